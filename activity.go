@@ -0,0 +1,207 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrNoActivityLog is returned from Activity when the
+//manager was not constructed WithActivityLog
+var ErrNoActivityLog = errors.New("manager has no activity log")
+
+//DefaultActivityLogSize is the default number of activities kept
+//for each session, used when an activity log's size is zero or less
+const DefaultActivityLogSize = 50
+
+//Activity records a request that resumed a session
+type Activity struct {
+	//Time is when the request was made
+	Time time.Time `json:"time"`
+	//Method is the request method
+	Method string `json:"method"`
+	//Path is the request URL path
+	Path string `json:"path"`
+	//RemoteAddr is the network address of the client
+	RemoteAddr string `json:"remoteAddr"`
+}
+
+//ActivityLog keeps the most recent activities for each session,
+//to support security reviews of compromised accounts
+type ActivityLog interface {
+	//Record adds the activity to the session's log, discarding
+	//the oldest activity if the log is full
+	Record(sessionID string, activity Activity) error
+	//Activities returns the session's activities, newest first
+	Activities(sessionID string) ([]Activity, error)
+	//Delete deletes the session's log, when the session ends
+	Delete(sessionID string) error
+}
+
+//memoryActivityLog is an in-memory ActivityLog
+type memoryActivityLog struct {
+	mx   sync.Mutex
+	size int
+	logs map[string][]Activity
+}
+
+//NewMemoryActivityLog constructs a new ActivityLog that keeps the
+//most recent size activities for each session in memory, or
+//DefaultActivityLogSize activities if size is zero or less. Logs
+//are not shared between processes, and are discarded only when
+//their sessions end, so use NewRedisActivityLog in production.
+func NewMemoryActivityLog(size int) ActivityLog {
+	if size <= 0 {
+		size = DefaultActivityLogSize
+	}
+	return &memoryActivityLog{
+		size: size,
+		logs: make(map[string][]Activity),
+	}
+}
+
+//Record adds the activity to the session's log
+func (mal *memoryActivityLog) Record(sessionID string, activity Activity) error {
+	mal.mx.Lock()
+	defer mal.mx.Unlock()
+	log := append([]Activity{activity}, mal.logs[sessionID]...)
+	if len(log) > mal.size {
+		log = log[:mal.size]
+	}
+	mal.logs[sessionID] = log
+	return nil
+}
+
+//Activities returns the session's activities, newest first
+func (mal *memoryActivityLog) Activities(sessionID string) ([]Activity, error) {
+	mal.mx.Lock()
+	defer mal.mx.Unlock()
+	return append([]Activity(nil), mal.logs[sessionID]...), nil
+}
+
+//Delete deletes the session's log
+func (mal *memoryActivityLog) Delete(sessionID string) error {
+	mal.mx.Lock()
+	defer mal.mx.Unlock()
+	delete(mal.logs, sessionID)
+	return nil
+}
+
+//DefaultRedisActivityKeyPrefix is the default prefix added to
+//session IDs to form the redis keys of activity logs
+const DefaultRedisActivityKeyPrefix = "activity:"
+
+//RedisActivityLog is an ActivityLog backed by redis. Each session's
+//log is a capped list of JSON-encoded activities.
+type RedisActivityLog struct {
+	//Prefix added to session IDs to form redis keys.
+	//Defaults to DefaultRedisActivityKeyPrefix, but
+	//callers may adjust this after construction.
+	KeyPrefix string
+	//Used for key expiry time on redis, which is reset each
+	//time an activity is recorded. Defaults to the session
+	//duration passed to NewRedisActivityLog. Zero means the logs
+	//never expire. Callers may adjust this after construction.
+	LogDuration time.Duration
+	//size is the number of activities kept for each session
+	size int
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//NewRedisActivityLog constructs a new RedisActivityLog that keeps the
+//most recent size activities for each session, or DefaultActivityLogSize
+//activities if size is zero or less. Each log expires sessionDuration
+//after its session was last active, like the session state itself.
+func NewRedisActivityLog(pool *redis.Pool, size int, sessionDuration time.Duration) *RedisActivityLog {
+	if size <= 0 {
+		size = DefaultActivityLogSize
+	}
+	return &RedisActivityLog{
+		KeyPrefix:   DefaultRedisActivityKeyPrefix,
+		LogDuration: sessionDuration,
+		size:        size,
+		pool:        pool,
+	}
+}
+
+//Record adds the activity to the session's log
+func (ral *RedisActivityLog) Record(sessionID string, activity Activity) error {
+	v, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error encoding activity: %v", err)
+	}
+	conn := ral.pool.Get()
+	defer conn.Close()
+
+	//push the activity and trim the list in one transaction
+	key := ral.KeyPrefix + sessionID
+	conn.Send("MULTI")
+	conn.Send("LPUSH", key, v)
+	conn.Send("LTRIM", key, 0, ral.size-1)
+	if ral.LogDuration > 0 {
+		conn.Send("EXPIRE", key, int64(ral.LogDuration.Seconds()))
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("error recording activity: %v", err)
+	}
+	return nil
+}
+
+//Activities returns the session's activities, newest first
+func (ral *RedisActivityLog) Activities(sessionID string) ([]Activity, error) {
+	conn := ral.pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("LRANGE", ral.KeyPrefix+sessionID, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("error executing LRANGE: %v", err)
+	}
+	activities := make([]Activity, len(values))
+	for i, v := range values {
+		if err := json.Unmarshal(v, &activities[i]); err != nil {
+			return nil, fmt.Errorf("error decoding activity: %v", err)
+		}
+	}
+	return activities, nil
+}
+
+//Delete deletes the session's log
+func (ral *RedisActivityLog) Delete(sessionID string) error {
+	conn := ral.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("DEL", ral.KeyPrefix+sessionID); err != nil {
+		return fmt.Errorf("error executing DEL: %v", err)
+	}
+	return nil
+}
+
+//Activity returns the most recent activities for the session with the
+//given ID, newest first. The manager must be constructed WithActivityLog,
+//or ErrNoActivityLog is returned.
+func (m *manager) Activity(sessionID string) ([]Activity, error) {
+	if m.activity == nil {
+		return nil, ErrNoActivityLog
+	}
+	return m.activity.Activities(sessionID)
+}
+
+//recordActivity records the request in the manager's activity log.
+//Sessions resumed without a request aren't recorded. The log is
+//best-effort, so an outage doesn't prevent sessions being resumed.
+func (m *manager) recordActivity(r *http.Request, token Token) {
+	if m.activity == nil || r == nil {
+		return
+	}
+	activity := Activity{
+		Time:       time.Now(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+	}
+	m.activity.Record(token.ID().String(), activity)
+}
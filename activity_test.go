@@ -0,0 +1,160 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestMemoryActivityLog(t *testing.T) {
+	log := NewMemoryActivityLog(2)
+	for i := 0; i < 3; i++ {
+		if err := log.Record("a", Activity{Path: fmt.Sprintf("/%d", i)}); err != nil {
+			t.Fatalf("unexpected error recording activity: %v", err)
+		}
+	}
+	activities, err := log.Activities("a")
+	if err != nil {
+		t.Fatalf("unexpected error getting activities: %v", err)
+	}
+	if len(activities) != 2 || activities[0].Path != "/2" || activities[1].Path != "/1" {
+		t.Errorf("incorrect activities: %v", activities)
+	}
+	if activities, _ := log.Activities("b"); len(activities) != 0 {
+		t.Errorf("incorrect activities for unknown session: %v", activities)
+	}
+	if err := log.Delete("a"); err != nil {
+		t.Errorf("unexpected error deleting log: %v", err)
+	}
+	if activities, _ := log.Activities("a"); len(activities) != 0 {
+		t.Errorf("activities remain after deleting log: %v", activities)
+	}
+
+	//a size of zero or less should keep the default number of activities
+	log = NewMemoryActivityLog(0)
+	for i := 0; i < DefaultActivityLogSize+1; i++ {
+		log.Record("a", Activity{Path: fmt.Sprintf("/%d", i)})
+	}
+	if activities, _ := log.Activities("a"); len(activities) != DefaultActivityLogSize {
+		t.Errorf("incorrect number of activities: expected %d but got %d", DefaultActivityLogSize, len(activities))
+	}
+}
+
+func TestRedisActivityLog(t *testing.T) {
+	conn := redigomock.NewConn()
+	log := NewRedisActivityLog(getMockPool(conn), 2, time.Hour)
+
+	conn.Command("MULTI").Expect("OK")
+	conn.Command("LPUSH", "activity:a", redigomock.NewAnyData()).Expect("QUEUED")
+	conn.Command("LTRIM", "activity:a", 0, 1).Expect("QUEUED")
+	conn.Command("EXPIRE", "activity:a", int64(3600)).Expect("QUEUED")
+	conn.Command("EXEC").Expect([]interface{}{int64(1), "OK", int64(1)})
+	if err := log.Record("a", Activity{Method: "GET", Path: "/"}); err != nil {
+		t.Errorf("unexpected error recording activity: %v", err)
+	}
+
+	conn.Command("LRANGE", "activity:a", 0, -1).Expect([]interface{}{[]byte(`{"method":"GET","path":"/"}`)})
+	activities, err := log.Activities("a")
+	if err != nil {
+		t.Errorf("unexpected error getting activities: %v", err)
+	}
+	if len(activities) != 1 || activities[0].Path != "/" {
+		t.Errorf("incorrect activities: %v", activities)
+	}
+
+	conn.Command("DEL", "activity:a").Expect(int64(1))
+	if err := log.Delete("a"); err != nil {
+		t.Errorf("unexpected error deleting log: %v", err)
+	}
+
+	//a size of zero or less should keep the default number of activities
+	conn.Clear()
+	log = NewRedisActivityLog(getMockPool(conn), 0, time.Hour)
+	conn.Command("MULTI").Expect("OK")
+	conn.Command("LPUSH", "activity:a", redigomock.NewAnyData()).Expect("QUEUED")
+	trim := conn.Command("LTRIM", "activity:a", 0, DefaultActivityLogSize-1).Expect("QUEUED")
+	conn.Command("EXPIRE", "activity:a", int64(3600)).Expect("QUEUED")
+	conn.Command("EXEC").Expect([]interface{}{int64(1), "OK", int64(1)})
+	if err := log.Record("a", Activity{Method: "GET", Path: "/"}); err != nil {
+		t.Errorf("unexpected error recording activity: %v", err)
+	}
+	if conn.Stats(trim) != 1 {
+		t.Error("list was not trimmed to the default size")
+	}
+
+	conn.Clear()
+	conn.Command("LRANGE", "activity:a", 0, -1).ExpectError(fmt.Errorf("test error"))
+	if _, err := log.Activities("a"); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+//failingActivityLog is an ActivityLog whose Record always fails
+type failingActivityLog struct {
+	ActivityLog
+}
+
+func (fal failingActivityLog) Record(sessionID string, activity Activity) error {
+	return fmt.Errorf("test error")
+}
+
+func TestManagerActivity(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithActivityLog(NewMemoryActivityLog(DefaultActivityLogSize)))
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	for _, path := range []string{"/a", "/b"} {
+		req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		var state string
+		if _, err := mgr.GetState(req, &state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+	}
+
+	activities, err := mgr.Activity(token.ID().String())
+	if err != nil {
+		t.Fatalf("unexpected error getting activity: %v", err)
+	}
+	if len(activities) != 2 || activities[0].Path != "/b" || activities[1].Path != "/a" {
+		t.Errorf("incorrect activities: %v", activities)
+	}
+	if activities[0].Method != "GET" || activities[0].Time.IsZero() || len(activities[0].RemoteAddr) == 0 {
+		t.Errorf("incomplete activity: %v", activities[0])
+	}
+
+	//ending the session should delete its log
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if activities, _ := mgr.Activity(token.ID().String()); len(activities) != 0 {
+		t.Errorf("activities remain after ending session: %v", activities)
+	}
+
+	//failing to record activity should not fail the request
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithActivityLog(failingActivityLog{NewMemoryActivityLog(DefaultActivityLogSize)}))
+	respRec = httptest.NewRecorder()
+	if _, err := mgr.BeginSession(respRec, "test state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	if _, err := mgr.Activity(token.ID().String()); err != ErrNoActivityLog {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoActivityLog, err)
+	}
+}
@@ -0,0 +1,237 @@
+/*Package adminapi provides an HTTP API for administering sessions
+managed by the github.com/davestearns/sessions package, such as
+reviewing a session's recent activity, or revoking a user's devices,
+and a single-page web UI for inspecting and revoking sessions.
+
+The API performs no authentication or authorization of its own, so
+always wrap it with middleware that ensures only administrators can
+reach it, and mount it under a prefix using http.StripPrefix:
+
+	mux.Handle("/admin/sessions/", requireAdmin(
+		http.StripPrefix("/admin/sessions", adminapi.Handler(mgr))))
+
+The API supports these requests:
+
+	GET    /sessions/{sessionID}/activity       the session's recent activity
+	DELETE /sessions/{sessionID}                revokes the session
+	GET    /users/{userID}/sessions             the user's sessions
+	DELETE /users/{userID}/sessions             revokes all the user's sessions
+	GET    /users/{userID}/devices              the user's devices
+	DELETE /users/{userID}/devices/{deviceID}   revokes the user's device
+
+The user's sessions are found using Options.UserSessions if set, such
+as the UserSessions method of a sessions.RedisStore with a user index,
+or otherwise from the current sessions of the user's devices.
+
+UIHandler serves the API along with the web UI, which searches for a
+user's sessions, shows their devices and recent activity, and revokes
+them. It requires an Options.Authorize function, which is called for
+every request:
+
+	mux.Handle("/admin/sessions/", http.StripPrefix("/admin/sessions",
+		adminapi.UIHandler(mgr, adminapi.Options{Authorize: isAdmin})))
+*/
+package adminapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/davestearns/sessions"
+)
+
+//Options controls the optional behavior of the admin API and UI
+type Options struct {
+	//Authorize reports whether the request may use the API or UI, such
+	//as by checking that it's from a signed-in administrator. Requests
+	//for which it returns false are rejected with 403 Forbidden. It is
+	//required by UIHandler, which rejects every request if it is nil.
+	Authorize func(r *http.Request) bool
+	//UserSessions returns the IDs of the user's sessions, such as the
+	//UserSessions method of a sessions.RedisStore with a user index.
+	//If nil, the current sessions of the user's devices are used.
+	UserSessions func(userID string) ([]string, error)
+}
+
+//UserSession describes one of a user's sessions
+type UserSession struct {
+	//SessionID is the string version of the session's ID
+	SessionID string `json:"sessionID"`
+	//Device is the device the session belongs to, if known
+	Device *sessions.Device `json:"device,omitempty"`
+}
+
+//handler is the http.Handler for the admin API
+type handler struct {
+	mgr  sessions.Manager
+	opts Options
+}
+
+//Handler returns an http.Handler that serves the admin API for mgr
+func Handler(mgr sessions.Manager) http.Handler {
+	return &handler{mgr: mgr}
+}
+
+//HandlerWithOptions is like Handler, but uses opts. If opts.Authorize
+//is set, requests for which it returns false are rejected.
+func HandlerWithOptions(mgr sessions.Manager, opts Options) http.Handler {
+	return &handler{mgr: mgr, opts: opts}
+}
+
+//ServeHTTP routes the request to the appropriate method
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Authorize != nil && !h.opts.Authorize(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 2 && segments[0] == "sessions":
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		h.revokeSession(w, r, segments[1])
+	case len(segments) == 3 && segments[0] == "users" && segments[2] == "sessions":
+		switch r.Method {
+		case http.MethodGet:
+			h.userSessions(w, r, segments[1])
+		case http.MethodDelete:
+			h.revokeUser(w, r, segments[1])
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(segments) == 3 && segments[0] == "sessions" && segments[2] == "activity":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		h.activity(w, r, segments[1])
+	case len(segments) == 3 && segments[0] == "users" && segments[2] == "devices":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		h.devices(w, r, segments[1])
+	case len(segments) == 4 && segments[0] == "users" && segments[2] == "devices":
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		h.revokeDevice(w, r, segments[1], segments[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//activity responds with the session's recent activity
+func (h *handler) activity(w http.ResponseWriter, r *http.Request, sessionID string) {
+	activities, err := h.mgr.Activity(sessionID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, activities)
+}
+
+//devices responds with the user's devices
+func (h *handler) devices(w http.ResponseWriter, r *http.Request, userID string) {
+	devices, err := h.mgr.Devices(userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, devices)
+}
+
+//revokeSession revokes the session
+func (h *handler) revokeSession(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if err := h.mgr.Revoke(sessions.IDToken(sessionID)); err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//userSessions responds with the user's sessions, along with
+//the devices they belong to, if the manager records devices
+func (h *handler) userSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	devices, err := h.mgr.Devices(userID)
+	if err != nil && (err != sessions.ErrNoDeviceRegistry || h.opts.UserSessions == nil) {
+		respondError(w, err)
+		return
+	}
+	bySession := make(map[string]*sessions.Device, len(devices))
+	for i := range devices {
+		if len(devices[i].SessionID) > 0 {
+			bySession[devices[i].SessionID] = &devices[i]
+		}
+	}
+
+	var ids []string
+	if h.opts.UserSessions != nil {
+		if ids, err = h.opts.UserSessions(userID); err != nil {
+			respondError(w, err)
+			return
+		}
+	} else {
+		for i := range devices {
+			if len(devices[i].SessionID) > 0 {
+				ids = append(ids, devices[i].SessionID)
+			}
+		}
+	}
+	userSessions := make([]UserSession, len(ids))
+	for i, id := range ids {
+		userSessions[i] = UserSession{SessionID: id, Device: bySession[id]}
+	}
+	respondJSON(w, userSessions)
+}
+
+//revokeUser revokes all the user's sessions
+func (h *handler) revokeUser(w http.ResponseWriter, r *http.Request, userID string) {
+	if err := h.mgr.RevokeUser(userID); err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//revokeDevice revokes the user's device
+func (h *handler) revokeDevice(w http.ResponseWriter, r *http.Request, userID string, deviceID string) {
+	if err := h.mgr.RevokeDevice(userID, deviceID); err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//allowMethod responds with a 405 error and returns false
+//if the request method is not the allowed method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+//respondJSON writes v to the response as JSON
+func respondJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+//respondError writes an error response with
+//an appropriate status code for err
+func respondError(w http.ResponseWriter, err error) {
+	switch err {
+	case sessions.ErrDeviceNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case sessions.ErrNoActivityLog, sessions.ErrNoDeviceRegistry, sessions.ErrNoEpochStore,
+		sessions.ErrUserIndexDisabled:
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, "error processing request", http.StatusInternalServerError)
+	}
+}
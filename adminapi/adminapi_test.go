@@ -0,0 +1,250 @@
+package adminapi
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/davestearns/sessions"
+)
+
+type mapStore struct {
+	mx      sync.Mutex
+	entries map[string][]byte
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{entries: make(map[string][]byte)}
+}
+
+func (ms *mapStore) Save(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return err
+	}
+	ms.entries[token.ID().String()] = buf.Bytes()
+	return nil
+}
+
+func (ms *mapStore) Get(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	val, found := ms.entries[token.ID().String()]
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState)
+}
+
+func (ms *mapStore) Delete(token sessions.Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.entries, token.ID().String())
+	return nil
+}
+
+type deviceState struct {
+	UserID   string
+	DeviceID string
+}
+
+func (ds *deviceState) SessionUserID() string {
+	return ds.UserID
+}
+
+func (ds *deviceState) SessionDevice() sessions.Device {
+	return sessions.Device{ID: ds.DeviceID}
+}
+
+func TestHandler(t *testing.T) {
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, newMapStore(),
+		sessions.WithActivityLog(sessions.NewMemoryActivityLog(sessions.DefaultActivityLogSize)),
+		sessions.WithDeviceRegistry(sessions.NewMemoryDeviceRegistry()))
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, &deviceState{"user1", "phone"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com/orders", nil)
+	req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+	if _, err := mgr.GetState(req, &deviceState{}); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedLen    int
+	}{
+		{"activity", "GET", "/sessions/" + token.ID().String() + "/activity", http.StatusOK, 1},
+		{"devices", "GET", "/users/user1/devices", http.StatusOK, 1},
+		{"no devices", "GET", "/users/user2/devices", http.StatusOK, 0},
+		{"wrong method", "POST", "/users/user1/devices", http.StatusMethodNotAllowed, -1},
+		{"unknown path", "GET", "/sessions", http.StatusNotFound, -1},
+		{"revoke unknown device", "DELETE", "/users/user1/devices/tablet", http.StatusNotFound, -1},
+		{"revoke device", "DELETE", "/users/user1/devices/phone", http.StatusNoContent, -1},
+		{"devices after revoking", "GET", "/users/user1/devices", http.StatusOK, 0},
+	}
+
+	handler := Handler(mgr)
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, httptest.NewRequest(c.method, c.path, nil))
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status code: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if c.expectedLen < 0 {
+			continue
+		}
+		var results []map[string]interface{}
+		if err := json.Unmarshal(respRec.Body.Bytes(), &results); err != nil {
+			t.Errorf("case %s: error decoding response: %v", c.name, err)
+		}
+		if len(results) != c.expectedLen {
+			t.Errorf("case %s: incorrect number of results: expected %d but got %d", c.name, c.expectedLen, len(results))
+		}
+	}
+
+	//features that aren't enabled should respond with 501
+	handler = Handler(sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, newMapStore()))
+	respRec = httptest.NewRecorder()
+	handler.ServeHTTP(respRec, httptest.NewRequest("GET", "/users/user1/devices", nil))
+	if respRec.Code != http.StatusNotImplemented {
+		t.Errorf("incorrect status code: expected %d but got %d", http.StatusNotImplemented, respRec.Code)
+	}
+}
+
+func TestHandlerUserSessions(t *testing.T) {
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, newMapStore(),
+		sessions.WithDeviceRegistry(sessions.NewMemoryDeviceRegistry()),
+		sessions.WithEpochStore(sessions.NewMemoryEpochStore()))
+	phone, err := mgr.BeginSession(nil, &deviceState{"user1", "phone"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	laptop, err := mgr.BeginSession(nil, &deviceState{"user1", "laptop"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	cases := []struct {
+		name           string
+		opts           Options
+		method         string
+		path           string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{"from devices", Options{}, "GET", "/users/user1/sessions", http.StatusOK, nil},
+		{"from user index", Options{UserSessions: func(userID string) ([]string, error) {
+			return []string{phone.ID().String(), "unknown"}, nil
+		}}, "GET", "/users/user1/sessions", http.StatusOK, []string{phone.ID().String(), "unknown"}},
+		{"unauthorized", Options{Authorize: func(*http.Request) bool { return false }},
+			"GET", "/users/user1/sessions", http.StatusForbidden, nil},
+		{"wrong method", Options{}, "PUT", "/users/user1/sessions", http.StatusMethodNotAllowed, nil},
+		{"revoke session", Options{}, "DELETE", "/sessions/" + laptop.ID().String(), http.StatusNoContent, nil},
+		{"revoke user", Options{}, "DELETE", "/users/user1/sessions", http.StatusNoContent, nil},
+	}
+
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		HandlerWithOptions(mgr, c.opts).ServeHTTP(respRec, httptest.NewRequest(c.method, c.path, nil))
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status code: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if c.expectedIDs == nil {
+			continue
+		}
+		var results []UserSession
+		if err := json.Unmarshal(respRec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("case %s: error decoding response: %v", c.name, err)
+		}
+		if len(results) != len(c.expectedIDs) {
+			t.Fatalf("case %s: incorrect number of results: expected %d but got %d", c.name, len(c.expectedIDs), len(results))
+		}
+		for i, id := range c.expectedIDs {
+			if results[i].SessionID != id {
+				t.Errorf("case %s: incorrect session ID: expected %s but got %s", c.name, id, results[i].SessionID)
+			}
+		}
+		if results[0].Device == nil || results[0].Device.ID != "phone" || results[1].Device != nil {
+			t.Errorf("case %s: incorrect devices: %+v, %+v", c.name, results[0].Device, results[1].Device)
+		}
+	}
+
+	//sessions should be listed from the user's devices
+	respRec := httptest.NewRecorder()
+	Handler(mgr).ServeHTTP(respRec, httptest.NewRequest("GET", "/users/user1/sessions", nil))
+	var results []UserSession
+	if err := json.Unmarshal(respRec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(results) != 2 || results[0].Device == nil || results[1].Device == nil {
+		t.Errorf("incorrect sessions from devices: %+v", results)
+	}
+
+	//revoked sessions should no longer be usable
+	for _, tk := range []sessions.Token{phone, laptop} {
+		if _, err := mgr.GetStateByToken(tk.String(), &deviceState{}); err == nil {
+			t.Errorf("revoked session %s was still usable", tk.ID())
+		}
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, newMapStore(),
+		sessions.WithDeviceRegistry(sessions.NewMemoryDeviceRegistry()))
+	isAdmin := func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+
+	cases := []struct {
+		name                string
+		opts                Options
+		method              string
+		path                string
+		admin               bool
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{"page", Options{Authorize: isAdmin}, "GET", "/", true, http.StatusOK, "text/html; charset=utf-8"},
+		{"page without slash", Options{Authorize: isAdmin}, "GET", "", true, http.StatusOK, "text/html; charset=utf-8"},
+		{"script", Options{Authorize: isAdmin}, "GET", "/ui.js", true, http.StatusOK, "text/javascript; charset=utf-8"},
+		{"styles", Options{Authorize: isAdmin}, "GET", "/ui.css", true, http.StatusOK, "text/css; charset=utf-8"},
+		{"api", Options{Authorize: isAdmin}, "GET", "/users/user1/sessions", true, http.StatusOK, "application/json"},
+		{"page not admin", Options{Authorize: isAdmin}, "GET", "/", false, http.StatusForbidden, ""},
+		{"api not admin", Options{Authorize: isAdmin}, "GET", "/users/user1/sessions", false, http.StatusForbidden, ""},
+		{"no authorize", Options{}, "GET", "/", true, http.StatusForbidden, ""},
+		{"no authorize api", Options{}, "GET", "/users/user1/sessions", true, http.StatusForbidden, ""},
+		{"wrong method", Options{Authorize: isAdmin}, "POST", "/", true, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com/", nil)
+		req.URL.Path = c.path
+		if c.admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		respRec := httptest.NewRecorder()
+		UIHandler(mgr, c.opts).ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status code: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if ct := respRec.Header().Get("Content-Type"); len(c.expectedContentType) > 0 && ct != c.expectedContentType {
+			t.Errorf("case %s: incorrect content type: expected %s but got %s", c.name, c.expectedContentType, ct)
+		}
+		if c.expectedStatus == http.StatusOK && c.expectedContentType != "application/json" &&
+			len(respRec.Header().Get("Content-Security-Policy")) == 0 {
+			t.Errorf("case %s: missing Content-Security-Policy header", c.name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package adminapi
+
+import (
+	"embed"
+	"net/http"
+
+	"github.com/davestearns/sessions"
+)
+
+//uiFiles holds the web UI's page, script and styles
+//
+//go:embed ui/index.html ui/ui.js ui/ui.css
+var uiFiles embed.FS
+
+//uiContentTypes maps the paths of the UI's files, relative
+//to the handler, to their names and content types
+var uiContentTypes = map[string][2]string{
+	"/":       {"ui/index.html", "text/html; charset=utf-8"},
+	"/ui.js":  {"ui/ui.js", "text/javascript; charset=utf-8"},
+	"/ui.css": {"ui/ui.css", "text/css; charset=utf-8"},
+}
+
+//uiContentSecurityPolicy allows the UI to load only its own
+//script and styles, and to make requests only to the API
+const uiContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"connect-src 'self'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+//UIHandler returns an http.Handler that serves a single-page web UI for
+//searching for a user's sessions, viewing their devices and recent activity,
+//and revoking them, along with the admin API it uses. Mount it under a
+//prefix ending with a slash using http.StripPrefix, as the UI requests
+//the API relative to its own URL. Every request is passed to
+//opts.Authorize, which is required, and requests for which it returns
+//false are rejected with 403 Forbidden, as are all requests if it is nil.
+func UIHandler(mgr sessions.Manager, opts Options) http.Handler {
+	authorize := opts.Authorize
+	if authorize == nil {
+		authorize = func(*http.Request) bool { return false }
+	}
+	opts.Authorize = authorize
+	api := HandlerWithOptions(mgr, opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) == 0 {
+			path = "/"
+		}
+		file, isUI := uiContentTypes[path]
+		if !isUI {
+			api.ServeHTTP(w, r)
+			return
+		}
+		if !authorize(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		buf, err := uiFiles.ReadFile(file[0])
+		if err != nil {
+			http.Error(w, "error reading UI file", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", file[1])
+		w.Header().Set("Content-Security-Policy", uiContentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf)
+	})
+}
@@ -0,0 +1,122 @@
+"use strict";
+
+//the API is served relative to the page, wherever it's mounted
+var api = function(path, method) {
+	return fetch(path, {method: method || "GET", credentials: "same-origin"}).then(function(resp) {
+		if (!resp.ok) {
+			return resp.text().then(function(text) {
+				throw new Error(text.trim() || resp.statusText);
+			});
+		}
+		return resp.status === 204 ? null : resp.json();
+	});
+};
+
+var $ = function(id) { return document.getElementById(id); };
+
+var setStatus = function(message, isError) {
+	$("status").textContent = message || "";
+	$("status").className = isError ? "error" : "";
+};
+
+var formatTime = function(t) {
+	return t && !t.startsWith("0001-") ? new Date(t).toLocaleString() : "";
+};
+
+//cell appends a cell containing text to the row
+var cell = function(row, text) {
+	var td = row.insertCell();
+	td.textContent = text || "";
+	return td;
+};
+
+var button = function(label, className, onclick) {
+	var b = document.createElement("button");
+	b.type = "button";
+	b.textContent = label;
+	b.className = className || "";
+	b.addEventListener("click", onclick);
+	return b;
+};
+
+var currentUser = "";
+
+var search = function(userID) {
+	currentUser = userID;
+	$("activity").hidden = true;
+	setStatus("Searching...");
+	api("users/" + encodeURIComponent(userID) + "/sessions").then(function(sessions) {
+		var tbody = $("sessions");
+		tbody.textContent = "";
+		sessions.forEach(function(s) {
+			var row = tbody.insertRow();
+			var device = s.device || {};
+			var id = cell(row, "");
+			var code = document.createElement("code");
+			code.textContent = s.sessionID;
+			id.appendChild(code);
+			cell(row, device.name || device.id);
+			cell(row, device.platform);
+			cell(row, formatTime(device.firstSeen));
+			cell(row, formatTime(device.lastSeen));
+			var actions = cell(row, "");
+			actions.appendChild(button("Activity", "", function() { showActivity(s.sessionID); }));
+			actions.appendChild(document.createTextNode(" "));
+			actions.appendChild(button("Revoke", "danger", function() { revokeSession(s.sessionID); }));
+		});
+		$("results-user").textContent = userID;
+		$("results").hidden = false;
+		setStatus(sessions.length === 1 ? "1 session found." : sessions.length + " sessions found.");
+	}).catch(function(err) {
+		$("results").hidden = true;
+		setStatus("Error finding sessions: " + err.message, true);
+	});
+};
+
+var showActivity = function(sessionID) {
+	api("sessions/" + encodeURIComponent(sessionID) + "/activity").then(function(activities) {
+		var tbody = $("activities");
+		tbody.textContent = "";
+		activities.forEach(function(a) {
+			var row = tbody.insertRow();
+			cell(row, formatTime(a.time));
+			cell(row, a.method);
+			cell(row, a.path);
+			cell(row, a.remoteAddr);
+		});
+		$("activity-session").textContent = sessionID;
+		$("activity").hidden = false;
+	}).catch(function(err) {
+		setStatus("Error getting activity: " + err.message, true);
+	});
+};
+
+var revokeSession = function(sessionID) {
+	if (!confirm("Revoke session " + sessionID + "?")) {
+		return;
+	}
+	api("sessions/" + encodeURIComponent(sessionID), "DELETE").then(function() {
+		search(currentUser);
+	}).catch(function(err) {
+		setStatus("Error revoking session: " + err.message, true);
+	});
+};
+
+$("revoke-user").addEventListener("click", function() {
+	if (!confirm("Revoke all sessions for " + currentUser + "?")) {
+		return;
+	}
+	api("users/" + encodeURIComponent(currentUser) + "/sessions", "DELETE").then(function() {
+		search(currentUser);
+	}).catch(function(err) {
+		setStatus("Error revoking sessions: " + err.message, true);
+	});
+});
+
+$("search").addEventListener("submit", function(evt) {
+	evt.preventDefault();
+	var userID = $("user").value.trim();
+	if (userID) {
+		search(userID);
+	}
+});
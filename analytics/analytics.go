@@ -0,0 +1,305 @@
+/*Package analytics maintains approximate counts of active sessions in
+redis, for product dashboards that need to know how many sessions were
+active in each minute, hour, or day, without scanning session keys. Each
+time bucket is a redis HyperLogLog, which counts distinct sessions to
+within about 1% using at most 12KB per bucket. To count sessions from a
+sessions.Manager, subscribe the counter's Send method:
+
+	counter := analytics.New(pool)
+	mgr.Subscribe(counter.Send)
+
+Send records the event in redis before returning, so to keep that round
+trip out of the request path, wrap the counter in a sessions.AsyncEventSink:
+
+	sink := sessions.NewAsyncEventSink(counter, 4096)
+	mgr.Subscribe(sink.Send)
+
+Counts can be queried using Count, Unique, and Series, or over HTTP
+using the Handler, which supports requests such as:
+
+	GET /?resolution=minute&from=2024-01-02T15:04:00Z&to=2024-01-02T16:04:00Z
+
+The from and to parameters are RFC 3339 times, and default to the last
+hour. The response is a JSON array of Points.
+*/
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davestearns/sessions"
+	"github.com/gomodule/redigo/redis"
+)
+
+//DefaultKeyPrefix is the default prefix added
+//to the redis keys of time buckets
+const DefaultKeyPrefix = "analytics:"
+
+//MaxSeriesPoints is the maximum number of points
+//that Series returns in a single call
+const MaxSeriesPoints = 1440
+
+//Resolution is the length of the time buckets
+//in which active sessions are counted
+type Resolution string
+
+//Supported resolutions
+const (
+	Minute Resolution = "minute"
+	Hour   Resolution = "hour"
+	Day    Resolution = "day"
+)
+
+//resolutions are all of the supported resolutions
+var resolutions = []Resolution{Minute, Hour, Day}
+
+//Duration returns the length of the resolution's time buckets
+func (res Resolution) Duration() time.Duration {
+	switch res {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	case Day:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+//DefaultRetention is how long the time buckets of each
+//resolution are retained in redis unless adjusted
+var DefaultRetention = map[Resolution]time.Duration{
+	Minute: 48 * time.Hour,
+	Hour:   31 * 24 * time.Hour,
+	Day:    400 * 24 * time.Hour,
+}
+
+//Point is the number of distinct sessions
+//active during the time bucket beginning at Time
+type Point struct {
+	//Time is the start of the time bucket, in UTC
+	Time time.Time `json:"time"`
+	//Count is the approximate number of distinct active sessions
+	Count int64 `json:"count"`
+}
+
+//Counter counts active sessions in redis
+type Counter struct {
+	//KeyPrefix is added to the redis keys of time buckets.
+	//Defaults to DefaultKeyPrefix, but callers may adjust
+	//this after construction.
+	KeyPrefix string
+	//Types are the event types that mark a session as active.
+	//Other event types are ignored. Callers may adjust this
+	//after construction.
+	Types []sessions.EventType
+	//Retention is how long the time buckets of each resolution are
+	//retained. Resolutions with no retention aren't counted. Defaults
+	//to a copy of DefaultRetention, but callers may adjust this after
+	//construction.
+	Retention map[Resolution]time.Duration
+	//OnError is called with any errors that occur while recording
+	//events in Send. Callers may set this after construction.
+	OnError func(err error)
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//New constructs a new Counter that counts active sessions using pool.
+//By default, sessions are active when they are created, accessed,
+//or updated.
+func New(pool *redis.Pool) *Counter {
+	retention := make(map[Resolution]time.Duration, len(DefaultRetention))
+	for res, d := range DefaultRetention {
+		retention[res] = d
+	}
+	return &Counter{
+		KeyPrefix: DefaultKeyPrefix,
+		Types:     []sessions.EventType{sessions.EventCreated, sessions.EventAccessed, sessions.EventUpdated},
+		Retention: retention,
+		pool:      pool,
+	}
+}
+
+//Send records that the event's session was active at the time
+//of the event, if the event's type is one of the counter's Types,
+//so that Counter is a sessions.EventSink
+func (c *Counter) Send(evt sessions.Event) {
+	for _, t := range c.Types {
+		if evt.Type == t {
+			if err := c.Record(evt.SessionID, evt.Time); err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+			return
+		}
+	}
+}
+
+//Record records that the member was active at time t, in the time
+//bucket of each retained resolution. Members are usually session IDs,
+//but callers may record other IDs, such as user IDs, with a separate
+//Counter using a different KeyPrefix.
+func (c *Counter) Record(member string, t time.Time) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	for _, res := range resolutions {
+		retention := c.Retention[res]
+		if retention <= 0 {
+			continue
+		}
+		bucket := bucketStart(res, t)
+		key := c.key(res, bucket)
+		conn.Send("PFADD", key, member)
+		//expire the bucket relative to its end, so that late
+		//events don't extend the retention of old buckets
+		conn.Send("EXPIREAT", key, bucket.Add(res.Duration()+retention).Unix())
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("error recording active session: %v", err)
+	}
+	return nil
+}
+
+//Count returns the approximate number of distinct sessions
+//active during the time bucket of the resolution containing t
+func (c *Counter) Count(res Resolution, t time.Time) (int64, error) {
+	if res.Duration() == 0 {
+		return 0, fmt.Errorf("unsupported resolution %q", res)
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	count, err := redis.Int64(conn.Do("PFCOUNT", c.key(res, bucketStart(res, t))))
+	if err != nil {
+		return 0, fmt.Errorf("error executing PFCOUNT: %v", err)
+	}
+	return count, nil
+}
+
+//Unique returns the approximate number of distinct sessions active
+//at any time during the time buckets of the resolution from the
+//one containing from, through the one containing to. Sessions active
+//in several of those buckets are counted only once, so this is the
+//number of sessions active in a rolling window, such as the last
+//fifteen minutes.
+func (c *Counter) Unique(res Resolution, from time.Time, to time.Time) (int64, error) {
+	buckets, err := bucketRange(res, from, to)
+	if err != nil {
+		return 0, err
+	}
+	args := make([]interface{}, len(buckets))
+	for i, bucket := range buckets {
+		args[i] = c.key(res, bucket)
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	count, err := redis.Int64(conn.Do("PFCOUNT", args...))
+	if err != nil {
+		return 0, fmt.Errorf("error executing PFCOUNT: %v", err)
+	}
+	return count, nil
+}
+
+//Series returns the approximate number of distinct sessions active
+//during each time bucket of the resolution from the one containing
+//from, through the one containing to
+func (c *Counter) Series(res Resolution, from time.Time, to time.Time) ([]Point, error) {
+	buckets, err := bucketRange(res, from, to)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	for _, bucket := range buckets {
+		conn.Send("PFCOUNT", c.key(res, bucket))
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, fmt.Errorf("error executing PFCOUNT: %v", err)
+	}
+	points := make([]Point, len(buckets))
+	for i, bucket := range buckets {
+		count, err := redis.Int64(conn.Receive())
+		if err != nil {
+			return nil, fmt.Errorf("error executing PFCOUNT: %v", err)
+		}
+		points[i] = Point{Time: bucket, Count: count}
+	}
+	return points, nil
+}
+
+//Handler returns an http.Handler that responds with the Series
+//requested in the query string, as described in the package docs
+func (c *Counter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		res := Minute
+		if len(query.Get("resolution")) > 0 {
+			res = Resolution(query.Get("resolution"))
+		}
+		to := time.Now()
+		from := to.Add(-time.Hour)
+		for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+			if value := query.Get(name); len(value) > 0 {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, "invalid "+name+" time: "+strconv.Quote(value), http.StatusBadRequest)
+					return
+				}
+				*t = parsed
+			}
+		}
+		if _, err := bucketRange(res, from, to); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		points, err := c.Series(res, from, to)
+		if err != nil {
+			http.Error(w, "error getting active sessions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(points)
+	})
+}
+
+//key returns the redis key of the time bucket
+func (c *Counter) key(res Resolution, bucket time.Time) string {
+	return c.KeyPrefix + string(res) + ":" + strconv.FormatInt(bucket.Unix(), 10)
+}
+
+//bucketStart returns the start of the resolution's
+//time bucket that contains t, in UTC
+func bucketStart(res Resolution, t time.Time) time.Time {
+	return t.UTC().Truncate(res.Duration())
+}
+
+//bucketRange returns the start of each of the resolution's time
+//buckets from the one containing from, through the one containing to
+func bucketRange(res Resolution, from time.Time, to time.Time) ([]time.Time, error) {
+	d := res.Duration()
+	if d == 0 {
+		return nil, fmt.Errorf("unsupported resolution %q", res)
+	}
+	start, end := bucketStart(res, from), bucketStart(res, to)
+	if end.Before(start) {
+		return nil, fmt.Errorf("from time is after to time")
+	}
+	n := int(end.Sub(start)/d) + 1
+	if n > MaxSeriesPoints {
+		return nil, fmt.Errorf("too many %s buckets: %d is more than %d", res, n, MaxSeriesPoints)
+	}
+	buckets := make([]time.Time, n)
+	for i := range buckets {
+		buckets[i] = start.Add(time.Duration(i) * d)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davestearns/sessions"
+)
+
+func TestCounter(t *testing.T) {
+	srv := miniredis.RunT(t)
+	counter := New(sessions.NewRedisPool(srv.Addr(), time.Minute))
+	var errs []error
+	counter.OnError = func(err error) { errs = append(errs, err) }
+
+	//buckets expire relative to their end, so record events
+	//four and a half minutes into the current hour
+	base := time.Now().UTC().Truncate(time.Hour).Add(4*time.Minute + 30*time.Second)
+	//session0 is active in both minutes, session1 only in the first,
+	//and session2 only in the second
+	events := []sessions.Event{
+		{Type: sessions.EventCreated, SessionID: "session0", Time: base},
+		{Type: sessions.EventAccessed, SessionID: "session0", Time: base.Add(10 * time.Second)},
+		{Type: sessions.EventUpdated, SessionID: "session1", Time: base},
+		{Type: sessions.EventAccessed, SessionID: "session0", Time: base.Add(time.Minute)},
+		{Type: sessions.EventAccessed, SessionID: "session2", Time: base.Add(time.Minute)},
+		{Type: sessions.EventEnded, SessionID: "session3", Time: base},
+	}
+	for _, evt := range events {
+		counter.Send(evt)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors recording events: %v", errs)
+	}
+
+	cases := []struct {
+		name     string
+		query    func() (int64, error)
+		expected int64
+	}{
+		{"first minute", func() (int64, error) { return counter.Count(Minute, base) }, 2},
+		{"second minute", func() (int64, error) { return counter.Count(Minute, base.Add(time.Minute)) }, 2},
+		{"empty minute", func() (int64, error) { return counter.Count(Minute, base.Add(-time.Minute)) }, 0},
+		{"hour", func() (int64, error) { return counter.Count(Hour, base) }, 3},
+		{"day", func() (int64, error) { return counter.Count(Day, base) }, 3},
+		//miniredis sums the counts of multiple keys, rather than counting
+		//their union as redis does, so this window contains no sessions
+		//that were active in more than one of its buckets
+		{"rolling window", func() (int64, error) { return counter.Unique(Minute, base.Add(-5*time.Minute), base) }, 2},
+	}
+	for _, c := range cases {
+		count, err := c.query()
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if count != c.expected {
+			t.Errorf("case %s: incorrect count: expected %d but got %d", c.name, c.expected, count)
+		}
+	}
+
+	//buckets should expire after their retention
+	key := counter.key(Minute, bucketStart(Minute, base))
+	if ttl := srv.TTL(key); ttl <= 0 {
+		t.Errorf("minute bucket has no expiry: %v", ttl)
+	}
+
+	points, err := counter.Series(Minute, base.Add(-time.Minute), base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error getting series: %v", err)
+	}
+	if fmt.Sprint(counts(points)) != "[0 2 2]" {
+		t.Errorf("incorrect series: %v", points)
+	}
+	if !points[0].Time.Equal(base.Truncate(time.Minute).Add(-time.Minute)) {
+		t.Errorf("incorrect start of series: %v", points[0].Time)
+	}
+	if _, err := counter.Series(Minute, base, base.Add(-time.Minute)); err == nil {
+		t.Error("did not receive expected error when from is after to")
+	}
+	if _, err := counter.Series(Minute, base, base.Add(MaxSeriesPoints*time.Minute)); err == nil {
+		t.Error("did not receive expected error requesting too many points")
+	}
+	if _, err := counter.Count("week", base); err == nil {
+		t.Error("did not receive expected error for unsupported resolution")
+	}
+}
+
+func counts(points []Point) []int64 {
+	counts := make([]int64, len(points))
+	for i, p := range points {
+		counts[i] = p.Count
+	}
+	return counts
+}
+
+func TestHandler(t *testing.T) {
+	srv := miniredis.RunT(t)
+	counter := New(sessions.NewRedisPool(srv.Addr(), time.Minute))
+	base := time.Now().UTC().Truncate(time.Hour).Add(4*time.Minute + 30*time.Second)
+	hour := base.Truncate(time.Hour)
+	if err := counter.Record("session0", base); err != nil {
+		t.Fatalf("unexpected error recording session: %v", err)
+	}
+	handler := counter.Handler()
+
+	cases := []struct {
+		name           string
+		method         string
+		query          url.Values
+		expectedStatus int
+		expectedCounts string
+	}{
+		{"hours", "GET", url.Values{"resolution": {"hour"}, "from": {hour.Add(-time.Hour).Format(time.RFC3339)}, "to": {hour.Add(time.Hour).Format(time.RFC3339)}}, http.StatusOK, "[0 1 0]"},
+		{"default resolution", "GET", url.Values{"from": {hour.Add(4 * time.Minute).Format(time.RFC3339)}, "to": {hour.Add(5 * time.Minute).Format(time.RFC3339)}}, http.StatusOK, "[1 0]"},
+		{"invalid time", "GET", url.Values{"from": {"yesterday"}}, http.StatusBadRequest, ""},
+		{"invalid resolution", "GET", url.Values{"resolution": {"week"}}, http.StatusBadRequest, ""},
+		{"invalid method", "POST", nil, http.StatusMethodNotAllowed, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com/?"+c.query.Encode(), nil)
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if c.expectedStatus != http.StatusOK {
+			continue
+		}
+		var points []Point
+		if err := json.Unmarshal(respRec.Body.Bytes(), &points); err != nil {
+			t.Errorf("case %s: error decoding response: %v", c.name, err)
+			continue
+		}
+		if fmt.Sprint(counts(points)) != c.expectedCounts {
+			t.Errorf("case %s: incorrect counts: expected %s but got %v", c.name, c.expectedCounts, counts(points))
+		}
+	}
+}
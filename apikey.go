@@ -0,0 +1,183 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//APIKeyPrefix begins every API key, which distinguishes
+//them from session tokens and makes them easy to spot
+//in logs and source code
+const APIKeyPrefix = "ak_"
+
+//apiKeyLabel is mixed into API key signatures, so that they can
+//never be confused with the signatures of sub-tokens or session tokens
+const apiKeyLabel = "sessions api key"
+
+//ErrAPIKeyExpired is returned when verifying an API key
+//whose time-to-live has elapsed
+var ErrAPIKeyExpired = errors.New("API key has expired")
+
+//ErrAPIKeyRevoked is returned when verifying an API key
+//whose user's sessions were revoked after it was issued,
+//or whose session was revoked
+var ErrAPIKeyRevoked = errors.New("API key has been revoked")
+
+//ErrNoUser is returned from NewAPIKey when the session
+//state doesn't identify a user
+var ErrNoUser = errors.New("session has no user")
+
+//APIKey describes a long-lived key minted from a user's session, which
+//scripts and other non-interactive clients can use in place of a session
+//token. API keys outlive the session they were minted from, but they are
+//linked to the user's logout epoch, so revoking the user's sessions with
+//RevokeUser also revokes all of the user's API keys issued before then.
+type APIKey struct {
+	//UserID is the ID of the user the key was issued to
+	UserID string `json:"uid"`
+	//SessionID is the string version of the ID of the
+	//session the key was minted from
+	SessionID string `json:"sid"`
+	//Scopes are the scopes granted to the key
+	Scopes []string `json:"scp,omitempty"`
+	//Issued is when the key was issued
+	Issued time.Time `json:"iat"`
+	//Expires is when the key expires
+	Expires time.Time `json:"exp"`
+}
+
+//HasScope reports whether the API key was granted scope
+func (ak *APIKey) HasScope(scope string) bool {
+	return contains(ak.Scopes, scope)
+}
+
+//NewAPIKey mints an API key for the user of the session identified by
+//token, granting only the provided scopes, and expiring after ttl. The
+//manager must be constructed WithEpochStore, or ErrNoEpochStore is returned,
+//and the session state must implement UserIdentifier, or ErrNoUser is
+//returned. Verify the returned key using a Verifier with the same
+//signing keys and EpochStore. If the EpochStore implements EpochRetainer,
+//ttl may not exceed its retention, as revoked keys would otherwise become
+//valid again once the user's epoch was forgotten.
+func (m *manager) NewAPIKey(token Token, ttl time.Duration, scopes ...string) (string, error) {
+	if m.epochs == nil {
+		return "", ErrNoEpochStore
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("API key time-to-live must be positive")
+	}
+	if er, ok := m.epochs.(EpochRetainer); ok && er.EpochRetention() > 0 && ttl > er.EpochRetention() {
+		return "", fmt.Errorf("API key time-to-live must not exceed the epoch retention of %v", er.EpochRetention())
+	}
+	_, key, err := m.keys.verify(token.String(), m.tokenOpts)
+	if err != nil {
+		return "", err
+	}
+	env, err := m.getState(token, nil)
+	if err != nil {
+		return "", getStateError(err)
+	}
+	if env.Pending {
+		return "", ErrSessionPending
+	}
+	if len(env.UserID) == 0 {
+		return "", ErrNoUser
+	}
+	now := time.Now()
+	payload, err := json.Marshal(&APIKey{
+		UserID:    env.UserID,
+		SessionID: token.ID().String(),
+		Scopes:    scopes,
+		Issued:    now,
+		Expires:   now.Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding API key: %v", err)
+	}
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signAPIKey(key, payload)), nil
+}
+
+//VerifyAPIKey verifies an API key minted by a Manager's NewAPIKey method,
+//ensuring that it hasn't expired, that its user's sessions haven't been
+//revoked since it was issued, and that it was granted all of the
+//requiredScopes. The Verifier's Epochs must be set to the EpochStore
+//used by the Manager, or ErrNoEpochStore is returned. If Revocations is
+//also set, keys minted from sessions that were revoked are rejected too,
+//though only for as long as the revocation list remembers the session,
+//so use RevokeUser to revoke API keys permanently.
+func (v *Verifier) VerifyAPIKey(apiKey string, requiredScopes ...string) (*APIKey, error) {
+	if v.Epochs == nil {
+		return nil, ErrNoEpochStore
+	}
+	if !strings.HasPrefix(apiKey, APIKeyPrefix) {
+		return nil, fmt.Errorf("invalid API key format")
+	}
+	dot := strings.IndexByte(apiKey, '.')
+	if dot < 0 {
+		return nil, fmt.Errorf("invalid API key format")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(apiKey[len(APIKeyPrefix):dot])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding API key: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(apiKey[dot+1:])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding API key signature: %v", err)
+	}
+	valid := false
+	for _, k := range v.keys.secrets() {
+		if hmac.Equal(sig, signAPIKey(k, payload)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("API key has been modified since signed")
+	}
+
+	ak := &APIKey{}
+	if err := json.Unmarshal(payload, ak); err != nil {
+		return nil, fmt.Errorf("error decoding API key: %v", err)
+	}
+	if time.Now().After(ak.Expires) {
+		return nil, ErrAPIKeyExpired
+	}
+	for _, scope := range requiredScopes {
+		if !ak.HasScope(scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+
+	epoch, err := v.Epochs.GetEpoch(ak.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting logout epoch: %v", err)
+	}
+	if !epoch.IsZero() && !ak.Issued.After(epoch) {
+		return nil, ErrAPIKeyRevoked
+	}
+	if v.Revocations != nil {
+		revoked, err := v.Revocations.IsRevoked(ak.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("error checking revocation list: %v", err)
+		}
+		if revoked {
+			return nil, ErrAPIKeyRevoked
+		}
+	}
+	return ak, nil
+}
+
+//signAPIKey returns the HMAC signature of the API key payload
+func signAPIKey(signingKey []byte, payload []byte) []byte {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte(apiKeyLabel))
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAPIKeys(t *testing.T) {
+	signingKeys := []string{"key1", "key2"}
+	epochs := NewMemoryEpochStore()
+	revocations := NewMemoryRevocationList()
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, signingKeys, store,
+		WithEpochStore(epochs), WithRevocationList(revocations))
+	begin := func(state interface{}) Token {
+		tk, err := mgr.BeginSession(httptest.NewRecorder(), state)
+		if err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		return tk
+	}
+	newKey := func(tk Token, scopes ...string) string {
+		key, err := mgr.NewAPIKey(tk, time.Hour, scopes...)
+		if err != nil {
+			t.Fatalf("unexpected error minting API key: %v", err)
+		}
+		return key
+	}
+
+	user1 := begin(&userState{"user1"})
+	user1Key := newKey(user1, "orders:read")
+	user2 := begin(&userState{"user2"})
+	user2Key := newKey(user2)
+	revokedSession := begin(&userState{"user2"})
+	revokedSessionKey := newKey(revokedSession)
+	if _, err := mgr.NewAPIKey(begin(&userState{}), time.Hour); err != ErrNoUser {
+		t.Errorf("incorrect error minting API key for anonymous session: expected %v but got %v", ErrNoUser, err)
+	}
+
+	//API keys should survive the end of their session,
+	//but not the revocation of their user or session
+	if err := store.Delete(user2); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if err := mgr.Revoke(revokedSession); err != nil {
+		t.Fatalf("unexpected error revoking session: %v", err)
+	}
+	if err := mgr.RevokeUser("user1"); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	user1Again := begin(&userState{"user1"})
+	user1NewKey := newKey(user1Again, "orders:read")
+
+	verifier := NewVerifier(signingKeys)
+	verifier.Epochs = epochs
+	verifier.Revocations = revocations
+	cases := []struct {
+		name           string
+		apiKey         string
+		requiredScopes []string
+		expectedError  error
+		expectError    bool
+	}{
+		{"key issued after user revoked", user1NewKey, []string{"orders:read"}, nil, false},
+		{"key outliving its session", user2Key, nil, nil, false},
+		{"insufficient scope", user1NewKey, []string{"orders:write"}, ErrInsufficientScope, true},
+		{"key issued before user revoked", user1Key, nil, ErrAPIKeyRevoked, true},
+		{"key from revoked session", revokedSessionKey, nil, ErrAPIKeyRevoked, true},
+		{"session token", user1Again.String(), nil, nil, true},
+		{"modified key", strings.Replace(user2Key, ".", "A.", 1), nil, nil, true},
+	}
+	for _, c := range cases {
+		ak, err := verifier.VerifyAPIKey(c.apiKey, c.requiredScopes...)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("case %s: did not receive expected error", c.name)
+			} else if c.expectedError != nil && err != c.expectedError {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if len(ak.UserID) == 0 {
+			t.Errorf("case %s: API key has no user ID", c.name)
+		}
+	}
+
+	//API keys can't be verified without an epoch store
+	if _, err := NewVerifier(signingKeys).VerifyAPIKey(user2Key); err != ErrNoEpochStore {
+		t.Errorf("incorrect error verifying without epoch store: expected %v but got %v", ErrNoEpochStore, err)
+	}
+	if _, err := NewManager(DefaultIDLength, signingKeys, newMockStore(false)).NewAPIKey(user2, time.Hour); err != ErrNoEpochStore {
+		t.Errorf("incorrect error minting without epoch store: expected %v but got %v", ErrNoEpochStore, err)
+	}
+}
+
+func TestAPIKeyEpochRetention(t *testing.T) {
+	srv := miniredis.RunT(t)
+	epochs := NewRedisEpochStore(NewRedisPool(srv.Addr(), time.Minute))
+	epochs.EpochDuration = time.Second
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithEpochStore(epochs))
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), &userState{"user1"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	//keys may not outlive the epochs that revoke them
+	if _, err := mgr.NewAPIKey(tk, 2*epochs.EpochDuration); err == nil {
+		t.Error("did not receive expected error minting API key that outlives the epoch")
+	}
+	key, err := mgr.NewAPIKey(tk, epochs.EpochDuration)
+	if err != nil {
+		t.Fatalf("unexpected error minting API key: %v", err)
+	}
+	if err := mgr.RevokeUser("user1"); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	verifier := NewVerifier([]string{string(testSigningKey)})
+	verifier.Epochs = epochs
+	if _, err := verifier.VerifyAPIKey(key); err != ErrAPIKeyRevoked {
+		t.Errorf("incorrect error: expected %v but got %v", ErrAPIKeyRevoked, err)
+	}
+
+	//once the epoch has expired, so has the key
+	srv.FastForward(epochs.EpochDuration)
+	time.Sleep(epochs.EpochDuration)
+	if _, err := verifier.VerifyAPIKey(key); err != ErrAPIKeyExpired {
+		t.Errorf("incorrect error after the epoch expired: expected %v but got %v", ErrAPIKeyExpired, err)
+	}
+}
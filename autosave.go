@@ -0,0 +1,81 @@
+package sessions
+
+import (
+	"bytes"
+	"net/http"
+)
+
+//Dirtier is implemented by session states that track whether they have
+//been changed, so that AutoSave doesn't need to compare encoded snapshots
+type Dirtier interface {
+	//SessionDirty reports whether the state has been
+	//changed since it was read from the store
+	SessionDirty() bool
+}
+
+//AutoSaveOptions controls how AutoSave loads and saves session state
+type AutoSaveOptions struct {
+	//NewState returns a pointer to a new, empty session state,
+	//into which AutoSave gets the session's state. It is required.
+	NewState func() interface{}
+	//OnError, if non-nil, is called with errors saving changed
+	//session state, which can't be reported to the client, as
+	//the handler has already written the response.
+	OnError func(r *http.Request, err error)
+}
+
+//AutoSave is middleware that gets the request's session state, adds it to
+//the request's context along with the token using NewContext, calls next,
+//and then saves the state using UpdateState if next changed it, so that
+//handlers can't forget to save their changes. The state is saved exactly
+//once, before the response is complete, even if next panics, in which case
+//the panic continues once the state is saved. Requests without a valid
+//session are passed to next unchanged. If next ends the session using
+//EndSession, or replaces it using BeginRequestSession or UpgradeSession,
+//such as when signing the user in or out, the state is not saved, so that
+//the ended session isn't recreated.
+//
+//If the state implements Dirtier, it decides whether the state changed.
+//Otherwise, the state is encoded using the DefaultCodec before and after
+//next is called, and is saved if the encodings differ.
+func AutoSave(m Manager, opts AutoSaveOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := opts.NewState()
+		tk, err := m.GetState(r, state)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, dirtier := state.(Dirtier)
+		var snapshot []byte
+		if !dirtier {
+			snapshot, _ = DefaultCodec.Encode(state)
+		}
+
+		ctx, replaced := trackReplaced(r.Context())
+		r = r.WithContext(NewContext(ctx, tk, state))
+		defer func() {
+			p := recover()
+			if !replaced.Load() && stateChanged(state, snapshot) {
+				if err := m.UpdateState(tk, state); err != nil && opts.OnError != nil {
+					opts.OnError(r, err)
+				}
+			}
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+//stateChanged reports whether the state has changed since the snapshot
+//was encoded, or whether it reports itself as dirty if it implements
+//Dirtier. If either encoding fails, the state is assumed to have changed.
+func stateChanged(state interface{}, snapshot []byte) bool {
+	if d, ok := state.(Dirtier); ok {
+		return d.SessionDirty()
+	}
+	current, err := DefaultCodec.Encode(state)
+	return snapshot == nil || err != nil || !bytes.Equal(current, snapshot)
+}
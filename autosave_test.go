@@ -0,0 +1,172 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type cartState struct {
+	Items []string
+}
+
+type dirtyState struct {
+	Count int
+	dirty bool
+}
+
+func (ds *dirtyState) SessionDirty() bool {
+	return ds.dirty
+}
+
+func TestAutoSave(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	updates := 0
+	mgr.Subscribe(func(e Event) {
+		if e.Type == EventUpdated {
+			updates++
+		}
+	})
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), &cartState{})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	opts := AutoSaveOptions{NewState: func() interface{} { return &cartState{} }}
+
+	cases := []struct {
+		name            string
+		handler         func(state *cartState)
+		expectPanic     bool
+		expectedUpdates int
+		expectedItems   int
+	}{
+		{"unchanged", func(state *cartState) {}, false, 0, 0},
+		{"changed", func(state *cartState) { state.Items = append(state.Items, "a") }, false, 1, 1},
+		{"changed then panicked", func(state *cartState) {
+			state.Items = append(state.Items, "b")
+			panic("test panic")
+		}, true, 1, 2},
+	}
+	for _, c := range cases {
+		updates = 0
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, _ := StateFromContext(r.Context())
+			c.handler(state.(*cartState))
+		})
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			AutoSave(mgr, opts, next).ServeHTTP(httptest.NewRecorder(), req)
+			return false
+		}()
+		if panicked != c.expectPanic {
+			t.Errorf("case %s: incorrect panic: expected %t but got %t", c.name, c.expectPanic, panicked)
+		}
+		if updates != c.expectedUpdates {
+			t.Errorf("case %s: incorrect number of updates: expected %d but got %d", c.name, c.expectedUpdates, updates)
+		}
+		saved := &cartState{}
+		store.Get(tk, saved)
+		if len(saved.Items) != c.expectedItems {
+			t.Errorf("case %s: incorrect saved items: expected %d but got %v", c.name, c.expectedItems, saved.Items)
+		}
+	}
+
+	//sessions ended or replaced by the handler should not be recreated
+	endCases := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request) error
+	}{
+		{"ended", func(w http.ResponseWriter, r *http.Request) error {
+			return mgr.EndSession(r)
+		}},
+		{"replaced", func(w http.ResponseWriter, r *http.Request) error {
+			_, err := mgr.BeginRequestSession(w, r, &cartState{})
+			return err
+		}},
+	}
+	for _, c := range endCases {
+		tk, err := mgr.BeginSession(httptest.NewRecorder(), &cartState{})
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		updates = 0
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, _ := StateFromContext(r.Context())
+			state.(*cartState).Items = append(state.(*cartState).Items, "c")
+			if err := c.handler(w, r); err != nil {
+				t.Errorf("case %s: unexpected error in handler: %v", c.name, err)
+			}
+		})
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+		AutoSave(mgr, opts, next).ServeHTTP(httptest.NewRecorder(), req)
+		if updates != 0 {
+			t.Errorf("case %s: incorrect number of updates: expected 0 but got %d", c.name, updates)
+		}
+		saved := &cartState{}
+		if err := store.Get(tk, saved); c.name == "ended" && err != ErrStateNotFound {
+			t.Errorf("case %s: ended session was recreated: %+v, %v", c.name, saved, err)
+		} else if len(saved.Items) != 0 {
+			t.Errorf("case %s: state was saved to replaced session: %v", c.name, saved.Items)
+		}
+	}
+
+	//requests without a session should pass through
+	called, hasToken := false, false
+	AutoSave(mgr, opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, hasToken = TokenFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+	if !called || hasToken {
+		t.Errorf("incorrect handling of request without session: called %t, token in context %t", called, hasToken)
+	}
+}
+
+func TestAutoSaveDirtier(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), &dirtyState{})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	var saveErr error
+	opts := AutoSaveOptions{
+		NewState: func() interface{} { return &dirtyState{} },
+		OnError:  func(r *http.Request, err error) { saveErr = err },
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+
+	//changes that aren't marked dirty aren't saved
+	AutoSave(mgr, opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, _ := StateFromContext(r.Context())
+		state.(*dirtyState).Count = 1
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	saved := &dirtyState{}
+	if store.Get(tk, saved); saved.Count != 0 {
+		t.Errorf("state that wasn't dirty was saved: %+v", saved)
+	}
+
+	AutoSave(mgr, opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, _ := StateFromContext(r.Context())
+		state.(*dirtyState).Count = 2
+		state.(*dirtyState).dirty = true
+		//make the save fail
+		store.triggerError = true
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if saveErr == nil {
+		t.Error("save error was not passed to OnError")
+	}
+	store.triggerError = false
+	AutoSave(mgr, opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, _ := StateFromContext(r.Context())
+		state.(*dirtyState).Count = 3
+		state.(*dirtyState).dirty = true
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if store.Get(tk, saved); saved.Count != 3 {
+		t.Errorf("incorrect saved state: expected %d but got %d", 3, saved.Count)
+	}
+}
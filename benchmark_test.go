@@ -0,0 +1,171 @@
+package sessions
+
+import (
+	"crypto/ed25519"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+//benchmarkState is the session state used by the benchmarks,
+//which is about the size of a typical authenticated session
+type benchmarkState struct {
+	UserID    string
+	Email     string
+	Roles     []string
+	CreatedAt time.Time
+}
+
+func newBenchmarkState() *benchmarkState {
+	return &benchmarkState{
+		UserID:    "1234567890",
+		Email:     "test@example.com",
+		Roles:     []string{"admin", "editor"},
+		CreatedAt: time.Now(),
+	}
+}
+
+//benchmarkManager is a named manager to benchmark
+type benchmarkManager struct {
+	name string
+	mgr  Manager
+}
+
+//benchmarkManagers returns managers using the memory store
+//with the options that change the cost of each request
+func benchmarkManagers() []benchmarkManager {
+	newManager := func(opts ...ManagerOption) Manager {
+		return NewManager(DefaultIDLength, []string{string(testSigningKey)}, NewMemoryStore(time.Hour), opts...)
+	}
+	return []benchmarkManager{
+		{"default", newManager()},
+		{"max lifetime", newManager(WithMaxLifetime(time.Hour))},
+		{"max age", newManager(WithMaxTokenAge(time.Hour))},
+	}
+}
+
+func BenchmarkBeginSession(b *testing.B) {
+	for _, bm := range benchmarkManagers() {
+		mgr := bm.mgr
+		b.Run(bm.name, func(b *testing.B) {
+			state := newBenchmarkState()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := mgr.BeginSession(nil, state); err != nil {
+					b.Fatalf("unexpected error beginning session: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetState(b *testing.B) {
+	for _, bm := range benchmarkManagers() {
+		mgr := bm.mgr
+		b.Run(bm.name, func(b *testing.B) {
+			tk, err := mgr.BeginSession(nil, newBenchmarkState())
+			if err != nil {
+				b.Fatalf("unexpected error beginning session: %v", err)
+			}
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			req.Header.Add(headerAuthorization, authTypeBearer+" "+tk.String())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state := benchmarkState{}
+				if _, err := mgr.GetState(req, &state); err != nil {
+					b.Fatalf("unexpected error getting state: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerifyToken(b *testing.B) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		b.Fatalf("unexpected error generating ed25519 key: %v", err)
+	}
+	keys := []SigningKey{
+		{Algorithm: HS256, Key: testSigningKey},
+		{Algorithm: HS512, Key: testSigningKey},
+		{Algorithm: EdDSA, Key: priv},
+	}
+	for _, key := range keys {
+		key := key
+		b.Run(string(key.Algorithm), func(b *testing.B) {
+			tk, err := NewTokenWithKey(key, DefaultIDLength)
+			if err != nil {
+				b.Fatalf("unexpected error generating token: %v", err)
+			}
+			encoded := tk.String()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := VerifyTokenWithKey(encoded, key); err != nil {
+					b.Fatalf("unexpected error verifying token: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStores(b *testing.B) {
+	stores := []struct {
+		name     string
+		newStore func(b *testing.B) Store
+	}{
+		{"memory", func(b *testing.B) Store {
+			return NewMemoryStore(time.Hour)
+		}},
+		{"redis", func(b *testing.B) Store {
+			srv := miniredis.RunT(b)
+			return NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+		}},
+		{"tiered", func(b *testing.B) Store {
+			srv := miniredis.RunT(b)
+			back := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+			return NewTieredStore(NewMemoryStore(time.Minute), back)
+		}},
+		{"write behind", func(b *testing.B) Store {
+			srv := miniredis.RunT(b)
+			store := NewWriteBehindStore(NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour),
+				DefaultWriteBehindQueueSize, BlockOnOverflow)
+			b.Cleanup(func() { store.Close() })
+			return store
+		}},
+	}
+
+	for _, s := range stores {
+		b.Run(s.name+"/save", func(b *testing.B) {
+			store := s.newStore(b)
+			tk, _ := NewToken(testSigningKey)
+			state := newBenchmarkState()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := store.Save(tk, state); err != nil {
+					b.Fatalf("unexpected error saving state: %v", err)
+				}
+			}
+		})
+		b.Run(s.name+"/get", func(b *testing.B) {
+			store := s.newStore(b)
+			tk, _ := NewToken(testSigningKey)
+			if err := store.Save(tk, newBenchmarkState()); err != nil {
+				b.Fatalf("unexpected error saving state: %v", err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state := benchmarkState{}
+				if err := store.Get(tk, &state); err != nil {
+					b.Fatalf("unexpected error getting state: %v", err)
+				}
+			}
+		})
+	}
+}
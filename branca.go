@@ -0,0 +1,180 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//brancaVersion is the version byte that begins every Branca token
+const brancaVersion = 0xBA
+
+//brancaHeaderLength is the length of the version, timestamp, and nonce
+const brancaHeaderLength = 1 + 4 + chacha20poly1305.NonceSizeX
+
+//base62Alphabet is the alphabet used for Branca's base62 encoding
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+//ErrBrancaTokenExpired is returned when decoding a Branca
+//token that is older than the Branca's TTL
+var ErrBrancaTokenExpired = errors.New("branca token has expired")
+
+//Branca generates and verifies tokens in the Branca format
+//(https://www.branca.io), which are encrypted and authenticated
+//using XChaCha20-Poly1305, include the time they were created, and
+//are base62-encoded. Branca tokens are a compact alternative to JWT
+//or PASETO for carrying encrypted session state. Since XChaCha20-Poly1305
+//is not FIPS-approved, Branca is not available in FIPS mode.
+type Branca struct {
+	//TTL is how long tokens remain valid after they are created.
+	//Zero means tokens don't expire. Callers may adjust this
+	//after construction.
+	TTL time.Duration
+	//Rand is the reader used to generate random nonces. Defaults to
+	//crypto/rand.Reader, but tests and fuzzing harnesses may adjust
+	//this after construction to generate predictable tokens.
+	Rand io.Reader
+	//key is the 32 byte encryption key
+	key []byte
+}
+
+//NewBranca constructs a new Branca using key, which must be 32 bytes.
+//Tokens expire after ttl, or never expire if ttl is zero.
+func NewBranca(key []byte, ttl time.Duration) (*Branca, error) {
+	if fipsMode {
+		return nil, fmt.Errorf("error constructing Branca: %v", ErrNotFIPSApproved)
+	}
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("branca key must be %d bytes", chacha20poly1305.KeySize)
+	}
+	return &Branca{TTL: ttl, Rand: rand.Reader, key: key}, nil
+}
+
+//Encode encrypts payload into a new Branca token created now
+func (b *Branca) Encode(payload []byte) (string, error) {
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(b.Rand, nonce); err != nil {
+		return "", fmt.Errorf("error reading random bytes: %v", err)
+	}
+	return b.encode(payload, time.Now(), nonce)
+}
+
+//encode encrypts payload into a Branca token with the timestamp and nonce
+func (b *Branca) encode(payload []byte, timestamp time.Time, nonce []byte) (string, error) {
+	aead, err := chacha20poly1305.NewX(b.key)
+	if err != nil {
+		return "", fmt.Errorf("error creating cipher: %v", err)
+	}
+	header := make([]byte, brancaHeaderLength, brancaHeaderLength+len(payload)+aead.Overhead())
+	header[0] = brancaVersion
+	binary.BigEndian.PutUint32(header[1:5], uint32(timestamp.Unix()))
+	copy(header[5:], nonce)
+	//the header is authenticated along with the payload
+	return encodeBase62(aead.Seal(header, nonce, payload, header)), nil
+}
+
+//Decode decrypts a Branca token, returning its payload and the time it
+//was created. If the token is older than the TTL, ErrBrancaTokenExpired
+//is returned.
+func (b *Branca) Decode(token string) ([]byte, time.Time, error) {
+	buf, err := decodeBase62(token)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	aead, err := chacha20poly1305.NewX(b.key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error creating cipher: %v", err)
+	}
+	if len(buf) < brancaHeaderLength+aead.Overhead() {
+		return nil, time.Time{}, fmt.Errorf("branca token not long enough")
+	}
+	if buf[0] != brancaVersion {
+		return nil, time.Time{}, fmt.Errorf("unsupported branca version %#x", buf[0])
+	}
+	header, ciphertext := buf[:brancaHeaderLength], buf[brancaHeaderLength:]
+	payload, err := aead.Open(nil, header[5:], ciphertext, header)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error decrypting branca token: %v", err)
+	}
+	created := time.Unix(int64(binary.BigEndian.Uint32(header[1:5])), 0)
+	if b.TTL > 0 && time.Since(created) > b.TTL {
+		return nil, created, ErrBrancaTokenExpired
+	}
+	return payload, created, nil
+}
+
+//Seal encodes sessionState using the DefaultCodec,
+//and encrypts it into a new Branca token
+func (b *Branca) Seal(sessionState interface{}) (string, error) {
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return "", err
+	}
+	return b.Encode(state)
+}
+
+//Open decrypts a Branca token created by Seal,
+//and decodes its state into sessionState
+func (b *Branca) Open(token string, sessionState interface{}) error {
+	state, _, err := b.Decode(token)
+	if err != nil {
+		return err
+	}
+	return decodeState(state, sessionState)
+}
+
+//encodeBase62 encodes buf using Branca's base62 alphabet
+func encodeBase62(buf []byte) string {
+	n := new(big.Int).SetBytes(buf)
+	if n.Sign() == 0 {
+		return base62Alphabet[:1]
+	}
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base62Alphabet[mod.Int64()])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+//decodeBase62 decodes s using Branca's base62 alphabet
+func decodeBase62(s string) ([]byte, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("empty base62 string")
+	}
+	n := new(big.Int)
+	base := big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		d := indexBase62(s[i])
+		if d < 0 {
+			return nil, fmt.Errorf("invalid base62 character %q", s[i])
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return n.Bytes(), nil
+}
+
+//indexBase62 returns the value of the base62 character c, or -1
+func indexBase62(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	}
+	return -1
+}
@@ -0,0 +1,83 @@
+package sessions
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var testBrancaKey = []byte("supersecretkeyyoushouldnotcommit")
+
+func TestBrancaSpecVector(t *testing.T) {
+	b, err := NewBranca(testBrancaKey, 0)
+	if err != nil {
+		t.Fatalf("unexpected error constructing Branca: %v", err)
+	}
+	nonce := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 2)
+	token, err := b.encode([]byte("Hello world!"), time.Unix(123206400, 0), nonce)
+	if err != nil {
+		t.Fatalf("unexpected error encoding token: %v", err)
+	}
+	expected := "875GH233T7IYrxtgXxlQBYiFobZMQdHAT51vChKsAIYCFxZtL1evV54vYqLyZtQ0ekPHt8kJHQp0a"
+	if token != expected {
+		t.Errorf("incorrect token: expected %s but got %s", expected, token)
+	}
+	payload, created, err := b.Decode(expected)
+	if err != nil {
+		t.Fatalf("unexpected error decoding token: %v", err)
+	}
+	if string(payload) != "Hello world!" || created.Unix() != 123206400 {
+		t.Errorf("incorrect payload or timestamp: %s, %v", payload, created)
+	}
+}
+
+func TestBranca(t *testing.T) {
+	if _, err := NewBranca([]byte("short"), 0); err == nil {
+		t.Error("did not receive expected error with short key")
+	}
+	b, err := NewBranca(testBrancaKey, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error constructing Branca: %v", err)
+	}
+	token, err := b.Seal(map[string]string{"user": "tester"})
+	if err != nil {
+		t.Fatalf("unexpected error sealing state: %v", err)
+	}
+	var state map[string]string
+	if err := b.Open(token, &state); err != nil || state["user"] != "tester" {
+		t.Errorf("incorrect state: %v, %v", state, err)
+	}
+
+	old, _ := b.encode([]byte("old"), time.Now().Add(-2*time.Hour), make([]byte, 24))
+	modified := []byte(token)
+	modified[len(modified)/2] ^= 1
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"expired", old},
+		{"modified", string(modified)},
+		{"invalid character", token + "!"},
+		{"too short", "875GH233T7"},
+		{"empty", ""},
+	}
+	for _, c := range cases {
+		if _, _, err := b.Decode(c.token); err == nil {
+			t.Errorf("case %s: did not receive expected error", c.name)
+		}
+	}
+	if _, _, err := b.Decode(old); err != ErrBrancaTokenExpired {
+		t.Errorf("incorrect error: expected %v but got %v", ErrBrancaTokenExpired, err)
+	}
+
+	b.Rand = &errorReader{}
+	if _, err := b.Encode([]byte("payload")); err == nil {
+		t.Error("did not receive expected error when simulating error reading random bytes")
+	}
+
+	defer func(enabled bool) { fipsMode = enabled }(fipsMode)
+	fipsMode = true
+	if _, err := NewBranca(testBrancaKey, 0); err == nil {
+		t.Error("did not receive expected error in FIPS mode")
+	}
+}
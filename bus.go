@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//DefaultBusChannel is the default channel used by RedisBus
+const DefaultBusChannel = "sessions:bus"
+
+//BusMessage is a message about a session that is broadcast to every
+//process subscribed to a Bus, such as an invalidation of cached state
+type BusMessage struct {
+	//Type is the type of session event that caused the message
+	Type EventType `json:"type"`
+	//SessionID is the string version of the session ID
+	SessionID string `json:"sessionID"`
+	//Origin identifies the publisher, so that subscribers
+	//can ignore messages they published themselves
+	Origin string `json:"origin,omitempty"`
+}
+
+//Bus broadcasts BusMessages between processes, so that per-process
+//state such as a TieredStore's front store can be invalidated when a
+//session changes elsewhere, and so that clients can be told when they
+//have been logged out elsewhere. Delivery is best-effort: subscribers
+//that are disconnected when a message is published never receive it.
+type Bus interface {
+	//Publish broadcasts the message to all subscribers
+	Publish(msg BusMessage) error
+	//Subscribe calls fn with each message published to the bus until
+	//the returned function is called. Messages may be delivered on
+	//a separate goroutine, so fn must be safe for concurrent use.
+	Subscribe(fn func(msg BusMessage)) (func(), error)
+}
+
+//BusPublisher returns a function that publishes session events of the
+//given types to the bus, for use with Manager.Subscribe. Any errors that
+//occur while publishing are passed to onError, which may be nil.
+//For example, to tell other processes when sessions are logged out:
+//
+//	mgr.Subscribe(sessions.BusPublisher(bus, nil, sessions.EventEnded, sessions.EventRevoked))
+func BusPublisher(bus Bus, onError func(err error), types ...EventType) func(Event) {
+	return func(evt Event) {
+		for _, t := range types {
+			if evt.Type == t {
+				if err := bus.Publish(BusMessage{Type: evt.Type, SessionID: evt.SessionID}); err != nil && onError != nil {
+					onError(err)
+				}
+				return
+			}
+		}
+	}
+}
+
+//RedisBus is a Bus that uses redis pub/sub
+type RedisBus struct {
+	pool    *redis.Pool
+	channel string
+}
+
+//NewRedisBus constructs a new RedisBus that publishes to the channel,
+//or DefaultBusChannel if channel is empty. Each subscription holds
+//one connection from the pool until it is stopped.
+func NewRedisBus(pool *redis.Pool, channel string) *RedisBus {
+	if len(channel) == 0 {
+		channel = DefaultBusChannel
+	}
+	return &RedisBus{
+		pool:    pool,
+		channel: channel,
+	}
+}
+
+//Publish publishes the message to the redis channel
+func (rb *RedisBus) Publish(msg BusMessage) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding bus message: %v", err)
+	}
+	conn := rb.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PUBLISH", rb.channel, buf); err != nil {
+		return fmt.Errorf("error publishing bus message: %v", err)
+	}
+	return nil
+}
+
+//Subscribe subscribes to the redis channel, calling fn with each message
+//on a background goroutine. Messages that can't be decoded are ignored.
+//The subscription ends if the connection to redis is lost.
+func (rb *RedisBus) Subscribe(fn func(msg BusMessage)) (func(), error) {
+	psc := redis.PubSubConn{Conn: rb.pool.Get()}
+	if err := psc.Subscribe(rb.channel); err != nil {
+		psc.Close()
+		return nil, fmt.Errorf("error subscribing to bus: %v", err)
+	}
+	//wait for the subscription to be confirmed, so that
+	//messages published after Subscribe returns are received
+	switch v := psc.Receive().(type) {
+	case redis.Subscription:
+	case error:
+		psc.Close()
+		return nil, fmt.Errorf("error subscribing to bus: %v", v)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			switch v := psc.Receive().(type) {
+			case redis.Message:
+				msg := BusMessage{}
+				if err := json.Unmarshal(v.Data, &msg); err == nil {
+					fn(msg)
+				}
+			case redis.Subscription:
+				if v.Count == 0 {
+					return
+				}
+			case error:
+				return
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			psc.Unsubscribe()
+			<-done
+			psc.Close()
+		})
+	}, nil
+}
@@ -0,0 +1,163 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisBus(t *testing.T) *RedisBus {
+	srv := miniredis.RunT(t)
+	return NewRedisBus(NewRedisPool(srv.Addr(), time.Minute), "")
+}
+
+//receive waits for a message from the channel
+func receive(t *testing.T, msgs chan BusMessage) (BusMessage, bool) {
+	select {
+	case msg := <-msgs:
+		return msg, true
+	case <-time.After(time.Second):
+		return BusMessage{}, false
+	}
+}
+
+func TestRedisBus(t *testing.T) {
+	bus := newTestRedisBus(t)
+	msgs := make(chan BusMessage, 10)
+	stop, err := bus.Subscribe(func(msg BusMessage) { msgs <- msg })
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+
+	expected := BusMessage{Type: EventEnded, SessionID: "test session", Origin: "test origin"}
+	if err := bus.Publish(expected); err != nil {
+		t.Fatalf("unexpected error publishing: %v", err)
+	}
+	if msg, ok := receive(t, msgs); !ok || msg != expected {
+		t.Errorf("incorrect message: expected %v but got %v", expected, msg)
+	}
+
+	stop()
+	stop()
+	bus.Publish(expected)
+	select {
+	case msg := <-msgs:
+		t.Errorf("received message after stopping: %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestBusPublisher(t *testing.T) {
+	bus := newTestRedisBus(t)
+	msgs := make(chan BusMessage, 10)
+	stop, err := bus.Subscribe(func(msg BusMessage) { msgs <- msg })
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	defer stop()
+
+	tk, _ := NewToken(testSigningKey)
+	store := newMockStore(false)
+	store.Save(tk, "test state")
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	mgr.Subscribe(BusPublisher(bus, func(err error) {
+		t.Errorf("unexpected error publishing: %v", err)
+	}, EventEnded))
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, tk.String()))
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	msg, ok := receive(t, msgs)
+	if !ok || msg.Type != EventEnded || msg.SessionID != tk.ID().String() {
+		t.Errorf("incorrect message: %v", msg)
+	}
+}
+
+func TestTieredStoreBus(t *testing.T) {
+	bus := newTestRedisBus(t)
+	back := NewMemoryStore(time.Hour)
+	fronts := []*MemoryStore{NewMemoryStore(time.Hour), NewMemoryStore(time.Hour)}
+	stores := make([]*TieredStore, len(fronts))
+	for i, front := range fronts {
+		stores[i] = NewTieredStore(front, back)
+		stop, err := stores[i].UseBus(bus)
+		if err != nil {
+			t.Fatalf("unexpected error using bus: %v", err)
+		}
+		defer stop()
+	}
+
+	tk, _ := NewToken(testSigningKey)
+	back.Save(tk, "test state")
+	var state string
+	for _, store := range stores {
+		store.Get(tk, &state)
+	}
+
+	//saving in one process should invalidate the other's front store,
+	//but not its own
+	if err := stores[1].Save(tk, "updated state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for exists, _ := fronts[0].Exists(tk); exists && time.Now().Before(deadline); exists, _ = fronts[0].Exists(tk) {
+		time.Sleep(time.Millisecond)
+	}
+	if exists, _ := fronts[0].Exists(tk); exists {
+		t.Error("other front store was not invalidated")
+	}
+	if exists, _ := fronts[1].Exists(tk); !exists {
+		t.Error("own front store was invalidated")
+	}
+	if err := stores[0].Get(tk, &state); err != nil || state != "updated state" {
+		t.Errorf("incorrect state: expected updated state, <nil> but got %s, %v", state, err)
+	}
+}
+
+//recordingBus is a Bus that records published messages
+type recordingBus struct {
+	msgs chan BusMessage
+}
+
+func (rb *recordingBus) Publish(msg BusMessage) error {
+	rb.msgs <- msg
+	return nil
+}
+
+func (rb *recordingBus) Subscribe(fn func(msg BusMessage)) (func(), error) {
+	return func() {}, nil
+}
+
+func TestTieredStoreBusWriteBehind(t *testing.T) {
+	back := newGatedStore()
+	store := NewTieredStoreWithPolicy(NewMemoryStore(time.Hour), back, TieredPolicy{Write: WriteBehind})
+	bus := &recordingBus{msgs: make(chan BusMessage, 10)}
+	if _, err := store.UseBus(bus); err != nil {
+		t.Fatalf("unexpected error using bus: %v", err)
+	}
+
+	//the update should not be published until the back store has it
+	tk, _ := NewToken(testSigningKey)
+	if err := store.Save(tk, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	<-back.started
+	select {
+	case msg := <-bus.msgs:
+		t.Errorf("message published before the write was flushed: %v", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(back.gate)
+	msg, ok := receive(t, bus.msgs)
+	if !ok || msg.Type != EventUpdated || msg.SessionID != tk.ID().String() {
+		t.Errorf("incorrect message: %v", msg)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("unexpected error closing store: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package sessions
+
+import (
+	"time"
+)
+
+//BeginSessionToken is like BeginSession, but returns the new token as a
+//string, rather than writing it to a response, for services that don't
+//receive sessions over HTTP, such as CLI tools, message consumers, and
+//gRPC services.
+func (m *manager) BeginSessionToken(sessionState interface{}) (string, error) {
+	tk, err := m.beginSession(nil, sessionState, &envelope{Created: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	return tk.String(), nil
+}
+
+//GetStateByToken is like GetState, but verifies the token string, rather
+//than reading a token from a request. Since there is no request, caveats
+//that restrict the request's path or method are never satisfied, the
+//manager's ResumptionPolicy isn't applied, and no activity is recorded.
+func (m *manager) GetStateByToken(token string, sessionState interface{}) (Token, error) {
+	tk, err := m.verifyToken(nil, token)
+	if err != nil {
+		m.expvars.verifyFailed()
+		return nil, err
+	}
+	if err := m.resume(nil, tk, sessionState); err != nil {
+		return nil, getStateError(err)
+	}
+	return tk, nil
+}
+
+//EndSessionByToken is like EndSession, but verifies the token
+//string, rather than reading a token from a request
+func (m *manager) EndSessionByToken(token string) error {
+	tk, err := m.verifyToken(nil, token)
+	if err != nil {
+		m.expvars.verifyFailed()
+		return err
+	}
+	return m.endSession(tk)
+}
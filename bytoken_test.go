@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionsByToken(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithActivityLog(NewMemoryActivityLog(10)))
+	token, err := mgr.BeginSessionToken("test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	var state string
+	tk, err := mgr.GetStateByToken(token, &state)
+	if err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if tk.String() != token || state != "test state" {
+		t.Errorf("incorrect result: expected %s, test state but got %s, %s", token, tk.String(), state)
+	}
+	if activities, _ := mgr.Activity(tk.ID().String()); len(activities) != 0 {
+		t.Errorf("activity recorded without a request: %v", activities)
+	}
+
+	//the token should also work with the request-based methods
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+token)
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Errorf("unexpected error getting state from request: %v", err)
+	}
+
+	//caveats about the request can't be satisfied without one
+	expiring, err := Attenuate(token, ExpiresCaveat(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+	if _, err := mgr.GetStateByToken(expiring, &state); err != nil {
+		t.Errorf("unexpected error getting state with expiry caveat: %v", err)
+	}
+	restricted, err := Attenuate(token, MethodCaveat("GET"))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+	if _, err := mgr.GetStateByToken(restricted, &state); err != ErrCaveatNotSatisfied {
+		t.Errorf("incorrect error for method caveat: expected %v but got %v", ErrCaveatNotSatisfied, err)
+	}
+
+	if _, err := mgr.GetStateByToken(modToken(token), &state); err == nil {
+		t.Error("did not receive expected error getting state with modified token")
+	}
+	if err := mgr.EndSessionByToken(modToken(token)); err == nil {
+		t.Error("did not receive expected error ending session with modified token")
+	}
+	if err := mgr.EndSessionByToken(token); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if _, err := mgr.GetStateByToken(token, &state); err == nil {
+		t.Error("did not receive expected error getting state of ended session")
+	}
+}
@@ -0,0 +1,238 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//caveatSeparator separates the token, caveats,
+//and signature in an attenuated token
+const caveatSeparator = "."
+
+//ErrCaveatNotSatisfied is returned from GetToken when the
+//request doesn't satisfy one of the token's caveats
+var ErrCaveatNotSatisfied = errors.New("token caveat not satisfied")
+
+//Caveat restricts when an attenuated token may be used.
+//Use ExpiresCaveat, PathPrefixCaveat, and MethodCaveat
+//to construct caveats.
+type Caveat string
+
+//caveat condition prefixes
+const (
+	caveatExpires = "expires:"
+	caveatPath    = "path:"
+	caveatMethod  = "method:"
+)
+
+//ExpiresCaveat restricts a token to requests made before expires
+func ExpiresCaveat(expires time.Time) Caveat {
+	return Caveat(caveatExpires + strconv.FormatInt(expires.Unix(), 10))
+}
+
+//PathPrefixCaveat restricts a token to requests
+//whose URL paths begin with prefix
+func PathPrefixCaveat(prefix string) Caveat {
+	return Caveat(caveatPath + prefix)
+}
+
+//MethodCaveat restricts a token to requests using one of the methods
+func MethodCaveat(methods ...string) Caveat {
+	return Caveat(caveatMethod + strings.Join(methods, ","))
+}
+
+//Attenuate appends caveats to a session token, or to a token that has
+//already been attenuated, returning a new token that can only be used for
+//requests satisfying every caveat. Attenuation doesn't require the signing
+//key, so a client can narrow a token before handing it to a less-trusted
+//client, which can't remove the caveats. Like macaroons, each caveat is
+//chained into an HMAC signature keyed by the previous signature, starting
+//with the token's own signature, which is not included in the attenuated
+//token, so the original token can't be recovered from it. The Manager
+//recomputes the token's signature using its signing keys, and verifies the
+//caveats in GetToken.
+//
+//Session tokens that haven't been attenuated are expected to use the default
+//base64 encoding and an HS256 signature. Use AttenuateToken to attenuate a
+//Token generated with other TokenOptions or SigningKeys.
+func Attenuate(token string, caveats ...Caveat) (string, error) {
+	if strings.Contains(token, caveatSeparator) {
+		body, existing, sig, err := parseAttenuated(token)
+		if err != nil {
+			return "", err
+		}
+		return formatAttenuated(body, sig, existing, caveats), nil
+	}
+	buf, err := defaultEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("error decoding token: %v", err)
+	}
+	if len(buf) < MinIDLength+sha256.Size {
+		return "", fmt.Errorf("token not long enough")
+	}
+	sigStart := len(buf) - sha256.Size
+	return formatAttenuated(buf[:sigStart], buf[sigStart:], nil, caveats), nil
+}
+
+//AttenuateToken is like Attenuate, but attenuates a Token returned from
+//a Manager or NewToken, which may use any TokenOptions and SigningKey.
+func AttenuateToken(tk Token, caveats ...Caveat) (string, error) {
+	t, ok := tk.(*token)
+	if !ok {
+		return "", fmt.Errorf("only session tokens can be attenuated")
+	}
+	sigStart := len(t.buf) - t.sigLen()
+	return formatAttenuated(t.buf[:sigStart], t.buf[sigStart:], nil, caveats), nil
+}
+
+//formatAttenuated returns an attenuated token containing the body of the
+//original token, which is everything but its signature, the existing
+//caveats, which have already been chained into sig, and the new caveats,
+//which are chained into sig in turn
+func formatAttenuated(body []byte, sig []byte, existing []Caveat, caveats []Caveat) string {
+	parts := []string{base64.RawURLEncoding.EncodeToString(body)}
+	for _, c := range existing {
+		parts = append(parts, base64.RawURLEncoding.EncodeToString([]byte(c)))
+	}
+	for _, c := range caveats {
+		sig = signCaveat(sig, c)
+		parts = append(parts, base64.RawURLEncoding.EncodeToString([]byte(c)))
+	}
+	parts = append(parts, base64.RawURLEncoding.EncodeToString(sig))
+	return strings.Join(parts, caveatSeparator)
+}
+
+//signCaveat chains the caveat into the signature
+func signCaveat(sig []byte, c Caveat) []byte {
+	h := hmac.New(sha256.New, sig)
+	h.Write([]byte(c))
+	return h.Sum(nil)
+}
+
+//parseAttenuated splits an attenuated token into the body of the original
+//token, its caveats, and the chained signature, without verifying them
+func parseAttenuated(token string) ([]byte, []Caveat, []byte, error) {
+	parts := strings.Split(token, caveatSeparator)
+	if len(parts) < 2 {
+		return nil, nil, nil, fmt.Errorf("error verifying caveats: malformed token")
+	}
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error verifying caveats: %v", err)
+	}
+	caveats := make([]Caveat, len(parts)-2)
+	for i, part := range parts[1 : len(parts)-1] {
+		c, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error verifying caveats: %v", err)
+		}
+		caveats[i] = Caveat(c)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error verifying caveats: %v", err)
+	}
+	return body, caveats, sig, nil
+}
+
+//verifyCaveats verifies a token that may have been attenuated, returning
+//the original Token, the index of the key that verified it, and the
+//caveats, which the caller must check. For attenuated tokens, the original
+//token's signature is recomputed with each key that can sign, and the
+//caveats are chained into it, until the result matches the attenuated
+//token's signature.
+func (kr keyRing) verifyCaveats(b64token string, opts []TokenOption) (Token, int, []Caveat, error) {
+	if !strings.Contains(b64token, caveatSeparator) {
+		tk, i, err := kr.verifyIndex(b64token, opts)
+		return tk, i, nil, err
+	}
+	body, caveats, expected, err := parseAttenuated(b64token)
+	if err != nil {
+		return nil, -1, nil, err
+	}
+	for i, key := range kr {
+		if !key.canSign() {
+			continue
+		}
+		buf := key.appendSig(append(make([]byte, 0, len(body)+key.sigSize()), body...))
+		sig := buf[len(body):]
+		for _, c := range caveats {
+			sig = signCaveat(sig, c)
+		}
+		if !hmac.Equal(sig, expected) {
+			continue
+		}
+		//verify the reconstructed token, so that it's subject to
+		//the same checks as tokens that haven't been attenuated
+		tk, err := VerifyTokenWithKey(newTokenOptions(opts).encoding.EncodeToString(buf), key, opts...)
+		if err != nil {
+			return nil, -1, nil, fmt.Errorf("error verifying session token: %v", err)
+		}
+		return tk, i, caveats, nil
+	}
+	return nil, -1, nil, fmt.Errorf("error verifying caveats: token or caveats have been modified")
+}
+
+//verifyAttenuated verifies a token that may have been attenuated,
+//and checks that the request satisfies any caveats. The index of
+//the key that verified the token is also returned.
+func (kr keyRing) verifyAttenuated(r *http.Request, b64token string, opts []TokenOption) (Token, int, error) {
+	tk, i, caveats, err := kr.verifyCaveats(b64token, opts)
+	if err != nil {
+		return nil, -1, err
+	}
+	for _, c := range caveats {
+		if err := c.check(r); err != nil {
+			return nil, -1, err
+		}
+	}
+	return tk, i, nil
+}
+
+//check returns ErrCaveatNotSatisfied if the request doesn't satisfy
+//the caveat. Unknown caveats are never satisfied.
+func (c Caveat) check(r *http.Request) error {
+	s := string(c)
+	if expires, ok := c.expires(); ok {
+		if time.Now().Before(expires) {
+			return nil
+		}
+		return ErrCaveatNotSatisfied
+	}
+	switch {
+	case r == nil:
+		//caveats about the request can't be satisfied without one
+	case strings.HasPrefix(s, caveatPath):
+		if strings.HasPrefix(r.URL.Path, s[len(caveatPath):]) {
+			return nil
+		}
+	case strings.HasPrefix(s, caveatMethod):
+		for _, method := range strings.Split(s[len(caveatMethod):], ",") {
+			if r.Method == method {
+				return nil
+			}
+		}
+	}
+	return ErrCaveatNotSatisfied
+}
+
+//expires returns the time of an expiry caveat, and whether it is one
+func (c Caveat) expires() (time.Time, bool) {
+	s := string(c)
+	if !strings.HasPrefix(s, caveatExpires) {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseInt(s[len(caveatExpires):], 10, 64)
+	if err != nil {
+		//an unparsable expiry is never satisfied
+		return time.Time{}, true
+	}
+	return time.Unix(secs, 0), true
+}
@@ -0,0 +1,115 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttenuate(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	narrow, err := Attenuate(tk.String(), PathPrefixCaveat("/api/"), MethodCaveat("GET", "HEAD"))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+	narrower, err := Attenuate(narrow, ExpiresCaveat(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+	expired, _ := Attenuate(narrow, ExpiresCaveat(time.Now().Add(-time.Minute)))
+
+	//the original token must not be recoverable from an attenuated one
+	if strings.Contains(narrower, strings.TrimRight(tk.String(), "=")) {
+		t.Errorf("attenuated token contains the original token: %s", narrower)
+	}
+
+	//removing a caveat should invalidate the signature
+	parts := strings.Split(narrower, caveatSeparator)
+	removed := strings.Join(append(parts[:1], parts[2:]...), caveatSeparator)
+
+	cases := []struct {
+		name        string
+		token       string
+		method      string
+		path        string
+		expectedErr error
+		expectErr   bool
+	}{
+		{"plain token", tk.String(), "POST", "/", nil, false},
+		{"satisfied", narrow, "GET", "/api/users", nil, false},
+		{"wrong method", narrow, "POST", "/api/users", ErrCaveatNotSatisfied, true},
+		{"wrong path", narrow, "GET", "/admin", ErrCaveatNotSatisfied, true},
+		{"further attenuated", narrower, "HEAD", "/api/", nil, false},
+		{"expired", expired, "GET", "/api/", ErrCaveatNotSatisfied, true},
+		{"caveat removed", removed, "GET", "/api/", nil, true},
+		{"missing signature", parts[0] + caveatSeparator + parts[1], "GET", "/api/", nil, true},
+		{"stripped to prefix", parts[0], "POST", "/", nil, true},
+		{"signature stripped to prefix", parts[0] + caveatSeparator + parts[len(parts)-1], "POST", "/", nil, true},
+		{"unknown caveat", mustAttenuate(t, tk.String(), Caveat("ip:127.0.0.1")), "GET", "/", ErrCaveatNotSatisfied, true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com"+c.path, nil)
+		req.Header.Add(headerAuthorization, authTypeBearer+" "+c.token)
+		gotTk, err := mgr.GetToken(req)
+		if (err != nil) != c.expectErr {
+			t.Errorf("case %s: unexpected error result: %v", c.name, err)
+			continue
+		}
+		if c.expectedErr != nil && err != c.expectedErr {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedErr, err)
+		}
+		if err == nil && gotTk.ID().String() != tk.ID().String() {
+			t.Errorf("case %s: incorrect session ID", c.name)
+		}
+	}
+}
+
+func TestAttenuateToken(t *testing.T) {
+	key := SigningKey{Algorithm: HS512, Key: testSigningKey}
+	mgr := NewManager(DefaultIDLength, nil, newMockStore(false), WithSigningKeys(key),
+		WithTokenOptions(WithEncoding(base64.RawURLEncoding)))
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	narrow, err := AttenuateToken(tk, MethodCaveat("GET"))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		method    string
+		expectErr bool
+	}{
+		{"satisfied", "GET", false},
+		{"wrong method", "POST", true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com/", nil)
+		req.Header.Add(headerAuthorization, authTypeBearer+" "+narrow)
+		gotTk, err := mgr.GetToken(req)
+		if (err != nil) != c.expectErr {
+			t.Errorf("case %s: unexpected error result: %v", c.name, err)
+			continue
+		}
+		if err == nil && gotTk.ID().String() != tk.ID().String() {
+			t.Errorf("case %s: incorrect session ID", c.name)
+		}
+	}
+}
+
+func mustAttenuate(t *testing.T, token string, caveats ...Caveat) string {
+	attenuated, err := Attenuate(token, caveats...)
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+	return attenuated
+}
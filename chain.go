@@ -0,0 +1,50 @@
+package sessions
+
+//Chain composes a Store from a base Store and a series of decorators,
+//each of which wraps the Store it is given. The first decorator is the
+//outermost, so it sees each operation first, and the base Store sees it
+//last. For example:
+//
+//	store := sessions.Chain(redisStore,
+//		sessions.CircuitBreaker(sessions.DefaultCircuitBreakerOptions),
+//		sessions.Retry(sessions.DefaultRetryPolicy),
+//	)
+//
+//is equivalent to:
+//
+//	store := sessions.CircuitBreakerStore(
+//		sessions.RetryStore(redisStore, sessions.DefaultRetryPolicy),
+//		sessions.DefaultCircuitBreakerOptions)
+//
+//When stacking decorators, order them from outermost to innermost like so:
+//
+//  - metrics, so they measure the latency and errors callers actually experience
+//  - local caching and circuit breaking, so that cache hits and fast failures
+//    skip everything below them, and so that a retried operation counts as
+//    a single failure
+//  - retry, so that each attempt goes through the layers below it
+//  - timeouts, so that each attempt is bounded, rather than all attempts together
+//  - compression and encryption, nearest the base store, so that only the
+//    base store ever sees the encoded bytes
+func Chain(base Store, decorators ...func(Store) Store) Store {
+	s := base
+	for i := len(decorators) - 1; i >= 0; i-- {
+		s = decorators[i](s)
+	}
+	return s
+}
+
+//Retry returns a decorator for use with Chain that wraps a Store using RetryStore
+func Retry(policy RetryPolicy) func(Store) Store {
+	return func(s Store) Store {
+		return RetryStore(s, policy)
+	}
+}
+
+//CircuitBreaker returns a decorator for use with Chain that
+//wraps a Store using CircuitBreakerStore
+func CircuitBreaker(opts CircuitBreakerOptions) func(Store) Store {
+	return func(s Store) Store {
+		return CircuitBreakerStore(s, opts)
+	}
+}
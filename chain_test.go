@@ -0,0 +1,60 @@
+package sessions
+
+import (
+	"reflect"
+	"testing"
+)
+
+//namedStore is a decorator that records the order in which it sees operations
+type namedStore struct {
+	Store
+	name  string
+	order *[]string
+}
+
+func (ns *namedStore) Save(token Token, sessionState interface{}) error {
+	*ns.order = append(*ns.order, ns.name)
+	return ns.Store.Save(token, sessionState)
+}
+
+func named(name string, order *[]string) func(Store) Store {
+	return func(s Store) Store {
+		return &namedStore{s, name, order}
+	}
+}
+
+func TestChain(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	var order []string
+	base := newMockStore(false)
+	store := Chain(base, named("outer", &order), named("middle", &order), named("inner", &order))
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	expected := []string{"outer", "middle", "inner"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("incorrect decorator order: expected %v but got %v", expected, order)
+	}
+	if len(base.entries) != 1 {
+		t.Error("state was not saved to the base store")
+	}
+
+	//no decorators should return the base store
+	if Chain(base) != Store(base) {
+		t.Error("Chain with no decorators did not return the base store")
+	}
+
+	//the provided decorators should wrap with the expected types
+	store = Chain(base, CircuitBreaker(DefaultCircuitBreakerOptions), Retry(DefaultRetryPolicy))
+	cs, ok := store.(*circuitStore)
+	if !ok {
+		t.Fatalf("outermost store is not a circuit breaker: %T", store)
+	}
+	if _, ok := cs.inner.(*retryStore); !ok {
+		t.Errorf("inner store is not a retry store: %T", cs.inner)
+	}
+}
@@ -0,0 +1,339 @@
+package sessions
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//ErrCircuitOpen is returned by a circuit-breaking store when it
+//fails fast because the inner store has been failing
+var ErrCircuitOpen = errors.New("session store circuit is open")
+
+//CircuitBreakerOptions controls when a circuit-breaking store trips,
+//and how it behaves while tripped
+type CircuitBreakerOptions struct {
+	//FailureThreshold is the number of consecutive failures
+	//that trip the circuit open
+	FailureThreshold int
+	//Cooldown is how long the circuit stays open before a
+	//single trial operation is allowed through to the inner store.
+	//If the trial succeeds, the circuit closes again.
+	Cooldown time.Duration
+	//CacheSize is the maximum number of recently-used session states
+	//to keep in a local cache. While the circuit is open, Get serves
+	//states from this cache, so sessions degrade to read-only instead
+	//of failing. Set to 0 to disable the cache.
+	CacheSize int
+	//CacheMaxAge is how long a state stays in the local cache after it
+	//was last saved or read, after which it is no longer served while
+	//the circuit is open, so that sessions ended elsewhere during an
+	//outage don't stay usable indefinitely. If zero, the
+	//DefaultCircuitCacheMaxAge is used.
+	CacheMaxAge time.Duration
+}
+
+//DefaultCircuitCacheMaxAge is the default CacheMaxAge
+const DefaultCircuitCacheMaxAge = time.Minute
+
+//DefaultCircuitBreakerOptions are CircuitBreakerOptions that
+//should work well in most situations
+var DefaultCircuitBreakerOptions = CircuitBreakerOptions{
+	FailureThreshold: 5,
+	Cooldown:         5 * time.Second,
+}
+
+//circuitStore is a Store that stops calling an inner Store after repeated failures
+type circuitStore struct {
+	inner Store
+	opts  CircuitBreakerOptions
+	mx    sync.Mutex
+	//consecutive failures while closed
+	failures int
+	//time the circuit opened, zero when closed
+	openedAt time.Time
+	//true while a trial operation is in flight
+	trial bool
+	//cached gob-encoded states keyed by session ID,
+	//with entries ordered from most to least recently used
+	cache   map[string]*list.Element
+	entries *list.List
+}
+
+//circuitCacheEntry is an entry in the circuit store's local cache
+type circuitCacheEntry struct {
+	key    string
+	state  []byte
+	cached time.Time
+}
+
+//CircuitBreakerStore wraps inner with a Store that trips open after
+//repeated failures, and then fails fast with ErrCircuitOpen until the
+//inner store recovers, protecting request latency during outages.
+//ErrStateNotFound is not considered a failure.
+func CircuitBreakerStore(inner Store, opts CircuitBreakerOptions) Store {
+	if opts.FailureThreshold < 1 {
+		opts.FailureThreshold = 1
+	}
+	if opts.CacheMaxAge <= 0 {
+		opts.CacheMaxAge = DefaultCircuitCacheMaxAge
+	}
+	return &circuitStore{
+		inner:   inner,
+		opts:    opts,
+		cache:   make(map[string]*list.Element),
+		entries: list.New(),
+	}
+}
+
+//Save saves the state to the inner store, unless the circuit is open
+func (cs *circuitStore) Save(token Token, sessionState interface{}) error {
+	return cs.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the state from the inner store, or the local cache if the circuit is open
+func (cs *circuitStore) Get(token Token, sessionState interface{}) error {
+	return cs.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the state from the inner store, unless the circuit is open
+func (cs *circuitStore) Delete(token Token) error {
+	return cs.DeleteContext(context.Background(), token)
+}
+
+//SaveContext saves the state to the inner store, unless the circuit is open
+func (cs *circuitStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	if !cs.allow() {
+		return ErrCircuitOpen
+	}
+	err := saveContext(ctx, cs.inner, token, sessionState)
+	cs.record(ctx, err)
+	if err == nil {
+		cs.cacheState(token, sessionState)
+	}
+	return err
+}
+
+//GetContext gets the state from the inner store, or the local cache if the circuit is open
+func (cs *circuitStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return cs.read(ctx, token, sessionState, func() error {
+		return getContext(ctx, cs.inner, token, sessionState)
+	})
+}
+
+//DeleteContext deletes the state from the inner store, unless the circuit
+//is open. The state is removed from the local cache in either case, so
+//that it can't be read after the session has ended.
+func (cs *circuitStore) DeleteContext(ctx context.Context, token Token) error {
+	cs.uncache(token)
+	if !cs.allow() {
+		return ErrCircuitOpen
+	}
+	err := deleteContext(ctx, cs.inner, token)
+	cs.record(ctx, err)
+	return err
+}
+
+//Ping pings the inner store
+func (cs *circuitStore) Ping(ctx context.Context) error {
+	return ping(ctx, cs.inner)
+}
+
+//Peek peeks at the state in the inner store, or the local cache if the circuit is open
+func (cs *circuitStore) Peek(token Token, sessionState interface{}) error {
+	if _, ok := cs.inner.(Peeker); !ok {
+		return ErrPeekNotSupported
+	}
+	return cs.read(context.Background(), token, sessionState, func() error {
+		return peek(cs.inner, token, sessionState)
+	})
+}
+
+//GetAndTouch gets and touches the state in the inner store,
+//or gets it from the local cache if the circuit is open
+func (cs *circuitStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return cs.read(context.Background(), token, sessionState, func() error {
+		return getAndTouch(cs.inner, token, sessionState, ttl)
+	})
+}
+
+//Touch touches the state in the inner store, unless the circuit is open
+func (cs *circuitStore) Touch(token Token) error {
+	err := cs.do(func() error {
+		return touch(cs.inner, token)
+	})
+	if err == ErrStateNotFound {
+		cs.uncache(token)
+	}
+	return err
+}
+
+//TTL gets the TTL of the state from the inner store, unless the circuit is open
+func (cs *circuitStore) TTL(token Token) (time.Duration, error) {
+	var ttl time.Duration
+	err := cs.do(func() error {
+		var err error
+		ttl, err = storeTTL(cs.inner, token)
+		return err
+	})
+	return ttl, err
+}
+
+//Exists checks whether the inner store has the state, unless the circuit is open
+func (cs *circuitStore) Exists(token Token) (bool, error) {
+	var found bool
+	err := cs.do(func() error {
+		var err error
+		found, err = exists(cs.inner, token)
+		return err
+	})
+	if err == nil && !found {
+		cs.uncache(token)
+	}
+	return found, err
+}
+
+//Scan scans the inner store, unless the circuit is open
+func (cs *circuitStore) Scan(fn func(token Token) error) error {
+	return cs.do(func() error {
+		return scan(cs.inner, fn)
+	})
+}
+
+//Replace replaces the state in the inner store, unless the circuit is open
+func (cs *circuitStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	err := cs.do(func() error {
+		return replace(cs.inner, token, sessionState, replaced)
+	})
+	if err == nil {
+		cs.uncache(replaced)
+		cs.cacheState(token, sessionState)
+	}
+	return err
+}
+
+//read reads the state from the inner store using fn, which
+//uses ctx, or from the local cache if the circuit is open
+func (cs *circuitStore) read(ctx context.Context, token Token, sessionState interface{}, fn func() error) error {
+	if !cs.allow() {
+		return cs.getCached(token, sessionState)
+	}
+	err := fn()
+	cs.record(ctx, err)
+	switch err {
+	case nil:
+		cs.cacheState(token, sessionState)
+	case ErrStateNotFound:
+		cs.uncache(token)
+	}
+	return err
+}
+
+//do calls fn, unless the circuit is open, and records the result
+func (cs *circuitStore) do(fn func() error) error {
+	if !cs.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	cs.record(context.Background(), err)
+	return err
+}
+
+//allow reports whether an operation may call the inner store
+func (cs *circuitStore) allow() bool {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	if cs.openedAt.IsZero() {
+		return true
+	}
+	if cs.trial || time.Since(cs.openedAt) < cs.opts.Cooldown {
+		return false
+	}
+	//cooldown has elapsed, so let one trial operation through
+	cs.trial = true
+	return true
+}
+
+//record records the result of an operation on the inner store, which
+//used ctx. Operations that failed because the caller's context was done
+//say nothing about the store's health, so they are ignored.
+func (cs *circuitStore) record(ctx context.Context, err error) {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	cs.trial = false
+	if err != nil && (err == context.Canceled || err == context.DeadlineExceeded || ctx.Err() != nil) {
+		return
+	}
+	if err == nil || err == ErrStateNotFound {
+		cs.failures = 0
+		cs.openedAt = time.Time{}
+		return
+	}
+	cs.failures++
+	if !cs.openedAt.IsZero() || cs.failures >= cs.opts.FailureThreshold {
+		cs.openedAt = time.Now()
+	}
+}
+
+//cacheState adds an encoded copy of the state to the local cache
+func (cs *circuitStore) cacheState(token Token, sessionState interface{}) {
+	if cs.opts.CacheSize <= 0 {
+		return
+	}
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return
+	}
+	key := token.ID().String()
+
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	if elem, found := cs.cache[key]; found {
+		entry := elem.Value.(*circuitCacheEntry)
+		entry.state, entry.cached = state, time.Now()
+		cs.entries.MoveToFront(elem)
+		return
+	}
+	cs.cache[key] = cs.entries.PushFront(&circuitCacheEntry{key, state, time.Now()})
+	if cs.entries.Len() > cs.opts.CacheSize {
+		oldest := cs.entries.Back()
+		cs.entries.Remove(oldest)
+		delete(cs.cache, oldest.Value.(*circuitCacheEntry).key)
+	}
+}
+
+//getCached decodes the cached state into sessionState, returning
+//ErrCircuitOpen if it is not cached, or was cached too long ago
+func (cs *circuitStore) getCached(token Token, sessionState interface{}) error {
+	cs.mx.Lock()
+	elem, found := cs.cache[token.ID().String()]
+	var state []byte
+	if found {
+		entry := elem.Value.(*circuitCacheEntry)
+		if time.Since(entry.cached) < cs.opts.CacheMaxAge {
+			state = entry.state
+		} else {
+			cs.entries.Remove(elem)
+			delete(cs.cache, entry.key)
+			found = false
+		}
+	}
+	cs.mx.Unlock()
+	if !found {
+		return ErrCircuitOpen
+	}
+	return decodeState(state, sessionState)
+}
+
+//uncache removes the state from the local cache
+func (cs *circuitStore) uncache(token Token) {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	key := token.ID().String()
+	if elem, found := cs.cache[key]; found {
+		cs.entries.Remove(elem)
+		delete(cs.cache, key)
+	}
+}
@@ -0,0 +1,191 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStore(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	inner := newMockStore(false)
+	store := CircuitBreakerStore(inner, CircuitBreakerOptions{
+		FailureThreshold: 2,
+		Cooldown:         20 * time.Millisecond,
+		CacheSize:        1,
+	})
+
+	//operations should pass through while the inner store is healthy
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	if err := store.Get(token, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+
+	//ErrStateNotFound should not count as a failure
+	other, _ := NewToken(testSigningKey)
+	for i := 0; i < 3; i++ {
+		if err := store.Get(other, &state); err != ErrStateNotFound {
+			t.Fatalf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+		}
+	}
+
+	//trip the circuit
+	inner.triggerError = true
+	for i := 0; i < 2; i++ {
+		if err := store.Save(token, "test state"); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("expected error from inner store but got %v", err)
+		}
+	}
+
+	//the circuit should now be open, so writes fail fast,
+	//but reads are served from the cache
+	inner.triggerError = false
+	if err := store.Save(token, "test state"); err != ErrCircuitOpen {
+		t.Errorf("incorrect error: expected %v but got %v", ErrCircuitOpen, err)
+	}
+	state = ""
+	if err := store.Get(token, &state); err != nil {
+		t.Errorf("unexpected error getting cached state: %v", err)
+	}
+	if state != "test state" {
+		t.Errorf("incorrect cached state: expected %s but got %s", "test state", state)
+	}
+
+	//deletes should remove the state from the cache even though they fail
+	if err := store.Delete(token); err != ErrCircuitOpen {
+		t.Errorf("incorrect error: expected %v but got %v", ErrCircuitOpen, err)
+	}
+	if err := store.Get(token, &state); err != ErrCircuitOpen {
+		t.Errorf("incorrect error for deleted state: expected %v but got %v", ErrCircuitOpen, err)
+	}
+	if err := store.Get(other, &state); err != ErrCircuitOpen {
+		t.Errorf("incorrect error for uncached state: expected %v but got %v", ErrCircuitOpen, err)
+	}
+
+	//after the cooldown, a failed trial should re-open the circuit
+	time.Sleep(25 * time.Millisecond)
+	inner.triggerError = true
+	if err := store.Save(token, "test state"); err == nil || err == ErrCircuitOpen {
+		t.Errorf("expected error from inner store but got %v", err)
+	}
+	if err := store.Save(token, "test state"); err != ErrCircuitOpen {
+		t.Errorf("incorrect error: expected %v but got %v", ErrCircuitOpen, err)
+	}
+
+	//and a successful trial should close it again
+	time.Sleep(25 * time.Millisecond)
+	inner.triggerError = false
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
+
+func TestCircuitBreakerStoreContextErrors(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cases := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"canceled", context.Background(), context.Canceled},
+		{"deadline exceeded", context.Background(), context.DeadlineExceeded},
+		{"wrapped", canceled, fmt.Errorf("error executing GET: %v", context.Canceled)},
+	}
+	for _, c := range cases {
+		inner := &errorStore{mockStore: newMockStore(false), err: func() error { return c.err }}
+		store := CircuitBreakerStore(inner, CircuitBreakerOptions{
+			FailureThreshold: 2,
+			Cooldown:         time.Hour,
+		})
+		//the caller's context being done should not count as a failure
+		var state string
+		for i := 0; i < 3; i++ {
+			if err := store.(ContextStore).GetContext(c.ctx, token, &state); err != c.err {
+				t.Fatalf("case %s: incorrect error: expected %v but got %v", c.name, c.err, err)
+			}
+		}
+		if err := store.Save(token, "test state"); err != nil {
+			t.Errorf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+	}
+}
+
+func TestCircuitBreakerStoreCacheEviction(t *testing.T) {
+	inner := newMockStore(false)
+	store := CircuitBreakerStore(inner, CircuitBreakerOptions{
+		FailureThreshold: 1,
+		Cooldown:         time.Hour,
+		CacheSize:        2,
+	}).(*circuitStore)
+
+	tokens := make([]Token, 3)
+	for i := range tokens {
+		tokens[i], _ = NewToken(testSigningKey)
+		if err := store.Save(tokens[i], i); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	if store.entries.Len() != 2 {
+		t.Errorf("incorrect cache size: expected 2 but got %d", store.entries.Len())
+	}
+	if _, found := store.cache[tokens[0].ID().String()]; found {
+		t.Error("least-recently used state was not evicted")
+	}
+}
+
+func TestCircuitBreakerStoreCacheInvalidation(t *testing.T) {
+	inner := newMockStore(false)
+	store := CircuitBreakerStore(inner, CircuitBreakerOptions{
+		FailureThreshold: 1,
+		Cooldown:         time.Hour,
+		CacheSize:        10,
+		CacheMaxAge:      20 * time.Millisecond,
+	})
+	missing, _ := NewToken(testSigningKey)
+	stale, _ := NewToken(testSigningKey)
+	for _, tk := range []Token{missing, stale} {
+		if err := store.Save(tk, "test state"); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+
+	//states found to be missing from the inner store should be uncached
+	inner.Delete(missing)
+	var state string
+	if err := store.Get(missing, &state); err != ErrStateNotFound {
+		t.Fatalf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+
+	//trip the circuit
+	inner.triggerError = true
+	if err := store.Save(stale, "test state"); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected error from inner store but got %v", err)
+	}
+	if err := store.Get(missing, &state); err != ErrCircuitOpen {
+		t.Errorf("incorrect error for missing state: expected %v but got %v", ErrCircuitOpen, err)
+	}
+	if err := store.Get(stale, &state); err != nil {
+		t.Errorf("unexpected error getting cached state: %v", err)
+	}
+
+	//states cached longer ago than CacheMaxAge should not be served
+	time.Sleep(25 * time.Millisecond)
+	if err := store.Get(stale, &state); err != ErrCircuitOpen {
+		t.Errorf("incorrect error for stale state: expected %v but got %v", ErrCircuitOpen, err)
+	}
+}
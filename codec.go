@@ -0,0 +1,144 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+//Codec encodes session state to bytes, and decodes it back again
+type Codec interface {
+	//Encode encodes sessionState
+	Encode(sessionState interface{}) ([]byte, error)
+	//Decode decodes data into sessionState, which must be a pointer
+	Decode(data []byte, sessionState interface{}) error
+}
+
+//DefaultCodec is the Codec used by the package's stores and tokens.
+//Session state that implements encoding.BinaryMarshaler and
+//encoding.BinaryUnmarshaler is encoded using those methods, and state that
+//implements encoding.TextMarshaler and encoding.TextUnmarshaler is encoded
+//using those. All other state is gob-encoded. Since the encoding depends on
+//the state's type, adding or removing these methods from a type makes
+//previously-saved state of that type undecodable.
+var DefaultCodec Codec = defaultCodec{}
+
+//defaultCodec implements DefaultCodec
+type defaultCodec struct{}
+
+func (defaultCodec) Encode(sessionState interface{}) ([]byte, error) {
+	switch m := marshaler(sessionState).(type) {
+	case encoding.BinaryMarshaler:
+		return m.MarshalBinary()
+	case encoding.TextMarshaler:
+		return m.MarshalText()
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (defaultCodec) Decode(data []byte, sessionState interface{}) error {
+	switch u := sessionState.(type) {
+	case encoding.BinaryUnmarshaler:
+		return u.UnmarshalBinary(data)
+	case encoding.TextUnmarshaler:
+		return u.UnmarshalText(data)
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(sessionState)
+}
+
+//marshaler returns a pointer to a copy of sessionState if sessionState
+//isn't a pointer, but its pointer type has marshaling methods, so that
+//state saved by value is encoded the same way it will be decoded
+func marshaler(sessionState interface{}) interface{} {
+	v := reflect.ValueOf(sessionState)
+	if !v.IsValid() || v.Kind() == reflect.Ptr {
+		return sessionState
+	}
+	pt := reflect.PtrTo(v.Type())
+	if !pt.Implements(reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()) &&
+		!pt.Implements(reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()) {
+		return sessionState
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+//WithCodec registers a Codec for session state of the same type as
+//sessionState, so that services with several kinds of sessions can
+//encode each kind differently against the same store. For example, admin
+//sessions could use the DefaultCodec while end-user sessions use a
+//protobuf Codec. Pointers are ignored when matching types, so either a
+//value or a pointer may be passed. State of unregistered types uses the
+//DefaultCodec. Registering any codec records the encoded state alongside
+//metadata in the store, like WithMaxLifetime, so sessions begun without
+//this option are not readable with it, and vice-versa.
+func WithCodec(sessionState interface{}, codec Codec) ManagerOption {
+	return func(m *manager) {
+		if m.codecs == nil {
+			m.codecs = make(map[reflect.Type]Codec)
+		}
+		m.codecs[stateType(sessionState)] = codec
+	}
+}
+
+//codecFor returns the Codec registered for the type of sessionState,
+//or the DefaultCodec if there isn't one
+func (m *manager) codecFor(sessionState interface{}) Codec {
+	if codec, found := m.codecs[stateType(sessionState)]; found {
+		return codec
+	}
+	return DefaultCodec
+}
+
+//stateType returns the type of sessionState, dereferencing any pointers
+func stateType(sessionState interface{}) reflect.Type {
+	t := reflect.TypeOf(sessionState)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+//CodecError is returned by the package's stores when session state
+//couldn't be encoded or decoded. Unlike most store errors, retrying
+//the operation won't help.
+type CodecError struct {
+	//Op is "encoding" or "decoding"
+	Op string
+	//Err is the error returned by the Codec
+	Err error
+}
+
+//Error returns the error message
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("error %s session state: %v", e.Op, e.Err)
+}
+
+//Unwrap returns the error returned by the Codec, for use with errors.Is and errors.As
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+//encodeState encodes sessionState using the DefaultCodec
+func encodeState(sessionState interface{}) ([]byte, error) {
+	data, err := DefaultCodec.Encode(sessionState)
+	if err != nil {
+		return nil, &CodecError{Op: "encoding", Err: err}
+	}
+	return data, nil
+}
+
+//decodeState decodes data into sessionState using the DefaultCodec
+func decodeState(data []byte, sessionState interface{}) error {
+	if err := DefaultCodec.Decode(data, sessionState); err != nil {
+		return &CodecError{Op: "decoding", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//bitset is session state with a compact binary encoding
+type bitset []uint64
+
+func (b bitset) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, len(b)*8)
+	for _, w := range b {
+		for i := 0; i < 8; i++ {
+			buf = append(buf, byte(w>>(8*i)))
+		}
+	}
+	return buf, nil
+}
+
+func (b *bitset) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return fmt.Errorf("invalid bitset length %d", len(data))
+	}
+	*b = make(bitset, len(data)/8)
+	for i := range *b {
+		for j := 0; j < 8; j++ {
+			(*b)[i] |= uint64(data[i*8+j]) << (8 * j)
+		}
+	}
+	return nil
+}
+
+//upperName is session state with a text encoding, whose
+//marshaling methods are defined on the pointer type
+type upperName struct {
+	Name string
+}
+
+func (u *upperName) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(u.Name)), nil
+}
+
+func (u *upperName) UnmarshalText(data []byte) error {
+	u.Name = strings.ToLower(string(data))
+	return nil
+}
+
+func TestDefaultCodec(t *testing.T) {
+	data, err := DefaultCodec.Encode(bitset{1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error encoding bitset: %v", err)
+	}
+	if len(data) != 16 {
+		t.Errorf("bitset was not encoded using MarshalBinary: %v", data)
+	}
+	var b bitset
+	if err := DefaultCodec.Decode(data, &b); err != nil {
+		t.Fatalf("unexpected error decoding bitset: %v", err)
+	}
+	if len(b) != 2 || b[0] != 1 || b[1] != 2 {
+		t.Errorf("incorrect bitset: %v", b)
+	}
+
+	//state saved by value should be encoded using the pointer type's methods
+	for _, state := range []interface{}{upperName{"tester"}, &upperName{"tester"}} {
+		data, err := DefaultCodec.Encode(state)
+		if err != nil {
+			t.Fatalf("unexpected error encoding %T: %v", state, err)
+		}
+		if !bytes.Equal(data, []byte("TESTER")) {
+			t.Errorf("%T was not encoded using MarshalText: %s", state, data)
+		}
+		var u upperName
+		if err := DefaultCodec.Decode(data, &u); err != nil || u.Name != "tester" {
+			t.Errorf("incorrect name: expected tester, <nil> but got %s, %v", u.Name, err)
+		}
+	}
+
+	//other state should be gob-encoded
+	data, err = DefaultCodec.Encode(map[string]int{"count": 1})
+	if err != nil {
+		t.Fatalf("unexpected error encoding map: %v", err)
+	}
+	var m map[string]int
+	if err := DefaultCodec.Decode(data, &m); err != nil || m["count"] != 1 {
+		t.Errorf("incorrect map: %v, %v", m, err)
+	}
+	if err := DefaultCodec.Decode([]byte{1, 2, 3}, &b); err == nil {
+		t.Error("did not receive expected error when decoding invalid data")
+	}
+}
+
+//jsonCodec is a Codec that encodes state as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(sessionState interface{}) ([]byte, error) {
+	return json.Marshal(sessionState)
+}
+
+func (jsonCodec) Decode(data []byte, sessionState interface{}) error {
+	return json.Unmarshal(data, sessionState)
+}
+
+func TestManagerWithCodec(t *testing.T) {
+	type adminState struct {
+		Admin string
+	}
+	type userState struct {
+		User string
+	}
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithCodec(&adminState{}, jsonCodec{}))
+
+	cases := []struct {
+		name     string
+		state    interface{}
+		getState interface{}
+		json     bool
+	}{
+		{"admin", adminState{"root"}, &adminState{}, true},
+		{"user", &userState{"tester"}, &userState{}, false},
+	}
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		tk, err := mgr.BeginSession(respRec, c.state)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		env := &envelope{}
+		if err := store.Get(tk, env); err != nil {
+			t.Fatalf("case %s: unexpected error getting envelope: %v", c.name, err)
+		}
+		if json.Valid(env.State) != c.json {
+			t.Errorf("case %s: incorrect encoding: %q", c.name, env.State)
+		}
+
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		if _, err := mgr.GetState(req, c.getState); err != nil {
+			t.Errorf("case %s: unexpected error getting state: %v", c.name, err)
+		}
+		expected := reflect.Indirect(reflect.ValueOf(c.state)).Interface()
+		if actual := reflect.Indirect(reflect.ValueOf(c.getState)).Interface(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("case %s: incorrect state: expected %v but got %v", c.name, c.state, c.getState)
+		}
+	}
+}
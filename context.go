@@ -0,0 +1,60 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+//contextKey is the type used for keys of values this package
+//stores in a context.Context, so they can't collide with keys
+//defined in other packages
+type contextKey int
+
+const (
+	tokenContextKey contextKey = iota
+	stateContextKey
+	replacedContextKey
+)
+
+//NewContext returns a new Context carrying the session token and state.
+//Use this to pass session identity to service layers below your HTTP
+//handlers, which can then retrieve them using TokenFromContext and
+//StateFromContext.
+func NewContext(ctx context.Context, token Token, sessionState interface{}) context.Context {
+	ctx = context.WithValue(ctx, tokenContextKey, token)
+	return context.WithValue(ctx, stateContextKey, sessionState)
+}
+
+//TokenFromContext returns the session Token stored in ctx, if any.
+func TokenFromContext(ctx context.Context) (Token, bool) {
+	tk, ok := ctx.Value(tokenContextKey).(Token)
+	return tk, ok
+}
+
+//StateFromContext returns the session state stored in ctx, if any.
+//The returned value is the same value passed to NewContext, so callers
+//should type-assert it to their own session state type.
+func StateFromContext(ctx context.Context) (interface{}, bool) {
+	state := ctx.Value(stateContextKey)
+	return state, state != nil
+}
+
+//trackReplaced returns a copy of ctx in which the manager records whether
+//the request's session was ended or replaced by a new one, along with the
+//flag it sets, so that AutoSave doesn't recreate the session when saving
+func trackReplaced(ctx context.Context) (context.Context, *atomic.Bool) {
+	replaced := &atomic.Bool{}
+	return context.WithValue(ctx, replacedContextKey, replaced), replaced
+}
+
+//markReplaced records that the request's session was ended
+//or replaced, if the request's context is tracking that
+func markReplaced(r *http.Request) {
+	if r == nil {
+		return
+	}
+	if replaced, ok := r.Context().Value(replacedContextKey).(*atomic.Bool); ok {
+		replaced.Store(true)
+	}
+}
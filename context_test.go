@@ -0,0 +1,38 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	state := &statelessState{UserID: 42}
+
+	//ensure we get nothing from an empty context
+	if _, ok := TokenFromContext(context.Background()); ok {
+		t.Error("got a token from an empty context")
+	}
+	if _, ok := StateFromContext(context.Background()); ok {
+		t.Error("got state from an empty context")
+	}
+
+	ctx := NewContext(context.Background(), token, state)
+	tk, ok := TokenFromContext(ctx)
+	if !ok {
+		t.Fatal("no token found in context")
+	}
+	if tk.String() != token.String() {
+		t.Errorf("incorrect token: expected %s but got %s", token.String(), tk.String())
+	}
+	s, ok := StateFromContext(ctx)
+	if !ok {
+		t.Fatal("no state found in context")
+	}
+	if s.(*statelessState) != state {
+		t.Errorf("incorrect state: expected %+v but got %+v", state, s)
+	}
+}
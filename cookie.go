@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//maxCookieValueLength is the maximum length of a single cookie value.
+//Browsers limit each cookie to about 4096 bytes, including the name
+//and attributes, so this leaves some room for those.
+const maxCookieValueLength = 3800
+
+//cookieChunksPrefix prefixes the value of the primary cookie when
+//the value has been split across multiple chunk cookies. The rest
+//of the primary cookie value is the number of chunks.
+const cookieChunksPrefix = "chunks-"
+
+//cookieChunkName returns the name of the chunk cookie at index i (1-based)
+func cookieChunkName(name string, i int) string {
+	return name + "C" + strconv.Itoa(i)
+}
+
+//SetChunkedCookie adds cookie to the response. If the cookie's value is
+//too long for a single cookie (e.g., a large token or inline session state),
+//the value is split across multiple numbered cookies, and the primary
+//cookie records how many chunks there are. All chunk cookies share the
+//other attributes of cookie. Use ReadChunkedCookie to reassemble the value.
+func SetChunkedCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	if len(cookie.Value) <= maxCookieValueLength {
+		http.SetCookie(w, cookie)
+		return
+	}
+
+	numChunks := (len(cookie.Value) + maxCookieValueLength - 1) / maxCookieValueLength
+	for i := 0; i < numChunks; i++ {
+		end := (i + 1) * maxCookieValueLength
+		if end > len(cookie.Value) {
+			end = len(cookie.Value)
+		}
+		chunk := *cookie
+		chunk.Name = cookieChunkName(cookie.Name, i+1)
+		chunk.Value = cookie.Value[i*maxCookieValueLength : end]
+		http.SetCookie(w, &chunk)
+	}
+	primary := *cookie
+	primary.Value = cookieChunksPrefix + strconv.Itoa(numChunks)
+	http.SetCookie(w, &primary)
+}
+
+//ReadChunkedCookie reads the value of the named cookie from the request,
+//reassembling it if it was split across multiple cookies by SetChunkedCookie.
+//If the cookie doesn't exist, http.ErrNoCookie is returned.
+func ReadChunkedCookie(r *http.Request, name string) (string, error) {
+	primary, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(primary.Value, cookieChunksPrefix) {
+		return primary.Value, nil
+	}
+
+	numChunks, err := strconv.Atoi(primary.Value[len(cookieChunksPrefix):])
+	if err != nil || numChunks < 1 {
+		return "", fmt.Errorf("invalid cookie chunk count %q", primary.Value)
+	}
+	var sb strings.Builder
+	for i := 1; i <= numChunks; i++ {
+		chunk, err := r.Cookie(cookieChunkName(name, i))
+		if err != nil {
+			return "", fmt.Errorf("missing cookie chunk %d of %d", i, numChunks)
+		}
+		sb.WriteString(chunk.Value)
+	}
+	return sb.String(), nil
+}
+
+//DeleteChunkedCookie expires the cookie, along with any chunk cookies
+//sent in the request. The cookie's Path and Domain must match those
+//used when it was set.
+func DeleteChunkedCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) {
+	expire := func(name string) {
+		c := *cookie
+		c.Name = name
+		c.Value = ""
+		c.MaxAge = -1
+		http.SetCookie(w, &c)
+	}
+	expire(cookie.Name)
+	for i := 1; ; i++ {
+		name := cookieChunkName(cookie.Name, i)
+		if _, err := r.Cookie(name); err != nil {
+			break
+		}
+		expire(name)
+	}
+}
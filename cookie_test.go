@@ -0,0 +1,121 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//requestWithCookies returns a new request carrying the cookies set in respRec
+func requestWithCookies(respRec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	for _, c := range respRec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			req.AddCookie(c)
+		}
+	}
+	return req
+}
+
+func TestChunkedCookie(t *testing.T) {
+	cases := []struct {
+		name           string
+		value          string
+		expectedCookie int
+	}{
+		{
+			"short value",
+			"short",
+			1,
+		},
+		{
+			"max length value",
+			strings.Repeat("a", maxCookieValueLength),
+			1,
+		},
+		{
+			"value one byte too long",
+			strings.Repeat("a", maxCookieValueLength+1),
+			3,
+		},
+		{
+			"very long value",
+			strings.Repeat("abcdefghij", maxCookieValueLength),
+			11,
+		},
+	}
+
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		SetChunkedCookie(respRec, &http.Cookie{Name: "session", Value: c.value, Path: "/", HttpOnly: true})
+		cookies := respRec.Result().Cookies()
+		if len(cookies) != c.expectedCookie {
+			t.Errorf("case %s: incorrect number of cookies: expected %d but got %d", c.name, c.expectedCookie, len(cookies))
+		}
+		for _, cookie := range cookies {
+			if len(cookie.Value) > maxCookieValueLength {
+				t.Errorf("case %s: cookie %s value is too long: %d", c.name, cookie.Name, len(cookie.Value))
+			}
+			if !cookie.HttpOnly || cookie.Path != "/" {
+				t.Errorf("case %s: cookie %s did not retain attributes", c.name, cookie.Name)
+			}
+		}
+
+		req := requestWithCookies(respRec)
+		value, err := ReadChunkedCookie(req, "session")
+		if err != nil {
+			t.Errorf("case %s: unexpected error reading cookie: %v", c.name, err)
+			continue
+		}
+		if value != c.value {
+			t.Errorf("case %s: reassembled value does not match original", c.name)
+		}
+
+		//delete and ensure all cookies are expired
+		respRec = httptest.NewRecorder()
+		DeleteChunkedCookie(respRec, req, &http.Cookie{Name: "session", Path: "/"})
+		deleted := respRec.Result().Cookies()
+		if len(deleted) != c.expectedCookie {
+			t.Errorf("case %s: incorrect number of deleted cookies: expected %d but got %d", c.name, c.expectedCookie, len(deleted))
+		}
+		for _, cookie := range deleted {
+			if cookie.MaxAge >= 0 {
+				t.Errorf("case %s: cookie %s was not expired", c.name, cookie.Name)
+			}
+		}
+	}
+}
+
+func TestReadChunkedCookieErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		cookies []*http.Cookie
+	}{
+		{
+			"no cookie",
+			nil,
+		},
+		{
+			"invalid chunk count",
+			[]*http.Cookie{{Name: "session", Value: cookieChunksPrefix + "x"}},
+		},
+		{
+			"missing chunk",
+			[]*http.Cookie{
+				{Name: "session", Value: cookieChunksPrefix + "2"},
+				{Name: cookieChunkName("session", 1), Value: "abc"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		for _, cookie := range c.cookies {
+			req.AddCookie(cookie)
+		}
+		if _, err := ReadChunkedCookie(req, "session"); err == nil {
+			t.Errorf("case %s: did not receive expected error", c.name)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package sessions
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//DefaultCORSMethods are the methods that CORS
+//allows in cross-origin requests by default
+var DefaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+//CORS is middleware that adds the Cross-Origin Resource Sharing headers
+//that single-page apps on other origins need in order to use sessions
+//carried by a Transport. Browsers hide response headers from scripts on
+//other origins unless they are exposed, so CORS exposes the headers the
+//transport writes tokens to, such as Authorization, and allows the headers
+//the transport reads tokens from. If the transport uses cookies, CORS also
+//allows credentials, which browsers require before sending cookies with
+//cross-origin requests.
+type CORS struct {
+	//AllowedOrigins are the origins allowed to make cross-origin requests,
+	//such as "https://app.example.com". Use "*" to allow any origin, which
+	//is answered with a literal "*" and without allowing credentials, so
+	//that browsers never send cookies to origins that aren't listed, even
+	//for transports that use cookies. Callers may adjust this after construction.
+	AllowedOrigins []string
+	//AllowedMethods are the methods allowed in cross-origin requests.
+	//Defaults to DefaultCORSMethods.
+	AllowedMethods []string
+	//AllowedHeaders are request headers that are allowed in addition
+	//to those the transport reads tokens from. Defaults to Content-Type.
+	AllowedHeaders []string
+	//ExposedHeaders are response headers that are exposed in addition to
+	//those the transport writes tokens to. Defaults to HeaderSessionExpires.
+	ExposedHeaders []string
+	//MaxAge is how long browsers may cache the response to a preflight
+	//request. Zero means browsers use their own default.
+	MaxAge      time.Duration
+	transport   Transport
+	credentials bool
+}
+
+//NewCORS constructs a new CORS for sessions carried by the transport,
+//which should be the transport used by the Manager, allowing requests
+//from the allowedOrigins
+func NewCORS(transport Transport, allowedOrigins ...string) *CORS {
+	return &CORS{
+		AllowedOrigins: allowedOrigins,
+		AllowedMethods: DefaultCORSMethods,
+		AllowedHeaders: []string{"Content-Type"},
+		ExposedHeaders: []string{HeaderSessionExpires},
+		transport:      transport,
+		credentials:    usesCookies(transport),
+	}
+}
+
+//Handler returns middleware that adds CORS headers to responses for
+//requests from allowed origins, and responds to preflight requests
+//itself. Other requests are passed to next unchanged.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if len(origin) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		listed, wildcard := c.allowed(origin)
+		if !listed && !wildcard {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if listed {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if c.credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			//credentials are only allowed for listed origins
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+
+		//preflight requests are answered here
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			h.Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+			if allowed := append(transportRequestHeaders(c.transport), c.AllowedHeaders...); len(allowed) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(allowed, ", "))
+			}
+			if c.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exposed := append(transportResponseHeaders(c.transport), c.ExposedHeaders...); len(exposed) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//allowed reports whether the origin is listed in AllowedOrigins,
+//and whether any origin is allowed using "*"
+func (c *CORS) allowed(origin string) (listed bool, wildcard bool) {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			wildcard = true
+		} else if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			listed = true
+		}
+	}
+	return listed, wildcard
+}
+
+//transportResponseHeaders returns the response
+//headers the transport writes tokens to
+func transportResponseHeaders(t Transport) []string {
+	switch tt := t.(type) {
+	case *HeaderTransport:
+		return []string{tt.Name}
+	case *CSRF:
+		return transportResponseHeaders(tt.Transport)
+	case multiTransport:
+		var headers []string
+		for _, inner := range tt {
+			headers = append(headers, transportResponseHeaders(inner)...)
+		}
+		return headers
+	}
+	return nil
+}
+
+//transportRequestHeaders returns the request headers
+//the transport reads tokens from
+func transportRequestHeaders(t Transport) []string {
+	switch tt := t.(type) {
+	case *HeaderTransport:
+		return []string{tt.Name}
+	case *CSRF:
+		//scripts also need to submit CSRF tokens
+		return append(transportRequestHeaders(tt.Transport), tt.HeaderName)
+	case multiTransport:
+		var headers []string
+		for _, inner := range tt {
+			headers = append(headers, transportRequestHeaders(inner)...)
+		}
+		return headers
+	}
+	return nil
+}
+
+//usesCookies reports whether the transport carries tokens in cookies
+func usesCookies(t Transport) bool {
+	switch tt := t.(type) {
+	case *CookieTransport:
+		return true
+	case *CSRF:
+		return true
+	case multiTransport:
+		for _, inner := range tt {
+			if usesCookies(inner) {
+				return true
+			}
+		}
+	}
+	return false
+}
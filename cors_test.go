@@ -0,0 +1,112 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cookieTransport := &CookieTransport{Cookie: http.Cookie{Name: "session"}}
+	cases := []struct {
+		name                string
+		cors                *CORS
+		method              string
+		origin              string
+		preflight           bool
+		expectedStatus      int
+		expectedOrigin      string
+		expectedCredentials string
+		expectedExposed     string
+		expectedAllowed     string
+	}{
+		{
+			"default transport",
+			NewCORS(DefaultTransport, "https://app.example.com"),
+			"POST", "https://app.example.com", false,
+			http.StatusOK, "https://app.example.com", "", headerAuthorization + ", " + HeaderSessionExpires, "",
+		},
+		{
+			"preflight",
+			NewCORS(DefaultTransport, "https://app.example.com"),
+			"OPTIONS", "https://app.example.com", true,
+			http.StatusNoContent, "https://app.example.com", "", "", headerAuthorization + ", Content-Type",
+		},
+		{
+			"disallowed origin",
+			NewCORS(DefaultTransport, "https://app.example.com"),
+			"POST", "https://evil.com", false,
+			http.StatusOK, "", "", "", "",
+		},
+		{
+			"any origin",
+			NewCORS(DefaultTransport, "*"),
+			"GET", "https://other.example.com", false,
+			http.StatusOK, "*", "", headerAuthorization + ", " + HeaderSessionExpires, "",
+		},
+		{
+			"no origin",
+			NewCORS(DefaultTransport, "*"),
+			"GET", "", false,
+			http.StatusOK, "", "", "", "",
+		},
+		{
+			"cookie transport",
+			NewCORS(cookieTransport, "https://app.example.com"),
+			"POST", "https://app.example.com", false,
+			http.StatusOK, "https://app.example.com", "true", HeaderSessionExpires, "",
+		},
+		{
+			"any origin with cookies",
+			NewCORS(cookieTransport, "https://app.example.com", "*"),
+			"POST", "https://evil.com", false,
+			http.StatusOK, "*", "", HeaderSessionExpires, "",
+		},
+		{
+			"listed origin with cookies and any origin",
+			NewCORS(cookieTransport, "https://app.example.com", "*"),
+			"POST", "https://app.example.com", false,
+			http.StatusOK, "https://app.example.com", "true", HeaderSessionExpires, "",
+		},
+		{
+			"CSRF preflight",
+			NewCORS(NewCSRF([]string{string(testSigningKey)}, cookieTransport), "https://app.example.com"),
+			"OPTIONS", "https://app.example.com", true,
+			http.StatusNoContent, "https://app.example.com", "true", "", DefaultCSRFHeader + ", Content-Type",
+		},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com", nil)
+		if len(c.origin) > 0 {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		respRec := httptest.NewRecorder()
+		c.cors.Handler(next).ServeHTTP(respRec, req)
+		h := respRec.Header()
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+		if !strings.Contains(h.Get("Vary"), "Origin") {
+			t.Errorf("case %s: response does not vary by origin", c.name)
+		}
+		actual := []string{
+			h.Get("Access-Control-Allow-Origin"),
+			h.Get("Access-Control-Allow-Credentials"),
+			h.Get("Access-Control-Expose-Headers"),
+			h.Get("Access-Control-Allow-Headers"),
+		}
+		expected := []string{c.expectedOrigin, c.expectedCredentials, c.expectedExposed, c.expectedAllowed}
+		for i, name := range []string{"allowed origin", "credentials", "exposed headers", "allowed headers"} {
+			if actual[i] != expected[i] {
+				t.Errorf("case %s: incorrect %s: expected %q but got %q", c.name, name, expected[i], actual[i])
+			}
+		}
+	}
+}
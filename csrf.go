@@ -0,0 +1,175 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+//DefaultCSRFCookieName is the default name of the CSRF cookie
+const DefaultCSRFCookieName = "csrf_token"
+
+//DefaultCSRFHeader is the default request header
+//from which submitted CSRF tokens are read
+const DefaultCSRFHeader = "X-CSRF-Token"
+
+//DefaultCSRFFormField is the default form field from which
+//submitted CSRF tokens are read if the header is missing
+const DefaultCSRFFormField = "csrf_token"
+
+//csrfLabel is mixed into CSRF tokens, so that they can never
+//be confused with the signatures of session tokens
+const csrfLabel = "sessions csrf token"
+
+//CSRF protects sessions carried in cookies from cross-site request forgery,
+//using the double-submit cookie pattern. It is a Transport that wraps the
+//session's cookie transport, so that whenever the manager writes a session
+//token, such as when beginning or upgrading a session, it also writes a
+//CSRF cookie bound to that session. Scripts and forms must read that cookie
+//and submit its value in a header or form field with every state-changing
+//request, which Protect compares against the cookie and the session token.
+//Since CSRF tokens are derived from the session ID, a CSRF token can't be
+//used with any session other than the one it was issued for.
+type CSRF struct {
+	//Transport carries session tokens, usually a CookieTransport.
+	//Callers may adjust this after construction.
+	Transport Transport
+	//Cookie is the template for the CSRF cookie. Its Value is set to
+	//the CSRF token. Defaults to a cookie named DefaultCSRFCookieName with
+	//a Path of "/" and SameSite=Strict. The cookie must not be HttpOnly,
+	//since scripts need to read it. Callers may adjust this after
+	//construction, such as to set Secure or Domain.
+	Cookie http.Cookie
+	//HeaderName is the request header from which submitted CSRF tokens
+	//are read. Defaults to DefaultCSRFHeader.
+	HeaderName string
+	//FormField is the form field from which submitted CSRF tokens are
+	//read if the header is missing. Defaults to DefaultCSRFFormField.
+	FormField string
+	keys      keyRing
+	tokenOpts []TokenOption
+}
+
+//NewCSRF constructs a new CSRF that wraps the session transport. The
+//signingKeys and TokenOptions must match those used by the Manager.
+//Pass the returned CSRF to the Manager using WithTransport, and wrap
+//handlers with Protect.
+func NewCSRF(signingKeys []string, transport Transport, opts ...TokenOption) *CSRF {
+	return NewCSRFWithKeys(newKeyRing(signingKeys), transport, opts...)
+}
+
+//NewCSRFWithKeys is like NewCSRF, but accepts keys that declare their
+//own algorithms, matching those passed to the Manager using
+//WithSigningKeys. CSRF tokens are signed with secrets derived from
+//the key that verified the session token, so sessions whose tokens
+//are verified by keys that can only verify tokens are rejected.
+//It panics if any key is invalid.
+func NewCSRFWithKeys(signingKeys []SigningKey, transport Transport, opts ...TokenOption) *CSRF {
+	keys := append(keyRing(nil), signingKeys...)
+	keys.mustCheck()
+	return &CSRF{
+		Transport: transport,
+		Cookie: http.Cookie{
+			Name:     DefaultCSRFCookieName,
+			Path:     "/",
+			SameSite: http.SameSiteStrictMode,
+		},
+		HeaderName: DefaultCSRFHeader,
+		FormField:  DefaultCSRFFormField,
+		keys:       keys,
+		tokenOpts:  opts,
+	}
+}
+
+//Write adds the session token to the response using the wrapped
+//Transport, and sets a CSRF cookie bound to that session
+func (c *CSRF) Write(w http.ResponseWriter, token Token) error {
+	if err := c.Transport.Write(w, token); err != nil {
+		return err
+	}
+	csrfToken, err := c.newToken(token.String())
+	if err != nil {
+		return err
+	}
+	cookie := c.Cookie
+	cookie.Value = csrfToken
+	http.SetCookie(w, &cookie)
+	return nil
+}
+
+//Read returns the session token from the request using the wrapped Transport
+func (c *CSRF) Read(r *http.Request) (string, error) {
+	return c.Transport.Read(r)
+}
+
+//ReadCandidates returns the candidate session tokens
+//from the request using the wrapped Transport
+func (c *CSRF) ReadCandidates(r *http.Request) ([]string, error) {
+	return readCandidates(c.Transport, r)
+}
+
+//Token returns the CSRF token for the session in the request, for
+//embedding in forms rendered by the server. ErrNoToken is returned
+//if the request has no session token.
+func (c *CSRF) Token(r *http.Request) (string, error) {
+	b64tk, err := c.Transport.Read(r)
+	if err != nil {
+		return "", err
+	}
+	return c.newToken(b64tk)
+}
+
+//Protect returns middleware that responds with 403 Forbidden to
+//state-changing requests with a session token, unless the CSRF token
+//submitted in the header or form field matches both the CSRF cookie
+//and the session. Requests using safe methods (GET, HEAD, OPTIONS,
+//and TRACE), and requests without a session token, are passed to next.
+func (c *CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		expected, err := c.Token(r)
+		if err == ErrNoToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cookie, cookieErr := r.Cookie(c.Cookie.Name)
+		submitted := r.Header.Get(c.HeaderName)
+		if len(submitted) == 0 && len(c.FormField) > 0 {
+			submitted = r.PostFormValue(c.FormField)
+		}
+		if err != nil || cookieErr != nil || len(submitted) == 0 ||
+			!hmac.Equal([]byte(cookie.Value), []byte(expected)) ||
+			!hmac.Equal([]byte(submitted), []byte(expected)) {
+			http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//newToken verifies the base64-encoded session token,
+//and returns the CSRF token bound to it
+func (c *CSRF) newToken(b64token string) (string, error) {
+	tk, key, err := c.keys.verify(b64token, c.tokenOpts)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(csrfLabel))
+	h.Write([]byte(tk.ID().String()))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+//isSafeMethod reports whether the HTTP method is one that
+//shouldn't change state, and so doesn't need CSRF protection
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
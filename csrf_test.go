@@ -0,0 +1,103 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	signingKeys := []string{string(testSigningKey)}
+	csrf := NewCSRF(signingKeys, &CookieTransport{Cookie: http.Cookie{Name: "session"}})
+	mgr := NewManager(DefaultIDLength, signingKeys, newMockStore(false), WithTransport(csrf))
+	handler := csrf.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	//begin returns the session and CSRF cookies written by the manager
+	begin := func() (*http.Cookie, *http.Cookie) {
+		respRec := httptest.NewRecorder()
+		if _, err := mgr.BeginSession(respRec, "test state"); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		var session, csrfCookie *http.Cookie
+		for _, c := range respRec.Result().Cookies() {
+			switch c.Name {
+			case "session":
+				session = c
+			case DefaultCSRFCookieName:
+				csrfCookie = c
+			}
+		}
+		if session == nil || csrfCookie == nil {
+			t.Fatalf("session and CSRF cookies not both written: %v", respRec.Result().Cookies())
+		}
+		if csrfCookie.HttpOnly {
+			t.Error("CSRF cookie is HttpOnly")
+		}
+		return session, csrfCookie
+	}
+	session, csrfCookie := begin()
+	//rotating the session should issue a new CSRF token,
+	//which doesn't work with the old session
+	_, rotatedCSRFCookie := begin()
+	if rotatedCSRFCookie.Value == csrfCookie.Value {
+		t.Error("new session was issued the same CSRF token")
+	}
+
+	cases := []struct {
+		name           string
+		method         string
+		session        *http.Cookie
+		csrfCookie     *http.Cookie
+		header         string
+		formValue      string
+		expectedStatus int
+	}{
+		{"valid header", "POST", session, csrfCookie, csrfCookie.Value, "", http.StatusNoContent},
+		{"valid form field", "POST", session, csrfCookie, "", csrfCookie.Value, http.StatusNoContent},
+		{"safe method", "GET", session, nil, "", "", http.StatusNoContent},
+		{"no session", "POST", nil, nil, "", "", http.StatusNoContent},
+		{"missing submitted token", "POST", session, csrfCookie, "", "", http.StatusForbidden},
+		{"missing cookie", "DELETE", session, nil, csrfCookie.Value, "", http.StatusForbidden},
+		{"mismatched submitted token", "POST", session, csrfCookie, rotatedCSRFCookie.Value, "", http.StatusForbidden},
+		{"token from another session", "PUT", session, rotatedCSRFCookie, rotatedCSRFCookie.Value, "", http.StatusForbidden},
+		{"invalid session", "POST", &http.Cookie{Name: "session", Value: "garbage"}, csrfCookie, csrfCookie.Value, "", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		var req *http.Request
+		if len(c.formValue) > 0 {
+			req = httptest.NewRequest(c.method, "http://example.com", strings.NewReader(url.Values{DefaultCSRFFormField: {c.formValue}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(c.method, "http://example.com", nil)
+		}
+		if c.session != nil {
+			req.AddCookie(c.session)
+		}
+		if c.csrfCookie != nil {
+			req.AddCookie(c.csrfCookie)
+		}
+		if len(c.header) > 0 {
+			req.Header.Set(DefaultCSRFHeader, c.header)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+	}
+
+	//Token should return the same token as the cookie, for rendering in forms
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.AddCookie(session)
+	csrfToken, err := csrf.Token(req)
+	if err != nil {
+		t.Fatalf("unexpected error getting CSRF token: %v", err)
+	}
+	if csrfToken != csrfCookie.Value {
+		t.Errorf("incorrect CSRF token: expected %s but got %s", csrfCookie.Value, csrfToken)
+	}
+}
@@ -0,0 +1,362 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrNoDeviceRegistry is returned from the device methods when the
+//manager was not constructed WithDeviceRegistry
+var ErrNoDeviceRegistry = errors.New("manager has no device registry")
+
+//ErrDeviceNotFound is returned from RevokeDevice when
+//the user has no device with the given ID
+var ErrDeviceNotFound = errors.New("device not found")
+
+//Device describes a device that a user has signed in from
+type Device struct {
+	//ID uniquely identifies the device for its user
+	ID string `json:"id"`
+	//Name is a friendly name for the device, such as "Dave's iPhone"
+	Name string `json:"name,omitempty"`
+	//Platform describes the device's platform, such as "iOS 17" or "Firefox on Linux"
+	Platform string `json:"platform,omitempty"`
+	//SessionID is the string version of the ID of the device's current session
+	SessionID string `json:"sessionID"`
+	//FirstSeen is when the device was first registered
+	FirstSeen time.Time `json:"firstSeen"`
+	//LastSeen is when the device's session was last accessed
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+//DeviceIdentifier is implemented by session state types that describe
+//the device the session belongs to. When a manager has a DeviceRegistry,
+//sessions whose state implements both this and UserIdentifier are
+//recorded in the registry.
+type DeviceIdentifier interface {
+	//SessionDevice returns the session's device. Only the ID,
+	//Name, and Platform fields are used. If the ID is empty, the
+	//session is not recorded in the registry.
+	SessionDevice() Device
+}
+
+//DeviceRegistry records the devices that each user has signed in
+//from, powering "manage your devices" screens
+type DeviceRegistry interface {
+	//Register adds or replaces the user's device, preserving
+	//the FirstSeen time of a device that is already registered
+	Register(userID string, device Device) error
+	//Touch updates the LastSeen time of the user's device
+	Touch(userID string, deviceID string, lastSeen time.Time) error
+	//Devices returns the user's devices, most recently seen first
+	Devices(userID string) ([]Device, error)
+	//Remove removes and returns the user's device,
+	//or returns ErrDeviceNotFound if there is no such device
+	Remove(userID string, deviceID string) (Device, error)
+	//Unregister removes the user's device, but only if its current
+	//session is still the one with the given session ID, so that
+	//ending an old session doesn't remove a device that has since
+	//signed in again. It is not an error if there is no such device.
+	Unregister(userID string, deviceID string, sessionID string) error
+}
+
+//memoryDeviceRegistry is an in-memory DeviceRegistry
+type memoryDeviceRegistry struct {
+	mx      sync.Mutex
+	devices map[string]map[string]Device
+}
+
+//NewMemoryDeviceRegistry constructs a new DeviceRegistry that holds
+//devices in memory. Devices are not shared between processes, so use
+//NewRedisDeviceRegistry when running multiple instances.
+func NewMemoryDeviceRegistry() DeviceRegistry {
+	return &memoryDeviceRegistry{devices: make(map[string]map[string]Device)}
+}
+
+//Register adds or replaces the user's device
+func (mdr *memoryDeviceRegistry) Register(userID string, device Device) error {
+	mdr.mx.Lock()
+	defer mdr.mx.Unlock()
+	devices := mdr.devices[userID]
+	if devices == nil {
+		devices = make(map[string]Device)
+		mdr.devices[userID] = devices
+	}
+	if existing, found := devices[device.ID]; found {
+		device.FirstSeen = existing.FirstSeen
+	}
+	devices[device.ID] = device
+	return nil
+}
+
+//Touch updates the LastSeen time of the user's device
+func (mdr *memoryDeviceRegistry) Touch(userID string, deviceID string, lastSeen time.Time) error {
+	mdr.mx.Lock()
+	defer mdr.mx.Unlock()
+	if device, found := mdr.devices[userID][deviceID]; found {
+		device.LastSeen = lastSeen
+		mdr.devices[userID][deviceID] = device
+	}
+	return nil
+}
+
+//Devices returns the user's devices, most recently seen first
+func (mdr *memoryDeviceRegistry) Devices(userID string) ([]Device, error) {
+	mdr.mx.Lock()
+	defer mdr.mx.Unlock()
+	devices := make([]Device, 0, len(mdr.devices[userID]))
+	for _, device := range mdr.devices[userID] {
+		devices = append(devices, device)
+	}
+	sortDevices(devices)
+	return devices, nil
+}
+
+//Remove removes and returns the user's device
+func (mdr *memoryDeviceRegistry) Remove(userID string, deviceID string) (Device, error) {
+	mdr.mx.Lock()
+	defer mdr.mx.Unlock()
+	device, found := mdr.devices[userID][deviceID]
+	if !found {
+		return Device{}, ErrDeviceNotFound
+	}
+	delete(mdr.devices[userID], deviceID)
+	if len(mdr.devices[userID]) == 0 {
+		delete(mdr.devices, userID)
+	}
+	return device, nil
+}
+
+//Unregister removes the user's device if its session ID matches
+func (mdr *memoryDeviceRegistry) Unregister(userID string, deviceID string, sessionID string) error {
+	mdr.mx.Lock()
+	defer mdr.mx.Unlock()
+	if device, found := mdr.devices[userID][deviceID]; found && device.SessionID == sessionID {
+		delete(mdr.devices[userID], deviceID)
+		if len(mdr.devices[userID]) == 0 {
+			delete(mdr.devices, userID)
+		}
+	}
+	return nil
+}
+
+//DefaultRedisDeviceKeyPrefix is the default prefix added to user IDs
+//to form the redis keys of the hashes holding their devices
+const DefaultRedisDeviceKeyPrefix = "devices:"
+
+//registerDeviceScriptSrc saves a device, preserving the FirstSeen
+//time of the existing device, and resets the hash's TTL
+const registerDeviceScriptSrc = `
+local device = cjson.decode(ARGV[2])
+local existing = redis.call("HGET", KEYS[1], ARGV[1])
+if existing then
+	device.firstSeen = cjson.decode(existing).firstSeen
+end
+redis.call("HSET", KEYS[1], ARGV[1], cjson.encode(device))
+redis.call("EXPIRE", KEYS[1], ARGV[3])`
+
+var registerDeviceScript = redis.NewScript(1, registerDeviceScriptSrc)
+
+//touchDeviceScriptSrc updates the LastSeen time of a device
+//and resets the hash's TTL, but only if the device exists
+const touchDeviceScriptSrc = `
+local existing = redis.call("HGET", KEYS[1], ARGV[1])
+if not existing then
+	return 0
+end
+local device = cjson.decode(existing)
+device.lastSeen = ARGV[2]
+redis.call("HSET", KEYS[1], ARGV[1], cjson.encode(device))
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return 1`
+
+var touchDeviceScript = redis.NewScript(1, touchDeviceScriptSrc)
+
+//removeDeviceScriptSrc removes and returns a device. If ARGV[2]
+//is not empty, the device is removed only if its session ID matches.
+const removeDeviceScriptSrc = `
+local existing = redis.call("HGET", KEYS[1], ARGV[1])
+if not existing then
+	return false
+end
+if ARGV[2] ~= "" and cjson.decode(existing).sessionID ~= ARGV[2] then
+	return false
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+return existing`
+
+var removeDeviceScript = redis.NewScript(1, removeDeviceScriptSrc)
+
+//RedisDeviceRegistry is a DeviceRegistry backed by redis. Each user's
+//devices are stored as JSON values in a hash, keyed by device ID.
+type RedisDeviceRegistry struct {
+	//Prefix added to user IDs to form redis keys.
+	//Defaults to DefaultRedisDeviceKeyPrefix, but
+	//callers may adjust this after construction.
+	KeyPrefix string
+	//DeviceDuration is how long a user's devices are kept after
+	//any of them was last registered or seen. This should be at
+	//least as long as the session duration.
+	DeviceDuration time.Duration
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//NewRedisDeviceRegistry constructs a new RedisDeviceRegistry, which
+//keeps each user's devices for deviceDuration after any of them was
+//last registered or seen
+func NewRedisDeviceRegistry(pool *redis.Pool, deviceDuration time.Duration) *RedisDeviceRegistry {
+	return &RedisDeviceRegistry{
+		KeyPrefix:      DefaultRedisDeviceKeyPrefix,
+		DeviceDuration: deviceDuration,
+		pool:           pool,
+	}
+}
+
+//Register adds or replaces the user's device
+func (rdr *RedisDeviceRegistry) Register(userID string, device Device) error {
+	v, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("error encoding device: %v", err)
+	}
+	conn := rdr.pool.Get()
+	defer conn.Close()
+	if _, err := registerDeviceScript.Do(conn, rdr.KeyPrefix+userID, device.ID, v, rdr.DeviceDuration.Seconds()); err != nil {
+		return fmt.Errorf("error registering device: %v", err)
+	}
+	return nil
+}
+
+//Touch updates the LastSeen time of the user's device
+func (rdr *RedisDeviceRegistry) Touch(userID string, deviceID string, lastSeen time.Time) error {
+	conn := rdr.pool.Get()
+	defer conn.Close()
+	if _, err := touchDeviceScript.Do(conn, rdr.KeyPrefix+userID, deviceID,
+		lastSeen.Format(time.RFC3339Nano), rdr.DeviceDuration.Seconds()); err != nil {
+		return fmt.Errorf("error touching device: %v", err)
+	}
+	return nil
+}
+
+//Devices returns the user's devices, most recently seen first
+func (rdr *RedisDeviceRegistry) Devices(userID string) ([]Device, error) {
+	conn := rdr.pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("HVALS", rdr.KeyPrefix+userID))
+	if err != nil {
+		return nil, fmt.Errorf("error executing HVALS: %v", err)
+	}
+	devices := make([]Device, len(values))
+	for i, v := range values {
+		if err := json.Unmarshal(v, &devices[i]); err != nil {
+			return nil, fmt.Errorf("error decoding device: %v", err)
+		}
+	}
+	sortDevices(devices)
+	return devices, nil
+}
+
+//Remove removes and returns the user's device
+func (rdr *RedisDeviceRegistry) Remove(userID string, deviceID string) (Device, error) {
+	return rdr.remove(userID, deviceID, "")
+}
+
+//Unregister removes the user's device if its session ID matches
+func (rdr *RedisDeviceRegistry) Unregister(userID string, deviceID string, sessionID string) error {
+	_, err := rdr.remove(userID, deviceID, sessionID)
+	if err == ErrDeviceNotFound {
+		return nil
+	}
+	return err
+}
+
+//remove removes and returns the user's device, if its session ID
+//matches sessionID or sessionID is empty
+func (rdr *RedisDeviceRegistry) remove(userID string, deviceID string, sessionID string) (Device, error) {
+	var device Device
+	conn := rdr.pool.Get()
+	defer conn.Close()
+	v, err := redis.Bytes(removeDeviceScript.Do(conn, rdr.KeyPrefix+userID, deviceID, sessionID))
+	if err == redis.ErrNil {
+		return device, ErrDeviceNotFound
+	}
+	if err != nil {
+		return device, fmt.Errorf("error removing device: %v", err)
+	}
+	if err := json.Unmarshal(v, &device); err != nil {
+		return device, fmt.Errorf("error decoding device: %v", err)
+	}
+	return device, nil
+}
+
+//sortDevices sorts devices from most to least recently seen
+func sortDevices(devices []Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeen.After(devices[j].LastSeen)
+	})
+}
+
+//Devices returns the devices the user has signed in from, most
+//recently seen first. The manager must be constructed
+//WithDeviceRegistry, or ErrNoDeviceRegistry is returned.
+func (m *manager) Devices(userID string) ([]Device, error) {
+	if m.devices == nil {
+		return nil, ErrNoDeviceRegistry
+	}
+	return m.devices.Devices(userID)
+}
+
+//RevokeDevice removes the user's device from the registry, and revokes
+//its current session, as described in Revoke. The manager must be
+//constructed WithDeviceRegistry, or ErrNoDeviceRegistry is returned.
+func (m *manager) RevokeDevice(userID string, deviceID string) error {
+	if m.devices == nil {
+		return ErrNoDeviceRegistry
+	}
+	device, err := m.devices.Remove(userID, deviceID)
+	if err != nil {
+		return err
+	}
+	tk, err := m.tokenFromID(device.SessionID)
+	if err != nil {
+		return err
+	}
+	return m.Revoke(tk)
+}
+
+//registerDevice records the session's device in the registry, if the
+//session state identifies both its user and device, and returns the
+//device ID, or an empty string if the device was not recorded
+func (m *manager) registerDevice(token Token, sessionState interface{}) (string, error) {
+	ui, ok := sessionState.(UserIdentifier)
+	if !ok || len(ui.SessionUserID()) == 0 {
+		return "", nil
+	}
+	di, ok := sessionState.(DeviceIdentifier)
+	if !ok {
+		return "", nil
+	}
+	d := di.SessionDevice()
+	if len(d.ID) == 0 {
+		return "", nil
+	}
+	now := time.Now()
+	device := Device{
+		ID:        d.ID,
+		Name:      d.Name,
+		Platform:  d.Platform,
+		SessionID: token.ID().String(),
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	if err := m.devices.Register(ui.SessionUserID(), device); err != nil {
+		return "", fmt.Errorf("error registering device: %v", err)
+	}
+	return d.ID, nil
+}
@@ -0,0 +1,218 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type deviceState struct {
+	UserID   string
+	DeviceID string
+}
+
+func (ds *deviceState) SessionUserID() string {
+	return ds.UserID
+}
+
+func (ds *deviceState) SessionDevice() Device {
+	return Device{ID: ds.DeviceID, Name: "device " + ds.DeviceID, Platform: "test"}
+}
+
+func TestManagerDevices(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithDeviceRegistry(NewMemoryDeviceRegistry()),
+		WithRevocationList(NewMemoryRevocationList()))
+
+	begin := func(state interface{}) *http.Request {
+		respRec := httptest.NewRecorder()
+		if _, err := mgr.BeginSession(respRec, state); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		return req
+	}
+	phone := begin(&deviceState{"user1", "phone"})
+	time.Sleep(time.Millisecond)
+	laptop := begin(&deviceState{"user1", "laptop"})
+	begin(&deviceState{"user1", ""})
+	begin(&userState{"user1"})
+	begin(&deviceState{"user2", "tablet"})
+
+	devices, err := mgr.Devices("user1")
+	if err != nil {
+		t.Fatalf("unexpected error getting devices: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("incorrect number of devices: expected 2 but got %d", len(devices))
+	}
+	if devices[0].ID != "laptop" || devices[1].ID != "phone" {
+		t.Errorf("devices not ordered by last seen: %v", devices)
+	}
+	if devices[1].Name != "device phone" || devices[1].Platform != "test" {
+		t.Errorf("incorrect device descriptor: %v", devices[1])
+	}
+
+	//accessing a session should update its device's last seen time
+	time.Sleep(time.Millisecond)
+	state := &deviceState{}
+	if _, err := mgr.GetState(phone, state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	devices, _ = mgr.Devices("user1")
+	if devices[0].ID != "phone" {
+		t.Errorf("last seen time was not updated: %v", devices)
+	}
+	if !devices[0].FirstSeen.Before(devices[0].LastSeen) {
+		t.Errorf("first seen time was not preserved: %v", devices[0])
+	}
+
+	//revoking a device should revoke its session
+	if err := mgr.RevokeDevice("user1", "phone"); err != nil {
+		t.Fatalf("unexpected error revoking device: %v", err)
+	}
+	if _, err := mgr.GetState(phone, state); err != ErrSessionRevoked {
+		t.Errorf("incorrect error: expected %v but got %v", ErrSessionRevoked, err)
+	}
+	if err := mgr.RevokeDevice("user1", "phone"); err != ErrDeviceNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrDeviceNotFound, err)
+	}
+
+	//ending a session should not remove its device if
+	//the device has since signed in with another session
+	newLaptop := begin(&deviceState{"user1", "laptop"})
+	if err := mgr.EndSession(laptop); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if devices, _ := mgr.Devices("user1"); len(devices) != 1 {
+		t.Errorf("device removed after ending its old session: %v", devices)
+	}
+
+	//ending a session should remove its device
+	if err := mgr.EndSession(newLaptop); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if devices, _ := mgr.Devices("user1"); len(devices) != 0 {
+		t.Errorf("devices remain after ending their sessions: %v", devices)
+	}
+	if devices, _ := mgr.Devices("user2"); len(devices) != 1 {
+		t.Errorf("incorrect number of devices for other user: expected 1 but got %d", len(devices))
+	}
+
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if _, err := mgr.Devices("user1"); err != ErrNoDeviceRegistry {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoDeviceRegistry, err)
+	}
+	if err := mgr.RevokeDevice("user1", "phone"); err != ErrNoDeviceRegistry {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoDeviceRegistry, err)
+	}
+}
+
+//failingTouchRegistry is a DeviceRegistry whose Touch always fails
+type failingTouchRegistry struct {
+	DeviceRegistry
+}
+
+func (ftr failingTouchRegistry) Touch(userID string, deviceID string, lastSeen time.Time) error {
+	return fmt.Errorf("test error")
+}
+
+func TestManagerDeviceTouchFailure(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithDeviceRegistry(failingTouchRegistry{NewMemoryDeviceRegistry()}))
+	respRec := httptest.NewRecorder()
+	if _, err := mgr.BeginSession(respRec, &deviceState{"user1", "phone"}); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	//failing to update the last seen time should not fail the request
+	state := &deviceState{}
+	if _, err := mgr.GetState(req, state); err != nil || state.DeviceID != "phone" {
+		t.Errorf("incorrect result: expected phone, <nil> but got %s, %v", state.DeviceID, err)
+	}
+}
+
+func TestRedisDeviceRegistry(t *testing.T) {
+	srv := miniredis.RunT(t)
+	dr := NewRedisDeviceRegistry(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	firstSeen := time.Now().Add(-time.Hour).UTC()
+	if err := dr.Register("user1", Device{ID: "phone", SessionID: "old", FirstSeen: firstSeen, LastSeen: firstSeen}); err != nil {
+		t.Fatalf("unexpected error registering device: %v", err)
+	}
+	if ttl := srv.TTL("devices:user1"); ttl != time.Hour {
+		t.Errorf("incorrect TTL: expected %v but got %v", time.Hour, ttl)
+	}
+
+	//registering an existing device should preserve its first seen time
+	srv.FastForward(time.Minute)
+	now := time.Now().UTC()
+	if err := dr.Register("user1", Device{ID: "phone", SessionID: "new", FirstSeen: now, LastSeen: now}); err != nil {
+		t.Errorf("unexpected error registering device: %v", err)
+	}
+	if err := dr.Register("user1", Device{ID: "laptop", SessionID: "laptop", FirstSeen: firstSeen, LastSeen: firstSeen}); err != nil {
+		t.Errorf("unexpected error registering device: %v", err)
+	}
+	devices, err := dr.Devices("user1")
+	if err != nil {
+		t.Errorf("unexpected error getting devices: %v", err)
+	}
+	if len(devices) != 2 || devices[0].SessionID != "new" || !devices[0].FirstSeen.Equal(firstSeen) || !devices[0].LastSeen.Equal(now) {
+		t.Errorf("incorrect devices: %v", devices)
+	}
+	if ttl := srv.TTL("devices:user1"); ttl != time.Hour {
+		t.Errorf("incorrect TTL: expected %v but got %v", time.Hour, ttl)
+	}
+
+	//touching should update only the last seen time, and
+	//should not recreate a device that was removed
+	lastSeen := now.Add(time.Minute)
+	if err := dr.Touch("user1", "laptop", lastSeen); err != nil {
+		t.Errorf("unexpected error touching device: %v", err)
+	}
+	if err := dr.Touch("user1", "tablet", lastSeen); err != nil {
+		t.Errorf("unexpected error touching device: %v", err)
+	}
+	devices, _ = dr.Devices("user1")
+	if len(devices) != 2 || devices[0].ID != "laptop" || !devices[0].LastSeen.Equal(lastSeen) || !devices[0].FirstSeen.Equal(firstSeen) {
+		t.Errorf("incorrect devices after touch: %v", devices)
+	}
+
+	//unregistering should remove the device only if its session matches
+	if err := dr.Unregister("user1", "phone", "old"); err != nil {
+		t.Errorf("unexpected error unregistering device: %v", err)
+	}
+	if err := dr.Unregister("user1", "tablet", "old"); err != nil {
+		t.Errorf("unexpected error unregistering device: %v", err)
+	}
+	if devices, _ := dr.Devices("user1"); len(devices) != 2 {
+		t.Errorf("device unregistered by another session: %v", devices)
+	}
+	if err := dr.Unregister("user1", "phone", "new"); err != nil {
+		t.Errorf("unexpected error unregistering device: %v", err)
+	}
+	if devices, _ := dr.Devices("user1"); len(devices) != 1 {
+		t.Errorf("device not unregistered: %v", devices)
+	}
+
+	if _, err := dr.Remove("user1", "tablet"); err != ErrDeviceNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrDeviceNotFound, err)
+	}
+	if device, err := dr.Remove("user1", "laptop"); err != nil || device.SessionID != "laptop" {
+		t.Errorf("incorrect result: expected laptop, <nil> but got %s, %v", device.SessionID, err)
+	}
+
+	srv.Close()
+	if _, err := dr.Devices("user1"); err == nil {
+		t.Error("did not receive expected error from closed server")
+	}
+	if err := dr.Touch("user1", "phone", now); err == nil {
+		t.Error("did not receive expected error from closed server")
+	}
+}
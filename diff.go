@@ -0,0 +1,124 @@
+package sessions
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+//FieldChange describes a change to one field of session state
+type FieldChange struct {
+	//Field is the name of the struct field or Values key that changed,
+	//or an empty string if the state isn't a struct or map, in which
+	//case the state as a whole changed
+	Field string `json:"field"`
+	//Old is the field's previous value, or nil if it wasn't
+	//set, or the manager doesn't include values in diffs
+	Old interface{} `json:"old,omitempty"`
+	//New is the field's new value, or nil if it was
+	//deleted, or the manager doesn't include values in diffs
+	New interface{} `json:"new,omitempty"`
+}
+
+//WithStateDiffs makes UpdateState compare the new session state to the
+//state in the store, and include the changed fields in the EventUpdated
+//event, so that audit sinks can record exactly what changed in each
+//session, and when. Only the top-level exported fields of structs, and
+//the keys of maps, such as Values, are compared. If includeValues is
+//true, the old and new values of each changed field are included too,
+//so they must be safe to send to the manager's event sinks. The previous
+//state is decoded from the bytes UpdateState already reads to preserve
+//the session's metadata, so this option records the encoded state
+//alongside metadata in the store, like WithMaxLifetime. Sessions begun
+//without this option are not readable with it, and vice-versa, and it
+//can't be used with stores that support only Values state, such as
+//RedisHashStore.
+func WithStateDiffs(includeValues bool) ManagerOption {
+	return func(m *manager) {
+		m.stateDiffs = true
+		m.diffValues = includeValues
+	}
+}
+
+//previousState returns a new value of the same type as sessionState,
+//decoded from the encoded state that was read from the store in env
+func (m *manager) previousState(sessionState interface{}, env *envelope) (interface{}, error) {
+	t := reflect.TypeOf(sessionState)
+	if t == nil {
+		return nil, fmt.Errorf("session state is nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	target := reflect.New(t).Interface()
+	if err := env.getState(target, m.codecFor(sessionState)); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+//diffState returns the changes between the old and new session state,
+//including their values if includeValues is true
+func diffState(old interface{}, new interface{}, includeValues bool) []FieldChange {
+	oldv, newv := indirect(reflect.ValueOf(old)), indirect(reflect.ValueOf(new))
+	change := func(field string, o reflect.Value, n reflect.Value) FieldChange {
+		fc := FieldChange{Field: field}
+		if includeValues {
+			if o.IsValid() {
+				fc.Old = o.Interface()
+			}
+			if n.IsValid() {
+				fc.New = n.Interface()
+			}
+		}
+		return fc
+	}
+
+	var changes []FieldChange
+	switch {
+	case !oldv.IsValid() || !newv.IsValid() || oldv.Type() != newv.Type():
+		return []FieldChange{change("", oldv, newv)}
+	case newv.Kind() == reflect.Struct:
+		for i := 0; i < newv.NumField(); i++ {
+			field := newv.Type().Field(i)
+			if len(field.PkgPath) > 0 {
+				//unexported
+				continue
+			}
+			if !reflect.DeepEqual(oldv.Field(i).Interface(), newv.Field(i).Interface()) {
+				changes = append(changes, change(field.Name, oldv.Field(i), newv.Field(i)))
+			}
+		}
+	case newv.Kind() == reflect.Map && newv.Type().Key().Kind() == reflect.String:
+		keys := map[string]bool{}
+		for _, k := range oldv.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range newv.MapKeys() {
+			keys[k.String()] = true
+		}
+		names := make([]string, 0, len(keys))
+		for k := range keys {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := reflect.ValueOf(name).Convert(newv.Type().Key())
+			o, n := oldv.MapIndex(key), newv.MapIndex(key)
+			if o.IsValid() != n.IsValid() || (o.IsValid() && !reflect.DeepEqual(o.Interface(), n.Interface())) {
+				changes = append(changes, change(name, o, n))
+			}
+		}
+	case !reflect.DeepEqual(oldv.Interface(), newv.Interface()):
+		changes = append(changes, change("", oldv, newv))
+	}
+	return changes
+}
+
+//indirect dereferences pointers until it reaches a non-pointer value
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type profileState struct {
+	Name   string
+	Email  string
+	Roles  []string
+	secret string
+}
+
+func TestDiffState(t *testing.T) {
+	cases := []struct {
+		name          string
+		old           interface{}
+		new           interface{}
+		includeValues bool
+		expected      []FieldChange
+	}{
+		{"unchanged struct", &profileState{Name: "a"}, &profileState{Name: "a"}, false, nil},
+		{"changed struct fields", &profileState{Name: "a", Roles: []string{"x"}}, &profileState{Name: "b", Roles: []string{"x", "y"}}, false,
+			[]FieldChange{{Field: "Name"}, {Field: "Roles"}}},
+		{"struct values", &profileState{Email: "a@example.com"}, &profileState{Email: "b@example.com"}, true,
+			[]FieldChange{{Field: "Email", Old: "a@example.com", New: "b@example.com"}}},
+		{"unexported fields ignored", &profileState{secret: "a"}, &profileState{secret: "b"}, true, nil},
+		{"map keys", &Values{"a": 1, "b": 2}, Values{"b": 3, "c": 4}, true,
+			[]FieldChange{{Field: "a", Old: 1}, {Field: "b", Old: 2, New: 3}, {Field: "c", New: 4}}},
+		{"scalar", "old", "new", true, []FieldChange{{Old: "old", New: "new"}}},
+		{"unchanged scalar", "same", "same", true, nil},
+		{"different types", "old", 1, false, []FieldChange{{}}},
+	}
+	for _, c := range cases {
+		changes := diffState(c.old, c.new, c.includeValues)
+		if !reflect.DeepEqual(changes, c.expected) {
+			t.Errorf("case %s: incorrect changes: expected %+v but got %+v", c.name, c.expected, changes)
+		}
+	}
+}
+
+//undecodableCodec is a Codec that can't decode what it encodes
+type undecodableCodec struct{}
+
+func (undecodableCodec) Encode(sessionState interface{}) ([]byte, error) {
+	return []byte("test"), nil
+}
+
+func (undecodableCodec) Decode(data []byte, sessionState interface{}) error {
+	return fmt.Errorf("test error")
+}
+
+func TestManagerStateDiffs(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []ManagerOption
+	}{
+		{"bare state", []ManagerOption{WithStateDiffs(true)}},
+		{"envelope", []ManagerOption{WithStateDiffs(true), WithMaxLifetime(time.Hour)}},
+	}
+	for _, c := range cases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false), c.opts...)
+		var changes []FieldChange
+		mgr.Subscribe(func(e Event) {
+			if e.Type == EventUpdated {
+				changes = e.Changes
+			}
+		})
+		tk, err := mgr.BeginSession(httptest.NewRecorder(), &profileState{Name: "a", Email: "a@example.com"})
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		if err := mgr.UpdateState(tk, &profileState{Name: "a", Email: "b@example.com"}); err != nil {
+			t.Fatalf("case %s: unexpected error updating state: %v", c.name, err)
+		}
+		expected := []FieldChange{{Field: "Email", Old: "a@example.com", New: "b@example.com"}}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("case %s: incorrect changes: expected %+v but got %+v", c.name, expected, changes)
+		}
+	}
+
+	//an update that changes nothing should be distinguishable
+	//from one whose changes couldn't be determined
+	emptyCases := []struct {
+		name       string
+		opts       []ManagerOption
+		diffFailed bool
+	}{
+		{"no changes", []ManagerOption{WithStateDiffs(true)}, false},
+		{"undecodable", []ManagerOption{WithStateDiffs(true), WithCodec(profileState{}, undecodableCodec{})}, true},
+	}
+	for _, c := range emptyCases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false), c.opts...)
+		var evt Event
+		mgr.Subscribe(func(e Event) { evt = e })
+		tk, err := mgr.BeginSession(httptest.NewRecorder(), &profileState{Name: "a"})
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		if err := mgr.UpdateState(tk, &profileState{Name: "a"}); err != nil {
+			t.Fatalf("case %s: unexpected error updating state: %v", c.name, err)
+		}
+		if evt.Type != EventUpdated || evt.Changes != nil || evt.DiffFailed != c.diffFailed {
+			t.Errorf("case %s: incorrect event: expected no changes and DiffFailed %t but got %+v", c.name, c.diffFailed, evt)
+		}
+	}
+
+	//without the option, no changes are included
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	changes := []FieldChange{{}}
+	mgr.Subscribe(func(e Event) { changes = e.Changes })
+	tk, _ := mgr.BeginSession(httptest.NewRecorder(), &profileState{Name: "a"})
+	mgr.UpdateState(tk, &profileState{Name: "b"})
+	if changes != nil {
+		t.Errorf("changes were included without WithStateDiffs: %+v", changes)
+	}
+}
@@ -66,8 +66,11 @@ The `.BeginSession()` method will add an `Authorization` header to the response
 the value `Bearer <token-string>`. The `<token-string>` will be a base64-encoded version
 of the newly-generated session token. The session ID portion of the token is a series of
 crypto-random bytes, the length of which is controlled by the `idLength` parameter passed
-to `sessions.NewManager`. The token also contains an HMAC signature of the ID, which is
-generated using one of your signing keys.
+to `sessions.NewManager`. Time-ordered IDs, such as ULIDs or UUIDv7s, can be selected
+instead by passing `sessions.WithIDGenerator` to `sessions.WithTokenOptions`, and the IDs
+used as store keys can be hex- or base62-encoded by passing `sessions.WithIDEncoding`.
+The token also contains an HMAC signature of the ID, which is generated using one of your
+signing keys.
 
 Clients should hold on to this `Authorization` response header value and send it back
 to the server with all subsequent requests. The `.GetState()` method described below will
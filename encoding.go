@@ -0,0 +1,61 @@
+package sessions
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+//HexEncoding is an Encoding that uses lowercase hex. Its strings are
+//twice as long as the bytes, but contain only the characters 0-9 and
+//a-f, so they survive log pipelines and SQL collations that mangle
+//punctuation or fold case, and they sort in the same order as the bytes.
+var HexEncoding Encoding = hexEncoding{}
+
+//Base62Encoding is an Encoding that uses the characters 0-9, A-Z, and
+//a-z. Its strings are about a third shorter than hex, and contain no
+//punctuation, but they are case-sensitive, and don't sort in the same
+//order as the bytes. Each leading zero byte is encoded as a leading "0",
+//so that the length of the bytes is preserved.
+var Base62Encoding Encoding = base62Encoding{}
+
+//hexEncoding implements HexEncoding
+type hexEncoding struct{}
+
+func (hexEncoding) EncodeToString(src []byte) string {
+	return hex.EncodeToString(src)
+}
+
+func (hexEncoding) DecodeString(s string) ([]byte, error) {
+	return hex.DecodeString(s)
+}
+
+//base62Encoding implements Base62Encoding
+type base62Encoding struct{}
+
+func (base62Encoding) EncodeToString(src []byte) string {
+	zeros := 0
+	for zeros < len(src) && src[zeros] == 0 {
+		zeros++
+	}
+	prefix := strings.Repeat(base62Alphabet[:1], zeros)
+	if zeros == len(src) {
+		return prefix
+	}
+	return prefix + encodeBase62(src[zeros:])
+}
+
+func (base62Encoding) DecodeString(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base62Alphabet[0] {
+		zeros++
+	}
+	out := make([]byte, zeros)
+	if zeros == len(s) {
+		return out, nil
+	}
+	buf, err := decodeBase62(s[zeros:])
+	if err != nil {
+		return nil, err
+	}
+	return append(out, buf...), nil
+}
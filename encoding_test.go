@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodings(t *testing.T) {
+	cases := []struct {
+		name     string
+		enc      Encoding
+		alphabet string
+	}{
+		{"hex", HexEncoding, "0123456789abcdef"},
+		{"base62", Base62Encoding, base62Alphabet},
+	}
+	inputs := [][]byte{
+		{},
+		{0},
+		{0, 0, 0},
+		{0, 0, 1, 2, 3},
+		{255, 255, 255, 255},
+		bytes.Repeat([]byte{0xAB}, DefaultIDLength),
+	}
+
+	for _, c := range cases {
+		for _, input := range inputs {
+			encoded := c.enc.EncodeToString(input)
+			if strings.Trim(encoded, c.alphabet) != "" {
+				t.Errorf("case %s: encoding of %x has characters outside the alphabet: %s", c.name, input, encoded)
+			}
+			decoded, err := c.enc.DecodeString(encoded)
+			if err != nil {
+				t.Errorf("case %s: unexpected error decoding %s: %v", c.name, encoded, err)
+				continue
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("case %s: incorrect round trip: expected %x but got %x", c.name, input, decoded)
+			}
+		}
+		if _, err := c.enc.DecodeString("not-valid_"); err == nil {
+			t.Errorf("case %s: did not receive expected error decoding invalid string", c.name)
+		}
+	}
+}
+
+func TestWithIDEncoding(t *testing.T) {
+	cases := []struct {
+		name string
+		enc  Encoding
+	}{
+		{"hex", HexEncoding},
+		{"base62", Base62Encoding},
+	}
+
+	for _, c := range cases {
+		//tokens should keep their own encoding
+		tk, err := NewToken(testSigningKey, WithIDEncoding(c.enc))
+		if err != nil {
+			t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+		}
+		if _, err := base64.URLEncoding.DecodeString(tk.String()); err != nil {
+			t.Errorf("case %s: token was not base64-encoded: %v", c.name, err)
+		}
+		verified, err := VerifyToken(tk.String(), testSigningKey, WithIDEncoding(c.enc))
+		if err != nil {
+			t.Fatalf("case %s: unexpected error verifying token: %v", c.name, err)
+		}
+		if sid := verified.ID().String(); sid != tk.ID().String() || strings.ContainsAny(sid, "-_=") {
+			t.Errorf("case %s: incorrect ID: expected %s but got %s", c.name, tk.ID(), sid)
+		}
+
+		//the manager should key sessions by the encoded ID,
+		//and reconstruct tokens from them
+		store := newMockStore(false)
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+			WithTokenOptions(WithIDEncoding(c.enc)))
+		tk, err = mgr.BeginSession(nil, "test state")
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		if _, found := store.entries[tk.ID().String()]; !found || strings.ContainsAny(tk.ID().String(), "-_=") {
+			t.Errorf("case %s: session was not saved under the encoded ID %s", c.name, tk.ID())
+		}
+		signed, err := mgr.SignURL(tk, "https://example.com/report.pdf", time.Minute)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error signing URL: %v", c.name, err)
+		}
+		var state string
+		if _, err := mgr.VerifyURL(httptest.NewRequest("GET", signed, nil), &state); err != nil || state != "test state" {
+			t.Errorf("case %s: incorrect result verifying URL: expected test state, <nil> but got %s, %v", c.name, state, err)
+		}
+	}
+}
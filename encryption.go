@@ -0,0 +1,322 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+)
+
+//dataKeyLength is the length of the per-session data keys
+//used to encrypt session state
+const dataKeyLength = 32
+
+//KeyWrapper encrypts and decrypts data keys using master keys. The master
+//keys may be held locally, as with NewLocalKeyWrapper, or by a key
+//management service, which never reveals them. To rotate the master key,
+//make a new key current, while keeping older keys available for unwrapping
+//until all data keys have been re-wrapped.
+type KeyWrapper interface {
+	//KeyID returns the ID of the current master key
+	KeyID() string
+	//Wrap encrypts the data key using the current master key
+	Wrap(dataKey []byte) ([]byte, error)
+	//Unwrap decrypts a data key that was wrapped using the identified master key
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+//localKeyWrapper is a KeyWrapper using AES-GCM master keys held in memory
+type localKeyWrapper struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+//NewLocalKeyWrapper constructs a KeyWrapper that wraps data keys with
+//AES-GCM, using the master keys in masterKeys, which maps key IDs to
+//16, 24, or 32 byte AES keys. Data keys are wrapped using the key
+//identified by currentKeyID.
+func NewLocalKeyWrapper(currentKeyID string, masterKeys map[string][]byte) (KeyWrapper, error) {
+	if _, found := masterKeys[currentKeyID]; !found {
+		return nil, fmt.Errorf("no master key with ID %s", currentKeyID)
+	}
+	kw := &localKeyWrapper{
+		current: currentKeyID,
+		keys:    make(map[string]cipher.AEAD, len(masterKeys)),
+	}
+	for keyID, key := range masterKeys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("error using master key %s: %v", keyID, err)
+		}
+		kw.keys[keyID] = aead
+	}
+	return kw, nil
+}
+
+func (kw *localKeyWrapper) KeyID() string {
+	return kw.current
+}
+
+func (kw *localKeyWrapper) Wrap(dataKey []byte) ([]byte, error) {
+	return seal(rand.Reader, kw.keys[kw.current], dataKey, []byte(kw.current))
+}
+
+func (kw *localKeyWrapper) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, found := kw.keys[keyID]
+	if !found {
+		return nil, fmt.Errorf("no master key with ID %s", keyID)
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+//encryptedState is what an EncryptedStore saves to its underlying store
+type encryptedState struct {
+	//KeyID is the ID of the master key that wrapped the data key
+	KeyID string
+	//WrappedKey is the wrapped data key
+	WrappedKey []byte
+	//Sealed is the encrypted session state
+	Sealed []byte
+}
+
+//EncryptedStore is a Store that encrypts session state before saving it to
+//another store, so that the state can't be read by anyone with access to
+//that store. Each session's state is encrypted with its own data key, which
+//is wrapped by a master key using a KeyWrapper and saved with the state.
+//When the master key is rotated, existing sessions remain readable, and
+//their data keys can be re-wrapped gradually using Rewrap or RewrapAll.
+type EncryptedStore struct {
+	//Rand is the reader used to generate data keys and nonces.
+	//Defaults to crypto/rand.Reader, but tests may adjust this
+	//after construction.
+	Rand    io.Reader
+	store   Store
+	wrapper KeyWrapper
+}
+
+//NewEncryptedStore constructs a new EncryptedStore that saves
+//encrypted state to store, wrapping data keys using wrapper
+func NewEncryptedStore(store Store, wrapper KeyWrapper) *EncryptedStore {
+	return &EncryptedStore{
+		Rand:    rand.Reader,
+		store:   store,
+		wrapper: wrapper,
+	}
+}
+
+//Save encrypts the session state with a new data key
+//and saves it to the underlying store
+func (es *EncryptedStore) Save(token Token, sessionState interface{}) error {
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	enc, err := es.encrypt(token, state)
+	if err != nil {
+		return err
+	}
+	return es.store.Save(token, enc)
+}
+
+//Get gets the encrypted session state from the underlying
+//store, and decrypts it into sessionState
+func (es *EncryptedStore) Get(token Token, sessionState interface{}) error {
+	return es.read(token, sessionState, func(enc *encryptedState) error {
+		return es.store.Get(token, enc)
+	})
+}
+
+//read reads the encrypted session state using get,
+//and decrypts it into sessionState
+func (es *EncryptedStore) read(token Token, sessionState interface{}, get func(enc *encryptedState) error) error {
+	enc := &encryptedState{}
+	if err := get(enc); err != nil {
+		return err
+	}
+	state, err := es.decrypt(token, enc)
+	if err != nil {
+		return err
+	}
+	return decodeState(state, sessionState)
+}
+
+//Delete deletes the session state from the underlying store
+func (es *EncryptedStore) Delete(token Token) error {
+	return es.store.Delete(token)
+}
+
+//Peek is like Get, but peeks at the encrypted session state,
+//if the underlying store implements Peeker
+func (es *EncryptedStore) Peek(token Token, sessionState interface{}) error {
+	return es.read(token, sessionState, func(enc *encryptedState) error {
+		return peek(es.store, token, enc)
+	})
+}
+
+//GetAndTouch is like Get, but resets the expiry time of the encrypted
+//session state in the same operation, if the underlying store
+//implements GetToucher
+func (es *EncryptedStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return es.read(token, sessionState, func(enc *encryptedState) error {
+		return getAndTouch(es.store, token, enc, ttl)
+	})
+}
+
+//Exists reports whether the underlying store has state for the token
+func (es *EncryptedStore) Exists(token Token) (bool, error) {
+	return exists(es.store, token)
+}
+
+//Touch resets the expiry time of the session state in the underlying store
+func (es *EncryptedStore) Touch(token Token) error {
+	return touch(es.store, token)
+}
+
+//TTL returns the time remaining before the session
+//state expires in the underlying store
+func (es *EncryptedStore) TTL(token Token) (time.Duration, error) {
+	return storeTTL(es.store, token)
+}
+
+//Replace encrypts the session state with a new data key, and replaces
+//the replaced token's state with it in the underlying store
+func (es *EncryptedStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	enc, err := es.encrypt(token, state)
+	if err != nil {
+		return err
+	}
+	return replace(es.store, token, enc, replaced)
+}
+
+//Rewrap re-wraps the session's data key using the current master key,
+//without decrypting the session state. It reports whether the data key
+//was re-wrapped, which is false if it was already wrapped by the current
+//master key. If the session is saved by another request between the read
+//and write performed by Rewrap, that update may be lost, so rewrap sessions
+//when they are unlikely to be in use, or accept that risk.
+func (es *EncryptedStore) Rewrap(token Token) (bool, error) {
+	enc := &encryptedState{}
+	if err := es.store.Get(token, enc); err != nil {
+		return false, err
+	}
+	keyID := es.wrapper.KeyID()
+	if enc.KeyID == keyID {
+		return false, nil
+	}
+	dataKey, err := es.wrapper.Unwrap(enc.KeyID, enc.WrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("error unwrapping data key: %v", err)
+	}
+	wrapped, err := es.wrapper.Wrap(dataKey)
+	if err != nil {
+		return false, fmt.Errorf("error wrapping data key: %v", err)
+	}
+	enc.KeyID, enc.WrappedKey = keyID, wrapped
+	if err := es.store.Save(token, enc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//RewrapAll calls Rewrap for every session in the underlying store, which
+//must implement Scanner. It returns the number of sessions whose data keys
+//were re-wrapped. Sessions that end during the scan are skipped.
+func (es *EncryptedStore) RewrapAll() (int, error) {
+	scanner, ok := es.store.(Scanner)
+	if !ok {
+		return 0, fmt.Errorf("error rewrapping data keys: %T does not implement Scanner", es.store)
+	}
+	rewrapped := 0
+	err := scanner.Scan(func(token Token) error {
+		ok, err := es.Rewrap(token)
+		if err == ErrStateNotFound {
+			return nil
+		}
+		if ok {
+			rewrapped++
+		}
+		return err
+	})
+	return rewrapped, err
+}
+
+//Scan scans the underlying store, if it implements Scanner
+func (es *EncryptedStore) Scan(fn func(token Token) error) error {
+	return scan(es.store, fn)
+}
+
+//encrypt encrypts the encoded session state with a new data key,
+//which is wrapped using the current master key
+func (es *EncryptedStore) encrypt(token Token, state []byte) (*encryptedState, error) {
+	dataKey := make([]byte, dataKeyLength)
+	if _, err := io.ReadFull(es.Rand, dataKey); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %v", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	//the session ID is authenticated with the state, so that
+	//encrypted state can't be moved to another session
+	sealed, err := seal(es.Rand, aead, state, []byte(token.ID().String()))
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting session state: %v", err)
+	}
+	keyID := es.wrapper.KeyID()
+	wrapped, err := es.wrapper.Wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping data key: %v", err)
+	}
+	return &encryptedState{keyID, wrapped, sealed}, nil
+}
+
+//decrypt unwraps the data key and returns the encoded session state
+func (es *EncryptedStore) decrypt(token Token, enc *encryptedState) ([]byte, error) {
+	dataKey, err := es.wrapper.Unwrap(enc.KeyID, enc.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %v", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	state, err := open(aead, enc.Sealed, []byte(token.ID().String()))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting session state: %v", err)
+	}
+	return state, nil
+}
+
+//newAEAD returns an AES-GCM cipher using key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+//seal encrypts plaintext with a nonce read from random,
+//and returns the nonce followed by the ciphertext
+func seal(random io.Reader, aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+//open decrypts data returned from seal
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data not long enough")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
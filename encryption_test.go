@@ -0,0 +1,115 @@
+package sessions
+
+import (
+	"bytes"
+	"testing"
+)
+
+//Scan implements Scanner for the mock store
+func (ms *mockStore) Scan(fn func(token Token) error) error {
+	ms.mx.Lock()
+	ids := make([]string, 0, len(ms.entries))
+	for id := range ms.entries {
+		ids = append(ids, id)
+	}
+	ms.mx.Unlock()
+	for _, id := range ids {
+		if err := fn(storeToken(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestNewLocalKeyWrapper(t *testing.T) {
+	cases := []struct {
+		name      string
+		current   string
+		keys      map[string][]byte
+		expectErr bool
+	}{
+		{"valid", "k1", map[string][]byte{"k1": make([]byte, 32), "k0": make([]byte, 16)}, false},
+		{"missing current", "k2", map[string][]byte{"k1": make([]byte, 32)}, true},
+		{"invalid length", "k1", map[string][]byte{"k1": make([]byte, 10)}, true},
+	}
+	for _, c := range cases {
+		_, err := NewLocalKeyWrapper(c.current, c.keys)
+		if (err != nil) != c.expectErr {
+			t.Errorf("case %s: unexpected error result: %v", c.name, err)
+		}
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	masterKeys := map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}
+	wrapper, err := NewLocalKeyWrapper("k1", masterKeys)
+	if err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	inner := newMockStore(false)
+	store := NewEncryptedStore(inner, wrapper)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	if err := store.Save(token, "secret state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if bytes.Contains(inner.entries[token.ID().String()], []byte("secret state")) {
+		t.Error("state was saved unencrypted")
+	}
+	var state string
+	if err := store.Get(token, &state); err != nil || state != "secret state" {
+		t.Errorf("incorrect state: expected secret state, <nil> but got %s, %v", state, err)
+	}
+
+	//encrypted state moved to another session should be rejected
+	other, _ := NewToken(testSigningKey)
+	inner.entries[other.ID().String()] = inner.entries[token.ID().String()]
+	if err := store.Get(other, &state); err == nil {
+		t.Error("did not receive expected error when getting state moved from another session")
+	}
+	if err := store.Delete(other); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+
+	//state should remain readable after rotating the master key
+	masterKeys["k2"] = bytes.Repeat([]byte{2}, 32)
+	if store.wrapper, err = NewLocalKeyWrapper("k2", masterKeys); err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	if err := store.Get(token, &state); err != nil || state != "secret state" {
+		t.Errorf("incorrect state after rotation: expected secret state, <nil> but got %s, %v", state, err)
+	}
+
+	//and after re-wrapping, the old master key should no longer be needed
+	second, _ := NewToken(testSigningKey)
+	if err := store.Save(second, "second state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	rewrapped, err := store.RewrapAll()
+	if err != nil {
+		t.Fatalf("unexpected error rewrapping: %v", err)
+	}
+	if rewrapped != 1 {
+		t.Errorf("incorrect number of rewrapped sessions: expected 1 but got %d", rewrapped)
+	}
+	delete(masterKeys, "k1")
+	if store.wrapper, err = NewLocalKeyWrapper("k2", masterKeys); err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	if err := store.Get(token, &state); err != nil || state != "secret state" {
+		t.Errorf("incorrect state after rewrapping: expected secret state, <nil> but got %s, %v", state, err)
+	}
+
+	store.Rand = &errorReader{}
+	if err := store.Save(token, "secret state"); err == nil {
+		t.Error("did not receive expected error when simulating error reading random bytes")
+	}
+
+	//rewrapping requires a Scanner
+	if _, err := NewEncryptedStore(struct{ Store }{inner}, wrapper).RewrapAll(); err == nil {
+		t.Error("did not receive expected error when rewrapping a store that isn't a Scanner")
+	}
+}
@@ -0,0 +1,104 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+//ErrSessionRejected is returned from GetState when the
+//manager's ResumptionPolicy rejects the session's resumption
+var ErrSessionRejected = errors.New("session resumption rejected by policy")
+
+//ClientInfo holds information about the client that began
+//or is resuming a session, such as its geographic location,
+//autonomous system number, or bot score
+type ClientInfo map[string]string
+
+//Enricher adds information about the client making the request to info.
+//For example, an Enricher might look up the client's IP address in a
+//GeoIP database, and add its country and ASN.
+type Enricher func(r *http.Request, info ClientInfo)
+
+//PolicyDecision is the decision made by a ResumptionPolicy
+type PolicyDecision int
+
+const (
+	//PolicyAllow allows the session to be resumed
+	PolicyAllow PolicyDecision = iota
+	//PolicyFlag allows the session to be resumed, but
+	//emits an EventFlagged event for the session
+	PolicyFlag
+	//PolicyReject rejects the resumption, causing
+	//GetState to return ErrSessionRejected
+	PolicyReject
+)
+
+//ResumptionPolicy decides whether a session may be resumed by the request,
+//comparing the information about the client that began the session with
+//the information about the current client. For example, a policy might
+//reject resumptions from a different country, or flag resumptions from
+//a different ASN for review.
+type ResumptionPolicy func(r *http.Request, original ClientInfo, current ClientInfo) PolicyDecision
+
+//WithEnricher adds an Enricher that is called when sessions are begun using
+//BeginRequestSession or GetOrBeginSession, and when they are resumed. The
+//information gathered when the session is begun is recorded alongside the
+//session's state in the store, so like WithMaxLifetime, sessions begun
+//without this option are not readable with it, and vice-versa.
+func WithEnricher(enricher Enricher) ManagerOption {
+	return func(m *manager) {
+		m.enrichers = append(m.enrichers, enricher)
+	}
+}
+
+//WithResumptionPolicy sets the ResumptionPolicy that decides whether
+//sessions may be resumed. Use WithEnricher to gather the client
+//information that the policy considers.
+func WithResumptionPolicy(policy ResumptionPolicy) ManagerOption {
+	return func(m *manager) {
+		m.policy = policy
+	}
+}
+
+//BeginRequestSession is like BeginSession, but the manager's enrichers
+//are called with the request, and the information they gather about
+//the client is recorded with the session.
+func (m *manager) BeginRequestSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error) {
+	env := &envelope{Created: time.Now()}
+	if len(m.enrichers) > 0 {
+		env.ClientInfo = m.enrich(r)
+	}
+	tk, err := m.beginSession(w, sessionState, env)
+	if err != nil {
+		return nil, err
+	}
+	markReplaced(r)
+	return tk, nil
+}
+
+//enrich returns the information gathered by
+//the manager's enrichers about the request
+func (m *manager) enrich(r *http.Request) ClientInfo {
+	info := ClientInfo{}
+	for _, enricher := range m.enrichers {
+		enricher(r, info)
+	}
+	return info
+}
+
+//checkPolicy applies the manager's ResumptionPolicy to
+//the resumption of the session in env by the request.
+//Sessions resumed without a request aren't checked.
+func (m *manager) checkPolicy(r *http.Request, token Token, env *envelope) error {
+	if m.policy == nil || env == nil || r == nil {
+		return nil
+	}
+	switch m.policy(r, env.ClientInfo, m.enrich(r)) {
+	case PolicyReject:
+		return ErrSessionRejected
+	case PolicyFlag:
+		m.events.emit(EventFlagged, token)
+	}
+	return nil
+}
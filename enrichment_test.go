@@ -0,0 +1,67 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagerEnrichment(t *testing.T) {
+	countryEnricher := func(r *http.Request, info ClientInfo) {
+		info["country"] = r.Header.Get("X-Country")
+	}
+	botEnricher := func(r *http.Request, info ClientInfo) {
+		info["bot"] = r.Header.Get("X-Bot")
+	}
+	policy := func(r *http.Request, original ClientInfo, current ClientInfo) PolicyDecision {
+		if current["bot"] == "yes" {
+			return PolicyReject
+		}
+		if original["country"] != current["country"] {
+			return PolicyFlag
+		}
+		return PolicyAllow
+	}
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithEnricher(countryEnricher), WithEnricher(botEnricher), WithResumptionPolicy(policy))
+	var flagged int
+	mgr.Subscribe(func(evt Event) {
+		if evt.Type == EventFlagged {
+			flagged++
+		}
+	})
+
+	beginReq := httptest.NewRequest("GET", "http://example.com", nil)
+	beginReq.Header.Set("X-Country", "US")
+	respRec := httptest.NewRecorder()
+	if _, err := mgr.BeginRequestSession(respRec, beginReq, "test state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	cases := []struct {
+		name            string
+		country         string
+		bot             string
+		expectedError   error
+		expectedFlagged int
+	}{
+		{"same client", "US", "", nil, 0},
+		{"different country", "FR", "", nil, 1},
+		{"bot", "US", "yes", ErrSessionRejected, 0},
+	}
+
+	for _, c := range cases {
+		flagged = 0
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		req.Header.Set("X-Country", c.country)
+		req.Header.Set("X-Bot", c.bot)
+		var state string
+		if _, err := mgr.GetState(req, &state); err != c.expectedError {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+		}
+		if flagged != c.expectedFlagged {
+			t.Errorf("case %s: incorrect number of flagged events: expected %d but got %d", c.name, c.expectedFlagged, flagged)
+		}
+	}
+}
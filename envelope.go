@@ -0,0 +1,57 @@
+package sessions
+
+import (
+	"time"
+)
+
+//envelope wraps session state with metadata that the Manager
+//needs to enforce its policies. Envelopes are only used when
+//an option that requires them is set, so that managers without
+//those options continue to save bare session state.
+type envelope struct {
+	//Created is when the session was begun
+	Created time.Time
+	//Expires is when the session expires, or zero if
+	//it doesn't have its own expiry time
+	Expires time.Time
+	//UserID is the ID of the session's user, if the
+	//session state implements UserIdentifier
+	UserID string
+	//DeviceID is the ID of the session's device, if the session
+	//was recorded in the manager's DeviceRegistry
+	DeviceID string
+	//ClientInfo is the information gathered by the manager's
+	//enrichers about the client that began the session
+	ClientInfo ClientInfo
+	//Roles are the roles of the session's user, if the manager
+	//was constructed WithRoles and the state implements RoleIdentifier
+	Roles []string
+	//Permissions are the permissions of the session's user, if the manager
+	//was constructed WithRoles and the state implements PermissionIdentifier
+	Permissions []string
+	//Pending is true for pre-sessions begun by BeginPreSession,
+	//which haven't been upgraded to full sessions yet
+	Pending bool
+	//Version is the schema version of the encoded state
+	Version int
+	//State is the encoded session state
+	State []byte
+}
+
+//setState encodes sessionState into the envelope using codec
+func (e *envelope) setState(sessionState interface{}, codec Codec) error {
+	state, err := codec.Encode(sessionState)
+	if err != nil {
+		return &CodecError{Op: "encoding", Err: err}
+	}
+	e.State = state
+	return nil
+}
+
+//getState decodes the envelope's state into sessionState using codec
+func (e *envelope) getState(sessionState interface{}, codec Codec) error {
+	if err := codec.Decode(e.State, sessionState); err != nil {
+		return &CodecError{Op: "decoding", Err: err}
+	}
+	return nil
+}
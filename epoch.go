@@ -0,0 +1,167 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrNoEpochStore is returned from RevokeUser when the
+//manager was not constructed WithEpochStore
+var ErrNoEpochStore = errors.New("manager has no epoch store")
+
+//UserIdentifier is implemented by session state types that identify
+//the session's user. When a manager has an EpochStore, it records the
+//user ID of each session whose state implements this interface, so that
+//RevokeUser can invalidate all of that user's sessions.
+type UserIdentifier interface {
+	//SessionUserID returns the ID of the session's user,
+	//or an empty string if the session has no user yet
+	SessionUserID() string
+}
+
+//EpochStore stores a logout epoch for each user. Sessions for a user
+//that began at or before the user's epoch are invalid, which allows
+//all of a user's sessions to be invalidated at once, without having
+//to find them.
+type EpochStore interface {
+	//SetEpoch sets the user's logout epoch
+	SetEpoch(userID string, epoch time.Time) error
+	//GetEpoch gets the user's logout epoch,
+	//or the zero time if the user has none
+	GetEpoch(userID string) (time.Time, error)
+}
+
+//EpochRetainer is implemented by EpochStores that forget epochs some
+//time after they're set. NewAPIKey won't mint API keys that outlive
+//that time, as they would become valid again once their user's epoch
+//was forgotten.
+type EpochRetainer interface {
+	//EpochRetention returns how long epochs are kept after
+	//they're set, or zero if they're kept forever
+	EpochRetention() time.Duration
+}
+
+//memoryEpochStore is an in-memory EpochStore
+type memoryEpochStore struct {
+	mx     sync.RWMutex
+	epochs map[string]time.Time
+}
+
+//NewMemoryEpochStore constructs a new EpochStore that holds epochs
+//in memory. Epochs are not shared between processes, so use
+//NewRedisEpochStore when running multiple instances.
+func NewMemoryEpochStore() EpochStore {
+	return &memoryEpochStore{epochs: make(map[string]time.Time)}
+}
+
+//SetEpoch sets the user's logout epoch
+func (mes *memoryEpochStore) SetEpoch(userID string, epoch time.Time) error {
+	mes.mx.Lock()
+	defer mes.mx.Unlock()
+	mes.epochs[userID] = epoch
+	return nil
+}
+
+//GetEpoch gets the user's logout epoch
+func (mes *memoryEpochStore) GetEpoch(userID string) (time.Time, error) {
+	mes.mx.RLock()
+	defer mes.mx.RUnlock()
+	return mes.epochs[userID], nil
+}
+
+//DefaultRedisEpochKeyPrefix is the default prefix added to
+//user IDs to form the redis keys of logout epochs
+const DefaultRedisEpochKeyPrefix = "epoch:"
+
+//RedisEpochStore is an EpochStore backed by redis
+type RedisEpochStore struct {
+	//Prefix added to user IDs to form redis keys.
+	//Defaults to DefaultRedisEpochKeyPrefix, but
+	//callers may adjust this after construction.
+	KeyPrefix string
+	//Used for key expiry time on redis. This should be at least as long
+	//as the maximum session lifetime, as sessions older than that can't
+	//be resumed anyway, and API keys can't be minted with a longer
+	//time-to-live. Zero means the epochs never expire. Callers may
+	//adjust this after construction.
+	EpochDuration time.Duration
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//NewRedisEpochStore constructs a new RedisEpochStore
+func NewRedisEpochStore(pool *redis.Pool) *RedisEpochStore {
+	return &RedisEpochStore{
+		KeyPrefix: DefaultRedisEpochKeyPrefix,
+		pool:      pool,
+	}
+}
+
+//EpochRetention returns the EpochDuration
+func (res *RedisEpochStore) EpochRetention() time.Duration {
+	return res.EpochDuration
+}
+
+//SetEpoch sets the user's logout epoch
+func (res *RedisEpochStore) SetEpoch(userID string, epoch time.Time) error {
+	conn := res.pool.Get()
+	defer conn.Close()
+	var err error
+	if res.EpochDuration > 0 {
+		_, err = conn.Do("SETEX", res.KeyPrefix+userID, int64(res.EpochDuration.Seconds()), epoch.UnixNano())
+	} else {
+		_, err = conn.Do("SET", res.KeyPrefix+userID, epoch.UnixNano())
+	}
+	if err != nil {
+		return fmt.Errorf("error setting epoch: %v", err)
+	}
+	return nil
+}
+
+//GetEpoch gets the user's logout epoch
+func (res *RedisEpochStore) GetEpoch(userID string) (time.Time, error) {
+	conn := res.pool.Get()
+	defer conn.Close()
+	nanos, err := redis.Int64(conn.Do("GET", res.KeyPrefix+userID))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error executing GET: %v", err)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+//RevokeUser invalidates all sessions for the user that began before now,
+//by advancing the user's logout epoch. GetState returns ErrSessionRevoked
+//for those sessions from then on. The manager must be constructed
+//WithEpochStore, or ErrNoEpochStore is returned.
+func (m *manager) RevokeUser(userID string) error {
+	if m.epochs == nil {
+		return ErrNoEpochStore
+	}
+	if err := m.epochs.SetEpoch(userID, time.Now()); err != nil {
+		return fmt.Errorf("error revoking user sessions: %v", err)
+	}
+	return nil
+}
+
+//checkEpoch returns ErrSessionRevoked if the session in env began
+//at or before its user's logout epoch
+func (m *manager) checkEpoch(env *envelope) error {
+	if m.epochs == nil || len(env.UserID) == 0 {
+		return nil
+	}
+	epoch, err := m.epochs.GetEpoch(env.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting logout epoch: %v", err)
+	}
+	if !epoch.IsZero() && !env.Created.After(epoch) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
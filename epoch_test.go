@@ -0,0 +1,126 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/redigomock"
+)
+
+type userState struct {
+	UserID string
+}
+
+func (us *userState) SessionUserID() string {
+	return us.UserID
+}
+
+func TestManagerRevokeUser(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithEpochStore(NewMemoryEpochStore()))
+
+	begin := func(state interface{}) *http.Request {
+		respRec := httptest.NewRecorder()
+		if _, err := mgr.BeginSession(respRec, state); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		return req
+	}
+	user1a := begin(&userState{"user1"})
+	user1b := begin(&userState{"user1"})
+	user2 := begin(&userState{"user2"})
+	anonymous := begin(&userState{})
+
+	if err := mgr.RevokeUser("user1"); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	//sessions begun after the epoch should still work
+	user1c := begin(&userState{"user1"})
+
+	cases := []struct {
+		name          string
+		req           *http.Request
+		expectedError error
+	}{
+		{"revoked user session", user1a, ErrSessionRevoked},
+		{"other revoked user session", user1b, ErrSessionRevoked},
+		{"other user session", user2, nil},
+		{"anonymous session", anonymous, nil},
+		{"session begun after epoch", user1c, nil},
+	}
+
+	for _, c := range cases {
+		state := &userState{}
+		if _, err := mgr.GetState(c.req, state); err != c.expectedError {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+	if len(store.entries) != 3 {
+		t.Errorf("state for revoked sessions was not deleted")
+	}
+
+	//sessions should be associated with users when updated too
+	state := &userState{}
+	anonToken, _ := mgr.GetState(anonymous, state)
+	state.UserID = "user2"
+	if err := mgr.UpdateState(anonToken, state); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := mgr.RevokeUser("user2"); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	if _, err := mgr.GetState(anonymous, state); err != ErrSessionRevoked {
+		t.Errorf("incorrect error: expected %v but got %v", ErrSessionRevoked, err)
+	}
+
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if err := mgr.RevokeUser("user1"); err != ErrNoEpochStore {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoEpochStore, err)
+	}
+}
+
+func TestRedisEpochStore(t *testing.T) {
+	conn := redigomock.NewConn()
+	es := NewRedisEpochStore(getMockPool(conn))
+	epoch := time.Now()
+
+	conn.Command("SET", "epoch:user1", epoch.UnixNano()).Expect("OK")
+	if err := es.SetEpoch("user1", epoch); err != nil {
+		t.Errorf("unexpected error setting epoch: %v", err)
+	}
+	es.EpochDuration = time.Hour
+	conn.Command("SETEX", "epoch:user1", int64(3600), epoch.UnixNano()).Expect("OK")
+	if err := es.SetEpoch("user1", epoch); err != nil {
+		t.Errorf("unexpected error setting epoch: %v", err)
+	}
+
+	conn.Command("GET", "epoch:user1").Expect([]byte(fmt.Sprint(epoch.UnixNano())))
+	actual, err := es.GetEpoch("user1")
+	if err != nil {
+		t.Errorf("unexpected error getting epoch: %v", err)
+	}
+	if !actual.Equal(epoch) {
+		t.Errorf("incorrect epoch: expected %v but got %v", epoch, actual)
+	}
+	conn.Command("GET", "epoch:user2").Expect(nil)
+	if actual, err := es.GetEpoch("user2"); err != nil || !actual.IsZero() {
+		t.Errorf("incorrect result for user with no epoch: %v, %v", actual, err)
+	}
+
+	conn.Clear()
+	conn.Command("GET", "epoch:user1").ExpectError(fmt.Errorf("test error"))
+	if _, err := es.GetEpoch("user1"); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+	conn.Command("SETEX", "epoch:user1", int64(3600), epoch.UnixNano()).ExpectError(fmt.Errorf("test error"))
+	if err := es.SetEpoch("user1", epoch); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
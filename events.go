@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+//EventType identifies the kind of session lifecycle event
+type EventType string
+
+//Session lifecycle event types
+const (
+	//EventCreated is emitted when a new session is begun
+	EventCreated EventType = "created"
+	//EventAccessed is emitted when session state is read
+	EventAccessed EventType = "accessed"
+	//EventUpdated is emitted when session state is updated
+	EventUpdated EventType = "updated"
+	//EventEnded is emitted when a session is ended
+	EventEnded EventType = "ended"
+	//EventRevoked is emitted when a session is revoked
+	EventRevoked EventType = "revoked"
+	//EventFlagged is emitted when the manager's ResumptionPolicy
+	//flags a session's resumption as suspicious
+	EventFlagged EventType = "flagged"
+)
+
+//Event describes a session lifecycle event
+type Event struct {
+	//Type is the type of event
+	Type EventType `json:"type"`
+	//SessionID is the string version of the session ID
+	SessionID string `json:"sessionID"`
+	//Time is when the event occurred
+	Time time.Time `json:"time"`
+	//Changes are the changes made to the session state by an update,
+	//if the manager was constructed WithStateDiffs
+	Changes []FieldChange `json:"changes,omitempty"`
+	//DiffFailed is true for an update whose changes couldn't be
+	//determined, such as when the previous state couldn't be decoded.
+	//Otherwise, an update with no Changes from a manager constructed
+	//WithStateDiffs didn't change any fields.
+	DiffFailed bool `json:"diffFailed,omitempty"`
+}
+
+//eventHub is a registry of event subscribers
+type eventHub struct {
+	mx          sync.RWMutex
+	subscribers map[int]func(Event)
+	nextID      int
+}
+
+//newEventHub constructs a new eventHub
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[int]func(Event)),
+	}
+}
+
+//subscribe adds fn to the subscribers, returning
+//a function that removes it
+func (eh *eventHub) subscribe(fn func(Event)) func() {
+	eh.mx.Lock()
+	defer eh.mx.Unlock()
+	id := eh.nextID
+	eh.nextID++
+	eh.subscribers[id] = fn
+	return func() {
+		eh.mx.Lock()
+		defer eh.mx.Unlock()
+		delete(eh.subscribers, id)
+	}
+}
+
+//emit sends a new event to all subscribers
+func (eh *eventHub) emit(eventType EventType, token Token) {
+	eh.emitChanges(eventType, token, nil, false)
+}
+
+//emitChanges is like emit, but includes the changes in the event,
+//or reports that they couldn't be determined if diffFailed is true
+func (eh *eventHub) emitChanges(eventType EventType, token Token, changes []FieldChange, diffFailed bool) {
+	eh.mx.RLock()
+	defer eh.mx.RUnlock()
+	if len(eh.subscribers) == 0 {
+		return
+	}
+	evt := Event{
+		Type:       eventType,
+		SessionID:  token.ID().String(),
+		Time:       time.Now(),
+		Changes:    changes,
+		DiffFailed: diffFailed,
+	}
+	for _, fn := range eh.subscribers {
+		fn(evt)
+	}
+}
@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestManagerEvents(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+
+	var events []Event
+	unsubscribe := mgr.Subscribe(func(evt Event) {
+		events = append(events, evt)
+	})
+	var count int
+	mgr.Subscribe(func(evt Event) {
+		count++
+	})
+
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if err := mgr.UpdateState(token, "updated state"); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+
+	//failed operations should not emit events
+	if _, err := mgr.GetState(req, &state); err == nil {
+		t.Fatal("did not receive expected error getting state after ending session")
+	}
+	store.triggerError = true
+	if err := mgr.UpdateState(token, "updated state"); err == nil {
+		t.Fatal("did not receive expected error from store")
+	}
+	if err := mgr.EndSession(req); err == nil {
+		t.Fatal("did not receive expected error from store")
+	}
+
+	expectedTypes := []EventType{EventCreated, EventAccessed, EventUpdated, EventEnded}
+	var actualTypes []EventType
+	for _, evt := range events {
+		actualTypes = append(actualTypes, evt.Type)
+		if evt.SessionID != token.ID().String() {
+			t.Errorf("incorrect session ID in %s event: expected %s but got %s", evt.Type, token.ID().String(), evt.SessionID)
+		}
+		if evt.Time.IsZero() {
+			t.Errorf("no time in %s event", evt.Type)
+		}
+	}
+	if !reflect.DeepEqual(actualTypes, expectedTypes) {
+		t.Errorf("incorrect events: expected %v but got %v", expectedTypes, actualTypes)
+	}
+	if count != len(expectedTypes) {
+		t.Errorf("incorrect number of events for second subscriber: expected %d but got %d", len(expectedTypes), count)
+	}
+
+	//unsubscribed functions should no longer receive events
+	unsubscribe()
+	store.triggerError = false
+	if _, err := mgr.BeginSession(httptest.NewRecorder(), "test state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if len(events) != len(expectedTypes) {
+		t.Errorf("event delivered after unsubscribing")
+	}
+	if count != len(expectedTypes)+1 {
+		t.Errorf("event not delivered to remaining subscriber")
+	}
+}
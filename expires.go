@@ -0,0 +1,54 @@
+package sessions
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//HeaderSessionExpires is the response header that reports when
+//the session expires, if the manager was constructed WithExpiresHeader
+const HeaderSessionExpires = "X-Session-Expires"
+
+//ExpiresFormat is the format of the HeaderSessionExpires header value
+type ExpiresFormat int
+
+//Supported ExpiresFormats
+const (
+	//ExpiresRFC3339 formats the expiry time using time.RFC3339
+	ExpiresRFC3339 ExpiresFormat = iota + 1
+	//ExpiresSeconds formats the expiry as the number
+	//of whole seconds until the session expires
+	ExpiresSeconds
+)
+
+//WithExpiresHeader adds the HeaderSessionExpires header to responses
+//when the manager begins a session, and when Require or any of its
+//variants allows a request, so that clients can warn users before their
+//sessions expire, without calling a keepalive endpoint. The header reports
+//when the session will expire if it isn't used again, as described in
+//Keepalive, and is omitted if the manager can't tell, or if the store's
+//TTL can't be read.
+func WithExpiresHeader(format ExpiresFormat) ManagerOption {
+	return func(m *manager) {
+		m.expiresFormat = format
+	}
+}
+
+//writeExpires adds the HeaderSessionExpires header to the
+//response, if the manager was constructed WithExpiresHeader
+func (m *manager) writeExpires(w http.ResponseWriter, token Token, env *envelope) {
+	if w == nil || m.expiresFormat == 0 {
+		return
+	}
+	expires, err := m.expiry(token, env)
+	if err != nil || expires.IsZero() {
+		return
+	}
+	switch m.expiresFormat {
+	case ExpiresSeconds:
+		w.Header().Set(HeaderSessionExpires, strconv.FormatInt(int64(time.Until(expires)/time.Second), 10))
+	default:
+		w.Header().Set(HeaderSessionExpires, expires.UTC().Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,61 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpiresHeader(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		name      string
+		store     Store
+		opts      []ManagerOption
+		expectTTL time.Duration
+	}{
+		{"seconds", NewMemoryStore(time.Hour), []ManagerOption{WithExpiresHeader(ExpiresSeconds)}, time.Hour},
+		{"RFC 3339", NewMemoryStore(time.Hour), []ManagerOption{WithExpiresHeader(ExpiresRFC3339)}, time.Hour},
+		{"max lifetime", NewMemoryStore(time.Hour), []ManagerOption{WithExpiresHeader(ExpiresSeconds), WithMaxLifetime(time.Minute)}, time.Minute},
+		{"disabled", NewMemoryStore(time.Hour), nil, 0},
+		{"store without TTLs", newMockStore(false), []ManagerOption{WithExpiresHeader(ExpiresSeconds)}, 0},
+	}
+	for _, c := range cases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, c.store, c.opts...)
+		respRec := httptest.NewRecorder()
+		tk, err := mgr.BeginSession(respRec, "test state")
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+		requireRec := httptest.NewRecorder()
+		mgr.Require(ok, RequireOptions{}).ServeHTTP(requireRec, req)
+
+		for source, header := range map[string]string{
+			"BeginSession": respRec.Header().Get(HeaderSessionExpires),
+			"Require":      requireRec.Header().Get(HeaderSessionExpires),
+		} {
+			if c.expectTTL == 0 {
+				if len(header) > 0 {
+					t.Errorf("case %s: %s added unexpected header %q", c.name, source, header)
+				}
+				continue
+			}
+			var remaining time.Duration
+			if seconds, err := strconv.Atoi(header); err == nil {
+				remaining = time.Duration(seconds) * time.Second
+			} else if expires, err := time.Parse(time.RFC3339, header); err == nil {
+				remaining = time.Until(expires)
+			} else {
+				t.Errorf("case %s: %s added invalid header %q", c.name, source, header)
+				continue
+			}
+			if remaining > c.expectTTL || remaining < c.expectTTL-5*time.Second {
+				t.Errorf("case %s: %s reported incorrect expiry: expected about %v but got %v", c.name, source, c.expectTTL, remaining)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package sessions
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ExpvarMetrics publishes counters about sessions and stores using the
+//expvar package, for services that scrape /debug/vars rather than using
+//a metrics system. Pass it to a manager using WithExpvar, and to
+//MetricsStore to count store operations and errors.
+type ExpvarMetrics struct {
+	prefix         string
+	active         *expvar.Int
+	created        *expvar.Int
+	ended          *expvar.Int
+	revoked        *expvar.Int
+	verifyFailures *expvar.Int
+	storeOps       *expvar.Map
+	storeErrors    *expvar.Int
+}
+
+//NewExpvarMetrics constructs a new ExpvarMetrics, publishing its counters
+//with names beginning with prefix, such as prefix+"sessions_active".
+//Since expvar names must be unique, this panics if it is called twice
+//with the same prefix.
+func NewExpvarMetrics(prefix string) *ExpvarMetrics {
+	return &ExpvarMetrics{
+		prefix:         prefix,
+		active:         expvar.NewInt(prefix + "sessions_active"),
+		created:        expvar.NewInt(prefix + "sessions_created"),
+		ended:          expvar.NewInt(prefix + "sessions_ended"),
+		revoked:        expvar.NewInt(prefix + "sessions_revoked"),
+		verifyFailures: expvar.NewInt(prefix + "verification_failures"),
+		storeOps:       expvar.NewMap(prefix + "store_ops"),
+		storeErrors:    expvar.NewInt(prefix + "store_errors"),
+	}
+}
+
+//WithExpvar publishes counters of the sessions the manager begins, ends,
+//and revokes, and of tokens that fail verification, using ev. The number
+//of active sessions is the number begun less the number ended or revoked
+//since the process started, so it doesn't account for sessions that expire
+//in the store, or that are shared with other processes.
+func WithExpvar(ev *ExpvarMetrics) ManagerOption {
+	return func(m *manager) {
+		m.expvars = ev
+		m.events.subscribe(ev.Send)
+	}
+}
+
+//PublishPool publishes the statistics of a redis connection pool
+//with the name prefix+name
+func (ev *ExpvarMetrics) PublishPool(name string, pool *redis.Pool) {
+	expvar.Publish(ev.prefix+name, expvar.Func(func() interface{} {
+		return pool.Stats()
+	}))
+}
+
+//ObserveStoreOp counts the store operation, and whether it failed.
+//ErrStateNotFound isn't counted as a failure.
+func (ev *ExpvarMetrics) ObserveStoreOp(op StoreOp, elapsed time.Duration, size int, err error) {
+	ev.storeOps.Add(string(op), 1)
+	if err != nil && err != ErrStateNotFound {
+		ev.storeErrors.Add(1)
+	}
+}
+
+//Send counts session events, so that ExpvarMetrics is an EventSink
+func (ev *ExpvarMetrics) Send(evt Event) {
+	switch evt.Type {
+	case EventCreated:
+		ev.created.Add(1)
+		ev.active.Add(1)
+	case EventEnded:
+		ev.ended.Add(1)
+		ev.active.Add(-1)
+	case EventRevoked:
+		ev.revoked.Add(1)
+		ev.active.Add(-1)
+	}
+}
+
+//verifyFailed counts a token that failed verification
+func (ev *ExpvarMetrics) verifyFailed() {
+	if ev != nil {
+		ev.verifyFailures.Add(1)
+	}
+}
@@ -0,0 +1,53 @@
+package sessions
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	ev := NewExpvarMetrics("test_")
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, MetricsStore(store, ev), WithExpvar(ev))
+	ev.PublishPool("redis_pool", getMockPool(nil))
+
+	respRec := httptest.NewRecorder()
+	for i := 0; i < 2; i++ {
+		if _, err := mgr.BeginSession(respRec, "test state"); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	req.Header.Set(headerAuthorization, authTypeBearer+" garbage")
+	mgr.GetToken(req)
+	store.triggerError = true
+	mgr.BeginSession(respRec, "test state")
+
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"test_sessions_created", "2"},
+		{"test_sessions_ended", "1"},
+		{"test_sessions_active", "1"},
+		{"test_verification_failures", "1"},
+		{"test_store_errors", "1"},
+		{"test_store_ops", `{"delete": 1, "save": 3}`},
+		{"test_redis_pool", `{"ActiveCount":0,"IdleCount":0,"WaitCount":0,"WaitDuration":0}`},
+	}
+	for _, c := range cases {
+		v := expvar.Get(c.name)
+		if v == nil {
+			t.Errorf("case %s: variable not published", c.name)
+			continue
+		}
+		if v.String() != c.expected {
+			t.Errorf("case %s: incorrect value: expected %s but got %s", c.name, c.expected, v.String())
+		}
+	}
+}
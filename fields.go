@@ -0,0 +1,213 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//FieldStore is implemented by stores that can read and write individual
+//named fields of Values session state, without fetching and rewriting the
+//whole state. When the manager's store implements FieldStore, Session.Save
+//writes only the fields that were changed with Session.Set and Session.Delete.
+type FieldStore interface {
+	//GetField populates value with the named field of the state associated
+	//with the token. If there is no state associated with the token, or the
+	//state has no such field, ErrStateNotFound is returned.
+	GetField(token Token, name string, value interface{}) error
+	//SetField sets the named field of the state associated with the token.
+	//If there is no state associated with the token, ErrStateNotFound is returned.
+	SetField(token Token, name string, value interface{}) error
+	//DeleteField removes the named field of the state associated with the token
+	DeleteField(token Token, name string) error
+}
+
+//redisHashMarker is a field added to every session hash so that
+//sessions with no values still exist in redis
+const redisHashMarker = ""
+
+//setFieldScriptSrc sets a hash field and resets the hash's TTL,
+//but only if the hash already exists
+const setFieldScriptSrc = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return 1`
+
+var setFieldScript = redis.NewScript(1, setFieldScriptSrc)
+
+//RedisHashStore is a FieldStore backed by redis, which stores each
+//session's Values as a redis hash. It supports only Values session
+//state, so it can't be used with manager options that wrap the
+//state with metadata, such as WithMaxLifetime.
+type RedisHashStore struct {
+	*RedisStore
+}
+
+//NewRedisHashStore constructs a new RedisHashStore
+func NewRedisHashStore(pool *redis.Pool, sessionDuration time.Duration) *RedisHashStore {
+	return &RedisHashStore{NewRedisStore(pool, sessionDuration)}
+}
+
+//Save replaces the hash associated with the session token with
+//the provided sessionState, which must be Values or *Values.
+func (rhs *RedisHashStore) Save(token Token, sessionState interface{}) error {
+	var values Values
+	switch v := sessionState.(type) {
+	case Values:
+		values = v
+	case *Values:
+		values = *v
+	default:
+		return fmt.Errorf("error saving session state: RedisHashStore only supports Values, not %T", sessionState)
+	}
+	args := redis.Args{rhs.getRedisKey(token), redisHashMarker, ""}
+	for name, value := range values {
+		buf, err := encodeField(value)
+		if err != nil {
+			return err
+		}
+		args = append(args, name, buf)
+	}
+
+	conn := rhs.pool.Get()
+	defer conn.Close()
+
+	//replace the hash and set its TTL atomically
+	conn.Send("MULTI")
+	conn.Send("DEL", args[0])
+	conn.Send("HSET", args...)
+	conn.Send("EXPIRE", args[0], rhs.SessionDuration.Seconds())
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("error executing EXEC: %v", err)
+	}
+	return nil
+}
+
+//Get populates sessionState, which must be a *Values, with the hash
+//associated with the session token, and resets the expiry time.
+//If there is no state associated with the token, ErrStateNotFound is returned.
+func (rhs *RedisHashStore) Get(token Token, sessionState interface{}) error {
+	conn := rhs.pool.Get()
+	defer conn.Close()
+
+	//pipeline HGETALL and EXPIRE commands
+	//to get the state and reset its TTL
+	key := rhs.getRedisKey(token)
+	conn.Send("HGETALL", key)
+	conn.Send("EXPIRE", key, rhs.SessionDuration.Seconds())
+	conn.Flush()
+
+	fields, err := redis.StringMap(conn.Receive())
+	if err != nil {
+		return fmt.Errorf("error executing HGETALL: %v", err)
+	}
+	if len(fields) == 0 {
+		return ErrStateNotFound
+	}
+	if sessionState == nil {
+		return nil
+	}
+	values, ok := sessionState.(*Values)
+	if !ok {
+		return fmt.Errorf("error getting session state: RedisHashStore only supports *Values, not %T", sessionState)
+	}
+	*values = make(Values, len(fields))
+	for name, buf := range fields {
+		if name == redisHashMarker {
+			continue
+		}
+		value, err := decodeField([]byte(buf))
+		if err != nil {
+			return err
+		}
+		(*values)[name] = value
+	}
+	return nil
+}
+
+//GetField populates value, which must be a pointer, with the named
+//field of the hash associated with the session token.
+func (rhs *RedisHashStore) GetField(token Token, name string, value interface{}) error {
+	conn := rhs.pool.Get()
+	defer conn.Close()
+	buf, err := redis.Bytes(conn.Do("HGET", rhs.getRedisKey(token), name))
+	if err == redis.ErrNil {
+		return ErrStateNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error executing HGET: %v", err)
+	}
+	field, err := decodeField(buf)
+	if err != nil {
+		return err
+	}
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("error getting field %s: value must be a non-nil pointer", name)
+	}
+	src := reflect.ValueOf(field)
+	if !src.IsValid() {
+		dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+		return nil
+	}
+	if !src.Type().AssignableTo(dest.Elem().Type()) {
+		return fmt.Errorf("error getting field %s: %T is not assignable to %T", name, field, value)
+	}
+	dest.Elem().Set(src)
+	return nil
+}
+
+//SetField sets the named field of the hash associated with
+//the session token, and resets the expiry time.
+func (rhs *RedisHashStore) SetField(token Token, name string, value interface{}) error {
+	buf, err := encodeField(value)
+	if err != nil {
+		return err
+	}
+	conn := rhs.pool.Get()
+	defer conn.Close()
+	set, err := redis.Bool(setFieldScript.Do(conn, rhs.getRedisKey(token), name, buf, rhs.SessionDuration.Seconds()))
+	if err != nil {
+		return fmt.Errorf("error setting field: %v", err)
+	}
+	if !set {
+		return ErrStateNotFound
+	}
+	return nil
+}
+
+//DeleteField removes the named field of the hash associated with the session token.
+func (rhs *RedisHashStore) DeleteField(token Token, name string) error {
+	conn := rhs.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("HDEL", rhs.getRedisKey(token), name); err != nil {
+		return fmt.Errorf("error executing HDEL: %v", err)
+	}
+	return nil
+}
+
+//encodeField gob-encodes a field value as an interface value,
+//so that it can be decoded without knowing its type
+func encodeField(value interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(&value); err != nil {
+		return nil, fmt.Errorf("error encoding field: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+//decodeField decodes a field value encoded by encodeField
+func decodeField(buf []byte) (interface{}, error) {
+	var value interface{}
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&value); err != nil {
+		return nil, fmt.Errorf("error decoding field: %v", err)
+	}
+	return value, nil
+}
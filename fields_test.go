@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestRedisHashStoreIntegration(t *testing.T) {
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if len(redisAddr) == 0 {
+		t.Skip("set REDIS_ADDR to run redis hash store integration test")
+	}
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store := NewRedisHashStore(NewRedisPool(redisAddr, time.Minute*10), time.Hour)
+
+	if err := store.SetField(token, "count", 1); err != ErrStateNotFound {
+		t.Errorf("incorrect error setting field before saving: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Save(token, Values{"name": "tester"}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.SetField(token, "count", 1); err != nil {
+		t.Errorf("unexpected error setting field: %v", err)
+	}
+	var count int
+	if err := store.GetField(token, "count", &count); err != nil || count != 1 {
+		t.Errorf("incorrect field: expected 1, <nil> but got %d, %v", count, err)
+	}
+	if err := store.DeleteField(token, "name"); err != nil {
+		t.Errorf("unexpected error deleting field: %v", err)
+	}
+	values := Values{}
+	if err := store.Get(token, &values); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+	if len(values) != 1 || values.GetInt("count") != 1 {
+		t.Errorf("incorrect values: %v", values)
+	}
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+}
+
+func TestRedisHashStoreSave(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisHashStore(getMockPool(conn), time.Hour)
+	key := store.getRedisKey(token)
+
+	conn.Command("MULTI").Expect("OK")
+	conn.Command("DEL", key).Expect("QUEUED")
+	conn.Command("HSET", key, redisHashMarker, "", "count", redigomock.NewAnyData()).Expect("QUEUED")
+	conn.Command("EXPIRE", key, time.Hour.Seconds()).Expect("QUEUED")
+	conn.Command("EXEC").Expect([]interface{}{})
+	if err := store.Save(token, Values{"count": 1}); err != nil {
+		t.Errorf("unexpected error saving state: %v", err)
+	}
+	if err := store.Save(token, "not values"); err == nil {
+		t.Error("did not receive expected error when saving unsupported state")
+	}
+	conn.Command("EXEC").ExpectError(fmt.Errorf("test error"))
+	if err := store.Save(token, &Values{}); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestRedisHashStoreGet(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	count, err := encodeField(2)
+	if err != nil {
+		t.Fatalf("unexpected error encoding field: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisHashStore(getMockPool(conn), time.Hour)
+	key := store.getRedisKey(token)
+
+	conn.Command("HGETALL", key).Expect([]interface{}{[]byte(redisHashMarker), []byte(""), []byte("count"), count})
+	conn.Command("EXPIRE", key, time.Hour.Seconds()).Expect(int64(1))
+	values := Values{}
+	if err := store.Get(token, &values); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if len(values) != 1 || values.GetInt("count") != 2 {
+		t.Errorf("incorrect values: %v", values)
+	}
+	var state string
+	if err := store.Get(token, &state); err == nil {
+		t.Error("did not receive expected error when getting unsupported state")
+	}
+
+	conn.Command("HGETALL", key).Expect([]interface{}{})
+	if err := store.Get(token, &values); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
+
+func TestRedisHashStoreFields(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	count, err := encodeField(3)
+	if err != nil {
+		t.Fatalf("unexpected error encoding field: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisHashStore(getMockPool(conn), time.Hour)
+	key := store.getRedisKey(token)
+
+	conn.Command("HGET", key, "count").Expect(count)
+	var i int
+	if err := store.GetField(token, "count", &i); err != nil || i != 3 {
+		t.Errorf("incorrect field: expected 3, <nil> but got %d, %v", i, err)
+	}
+	var s string
+	if err := store.GetField(token, "count", &s); err == nil {
+		t.Error("did not receive expected error when getting field into incorrect type")
+	}
+	conn.Command("HGET", key, "missing").Expect(nil)
+	if err := store.GetField(token, "missing", &i); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+
+	conn.Script([]byte(setFieldScriptSrc), 1, key, "count", redigomock.NewAnyData(), time.Hour.Seconds()).Expect(int64(1))
+	if err := store.SetField(token, "count", 3); err != nil {
+		t.Errorf("unexpected error setting field: %v", err)
+	}
+	conn.Script([]byte(setFieldScriptSrc), 1, key, "count", redigomock.NewAnyData(), time.Hour.Seconds()).Expect(int64(0))
+	if err := store.SetField(token, "count", 3); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+
+	conn.Command("HDEL", key, "count").Expect(int64(1))
+	if err := store.DeleteField(token, "count"); err != nil {
+		t.Errorf("unexpected error deleting field: %v", err)
+	}
+	conn.Command("HDEL", key, "count").ExpectError(fmt.Errorf("test error"))
+	if err := store.DeleteField(token, "count"); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
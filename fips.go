@@ -0,0 +1,50 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+)
+
+//MinFIPSKeyLength is the minimum signing key length in bytes allowed in
+//FIPS mode, which requires HMAC keys of at least 112 bits
+const MinFIPSKeyLength = 14
+
+//ErrNotFIPSApproved is returned when an option that uses
+//non-FIPS-approved primitives is requested in FIPS mode
+var ErrNotFIPSApproved = errors.New("not allowed in FIPS mode")
+
+//fipsMode is whether FIPS mode is enabled. It's a variable
+//so that automated tests can enable it.
+var fipsMode = fipsBuild
+
+//FIPSMode reports whether the package was built in FIPS mode, using the
+//fips build tag (go build -tags fips). In FIPS mode, the package uses only
+//FIPS-approved primitives, which are HMAC-SHA-256, HMAC-SHA-512 and AES-GCM from the
+//standard library (or BoringCrypto, when built with GOEXPERIMENT=boringcrypto),
+//and rejects options that would use anything else. Signing keys shorter
+//than MinFIPSKeyLength are also rejected: token functions return errors,
+//and NewManager and NewStatelessManager panic, so that a non-compliant
+//configuration is caught when the process starts.
+func FIPSMode() bool {
+	return fipsMode
+}
+
+//checkFIPSKey returns an error if FIPS mode is enabled
+//and the signing key is too short
+func checkFIPSKey(signingKey []byte) error {
+	if fipsMode && len(signingKey) < MinFIPSKeyLength {
+		return fmt.Errorf("signing key must be at least %d bytes in FIPS mode", MinFIPSKeyLength)
+	}
+	return nil
+}
+
+//mustCheck panics if any of the keys in the ring are invalid, including
+//when FIPS mode is enabled and they are too short, or use an algorithm
+//that isn't FIPS-approved
+func (kr keyRing) mustCheck() {
+	for _, key := range kr {
+		if err := key.check(); err != nil {
+			panic(err)
+		}
+	}
+}
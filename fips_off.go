@@ -0,0 +1,7 @@
+//go:build !fips
+// +build !fips
+
+package sessions
+
+//fipsBuild is whether the package was built with the fips build tag
+const fipsBuild = false
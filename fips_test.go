@@ -0,0 +1,52 @@
+package sessions
+
+import (
+	"testing"
+)
+
+func TestFIPSMode(t *testing.T) {
+	defer func(enabled bool) { fipsMode = enabled }(fipsMode)
+	fipsMode = true
+	if !FIPSMode() {
+		t.Error("FIPS mode not reported")
+	}
+
+	shortKey := []byte("short key")
+	if _, err := NewToken(shortKey); err == nil {
+		t.Error("did not receive expected error generating token with short key")
+	}
+	if _, err := NewStatelessToken(shortKey, "test state"); err == nil {
+		t.Error("did not receive expected error generating stateless token with short key")
+	}
+	tk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if _, err := VerifyToken(tk.String(), shortKey); err == nil {
+		t.Error("did not receive expected error verifying token with short key")
+	}
+
+	cases := []struct {
+		name        string
+		keys        []string
+		expectPanic bool
+	}{
+		{"compliant keys", []string{string(testSigningKey)}, false},
+		{"short key", []string{string(testSigningKey), string(shortKey)}, true},
+	}
+	for _, c := range cases {
+		for _, construct := range []func(){
+			func() { NewManager(DefaultIDLength, c.keys, newMockStore(false)) },
+			func() { NewStatelessManager(c.keys) },
+		} {
+			panicked := func() (panicked bool) {
+				defer func() { panicked = recover() != nil }()
+				construct()
+				return false
+			}()
+			if panicked != c.expectPanic {
+				t.Errorf("case %s: incorrect panic result: expected %t but got %t", c.name, c.expectPanic, panicked)
+			}
+		}
+	}
+}
@@ -0,0 +1,377 @@
+/*Package httpstore provides a remote session store that uses a simple
+HTTP/JSON API, for environments where gRPC isn't available but a central
+session service is required. Handler serves the API using any
+sessions.Store, and Client is a sessions.Store that uses the API.
+
+On the session service:
+
+	store := sessions.NewRedisStore(sessions.NewRedisPool(redisAddr, time.Minute), time.Hour)
+	http.ListenAndServeTLS(addr, certFile, keyFile, httpstore.Handler(store, apiKey))
+
+In each service:
+
+	mgr := sessions.NewManager(sessions.DefaultIDLength, signingKeys,
+		httpstore.NewClient("https://sessions.internal", apiKey))
+
+Requests are authenticated with a shared API key, sent as a bearer token
+in the Authorization header, so always serve the API over HTTPS. The API
+supports these requests:
+
+	GET    /sessions/{sessionID}         responds with {"state": "<base64 state>"}
+	PUT    /sessions/{sessionID}         saves the state in the {"state": ...} request body
+	DELETE /sessions/{sessionID}         deletes the state
+	POST   /sessions/{sessionID}/touch   resets the state's expiry time
+
+GET and touch requests for sessions with no state respond with 404 Not Found.
+GET responses include an ETag header, and GET requests with a matching
+If-None-Match header respond with 304 Not Modified and no body, so that
+the Client can reuse its cached copy of large session states.
+Clients encode session state before sending it, so the service stores it as
+opaque bytes and never needs the clients' session state types.
+*/
+package httpstore
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/davestearns/sessions"
+)
+
+//sessionsPath is the path prefix for session resources
+const sessionsPath = "/sessions/"
+
+//authScheme is the Authorization header scheme for the API key
+const authScheme = "Bearer "
+
+//DefaultCacheSize is the default number of session states a Client caches
+const DefaultCacheSize = 1024
+
+//stateBody is the JSON request and response body
+type stateBody struct {
+	State []byte `json:"state"`
+}
+
+//handler is the http.Handler for the API
+type handler struct {
+	store  sessions.Store
+	apiKey string
+}
+
+//Handler returns an http.Handler that serves the API using store,
+//accepting only requests that include apiKey
+func Handler(store sessions.Store, apiKey string) http.Handler {
+	return &handler{store: store, apiKey: apiKey}
+}
+
+//ServeHTTP authenticates the request and routes it to the appropriate method
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), authScheme)
+	if len(h.apiKey) == 0 || subtle.ConstantTimeCompare([]byte(key), []byte(h.apiKey)) != 1 {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+	//use the escaped path, as session IDs might contain slashes
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, sessionsPath) {
+		http.NotFound(w, r)
+		return
+	}
+	segments := strings.Split(path[len(sessionsPath):], "/")
+	sessionID, err := url.PathUnescape(segments[0])
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+	token := sessions.IDToken(sessionID)
+	switch {
+	case len(segments) == 1 && len(segments[0]) > 0:
+		switch r.Method {
+		case http.MethodGet:
+			h.get(w, r, token)
+		case http.MethodPut:
+			h.save(w, r, token)
+		case http.MethodDelete:
+			h.respond(w, h.store.Delete(token))
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(segments) == 2 && segments[1] == "touch":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.respond(w, h.touch(token))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//get responds with the session state
+func (h *handler) get(w http.ResponseWriter, r *http.Request, token sessions.Token) {
+	body := &stateBody{}
+	if err := h.store.Get(token, &body.State); err != nil {
+		h.respond(w, err)
+		return
+	}
+	tag := etag(body.State)
+	w.Header().Set("ETag", tag)
+	if r.Header.Get("If-None-Match") == tag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+//save saves the session state in the request body
+func (h *handler) save(w http.ResponseWriter, r *http.Request, token sessions.Token) {
+	body := &stateBody{}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+	h.respond(w, h.store.Save(token, body.State))
+}
+
+//touch resets the expiry time of the session state, using the store's
+//Touch method if it implements sessions.Toucher, or by getting the
+//state and discarding it otherwise
+func (h *handler) touch(token sessions.Token) error {
+	if t, ok := h.store.(sessions.Toucher); ok {
+		return t.Touch(token)
+	}
+	var state []byte
+	return h.store.Get(token, &state)
+}
+
+//etag returns the entity tag for the session state
+func etag(state []byte) string {
+	sum := sha256.Sum256(state)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+//respond writes a response with no body for the result of a store operation
+func (h *handler) respond(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case sessions.ErrStateNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, "error accessing session store", http.StatusInternalServerError)
+	}
+}
+
+//Client is a sessions.Store that saves session state using the API
+type Client struct {
+	//HTTPClient is the client used to make requests. Defaults to
+	//http.DefaultClient, but callers may adjust this after construction,
+	//for example to set a timeout.
+	HTTPClient *http.Client
+	//CacheSize is the maximum number of session states to cache
+	//locally, so that unchanged states needn't be downloaded again.
+	//Defaults to DefaultCacheSize, but callers may adjust this after
+	//construction. Set to 0 to disable the cache.
+	CacheSize int
+	baseURL   string
+	apiKey    string
+	mx        sync.Mutex
+	cache     map[string]*list.Element
+	entries   *list.List
+}
+
+//cacheEntry is an entry in the Client's local cache
+type cacheEntry struct {
+	sessionID string
+	etag      string
+	state     []byte
+}
+
+//NewClient constructs a new Client that calls the API at baseURL,
+//authenticating with apiKey
+func NewClient(baseURL string, apiKey string) *Client {
+	return &Client{
+		HTTPClient: http.DefaultClient,
+		CacheSize:  DefaultCacheSize,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		cache:      make(map[string]*list.Element),
+		entries:    list.New(),
+	}
+}
+
+//Save encodes the session state using sessions.DefaultCodec,
+//and saves it using the API
+func (c *Client) Save(token sessions.Token, sessionState interface{}) error {
+	return c.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the session state using the API, and decodes it into
+//sessionState. If there is no state associated with the token,
+//sessions.ErrStateNotFound is returned.
+func (c *Client) Get(token sessions.Token, sessionState interface{}) error {
+	return c.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the session state using the API
+func (c *Client) Delete(token sessions.Token) error {
+	return c.DeleteContext(context.Background(), token)
+}
+
+//Touch resets the expiry time of the session state using the API
+func (c *Client) Touch(token sessions.Token) error {
+	resp, err := c.do(context.Background(), http.MethodPost, token, "/touch", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+//SaveContext is like Save, but respects the context
+func (c *Client) SaveContext(ctx context.Context, token sessions.Token, sessionState interface{}) error {
+	state, err := sessions.DefaultCodec.Encode(sessionState)
+	if err != nil {
+		return fmt.Errorf("error encoding session state: %v", err)
+	}
+	body, err := json.Marshal(&stateBody{State: state})
+	if err != nil {
+		return fmt.Errorf("error encoding request body: %v", err)
+	}
+	resp, err := c.do(ctx, http.MethodPut, token, "", nil, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.cacheState(token.ID().String(), etag(state), state)
+	return nil
+}
+
+//GetContext is like Get, but respects the context
+func (c *Client) GetContext(ctx context.Context, token sessions.Token, sessionState interface{}) error {
+	sessionID := token.ID().String()
+	tag, state := c.cached(sessionID)
+	header := http.Header{}
+	if len(tag) > 0 {
+		header.Set("If-None-Match", tag)
+	}
+	resp, err := c.do(ctx, http.MethodGet, token, "", header, nil)
+	if err != nil {
+		c.uncache(sessionID)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		body := &stateBody{}
+		if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+			return fmt.Errorf("error decoding response body: %v", err)
+		}
+		state = body.State
+		c.cacheState(sessionID, resp.Header.Get("ETag"), state)
+	}
+	if err := sessions.DefaultCodec.Decode(state, sessionState); err != nil {
+		return fmt.Errorf("error decoding session state: %v", err)
+	}
+	return nil
+}
+
+//DeleteContext is like Delete, but respects the context
+func (c *Client) DeleteContext(ctx context.Context, token sessions.Token) error {
+	c.uncache(token.ID().String())
+	resp, err := c.do(ctx, http.MethodDelete, token, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+//cached returns the cached entity tag and state for the session, if any
+func (c *Client) cached(sessionID string) (string, []byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	elem, found := c.cache[sessionID]
+	if !found {
+		return "", nil
+	}
+	c.entries.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	return entry.etag, entry.state
+}
+
+//cacheState caches the state for the session, evicting the
+//least-recently used state if the cache is full
+func (c *Client) cacheState(sessionID string, etag string, state []byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.CacheSize <= 0 || len(etag) == 0 {
+		return
+	}
+	if elem, found := c.cache[sessionID]; found {
+		entry := elem.Value.(*cacheEntry)
+		entry.etag, entry.state = etag, state
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.cache[sessionID] = c.entries.PushFront(&cacheEntry{sessionID, etag, state})
+	for c.entries.Len() > c.CacheSize {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.cache, oldest.Value.(*cacheEntry).sessionID)
+	}
+}
+
+//uncache removes the session's state from the cache
+func (c *Client) uncache(sessionID string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if elem, found := c.cache[sessionID]; found {
+		c.entries.Remove(elem)
+		delete(c.cache, sessionID)
+	}
+}
+
+//do makes an authenticated request for the session resource, returning
+//sessions.ErrStateNotFound for 404 responses, and an error for any other
+//unsuccessful response other than 304 Not Modified
+func (c *Client) do(ctx context.Context, method string, token sessions.Token, suffix string, header http.Header, body []byte) (*http.Response, error) {
+	rawurl := c.baseURL + sessionsPath + url.PathEscape(token.ID().String()) + suffix
+	req, err := http.NewRequest(method, rawurl, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", authScheme+c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, sessions.ErrStateNotFound
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error response from session service: %s", resp.Status)
+	}
+	return resp, nil
+}
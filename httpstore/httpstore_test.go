@@ -0,0 +1,208 @@
+package httpstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/davestearns/sessions"
+)
+
+type mapStore struct {
+	mx           sync.Mutex
+	entries      map[string][]byte
+	triggerError bool
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{entries: make(map[string][]byte)}
+}
+
+func (ms *mapStore) Save(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.triggerError {
+		return fmt.Errorf("test error")
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return err
+	}
+	ms.entries[token.ID().String()] = buf.Bytes()
+	return nil
+}
+
+func (ms *mapStore) Get(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.triggerError {
+		return fmt.Errorf("test error")
+	}
+	val, found := ms.entries[token.ID().String()]
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState)
+}
+
+func (ms *mapStore) Delete(token sessions.Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.entries, token.ID().String())
+	return nil
+}
+
+const testAPIKey = "test api key"
+
+func TestClient(t *testing.T) {
+	type state struct {
+		Name  string
+		Count int
+	}
+	backing := newMapStore()
+	server := httptest.NewServer(Handler(backing, testAPIKey))
+	defer server.Close()
+	client := NewClient(server.URL+"/", testAPIKey)
+	token, err := sessions.NewToken([]byte("test key"), sessions.WithEncoding(base64.StdEncoding))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	if err := client.Get(token, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error getting missing state: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := client.Touch(token); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error touching missing state: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := client.Save(token, &state{"tester", 1}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	got := &state{}
+	if err := client.Get(token, got); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if got.Name != "tester" || got.Count != 1 {
+		t.Errorf("incorrect state: %+v", got)
+	}
+	if err := client.Touch(token); err != nil {
+		t.Errorf("unexpected error touching state: %v", err)
+	}
+	if err := client.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if len(backing.entries) != 0 {
+		t.Error("state was not deleted from backing store")
+	}
+
+	backing.triggerError = true
+	if err := client.Save(token, &state{}); err == nil {
+		t.Error("did not receive expected error from failing store")
+	}
+	if err := NewClient(server.URL, "wrong key").Delete(token); err == nil {
+		t.Error("did not receive expected error with wrong API key")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(newMapStore(), testAPIKey)
+	cases := []struct {
+		name           string
+		method         string
+		path           string
+		apiKey         string
+		expectedStatus int
+	}{
+		{"missing key", "GET", "/sessions/abc", "", http.StatusUnauthorized},
+		{"wrong key", "GET", "/sessions/abc", "wrong", http.StatusUnauthorized},
+		{"not found", "GET", "/sessions/abc", testAPIKey, http.StatusNotFound},
+		{"delete", "DELETE", "/sessions/abc", testAPIKey, http.StatusNoContent},
+		{"invalid body", "PUT", "/sessions/abc", testAPIKey, http.StatusBadRequest},
+		{"wrong method", "PATCH", "/sessions/abc", testAPIKey, http.StatusMethodNotAllowed},
+		{"wrong touch method", "GET", "/sessions/abc/touch", testAPIKey, http.StatusMethodNotAllowed},
+		{"unknown path", "GET", "/other", testAPIKey, http.StatusNotFound},
+		{"empty ID", "GET", "/sessions/", testAPIKey, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com"+c.path, bytes.NewReader([]byte("not json")))
+		if len(c.apiKey) > 0 {
+			req.Header.Set("Authorization", authScheme+c.apiKey)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	backing := newMapStore()
+	var notModified int
+	handler := Handler(backing, testAPIKey)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, r)
+		if respRec.Code == http.StatusNotModified {
+			notModified++
+		}
+		for name, values := range respRec.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(respRec.Code)
+		w.Write(respRec.Body.Bytes())
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, testAPIKey)
+	token, err := sessions.NewToken([]byte("test key"))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	if err := client.Save(token, "large state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		var state string
+		if err := client.Get(token, &state); err != nil || state != "large state" {
+			t.Errorf("incorrect state: expected large state, <nil> but got %s, %v", state, err)
+		}
+	}
+	if notModified != 2 {
+		t.Errorf("incorrect number of 304 responses: expected 2 but got %d", notModified)
+	}
+
+	//changes made by other clients should be downloaded
+	if err := NewClient(server.URL, testAPIKey).Save(token, "changed state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	if err := client.Get(token, &state); err != nil || state != "changed state" {
+		t.Errorf("incorrect state: expected changed state, <nil> but got %s, %v", state, err)
+	}
+	if notModified != 2 {
+		t.Errorf("incorrect number of 304 responses: expected 2 but got %d", notModified)
+	}
+
+	//the cache should be limited to CacheSize states
+	client.CacheSize = 1
+	other, _ := sessions.NewToken([]byte("test key"))
+	if err := client.Save(other, "other state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if len(client.cache) != 1 || client.entries.Len() != 1 {
+		t.Errorf("incorrect cache size: %d", len(client.cache))
+	}
+
+	//deleted states should be removed from the cache
+	if err := client.Delete(other); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if len(client.cache) != 0 {
+		t.Error("deleted state was not removed from the cache")
+	}
+}
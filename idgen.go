@@ -0,0 +1,167 @@
+package sessions
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+//IDGenerator generates the ID portion of new tokens.
+//Use WithIDGenerator to select one.
+type IDGenerator interface {
+	//GenerateID fills id with a new session ID, reading any random
+	//bytes it needs from rand, which is crypto/rand.Reader unless
+	//another reader was selected using WithRand
+	GenerateID(id []byte, rand io.Reader) error
+}
+
+//IDGeneratorFunc adapts an ordinary function to an IDGenerator
+type IDGeneratorFunc func(id []byte, rand io.Reader) error
+
+//GenerateID calls f(id, rand)
+func (f IDGeneratorFunc) GenerateID(id []byte, rand io.Reader) error {
+	return f(id, rand)
+}
+
+//RandomIDs is the default IDGenerator, which fills
+//the entire ID with crypto-random bytes
+var RandomIDs IDGenerator = IDGeneratorFunc(func(id []byte, rand io.Reader) error {
+	if _, err := io.ReadFull(rand, id); err != nil {
+		return fmt.Errorf("error reading random bytes: %v", err)
+	}
+	return nil
+})
+
+//ULIDs is an IDGenerator that generates time-ordered IDs, which start
+//with the current time as a 48-bit count of milliseconds since the Unix
+//epoch, followed by crypto-random bytes. When the ID length is 16 bytes
+//(MinIDLength), the IDs are binary ULIDs (https://github.com/ulid/spec),
+//with an unpredictable 80-bit random portion. Longer IDs have
+//correspondingly more random bits.
+var ULIDs IDGenerator = IDGeneratorFunc(func(id []byte, rand io.Reader) error {
+	if err := RandomIDs.GenerateID(id[timestampLength:], rand); err != nil {
+		return err
+	}
+	putTimestamp(id, time.Now())
+	return nil
+})
+
+//UUIDv7s is an IDGenerator that generates time-ordered IDs laid out like
+//version 7 UUIDs (RFC 9562): the current time as a 48-bit count of
+//milliseconds since the Unix epoch, followed by crypto-random bytes,
+//with the version and variant bits set. When the ID length is 16 bytes
+//(MinIDLength), the IDs are binary UUIDv7s, with an unpredictable 74-bit
+//random portion. Longer IDs have correspondingly more random bits.
+var UUIDv7s IDGenerator = IDGeneratorFunc(func(id []byte, rand io.Reader) error {
+	if err := ULIDs.GenerateID(id, rand); err != nil {
+		return err
+	}
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	return nil
+})
+
+//timestampLength is the length in bytes of the
+//millisecond timestamp at the start of time-ordered IDs
+const timestampLength = 6
+
+//putTimestamp writes t as a 48-bit big-endian count of milliseconds
+//since the Unix epoch to the first timestampLength bytes of id
+func putTimestamp(id []byte, t time.Time) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+	copy(id[:timestampLength], ms[8-timestampLength:])
+}
+
+//WithIDGenerator sets the IDGenerator used to generate the IDs of new
+//tokens. The default is RandomIDs. Time-ordered IDs, such as ULIDs and
+//UUIDv7s, give stores better index locality, but reveal when each session
+//began, and have fewer random bits than crypto-random IDs of the same
+//length. This has no effect when verifying tokens. To use this with a
+//Manager, pass it to WithTokenOptions.
+func WithIDGenerator(gen IDGenerator) TokenOption {
+	return func(to *tokenOptions) {
+		to.idGen = gen
+	}
+}
+
+//DefaultIDTimeGranularity is the granularity of the timestamp
+//prefix used by TimePrefixedIDs if Granularity is zero
+const DefaultIDTimeGranularity = time.Hour
+
+//TimePrefixedIDs is an IDGenerator that starts each ID with a coarse
+//timestamp, so that IDs generated within the same period of Granularity
+//share a common prefix. This gives SQL and wide-column stores better index
+//locality, as new sessions are inserted near each other, and allows expired
+//sessions to be purged by range or prefix rather than by scanning every row.
+//
+//The prefix is a 48-bit big-endian count of periods since the Unix epoch,
+//which is exactly 8 characters when base64-encoded, and 12 when hex-encoded,
+//so it never shares a character with the random portion. The rest of the ID
+//is crypto-random. With the minimum ID length of 16 bytes, that leaves 80
+//random bits, and with DefaultIDLength, 208; well above the 64 bits OWASP
+//recommends. The prefix gives an attacker no help guessing IDs, since it
+//only narrows the search to the sessions begun in one period: with a million
+//sessions per period, each guess of a 16-byte ID still has a chance of
+//about 1 in 2^60 of matching one. It does reveal when each session began,
+//to the nearest period, to anyone who can see the token.
+type TimePrefixedIDs struct {
+	//Granularity is the length of the periods counted by the prefix.
+	//If zero, DefaultIDTimeGranularity is used.
+	Granularity time.Duration
+}
+
+//GenerateID fills id with the current period's prefix followed by random bytes
+func (g TimePrefixedIDs) GenerateID(id []byte, rand io.Reader) error {
+	if err := RandomIDs.GenerateID(id[timestampLength:], rand); err != nil {
+		return err
+	}
+	g.putPrefix(id, time.Now())
+	return nil
+}
+
+//Prefix returns the prefix shared by the IDs of sessions begun during
+//the same period as t, encoded using enc, which must be the Encoding used
+//for the IDs. Stores can delete the sessions begun during a period by
+//matching this prefix. If enc preserves the order of the bytes, such as
+//HexEncoding, or the store keeps IDs as bytes, the IDs of sessions begun
+//before the period sort before the prefix, so they can be deleted by range.
+//Base62Encoding encodes the whole ID as one number, so its IDs don't
+//share a prefix.
+func (g TimePrefixedIDs) Prefix(t time.Time, enc Encoding) string {
+	prefix := make([]byte, timestampLength)
+	g.putPrefix(prefix, t)
+	return enc.EncodeToString(prefix)
+}
+
+//Time returns the start of the period during which the session with the ID
+//began, where sid is the String of the ID, which was encoded using enc
+func (g TimePrefixedIDs) Time(sid string, enc Encoding) (time.Time, error) {
+	buf, err := enc.DecodeString(sid)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error decoding session ID: %v", err)
+	}
+	if len(buf) < MinIDLength {
+		return time.Time{}, fmt.Errorf("session ID not long enough")
+	}
+	var periods [8]byte
+	copy(periods[8-timestampLength:], buf[:timestampLength])
+	return time.Unix(0, int64(binary.BigEndian.Uint64(periods[:]))*int64(g.granularity())), nil
+}
+
+//granularity returns the Granularity, or the default if it's zero
+func (g TimePrefixedIDs) granularity() time.Duration {
+	if g.Granularity <= 0 {
+		return DefaultIDTimeGranularity
+	}
+	return g.Granularity
+}
+
+//putPrefix writes the count of periods from the Unix epoch
+//to t to the first timestampLength bytes of id
+func (g TimePrefixedIDs) putPrefix(id []byte, t time.Time) {
+	var periods [8]byte
+	binary.BigEndian.PutUint64(periods[:], uint64(t.UnixNano()/int64(g.granularity())))
+	copy(id[:timestampLength], periods[8-timestampLength:])
+}
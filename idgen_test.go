@@ -0,0 +1,133 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIDGenerators(t *testing.T) {
+	cases := []struct {
+		name        string
+		gen         IDGenerator
+		timeOrdered bool
+		uuidv7      bool
+	}{
+		{"random", RandomIDs, false, false},
+		{"ULID", ULIDs, true, false},
+		{"UUIDv7", UUIDv7s, true, true},
+	}
+
+	for _, c := range cases {
+		for _, idLength := range []int{MinIDLength, DefaultIDLength} {
+			before := time.Now().UnixNano() / int64(time.Millisecond)
+			tk, err := NewTokenOfLength(testSigningKey, idLength, WithIDGenerator(c.gen))
+			if err != nil {
+				t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+			}
+			after := time.Now().UnixNano() / int64(time.Millisecond)
+			if tk.ID().Len() != idLength {
+				t.Errorf("case %s: incorrect ID length: expected %d but got %d", c.name, idLength, tk.ID().Len())
+			}
+			if _, err := VerifyToken(tk.String(), testSigningKey); err != nil {
+				t.Errorf("case %s: unexpected error verifying token: %v", c.name, err)
+			}
+
+			buf := tk.(*token).buf
+			if c.timeOrdered {
+				var ms [8]byte
+				copy(ms[2:], buf[:timestampLength])
+				if ts := int64(binary.BigEndian.Uint64(ms[:])); ts < before || ts > after {
+					t.Errorf("case %s: incorrect timestamp: expected between %d and %d but got %d", c.name, before, after, ts)
+				}
+			}
+			if c.uuidv7 && (buf[6]>>4 != 7 || buf[8]>>6 != 2) {
+				t.Errorf("case %s: incorrect version or variant bits: %x", c.name, buf[:16])
+			}
+		}
+	}
+
+	//IDs generated in different milliseconds should sort by time
+	first, _ := NewTokenOfLength(testSigningKey, MinIDLength, WithIDGenerator(ULIDs))
+	time.Sleep(2 * time.Millisecond)
+	second, _ := NewTokenOfLength(testSigningKey, MinIDLength, WithIDGenerator(ULIDs))
+	if bytes.Compare(first.(*token).buf[:MinIDLength], second.(*token).buf[:MinIDLength]) >= 0 {
+		t.Error("ULIDs were not ordered by time")
+	}
+}
+
+func TestCustomIDGenerator(t *testing.T) {
+	gen := IDGeneratorFunc(func(id []byte, rand io.Reader) error {
+		for i := range id {
+			id[i] = byte(i)
+		}
+		return nil
+	})
+	tk, err := NewToken(testSigningKey, WithIDGenerator(gen))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if buf := tk.(*token).buf; buf[0] != 0 || buf[DefaultIDLength-1] != DefaultIDLength-1 {
+		t.Errorf("custom generator was not used: %x", buf[:DefaultIDLength])
+	}
+
+	errGen := errors.New("generator failed")
+	failing := IDGeneratorFunc(func(id []byte, rand io.Reader) error {
+		return errGen
+	})
+	if _, err := NewToken(testSigningKey, WithIDGenerator(failing)); err != errGen {
+		t.Errorf("incorrect error: expected %v but got %v", errGen, err)
+	}
+
+	//the generators should read from the reader selected using WithRand
+	if _, err := NewToken(testSigningKey, WithIDGenerator(ULIDs), WithRand(bytes.NewReader(nil))); err == nil {
+		t.Error("did not receive expected error when the reader is empty")
+	}
+}
+
+func TestTimePrefixedIDs(t *testing.T) {
+	gen := TimePrefixedIDs{Granularity: time.Minute}
+	tk, err := NewTokenOfLength(testSigningKey, MinIDLength, WithIDGenerator(gen))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	now := time.Now()
+	sid := tk.ID().String()
+	prefix := gen.Prefix(now, defaultEncoding)
+	if len(prefix) != 8 || (sid[:8] != prefix && sid[:8] != gen.Prefix(now.Add(-time.Minute), defaultEncoding)) {
+		t.Errorf("incorrect prefix: expected %s but got %s", prefix, sid[:8])
+	}
+	began, err := gen.Time(sid, defaultEncoding)
+	if err != nil {
+		t.Fatalf("unexpected error getting ID time: %v", err)
+	}
+	//allow for the period changing since the token was generated
+	if expected := now.Truncate(time.Minute); !began.Equal(expected) && !began.Equal(expected.Add(-time.Minute)) {
+		t.Errorf("incorrect time: expected %v but got %v", expected, began)
+	}
+
+	//the random portion should differ between IDs in the same period
+	tk2, err := NewTokenOfLength(testSigningKey, MinIDLength, WithIDGenerator(gen))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if tk2.ID().String() == sid {
+		t.Error("IDs in the same period were identical")
+	}
+
+	//hex-encoded prefixes should sort in time order
+	enc := HexEncoding
+	if earlier := gen.Prefix(now.Add(-time.Hour), enc); earlier >= gen.Prefix(now, enc) {
+		t.Errorf("hex prefixes were not ordered by time: %s >= %s", earlier, gen.Prefix(now, enc))
+	}
+
+	if (TimePrefixedIDs{}).granularity() != DefaultIDTimeGranularity {
+		t.Error("zero granularity did not default to DefaultIDTimeGranularity")
+	}
+	if _, err := gen.Time("short", defaultEncoding); err == nil {
+		t.Error("did not receive expected error for invalid ID")
+	}
+}
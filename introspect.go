@@ -0,0 +1,143 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//introspectionParam is the form parameter containing
+//the token in introspection requests
+const introspectionParam = "token"
+
+//SessionInfo describes a session token, as reported by Introspect
+type SessionInfo struct {
+	//Active is whether the token is valid and its session
+	//is still active. If false, the other fields are empty.
+	Active bool `json:"active"`
+	//SessionID is the session's ID
+	SessionID string `json:"session_id,omitempty"`
+	//IssuedAt is when the session was begun, in seconds since the epoch.
+	//This is known only if the manager records session metadata, for
+	//example because it was constructed WithMaxLifetime.
+	IssuedAt int64 `json:"issued_at,omitempty"`
+	//ExpiresAt is when the session will expire regardless of activity,
+	//in seconds since the epoch, or zero if it expires only due to
+	//inactivity. This is the earliest of the session's own expiry time,
+	//its maximum lifetime, and any expiry caveat on the token.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	//Metadata holds the session's user and device IDs, if known,
+	//as "user_id" and "device_id", along with any client information
+	//gathered by the manager's enrichers
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+//Introspect reports whether token, a string version of a session token,
+//is valid and its session is active, along with what the manager knows
+//about the session. Caveats on attenuated tokens are verified, but only
+//expiry caveats are enforced, as the other caveats depend on the request
+//that will use the token. Pre-sessions begun by BeginPreSession are
+//reported as inactive. An error is returned only if the token's
+//session can't be checked, for example because the store is unavailable.
+func (m *manager) Introspect(token string) (*SessionInfo, error) {
+	inactive := &SessionInfo{}
+	if len(token) > m.maxTokenLength {
+		return inactive, nil
+	}
+	tk, _, caveats, err := m.keys.verifyCaveats(token, m.tokenOpts)
+	if err != nil || m.checkTokenAge(tk) != nil {
+		return inactive, nil
+	}
+	info := &SessionInfo{Active: true, SessionID: tk.ID().String()}
+	for _, c := range caveats {
+		if expires, ok := c.expires(); ok {
+			if !time.Now().Before(expires) {
+				return inactive, nil
+			}
+			info.setExpiresAt(expires)
+		}
+	}
+	if issued, ok := IssuedAt(tk); ok && m.maxTokenAge > 0 {
+		info.setExpiresAt(issued.Add(m.maxTokenAge))
+	}
+
+	if err := m.checkRevoked(tk); err != nil {
+		if err == ErrSessionRevoked {
+			return inactive, nil
+		}
+		return nil, err
+	}
+	if !m.usesEnvelope() {
+		active, err := exists(m.store, tk)
+		if err != nil || !active {
+			return inactive, err
+		}
+		return info, nil
+	}
+	env, err := m.getEnvelope(tk)
+	switch err {
+	case nil:
+	case ErrStateNotFound, ErrSessionTooOld, ErrSessionExpired, ErrSessionRevoked:
+		return inactive, nil
+	default:
+		return nil, err
+	}
+	if env.Pending {
+		//pre-sessions haven't completed authentication
+		return inactive, nil
+	}
+	info.IssuedAt = env.Created.Unix()
+	if !env.Expires.IsZero() {
+		info.setExpiresAt(env.Expires)
+	}
+	if m.maxLifetime > 0 {
+		info.setExpiresAt(env.Created.Add(m.maxLifetime))
+	}
+	info.Metadata = make(map[string]string, len(env.ClientInfo)+2)
+	for k, v := range env.ClientInfo {
+		info.Metadata[k] = v
+	}
+	if len(env.UserID) > 0 {
+		info.Metadata["user_id"] = env.UserID
+	}
+	if len(env.DeviceID) > 0 {
+		info.Metadata["device_id"] = env.DeviceID
+	}
+	return info, nil
+}
+
+//setExpiresAt sets ExpiresAt to expires, if that's earlier
+func (si *SessionInfo) setExpiresAt(expires time.Time) {
+	if si.ExpiresAt == 0 || expires.Unix() < si.ExpiresAt {
+		si.ExpiresAt = expires.Unix()
+	}
+}
+
+//IntrospectionHandler returns an http.Handler that serves token introspection
+//requests in the style of RFC 7662, so that services written in other languages
+//can verify session tokens centrally. Requests must be POSTs with the token in
+//the "token" form parameter, and the response is the JSON-encoded SessionInfo.
+//The handler performs no authentication of its own, so make sure only trusted
+//services can reach it.
+func IntrospectionHandler(mgr Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method must be POST", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.PostFormValue(introspectionParam)
+		if len(token) == 0 {
+			http.Error(w, "missing token parameter", http.StatusBadRequest)
+			return
+		}
+		info, err := mgr.Introspect(token)
+		if err != nil {
+			http.Error(w, "error introspecting token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(info)
+	})
+}
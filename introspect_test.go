@@ -0,0 +1,119 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerIntrospect(t *testing.T) {
+	store := newMockStore(false)
+	keys := []string{string(testSigningKey)}
+	mgr := NewManager(DefaultIDLength, keys, store)
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	attenuated := mustAttenuate(t, tk.String(), ExpiresCaveat(expires))
+	expired := mustAttenuate(t, tk.String(), ExpiresCaveat(time.Now().Add(-time.Hour)))
+	ended, _ := NewToken(testSigningKey)
+
+	cases := []struct {
+		name      string
+		token     string
+		active    bool
+		expiresAt int64
+	}{
+		{"active", tk.String(), true, 0},
+		{"attenuated", attenuated, true, expires.Unix()},
+		{"expired caveat", expired, false, 0},
+		{"ended", ended.String(), false, 0},
+		{"invalid", "garbage", false, 0},
+	}
+	for _, c := range cases {
+		info, err := mgr.Introspect(c.token)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error: %v", c.name, err)
+		}
+		if info.Active != c.active || info.ExpiresAt != c.expiresAt {
+			t.Errorf("case %s: incorrect info: %+v", c.name, info)
+		}
+		if c.active && info.SessionID != tk.ID().String() {
+			t.Errorf("case %s: incorrect session ID: %s", c.name, info.SessionID)
+		}
+	}
+
+	store.triggerError = true
+	if _, err := mgr.Introspect(tk.String()); err == nil {
+		t.Error("did not receive expected error from store")
+	}
+}
+
+func TestManagerIntrospectMetadata(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithMaxLifetime(time.Hour), WithEnricher(func(r *http.Request, info ClientInfo) { info["ua"] = r.UserAgent() }))
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("User-Agent", "tester")
+	tk, err := mgr.BeginRequestSession(httptest.NewRecorder(), req, &userState{UserID: "u1"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	info, err := mgr.Introspect(tk.String())
+	if err != nil {
+		t.Fatalf("unexpected error introspecting: %v", err)
+	}
+	if !info.Active || info.IssuedAt == 0 || info.ExpiresAt != info.IssuedAt+3600 {
+		t.Errorf("incorrect info: %+v", info)
+	}
+	if info.Metadata["user_id"] != "u1" || info.Metadata["ua"] != "tester" {
+		t.Errorf("incorrect metadata: %v", info.Metadata)
+	}
+}
+
+func TestIntrospectionHandler(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	handler := IntrospectionHandler(mgr)
+
+	cases := []struct {
+		name           string
+		method         string
+		token          string
+		expectedStatus int
+		active         bool
+	}{
+		{"active", "POST", tk.String(), http.StatusOK, true},
+		{"inactive", "POST", "garbage", http.StatusOK, false},
+		{"missing token", "POST", "", http.StatusBadRequest, false},
+		{"wrong method", "GET", tk.String(), http.StatusMethodNotAllowed, false},
+	}
+	for _, c := range cases {
+		form := url.Values{introspectionParam: {c.token}}
+		req := httptest.NewRequest(c.method, "http://example.com/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if respRec.Code != http.StatusOK {
+			continue
+		}
+		info := &SessionInfo{}
+		if err := json.NewDecoder(respRec.Body).Decode(info); err != nil {
+			t.Fatalf("case %s: error decoding response: %v", c.name, err)
+		}
+		if info.Active != c.active {
+			t.Errorf("case %s: incorrect active: expected %t but got %t", c.name, c.active, info.Active)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+/*Package kafkasink publishes session lifecycle events to a Kafka topic,
+for feeding security data lakes and other audit systems. To receive
+events from a sessions.Manager, subscribe the sink's Send method:
+
+	sink := kafkasink.New([]string{"kafka1:9092", "kafka2:9092"}, "session-events")
+	defer sink.Close()
+	mgr.Subscribe(sink.Send)
+
+Each event is published as a JSON-encoded Record, keyed by session ID so
+that all events for a session land in the same partition, in order. The
+Record's Schema field and the message's HeaderSchema header identify the
+version of the Record format, so consumers can handle future changes.
+
+Delivery is at-least-once: events are queued and written in batches by a
+background worker, which retries failed writes until they succeed, so
+consumers may occasionally see the same event more than once. If the
+queue is full, Send blocks until there is room, rather than dropping
+events.
+*/
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davestearns/sessions"
+	"github.com/segmentio/kafka-go"
+)
+
+//SchemaVersion is the version of the Record format
+const SchemaVersion = 1
+
+//HeaderSchema is the Kafka message header containing the Record's SchemaVersion
+const HeaderSchema = "schema-version"
+
+//DefaultQueueSize is the default number of events that may be
+//queued for publishing before Send blocks
+const DefaultQueueSize = 4096
+
+//DefaultBatchSize is the default maximum number of events
+//published in each write to Kafka
+const DefaultBatchSize = 100
+
+//minBackoff and maxBackoff bound the delay between retries of failed writes
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+//Record is the JSON-encoded value of each Kafka message
+type Record struct {
+	//Schema is the SchemaVersion of the record format
+	Schema int `json:"schema"`
+	//Type is the type of event
+	Type sessions.EventType `json:"type"`
+	//SessionID is the string version of the session ID
+	SessionID string `json:"sessionID"`
+	//Time is when the event occurred
+	Time time.Time `json:"time"`
+	//Source is the host name of the server where the event occurred
+	Source string `json:"source,omitempty"`
+	//Changes are the changes made to the session state by an
+	//update, if the manager was constructed WithStateDiffs
+	Changes []sessions.FieldChange `json:"changes,omitempty"`
+	//DiffFailed is true for an update whose changes couldn't be determined
+	DiffFailed bool `json:"diffFailed,omitempty"`
+}
+
+//Writer writes messages to Kafka. It is implemented by *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+//Sink publishes session events to Kafka
+type Sink struct {
+	//Types are the event types that are published. Other event types
+	//are ignored. Callers may adjust this after construction.
+	Types []sessions.EventType
+	//OnError is called with any errors that occur while publishing
+	//events. Failed writes are retried, so these errors are not fatal.
+	//Callers may set this after construction.
+	OnError   func(err error)
+	writer    Writer
+	source    string
+	batchSize int
+	queue     chan sessions.Event
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	//closed receives the error closing the writer
+	closed chan error
+}
+
+//New constructs a new Sink that publishes events to topic on the Kafka
+//cluster at brokers. Writes wait for acknowledgement from all in-sync
+//replicas, so published events survive the loss of a broker. Call Close
+//or CloseContext to flush queued events before the process exits.
+func New(brokers []string, topic string) *Sink {
+	return NewWithWriter(&kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    DefaultBatchSize,
+	})
+}
+
+//NewWithWriter constructs a new Sink that publishes events using the
+//writer, which must already be configured with a topic. By default,
+//created, updated, ended, and revoked events are published, as
+//accessed events can be very frequent.
+func NewWithWriter(writer Writer) *Sink {
+	source, _ := os.Hostname()
+	s := &Sink{
+		Types:     []sessions.EventType{sessions.EventCreated, sessions.EventUpdated, sessions.EventEnded, sessions.EventRevoked},
+		writer:    writer,
+		source:    source,
+		batchSize: DefaultBatchSize,
+		queue:     make(chan sessions.Event, DefaultQueueSize),
+	}
+	s.wg.Add(1)
+	go s.publish()
+	return s
+}
+
+//Send queues the event for publishing, if its type is one of the sink's
+//Types. If the queue is full, Send blocks until there is room. The sink
+//may not be sent events after it is closed.
+func (s *Sink) Send(evt sessions.Event) {
+	for _, t := range s.Types {
+		if evt.Type == t {
+			s.queue <- evt
+			return
+		}
+	}
+}
+
+//Close waits for all queued events to be written to Kafka, and then
+//stops the background worker and closes the writer. Since failed writes
+//are retried until they succeed, Close blocks while Kafka is unreachable.
+func (s *Sink) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done, returning
+//its error, while the queued events continue to be written in the background,
+//after which the writer is closed
+func (s *Sink) CloseContext(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.queue)
+		s.closed = make(chan error, 1)
+		go func() {
+			s.wg.Wait()
+			s.closed <- s.writer.Close()
+			close(s.closed)
+		}()
+	})
+	select {
+	case err := <-s.closed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//publish writes queued events in batches until the queue is closed
+func (s *Sink) publish() {
+	defer s.wg.Done()
+	for evt := range s.queue {
+		batch := []kafka.Message{s.message(evt)}
+	fill:
+		for len(batch) < s.batchSize {
+			select {
+			case evt, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, s.message(evt))
+			default:
+				break fill
+			}
+		}
+		s.write(batch)
+	}
+}
+
+//write writes the batch to Kafka, retrying with exponential
+//backoff until it succeeds
+func (s *Sink) write(batch []kafka.Message) {
+	backoff := minBackoff
+	for {
+		err := s.writer.WriteMessages(context.Background(), batch...)
+		if err == nil {
+			return
+		}
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("error writing %d session events to kafka: %v", len(batch), err))
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+//message converts the event to a Kafka message
+func (s *Sink) message(evt sessions.Event) kafka.Message {
+	rec := Record{
+		Schema:     SchemaVersion,
+		Type:       evt.Type,
+		SessionID:  evt.SessionID,
+		Time:       evt.Time,
+		Source:     s.source,
+		Changes:    evt.Changes,
+		DiffFailed: evt.DiffFailed,
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		//the changed values aren't JSON-safe, so publish only the
+		//names of the changed fields, which always encode
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("error encoding changes to session %s: %v", evt.SessionID, err))
+		}
+		rec.Changes = make([]sessions.FieldChange, len(evt.Changes))
+		for i, change := range evt.Changes {
+			rec.Changes[i] = sessions.FieldChange{Field: change.Field}
+		}
+		value, _ = json.Marshal(rec)
+	}
+	return kafka.Message{
+		Key:     []byte(evt.SessionID),
+		Value:   value,
+		Headers: []kafka.Header{{Key: HeaderSchema, Value: []byte(strconv.Itoa(SchemaVersion))}},
+	}
+}
@@ -0,0 +1,137 @@
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davestearns/sessions"
+	"github.com/segmentio/kafka-go"
+)
+
+type mockWriter struct {
+	mx       sync.Mutex
+	failures int
+	messages []kafka.Message
+	closed   bool
+}
+
+func (mw *mockWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	mw.mx.Lock()
+	defer mw.mx.Unlock()
+	if mw.failures > 0 {
+		mw.failures--
+		return fmt.Errorf("test error")
+	}
+	mw.messages = append(mw.messages, msgs...)
+	return nil
+}
+
+func (mw *mockWriter) Close() error {
+	mw.closed = true
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	writer := &mockWriter{failures: 1}
+	sink := NewWithWriter(writer)
+	var errs int
+	sink.OnError = func(err error) { errs++ }
+
+	now := time.Now().UTC()
+	events := []sessions.Event{
+		{Type: sessions.EventCreated, SessionID: "a", Time: now},
+		{Type: sessions.EventAccessed, SessionID: "a", Time: now},
+		{Type: sessions.EventUpdated, SessionID: "a", Time: now, Changes: []sessions.FieldChange{{Field: "Email", Old: "a", New: "b"}}},
+		{Type: sessions.EventUpdated, SessionID: "a", Time: now, DiffFailed: true},
+		{Type: sessions.EventEnded, SessionID: "a", Time: now},
+		{Type: sessions.EventRevoked, SessionID: "b", Time: now},
+	}
+	for _, evt := range events {
+		sink.Send(evt)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing sink: %v", err)
+	}
+	if !writer.closed {
+		t.Error("writer was not closed")
+	}
+	if errs != 1 {
+		t.Errorf("incorrect number of errors: expected 1 but got %d", errs)
+	}
+
+	//accessed events aren't published by default,
+	//and failed writes should be retried
+	expected := []sessions.Event{events[0], events[2], events[3], events[4], events[5]}
+	if len(writer.messages) != len(expected) {
+		t.Fatalf("incorrect number of messages: expected %d but got %d", len(expected), len(writer.messages))
+	}
+	for i, msg := range writer.messages {
+		if string(msg.Key) != expected[i].SessionID {
+			t.Errorf("incorrect key: expected %s but got %s", expected[i].SessionID, msg.Key)
+		}
+		if len(msg.Headers) != 1 || msg.Headers[0].Key != HeaderSchema || string(msg.Headers[0].Value) != "1" {
+			t.Errorf("incorrect headers: %v", msg.Headers)
+		}
+		rec := Record{}
+		if err := json.Unmarshal(msg.Value, &rec); err != nil {
+			t.Fatalf("unexpected error decoding record: %v", err)
+		}
+		if rec.Schema != SchemaVersion || rec.Type != expected[i].Type ||
+			rec.SessionID != expected[i].SessionID || !rec.Time.Equal(expected[i].Time) ||
+			!reflect.DeepEqual(rec.Changes, expected[i].Changes) || rec.DiffFailed != expected[i].DiffFailed {
+			t.Errorf("incorrect record: %v", rec)
+		}
+	}
+}
+
+func TestSinkUnencodableChanges(t *testing.T) {
+	writer := &mockWriter{}
+	sink := NewWithWriter(writer)
+	var errs int
+	sink.OnError = func(err error) { errs++ }
+	sink.Send(sessions.Event{Type: sessions.EventUpdated, SessionID: "a", Time: time.Now(),
+		Changes: []sessions.FieldChange{{Field: "Callback", New: func() {}}}})
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing sink: %v", err)
+	}
+	if errs != 1 || len(writer.messages) != 1 {
+		t.Fatalf("incorrect result: expected 1 error and 1 message but got %d and %d", errs, len(writer.messages))
+	}
+	rec := Record{}
+	if err := json.Unmarshal(writer.messages[0].Value, &rec); err != nil {
+		t.Fatalf("unexpected error decoding record: %v", err)
+	}
+	expected := []sessions.FieldChange{{Field: "Callback"}}
+	if !reflect.DeepEqual(rec.Changes, expected) {
+		t.Errorf("incorrect changes: expected %+v but got %+v", expected, rec.Changes)
+	}
+}
+
+func TestSinkCloseContext(t *testing.T) {
+	//fail every write, so the queued event is never flushed
+	writer := &mockWriter{failures: 1 << 30}
+	sink := NewWithWriter(writer)
+	sink.Send(sessions.Event{Type: sessions.EventCreated, SessionID: "a", Time: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sink.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("incorrect error: expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	//once the writes succeed, the sink should finish closing
+	writer.mx.Lock()
+	writer.failures = 0
+	writer.mx.Unlock()
+	if err := sink.CloseContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error closing sink: %v", err)
+	}
+	if len(writer.messages) != 1 || !writer.closed {
+		t.Errorf("sink was not flushed: %d messages, closed %t", len(writer.messages), writer.closed)
+	}
+}
@@ -0,0 +1,107 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//KeepaliveResponse is the JSON response written by KeepaliveHandler
+type KeepaliveResponse struct {
+	//Expires is when the session will expire if it isn't used again,
+	//or nil if the manager can't tell
+	Expires *time.Time `json:"expires,omitempty"`
+	//ExpiresIn is the number of whole seconds until Expires
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+//Keepalive resets the expiry time of the request's session, as any other
+//use of the session would, and also touches its state in the store if the
+//store implements Toucher. It returns when the session will expire if it
+//isn't used again, which is the earliest of when the store will expire its
+//state, if the store implements TTLer, when the session was set to expire
+//by BeginSessionUntil, and when the session reaches the manager's maximum
+//lifetime. The zero time is returned if none of those apply. Errors are
+//classified as GetState does, so if the session has ended,
+//ErrSessionNotFound is returned.
+func (m *manager) Keepalive(r *http.Request) (time.Time, error) {
+	tk, err := m.GetToken(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	env, err := m.resumeEnvelope(r, tk, nil, false)
+	if err != nil {
+		return time.Time{}, getStateError(err)
+	}
+	if t, ok := m.store.(Toucher); ok {
+		if err := t.Touch(tk); err != nil {
+			return time.Time{}, getStateError(err)
+		}
+	}
+	expires, err := m.expiry(tk, env)
+	if err != nil {
+		return time.Time{}, getStateError(err)
+	}
+	return expires, nil
+}
+
+//expiry returns when the session will expire if it isn't used again,
+//or the zero time if the manager can't tell, as described in Keepalive
+func (m *manager) expiry(token Token, env *envelope) (time.Time, error) {
+	var expires time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (expires.IsZero() || t.Before(expires)) {
+			expires = t
+		}
+	}
+	if ttler, ok := m.store.(TTLer); ok {
+		ttl, err := ttler.TTL(token)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ttl > 0 {
+			earliest(time.Now().Add(ttl))
+		}
+	}
+	if env != nil {
+		earliest(env.Expires)
+		if m.maxLifetime > 0 {
+			earliest(env.Created.Add(m.maxLifetime))
+		}
+	}
+	return expires, nil
+}
+
+//KeepaliveHandler returns an http.Handler that keeps the request's session
+//alive using the manager's Keepalive method, and responds with a JSON
+//KeepaliveResponse. Single-page apps can request it periodically while a
+//tab is open, to keep the user signed in, and to warn them before their
+//session expires. Requests without a valid session are rejected like
+//Require does, using FormatJSON.
+func KeepaliveHandler(m Manager) http.Handler {
+	opts := RequireOptions{Format: FormatJSON}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := m.GetToken(r); err != nil {
+			if err == ErrNoToken {
+				opts.reject(w, r, RequireNoSession, "no session token")
+			} else {
+				opts.reject(w, r, RequireInvalidSession, "invalid session token")
+			}
+			return
+		}
+		expires, err := m.Keepalive(r)
+		if err != nil {
+			code, message := resumeRejection(err)
+			opts.reject(w, r, code, message)
+			return
+		}
+		resp := KeepaliveResponse{}
+		if !expires.IsZero() {
+			resp.Expires = &expires
+			resp.ExpiresIn = int64(time.Until(expires) / time.Second)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,111 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestKeepalive(t *testing.T) {
+	srv := miniredis.RunT(t)
+	cases := []struct {
+		name            string
+		store           Store
+		opts            []ManagerOption
+		expectedExpires time.Duration
+	}{
+		{"memory store", NewMemoryStore(time.Hour), nil, time.Hour},
+		{"redis store", NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour), nil, time.Hour},
+		{"max lifetime", NewMemoryStore(time.Hour), []ManagerOption{WithMaxLifetime(30 * time.Minute)}, 30 * time.Minute},
+		{"store without TTLs", newMockStore(false), nil, 0},
+	}
+	for _, c := range cases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, c.store, c.opts...)
+		tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		req := httptest.NewRequest("POST", "http://example.com/keepalive", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+		expires, err := mgr.Keepalive(req)
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if c.expectedExpires == 0 {
+			if !expires.IsZero() {
+				t.Errorf("case %s: incorrect expiry: expected zero time but got %v", c.name, expires)
+			}
+			continue
+		}
+		if remaining := time.Until(expires); remaining > c.expectedExpires || remaining < c.expectedExpires-time.Minute {
+			t.Errorf("case %s: incorrect expiry: expected about %v but got %v", c.name, c.expectedExpires, remaining)
+		}
+
+		//ended sessions should report ErrSessionNotFound
+		if err := c.store.Delete(tk); err != nil {
+			t.Fatalf("case %s: unexpected error deleting state: %v", c.name, err)
+		}
+		if _, err := mgr.Keepalive(req); err != ErrSessionNotFound {
+			t.Errorf("case %s: incorrect error for ended session: expected %v but got %v", c.name, ErrSessionNotFound, err)
+		}
+	}
+}
+
+func TestKeepaliveHandler(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	handler := KeepaliveHandler(mgr)
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	ended, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	store.Delete(ended)
+
+	cases := []struct {
+		name           string
+		authHeader     string
+		expectedStatus int
+		expectedError  string
+	}{
+		{"valid session", authTypeBearer + " " + tk.String(), http.StatusOK, ""},
+		{"no token", "", http.StatusUnauthorized, RequireNoSession},
+		{"invalid token", authTypeBearer + " " + modToken(tk.String()), http.StatusUnauthorized, RequireInvalidSession},
+		{"ended session", authTypeBearer + " " + ended.String(), http.StatusUnauthorized, RequireInvalidSession},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "http://example.com/keepalive", nil)
+		if len(c.authHeader) > 0 {
+			req.Header.Set(headerAuthorization, c.authHeader)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+			continue
+		}
+		if len(c.expectedError) > 0 {
+			if !strings.Contains(respRec.Body.String(), c.expectedError) {
+				t.Errorf("case %s: incorrect response: expected %s error but got %s", c.name, c.expectedError, respRec.Body.String())
+			}
+			continue
+		}
+		resp := &KeepaliveResponse{}
+		if err := json.Unmarshal(respRec.Body.Bytes(), resp); err != nil {
+			t.Errorf("case %s: error decoding response: %v", c.name, err)
+			continue
+		}
+		if resp.Expires == nil || resp.ExpiresIn < 3590 || resp.ExpiresIn > 3600 {
+			t.Errorf("case %s: incorrect response: %s", c.name, respRec.Body.String())
+		}
+	}
+}
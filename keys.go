@@ -0,0 +1,91 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+//ErrNoSigningKey is returned when a new token is needed, but none of the
+//keys can sign tokens, such as when they are all ed25519 public keys
+var ErrNoSigningKey = errors.New("no signing key can sign tokens")
+
+//keyIndexGenerator is used to generate random signing key indexes
+var keyIndexGenerator = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+//keyRing holds the signing keys used by a manager, and
+//handles rotating between them
+type keyRing []SigningKey
+
+//newKeyRing converts string signing keys to a keyRing of HS256 keys
+func newKeyRing(signingKeys []string) keyRing {
+	kr := make(keyRing, len(signingKeys))
+	for i, v := range signingKeys {
+		kr[i] = SigningKey{Algorithm: HS256, Key: []byte(v)}
+	}
+	return kr
+}
+
+//newHMACKeyRing converts byte slice signing keys to a keyRing of HS256 keys
+func newHMACKeyRing(signingKeys [][]byte) keyRing {
+	kr := make(keyRing, len(signingKeys))
+	for i, v := range signingKeys {
+		kr[i] = SigningKey{Algorithm: HS256, Key: v}
+	}
+	return kr
+}
+
+//random returns a randomly-selected key from those in the ring that can
+//sign tokens. Keys that can only verify tokens are never selected, and
+//ErrNoSigningKey is returned if there are no others.
+func (kr keyRing) random() (SigningKey, error) {
+	signers := make([]SigningKey, 0, len(kr))
+	for _, key := range kr {
+		if key.canSign() {
+			signers = append(signers, key)
+		}
+	}
+	if len(signers) == 0 {
+		return SigningKey{}, ErrNoSigningKey
+	}
+	return signers[keyIndexGenerator.Intn(len(signers))], nil
+}
+
+//secrets returns the secrets of the keys in the ring that have them,
+//for verifying data that features sign with the keys' secrets
+func (kr keyRing) secrets() [][]byte {
+	secrets := make([][]byte, 0, len(kr))
+	for _, key := range kr {
+		if secret, err := key.secret(); err == nil {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+//verify verifies the base64-encoded token against each key in the ring,
+//returning the verified Token and the secret of the key that verified it,
+//from which features that sign their own data derive their keys. Tokens
+//verified by keys that have no secret are rejected.
+func (kr keyRing) verify(b64token string, opts []TokenOption) (Token, []byte, error) {
+	tk, i, err := kr.verifyIndex(b64token, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := kr[i].secret()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tk, secret, nil
+}
+
+//verifyIndex is like verify, but returns the index
+//of the key that verified the token
+func (kr keyRing) verifyIndex(b64token string, opts []TokenOption) (Token, int, error) {
+	tk, i, err := verifyTokenWithKeys(b64token, kr, opts)
+	if err != nil {
+		return nil, -1, fmt.Errorf("error verifying session token: %v", err)
+	}
+	return tk, i, nil
+}
@@ -0,0 +1,115 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+)
+
+//lazySessionContextKey is the context key for the request's *LazySession
+const lazySessionContextKey contextKey = -1
+
+//LazySession is a session that isn't created until the handler actually
+//saves some state to it. This avoids minting tokens and storing empty
+//sessions for clients that never need them, such as anonymous crawlers.
+//Use the LazySessions middleware to add one to each request's context,
+//and LazySessionFromContext to get it within your handlers.
+type LazySession struct {
+	mgr   Manager
+	w     http.ResponseWriter
+	r     *http.Request
+	token Token
+	//active is true once the session is known to exist in the store
+	active bool
+	//saved holds the gob-encoded state saved when the session
+	//was begun during this request, since the request itself
+	//doesn't carry the new token
+	saved []byte
+}
+
+//LazySessions is middleware that adds a *LazySession for the current
+//request to the request's context before calling next.
+func LazySessions(m Manager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ls := &LazySession{mgr: m, w: w, r: r}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), lazySessionContextKey, ls)))
+	})
+}
+
+//LazySessionFromContext returns the *LazySession added to the
+//context by the LazySessions middleware, if any.
+func LazySessionFromContext(ctx context.Context) (*LazySession, bool) {
+	ls, ok := ctx.Value(lazySessionContextKey).(*LazySession)
+	return ls, ok
+}
+
+//Token returns the session Token, or ErrNoToken if the request has
+//no session and no state has been saved to this session yet.
+func (ls *LazySession) Token() (Token, error) {
+	if ls.token != nil {
+		return ls.token, nil
+	}
+	tk, err := ls.mgr.GetToken(ls.r)
+	if err != nil {
+		return nil, err
+	}
+	ls.token = tk
+	return tk, nil
+}
+
+//GetState populates sessionState from the Store. If the request has no
+//session and no state has been saved to this session yet, ErrNoToken is returned.
+func (ls *LazySession) GetState(sessionState interface{}) error {
+	if ls.saved != nil {
+		return decodeState(ls.saved, sessionState)
+	}
+	if _, err := ls.Token(); err != nil {
+		return err
+	}
+	if _, err := ls.mgr.GetState(ls.r, sessionState); err != nil {
+		return err
+	}
+	ls.active = true
+	return nil
+}
+
+//SetState saves sessionState to the session, beginning a new session
+//if the request doesn't already have a valid one, including when its
+//token is valid but its session has ended or expired. If the session
+//couldn't be checked because the store failed, the *StoreError is
+//returned. Since beginning a new session adds a response header, call
+//this before writing the response body.
+func (ls *LazySession) SetState(sessionState interface{}) error {
+	tk, err := ls.Token()
+	if err == nil && !ls.active {
+		if _, err = ls.mgr.GetState(ls.r, nil); err != nil {
+			if _, ok := err.(*StoreError); ok {
+				return err
+			}
+		}
+	}
+	if err == nil {
+		if err := ls.mgr.UpdateState(tk, sessionState); err != nil {
+			return err
+		}
+		ls.active = true
+		if ls.saved != nil {
+			return ls.save(sessionState)
+		}
+		return nil
+	}
+	if tk, err = ls.mgr.BeginRequestSession(ls.w, ls.r, sessionState); err != nil {
+		return err
+	}
+	ls.token, ls.active = tk, true
+	return ls.save(sessionState)
+}
+
+//save retains an encoded copy of sessionState for GetState
+func (ls *LazySession) save(sessionState interface{}) error {
+	saved, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	ls.saved = saved
+	return nil
+}
@@ -0,0 +1,164 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLazySessions(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+
+	cases := []struct {
+		name          string
+		setState      bool
+		expectSession bool
+	}{
+		{
+			"no state saved",
+			false,
+			false,
+		},
+		{
+			"state saved",
+			true,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		store.entries = make(map[string][]byte)
+		var handlerErr error
+		handler := LazySessions(mgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ls, ok := LazySessionFromContext(r.Context())
+			if !ok {
+				t.Fatalf("case %s: no lazy session in request context", c.name)
+			}
+			var state string
+			if err := ls.GetState(&state); err != ErrNoToken {
+				t.Errorf("case %s: incorrect error getting state before saving: expected %v but got %v", c.name, ErrNoToken, err)
+			}
+			if c.setState {
+				if handlerErr = ls.SetState("test state"); handlerErr != nil {
+					return
+				}
+				if handlerErr = ls.GetState(&state); handlerErr != nil {
+					return
+				}
+				if state != "test state" {
+					t.Errorf("case %s: incorrect state: expected %s but got %s", c.name, "test state", state)
+				}
+			}
+		}))
+
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, httptest.NewRequest("GET", "http://example.com", nil))
+		if handlerErr != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, handlerErr)
+			continue
+		}
+		hasHeader := len(respRec.Header().Get(headerAuthorization)) > 0
+		if hasHeader != c.expectSession {
+			t.Errorf("case %s: incorrect Authorization header presence: expected %t but got %t", c.name, c.expectSession, hasHeader)
+		}
+		if (len(store.entries) > 0) != c.expectSession {
+			t.Errorf("case %s: incorrect number of store entries: %d", c.name, len(store.entries))
+		}
+	}
+}
+
+func TestLazySessionExisting(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	token, err := mgr.BeginSession(httptest.NewRecorder(), "initial state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	handler := LazySessions(mgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ls, _ := LazySessionFromContext(r.Context())
+		tk, err := ls.Token()
+		if err != nil {
+			t.Fatalf("unexpected error getting token: %v", err)
+		}
+		if tk.String() != token.String() {
+			t.Errorf("incorrect token: expected %s but got %s", token.String(), tk.String())
+		}
+		var state string
+		if err := ls.GetState(&state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+		if state != "initial state" {
+			t.Errorf("incorrect state: expected %s but got %s", "initial state", state)
+		}
+		if err := ls.SetState("updated state"); err != nil {
+			t.Fatalf("unexpected error setting state: %v", err)
+		}
+	}))
+
+	respRec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+token.String())
+	handler.ServeHTTP(respRec, req)
+
+	if len(respRec.Header().Get(headerAuthorization)) > 0 {
+		t.Error("new session begun for request with an existing session")
+	}
+	var state string
+	if err := store.Get(token, &state); err != nil {
+		t.Fatalf("unexpected error getting state from store: %v", err)
+	}
+	if state != "updated state" {
+		t.Errorf("incorrect state: expected %s but got %s", "updated state", state)
+	}
+
+	//ensure we get nothing from a context without a lazy session
+	if _, ok := LazySessionFromContext(req.Context()); ok {
+		t.Error("got a lazy session from a context without one")
+	}
+}
+
+func TestLazySessionEnded(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	cases := []struct {
+		name          string
+		storeError    bool
+		expectSession bool
+	}{
+		{"session ended", false, true},
+		{"store error", true, false},
+	}
+
+	for _, c := range cases {
+		token, err := mgr.BeginSession(httptest.NewRecorder(), "initial state")
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		store.Delete(token)
+		store.triggerError = c.storeError
+
+		var setErr error
+		handler := LazySessions(mgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ls, _ := LazySessionFromContext(r.Context())
+			setErr = ls.SetState("updated state")
+		}))
+		respRec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+token.String())
+		handler.ServeHTTP(respRec, req)
+		store.triggerError = false
+
+		if _, isStoreErr := setErr.(*StoreError); isStoreErr != c.storeError || (setErr != nil && !c.storeError) {
+			t.Errorf("case %s: incorrect error setting state: %v", c.name, setErr)
+		}
+		if hasHeader := len(respRec.Header().Get(headerAuthorization)) > 0; hasHeader != c.expectSession {
+			t.Errorf("case %s: incorrect Authorization header presence: expected %t but got %t", c.name, c.expectSession, hasHeader)
+		}
+		var state string
+		if err := store.Get(token, &state); err != ErrStateNotFound {
+			t.Errorf("case %s: ended session was recreated: %s, %v", c.name, state, err)
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package sessions
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
-	"strings"
+	"reflect"
 	"time"
 )
 
@@ -21,23 +22,295 @@ var ErrNoToken = errors.New("no session token")
 //the session token is not supported
 var ErrUnsupportedTokenType = errors.New("unsupported session token type")
 
-//keyIndexGenerator is used to generate random signing key indexes
-var keyIndexGenerator = rand.New(rand.NewSource(time.Now().UnixNano()))
+//ErrSessionTooOld is returned from GetState when the session
+//is older than the maximum lifetime set by WithMaxLifetime
+var ErrSessionTooOld = errors.New("session is older than the maximum lifetime")
+
+//ErrTokenTooOld is returned from GetToken and GetState when the token
+//was issued longer ago than the maximum age set by WithMaxTokenAge
+var ErrTokenTooOld = errors.New("session token is older than the maximum age")
+
+//ErrSessionExpired is returned from GetState when the session
+//has passed the expiry time set by BeginSessionUntil
+var ErrSessionExpired = errors.New("session has expired")
+
+//ErrSessionExpiryDisabled is returned from BeginSessionUntil
+//when the manager was not constructed WithSessionExpiry
+var ErrSessionExpiryDisabled = errors.New("per-session expiry is not enabled")
+
+//ErrPeekNotSupported is returned from PeekState when
+//the manager's store doesn't implement Peeker
+var ErrPeekNotSupported = errors.New("store does not support peeking at session state")
+
+//ErrSessionNotFound is returned from GetState and the other methods that
+//resume sessions when there is no state in the store for the session,
+//usually because it has expired in the store, or has ended
+var ErrSessionNotFound = errors.New("session not found")
+
+//ErrSessionInvalid is returned from GetState and the other methods that
+//resume sessions when the session's state couldn't be decoded, such as
+//after an incompatible change to the state's type. Retrying won't help,
+//so handlers should treat the session as they would a missing one.
+var ErrSessionInvalid = errors.New("session state is invalid")
+
+//ErrStoreTimeout is the Kind of a *StoreError returned
+//when a store operation timed out
+var ErrStoreTimeout = errors.New("session store timed out")
+
+//ErrStoreUnavailable is the Kind of a *StoreError returned when
+//a store operation failed for any other reason, including when the
+//store's circuit is open
+var ErrStoreUnavailable = errors.New("session store is unavailable")
+
+//StoreError is returned from GetState and the other methods that resume
+//sessions when the session couldn't be checked, because the store failed.
+//HTTP handlers can compare Kind to ErrStoreTimeout and ErrStoreUnavailable
+//to choose a response status, such as 504 or 503.
+type StoreError struct {
+	//Kind is ErrStoreTimeout or ErrStoreUnavailable
+	Kind error
+	//Err is the error returned by the store
+	Err error
+}
+
+//Error returns the error message
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+//Is reports whether target is the error's Kind, for use with errors.Is
+func (e *StoreError) Is(target error) bool {
+	return target == e.Kind
+}
+
+//Unwrap returns the error returned by the store, for use with errors.Is and errors.As
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
 
 //Manager describes what session managers can do
 type Manager interface {
 	BeginSession(w http.ResponseWriter, sessionState interface{}) (Token, error)
 	GetToken(r *http.Request) (Token, error)
 	GetState(r *http.Request, sessionState interface{}) (Token, error)
+	PeekState(r *http.Request, sessionState interface{}) (Token, error)
 	UpdateState(token Token, sessionState interface{}) error
 	EndSession(r *http.Request) error
+	GetOrBeginSession(w http.ResponseWriter, r *http.Request, initState interface{}) (Token, error)
+	BeginRequestSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error)
+	BeginSessionUntil(w http.ResponseWriter, sessionState interface{}, expires time.Time) (Token, error)
+	Healthy(ctx context.Context) error
+	Subscribe(fn func(Event)) (unsubscribe func())
+	SignURL(token Token, rawurl string, ttl time.Duration) (string, error)
+	VerifyURL(r *http.Request, sessionState interface{}) (Token, error)
+	NewSubToken(parent Token, ttl time.Duration, scopes ...string) (string, error)
+	NewAPIKey(token Token, ttl time.Duration, scopes ...string) (string, error)
+	Revoke(token Token) error
+	RevokeUser(userID string) error
+	Devices(userID string) ([]Device, error)
+	RevokeDevice(userID string, deviceID string) error
+	Activity(sessionID string) ([]Activity, error)
+	Session(w http.ResponseWriter, r *http.Request) (*Session, error)
+	Introspect(token string) (*SessionInfo, error)
+	Require(next http.Handler, opts RequireOptions) http.Handler
+	HasRole(r *http.Request, role string) (bool, error)
+	HasPermission(r *http.Request, permission string) (bool, error)
+	RequireRole(next http.Handler, opts RequireOptions, roles ...string) http.Handler
+	RequirePermission(next http.Handler, opts RequireOptions, permissions ...string) http.Handler
+	Merge(guestToken Token, authToken Token, guestState interface{}, authState interface{}, merge func() error) error
+	BeginPreSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error)
+	GetPreSessionState(r *http.Request, sessionState interface{}) (Token, error)
+	UpgradeSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error)
+	RequirePreSession(next http.Handler, opts RequireOptions) http.Handler
+	Keepalive(r *http.Request) (time.Time, error)
+	BeginSessionToken(sessionState interface{}) (string, error)
+	GetStateByToken(token string, sessionState interface{}) (Token, error)
+	EndSessionByToken(token string) error
+	Close(ctx context.Context) error
 }
 
 //manager is the concrete implementation of the Manager interface
 type manager struct {
-	idLength    int
-	signingKeys [][]byte
-	store       Store
+	idLength       int
+	keys           keyRing
+	store          Store
+	tokenOpts      []TokenOption
+	events         *eventHub
+	maxLifetime    time.Duration
+	sessionExpiry  bool
+	suppressHeader bool
+	transport      Transport
+	revocations    RevocationList
+	epochs         EpochStore
+	devices        DeviceRegistry
+	enrichers      []Enricher
+	policy         ResumptionPolicy
+	activity       ActivityLog
+	codecs         map[reflect.Type]Codec
+	schemaVersion  int
+	migrations     map[int]Migration
+	expvars        *ExpvarMetrics
+	maxTokenLength int
+	roles          bool
+	preSessionTTL  time.Duration
+	expiresFormat  ExpiresFormat
+	stateDiffs     bool
+	diffValues     bool
+	maxTokenAge    time.Duration
+	keyMetrics     KeyMetrics
+	sinks          []sinkSubscription
+}
+
+//ManagerOption configures optional Manager behavior
+type ManagerOption func(*manager)
+
+//WithTokenOptions sets the TokenOptions the manager uses
+//when generating and verifying session tokens.
+func WithTokenOptions(opts ...TokenOption) ManagerOption {
+	return func(m *manager) {
+		m.tokenOpts = append(m.tokenOpts, opts...)
+	}
+}
+
+//WithMaxLifetime sets an absolute maximum lifetime for sessions.
+//GetState returns ErrSessionTooOld for sessions begun longer ago than
+//maxLifetime, even if the store keeps refreshing their expiry, and
+//the expired session state is deleted. This records the session's
+//creation time alongside its state in the store, so sessions begun
+//without this option are not readable with it, and vice-versa.
+func WithMaxLifetime(maxLifetime time.Duration) ManagerOption {
+	return func(m *manager) {
+		m.maxLifetime = maxLifetime
+	}
+}
+
+//WithMaxTokenAge rejects tokens issued longer ago than maxAge with
+//ErrTokenTooOld, regardless of whether the session's state is still in the
+//store, which limits the value of stolen tokens that have lain dormant. This
+//includes the issued-at time in the manager's tokens (see WithIssuedAt), so
+//tokens generated without this option are not accepted with it, and
+//vice-versa. Unlike WithMaxLifetime, the state of sessions with old tokens
+//isn't deleted, so a session can continue with a new token.
+func WithMaxTokenAge(maxAge time.Duration) ManagerOption {
+	return func(m *manager) {
+		m.maxTokenAge = maxAge
+		m.tokenOpts = append(m.tokenOpts, WithIssuedAt())
+	}
+}
+
+//WithSigningKeys adds keys that declare their own algorithms to the
+//manager's key ring, after the HS256 signingKeys passed to NewManager, which
+//may then be empty. New tokens are signed with a randomly-selected key that
+//can sign, and tokens signed with any of the keys are accepted, so to migrate
+//to another algorithm, add keys using it, then replace the old signing keys
+//with verify-only keys (such as ed25519 public keys), or remove them, once
+//their tokens have expired. NewManager panics if any key is invalid. If
+//none of the keys can sign, the manager can only resume sessions, and
+//methods that need a new token return ErrNoSigningKey.
+func WithSigningKeys(keys ...SigningKey) ManagerOption {
+	return func(m *manager) {
+		m.keys = append(m.keys, keys...)
+	}
+}
+
+//WithKeyMetrics sets the KeyMetrics that are told which signing key
+//verified each token the manager accepts from a request, which shows
+//when tokens signed with an old key are no longer in use, so that the
+//key can be retired
+func WithKeyMetrics(metrics KeyMetrics) ManagerOption {
+	return func(m *manager) {
+		m.keyMetrics = metrics
+	}
+}
+
+//WithSessionExpiry enables per-session expiry times, which are set
+//using BeginSessionUntil. This is useful when an identity provider
+//dictates when a session must end, regardless of activity. Like
+//WithMaxLifetime, this records the expiry time alongside the session's
+//state in the store, so sessions begun without this option are not
+//readable with it, and vice-versa.
+func WithSessionExpiry() ManagerOption {
+	return func(m *manager) {
+		m.sessionExpiry = true
+	}
+}
+
+//WithoutResponseHeader stops BeginSession from adding the session token
+//to the response using the manager's Transport. Use this for APIs that
+//deliver the token some other way, such as in a JSON response body, or
+//via a cookie set by another layer, so that clients don't receive it twice.
+func WithoutResponseHeader() ManagerOption {
+	return func(m *manager) {
+		m.suppressHeader = true
+	}
+}
+
+//WithTransport sets the Transport the manager uses to add session tokens
+//to responses, and get them from requests. See DefaultTransport for the
+//default behavior.
+func WithTransport(transport Transport) ManagerOption {
+	return func(m *manager) {
+		m.transport = transport
+	}
+}
+
+//WithRevocationList sets the RevocationList used to record sessions
+//revoked by Revoke, and checked by GetState. Revocations are remembered
+//for the maximum session lifetime set by WithMaxLifetime, or for
+//DefaultRevocationTTL if there is no maximum lifetime.
+func WithRevocationList(revocations RevocationList) ManagerOption {
+	return func(m *manager) {
+		m.revocations = revocations
+	}
+}
+
+//WithEpochStore sets the EpochStore used by RevokeUser to invalidate
+//all of a user's sessions at once. Sessions are associated with users
+//when their state implements UserIdentifier. Like WithMaxLifetime, this
+//records the user ID and creation time alongside the session's state in
+//the store, so sessions begun without this option are not readable with
+//it, and vice-versa.
+func WithEpochStore(epochs EpochStore) ManagerOption {
+	return func(m *manager) {
+		m.epochs = epochs
+	}
+}
+
+//WithDeviceRegistry sets the DeviceRegistry used to record the devices
+//that each user has signed in from. Sessions are recorded when their state
+//implements both UserIdentifier and DeviceIdentifier. Like WithMaxLifetime,
+//this records the user and device IDs alongside the session's state in
+//the store, so sessions begun without this option are not readable with
+//it, and vice-versa.
+func WithDeviceRegistry(devices DeviceRegistry) ManagerOption {
+	return func(m *manager) {
+		m.devices = devices
+	}
+}
+
+//WithActivityLog sets the ActivityLog used to record
+//each request that resumes a session using GetState
+func WithActivityLog(activity ActivityLog) ManagerOption {
+	return func(m *manager) {
+		m.activity = activity
+	}
+}
+
+//caveatAllowance is the length allowed for caveats in attenuated
+//tokens, when deriving a manager's default maximum token length
+const caveatAllowance = 1024
+
+//WithTokenLengthLimit sets the maximum length of the encoded tokens the
+//manager accepts from requests. Longer tokens are rejected with
+//ErrTokenTooLong before they are decoded or verified, which cheaply
+//rejects requests carrying huge headers or parameters. The default is
+//derived from the manager's idLength, allowing for hex or base64
+//encoding, plus room for the caveats of attenuated tokens. Set this
+//higher if you attenuate tokens with many or very long caveats.
+func WithTokenLengthLimit(maxLength int) ManagerOption {
+	return func(m *manager) {
+		m.maxTokenLength = maxLength
+	}
 }
 
 //NewManager constructs a new manager. Use idLength to specify a byte length
@@ -45,77 +318,135 @@ type manager struct {
 //signingKeys to use for signing session tokens--if multiple are provided,
 //the manager will rotate which key is used over time. The store will be
 //used to save, get, and delete session state associated with tokens.
-func NewManager(idLength int, signingKeys []string, store Store) Manager {
-	//convert string keys to byte slices
-	bkeys := make([][]byte, len(signingKeys))
-	for i, v := range signingKeys {
-		bkeys[i] = []byte(v)
+//Use opts to configure optional behavior.
+func NewManager(idLength int, signingKeys []string, store Store, opts ...ManagerOption) Manager {
+	m := &manager{
+		idLength:  idLength,
+		keys:      newKeyRing(signingKeys),
+		store:     store,
+		events:    newEventHub(),
+		transport: DefaultTransport,
+		//hex encoding doubles the length, which
+		//is more than any base64 encoding adds
+		maxTokenLength: 2*(idLength+sha256.Size) + caveatAllowance,
 	}
-	return &manager{
-		idLength:    idLength,
-		signingKeys: bkeys,
-		store:       store,
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.keys.mustCheck()
+	return m
 }
 
 //BeginSession begins a new session, saving the provided sessionState to the store.
 //The new Token for the session is returned, or an error if a problem occurs.
 func (m *manager) BeginSession(w http.ResponseWriter, sessionState interface{}) (Token, error) {
+	return m.beginSession(w, sessionState, &envelope{Created: time.Now()})
+}
+
+//BeginSessionUntil is like BeginSession, but the session expires at the
+//expires time, after which GetState returns ErrSessionExpired. A zero
+//expires time means the session doesn't expire. The manager must be
+//constructed WithSessionExpiry, or ErrSessionExpiryDisabled is returned.
+func (m *manager) BeginSessionUntil(w http.ResponseWriter, sessionState interface{}, expires time.Time) (Token, error) {
+	if !m.sessionExpiry {
+		return nil, ErrSessionExpiryDisabled
+	}
+	return m.beginSession(w, sessionState, &envelope{Created: time.Now(), Expires: expires})
+}
+
+//beginSession begins a new session, saving the provided
+//sessionState to the store, wrapped in env if the manager
+//uses envelopes.
+func (m *manager) beginSession(w http.ResponseWriter, sessionState interface{}, env *envelope) (Token, error) {
 	//generate a new token
-	keyidx := keyIndexGenerator.Intn(len(m.signingKeys))
-	tk, err := NewTokenOfLength(m.signingKeys[keyidx], m.idLength)
+	key, err := m.keys.random()
+	if err != nil {
+		return nil, err
+	}
+	tk, err := NewTokenWithKey(key, m.idLength, m.tokenOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("error generating new token: %v", err)
 	}
 
 	//save the session state
-	if err := m.store.Save(tk, sessionState); err != nil {
+	if err := m.saveState(tk, sessionState, env); err != nil {
 		return nil, fmt.Errorf("error saving session state: %v", err)
 	}
-	//add the token to the Authorization header as a bearer token
-	w.Header().Add(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, tk.String()))
+	//add the token to the response, if there is one
+	if w != nil && !m.suppressHeader {
+		if err := m.transport.Write(w, tk); err != nil {
+			return nil, fmt.Errorf("error writing token to response: %v", err)
+		}
+	}
+	m.writeExpires(w, tk, env)
+	m.events.emit(EventCreated, tk)
 	return tk, nil
 }
 
 //GetToken gets the Token (if any) from the request.
 //ErrNoToken is returned if there is no session token.
-//ErrUnsupportedTokenType is returned if the token type is unsupported. Currently, we
-//only support "Bearer" tokens.
+//ErrUnsupportedTokenType is returned if the token type is unsupported. By default,
+//we only support "Bearer" tokens (see DefaultTransport).
+//Tokens attenuated with caveats (see Attenuate) are accepted only if the
+//request satisfies every caveat, or ErrCaveatNotSatisfied is returned.
+//If the request has several candidate tokens, such as several Authorization
+//headers, the first one that verifies is returned.
 func (m *manager) GetToken(r *http.Request) (Token, error) {
-	//get the Authorization header
-	authHeader := r.Header.Get(headerAuthorization)
-	//if empty, fallback to the query string parameter
-	if len(authHeader) == 0 {
-		authHeader = r.URL.Query().Get(paramAuthorization)
-	}
-
-	//if still empty, return appropriate error
-	if len(authHeader) == 0 {
-		return nil, ErrNoToken
+	candidates, err := readCandidates(m.transport, r)
+	if err != nil {
+		return nil, err
 	}
-
-	//ensure it has the Bearer prefix
-	if !strings.HasPrefix(authHeader, authTypeBearer) {
-		return nil, ErrUnsupportedTokenType
+	//use the first candidate that verifies, returning
+	//the last candidate's error if none do
+	for _, b64tk := range candidates {
+		var tk Token
+		if tk, err = m.verifyToken(r, b64tk); err == nil {
+			return tk, nil
+		}
 	}
+	m.expvars.verifyFailed()
+	return nil, err
+}
 
-	//verify the token that follows the "Bearer " prefix
-	b64tk := authHeader[len(authTypeBearer)+1:]
-	var tk Token
-	var err error
-	for _, key := range m.signingKeys {
-		tk, err = VerifyToken(b64tk, key)
-		if err == nil {
-			break
-		}
+//verifyToken verifies the encoded token, including any caveats, which
+//are checked against the request. The request may be nil, in which case
+//only caveats that don't depend on the request can be satisfied.
+func (m *manager) verifyToken(r *http.Request, b64tk string) (Token, error) {
+	if len(b64tk) > m.maxTokenLength {
+		return nil, ErrTokenTooLong
 	}
+	tk, keyIndex, err := m.keys.verifyAttenuated(r, b64tk, m.tokenOpts)
 	if err != nil {
-		return nil, fmt.Errorf("error verifying session token: %v", err)
+		return nil, err
+	}
+	if err := m.checkTokenAge(tk); err != nil {
+		return nil, err
+	}
+	if m.keyMetrics != nil {
+		m.keyMetrics.ObserveKeyUsage(keyIndex)
 	}
-
 	return tk, nil
 }
 
+//maxTokenClockSkew is how far in the future the issued-at time of a
+//token may be, to allow for the clocks of servers sharing signing keys
+//differing slightly
+const maxTokenClockSkew = time.Minute
+
+//checkTokenAge returns ErrTokenTooOld if the token was issued longer
+//ago than the manager's maximum token age, if any, or if its issued-at
+//time is implausible, such as when it was issued without one
+func (m *manager) checkTokenAge(tk Token) error {
+	if m.maxTokenAge <= 0 {
+		return nil
+	}
+	issued, ok := IssuedAt(tk)
+	if age := time.Since(issued); !ok || age > m.maxTokenAge || age < -maxTokenClockSkew {
+		return ErrTokenTooOld
+	}
+	return nil
+}
+
 //GetState gets and validates the session Token, populates sessionState from the Store,
 //and returns the Token.
 func (m *manager) GetState(r *http.Request, sessionState interface{}) (Token, error) {
@@ -125,15 +456,63 @@ func (m *manager) GetState(r *http.Request, sessionState interface{}) (Token, er
 	}
 
 	//get the associated session state
-	if err := m.store.Get(tk, sessionState); err != nil {
-		return nil, fmt.Errorf("error getting session state: %v", err)
+	if err := m.resume(r, tk, sessionState); err != nil {
+		return nil, getStateError(err)
+	}
+	return tk, nil
+}
+
+//PeekState is like GetState, but doesn't reset the session's idle expiry
+//time in the store, record activity, or emit an EventAccessed event, so
+//that background requests, such as polling for notifications, don't keep
+//the session alive indefinitely. The manager's policies are still enforced.
+//If the store doesn't implement Peeker, ErrPeekNotSupported is returned.
+func (m *manager) PeekState(r *http.Request, sessionState interface{}) (Token, error) {
+	tk, err := m.GetToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.store.(Peeker); !ok {
+		return nil, ErrPeekNotSupported
+	}
+	env, err := m.readState(tk, sessionState, true)
+	if err == nil && env != nil && env.Pending {
+		err = ErrSessionPending
+	}
+	if err == nil {
+		err = m.checkPolicy(r, tk, env)
+	}
+	if err != nil {
+		return nil, getStateError(err)
 	}
 	return tk, nil
 }
 
 //UpdateState updates the session state for the provided token.
 func (m *manager) UpdateState(token Token, sessionState interface{}) error {
-	return m.store.Save(token, sessionState)
+	var env *envelope
+	if m.usesEnvelope() {
+		//get the existing envelope so that its metadata is preserved
+		var err error
+		if env, err = m.getEnvelope(token); err != nil {
+			return err
+		}
+	}
+	var changes []FieldChange
+	diffFailed := false
+	if m.stateDiffs {
+		//decode the previous state before env is updated
+		if prev, err := m.previousState(sessionState, env); err == nil {
+			changes = diffState(prev, sessionState, m.diffValues)
+		} else {
+			diffFailed = true
+		}
+	}
+	if err := m.saveState(token, sessionState, env); err != nil {
+		return err
+	}
+	m.events.emitChanges(EventUpdated, token, changes, diffFailed)
+	return nil
 }
 
 //EndSession deletes the session state associated with the token.
@@ -142,5 +521,252 @@ func (m *manager) EndSession(r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	return m.store.Delete(tk)
+	if err := m.endSession(tk); err != nil {
+		return err
+	}
+	markReplaced(r)
+	return nil
+}
+
+//endSession ends the session associated with the verified token
+func (m *manager) endSession(tk Token) error {
+	if m.devices != nil {
+		//remove the session's device from the registry, unless
+		//the device has since signed in with another session
+		if env, err := m.getEnvelope(tk); err == nil && len(env.DeviceID) > 0 {
+			m.devices.Unregister(env.UserID, env.DeviceID, tk.ID().String())
+		}
+	}
+	if err := m.store.Delete(tk); err != nil {
+		return err
+	}
+	if m.activity != nil {
+		//the log is no longer needed once the session has ended
+		m.activity.Delete(tk.ID().String())
+	}
+	m.events.emit(EventEnded, tk)
+	return nil
+}
+
+//GetOrBeginSession resumes the session associated with the request, populating
+//initState from the Store. If the request has no valid session, a new one is
+//begun with initState as its state. Since initState may be populated from the
+//Store, it must be passed by reference. If the session couldn't be checked
+//because the store failed, the *StoreError is returned, and no session is
+//begun, so that an outage doesn't replace every user's session.
+func (m *manager) GetOrBeginSession(w http.ResponseWriter, r *http.Request, initState interface{}) (Token, error) {
+	tk, err := m.GetState(r, initState)
+	if err == nil {
+		return tk, nil
+	}
+	if _, ok := err.(*StoreError); ok {
+		return nil, err
+	}
+	return m.BeginRequestSession(w, r, initState)
+}
+
+//Healthy returns an error if the session infrastructure is not reachable.
+//If the Store implements Pinger, it is pinged; otherwise the Store is
+//assumed to be healthy. Use this in readiness probes.
+func (m *manager) Healthy(ctx context.Context) error {
+	return ping(ctx, m.store)
+}
+
+//Subscribe registers fn to receive session lifecycle events, such as
+//sessions being created and ended, and returns a function that cancels
+//the subscription. Events are delivered synchronously on the goroutine
+//handling the request, so fn should return quickly, handing off any
+//slow work, like notifying clients over WebSockets, to another goroutine.
+func (m *manager) Subscribe(fn func(Event)) func() {
+	return m.events.subscribe(fn)
+}
+
+//resume populates sessionState for the token from the store, applies the
+//manager's policies to the request resuming the session, and records the
+//access. Errors from the store are returned as-is, so callers can detect
+//ErrStateNotFound.
+func (m *manager) resume(r *http.Request, token Token, sessionState interface{}) error {
+	_, err := m.resumeEnvelope(r, token, sessionState, false)
+	return err
+}
+
+//resumeEnvelope is like resume, but also returns the session's envelope,
+//or nil if the manager doesn't use envelopes. If pending is true, only
+//pre-sessions may be resumed, and if it's false, only full sessions.
+func (m *manager) resumeEnvelope(r *http.Request, token Token, sessionState interface{}, pending bool) (*envelope, error) {
+	env, err := m.getState(token, sessionState)
+	if err != nil {
+		return nil, err
+	}
+	if isPending := env != nil && env.Pending; isPending != pending {
+		if isPending {
+			return nil, ErrSessionPending
+		}
+		return nil, ErrNotPreSession
+	}
+	if err := m.checkPolicy(r, token, env); err != nil {
+		return nil, err
+	}
+	m.recordActivity(r, token)
+	m.events.emit(EventAccessed, token)
+	return env, nil
+}
+
+//usesEnvelope reports whether the manager's options require
+//session state to be wrapped in an envelope
+func (m *manager) usesEnvelope() bool {
+	return m.maxLifetime > 0 || m.sessionExpiry || m.epochs != nil ||
+		m.devices != nil || len(m.enrichers) > 0 || len(m.codecs) > 0 ||
+		m.schemaVersion > 0 || m.roles || m.preSessionTTL > 0 || m.stateDiffs
+}
+
+//saveState saves sessionState to the store, wrapped in env
+//if the manager uses envelopes
+func (m *manager) saveState(token Token, sessionState interface{}, env *envelope) error {
+	value, err := m.storedState(token, sessionState, env)
+	if err != nil {
+		return err
+	}
+	return m.store.Save(token, value)
+}
+
+//storedState returns the value to save to the store for sessionState,
+//which is env with sessionState encoded into it if the manager uses
+//envelopes, or sessionState itself if it doesn't
+func (m *manager) storedState(token Token, sessionState interface{}, env *envelope) (interface{}, error) {
+	if !m.usesEnvelope() {
+		return sessionState, nil
+	}
+	if ui, ok := sessionState.(UserIdentifier); ok {
+		env.UserID = ui.SessionUserID()
+	}
+	if m.roles {
+		env.setRoles(sessionState)
+	}
+	if m.devices != nil {
+		var err error
+		if env.DeviceID, err = m.registerDevice(token, sessionState); err != nil {
+			return nil, err
+		}
+	}
+	if err := env.setState(sessionState, m.codecFor(sessionState)); err != nil {
+		return nil, err
+	}
+	env.Version = m.schemaVersion
+	return env, nil
+}
+
+//getState populates sessionState from the store, unwrapping it from
+//its envelope if the manager uses envelopes. The envelope is returned,
+//or nil if the manager doesn't use envelopes.
+func (m *manager) getState(token Token, sessionState interface{}) (*envelope, error) {
+	return m.readState(token, sessionState, false)
+}
+
+//readState is like getState, but if peek is true, the state is read
+//using the store's Peek method, so that its expiry time isn't reset,
+//and the session's device isn't marked as recently seen. The store
+//must implement Peeker if peek is true.
+func (m *manager) readState(token Token, sessionState interface{}, peek bool) (*envelope, error) {
+	get := m.store.Get
+	if peek {
+		get = m.store.(Peeker).Peek
+	}
+	if err := m.checkRevoked(token); err != nil {
+		return nil, err
+	}
+	if !m.usesEnvelope() {
+		return nil, get(token, sessionState)
+	}
+	env, err := m.readEnvelope(token, get)
+	if err != nil {
+		return nil, err
+	}
+	if m.devices != nil && len(env.DeviceID) > 0 && !peek {
+		//the last seen time is best-effort, so a registry
+		//outage shouldn't prevent the session being resumed
+		m.devices.Touch(env.UserID, env.DeviceID, time.Now())
+	}
+	//a nil sessionState means the caller only needs the envelope
+	if sessionState == nil {
+		return env, nil
+	}
+	if err := m.migrate(env); err != nil {
+		return nil, err
+	}
+	return env, env.getState(sessionState, m.codecFor(sessionState))
+}
+
+//tokenFromID reconstructs a Token from the string version of its session
+//ID. The token is signed with one of the manager's keys, which may not be
+//the key the original token was signed with, so it is suitable only for
+//identifying the session, and not for returning to the client.
+func (m *manager) tokenFromID(sessionID string) (Token, error) {
+	key, err := m.keys.random()
+	if err != nil {
+		return nil, err
+	}
+	to := newTokenOptions(m.tokenOpts)
+	buf, err := to.idEnc().DecodeString(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding session ID: %v", err)
+	}
+	tk := &token{buf: buf, enc: to.encoding, idEnc: to.idEncoding}
+	tk.signWith(key)
+	return tk, nil
+}
+
+//getEnvelope gets the envelope from the store, enforcing the
+//manager's policies on the session's metadata
+func (m *manager) getEnvelope(token Token) (*envelope, error) {
+	return m.readEnvelope(token, m.store.Get)
+}
+
+//readEnvelope is like getEnvelope, but reads the envelope using get
+func (m *manager) readEnvelope(token Token, get func(Token, interface{}) error) (*envelope, error) {
+	env := &envelope{}
+	if err := get(token, env); err != nil {
+		return nil, err
+	}
+	if m.maxLifetime > 0 && time.Since(env.Created) > m.maxLifetime {
+		//the session can never be used again, so remove its state
+		m.store.Delete(token)
+		return nil, ErrSessionTooOld
+	}
+	if !env.Expires.IsZero() && time.Now().After(env.Expires) {
+		m.store.Delete(token)
+		return nil, ErrSessionExpired
+	}
+	if err := m.checkEpoch(env); err != nil {
+		if err == ErrSessionRevoked {
+			m.store.Delete(token)
+		}
+		return nil, err
+	}
+	return env, nil
+}
+
+//getStateError classifies an error from getState, returning ErrSessionNotFound
+//if the store has no state for the session, ErrSessionInvalid if the state
+//couldn't be decoded, the error itself if it is one of the errors returned
+//when enforcing policies or has already been classified, or a *StoreError
+//otherwise
+func getStateError(err error) error {
+	switch err {
+	case ErrSessionTooOld, ErrSessionExpired, ErrSessionRevoked, ErrSessionRejected,
+		ErrSessionPending, ErrNotPreSession, ErrSessionNotFound, ErrSessionInvalid:
+		return err
+	case ErrStateNotFound:
+		return ErrSessionNotFound
+	}
+	switch err.(type) {
+	case *CodecError:
+		return ErrSessionInvalid
+	case *StoreError:
+		return err
+	}
+	if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return &StoreError{Kind: ErrStoreTimeout, Err: err}
+	}
+	return &StoreError{Kind: ErrStoreUnavailable, Err: err}
 }
@@ -2,16 +2,23 @@ package sessions
 
 import (
 	"bytes"
-	"crypto/rand"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type mockStore struct {
+	mx           sync.Mutex
 	entries      map[string][]byte
 	triggerError bool
 }
@@ -24,6 +31,8 @@ func newMockStore(triggerError bool) *mockStore {
 }
 
 func (ms *mockStore) Save(token Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
 	if ms.triggerError {
 		return fmt.Errorf("test error")
 	}
@@ -36,12 +45,14 @@ func (ms *mockStore) Save(token Token, sessionState interface{}) error {
 }
 
 func (ms *mockStore) Get(token Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
 	if ms.triggerError {
 		return fmt.Errorf("test error")
 	}
 	val, found := ms.entries[token.ID().String()]
 	if !found {
-		return errors.New("no data found")
+		return ErrStateNotFound
 	}
 	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState); err != nil {
 		return err
@@ -50,6 +61,8 @@ func (ms *mockStore) Get(token Token, sessionState interface{}) error {
 }
 
 func (ms *mockStore) Delete(token Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
 	if ms.triggerError {
 		return fmt.Errorf("test error")
 	}
@@ -57,6 +70,13 @@ func (ms *mockStore) Delete(token Token) error {
 	return nil
 }
 
+func (ms *mockStore) Ping(ctx context.Context) error {
+	if ms.triggerError {
+		return fmt.Errorf("test error")
+	}
+	return nil
+}
+
 func TestManagerBeginSession(t *testing.T) {
 	store := newMockStore(false)
 	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
@@ -87,11 +107,10 @@ func TestManagerBeginSession(t *testing.T) {
 
 	//trigger an error while generating the new token and ensure we get it
 	store.triggerError = false
-	randReader = &errorReader{}
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithTokenOptions(WithRand(&errorReader{})))
 	if _, err := mgr.BeginSession(respRec, state); err == nil {
 		t.Error("did not get expected error when beginning session with error rand reader")
 	}
-	randReader = rand.Reader
 }
 
 func TestManagerGetState(t *testing.T) {
@@ -257,3 +276,417 @@ func TestManagerEndSession(t *testing.T) {
 		t.Error("did nto receive triggered error from store")
 	}
 }
+
+func TestManagerGetOrBeginSession(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+
+	//with no token in the request, a new session should be begun
+	respRec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	state := "initial state"
+	token, err := mgr.GetOrBeginSession(respRec, req, &state)
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	authHeader := respRec.Header().Get(headerAuthorization)
+	expectedHeader := fmt.Sprintf("%s %s", authTypeBearer, token.String())
+	if authHeader != expectedHeader {
+		t.Errorf("incorrect Authorization header in response: expected %s but got %s", expectedHeader, authHeader)
+	}
+
+	//update the state and ensure the existing session is resumed
+	if err := mgr.UpdateState(token, "updated state"); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	respRec = httptest.NewRecorder()
+	req.Header.Add(headerAuthorization, authHeader)
+	state = "initial state"
+	resumed, err := mgr.GetOrBeginSession(respRec, req, &state)
+	if err != nil {
+		t.Fatalf("unexpected error resuming session: %v", err)
+	}
+	if resumed.String() != token.String() {
+		t.Errorf("incorrect token: expected %s but got %s", token.String(), resumed.String())
+	}
+	if state != "updated state" {
+		t.Errorf("incorrect state: expected %s but got %s", "updated state", state)
+	}
+	if len(respRec.Header().Get(headerAuthorization)) > 0 {
+		t.Error("Authorization header added to response when resuming existing session")
+	}
+
+	//if the session state is gone, a new session should be begun
+	store.Delete(token)
+	respRec = httptest.NewRecorder()
+	newToken, err := mgr.GetOrBeginSession(respRec, req, &state)
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if newToken.String() == token.String() {
+		t.Error("expired session was resumed instead of beginning a new one")
+	}
+
+	//invalid tokens should begin a new session
+	respRec = httptest.NewRecorder()
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+token.String()+"x")
+	if _, err := mgr.GetOrBeginSession(respRec, req, &state); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if len(respRec.Header().Get(headerAuthorization)) == 0 {
+		t.Error("no new session was begun for an invalid token")
+	}
+
+	//errors from the store should be returned without beginning a new session
+	req.Header.Set(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, newToken.String()))
+	store.triggerError = true
+	respRec = httptest.NewRecorder()
+	if _, err := mgr.GetOrBeginSession(respRec, req, &state); !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("incorrect error: expected a *StoreError but got %v", err)
+	}
+	if len(respRec.Header().Get(headerAuthorization)) > 0 {
+		t.Error("new session was begun when the store failed")
+	}
+}
+
+func TestManagerTokenOptions(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithTokenOptions(WithEncoding(base64.RawURLEncoding)))
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if strings.Contains(token.String(), "=") {
+		t.Errorf("token is not raw encoded: %s", token.String())
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+
+	//a manager using the default encoding should reject the raw token
+	mgr2 := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if _, err := mgr2.GetToken(req); err == nil {
+		t.Error("did not receive expected error verifying raw token with default encoding")
+	}
+}
+
+func TestManagerHealthy(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if err := mgr.Healthy(context.Background()); err != nil {
+		t.Errorf("unexpected error from healthy store: %v", err)
+	}
+	store.triggerError = true
+	if err := mgr.Healthy(context.Background()); err == nil {
+		t.Error("did not receive expected error from unhealthy store")
+	}
+
+	//stores that don't implement Pinger are assumed to be healthy
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, struct{ Store }{store})
+	if err := mgr.Healthy(context.Background()); err != nil {
+		t.Errorf("unexpected error from store that doesn't implement Pinger: %v", err)
+	}
+}
+
+func TestManagerMaxLifetime(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithMaxLifetime(50*time.Millisecond))
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+
+	//updates should preserve the creation time
+	time.Sleep(30 * time.Millisecond)
+	if err := mgr.UpdateState(token, "updated state"); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if state != "updated state" {
+		t.Errorf("incorrect state: expected %s but got %s", "updated state", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := mgr.GetState(req, &state); err != ErrSessionTooOld {
+		t.Errorf("incorrect error: expected %v but got %v", ErrSessionTooOld, err)
+	}
+	if len(store.entries) != 0 {
+		t.Error("state for session that was too old was not deleted")
+	}
+}
+
+func TestManagerMaxTokenAge(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithMaxTokenAge(time.Hour))
+	respRec := httptest.NewRecorder()
+	tk, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+
+	//a token for the same session issued too long ago should be rejected,
+	//even though the session's state is still in the store
+	old := &token{buf: append([]byte{}, tk.(*token).buf[:DefaultIDLength+issuedAtLength]...), enc: defaultEncoding, issuedAt: true}
+	binary.BigEndian.PutUint64(old.buf[DefaultIDLength:], uint64(time.Now().Add(-2*time.Hour).Unix()))
+	old.sign(testSigningKey)
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+old.String())
+	if _, err := mgr.GetState(req, &state); err != ErrTokenTooOld {
+		t.Errorf("incorrect error: expected %v but got %v", ErrTokenTooOld, err)
+	}
+	if len(store.entries) != 1 {
+		t.Error("state for session with old token was deleted")
+	}
+	if info, err := mgr.Introspect(old.String()); err != nil || info.Active {
+		t.Errorf("incorrect introspection result for old token: expected inactive but got %+v, %v", info, err)
+	}
+	if info, err := mgr.Introspect(tk.String()); err != nil || info.ExpiresAt == 0 {
+		t.Errorf("incorrect introspection result: expected expiry time but got %+v, %v", info, err)
+	}
+
+	//tokens issued in the future, or without an issued-at time, should be rejected
+	binary.BigEndian.PutUint64(old.buf[DefaultIDLength:], uint64(time.Now().Add(time.Hour).Unix()))
+	old.buf = old.buf[:DefaultIDLength+issuedAtLength]
+	old.sign(testSigningKey)
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+old.String())
+	if _, err := mgr.GetState(req, &state); err != ErrTokenTooOld {
+		t.Errorf("incorrect error for token issued in the future: expected %v but got %v", ErrTokenTooOld, err)
+	}
+	plain, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+plain.String())
+	if _, err := mgr.GetState(req, &state); err == nil {
+		t.Error("did not receive expected error for token without issued-at time")
+	}
+}
+
+func TestManagerWithoutResponseHeader(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithoutResponseHeader())
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if len(respRec.Header().Get(headerAuthorization)) > 0 {
+		t.Error("Authorization header added to response")
+	}
+
+	//the returned token should still be usable
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, token.String()))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+}
+
+func TestManagerBeginSessionUntil(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithSessionExpiry())
+
+	cases := []struct {
+		name          string
+		expires       time.Time
+		expectedError error
+	}{
+		{"future expiry", time.Now().Add(time.Hour), nil},
+		{"no expiry", time.Time{}, nil},
+		{"past expiry", time.Now().Add(-time.Second), ErrSessionExpired},
+	}
+
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		token, err := mgr.BeginSessionUntil(respRec, "test state", c.expires)
+		if err != nil {
+			t.Errorf("case %s: unexpected error beginning session: %v", c.name, err)
+			continue
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		var state string
+		if _, err := mgr.GetState(req, &state); err != c.expectedError {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+		}
+		if c.expectedError != nil {
+			if len(store.entries) != 2 {
+				t.Errorf("case %s: expired session state was not deleted", c.name)
+			}
+			continue
+		}
+		//expiry should be preserved across updates
+		if err := mgr.UpdateState(token, "updated state"); err != nil {
+			t.Errorf("case %s: unexpected error updating state: %v", c.name, err)
+		}
+	}
+
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if _, err := mgr.BeginSessionUntil(httptest.NewRecorder(), "test state", time.Now()); err != ErrSessionExpiryDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrSessionExpiryDisabled, err)
+	}
+}
+
+func TestManagerTokenLengthLimit(t *testing.T) {
+	store := newMockStore(false)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store.Save(token, "test state")
+	attenuated, err := Attenuate(token.String(), MethodCaveat("GET"))
+	if err != nil {
+		t.Fatalf("unexpected error attenuating token: %v", err)
+	}
+
+	cases := []struct {
+		name          string
+		token         string
+		opts          []ManagerOption
+		expectedError error
+	}{
+		{"default limit", token.String(), nil, nil},
+		{"attenuated token within default limit", attenuated, nil, nil},
+		{"exceeds default limit", strings.Repeat("A", 2*(DefaultIDLength+sha256.Size)+caveatAllowance+1), nil, ErrTokenTooLong},
+		{"exceeds custom limit", token.String(), []ManagerOption{WithTokenLengthLimit(len(token.String()) - 1)}, ErrTokenTooLong},
+		{"within custom limit", token.String(), []ManagerOption{WithTokenLengthLimit(len(token.String()))}, nil},
+	}
+
+	for _, c := range cases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, c.opts...)
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, c.token))
+		if _, err := mgr.GetToken(req); err != c.expectedError {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+}
+
+func TestPeekState(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithPreSessions(time.Hour))
+	accessed := 0
+	mgr.Subscribe(func(e Event) {
+		if e.Type == EventAccessed {
+			accessed++
+		}
+	})
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+
+	time.Sleep(20 * time.Millisecond)
+	var state string
+	if _, err := mgr.PeekState(req, &state); err != nil {
+		t.Fatalf("unexpected error peeking at state: %v", err)
+	}
+	if state != "test state" {
+		t.Errorf("incorrect state: expected %s but got %s", "test state", state)
+	}
+	if ttl, _ := store.TTL(tk); ttl > time.Hour-20*time.Millisecond {
+		t.Errorf("expiry time was reset by peeking: TTL is %v", ttl)
+	}
+	if accessed != 0 {
+		t.Errorf("incorrect number of accessed events: expected 0 but got %d", accessed)
+	}
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if ttl, _ := store.TTL(tk); ttl <= time.Hour-20*time.Millisecond {
+		t.Errorf("expiry time was not reset by getting: TTL is %v", ttl)
+	}
+
+	//pre-sessions can't be peeked at, just as they can't be resumed
+	preToken, err := mgr.BeginPreSession(httptest.NewRecorder(), req, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning pre-session: %v", err)
+	}
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+preToken.String())
+	if _, err := mgr.PeekState(req, &state); err != ErrSessionPending {
+		t.Errorf("incorrect error for pre-session: expected %v but got %v", ErrSessionPending, err)
+	}
+
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	if tk, err = mgr.BeginSession(httptest.NewRecorder(), "test state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+	if _, err := mgr.PeekState(req, &state); err != ErrPeekNotSupported {
+		t.Errorf("incorrect error for store without Peek: expected %v but got %v", ErrPeekNotSupported, err)
+	}
+}
+
+func TestGetStateErrorKinds(t *testing.T) {
+	inner := newMockStore(false)
+	tk, err := NewManager(DefaultIDLength, []string{string(testSigningKey)}, inner).BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	ended, err := NewManager(DefaultIDLength, []string{string(testSigningKey)}, inner).BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	inner.Delete(ended)
+	//state of the wrong type can't be decoded
+	mem := NewMemoryStore(time.Hour)
+	invalid, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	mem.Save(invalid, 42)
+
+	cases := []struct {
+		name          string
+		store         Store
+		token         Token
+		expectedError error
+	}{
+		{"found", inner, tk, nil},
+		{"not found", inner, ended, ErrSessionNotFound},
+		{"invalid", mem, invalid, ErrSessionInvalid},
+		{"timeout", TimeoutStore(&slowStore{inner, 50 * time.Millisecond}, time.Millisecond), tk, ErrStoreTimeout},
+		{"unavailable", newMockStore(true), tk, ErrStoreUnavailable},
+	}
+	for _, c := range cases {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, c.store)
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+c.token.String())
+		var state string
+		_, err := mgr.GetState(req, &state)
+		if se, ok := err.(*StoreError); ok {
+			if se.Kind != c.expectedError || !errors.Is(err, c.expectedError) {
+				t.Errorf("case %s: incorrect error kind: expected %v but got %v", c.name, c.expectedError, se.Kind)
+			}
+			continue
+		}
+		if err != c.expectedError {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package sessions
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//DefaultMemoryStoreShards is the default number of shards in a MemoryStore
+const DefaultMemoryStoreShards = 32
+
+//memorySweepInterval is the number of saves to a shard
+//between sweeps of its expired entries
+const memorySweepInterval = 1024
+
+//MemoryStore is a Store that keeps session state in memory. Session state
+//is not shared between processes and is lost when the process exits, so
+//this is best suited to single-instance services, gateways that can afford
+//to lose sessions, and tests. To avoid contention on a single lock at high
+//request rates, sessions are spread across shards, each with its own lock.
+//
+//Set MaxEntries and/or MaxBytes to bound the memory used, so that a traffic
+//spike or a flood of new sessions can't exhaust the process's memory. When
+//a limit is exceeded, the least-recently used sessions are evicted. The
+//limits are divided evenly among the shards, so sessions may be evicted
+//slightly before the store as a whole reaches them.
+type MemoryStore struct {
+	//SessionDuration is how long session state is kept after it is
+	//last saved or read. Callers may adjust this after construction.
+	SessionDuration time.Duration
+	//MaxEntries is the maximum number of sessions kept in the store,
+	//or zero for no limit. Callers may adjust this after construction.
+	MaxEntries int
+	//MaxBytes is the maximum total size of the session IDs and encoded
+	//session states kept in the store, or zero for no limit.
+	//Callers may adjust this after construction.
+	MaxBytes   int
+	shards     []*memoryShard
+	snapshotMx sync.Mutex
+	//stopSnapshots holds the functions returned by SnapshotEvery
+	stopSnapshots []func() error
+}
+
+//memoryShard is one lock-striped partition of a MemoryStore
+type memoryShard struct {
+	mx      sync.Mutex
+	entries map[string]*memoryEntry
+	//lru orders the entries from most to least recently used
+	lru   *list.List
+	bytes int
+	saves int
+}
+
+//memoryEntry is the encoded state of one session
+type memoryEntry struct {
+	sessionID string
+	state     []byte
+	expires   time.Time
+	elem      *list.Element
+}
+
+//size returns the number of bytes the entry counts against MaxBytes
+func (entry *memoryEntry) size() int {
+	return len(entry.sessionID) + len(entry.state)
+}
+
+//NewMemoryStore constructs a new MemoryStore with DefaultMemoryStoreShards shards
+func NewMemoryStore(sessionDuration time.Duration) *MemoryStore {
+	return NewShardedMemoryStore(sessionDuration, DefaultMemoryStoreShards)
+}
+
+//NewShardedMemoryStore constructs a new MemoryStore with the given number
+//of shards. More shards reduce lock contention between concurrent requests,
+//at the cost of a little memory; the number of CPUs times four is a
+//reasonable choice for very busy processes.
+func NewShardedMemoryStore(sessionDuration time.Duration, shards int) *MemoryStore {
+	if shards < 1 {
+		shards = 1
+	}
+	ms := &MemoryStore{
+		SessionDuration: sessionDuration,
+		shards:          make([]*memoryShard, shards),
+	}
+	for i := range ms.shards {
+		ms.shards[i] = &memoryShard{
+			entries: make(map[string]*memoryEntry),
+			lru:     list.New(),
+		}
+	}
+	return ms
+}
+
+//shard returns the shard responsible for the session ID
+func (ms *MemoryStore) shard(sessionID string) *memoryShard {
+	return ms.shards[ms.shardIndex(sessionID)]
+}
+
+//shardIndex returns the index of the shard responsible for the session ID
+func (ms *MemoryStore) shardIndex(sessionID string) int {
+	return int(shardHash(sessionID) % uint64(len(ms.shards)))
+}
+
+//Save encodes the session state using the DefaultCodec and keeps it in memory,
+//evicting the least-recently used sessions if the store's limits are exceeded
+func (ms *MemoryStore) Save(token Token, sessionState interface{}) error {
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	ms.put(token.ID().String(), state, time.Now().Add(ms.SessionDuration))
+	return nil
+}
+
+//put adds the encoded session state to the store as the most
+//recently used session, replacing any existing state
+func (ms *MemoryStore) put(sessionID string, state []byte, expires time.Time) {
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	defer shard.mx.Unlock()
+	ms.putLocked(shard, sessionID, state, expires)
+}
+
+//putLocked is like put, but the caller must hold the
+//lock of the session ID's shard
+func (ms *MemoryStore) putLocked(shard *memoryShard, sessionID string, state []byte, expires time.Time) {
+	if entry, found := shard.entries[sessionID]; found {
+		shard.remove(entry)
+	}
+	entry := &memoryEntry{sessionID: sessionID, state: state, expires: expires}
+	entry.elem = shard.lru.PushFront(entry)
+	shard.entries[sessionID] = entry
+	shard.bytes += entry.size()
+	if shard.saves++; shard.saves%memorySweepInterval == 0 {
+		shard.sweep(time.Now())
+	}
+	shard.evict(perShard(ms.MaxEntries, len(ms.shards)), perShard(ms.MaxBytes, len(ms.shards)))
+}
+
+//Get decodes the session state into sessionState, and resets its expiry time.
+//If there is no state associated with the token, ErrStateNotFound is returned.
+func (ms *MemoryStore) Get(token Token, sessionState interface{}) error {
+	state, err := ms.touch(token)
+	if err != nil {
+		return err
+	}
+	return decodeState(state, sessionState)
+}
+
+//GetAndTouch decodes the session state into sessionState, and sets
+//its expiry time to ttl from now, or SessionDuration if ttl is zero
+func (ms *MemoryStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	state, err := ms.touchFor(token, ttl)
+	if err != nil {
+		return err
+	}
+	return decodeState(state, sessionState)
+}
+
+//Peek decodes the session state into sessionState, without resetting its
+//expiry time or marking it as recently used. If there is no unexpired
+//state associated with the token, ErrStateNotFound is returned.
+func (ms *MemoryStore) Peek(token Token, sessionState interface{}) error {
+	sessionID := token.ID().String()
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	entry, found := shard.entries[sessionID]
+	found = found && time.Now().Before(entry.expires)
+	shard.mx.Unlock()
+	if !found {
+		return ErrStateNotFound
+	}
+	//the encoded state is never modified, only replaced,
+	//so it's safe to decode without holding the lock
+	return decodeState(entry.state, sessionState)
+}
+
+//Delete deletes the session state
+func (ms *MemoryStore) Delete(token Token) error {
+	sessionID := token.ID().String()
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	defer shard.mx.Unlock()
+	if entry, found := shard.entries[sessionID]; found {
+		shard.remove(entry)
+	}
+	return nil
+}
+
+//Exists reports whether there is unexpired state associated with
+//the token, without resetting its expiry time
+func (ms *MemoryStore) Exists(token Token) (bool, error) {
+	sessionID := token.ID().String()
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	defer shard.mx.Unlock()
+	entry, found := shard.entries[sessionID]
+	return found && time.Now().Before(entry.expires), nil
+}
+
+//Touch resets the expiry time of the session state
+func (ms *MemoryStore) Touch(token Token) error {
+	_, err := ms.touch(token)
+	return err
+}
+
+//TTL returns the time remaining before the session state expires
+func (ms *MemoryStore) TTL(token Token) (time.Duration, error) {
+	sessionID := token.ID().String()
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	defer shard.mx.Unlock()
+	entry, found := shard.entries[sessionID]
+	if !found {
+		return 0, ErrStateNotFound
+	}
+	ttl := time.Until(entry.expires)
+	if ttl <= 0 {
+		return 0, ErrStateNotFound
+	}
+	return ttl, nil
+}
+
+//Scan calls fn with a token for each unexpired session. The shards
+//are not locked while fn runs, so fn may use the store.
+func (ms *MemoryStore) Scan(fn func(token Token) error) error {
+	for _, shard := range ms.shards {
+		now := time.Now()
+		shard.mx.Lock()
+		ids := make([]string, 0, len(shard.entries))
+		for id, entry := range shard.entries {
+			if now.Before(entry.expires) {
+				ids = append(ids, id)
+			}
+		}
+		shard.mx.Unlock()
+		for _, id := range ids {
+			if err := fn(storeToken(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Replace saves the session state for the token, and deletes the
+//replaced token's state, while holding the locks of both of their shards
+func (ms *MemoryStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	sessionID, replacedID := token.ID().String(), replaced.ID().String()
+	//always lock shards in index order, so concurrent
+	//replacements can't deadlock
+	first, second := ms.shardIndex(sessionID), ms.shardIndex(replacedID)
+	shard, replacedShard := ms.shards[first], ms.shards[second]
+	if first > second {
+		first, second = second, first
+	}
+	ms.shards[first].mx.Lock()
+	defer ms.shards[first].mx.Unlock()
+	if second != first {
+		ms.shards[second].mx.Lock()
+		defer ms.shards[second].mx.Unlock()
+	}
+	if entry, found := replacedShard.entries[replacedID]; found {
+		replacedShard.remove(entry)
+	}
+	ms.putLocked(shard, sessionID, state, time.Now().Add(ms.SessionDuration))
+	return nil
+}
+
+//Len returns the number of sessions in the store,
+//including expired sessions that haven't been removed yet
+func (ms *MemoryStore) Len() int {
+	n := 0
+	for _, shard := range ms.shards {
+		shard.mx.Lock()
+		n += len(shard.entries)
+		shard.mx.Unlock()
+	}
+	return n
+}
+
+//touch resets the expiry time of the session state, marks it as the most
+//recently used, and returns it, removing it and returning ErrStateNotFound
+//if it has expired
+func (ms *MemoryStore) touch(token Token) ([]byte, error) {
+	return ms.touchFor(token, ms.SessionDuration)
+}
+
+//touchFor is like touch, but sets the expiry time to ttl
+//from now, or SessionDuration if ttl is zero
+func (ms *MemoryStore) touchFor(token Token, ttl time.Duration) ([]byte, error) {
+	if ttl == 0 {
+		ttl = ms.SessionDuration
+	}
+	sessionID := token.ID().String()
+	now := time.Now()
+	shard := ms.shard(sessionID)
+	shard.mx.Lock()
+	defer shard.mx.Unlock()
+	entry, found := shard.entries[sessionID]
+	if !found {
+		return nil, ErrStateNotFound
+	}
+	if !now.Before(entry.expires) {
+		shard.remove(entry)
+		return nil, ErrStateNotFound
+	}
+	entry.expires = now.Add(ttl)
+	shard.lru.MoveToFront(entry.elem)
+	return entry.state, nil
+}
+
+//sweep removes expired entries from the shard. The shard must be locked.
+func (shard *memoryShard) sweep(now time.Time) {
+	for _, entry := range shard.entries {
+		if !now.Before(entry.expires) {
+			shard.remove(entry)
+		}
+	}
+}
+
+//evict removes the least-recently used entries from the shard until it
+//holds no more than maxEntries entries and maxBytes bytes, where zero
+//means no limit. The shard must be locked.
+func (shard *memoryShard) evict(maxEntries int, maxBytes int) {
+	for shard.lru.Len() > 0 &&
+		((maxEntries > 0 && len(shard.entries) > maxEntries) || (maxBytes > 0 && shard.bytes > maxBytes)) {
+		shard.remove(shard.lru.Back().Value.(*memoryEntry))
+	}
+}
+
+//remove removes the entry from the shard. The shard must be locked.
+func (shard *memoryShard) remove(entry *memoryEntry) {
+	shard.lru.Remove(entry.elem)
+	delete(shard.entries, entry.sessionID)
+	shard.bytes -= entry.size()
+}
+
+//perShard divides a store-wide limit among the shards, rounding up
+//so that a non-zero limit never becomes zero (no limit)
+func perShard(limit int, shards int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return (limit + shards - 1) / shards
+}
@@ -0,0 +1,207 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	var state string
+	if err := store.Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Get(token, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+	if exists, err := store.Exists(token); err != nil || !exists {
+		t.Errorf("incorrect result: expected true, <nil> but got %t, %v", exists, err)
+	}
+	if err := store.Touch(token); err != nil {
+		t.Errorf("unexpected error touching state: %v", err)
+	}
+	if ttl, err := store.TTL(token); err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("incorrect TTL: expected about 1h, <nil> but got %v, %v", ttl, err)
+	}
+	var ids []string
+	store.Scan(func(tk Token) error {
+		ids = append(ids, tk.ID().String())
+		return nil
+	})
+	if len(ids) != 1 || ids[0] != token.ID().String() {
+		t.Errorf("incorrect scanned IDs: %v", ids)
+	}
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("incorrect length after delete: %d", store.Len())
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewShardedMemoryStore(time.Hour, 1)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store.SessionDuration = -time.Second
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if exists, _ := store.Exists(token); exists {
+		t.Error("expired state reported as existing")
+	}
+	if _, err := store.TTL(token); err != ErrStateNotFound {
+		t.Errorf("incorrect TTL error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Touch(token); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if store.Len() != 0 {
+		t.Error("expired state was not removed")
+	}
+
+	//expired entries should be swept periodically as states are saved
+	for i := 1; i < memorySweepInterval; i++ {
+		tk, _ := NewToken(testSigningKey)
+		store.Save(tk, i)
+	}
+	if store.Len() != 0 {
+		t.Errorf("expired states were not swept: %d remaining", store.Len())
+	}
+}
+
+func TestMemoryStoreGetAndTouch(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	var state string
+	if err := store.GetAndTouch(token, &state, time.Minute); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.GetAndTouch(token, &state, time.Minute); err != nil || state != "test state" {
+		t.Errorf("incorrect result: expected %s, %v but got %s, %v", "test state", nil, state, err)
+	}
+	if ttl, _ := store.TTL(token); ttl > time.Minute {
+		t.Errorf("incorrect TTL: expected at most %v but got %v", time.Minute, ttl)
+	}
+	//a zero ttl should use the session duration
+	if err := store.GetAndTouch(token, &state, 0); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if ttl, _ := store.TTL(token); ttl <= time.Minute {
+		t.Errorf("incorrect TTL: expected about %v but got %v", time.Hour, ttl)
+	}
+}
+
+//benchmarkMemoryStore measures concurrent gets and saves
+//against a MemoryStore with the given number of shards
+func benchmarkMemoryStore(b *testing.B, shards int) {
+	store := NewShardedMemoryStore(time.Hour, shards)
+	tokens := make([]Token, 1024)
+	for i := range tokens {
+		tokens[i], _ = NewToken(testSigningKey)
+		store.Save(tokens[i], i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var state, i int
+		for pb.Next() {
+			tk := tokens[i%len(tokens)]
+			if i%10 == 0 {
+				store.Save(tk, i)
+			} else {
+				store.Get(tk, &state)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMemoryStoreSingleLock(b *testing.B) {
+	benchmarkMemoryStore(b, 1)
+}
+
+func BenchmarkMemoryStoreSharded(b *testing.B) {
+	benchmarkMemoryStore(b, DefaultMemoryStoreShards)
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	newTokens := func(n int) []Token {
+		tokens := make([]Token, n)
+		for i := range tokens {
+			tokens[i], _ = NewToken(testSigningKey)
+		}
+		return tokens
+	}
+	state := "0123456789"
+	entrySize := len(newTokens(1)[0].ID().String()) + len(mustEncodeState(t, state))
+
+	cases := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int
+		expected   int
+	}{
+		{"no limits", 0, 0, 5},
+		{"max entries", 3, 0, 3},
+		{"max bytes", 0, entrySize * 2, 2},
+		{"max bytes below one entry", 0, entrySize - 1, 0},
+		{"both limits", 4, entrySize * 3, 3},
+	}
+
+	for _, c := range cases {
+		store := NewShardedMemoryStore(time.Hour, 1)
+		store.MaxEntries = c.maxEntries
+		store.MaxBytes = c.maxBytes
+		tokens := newTokens(5)
+		for i, tk := range tokens {
+			if err := store.Save(tk, state); err != nil {
+				t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+			}
+			//touch the first token so that it is the most recently used
+			if i > 0 {
+				store.Touch(tokens[0])
+			}
+		}
+		if store.Len() != c.expected {
+			t.Errorf("case %s: incorrect length: expected %d but got %d", c.name, c.expected, store.Len())
+		}
+		if c.expected > 0 {
+			if exists, _ := store.Exists(tokens[0]); !exists {
+				t.Errorf("case %s: most recently used session was evicted", c.name)
+			}
+		}
+	}
+
+	//replacing state should not count the session twice
+	store := NewShardedMemoryStore(time.Hour, 1)
+	store.MaxBytes = entrySize
+	tk := newTokens(1)[0]
+	store.Save(tk, state)
+	store.Save(tk, state)
+	if exists, _ := store.Exists(tk); !exists {
+		t.Error("session evicted after saving the same size state")
+	}
+}
+
+func mustEncodeState(t *testing.T, state interface{}) []byte {
+	buf, err := encodeState(state)
+	if err != nil {
+		t.Fatalf("unexpected error encoding state: %v", err)
+	}
+	return buf
+}
@@ -0,0 +1,137 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+//MemoryDebugOptions controls MemoryStore.DebugHandler
+type MemoryDebugOptions struct {
+	//Enabled must be true for the handler to list any sessions. Otherwise,
+	//it responds to every request with 404 Not Found, so that the handler
+	//reveals nothing if it's accidentally left mounted in production.
+	//Set this from a development-only flag or environment variable.
+	Enabled bool
+	//NewState returns a pointer to a new, empty session state, into which
+	//each session's state is decoded so that it can be rendered as JSON.
+	//If nil, or if a session's state can't be decoded into it, the
+	//encoded state is shown instead.
+	NewState func() interface{}
+}
+
+//MemoryDebugSession describes one session listed by MemoryStore.DebugHandler
+type MemoryDebugSession struct {
+	//ID is the session ID
+	ID string `json:"id"`
+	//TTL is the number of seconds until the session's state expires
+	TTL float64 `json:"ttl_seconds"`
+	//Size is the size in bytes of the encoded state
+	Size int `json:"size"`
+	//Metadata holds the metadata the Manager keeps alongside the state
+	//when it uses options that require it, such as WithMaxLifetime
+	Metadata *MemoryDebugMetadata `json:"metadata,omitempty"`
+	//State is the decoded session state
+	State interface{} `json:"state,omitempty"`
+	//Encoded is the encoded session state, if it couldn't be decoded
+	Encoded []byte `json:"encoded,omitempty"`
+	//Error is the error decoding the state, if any
+	Error string `json:"error,omitempty"`
+}
+
+//MemoryDebugMetadata is the metadata the Manager keeps alongside session state
+type MemoryDebugMetadata struct {
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires,omitempty"`
+	UserID   string    `json:"user_id,omitempty"`
+	DeviceID string    `json:"device_id,omitempty"`
+	Roles    []string  `json:"roles,omitempty"`
+	Pending  bool      `json:"pending,omitempty"`
+	Version  int       `json:"version,omitempty"`
+}
+
+//DebugHandler returns an http.Handler that lists every unexpired session
+//in the store as JSON, with its decoded state and the time remaining
+//before it expires, for debugging session flows during local development.
+//It must be explicitly enabled using opts.Enabled. The handler performs no
+//authentication, and shows the full contents of every session, so never
+//enable it in production.
+func (ms *MemoryStore) DebugHandler(opts MemoryDebugOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !opts.Enabled {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method must be GET or HEAD", http.StatusMethodNotAllowed)
+			return
+		}
+		sessions := ms.debugSessions(opts.NewState)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(sessions)
+	})
+}
+
+//debugSessions returns a MemoryDebugSession for each unexpired
+//session in the store, sorted by ID
+func (ms *MemoryStore) debugSessions(newState func() interface{}) []*MemoryDebugSession {
+	sessions := []*MemoryDebugSession{}
+	states := map[string][]byte{}
+	now := time.Now()
+	for _, shard := range ms.shards {
+		shard.mx.Lock()
+		for id, entry := range shard.entries {
+			if now.Before(entry.expires) {
+				sessions = append(sessions, &MemoryDebugSession{
+					ID:   id,
+					TTL:  entry.expires.Sub(now).Seconds(),
+					Size: len(entry.state),
+				})
+				states[id] = entry.state
+			}
+		}
+		shard.mx.Unlock()
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+
+	//the encoded states are never modified, only replaced,
+	//so it's safe to decode them without holding the locks
+	for _, s := range sessions {
+		s.decode(states[s.ID], newState)
+	}
+	return sessions
+}
+
+//decode decodes the encoded state into the session, unwrapping
+//it from the Manager's envelope if it has one
+func (s *MemoryDebugSession) decode(encoded []byte, newState func() interface{}) {
+	env := &envelope{}
+	if err := DefaultCodec.Decode(encoded, env); err == nil && !env.Created.IsZero() {
+		s.Metadata = &MemoryDebugMetadata{
+			Created:  env.Created,
+			Expires:  env.Expires,
+			UserID:   env.UserID,
+			DeviceID: env.DeviceID,
+			Roles:    env.Roles,
+			Pending:  env.Pending,
+			Version:  env.Version,
+		}
+		encoded = env.State
+	}
+	if newState == nil {
+		s.Encoded = encoded
+		return
+	}
+	state := newState()
+	if err := DefaultCodec.Decode(encoded, state); err != nil {
+		s.Encoded = encoded
+		s.Error = err.Error()
+		return
+	}
+	s.State = state
+}
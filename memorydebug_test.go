@@ -0,0 +1,91 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreDebugHandler(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	plain, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if err := store.Save(plain, &userState{UserID: "user1"}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithMaxLifetime(time.Hour))
+	wrapped, err := mgr.BeginSession(nil, &userState{UserID: "user2"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	//the handler should reveal nothing unless enabled
+	respRec := httptest.NewRecorder()
+	store.DebugHandler(MemoryDebugOptions{}).ServeHTTP(respRec, httptest.NewRequest("GET", "/", nil))
+	if respRec.Code != http.StatusNotFound {
+		t.Errorf("incorrect status when disabled: expected %d but got %d", http.StatusNotFound, respRec.Code)
+	}
+
+	cases := []struct {
+		name          string
+		newState      func() interface{}
+		expectDecoded bool
+	}{
+		{"decoded", func() interface{} { return &userState{} }, true},
+		{"no state type", nil, false},
+		{"wrong state type", func() interface{} { return new(int) }, false},
+	}
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		handler := store.DebugHandler(MemoryDebugOptions{Enabled: true, NewState: c.newState})
+		handler.ServeHTTP(respRec, httptest.NewRequest("GET", "/", nil))
+		if respRec.Code != http.StatusOK {
+			t.Fatalf("case %s: incorrect status: expected %d but got %d", c.name, http.StatusOK, respRec.Code)
+		}
+		var sessions []struct {
+			ID       string               `json:"id"`
+			TTL      float64              `json:"ttl_seconds"`
+			Metadata *MemoryDebugMetadata `json:"metadata"`
+			State    *userState           `json:"state"`
+			Encoded  []byte               `json:"encoded"`
+		}
+		if err := json.Unmarshal(respRec.Body.Bytes(), &sessions); err != nil {
+			t.Fatalf("case %s: unexpected error decoding response: %v", c.name, err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("case %s: incorrect number of sessions: expected 2 but got %d", c.name, len(sessions))
+		}
+		for _, s := range sessions {
+			if s.TTL <= 0 || s.TTL > time.Hour.Seconds() {
+				t.Errorf("case %s: incorrect TTL: %f", c.name, s.TTL)
+			}
+			isWrapped := s.ID == wrapped.ID().String()
+			if isWrapped != (s.Metadata != nil) {
+				t.Errorf("case %s: incorrect metadata for session %s: %+v", c.name, s.ID, s.Metadata)
+			}
+			if c.expectDecoded != (s.State != nil) || c.expectDecoded == (len(s.Encoded) > 0) {
+				t.Errorf("case %s: incorrect state for session %s: %+v, %x", c.name, s.ID, s.State, s.Encoded)
+			}
+			if c.expectDecoded {
+				expected := "user1"
+				if isWrapped {
+					expected = "user2"
+				}
+				if s.State.UserID != expected {
+					t.Errorf("case %s: incorrect user ID: expected %s but got %s", c.name, expected, s.State.UserID)
+				}
+			}
+		}
+	}
+
+	respRec = httptest.NewRecorder()
+	store.DebugHandler(MemoryDebugOptions{Enabled: true}).ServeHTTP(respRec, httptest.NewRequest("POST", "/", nil))
+	if respRec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("incorrect status for POST: expected %d but got %d", http.StatusMethodNotAllowed, respRec.Code)
+	}
+}
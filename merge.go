@@ -0,0 +1,96 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+)
+
+//ErrMergeSameSession is returned from Merge when the guest
+//and authenticated tokens identify the same session
+var ErrMergeSameSession = errors.New("cannot merge a session into itself")
+
+//Replacer is implemented by stores that can save the state for one token
+//and delete the state for another in a single atomic operation, so that
+//Merge never leaves both sessions, or neither, in the store
+type Replacer interface {
+	//Replace saves sessionState for the token, and deletes
+	//the state associated with the replaced token
+	Replace(token Token, sessionState interface{}, replaced Token) error
+}
+
+//Merge merges a guest session into an authenticated session, such as when
+//a shopper with items in their cart signs in. The guest session's state is
+//read into guestState and the authenticated session's state is read into
+//authState, both of which must be passed by reference. Then merge is called,
+//which should merge guestState into authState. Finally, authState is saved
+//to the authenticated session, and the guest session is ended. If the store
+//implements Replacer, the save and the deletion are done atomically.
+//If merge returns an error, neither session is changed. Both sessions are
+//resumed, so the manager's policies apply, and pre-sessions that haven't
+//been upgraded return ErrSessionPending. If both tokens identify the same
+//session, ErrMergeSameSession is returned.
+//See MergeSessions for a type-safe version of this method.
+func (m *manager) Merge(guestToken Token, authToken Token, guestState interface{}, authState interface{}, merge func() error) error {
+	if guestToken.ID().String() == authToken.ID().String() {
+		return ErrMergeSameSession
+	}
+	if _, err := m.resumeEnvelope(nil, guestToken, guestState, false); err != nil {
+		return getStateError(err)
+	}
+	env, err := m.resumeEnvelope(nil, authToken, authState, false)
+	if err != nil {
+		return getStateError(err)
+	}
+	if err := merge(); err != nil {
+		return err
+	}
+
+	value, err := m.storedState(authToken, authState, env)
+	if err != nil {
+		return err
+	}
+	if err := m.replaceState(authToken, value, guestToken); err != nil {
+		return err
+	}
+	m.events.emit(EventUpdated, authToken)
+	m.events.emit(EventEnded, guestToken)
+	return nil
+}
+
+//MergeSessions merges a guest session with state of type G into an
+//authenticated session with state of type A, using Manager.Merge.
+//The merge function receives both states, and should merge the guest
+//state into the authenticated state. For example:
+//
+//	guestToken, err := mgr.GetToken(r)
+//	...
+//	authToken, err := mgr.BeginSession(w, &UserState{UserID: user.ID})
+//	...
+//	err = sessions.MergeSessions(mgr, guestToken, authToken, func(guest *GuestState, auth *UserState) error {
+//		auth.Cart = append(auth.Cart, guest.Cart...)
+//		return nil
+//	})
+func MergeSessions[G any, A any](m Manager, guestToken Token, authToken Token, merge func(guest *G, auth *A) error) error {
+	guest, auth := new(G), new(A)
+	return m.Merge(guestToken, authToken, guest, auth, func() error {
+		return merge(guest, auth)
+	})
+}
+
+//replaceState saves the stored state value for the token, and deletes the
+//state for the replaced token, atomically if the store implements Replacer
+func (m *manager) replaceState(token Token, value interface{}, replaced Token) error {
+	if r, ok := m.store.(Replacer); ok {
+		if err := r.Replace(token, value, replaced); err != nil {
+			return fmt.Errorf("error replacing session state: %v", err)
+		}
+		return nil
+	}
+	if err := m.store.Save(token, value); err != nil {
+		return err
+	}
+	if err := m.store.Delete(replaced); err != nil {
+		return fmt.Errorf("error deleting replaced session state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type guestCartState struct {
+	Cart []string
+}
+
+type memberState struct {
+	UserID string
+	Cart   []string
+}
+
+func TestMergeSessions(t *testing.T) {
+	srv := miniredis.RunT(t)
+	stores := map[string]Store{
+		"memory store": NewMemoryStore(time.Hour),
+		"redis store":  NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour),
+		"mock store":   newMockStore(false),
+	}
+
+	for name, store := range stores {
+		mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithMaxLifetime(time.Hour))
+		guestToken, err := mgr.BeginSession(httptest.NewRecorder(), &guestCartState{Cart: []string{"apple"}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error beginning guest session: %v", name, err)
+		}
+		authToken, err := mgr.BeginSession(httptest.NewRecorder(), &memberState{UserID: "user1", Cart: []string{"pear"}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error beginning authenticated session: %v", name, err)
+		}
+
+		//errors from the merge function should leave both sessions unchanged
+		err = MergeSessions(mgr, guestToken, authToken, func(guest *guestCartState, auth *memberState) error {
+			auth.Cart = nil
+			return fmt.Errorf("test error")
+		})
+		if err == nil {
+			t.Errorf("%s: did not receive expected error from merge function", name)
+		}
+		if exists, _ := exists(store, guestToken); !exists {
+			t.Errorf("%s: guest session was deleted after merge error", name)
+		}
+
+		err = MergeSessions(mgr, guestToken, authToken, func(guest *guestCartState, auth *memberState) error {
+			auth.Cart = append(auth.Cart, guest.Cart...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error merging sessions: %v", name, err)
+		}
+		if exists, _ := exists(store, guestToken); exists {
+			t.Errorf("%s: guest session was not deleted", name)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, authTypeBearer+" "+authToken.String())
+		merged := &memberState{}
+		if _, err := mgr.GetState(req, merged); err != nil {
+			t.Fatalf("%s: unexpected error getting merged state: %v", name, err)
+		}
+		if merged.UserID != "user1" || fmt.Sprint(merged.Cart) != "[pear apple]" {
+			t.Errorf("%s: incorrect merged state: %v", name, merged)
+		}
+
+		//merging a guest session that no longer exists should fail
+		err = MergeSessions(mgr, guestToken, authToken, func(guest *guestCartState, auth *memberState) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("%s: did not receive expected error merging ended guest session", name)
+		}
+
+		//merging a session into itself should fail without ending it
+		err = MergeSessions(mgr, authToken, authToken, func(guest *memberState, auth *memberState) error {
+			return nil
+		})
+		if err != ErrMergeSameSession {
+			t.Errorf("%s: incorrect error merging session into itself: expected %v but got %v", name, ErrMergeSameSession, err)
+		}
+		if exists, _ := exists(store, authToken); !exists {
+			t.Errorf("%s: session was deleted when merged into itself", name)
+		}
+	}
+}
+
+func TestMergePreSession(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithPreSessions(time.Minute))
+	preToken, err := mgr.BeginPreSession(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.com", nil), &memberState{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning pre-session: %v", err)
+	}
+	guestToken, err := mgr.BeginSession(httptest.NewRecorder(), &guestCartState{Cart: []string{"apple"}})
+	if err != nil {
+		t.Fatalf("unexpected error beginning guest session: %v", err)
+	}
+
+	//pre-sessions haven't completed authentication, so can't be merged into
+	err = MergeSessions(mgr, guestToken, preToken, func(guest *guestCartState, auth *memberState) error {
+		return nil
+	})
+	if err != ErrSessionPending {
+		t.Errorf("incorrect error merging into pre-session: expected %v but got %v", ErrSessionPending, err)
+	}
+	if exists, _ := exists(store, guestToken); !exists {
+		t.Error("guest session was deleted after failed merge")
+	}
+}
@@ -0,0 +1,376 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//StoreOp identifies a store operation
+type StoreOp string
+
+//Store operations reported to StoreMetrics
+const (
+	StoreOpSave        StoreOp = "save"
+	StoreOpGet         StoreOp = "get"
+	StoreOpDelete      StoreOp = "delete"
+	StoreOpPeek        StoreOp = "peek"
+	StoreOpGetAndTouch StoreOp = "get_and_touch"
+	StoreOpTouch       StoreOp = "touch"
+	StoreOpTTL         StoreOp = "ttl"
+	StoreOpExists      StoreOp = "exists"
+	StoreOpScan        StoreOp = "scan"
+	StoreOpReplace     StoreOp = "replace"
+)
+
+//StoreMetrics receives measurements of store operations.
+//Implement this to feed your metrics system of choice.
+type StoreMetrics interface {
+	//ObserveStoreOp is called after each store operation with the time it
+	//took, the size in bytes of the gob-encoded session state (0 for deletes
+	//and failed gets, or -1 if the state can't be gob-encoded), and the
+	//error returned by the store, if any.
+	ObserveStoreOp(op StoreOp, elapsed time.Duration, size int, err error)
+}
+
+//metricsStore is a Store that reports measurements of operations on an inner Store
+type metricsStore struct {
+	inner   Store
+	metrics StoreMetrics
+}
+
+//MetricsStore wraps inner with a Store that reports the latency, errors,
+//and payload size of every operation to metrics. This works with any Store
+//implementation, but note that measuring the payload size requires
+//gob-encoding the session state an extra time.
+func MetricsStore(inner Store, metrics StoreMetrics) Store {
+	return &metricsStore{
+		inner:   inner,
+		metrics: metrics,
+	}
+}
+
+//Metrics returns a decorator for use with Chain that wraps a Store using MetricsStore
+func Metrics(metrics StoreMetrics) func(Store) Store {
+	return func(s Store) Store {
+		return MetricsStore(s, metrics)
+	}
+}
+
+//Save saves the state to the inner store and reports the measurements
+func (ms *metricsStore) Save(token Token, sessionState interface{}) error {
+	return ms.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the state from the inner store and reports the measurements
+func (ms *metricsStore) Get(token Token, sessionState interface{}) error {
+	return ms.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the state from the inner store and reports the measurements
+func (ms *metricsStore) Delete(token Token) error {
+	return ms.DeleteContext(context.Background(), token)
+}
+
+//SaveContext is like Save, but respects the context
+func (ms *metricsStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	start := time.Now()
+	err := saveContext(ctx, ms.inner, token, sessionState)
+	elapsed := time.Since(start)
+	ms.metrics.ObserveStoreOp(StoreOpSave, elapsed, encodedSize(sessionState), err)
+	return err
+}
+
+//GetContext is like Get, but respects the context
+func (ms *metricsStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return ms.read(StoreOpGet, sessionState, func() error {
+		return getContext(ctx, ms.inner, token, sessionState)
+	})
+}
+
+//DeleteContext is like Delete, but respects the context
+func (ms *metricsStore) DeleteContext(ctx context.Context, token Token) error {
+	start := time.Now()
+	err := deleteContext(ctx, ms.inner, token)
+	ms.metrics.ObserveStoreOp(StoreOpDelete, time.Since(start), 0, err)
+	return err
+}
+
+//Ping pings the inner store
+func (ms *metricsStore) Ping(ctx context.Context) error {
+	return ping(ctx, ms.inner)
+}
+
+//Peek peeks at the state in the inner store and reports the measurements
+func (ms *metricsStore) Peek(token Token, sessionState interface{}) error {
+	return ms.read(StoreOpPeek, sessionState, func() error {
+		return peek(ms.inner, token, sessionState)
+	})
+}
+
+//GetAndTouch gets and touches the state in the inner store and reports the measurements
+func (ms *metricsStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return ms.read(StoreOpGetAndTouch, sessionState, func() error {
+		return getAndTouch(ms.inner, token, sessionState, ttl)
+	})
+}
+
+//Touch touches the state in the inner store and reports the measurements
+func (ms *metricsStore) Touch(token Token) error {
+	start := time.Now()
+	err := touch(ms.inner, token)
+	ms.metrics.ObserveStoreOp(StoreOpTouch, time.Since(start), 0, err)
+	return err
+}
+
+//TTL gets the TTL of the state in the inner store and reports the measurements
+func (ms *metricsStore) TTL(token Token) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := storeTTL(ms.inner, token)
+	ms.metrics.ObserveStoreOp(StoreOpTTL, time.Since(start), 0, err)
+	return ttl, err
+}
+
+//Exists checks whether the inner store has the state and reports the measurements
+func (ms *metricsStore) Exists(token Token) (bool, error) {
+	start := time.Now()
+	found, err := exists(ms.inner, token)
+	ms.metrics.ObserveStoreOp(StoreOpExists, time.Since(start), 0, err)
+	return found, err
+}
+
+//Scan scans the inner store and reports the measurements of the whole scan
+func (ms *metricsStore) Scan(fn func(token Token) error) error {
+	start := time.Now()
+	err := scan(ms.inner, fn)
+	ms.metrics.ObserveStoreOp(StoreOpScan, time.Since(start), 0, err)
+	return err
+}
+
+//Replace replaces the state in the inner store and reports the measurements
+func (ms *metricsStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	start := time.Now()
+	err := replace(ms.inner, token, sessionState, replaced)
+	ms.metrics.ObserveStoreOp(StoreOpReplace, time.Since(start), encodedSize(sessionState), err)
+	return err
+}
+
+//read performs the read operation and reports its measurements,
+//including the size of the state read, if it succeeded
+func (ms *metricsStore) read(op StoreOp, sessionState interface{}, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	size := 0
+	if err == nil {
+		size = encodedSize(sessionState)
+	}
+	ms.metrics.ObserveStoreOp(op, elapsed, size, err)
+	return err
+}
+
+//encodedSize returns the size of the encoded sessionState, or -1 if it can't be encoded
+func encodedSize(sessionState interface{}) int {
+	state, err := DefaultCodec.Encode(sessionState)
+	if err != nil {
+		return -1
+	}
+	return len(state)
+}
+
+//StoreOpStats holds aggregate measurements for a store operation
+type StoreOpStats struct {
+	//Count is the number of operations
+	Count int64
+	//Errors is the number of operations that failed,
+	//not including those that returned ErrStateNotFound
+	Errors int64
+	//NotFound is the number of operations that returned ErrStateNotFound
+	NotFound int64
+	//TotalLatency is the sum of the time taken by all operations
+	TotalLatency time.Duration
+	//TotalBytes is the sum of the known payload sizes
+	TotalBytes int64
+}
+
+//StoreStats is a simple StoreMetrics implementation that
+//aggregates measurements in memory. It is safe for concurrent use.
+type StoreStats struct {
+	mx   sync.Mutex
+	ops  map[StoreOp]*StoreOpStats
+	pool PoolStats
+}
+
+//NewStoreStats constructs a new StoreStats
+func NewStoreStats() *StoreStats {
+	return &StoreStats{
+		ops: make(map[StoreOp]*StoreOpStats),
+	}
+}
+
+//ObserveStoreOp adds the measurements to the aggregate stats for op
+func (ss *StoreStats) ObserveStoreOp(op StoreOp, elapsed time.Duration, size int, err error) {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	stats, found := ss.ops[op]
+	if !found {
+		stats = &StoreOpStats{}
+		ss.ops[op] = stats
+	}
+	stats.Count++
+	stats.TotalLatency += elapsed
+	if size > 0 {
+		stats.TotalBytes += int64(size)
+	}
+	switch {
+	case err == ErrStateNotFound:
+		stats.NotFound++
+	case err != nil:
+		stats.Errors++
+	}
+}
+
+//ObservePool records the latest statistics of
+//the store's pool, so that StoreStats is a PoolMetrics
+func (ss *StoreStats) ObservePool(stats PoolStats) {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	ss.pool = stats
+}
+
+//Pool returns the latest statistics of the store's pool
+//passed to ObservePool
+func (ss *StoreStats) Pool() PoolStats {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	return ss.pool
+}
+
+//Snapshot returns a copy of the current stats for each operation
+func (ss *StoreStats) Snapshot() map[StoreOp]StoreOpStats {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	snapshot := make(map[StoreOp]StoreOpStats, len(ss.ops))
+	for op, stats := range ss.ops {
+		snapshot[op] = *stats
+	}
+	return snapshot
+}
+
+//PoolStats holds statistics about a store's connection pool
+type PoolStats struct {
+	//ActiveCount is the number of connections in the pool,
+	//both in use and idle
+	ActiveCount int
+	//IdleCount is the number of idle connections in the pool
+	IdleCount int
+	//MaxActive is the maximum number of connections the
+	//pool allows, or zero for no limit
+	MaxActive int
+	//WaitCount is the total number of connections
+	//callers have waited for
+	WaitCount int64
+	//WaitDuration is the total time callers
+	//have waited for connections
+	WaitDuration time.Duration
+}
+
+//Exhausted reports whether every connection the pool allows is in use,
+//so that further operations must wait for a connection, or fail
+func (ps PoolStats) Exhausted() bool {
+	return ps.MaxActive > 0 && ps.ActiveCount-ps.IdleCount >= ps.MaxActive
+}
+
+//Pooler is implemented by stores backed by a connection pool
+//that can report statistics about it
+type Pooler interface {
+	//Stats returns the current statistics of the pool
+	Stats() PoolStats
+}
+
+//PoolMetrics receives statistics about a store's connection pool.
+//Implement this to feed your metrics system of choice.
+type PoolMetrics interface {
+	//ObservePool is called with the current statistics of the pool
+	ObservePool(stats PoolStats)
+}
+
+//ReportPoolStats reports the statistics of the pool to metrics every
+//interval, in the background, so that you can alert on the pool becoming
+//exhausted before requests start waiting for connections. It returns a
+//function that stops the reports, which should be called when the process
+//shuts down.
+func ReportPoolStats(pool Pooler, metrics PoolMetrics, interval time.Duration) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				metrics.ObservePool(pool.Stats())
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(done)
+		})
+		wg.Wait()
+	}
+}
+
+//KeyMetrics receives the signing keys used to verify tokens.
+//Implement this to feed your metrics system of choice.
+type KeyMetrics interface {
+	//ObserveKeyUsage is called each time a token is verified, with the
+	//index of the signing key that verified it, in the order the keys
+	//were passed to NewManager
+	ObserveKeyUsage(keyIndex int)
+}
+
+//KeyStats is a simple KeyMetrics implementation that counts the
+//tokens verified by each key in memory. It is safe for concurrent use.
+type KeyStats struct {
+	mx     sync.Mutex
+	counts map[int]int64
+	last   map[int]time.Time
+}
+
+//NewKeyStats constructs a new KeyStats
+func NewKeyStats() *KeyStats {
+	return &KeyStats{
+		counts: make(map[int]int64),
+		last:   make(map[int]time.Time),
+	}
+}
+
+//ObserveKeyUsage counts a token verified by the key at keyIndex
+func (ks *KeyStats) ObserveKeyUsage(keyIndex int) {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+	ks.counts[keyIndex]++
+	ks.last[keyIndex] = time.Now()
+}
+
+//Count returns the number of tokens verified by the key at keyIndex
+func (ks *KeyStats) Count(keyIndex int) int64 {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+	return ks.counts[keyIndex]
+}
+
+//LastUsed returns when the key at keyIndex last verified a token,
+//or the zero time if it hasn't verified any
+func (ks *KeyStats) LastUsed(keyIndex int) time.Time {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+	return ks.last[keyIndex]
+}
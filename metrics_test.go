@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsStore(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	inner := newMockStore(false)
+	stats := NewStoreStats()
+	store := Chain(inner, Metrics(stats))
+
+	state := "test state"
+	if err := store.Save(token, state); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var stateGet string
+	if err := store.Get(token, &stateGet); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if err := store.Delete(token); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Get(token, &stateGet); err != ErrStateNotFound {
+		t.Fatalf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	inner.triggerError = true
+	if err := store.Save(token, state); err == nil {
+		t.Fatal("did not receive expected error from store")
+	}
+	if err := store.Save(token, func() {}); err == nil {
+		t.Fatal("did not receive expected error from store")
+	}
+
+	size := int64(encodedSize(state))
+	expected := map[StoreOp]StoreOpStats{
+		StoreOpSave:   {Count: 3, Errors: 2, TotalBytes: 2 * size},
+		StoreOpGet:    {Count: 2, NotFound: 1, TotalBytes: size},
+		StoreOpDelete: {Count: 1},
+	}
+	snapshot := stats.Snapshot()
+	for op, exp := range expected {
+		actual := snapshot[op]
+		if actual.Count != exp.Count || actual.Errors != exp.Errors ||
+			actual.NotFound != exp.NotFound || actual.TotalBytes != exp.TotalBytes {
+			t.Errorf("incorrect stats for %s: expected %+v but got %+v", op, exp, actual)
+		}
+		if actual.TotalLatency <= 0 {
+			t.Errorf("no latency recorded for %s", op)
+		}
+	}
+	if encodedSize(func() {}) != -1 {
+		t.Error("incorrect size for un-serializable state")
+	}
+}
+
+type staticPool PoolStats
+
+func (sp staticPool) Stats() PoolStats {
+	return PoolStats(sp)
+}
+
+func TestReportPoolStats(t *testing.T) {
+	stats := NewStoreStats()
+	pool := staticPool{ActiveCount: 4, IdleCount: 0, MaxActive: 4, WaitCount: 2}
+	stop := ReportPoolStats(pool, stats, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	stop()
+	if stats.Pool() != PoolStats(pool) {
+		t.Errorf("incorrect pool stats: expected %+v but got %+v", pool, stats.Pool())
+	}
+}
+
+func TestPoolStatsExhausted(t *testing.T) {
+	cases := []struct {
+		name     string
+		stats    PoolStats
+		expected bool
+	}{
+		{"no limit", PoolStats{ActiveCount: 100}, false},
+		{"all in use", PoolStats{ActiveCount: 4, MaxActive: 4}, true},
+		{"some idle", PoolStats{ActiveCount: 4, IdleCount: 1, MaxActive: 4}, false},
+		{"below limit", PoolStats{ActiveCount: 3, MaxActive: 4}, false},
+	}
+	for _, c := range cases {
+		if exhausted := c.stats.Exhausted(); exhausted != c.expected {
+			t.Errorf("case %s: incorrect result: expected %t but got %t", c.name, c.expected, exhausted)
+		}
+	}
+}
+
+func TestManagerKeyMetrics(t *testing.T) {
+	stats := NewKeyStats()
+	mgr := NewManager(DefaultIDLength, []string{"newsigningkey", string(testSigningKey)}, newMockStore(false),
+		WithKeyMetrics(stats))
+	tk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+tk.String())
+	for i := 0; i < 2; i++ {
+		if _, err := mgr.GetToken(req); err != nil {
+			t.Fatalf("unexpected error getting token: %v", err)
+		}
+	}
+	if n := stats.Count(1); n != 2 {
+		t.Errorf("incorrect count for key 1: expected 2 but got %d", n)
+	}
+	if n := stats.Count(0); n != 0 {
+		t.Errorf("incorrect count for key 0: expected 0 but got %d", n)
+	}
+	if stats.LastUsed(1).IsZero() || !stats.LastUsed(0).IsZero() {
+		t.Errorf("incorrect last used times: %v, %v", stats.LastUsed(0), stats.LastUsed(1))
+	}
+}
@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"fmt"
+)
+
+//Migration converts encoded session state from one schema version to the
+//next. It typically decodes the state into the old version of the session
+//state struct, converts that to the new version, and encodes the result
+//using the same Codec.
+type Migration func(state []byte) ([]byte, error)
+
+//WithSchemaVersion sets the schema version recorded with newly-saved
+//session state. Increment the version when the session state struct
+//changes incompatibly, and register a Migration from the previous version
+//using WithMigration, so that live sessions remain readable after the
+//deploy. Like WithMaxLifetime, this records the version alongside the
+//session's state in the store, so sessions begun without this option are
+//not readable with it, and vice-versa. Sessions begun with this option but
+//before any version was set are version 0, so set this from the start if
+//the state struct might change later.
+func WithSchemaVersion(version int) ManagerOption {
+	return func(m *manager) {
+		if version > m.schemaVersion {
+			m.schemaVersion = version
+		}
+	}
+}
+
+//WithMigration registers a Migration from schema version from to from+1.
+//Migrations are applied in order when session state of an older version
+//is read, and the state is saved in the current version the next time it
+//is updated. If the schema version set by WithSchemaVersion is lower than
+//from+1, it is raised to from+1.
+func WithMigration(from int, migrate Migration) ManagerOption {
+	return func(m *manager) {
+		if m.migrations == nil {
+			m.migrations = make(map[int]Migration)
+		}
+		m.migrations[from] = migrate
+		WithSchemaVersion(from + 1)(m)
+	}
+}
+
+//migrate applies migrations to the envelope's state until it
+//reaches the manager's schema version
+func (m *manager) migrate(env *envelope) error {
+	if env.Version > m.schemaVersion {
+		return fmt.Errorf("session state version %d is newer than schema version %d", env.Version, m.schemaVersion)
+	}
+	for env.Version < m.schemaVersion {
+		migrate, found := m.migrations[env.Version]
+		if !found {
+			return fmt.Errorf("no migration from session state version %d", env.Version)
+		}
+		state, err := migrate(env.State)
+		if err != nil {
+			return fmt.Errorf("error migrating session state from version %d: %v", env.Version, err)
+		}
+		env.State = state
+		env.Version++
+	}
+	return nil
+}
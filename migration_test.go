@@ -0,0 +1,87 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type userStateV1 struct {
+	Name string
+}
+
+type userStateV2 struct {
+	First string
+	Last  string
+}
+
+type userStateV3 struct {
+	First string
+	Last  string
+	Admin bool
+}
+
+func TestManagerMigrations(t *testing.T) {
+	store := newMockStore(false)
+	keys := []string{string(testSigningKey)}
+	v1Mgr := NewManager(DefaultIDLength, keys, store, WithSchemaVersion(1))
+
+	respRec := httptest.NewRecorder()
+	if _, err := v1Mgr.BeginSession(respRec, &userStateV1{"Test User"}); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+
+	v1to2 := func(state []byte) ([]byte, error) {
+		v1 := &userStateV1{}
+		if err := DefaultCodec.Decode(state, v1); err != nil {
+			return nil, err
+		}
+		names := strings.SplitN(v1.Name, " ", 2)
+		return DefaultCodec.Encode(&userStateV2{names[0], names[1]})
+	}
+	v2to3 := func(state []byte) ([]byte, error) {
+		v2 := &userStateV2{}
+		if err := DefaultCodec.Decode(state, v2); err != nil {
+			return nil, err
+		}
+		return DefaultCodec.Encode(&userStateV3{First: v2.First, Last: v2.Last})
+	}
+
+	//both migrations should be applied in order
+	v3Mgr := NewManager(DefaultIDLength, keys, store, WithMigration(2, v2to3), WithMigration(1, v1to2))
+	state := &userStateV3{}
+	if _, err := v3Mgr.GetState(req, state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if state.First != "Test" || state.Last != "User" {
+		t.Errorf("incorrect migrated state: %+v", state)
+	}
+
+	//updated state should be saved with the current version
+	tk, _ := v3Mgr.GetToken(req)
+	state.Admin = true
+	if err := v3Mgr.UpdateState(tk, state); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	state = &userStateV3{}
+	if _, err := v3Mgr.GetState(req, state); err != nil || !state.Admin {
+		t.Errorf("incorrect state after update: %+v, %v", state, err)
+	}
+
+	//older managers can't read newer state, and missing
+	//migrations should be reported
+	cases := []struct {
+		name string
+		mgr  Manager
+	}{
+		{"older", v1Mgr},
+		{"missing migration", NewManager(DefaultIDLength, keys, store, WithSchemaVersion(4))},
+	}
+	for _, c := range cases {
+		if _, err := c.mgr.GetState(req, &userStateV3{}); err == nil {
+			t.Errorf("case %s: did not receive expected error", c.name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*Package natsbus provides a sessions.Bus that uses NATS core publish/subscribe,
+for environments that use NATS rather than redis for messaging:
+
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bus := natsbus.New(nc, "")
+	stop, err := tieredStore.UseBus(bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stop()
+
+Like sessions.RedisBus, delivery is best-effort: messages published while
+a subscriber is disconnected are not redelivered.
+*/
+package natsbus
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/davestearns/sessions"
+	"github.com/nats-io/nats.go"
+)
+
+//DefaultSubject is the default NATS subject used by Bus
+const DefaultSubject = "sessions.bus"
+
+//Bus is a sessions.Bus that uses NATS
+type Bus struct {
+	conn    *nats.Conn
+	subject string
+}
+
+//New constructs a new Bus that publishes to the subject,
+//or DefaultSubject if subject is empty
+func New(conn *nats.Conn, subject string) *Bus {
+	if len(subject) == 0 {
+		subject = DefaultSubject
+	}
+	return &Bus{
+		conn:    conn,
+		subject: subject,
+	}
+}
+
+//Publish publishes the message to the NATS subject
+func (b *Bus) Publish(msg sessions.BusMessage) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding bus message: %v", err)
+	}
+	if err := b.conn.Publish(b.subject, buf); err != nil {
+		return fmt.Errorf("error publishing bus message: %v", err)
+	}
+	return nil
+}
+
+//Subscribe subscribes to the NATS subject, calling fn with each message
+//on the connection's message-handling goroutine. Messages that can't be
+//decoded are ignored.
+func (b *Bus) Subscribe(fn func(msg sessions.BusMessage)) (func(), error) {
+	sub, err := b.conn.Subscribe(b.subject, func(m *nats.Msg) {
+		msg := sessions.BusMessage{}
+		if err := json.Unmarshal(m.Data, &msg); err == nil {
+			fn(msg)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to bus: %v", err)
+	}
+	//ensure the server has processed the subscription, so that
+	//messages published after Subscribe returns are received
+	if err := b.conn.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, fmt.Errorf("error subscribing to bus: %v", err)
+	}
+	return func() {
+		sub.Unsubscribe()
+	}, nil
+}
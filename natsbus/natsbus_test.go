@@ -0,0 +1,49 @@
+package natsbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davestearns/sessions"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func TestBus(t *testing.T) {
+	srv := test.RunRandClientPortServer()
+	defer srv.Shutdown()
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("unexpected error connecting to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	bus := New(nc, "")
+	msgs := make(chan sessions.BusMessage, 10)
+	stop, err := bus.Subscribe(func(msg sessions.BusMessage) { msgs <- msg })
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+
+	expected := sessions.BusMessage{Type: sessions.EventRevoked, SessionID: "test session", Origin: "test origin"}
+	if err := bus.Publish(expected); err != nil {
+		t.Fatalf("unexpected error publishing: %v", err)
+	}
+	select {
+	case msg := <-msgs:
+		if msg != expected {
+			t.Errorf("incorrect message: expected %v but got %v", expected, msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for message")
+	}
+
+	stop()
+	bus.Publish(expected)
+	nc.Flush()
+	select {
+	case msg := <-msgs:
+		t.Errorf("received message after stopping: %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
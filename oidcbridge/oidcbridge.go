@@ -0,0 +1,329 @@
+/*Package oidcbridge connects OpenID Connect login and logout flows to
+sessions managed by the github.com/davestearns/sessions package.
+
+After your OIDC client library has validated an ID token, pass its claims
+to Bridge.BeginSession to begin a session, with initial session state
+mapped from those claims. The Bridge remembers which sessions belong to
+which OIDC session, so that it can end them when the user logs out at the
+identity provider and the provider sends a back-channel logout request.
+
+This package deliberately doesn't validate tokens itself: use a dedicated
+OIDC library for that, and supply a function that validates back-channel
+logout tokens.
+*/
+package oidcbridge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/davestearns/sessions"
+)
+
+//ErrNoSubject is returned from BeginSession when the claims don't include a subject
+var ErrNoSubject = errors.New("ID token claims have no subject")
+
+//Claims are the claims from a validated ID token or logout token
+type Claims map[string]interface{}
+
+//String returns the claim with the given name if it is a string,
+//or an empty string otherwise
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+//State is the session state created by DefaultMapClaims
+type State struct {
+	//Issuer is the ID token's "iss" claim
+	Issuer string
+	//Subject is the ID token's "sub" claim
+	Subject string
+	//SessionID is the ID token's "sid" claim, if any
+	SessionID string
+	//Email is the ID token's "email" claim, if any
+	Email string
+	//Name is the ID token's "name" claim, if any
+	Name string
+}
+
+//DefaultMapClaims maps the ID token claims to a *State
+func DefaultMapClaims(claims Claims) (interface{}, error) {
+	return &State{
+		Issuer:    claims.String("iss"),
+		Subject:   claims.String("sub"),
+		SessionID: claims.String("sid"),
+		Email:     claims.String("email"),
+		Name:      claims.String("name"),
+	}, nil
+}
+
+//SessionIndex records which package sessions belong to which OIDC
+//sessions and subjects, so that they can be ended on back-channel logout.
+//The default implementation is in-memory, so if your service runs on
+//multiple hosts, supply an implementation backed by shared storage.
+type SessionIndex interface {
+	//Add associates the session token with the key
+	Add(key string, token sessions.Token) error
+	//Remove removes and returns all session tokens associated with the
+	//key, and removes those tokens from any other keys too
+	Remove(key string) ([]sessions.Token, error)
+	//Forget removes the session with the given ID from all keys,
+	//and is called by the Bridge when the session ends
+	Forget(sessionID string) error
+}
+
+//memoryIndex is an in-memory SessionIndex
+type memoryIndex struct {
+	mx      sync.Mutex
+	entries map[string][]sessions.Token
+	//keys are the keys associated with each session ID
+	keys map[string][]string
+	//exists reports whether a session still exists, if non-nil,
+	//so that expired sessions can be pruned
+	exists func(token sessions.Token) bool
+}
+
+//NewMemoryIndex constructs a new in-memory SessionIndex
+func NewMemoryIndex() SessionIndex {
+	return newMemoryIndex(nil)
+}
+
+//newMemoryIndex constructs a new in-memory SessionIndex that
+//prunes sessions for which exists returns false, if non-nil
+func newMemoryIndex(exists func(token sessions.Token) bool) *memoryIndex {
+	return &memoryIndex{
+		entries: make(map[string][]sessions.Token),
+		keys:    make(map[string][]string),
+		exists:  exists,
+	}
+}
+
+//Add associates the session token with the key, pruning
+//any sessions associated with the key that no longer exist
+func (mi *memoryIndex) Add(key string, token sessions.Token) error {
+	mi.mx.Lock()
+	defer mi.mx.Unlock()
+	if mi.exists != nil {
+		for _, tk := range mi.entries[key] {
+			if !mi.exists(tk) {
+				mi.forget(tk.ID().String())
+			}
+		}
+	}
+	id := token.ID().String()
+	mi.entries[key] = append(mi.entries[key], token)
+	mi.keys[id] = append(mi.keys[id], key)
+	return nil
+}
+
+//Remove removes and returns all session tokens associated with
+//the key, and removes those tokens from any other keys too
+func (mi *memoryIndex) Remove(key string) ([]sessions.Token, error) {
+	mi.mx.Lock()
+	defer mi.mx.Unlock()
+	tokens := mi.entries[key]
+	for _, tk := range tokens {
+		mi.forget(tk.ID().String())
+	}
+	return tokens, nil
+}
+
+//Forget removes the session from all keys
+func (mi *memoryIndex) Forget(sessionID string) error {
+	mi.mx.Lock()
+	defer mi.mx.Unlock()
+	mi.forget(sessionID)
+	return nil
+}
+
+//forget removes the session from all keys. The caller must hold mx.
+func (mi *memoryIndex) forget(sessionID string) {
+	for _, key := range mi.keys[sessionID] {
+		var remaining []sessions.Token
+		for _, tk := range mi.entries[key] {
+			if tk.ID().String() != sessionID {
+				remaining = append(remaining, tk)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(mi.entries, key)
+		} else {
+			mi.entries[key] = remaining
+		}
+	}
+	delete(mi.keys, sessionID)
+}
+
+//Bridge begins and ends package sessions in response to OIDC
+//logins and logouts
+type Bridge struct {
+	//MapClaims maps validated ID token claims to the initial session state.
+	//Defaults to DefaultMapClaims, but callers may adjust this after construction.
+	MapClaims func(claims Claims) (interface{}, error)
+	//VerifyLogoutToken validates a back-channel logout token, according
+	//to the OpenID Connect Back-Channel Logout specification, and returns
+	//its claims. This must be set to use BackChannelLogoutHandler.
+	VerifyLogoutToken func(rawToken string) (Claims, error)
+	//EndSessionEndpoint is the identity provider's end_session_endpoint.
+	//If set, LogoutHandler redirects there after ending the session.
+	EndSessionEndpoint string
+	//PostLogoutRedirectURI is the URI the identity provider
+	//should redirect to after RP-initiated logout
+	PostLogoutRedirectURI string
+	//ClientID is the client_id sent with RP-initiated logout requests
+	ClientID string
+	//Index records which sessions belong to which OIDC sessions. Defaults
+	//to an in-memory index, which prunes expired sessions if store
+	//implements sessions.Exister, but callers may adjust this after
+	//construction.
+	Index   SessionIndex
+	manager sessions.Manager
+}
+
+//New constructs a new Bridge that begins sessions using manager, and
+//revokes them using manager on back-channel logout. The store should be
+//the same store used by manager. It is used only to prune expired
+//sessions from the default Index.
+func New(manager sessions.Manager, store sessions.Store) *Bridge {
+	var exists func(token sessions.Token) bool
+	if exister, ok := store.(sessions.Exister); ok {
+		exists = func(token sessions.Token) bool {
+			//keep the session if the store can't tell
+			found, err := exister.Exists(token)
+			return found || err != nil
+		}
+	}
+	b := &Bridge{
+		MapClaims: DefaultMapClaims,
+		Index:     newMemoryIndex(exists),
+		manager:   manager,
+	}
+	//remove sessions from the index once they end
+	manager.Subscribe(b.forget)
+	return b
+}
+
+//forget removes ended and revoked sessions from the index
+func (b *Bridge) forget(evt sessions.Event) {
+	if evt.Type == sessions.EventEnded || evt.Type == sessions.EventRevoked {
+		b.Index.Forget(evt.SessionID)
+	}
+}
+
+//BeginSession begins a new session for the validated ID token claims,
+//with initial state returned by MapClaims, and returns its token.
+func (b *Bridge) BeginSession(w http.ResponseWriter, claims Claims) (sessions.Token, error) {
+	if len(claims.String("sub")) == 0 {
+		return nil, ErrNoSubject
+	}
+	state, err := b.MapClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping claims to session state: %v", err)
+	}
+	tk, err := b.manager.BeginSession(w, state)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range indexKeys(claims) {
+		if err := b.Index.Add(key, tk); err != nil {
+			return nil, fmt.Errorf("error indexing session: %v", err)
+		}
+	}
+	return tk, nil
+}
+
+//EndSessions revokes all sessions begun for the claims' OIDC session
+//("sid"), or if that claim is missing, all sessions for the claims'
+//subject ("iss" and "sub"), as required for back-channel logout. The
+//sessions are revoked using the manager's Revoke method, so they are
+//also recorded in its revocation list, if any.
+func (b *Bridge) EndSessions(claims Claims) error {
+	keys := indexKeys(claims)
+	if len(keys) == 0 {
+		return fmt.Errorf("logout claims have no sid or sub")
+	}
+	tokens, err := b.Index.Remove(keys[0])
+	if err != nil {
+		return fmt.Errorf("error removing sessions from index: %v", err)
+	}
+	for _, tk := range tokens {
+		if err := b.manager.Revoke(tk); err != nil && err != sessions.ErrStateNotFound {
+			return fmt.Errorf("error ending session: %v", err)
+		}
+	}
+	return nil
+}
+
+//LogoutHandler returns a handler for RP-initiated logout. It ends the
+//request's session, and then redirects to EndSessionEndpoint, if set,
+//so that the user is also logged out at the identity provider.
+func (b *Bridge) LogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := b.manager.EndSession(r); err != nil && err != sessions.ErrNoToken {
+			http.Error(w, "error ending session", http.StatusInternalServerError)
+			return
+		}
+		if len(b.EndSessionEndpoint) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		u, err := url.Parse(b.EndSessionEndpoint)
+		if err != nil {
+			http.Error(w, "invalid end session endpoint", http.StatusInternalServerError)
+			return
+		}
+		query := u.Query()
+		if len(b.ClientID) > 0 {
+			query.Set("client_id", b.ClientID)
+		}
+		if len(b.PostLogoutRedirectURI) > 0 {
+			query.Set("post_logout_redirect_uri", b.PostLogoutRedirectURI)
+		}
+		u.RawQuery = query.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	})
+}
+
+//BackChannelLogoutHandler returns a handler for back-channel logout
+//requests from the identity provider. The logout_token is validated
+//using VerifyLogoutToken, and the sessions it identifies are ended.
+func (b *Bridge) BackChannelLogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodPost {
+			http.Error(w, "method must be POST", http.StatusMethodNotAllowed)
+			return
+		}
+		rawToken := r.PostFormValue("logout_token")
+		if len(rawToken) == 0 || b.VerifyLogoutToken == nil {
+			http.Error(w, "missing logout_token", http.StatusBadRequest)
+			return
+		}
+		claims, err := b.VerifyLogoutToken(rawToken)
+		if err != nil {
+			http.Error(w, "invalid logout_token", http.StatusBadRequest)
+			return
+		}
+		if err := b.EndSessions(claims); err != nil {
+			http.Error(w, "error ending sessions", http.StatusBadRequest)
+			return
+		}
+	})
+}
+
+//indexKeys returns the SessionIndex keys for the claims, with the
+//most specific key first
+func indexKeys(claims Claims) []string {
+	var keys []string
+	if sid := claims.String("sid"); len(sid) > 0 {
+		keys = append(keys, "sid:"+claims.String("iss")+"|"+sid)
+	}
+	if sub := claims.String("sub"); len(sub) > 0 {
+		keys = append(keys, "sub:"+claims.String("iss")+"|"+sub)
+	}
+	return keys
+}
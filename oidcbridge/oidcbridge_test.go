@@ -0,0 +1,244 @@
+package oidcbridge
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davestearns/sessions"
+)
+
+type mapStore struct {
+	mx      sync.Mutex
+	entries map[string][]byte
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{entries: make(map[string][]byte)}
+}
+
+func (ms *mapStore) Save(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return err
+	}
+	ms.entries[token.ID().String()] = buf.Bytes()
+	return nil
+}
+
+func (ms *mapStore) Get(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	val, found := ms.entries[token.ID().String()]
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState)
+}
+
+func (ms *mapStore) Delete(token sessions.Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.entries, token.ID().String())
+	return nil
+}
+
+func (ms *mapStore) Exists(token sessions.Token) (bool, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	_, found := ms.entries[token.ID().String()]
+	return found, nil
+}
+
+func newTestBridge() (*Bridge, sessions.Manager, *mapStore) {
+	store := newMapStore()
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, store)
+	return New(mgr, store), mgr, store
+}
+
+func TestBeginSession(t *testing.T) {
+	bridge, mgr, _ := newTestBridge()
+	respRec := httptest.NewRecorder()
+	claims := Claims{"iss": "https://idp.example.com", "sub": "user1", "sid": "s1", "email": "user1@example.com"}
+	if _, err := bridge.BeginSession(respRec, claims); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+	state := &State{}
+	if _, err := mgr.GetState(req, state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	expected := State{Issuer: "https://idp.example.com", Subject: "user1", SessionID: "s1", Email: "user1@example.com"}
+	if *state != expected {
+		t.Errorf("incorrect state: expected %v but got %v", expected, *state)
+	}
+
+	if _, err := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "https://idp.example.com"}); err != ErrNoSubject {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoSubject, err)
+	}
+
+	bridge.MapClaims = func(claims Claims) (interface{}, error) {
+		return nil, fmt.Errorf("test error")
+	}
+	if _, err := bridge.BeginSession(httptest.NewRecorder(), claims); err == nil {
+		t.Error("did not receive expected error from MapClaims")
+	}
+}
+
+func TestBackChannelLogout(t *testing.T) {
+	bridge, _, store := newTestBridge()
+	bridge.VerifyLogoutToken = func(rawToken string) (Claims, error) {
+		switch rawToken {
+		case "sid1":
+			return Claims{"iss": "idp", "sid": "s1"}, nil
+		case "user2":
+			return Claims{"iss": "idp", "sub": "user2"}, nil
+		}
+		return nil, fmt.Errorf("invalid token")
+	}
+	tk1, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1", "sid": "s1"})
+	tk2, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1", "sid": "s2"})
+	tk3, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user2", "sid": "s3"})
+	tk4, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user2"})
+
+	cases := []struct {
+		name           string
+		method         string
+		logoutToken    string
+		expectedStatus int
+		ended          []sessions.Token
+		remaining      []sessions.Token
+	}{
+		{"wrong method", "GET", "sid1", http.StatusMethodNotAllowed, nil, []sessions.Token{tk1}},
+		{"missing token", "POST", "", http.StatusBadRequest, nil, []sessions.Token{tk1}},
+		{"invalid token", "POST", "invalid", http.StatusBadRequest, nil, []sessions.Token{tk1}},
+		{"logout by sid", "POST", "sid1", http.StatusOK, []sessions.Token{tk1}, []sessions.Token{tk2, tk3}},
+		{"logout by sub", "POST", "user2", http.StatusOK, []sessions.Token{tk3, tk4}, []sessions.Token{tk2}},
+	}
+
+	for _, c := range cases {
+		form := url.Values{}
+		if len(c.logoutToken) > 0 {
+			form.Set("logout_token", c.logoutToken)
+		}
+		req := httptest.NewRequest(c.method, "http://example.com/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		respRec := httptest.NewRecorder()
+		bridge.BackChannelLogoutHandler().ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status code: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+		if respRec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("case %s: response not marked no-store", c.name)
+		}
+		for _, tk := range c.ended {
+			if _, found := store.entries[tk.ID().String()]; found {
+				t.Errorf("case %s: session was not ended", c.name)
+			}
+		}
+		for _, tk := range c.remaining {
+			if _, found := store.entries[tk.ID().String()]; !found {
+				t.Errorf("case %s: session was incorrectly ended", c.name)
+			}
+		}
+	}
+}
+
+func TestBackChannelLogoutRevokes(t *testing.T) {
+	store := newMapStore()
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, store,
+		sessions.WithRevocationList(sessions.NewMemoryRevocationList()))
+	bridge := New(mgr, store)
+	respRec := httptest.NewRecorder()
+	tk, _ := bridge.BeginSession(respRec, Claims{"iss": "idp", "sub": "user1", "sid": "s1"})
+	saved := store.entries[tk.ID().String()]
+	if err := bridge.EndSessions(Claims{"iss": "idp", "sid": "s1"}); err != nil {
+		t.Fatalf("unexpected error ending sessions: %v", err)
+	}
+
+	//the session should stay ended even if its state reappears
+	store.entries[tk.ID().String()] = saved
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+	if _, err := mgr.GetState(req, &State{}); err != sessions.ErrSessionRevoked {
+		t.Errorf("incorrect error: expected %v but got %v", sessions.ErrSessionRevoked, err)
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	bridge, mgr, store := newTestBridge()
+	index := bridge.Index.(*memoryIndex)
+	tk1, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1", "sid": "s1"})
+	respRec := httptest.NewRecorder()
+	tk2, _ := bridge.BeginSession(respRec, Claims{"iss": "idp", "sub": "user1", "sid": "s2"})
+	tk3, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1", "sid": "s3"})
+
+	//removing by sid should remove the session from the sub key too
+	if tokens, _ := index.Remove("sid:idp|s1"); len(tokens) != 1 || tokens[0].ID().String() != tk1.ID().String() {
+		t.Errorf("incorrect tokens removed: %v", tokens)
+	}
+	if len(index.entries["sub:idp|user1"]) != 2 || len(index.keys) != 2 {
+		t.Errorf("removed session remains in index: %v", index.entries)
+	}
+
+	//ending a session should remove it from the index
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	if _, found := index.entries["sid:idp|s2"]; found || len(index.entries["sub:idp|user1"]) != 1 {
+		t.Errorf("ended session %s remains in index: %v", tk2.ID(), index.entries)
+	}
+
+	//sessions that no longer exist in the store should be pruned
+	delete(store.entries, tk3.ID().String())
+	tk4, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1"})
+	if tokens := index.entries["sub:idp|user1"]; len(tokens) != 1 || tokens[0].ID().String() != tk4.ID().String() {
+		t.Errorf("expired session was not pruned: %v", tokens)
+	}
+	if _, found := index.entries["sid:idp|s3"]; found || len(index.keys) != 1 {
+		t.Errorf("expired session remains in index: %v", index.entries)
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	bridge, _, store := newTestBridge()
+	bridge.EndSessionEndpoint = "https://idp.example.com/logout"
+	bridge.ClientID = "client1"
+	bridge.PostLogoutRedirectURI = "https://example.com/"
+	tk, _ := bridge.BeginSession(httptest.NewRecorder(), Claims{"iss": "idp", "sub": "user1"})
+
+	req := httptest.NewRequest("GET", "http://example.com/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tk.String())
+	respRec := httptest.NewRecorder()
+	bridge.LogoutHandler().ServeHTTP(respRec, req)
+	if respRec.Code != http.StatusFound {
+		t.Errorf("incorrect status code: expected %d but got %d", http.StatusFound, respRec.Code)
+	}
+	expectedLocation := "https://idp.example.com/logout?client_id=client1&post_logout_redirect_uri=https%3A%2F%2Fexample.com%2F"
+	if loc := respRec.Header().Get("Location"); loc != expectedLocation {
+		t.Errorf("incorrect redirect: expected %s but got %s", expectedLocation, loc)
+	}
+	if len(store.entries) != 0 {
+		t.Error("session was not ended")
+	}
+
+	//without an end session endpoint, there should be no redirect
+	bridge.EndSessionEndpoint = ""
+	respRec = httptest.NewRecorder()
+	bridge.LogoutHandler().ServeHTTP(respRec, httptest.NewRequest("GET", "http://example.com/logout", nil))
+	if respRec.Code != http.StatusNoContent {
+		t.Errorf("incorrect status code: expected %d but got %d", http.StatusNoContent, respRec.Code)
+	}
+}
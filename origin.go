@@ -0,0 +1,87 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//ErrOriginNotAllowed is returned from OriginChecker.Check when a
+//state-changing request comes from an origin that isn't allowed
+var ErrOriginNotAllowed = errors.New("request origin is not allowed")
+
+//OriginChecker rejects state-changing requests whose Origin header, or
+//Referer header if Origin is missing, isn't one of the allowed origins.
+//Browsers send these headers on cross-site requests, and scripts can't
+//forge them, so when session tokens are carried in cookies, this is a
+//second layer of CSRF protection that doesn't depend on CSRF tokens.
+type OriginChecker struct {
+	//AllowedOrigins are the allowed origins, such as
+	//"https://example.com". Callers may adjust this
+	//after construction.
+	AllowedOrigins []string
+	//AllowMissing allows requests with neither an Origin nor a Referer
+	//header, such as those from non-browser clients, or from browsers
+	//configured not to send Referer. Defaults to false.
+	AllowMissing bool
+}
+
+//NewOriginChecker constructs a new OriginChecker
+//that allows only the allowedOrigins
+func NewOriginChecker(allowedOrigins ...string) *OriginChecker {
+	return &OriginChecker{AllowedOrigins: allowedOrigins}
+}
+
+//Check returns ErrOriginNotAllowed if the request uses a state-changing
+//method, and its origin isn't allowed. Requests using safe methods
+//(GET, HEAD, OPTIONS, and TRACE) are always allowed. Requests with an
+//Origin of "null" are always rejected.
+func (oc *OriginChecker) Check(r *http.Request) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "null" {
+		//opaque origins, such as sandboxed iframes and some
+		//redirects, are never allowed, whatever the Referer says
+		return ErrOriginNotAllowed
+	}
+	if len(origin) == 0 {
+		origin = refererOrigin(r.Header.Get("Referer"))
+	}
+	if len(origin) == 0 {
+		if oc.AllowMissing {
+			return nil
+		}
+		return ErrOriginNotAllowed
+	}
+	for _, allowed := range oc.AllowedOrigins {
+		if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			return nil
+		}
+	}
+	return ErrOriginNotAllowed
+}
+
+//Protect returns middleware that responds with 403 Forbidden
+//to requests rejected by Check, and otherwise calls next
+func (oc *OriginChecker) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := oc.Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//refererOrigin returns the origin of the referer URL,
+//or an empty string if it isn't an absolute URL
+func refererOrigin(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,54 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginChecker(t *testing.T) {
+	checker := NewOriginChecker("https://example.com", "https://app.example.com/")
+	handler := checker.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name           string
+		method         string
+		origin         string
+		referer        string
+		allowMissing   bool
+		expectedStatus int
+	}{
+		{"allowed origin", "POST", "https://example.com", "", false, http.StatusNoContent},
+		{"allowed origin with trailing slash in allowlist", "POST", "https://app.example.com", "", false, http.StatusNoContent},
+		{"allowed origin different case", "POST", "https://EXAMPLE.com", "", false, http.StatusNoContent},
+		{"disallowed origin", "POST", "https://evil.com", "", false, http.StatusForbidden},
+		{"disallowed scheme", "POST", "http://example.com", "", false, http.StatusForbidden},
+		{"disallowed port", "POST", "https://example.com:8443", "", false, http.StatusForbidden},
+		{"allowed referer", "PUT", "", "https://example.com/some/page?q=1", false, http.StatusNoContent},
+		{"disallowed referer", "PUT", "", "https://evil.com/https://example.com", false, http.StatusForbidden},
+		{"null origin with allowed referer", "DELETE", "null", "https://example.com/", false, http.StatusForbidden},
+		{"null origin without referer", "DELETE", "null", "", true, http.StatusForbidden},
+		{"origin takes precedence over referer", "POST", "https://evil.com", "https://example.com/", false, http.StatusForbidden},
+		{"missing both", "POST", "", "", false, http.StatusForbidden},
+		{"missing both allowed", "POST", "", "", true, http.StatusNoContent},
+		{"relative referer", "POST", "", "/some/page", false, http.StatusForbidden},
+		{"safe method", "GET", "https://evil.com", "", false, http.StatusNoContent},
+	}
+	for _, c := range cases {
+		checker.AllowMissing = c.allowMissing
+		req := httptest.NewRequest(c.method, "http://example.com", nil)
+		if len(c.origin) > 0 {
+			req.Header.Set("Origin", c.origin)
+		}
+		if len(c.referer) > 0 {
+			req.Header.Set("Referer", c.referer)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+	}
+}
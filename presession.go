@@ -0,0 +1,118 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+//ErrSessionPending is returned from GetState and other methods that
+//resume full sessions when the session is a pre-session begun by
+//BeginPreSession, which hasn't completed authentication yet
+var ErrSessionPending = errors.New("session is pending completion of authentication")
+
+//ErrNotPreSession is returned from GetPreSessionState and UpgradeSession
+//when the session is a full session, rather than a pre-session
+var ErrNotPreSession = errors.New("session is not a pre-session")
+
+//ErrPreSessionsDisabled is returned from BeginPreSession when
+//the manager was not constructed WithPreSessions
+var ErrPreSessionsDisabled = errors.New("pre-sessions are not enabled")
+
+//WithPreSessions enables pre-sessions, which are restricted sessions for
+//users who have partially authenticated, such as by entering a correct
+//password, but haven't completed authentication, such as by entering a
+//one-time code. Pre-sessions expire ttl after they begin, and can't be
+//resumed by GetState, Require, or any other method that resumes full
+//sessions, which return ErrSessionPending instead. Use GetPreSessionState
+//and RequirePreSession in the handlers that complete authentication, and
+//UpgradeSession once it's complete. Like WithMaxLifetime, this records the
+//session's stage alongside its state in the store, so sessions begun
+//without this option are not readable with it, and vice-versa.
+func WithPreSessions(ttl time.Duration) ManagerOption {
+	return func(m *manager) {
+		m.preSessionTTL = ttl
+	}
+}
+
+//BeginPreSession begins a new pre-session, saving the provided sessionState
+//to the store. The pre-session expires after the ttl passed to
+//WithPreSessions, after which GetPreSessionState returns ErrSessionExpired.
+func (m *manager) BeginPreSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error) {
+	if m.preSessionTTL <= 0 {
+		return nil, ErrPreSessionsDisabled
+	}
+	now := time.Now()
+	env := &envelope{Created: now, Expires: now.Add(m.preSessionTTL), Pending: true}
+	if len(m.enrichers) > 0 {
+		env.ClientInfo = m.enrich(r)
+	}
+	return m.beginSession(w, sessionState, env)
+}
+
+//GetPreSessionState is like GetState, but resumes only pre-sessions,
+//returning ErrNotPreSession for full sessions
+func (m *manager) GetPreSessionState(r *http.Request, sessionState interface{}) (Token, error) {
+	tk, err := m.GetToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.resumeEnvelope(r, tk, sessionState, true); err != nil {
+		return nil, getStateError(err)
+	}
+	return tk, nil
+}
+
+//UpgradeSession upgrades the request's pre-session to a full session with
+//the provided sessionState, once the user has completed authentication.
+//The full session gets a new token, which is added to the response, and
+//the pre-session is ended, so that a token captured before authentication
+//was completed can never be used as a full session. If the store implements
+//Replacer, the new session is saved and the pre-session is deleted
+//atomically, so a pre-session can be upgraded only once. Full sessions
+//can't be downgraded to pre-sessions.
+func (m *manager) UpgradeSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error) {
+	preToken, err := m.GetToken(r)
+	if err != nil {
+		return nil, err
+	}
+	preEnv, err := m.resumeEnvelope(r, preToken, nil, true)
+	if err != nil {
+		return nil, getStateError(err)
+	}
+
+	key, err := m.keys.random()
+	if err != nil {
+		return nil, err
+	}
+	tk, err := NewTokenWithKey(key, m.idLength, m.tokenOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error generating new token: %v", err)
+	}
+	env := &envelope{Created: time.Now(), ClientInfo: preEnv.ClientInfo}
+	value, err := m.storedState(tk, sessionState, env)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.replaceState(tk, value, preToken); err != nil {
+		return nil, err
+	}
+	if !m.suppressHeader {
+		if err := m.transport.Write(w, tk); err != nil {
+			return nil, fmt.Errorf("error writing token to response: %v", err)
+		}
+	}
+	m.writeExpires(w, tk, env)
+	markReplaced(r)
+	m.events.emit(EventEnded, preToken)
+	m.events.emit(EventCreated, tk)
+	return tk, nil
+}
+
+//RequirePreSession is like Require, but calls next only for requests with
+//a valid pre-session, rejecting requests with full sessions. Use this for
+//the handlers that complete authentication, such as verifying one-time codes.
+func (m *manager) RequirePreSession(next http.Handler, opts RequireOptions) http.Handler {
+	return m.require(next, opts, true, nil)
+}
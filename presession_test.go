@@ -0,0 +1,141 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mfaState struct {
+	UserID string
+}
+
+func presessionRequest(tk Token) *http.Request {
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, authTypeBearer+" "+tk.String())
+	return req
+}
+
+func TestPreSessions(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithPreSessions(time.Minute))
+
+	preToken, err := mgr.BeginPreSession(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.com", nil), &mfaState{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning pre-session: %v", err)
+	}
+
+	//pre-sessions can't be resumed as full sessions
+	if _, err := mgr.GetState(presessionRequest(preToken), &mfaState{}); err != ErrSessionPending {
+		t.Errorf("incorrect error getting state of pre-session: expected %v but got %v", ErrSessionPending, err)
+	}
+	state := &mfaState{}
+	if _, err := mgr.GetPreSessionState(presessionRequest(preToken), state); err != nil {
+		t.Fatalf("unexpected error getting pre-session state: %v", err)
+	}
+	if state.UserID != "user1" {
+		t.Errorf("incorrect pre-session state: expected user1 but got %s", state.UserID)
+	}
+
+	//pre-sessions should not be reported as active by introspection
+	if info, err := mgr.Introspect(preToken.String()); err != nil || info.Active {
+		t.Errorf("incorrect introspection of pre-session: expected inactive but got %+v, %v", info, err)
+	}
+
+	//Require should reject pre-sessions, and RequirePreSession should allow them
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		name           string
+		handler        http.Handler
+		token          func() Token
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"Require with pre-session",
+			mgr.Require(ok, RequireOptions{Format: FormatJSON}),
+			func() Token { return preToken },
+			http.StatusUnauthorized,
+			RequirePendingSession,
+		},
+		{
+			"RequirePreSession with pre-session",
+			mgr.RequirePreSession(ok, RequireOptions{Format: FormatJSON}),
+			func() Token { return preToken },
+			http.StatusOK,
+			"",
+		},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		c.handler.ServeHTTP(w, presessionRequest(c.token()))
+		if w.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), c.expectedBody) {
+			t.Errorf("case %s: incorrect body: expected %q but got %q", c.name, c.expectedBody, w.Body.String())
+		}
+	}
+
+	//upgrading issues a new token for a full session, and ends the pre-session
+	w := httptest.NewRecorder()
+	fullToken, err := mgr.UpgradeSession(w, presessionRequest(preToken), &mfaState{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("unexpected error upgrading session: %v", err)
+	}
+	if fullToken.String() == preToken.String() {
+		t.Error("upgraded session has the same token as the pre-session")
+	}
+	if w.Header().Get(headerAuthorization) != authTypeBearer+" "+fullToken.String() {
+		t.Errorf("upgraded token not written to response: got %q", w.Header().Get(headerAuthorization))
+	}
+	if exists, _ := exists(store, preToken); exists {
+		t.Error("pre-session was not deleted after upgrade")
+	}
+	if _, err := mgr.GetState(presessionRequest(fullToken), &mfaState{}); err != nil {
+		t.Errorf("unexpected error getting state of upgraded session: %v", err)
+	}
+	if info, err := mgr.Introspect(fullToken.String()); err != nil || !info.Active {
+		t.Errorf("incorrect introspection of upgraded session: expected active but got %+v, %v", info, err)
+	}
+	if _, err := mgr.UpgradeSession(httptest.NewRecorder(), presessionRequest(preToken), &mfaState{}); err == nil {
+		t.Error("did not receive expected error upgrading pre-session twice")
+	}
+
+	//full sessions can't be used as pre-sessions
+	if _, err := mgr.GetPreSessionState(presessionRequest(fullToken), &mfaState{}); err != ErrNotPreSession {
+		t.Errorf("incorrect error getting pre-session state of full session: expected %v but got %v", ErrNotPreSession, err)
+	}
+	if _, err := mgr.UpgradeSession(httptest.NewRecorder(), presessionRequest(fullToken), &mfaState{}); err != ErrNotPreSession {
+		t.Errorf("incorrect error upgrading full session: expected %v but got %v", ErrNotPreSession, err)
+	}
+	w = httptest.NewRecorder()
+	mgr.RequirePreSession(ok, RequireOptions{}).ServeHTTP(w, presessionRequest(fullToken))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("incorrect status requiring pre-session with full session: expected %d but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestPreSessionExpires(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, NewMemoryStore(time.Hour), WithPreSessions(time.Millisecond))
+	preToken, err := mgr.BeginPreSession(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.com", nil), &mfaState{})
+	if err != nil {
+		t.Fatalf("unexpected error beginning pre-session: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := mgr.GetPreSessionState(presessionRequest(preToken), &mfaState{}); err != ErrSessionExpired {
+		t.Errorf("incorrect error getting expired pre-session: expected %v but got %v", ErrSessionExpired, err)
+	}
+	if _, err := mgr.UpgradeSession(httptest.NewRecorder(), presessionRequest(preToken), &mfaState{}); err == nil {
+		t.Error("did not receive expected error upgrading expired pre-session")
+	}
+}
+
+func TestPreSessionsDisabled(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, NewMemoryStore(time.Hour))
+	if _, err := mgr.BeginPreSession(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.com", nil), &mfaState{}); err != ErrPreSessionsDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrPreSessionsDisabled, err)
+	}
+}
@@ -0,0 +1,95 @@
+package sessions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+//DefaultForwardedAuthorizationHeader is the default header from which
+//TrustedProxyTransport reads tokens forwarded by a trusted proxy
+const DefaultForwardedAuthorizationHeader = "X-Forwarded-Authorization"
+
+//TrustedProxyTransport is a Transport that reads tokens from a header set
+//by a trusted proxy, for setups where the proxy consumes the original
+//Authorization header, and forwards the client's token in another header.
+//Since any client could set that header, it is read only from requests
+//whose remote address is in one of the trusted proxy networks. Tokens
+//can't be written to a header meant for proxies, so Write does nothing.
+//Combine this with a transport that writes tokens using Transports.
+type TrustedProxyTransport struct {
+	//Header reads tokens from the forwarded header. Defaults to
+	//DefaultForwardedAuthorizationHeader with the Bearer scheme,
+	//but callers may adjust this after construction.
+	Header HeaderTransport
+	//Proxies are the networks of the trusted proxies.
+	//Callers may adjust this after construction.
+	Proxies []*net.IPNet
+}
+
+//NewTrustedProxyTransport constructs a new TrustedProxyTransport that
+//trusts proxies in the networks described by the proxyCIDRs, such as
+//"10.0.0.0/8". Single addresses such as "10.1.2.3" are also accepted.
+func NewTrustedProxyTransport(proxyCIDRs ...string) (*TrustedProxyTransport, error) {
+	tpt := &TrustedProxyTransport{
+		Header: HeaderTransport{Name: DefaultForwardedAuthorizationHeader, Scheme: authTypeBearer},
+	}
+	for _, cidr := range proxyCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("error parsing trusted proxy network %q: %v", cidr, err)
+			}
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		tpt.Proxies = append(tpt.Proxies, network)
+	}
+	return tpt, nil
+}
+
+//Write does nothing, as clients never see the forwarded header
+func (tpt *TrustedProxyTransport) Write(w http.ResponseWriter, token Token) error {
+	return nil
+}
+
+//Read returns the token from the forwarded header if the request came
+//from a trusted proxy. Otherwise, ErrNoToken is returned.
+func (tpt *TrustedProxyTransport) Read(r *http.Request) (string, error) {
+	if !tpt.trusted(r) {
+		return "", ErrNoToken
+	}
+	return tpt.Header.Read(r)
+}
+
+//ReadCandidates returns the tokens from the forwarded headers if the
+//request came from a trusted proxy. Otherwise, ErrNoToken is returned.
+func (tpt *TrustedProxyTransport) ReadCandidates(r *http.Request) ([]string, error) {
+	if !tpt.trusted(r) {
+		return nil, ErrNoToken
+	}
+	return tpt.Header.ReadCandidates(r)
+}
+
+//trusted reports whether the request's remote
+//address is in one of the trusted proxy networks
+func (tpt *TrustedProxyTransport) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range tpt.Proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxyTransport(t *testing.T) {
+	if _, err := NewTrustedProxyTransport("not a network"); err == nil {
+		t.Error("did not receive expected error for invalid network")
+	}
+	tpt, err := NewTrustedProxyTransport("10.0.0.0/8", "192.168.1.5", "fd00::/8")
+	if err != nil {
+		t.Fatalf("unexpected error constructing transport: %v", err)
+	}
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithTransport(Transports(DefaultHeaderTransport, tpt)))
+	token, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		remoteAddr  string
+		forwarded   string
+		auth        string
+		expectToken bool
+	}{
+		{"trusted network", "10.1.2.3:1234", authTypeBearer + " " + token.String(), "", true},
+		{"trusted address", "192.168.1.5:1234", authTypeBearer + " " + token.String(), "", true},
+		{"trusted IPv6 network", "[fd00::1]:1234", authTypeBearer + " " + token.String(), "", true},
+		{"untrusted address", "192.168.1.6:1234", authTypeBearer + " " + token.String(), "", false},
+		{"untrusted address with authorization", "192.168.1.6:1234", "", authTypeBearer + " " + token.String(), true},
+		{"trusted proxy with basic credentials in authorization", "10.1.2.3:1234", authTypeBearer + " " + token.String(), "Basic dXNlcjpwYXNz", true},
+		{"trusted proxy without forwarded token", "10.1.2.3:1234", "", "", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = c.remoteAddr
+		if len(c.forwarded) > 0 {
+			req.Header.Set(DefaultForwardedAuthorizationHeader, c.forwarded)
+		}
+		if len(c.auth) > 0 {
+			req.Header.Set(headerAuthorization, c.auth)
+		}
+		tk, err := mgr.GetToken(req)
+		if c.expectToken {
+			if err != nil {
+				t.Errorf("case %s: unexpected error: %v", c.name, err)
+			} else if tk.String() != token.String() {
+				t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, token.String(), tk.String())
+			}
+		} else if err == nil {
+			t.Errorf("case %s: did not receive expected error", c.name)
+		}
+	}
+
+	//the forwarded header is never written to responses
+	respRec := httptest.NewRecorder()
+	tpt.Write(respRec, token)
+	if len(respRec.Header()) > 0 {
+		t.Error("trusted proxy transport wrote to the response")
+	}
+}
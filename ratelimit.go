@@ -0,0 +1,217 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrInvalidRateLimit is returned when constructing a RateLimiter with a
+//RateLimit whose Rate isn't a positive finite number, or whose Burst is
+//less than one, as such a limit would reject every request
+var ErrInvalidRateLimit = errors.New("rate limit must have a positive rate and a burst of at least one")
+
+//RateLimit is the rate and burst size of a token-bucket rate limit
+type RateLimit struct {
+	//Rate is the number of requests allowed per second, on
+	//average. It must be positive.
+	Rate float64
+	//Burst is the number of requests that may be made at once,
+	//after a period without requests. It must be at least one.
+	Burst int
+}
+
+//validate returns ErrInvalidRateLimit if the limit can't be enforced
+func (rl RateLimit) validate() error {
+	if !(rl.Rate > 0) || math.IsInf(rl.Rate, 1) || rl.Burst < 1 {
+		return ErrInvalidRateLimit
+	}
+	return nil
+}
+
+//RateLimiter limits the rate of requests made with each key,
+//such as a session ID
+type RateLimiter interface {
+	//Allow reports whether a request with the key is allowed, and if
+	//not, how long the caller must wait until a request will be allowed
+	Allow(key string) (bool, time.Duration, error)
+}
+
+//RateLimitSessions is middleware that limits the rate of requests made by
+//each session, responding with 429 Too Many Requests and a Retry-After
+//header when a session exceeds its limit. This ties the limit to the
+//authenticated session rather than the client's IP address, which may be
+//shared by many users, or changed at will by an attacker. Requests without
+//a valid session token aren't limited, so combine this with an IP-based
+//limiter for anonymous requests. If the limiter fails, requests are allowed,
+//so that an outage of the limiter's backend doesn't block all requests.
+func RateLimitSessions(m Manager, limiter RateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tk, err := m.GetToken(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, wait, err := limiter.Allow(tk.ID().String())
+		if err != nil || allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
+
+//refill returns the number of tokens in a bucket after refilling it
+//for the time elapsed since it last had the given number of tokens
+func (rl RateLimit) refill(tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(rl.Burst), tokens+elapsed.Seconds()*rl.Rate)
+}
+
+//wait returns how long it will take a bucket with the given
+//number of tokens to refill to one token
+func (rl RateLimit) wait(tokens float64) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / rl.Rate * float64(time.Second)))
+}
+
+//fillTime returns how long it takes an empty bucket to fill
+func (rl RateLimit) fillTime() time.Duration {
+	return time.Duration(float64(rl.Burst) / rl.Rate * float64(time.Second))
+}
+
+//rateLimitSweepInterval is the number of requests to a memoryRateLimiter
+//between sweeps of its full buckets
+const rateLimitSweepInterval = 1024
+
+//memoryRateLimiter is an in-memory RateLimiter
+type memoryRateLimiter struct {
+	limit    RateLimit
+	mx       sync.Mutex
+	buckets  map[string]*tokenBucket
+	requests int
+}
+
+//tokenBucket is the state of one key's rate limit
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+//NewMemoryRateLimiter constructs a new RateLimiter that holds its token
+//buckets in memory. Buckets are not shared between processes, so use
+//NewRedisRateLimiter when running multiple instances. If the limit
+//is invalid, ErrInvalidRateLimit is returned.
+func NewMemoryRateLimiter(limit RateLimit) (RateLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &memoryRateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}, nil
+}
+
+//Allow takes a token from the key's bucket, if it has one
+func (mrl *memoryRateLimiter) Allow(key string) (bool, time.Duration, error) {
+	mrl.mx.Lock()
+	defer mrl.mx.Unlock()
+	now := time.Now()
+	//discard buckets that have refilled, so the map doesn't grow forever
+	if mrl.requests++; mrl.requests%rateLimitSweepInterval == 0 {
+		for k, b := range mrl.buckets {
+			if now.Sub(b.updated) >= mrl.limit.fillTime() {
+				delete(mrl.buckets, k)
+			}
+		}
+	}
+
+	b, found := mrl.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: float64(mrl.limit.Burst), updated: now}
+		mrl.buckets[key] = b
+	}
+	b.tokens = mrl.limit.refill(b.tokens, now.Sub(b.updated))
+	b.updated = now
+	if b.tokens < 1 {
+		return false, mrl.limit.wait(b.tokens), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+//DefaultRedisRateLimitKeyPrefix is the default prefix added to
+//keys to form the redis keys of rate limit buckets
+const DefaultRedisRateLimitKeyPrefix = "ratelimit:"
+
+//rateLimitScriptSrc refills a token bucket stored in a hash, takes a
+//token from it if it has one, and returns whether it did, along with the
+//milliseconds until a token will be available if it didn't. The bucket
+//expires once it would be full again. Numbers are passed to HSET as
+//strings, as redis would otherwise truncate the fractional tokens.
+const rateLimitScriptSrc = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate))
+return {allowed, wait}`
+
+var rateLimitScript = redis.NewScript(1, rateLimitScriptSrc)
+
+//RedisRateLimiter is a RateLimiter backed by redis, which stores each
+//key's token bucket as a hash, updated atomically by a Lua script
+type RedisRateLimiter struct {
+	//Prefix added to keys to form redis keys.
+	//Defaults to DefaultRedisRateLimitKeyPrefix, but
+	//callers may adjust this after construction.
+	KeyPrefix string
+	limit     RateLimit
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//NewRedisRateLimiter constructs a new RedisRateLimiter. Buckets are refilled
+//using the clock of the server calling Allow, so keep server clocks in sync.
+//If the limit is invalid, ErrInvalidRateLimit is returned.
+func NewRedisRateLimiter(pool *redis.Pool, limit RateLimit) (*RedisRateLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &RedisRateLimiter{
+		KeyPrefix: DefaultRedisRateLimitKeyPrefix,
+		limit:     limit,
+		pool:      pool,
+	}, nil
+}
+
+//Allow takes a token from the key's bucket, if it has one
+func (rrl *RedisRateLimiter) Allow(key string) (bool, time.Duration, error) {
+	conn := rrl.pool.Get()
+	defer conn.Close()
+	//the script works in milliseconds
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	result, err := redis.Int64s(rateLimitScript.Do(conn, rrl.KeyPrefix+key,
+		rrl.limit.Rate/1000, rrl.limit.Burst, now))
+	if err != nil {
+		return false, 0, fmt.Errorf("error executing rate limit script: %v", err)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
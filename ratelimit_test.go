@@ -0,0 +1,119 @@
+package sessions
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func testRateLimiter(t *testing.T, name string, limiter RateLimiter) {
+	limit := RateLimit{Rate: 10, Burst: 2}
+	cases := []struct {
+		key      string
+		wait     time.Duration
+		expected bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true},
+		{"a", time.Second / time.Duration(limit.Rate), true},
+		{"a", 0, false},
+	}
+	for i, c := range cases {
+		time.Sleep(c.wait)
+		allowed, wait, err := limiter.Allow(c.key)
+		if err != nil {
+			t.Fatalf("%s request %d: unexpected error: %v", name, i, err)
+		}
+		if allowed != c.expected {
+			t.Errorf("%s request %d: incorrect result: expected %t but got %t", name, i, c.expected, allowed)
+		}
+		if !allowed && (wait <= 0 || wait > time.Second/time.Duration(limit.Rate)) {
+			t.Errorf("%s request %d: incorrect wait: %v", name, i, wait)
+		}
+	}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter, err := NewMemoryRateLimiter(RateLimit{Rate: 10, Burst: 2})
+	if err != nil {
+		t.Fatalf("unexpected error constructing limiter: %v", err)
+	}
+	testRateLimiter(t, "memory", limiter)
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	srv := miniredis.RunT(t)
+	limiter, err := NewRedisRateLimiter(NewRedisPool(srv.Addr(), time.Minute), RateLimit{Rate: 10, Burst: 2})
+	if err != nil {
+		t.Fatalf("unexpected error constructing limiter: %v", err)
+	}
+	testRateLimiter(t, "redis", limiter)
+	if ttl := srv.TTL(DefaultRedisRateLimitKeyPrefix + "a"); ttl <= 0 || ttl > 200*time.Millisecond {
+		t.Errorf("incorrect bucket TTL: %v", ttl)
+	}
+}
+
+func TestInvalidRateLimit(t *testing.T) {
+	cases := []struct {
+		name  string
+		limit RateLimit
+	}{
+		{"zero rate", RateLimit{Rate: 0, Burst: 1}},
+		{"negative rate", RateLimit{Rate: -1, Burst: 1}},
+		{"infinite rate", RateLimit{Rate: math.Inf(1), Burst: 1}},
+		{"NaN rate", RateLimit{Rate: math.NaN(), Burst: 1}},
+		{"zero burst", RateLimit{Rate: 1, Burst: 0}},
+	}
+	for _, c := range cases {
+		if _, err := NewMemoryRateLimiter(c.limit); err != ErrInvalidRateLimit {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, ErrInvalidRateLimit, err)
+		}
+		if _, err := NewRedisRateLimiter(nil, c.limit); err != ErrInvalidRateLimit {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, ErrInvalidRateLimit, err)
+		}
+	}
+}
+
+func TestRateLimitSessions(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	tk, _ := NewToken(testSigningKey)
+	limiter, err := NewMemoryRateLimiter(RateLimit{Rate: 0.5, Burst: 1})
+	if err != nil {
+		t.Fatalf("unexpected error constructing limiter: %v", err)
+	}
+	handler := RateLimitSessions(mgr, limiter,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"first request", fmt.Sprintf("%s %s", authTypeBearer, tk), http.StatusOK},
+		{"second request", fmt.Sprintf("%s %s", authTypeBearer, tk), http.StatusTooManyRequests},
+		{"no session", "", http.StatusOK},
+		{"no session again", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		if len(c.authorization) > 0 {
+			req.Header.Set(headerAuthorization, c.authorization)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+		if c.expectedStatus == http.StatusTooManyRequests && respRec.Header().Get("Retry-After") != "2" {
+			t.Errorf("case %s: incorrect Retry-After: %s", c.name, respRec.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package sessions
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -14,9 +14,23 @@ import (
 //idle for testAfterIdle or longer, it will be health-tested by executing a PING.
 //Set testAfterIdle to 0 to always health-test existing connections before they are returned.
 //Callers may adjust any settings on the returned pool before passing it to NewRedisStore().
-func NewRedisPool(addr string, testAfterIdle time.Duration) *redis.Pool {
+//
+//The addr is usually a TCP host:port, but may also be the path of a unix
+//domain socket, either as an absolute path or a unix:// URL, which avoids
+//the overhead of TCP when redis, or a proxy to it, runs on the same host.
+//A redis:// or rediss:// URL may also be used, to set the password and
+//database number. Any opts, such as redis.DialConnectTimeout, are used
+//when dialing each connection.
+func NewRedisPool(addr string, testAfterIdle time.Duration, opts ...redis.DialOption) *redis.Pool {
+	return NewRedisPoolWithDialer(redisDialer(addr, opts), testAfterIdle)
+}
+
+//NewRedisPoolWithDialer is like NewRedisPool, but the pool uses dial
+//to open new connections, for deployments that need complete control
+//over how connections are made.
+func NewRedisPoolWithDialer(dial func() (redis.Conn, error), testAfterIdle time.Duration) *redis.Pool {
 	return &redis.Pool{
-		Dial: func() (redis.Conn, error) { return redis.Dial("tcp", addr) },
+		Dial: dial,
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			if time.Since(t) < testAfterIdle {
 				return nil
@@ -31,85 +45,431 @@ func NewRedisPool(addr string, testAfterIdle time.Duration) *redis.Pool {
 	}
 }
 
+//redisDialer returns a function that dials addr, as described in NewRedisPool
+func redisDialer(addr string, opts []redis.DialOption) func() (redis.Conn, error) {
+	switch {
+	case strings.HasPrefix(addr, "redis://"), strings.HasPrefix(addr, "rediss://"):
+		return func() (redis.Conn, error) { return redis.DialURL(addr, opts...) }
+	case strings.HasPrefix(addr, "unix://"):
+		path := strings.TrimPrefix(addr, "unix://")
+		return func() (redis.Conn, error) { return redis.Dial("unix", path, opts...) }
+	case strings.HasPrefix(addr, "/"):
+		return func() (redis.Conn, error) { return redis.Dial("unix", addr, opts...) }
+	}
+	return func() (redis.Conn, error) { return redis.Dial("tcp", addr, opts...) }
+}
+
+//DefaultRedisKeyPrefix is the default prefix added to session IDs
+//to form redis keys. It keeps session keys separate from other keys
+//that might end up in the same redis instance.
+const DefaultRedisKeyPrefix = "sid:"
+
 //RedisStore represents a Store backed by redis.
 type RedisStore struct {
 	//Used for key expiry time on redis. Callers
 	//may adjust this after construction.
 	SessionDuration time.Duration
+	//Prefix added to session IDs to form redis keys.
+	//Defaults to DefaultRedisKeyPrefix, but callers may
+	//adjust this after construction to keep sessions for
+	//different applications or tenants separate.
+	KeyPrefix string
+	//RefreshInterval is the minimum time between refreshes of a
+	//session's expiry time by Get. If zero, every Get resets the
+	//expiry time, which requires an EXPIRE command. Otherwise, Get
+	//only issues an EXPIRE if this process hasn't saved or refreshed
+	//the session within the interval, which roughly halves the write
+	//commands for busy sessions, at the cost of sessions expiring up
+	//to RefreshInterval before SessionDuration has passed since their
+	//last use. Callers may adjust this after construction.
+	RefreshInterval time.Duration
+	//UserIndexPrefix is the prefix added to user IDs to form the keys of
+	//the hashes of each user's session IDs and state sizes. If empty, which
+	//is the default, no user index is kept. Otherwise, whenever state is
+	//saved for a user's session, as identified by UserIdentifier, the session
+	//ID and the size of its encoded state are added to the user's hash in the
+	//same transaction, so that the index never lacks a stored session.
+	//The session's user ID is also recorded under its session key with
+	//a ":uid" suffix, so that Get, GetAndTouch, and Touch can keep the
+	//user's hash for as long as any of the user's sessions. Callers may
+	//adjust this after construction.
+	UserIndexPrefix string
+	//UserQuota is the maximum total size in bytes of the encoded state of
+	//each user's sessions, which requires a UserIndexPrefix. Saves that
+	//would exceed the quota fail with a *QuotaExceededError. If zero, which
+	//is the default, there is no quota. Callers may adjust this after construction.
+	UserQuota int
+	//ExpiryIndexKey is the key of a sorted set of session IDs, scored by
+	//when each session's state will expire, which is updated whenever the
+	//expiry time is set or reset. This allows ExpiringSessions to find
+	//sessions that are about to expire, and SweepExpired to clean up
+	//resources associated with sessions that have expired. If empty,
+	//which is the default, no expiry index is kept. Callers may adjust
+	//this after construction.
+	ExpiryIndexKey string
 	//redis conection pool
 	pool *redis.Pool
+	//refreshes tracks when sessions' expiry times were last
+	//refreshed, when RefreshInterval is non-zero
+	refreshes *refreshTracker
+	//cache holds session state read from redis,
+	//if enabled by EnableClientCache
+	cache *clientCache
 }
 
 //NewRedisStore constructs a new RedisStore
 func NewRedisStore(pool *redis.Pool, sessionDuration time.Duration) *RedisStore {
 	return &RedisStore{
 		SessionDuration: sessionDuration,
+		KeyPrefix:       DefaultRedisKeyPrefix,
 		pool:            pool,
+		refreshes:       newRefreshTracker(),
 	}
 }
 
 //Save saves the provided sessionState into the store, associated with
-//the provided session token. The sessionState must be gob-encodable.
+//the provided session token. The sessionState must be encodable by the DefaultCodec.
 func (rs *RedisStore) Save(token Token, sessionState interface{}) error {
-	//gob-encode the session state
-	buf := bytes.NewBuffer(nil)
-	enc := gob.NewEncoder(buf)
-	if err := enc.Encode(sessionState); err != nil {
-		return fmt.Errorf("error encoding session state: %v", err)
+	return rs.SaveContext(context.Background(), token, sessionState)
+}
+
+//SaveContext is like Save, but respects the context's deadline and
+//cancellation while getting a connection and executing the command
+func (rs *RedisStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	//encode the session state
+	buf, err := encodeState(sessionState)
+	if err != nil {
+		return err
 	}
 
-	conn := rs.pool.Get()
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
 	defer conn.Close()
 
-	//use SETEX to set it with a TTL
-	_, err := conn.Do("SETEX", getRedisKey(token), rs.SessionDuration.Seconds(), buf)
-	if err != nil {
+	//use SETEX to set it with a TTL, and update
+	//the indexes in the same transaction
+	key := rs.getRedisKey(token)
+	userID := rs.getIndexedUserID(sessionState)
+	if len(userID) > 0 && rs.UserQuota > 0 {
+		if err := rs.saveWithinQuota(ctx, conn, token, userID, buf); err != nil {
+			return err
+		}
+	} else if len(userID) > 0 || len(rs.ExpiryIndexKey) > 0 {
+		conn.Send("MULTI")
+		conn.Send("SETEX", key, rs.SessionDuration.Seconds(), buf)
+		if len(userID) > 0 {
+			rs.sendIndexUser(conn, userID, token, len(buf))
+		}
+		rs.sendIndexExpiry(conn, token, false)
+		if _, err := doContext(ctx, conn, "EXEC"); err != nil {
+			return fmt.Errorf("error executing MULTI/EXEC: %v", err)
+		}
+	} else if _, err := doContext(ctx, conn, "SETEX", key, rs.SessionDuration.Seconds(), buf); err != nil {
 		return fmt.Errorf("error executing SETEX: %v", err)
 	}
+	rs.refreshes.mark(key, rs.RefreshInterval)
+	rs.cache.invalidate(key)
 	return nil
 }
 
 //Get gets the session state associated with the provided session token,
-//and resets the expiry time. The previously-stored state will be decoded
-//into the sessionState value, so that must be passed by reference.
+//and resets the expiry time, unless it was reset within the RefreshInterval,
+//in which case the state may be served from the cache enabled by
+//EnableClientCache. The previously-stored state will be decoded into the sessionState value,
+//so that must be passed by reference. If there is no state associated
+//with the token, ErrStateNotFound is returned.
 func (rs *RedisStore) Get(token Token, sessionState interface{}) error {
-	conn := rs.pool.Get()
+	return rs.GetContext(context.Background(), token, sessionState)
+}
+
+//GetContext is like Get, but respects the context's deadline and
+//cancellation while getting a connection and executing the commands
+func (rs *RedisStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	key := rs.getRedisKey(token)
+	refresh := rs.refreshes.due(key, rs.RefreshInterval)
+	var entry *clientCacheEntry
+	if !refresh {
+		if state, found := rs.cache.get(key); found {
+			return decodeState(state, sessionState)
+		}
+		//refreshing the expiry time invalidates the cached
+		//state, so only cache it if it isn't being refreshed
+		entry = rs.cache.reserve(key)
+	}
+
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		rs.cache.invalidate(key)
+		return fmt.Errorf("error getting connection: %v", err)
+	}
 	defer conn.Close()
 
 	//pipeline GET and EXPIRE commands
 	//to get the state and reset its TTL
-	key := getRedisKey(token)
 	conn.Send("GET", key)
-	conn.Send("EXPIRE", key, rs.SessionDuration.Seconds())
+	if refresh {
+		conn.Send("EXPIRE", key, rs.SessionDuration.Seconds())
+		rs.sendIndexExpiry(conn, token, true)
+		rs.sendTouchUser(conn, token, rs.SessionDuration)
+	}
 	conn.Flush()
 
 	//GET command reply
-	getReply, err := redis.Bytes(conn.Receive())
+	getReply, err := redis.Bytes(receiveContext(ctx, conn))
+	if err == redis.ErrNil {
+		rs.refreshes.forget(key)
+		rs.cache.invalidate(key)
+		return ErrStateNotFound
+	}
 	if err != nil {
+		rs.cache.invalidate(key)
 		return fmt.Errorf("error executing GET: %v", err)
 	}
-	if err := gob.NewDecoder(bytes.NewBuffer(getReply)).Decode(sessionState); err != nil {
-		return fmt.Errorf("error decoding session state: %v", err)
+	rs.cache.fill(key, entry, getReply)
+	if err := decodeState(getReply, sessionState); err != nil {
+		return err
 	}
 
-	//no need to look at the EXPIRE command reply
+	//no need to look at the EXPIRE command replies
 	return nil
 }
 
+//GetAndTouch is like Get, but always sets the expiry time of the session
+//state to ttl from now, or SessionDuration if ttl is zero, using a single
+//GETEX command, so that the state can't expire between being fetched
+//and touched. This requires redis 6.2 or later.
+func (rs *RedisStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = rs.SessionDuration
+	}
+	conn := rs.pool.Get()
+	defer conn.Close()
+	key := rs.getRedisKey(token)
+	rs.cache.invalidate(key)
+
+	conn.Send("GETEX", key, "PX", ttl.Milliseconds())
+	rs.sendIndexExpiryAt(conn, token, true, time.Now().Add(ttl))
+	rs.sendTouchUser(conn, token, ttl)
+	conn.Flush()
+	buf, err := redis.Bytes(conn.Receive())
+	if err == redis.ErrNil {
+		rs.refreshes.forget(key)
+		return ErrStateNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error executing GETEX: %v", err)
+	}
+	rs.refreshes.mark(key, rs.RefreshInterval)
+	return decodeState(buf, sessionState)
+}
+
+//Peek is like Get, but doesn't reset the expiry time of the session state.
+func (rs *RedisStore) Peek(token Token, sessionState interface{}) error {
+	conn := rs.pool.Get()
+	defer conn.Close()
+	buf, err := redis.Bytes(conn.Do("GET", rs.getRedisKey(token)))
+	if err == redis.ErrNil {
+		return ErrStateNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error executing GET: %v", err)
+	}
+	return decodeState(buf, sessionState)
+}
+
 //Delete deletes all session state data associated with the provided session token.
 func (rs *RedisStore) Delete(token Token) error {
-	conn := rs.pool.Get()
+	return rs.DeleteContext(context.Background(), token)
+}
+
+//DeleteContext is like Delete, but respects the context's deadline and
+//cancellation while getting a connection and executing the command
+func (rs *RedisStore) DeleteContext(ctx context.Context, token Token) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
 	defer conn.Close()
-	_, err := conn.Do("DEL", getRedisKey(token))
+	key := rs.getRedisKey(token)
+	if len(rs.ExpiryIndexKey) > 0 {
+		conn.Send("ZREM", rs.ExpiryIndexKey, token.ID().String())
+	}
+	if len(rs.UserIndexPrefix) > 0 {
+		conn.Send("DEL", rs.getUserIDKey(token))
+	}
+	_, err = doContext(ctx, conn, "DEL", key)
 	if err != nil {
 		return fmt.Errorf("error executing DEL: %v", err)
 	}
+	rs.refreshes.forget(key)
+	rs.cache.invalidate(key)
 	return nil
 }
 
+//Exists reports whether there is session state associated with
+//the provided session token, without resetting its expiry time.
+func (rs *RedisStore) Exists(token Token) (bool, error) {
+	conn := rs.pool.Get()
+	defer conn.Close()
+	exists, err := redis.Bool(conn.Do("EXISTS", rs.getRedisKey(token)))
+	if err != nil {
+		return false, fmt.Errorf("error executing EXISTS: %v", err)
+	}
+	return exists, nil
+}
+
+//Touch resets the expiry time of the session state associated
+//with the provided session token, without fetching it.
+func (rs *RedisStore) Touch(token Token) error {
+	conn := rs.pool.Get()
+	defer conn.Close()
+	key := rs.getRedisKey(token)
+	touched, err := redis.Bool(conn.Do("EXPIRE", key, rs.SessionDuration.Seconds()))
+	if err != nil {
+		return fmt.Errorf("error executing EXPIRE: %v", err)
+	}
+	if !touched {
+		rs.refreshes.forget(key)
+		return ErrStateNotFound
+	}
+	rs.sendIndexExpiry(conn, token, true)
+	if rs.sendTouchUser(conn, token, rs.SessionDuration) || len(rs.ExpiryIndexKey) > 0 {
+		if err := conn.Flush(); err != nil {
+			return fmt.Errorf("error updating indexes: %v", err)
+		}
+	}
+	rs.refreshes.mark(key, rs.RefreshInterval)
+	return nil
+}
+
+//TTL returns the time remaining before the session state associated
+//with the provided session token expires, without resetting it.
+func (rs *RedisStore) TTL(token Token) (time.Duration, error) {
+	conn := rs.pool.Get()
+	defer conn.Close()
+	millis, err := redis.Int64(conn.Do("PTTL", rs.getRedisKey(token)))
+	if err != nil {
+		return 0, fmt.Errorf("error executing PTTL: %v", err)
+	}
+	switch millis {
+	case -2:
+		return 0, ErrStateNotFound
+	case -1:
+		//the key has no expiry
+		return 0, nil
+	}
+	return time.Duration(millis) * time.Millisecond, nil
+}
+
+//Scan calls fn with a token for each session key in redis with the store's
+//KeyPrefix, using the SCAN command so that redis isn't blocked.
+func (rs *RedisStore) Scan(fn func(token Token) error) error {
+	conn := rs.pool.Get()
+	defer conn.Close()
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", rs.KeyPrefix+"*", "COUNT", 100))
+		if err != nil {
+			return fmt.Errorf("error executing SCAN: %v", err)
+		}
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return fmt.Errorf("error reading SCAN reply: %v", err)
+		}
+		for _, key := range keys {
+			//skip the keys that record the user IDs of sessions
+			if strings.HasSuffix(key, redisUserKeySuffix) {
+				continue
+			}
+			if err := fn(storeToken(key[len(rs.KeyPrefix):])); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+//Ping executes a PING command to ensure that redis is reachable.
+func (rs *RedisStore) Ping(ctx context.Context) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
+	defer conn.Close()
+	if _, err := doContext(ctx, conn, "PING"); err != nil {
+		return fmt.Errorf("error executing PING: %v", err)
+	}
+	return nil
+}
+
+//Stats returns the statistics of the store's redis connection pool
+func (rs *RedisStore) Stats() PoolStats {
+	stats := rs.pool.Stats()
+	return PoolStats{
+		ActiveCount:  stats.ActiveCount,
+		IdleCount:    stats.IdleCount,
+		MaxActive:    rs.pool.MaxActive,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+}
+
 //getRedisKey() returns the redis key to use for the SessionID
-func getRedisKey(token Token) string {
-	//add the prefix "sid:" to keep session keys separate from
+func (rs *RedisStore) getRedisKey(token Token) string {
+	//add the key prefix to keep session keys separate from
 	//other keys that might end up in this redis instance
-	return "sid:" + token.ID().String()
+	return rs.KeyPrefix + token.ID().String()
+}
+
+//Replace saves the session state for the token, and deletes the
+//replaced token's state, in a single redis transaction
+func (rs *RedisStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	buf, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	conn := rs.pool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	conn.Send("SETEX", rs.getRedisKey(token), rs.SessionDuration.Seconds(), buf)
+	conn.Send("DEL", rs.getRedisKey(replaced))
+	if userID := rs.getIndexedUserID(sessionState); len(userID) > 0 {
+		conn.Send("HDEL", rs.UserIndexPrefix+userID, replaced.ID().String())
+		conn.Send("DEL", rs.getUserIDKey(replaced))
+		rs.sendIndexUser(conn, userID, token, len(buf))
+	}
+	if len(rs.ExpiryIndexKey) > 0 {
+		conn.Send("ZREM", rs.ExpiryIndexKey, replaced.ID().String())
+		rs.sendIndexExpiry(conn, token, false)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("error executing MULTI/EXEC: %v", err)
+	}
+	rs.refreshes.mark(rs.getRedisKey(token), rs.RefreshInterval)
+	rs.refreshes.forget(rs.getRedisKey(replaced))
+	rs.cache.invalidate(rs.getRedisKey(token), rs.getRedisKey(replaced))
+	return nil
+}
+
+//doContext executes the command using redis.DoContext if the context
+//can be canceled, so that the command respects it. Otherwise, the command
+//is executed using Do, as not all connections support contexts.
+func doContext(ctx context.Context, conn redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	if ctx.Done() == nil {
+		return conn.Do(cmd, args...)
+	}
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+//receiveContext receives a reply using redis.ReceiveContext
+//if the context can be canceled, or Receive otherwise
+func receiveContext(ctx context.Context, conn redis.Conn) (interface{}, error) {
+	if ctx.Done() == nil {
+		return conn.Receive()
+	}
+	return redis.ReceiveContext(conn, ctx)
 }
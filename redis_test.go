@@ -1,12 +1,16 @@
 package sessions
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/rafaeljusto/redigomock"
 
 	"github.com/gomodule/redigo/redis"
@@ -145,8 +149,8 @@ func TestRedisStoreDeleteErrors(t *testing.T) {
 	}
 
 	conn := redigomock.NewConn()
-	conn.Command("DEL", getRedisKey(token)).ExpectError(fmt.Errorf("test error"))
 	store := NewRedisStore(getMockPool(conn), time.Hour)
+	conn.Command("DEL", store.getRedisKey(token)).ExpectError(fmt.Errorf("test error"))
 
 	if err := store.Delete(token); err == nil {
 		t.Error("did not receive expected error from mock")
@@ -163,8 +167,8 @@ func TestRedisStoreSaveErrors(t *testing.T) {
 	}
 
 	conn := redigomock.NewConn()
-	conn.Command("SETEX", getRedisKey(token), time.Hour.Seconds(), redigomock.NewAnyData()).ExpectError(fmt.Errorf("test error"))
 	store := NewRedisStore(getMockPool(conn), time.Hour)
+	conn.Command("SETEX", store.getRedisKey(token), time.Hour.Seconds(), redigomock.NewAnyData()).ExpectError(fmt.Errorf("test error"))
 
 	//try to save something that can't be encoded
 	if err := store.Save(token, func() {}); err == nil {
@@ -179,8 +183,431 @@ func TestRedisStoreSaveErrors(t *testing.T) {
 	}
 }
 
+func TestRedisStoreGetNotFound(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	conn.Command("GET", store.getRedisKey(token)).Expect(nil)
+	conn.Command("EXPIRE", store.getRedisKey(token), time.Hour.Seconds()).Expect(int64(0))
+
+	var state string
+	if err := store.Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
+
+func TestRedisStorePing(t *testing.T) {
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+
+	conn.Command("PING").Expect("PONG")
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error pinging: %v", err)
+	}
+
+	conn.Command("PING").ExpectError(fmt.Errorf("test error"))
+	if err := store.Ping(context.Background()); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+
+	//a cancelled context should prevent getting a connection
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := getMockPool(conn)
+	pool.MaxActive = 1
+	pool.Wait = true
+	busy := pool.Get()
+	defer busy.Close()
+	if err := NewRedisStore(pool, time.Hour).Ping(ctx); err == nil {
+		t.Error("did not receive expected error when pinging with a cancelled context")
+	}
+}
+
+func TestRedisStoreExists(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+
+	conn.Command("EXISTS", store.getRedisKey(token)).Expect(int64(1))
+	if exists, err := store.Exists(token); err != nil || !exists {
+		t.Errorf("incorrect result: expected true, <nil> but got %t, %v", exists, err)
+	}
+	conn.Command("EXISTS", store.getRedisKey(token)).Expect(int64(0))
+	if exists, err := store.Exists(token); err != nil || exists {
+		t.Errorf("incorrect result: expected false, <nil> but got %t, %v", exists, err)
+	}
+	conn.Command("EXISTS", store.getRedisKey(token)).ExpectError(fmt.Errorf("test error"))
+	if _, err := store.Exists(token); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
 func getMockPool(conn *redigomock.Conn) *redis.Pool {
 	return &redis.Pool{
 		Dial: func() (redis.Conn, error) { return conn, nil },
 	}
 }
+
+func TestRedisStoreKeyPrefix(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	if key := store.getRedisKey(token); key != DefaultRedisKeyPrefix+token.ID().String() {
+		t.Errorf("incorrect default key: %s", key)
+	}
+
+	store.KeyPrefix = "tenant1:sid:"
+	expectedKey := "tenant1:sid:" + token.ID().String()
+	if key := store.getRedisKey(token); key != expectedKey {
+		t.Errorf("incorrect key: expected %s but got %s", expectedKey, key)
+	}
+	conn.Command("DEL", expectedKey).Expect(int64(1))
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting: %v", err)
+	}
+	if err := conn.ExpectationsWereMet(); err != nil {
+		t.Errorf("some expectations were not met: %v", err)
+	}
+}
+
+func TestRedisStoreScan(t *testing.T) {
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	conn.Command("SCAN", 0, "MATCH", DefaultRedisKeyPrefix+"*", "COUNT", 100).
+		Expect([]interface{}{[]byte("7"), []interface{}{[]byte(DefaultRedisKeyPrefix + "a"), []byte(DefaultRedisKeyPrefix + "b")}})
+	conn.Command("SCAN", 7, "MATCH", DefaultRedisKeyPrefix+"*", "COUNT", 100).
+		Expect([]interface{}{[]byte("0"), []interface{}{[]byte(DefaultRedisKeyPrefix + "c")}})
+
+	var ids []string
+	err := store.Scan(func(token Token) error {
+		ids = append(ids, token.ID().String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error scanning: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Errorf("incorrect IDs: %v", ids)
+	}
+
+	conn.Command("SCAN", 0, "MATCH", DefaultRedisKeyPrefix+"*", "COUNT", 100).ExpectError(fmt.Errorf("test error"))
+	if err := store.Scan(func(token Token) error { return nil }); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestRedisStoreTouch(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+
+	conn.Command("EXPIRE", store.getRedisKey(token), time.Hour.Seconds()).Expect(int64(1))
+	if err := store.Touch(token); err != nil {
+		t.Errorf("unexpected error touching state: %v", err)
+	}
+	conn.Command("EXPIRE", store.getRedisKey(token), time.Hour.Seconds()).Expect(int64(0))
+	if err := store.Touch(token); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	conn.Command("EXPIRE", store.getRedisKey(token), time.Hour.Seconds()).ExpectError(fmt.Errorf("test error"))
+	if err := store.Touch(token); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+
+	cases := []struct {
+		name          string
+		reply         interface{}
+		expectedTTL   time.Duration
+		expectedError error
+	}{
+		{"expiring", int64(1500), 1500 * time.Millisecond, nil},
+		{"no expiry", int64(-1), 0, nil},
+		{"not found", int64(-2), 0, ErrStateNotFound},
+	}
+	for _, c := range cases {
+		conn.Command("PTTL", store.getRedisKey(token)).Expect(c.reply)
+		ttl, err := store.TTL(token)
+		if ttl != c.expectedTTL || err != c.expectedError {
+			t.Errorf("case %s: incorrect result: expected %v, %v but got %v, %v", c.name, c.expectedTTL, c.expectedError, ttl, err)
+		}
+	}
+	conn.Command("PTTL", store.getRedisKey(token)).ExpectError(fmt.Errorf("test error"))
+	if _, err := store.TTL(token); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestRedisStoreRefreshInterval(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	buf, err := encodeState("test state")
+	if err != nil {
+		t.Fatalf("unexpected error encoding state: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	store.RefreshInterval = time.Minute
+	key := store.getRedisKey(token)
+	conn.Command("SETEX", key, time.Hour.Seconds(), buf).Expect("OK")
+	conn.Command("GET", key).Expect(buf)
+	expire := conn.Command("EXPIRE", key, time.Hour.Seconds()).Expect(int64(1))
+
+	//the save refreshes the expiry time, so gets within
+	//the interval shouldn't refresh it again
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	for i := 0; i < 3; i++ {
+		if err := store.Get(token, &state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+	}
+	if n := conn.Stats(expire); n != 0 {
+		t.Errorf("incorrect number of EXPIRE commands: expected 0 but got %d", n)
+	}
+
+	//once the session is forgotten, the next get should refresh it
+	store.refreshes.forget(key)
+	for i := 0; i < 3; i++ {
+		if err := store.Get(token, &state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+	}
+	if n := conn.Stats(expire); n != 1 {
+		t.Errorf("incorrect number of EXPIRE commands: expected 1 but got %d", n)
+	}
+
+	//with no interval, every get should refresh it
+	store.RefreshInterval = 0
+	for i := 0; i < 3; i++ {
+		if err := store.Get(token, &state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+	}
+	if n := conn.Stats(expire); n != 4 {
+		t.Errorf("incorrect number of EXPIRE commands: expected 4 but got %d", n)
+	}
+}
+
+func TestRedisStorePeek(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	buf, err := encodeState("test state")
+	if err != nil {
+		t.Fatalf("unexpected error encoding state: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	expire := conn.Command("EXPIRE", store.getRedisKey(token), time.Hour.Seconds()).Expect(int64(1))
+
+	var state string
+	conn.Command("GET", store.getRedisKey(token)).Expect(buf)
+	if err := store.Peek(token, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect result: expected %s, %v but got %s, %v", "test state", nil, state, err)
+	}
+	if n := conn.Stats(expire); n != 0 {
+		t.Errorf("incorrect number of EXPIRE commands: expected 0 but got %d", n)
+	}
+	conn.Command("GET", store.getRedisKey(token)).Expect(nil)
+	if err := store.Peek(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	conn.Command("GET", store.getRedisKey(token)).ExpectError(fmt.Errorf("test error"))
+	if err := store.Peek(token, &state); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestRedisStoreGetAndTouch(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	store.ExpiryIndexKey = "expiring"
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	var state string
+	if err := store.GetAndTouch(token, &state, time.Minute); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if srv.Exists("expiring") {
+		t.Error("missing session was added to the expiry index")
+	}
+
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.GetAndTouch(token, &state, time.Minute); err != nil || state != "test state" {
+		t.Errorf("incorrect result: expected %s, %v but got %s, %v", "test state", nil, state, err)
+	}
+	key := store.getRedisKey(token)
+	if ttl := srv.TTL(key); ttl != time.Minute {
+		t.Errorf("incorrect TTL: expected %v but got %v", time.Minute, ttl)
+	}
+	score, err := srv.ZScore("expiring", token.ID().String())
+	if err != nil {
+		t.Fatalf("unexpected error getting expiry index score: %v", err)
+	}
+	if expires := time.Unix(0, int64(score)*int64(time.Millisecond)); time.Until(expires) > time.Minute {
+		t.Errorf("incorrect expiry index score: expected within %v but got %v", time.Minute, time.Until(expires))
+	}
+
+	//a zero ttl should use the session duration
+	if err := store.GetAndTouch(token, &state, 0); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if ttl := srv.TTL(key); ttl != time.Hour {
+		t.Errorf("incorrect TTL: expected %v but got %v", time.Hour, ttl)
+	}
+}
+
+func TestRedisStoreStats(t *testing.T) {
+	conn := redigomock.NewConn()
+	pool := getMockPool(conn)
+	pool.MaxActive = 8
+	pool.MaxIdle = 1
+	store := NewRedisStore(pool, time.Hour)
+	c := pool.Get()
+	stats := store.Stats()
+	if stats.ActiveCount != 1 || stats.IdleCount != 0 || stats.MaxActive != 8 {
+		t.Errorf("incorrect stats with connection in use: %+v", stats)
+	}
+	c.Close()
+	stats = store.Stats()
+	if stats.ActiveCount != 1 || stats.IdleCount != 1 {
+		t.Errorf("incorrect stats with idle connection: %+v", stats)
+	}
+}
+
+func TestRedisStoreContext(t *testing.T) {
+	srv := miniredis.RunT(t)
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	var _ ContextStore = store
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := store.SaveContext(ctx, token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	if err := store.GetContext(ctx, token, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect result: expected %s, %v but got %s, %v", "test state", nil, state, err)
+	}
+	if err := store.DeleteContext(ctx, token); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if err := store.GetContext(ctx, token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+
+	//commands should fail once the context is done
+	cancel()
+	if err := store.SaveContext(ctx, token, "test state"); err == nil {
+		t.Error("did not receive expected error saving with canceled context")
+	}
+	if err := store.GetContext(ctx, token, &state); err == nil {
+		t.Error("did not receive expected error getting with canceled context")
+	}
+	if err := store.DeleteContext(ctx, token); err == nil {
+		t.Error("did not receive expected error deleting with canceled context")
+	}
+}
+
+func TestNewRedisPoolAddresses(t *testing.T) {
+	srv := miniredis.RunT(t)
+
+	//serve PINGs on a unix domain socket
+	sockPath := filepath.Join(t.TempDir(), "redis.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("unexpected error listening on unix socket: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 512)
+				for {
+					if _, err := c.Read(buf); err != nil {
+						return
+					}
+					c.Write([]byte("+PONG\r\n"))
+				}
+			}()
+		}
+	}()
+
+	cases := []struct {
+		name string
+		addr string
+	}{
+		{"tcp", srv.Addr()},
+		{"redis url", "redis://" + srv.Addr() + "/0"},
+		{"unix path", sockPath},
+		{"unix url", "unix://" + sockPath},
+	}
+	for _, c := range cases {
+		pool := NewRedisPool(c.addr, 0, redis.DialConnectTimeout(time.Second))
+		conn := pool.Get()
+		reply, err := redis.String(conn.Do("PING"))
+		if err != nil || reply != "PONG" {
+			t.Errorf("case %s: incorrect result: expected PONG, %v but got %s, %v", c.name, nil, reply, err)
+		}
+		conn.Close()
+		pool.Close()
+	}
+}
+
+func TestNewRedisPoolWithDialer(t *testing.T) {
+	mockConn := redigomock.NewConn()
+	numDials := 0
+	pool := NewRedisPoolWithDialer(func() (redis.Conn, error) {
+		numDials++
+		return mockConn, nil
+	}, time.Minute)
+	conn := pool.Get()
+	if err := conn.Err(); err != nil {
+		t.Errorf("connection returned from Get has error: %v", err)
+	}
+	conn.Close()
+	if numDials != 1 {
+		t.Errorf("expected numDials to be 1, but got %d", numDials)
+	}
+}
@@ -0,0 +1,281 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//redisInvalidateChannel is the channel to which redis
+//publishes client-side caching invalidation messages
+const redisInvalidateChannel = "__redis__:invalidate"
+
+//DefaultClientCacheEntries is the number of session states
+//EnableClientCache keeps if maxEntries is zero
+const DefaultClientCacheEntries = 10000
+
+//clientCacheRetryInterval is how long a RedisStore waits before trying
+//to reconnect after its invalidation connection fails
+const clientCacheRetryInterval = time.Second
+
+//clientCache holds session state read from redis, which is
+//removed when redis reports that it has been modified
+type clientCache struct {
+	mx         sync.Mutex
+	entries    map[string]*clientCacheEntry
+	maxEntries int
+	//connected is true while invalidation messages are being received,
+	//as the entries can't be trusted otherwise
+	connected bool
+	stopped   bool
+	conns     []redis.Conn
+}
+
+//clientCacheEntry is the encoded state of one session, which is nil
+//while the state is being read from redis
+type clientCacheEntry struct {
+	state []byte
+}
+
+//EnableClientCache keeps up to maxEntries session states read by Get in
+//process memory, using redis 6 client-side caching in broadcasting mode
+//to remove them as soon as they are modified or expire in redis, by this
+//process or any other. Cached state is only used by Get between refreshes
+//of its expiry time, so RefreshInterval must also be set for the cache to
+//have any effect. If maxEntries is zero, DefaultClientCacheEntries is
+//used, and when the cache is full, arbitrary entries are evicted to make
+//room for new ones. If the connection receiving invalidation messages fails,
+//the cache is cleared and bypassed until it reconnects.
+//
+//This must be called before the store is used. It returns a function that
+//stops caching and closes the invalidation connections, which should be
+//called when the process shuts down. An error is returned if redis doesn't
+//support client-side caching.
+func (rs *RedisStore) EnableClientCache(maxEntries int) (func(), error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultClientCacheEntries
+	}
+	cache := &clientCache{
+		entries:    make(map[string]*clientCacheEntry),
+		maxEntries: maxEntries,
+	}
+	sub, err := rs.trackInvalidations(cache)
+	if err != nil {
+		return nil, err
+	}
+	rs.cache = cache
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			cache.reset(true)
+			cache.listen(sub)
+			cache.reset(false)
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(clientCacheRetryInterval):
+				}
+				if sub, err = rs.trackInvalidations(cache); err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(done)
+			cache.stop()
+		})
+		wg.Wait()
+	}, nil
+}
+
+//trackInvalidations dials a connection subscribed to invalidation messages,
+//and another that enables tracking of the store's keys, redirecting the
+//messages to the first, which is returned. The connections are closed
+//when the cache is stopped.
+func (rs *RedisStore) trackInvalidations(cache *clientCache) (redis.Conn, error) {
+	sub, err := rs.dial()
+	if err != nil {
+		return nil, fmt.Errorf("error dialing invalidation connection: %v", err)
+	}
+	tracking, err := rs.dial()
+	if err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("error dialing tracking connection: %v", err)
+	}
+	if !cache.setConns(sub, tracking) {
+		return nil, fmt.Errorf("client cache was stopped")
+	}
+	id, err := redis.Int64(sub.Do("CLIENT", "ID"))
+	if err != nil {
+		cache.closeConns()
+		return nil, fmt.Errorf("error executing CLIENT ID: %v", err)
+	}
+	//subscribe before tracking begins, so no messages are missed
+	if _, err := sub.Do("SUBSCRIBE", redisInvalidateChannel); err != nil {
+		cache.closeConns()
+		return nil, fmt.Errorf("error executing SUBSCRIBE: %v", err)
+	}
+	if _, err := tracking.Do("CLIENT", "TRACKING", "ON", "REDIRECT", id, "BCAST", "PREFIX", rs.KeyPrefix); err != nil {
+		cache.closeConns()
+		return nil, fmt.Errorf("error executing CLIENT TRACKING: %v", err)
+	}
+	return sub, nil
+}
+
+//dial dials a new connection that isn't managed by the store's pool
+func (rs *RedisStore) dial() (redis.Conn, error) {
+	if rs.pool.DialContext != nil {
+		return rs.pool.DialContext(context.Background())
+	}
+	return rs.pool.Dial()
+}
+
+//get returns the cached state for the key, if any
+func (c *clientCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	entry, found := c.entries[key]
+	if !found || entry.state == nil || !c.connected {
+		return nil, false
+	}
+	return entry.state, true
+}
+
+//reserve adds an empty entry for the key, to be filled once its state is
+//read from redis, unless the state is invalidated first. It returns nil
+//if the cache isn't connected.
+func (c *clientCache) reserve(key string) *clientCacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if !c.connected {
+		return nil
+	}
+	if len(c.entries) >= c.maxEntries {
+		//evict an arbitrary entry, as map iteration order is random
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	entry := &clientCacheEntry{}
+	c.entries[key] = entry
+	return entry
+}
+
+//fill sets the state of the entry returned by reserve, as long as
+//the entry hasn't been invalidated since it was reserved
+func (c *clientCache) fill(key string, entry *clientCacheEntry, state []byte) {
+	if c == nil || entry == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.entries[key] == entry {
+		entry.state = state
+	}
+}
+
+//invalidate removes the keys from the cache
+func (c *clientCache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+//reset removes all entries from the cache, and sets whether it's connected
+func (c *clientCache) reset(connected bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.entries = make(map[string]*clientCacheEntry)
+	c.connected = connected && !c.stopped
+}
+
+//listen receives invalidation messages from conn, removing the invalidated
+//keys from the cache, until receiving fails
+func (c *clientCache) listen(conn redis.Conn) error {
+	for {
+		reply, err := redis.Values(conn.Receive())
+		if err != nil {
+			return err
+		}
+		if len(reply) != 3 {
+			continue
+		}
+		if kind, _ := redis.String(reply[0], nil); kind != "message" {
+			continue
+		}
+		//a nil list of keys means the whole database was flushed
+		keys, err := redis.Strings(reply[2], nil)
+		if err == redis.ErrNil {
+			c.reset(true)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading invalidation message: %v", err)
+		}
+		c.invalidate(keys...)
+	}
+}
+
+//setConns records the cache's current connections, so that they can be
+//closed when it's stopped. If it has already been stopped, the connections
+//are closed and false is returned.
+func (c *clientCache) setConns(conns ...redis.Conn) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.closeConnsLocked()
+	c.conns = conns
+	if c.stopped {
+		c.closeConnsLocked()
+		return false
+	}
+	return true
+}
+
+//closeConns closes the cache's current connections
+func (c *clientCache) closeConns() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.closeConnsLocked()
+}
+
+//closeConnsLocked is like closeConns, but the caller must hold the lock
+func (c *clientCache) closeConnsLocked() {
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+}
+
+//stop disconnects and clears the cache, and closes its connections
+func (c *clientCache) stop() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.stopped = true
+	c.connected = false
+	c.entries = make(map[string]*clientCacheEntry)
+	c.closeConnsLocked()
+}
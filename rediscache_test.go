@@ -0,0 +1,147 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rafaeljusto/redigomock"
+)
+
+func newTestClientCache(maxEntries int) *clientCache {
+	return &clientCache{
+		entries:    make(map[string]*clientCacheEntry),
+		maxEntries: maxEntries,
+		connected:  true,
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	cache := newTestClientCache(2)
+	entry := cache.reserve("a")
+	if _, found := cache.get("a"); found {
+		t.Error("reserved entry was found before it was filled")
+	}
+	cache.fill("a", entry, []byte("state a"))
+	if state, found := cache.get("a"); !found || string(state) != "state a" {
+		t.Errorf("incorrect result: expected %s, %t but got %s, %t", "state a", true, state, found)
+	}
+	cache.invalidate("a")
+	if _, found := cache.get("a"); found {
+		t.Error("invalidated entry was found")
+	}
+
+	//entries invalidated while they're being read shouldn't be filled
+	entry = cache.reserve("b")
+	cache.invalidate("b")
+	cache.fill("b", entry, []byte("stale state"))
+	if _, found := cache.get("b"); found {
+		t.Error("entry invalidated before it was filled was found")
+	}
+
+	for _, key := range []string{"c", "d", "e"} {
+		cache.fill(key, cache.reserve(key), []byte(key))
+	}
+	if n := len(cache.entries); n != 2 {
+		t.Errorf("incorrect number of entries: expected 2 but got %d", n)
+	}
+
+	//nothing should be cached while disconnected
+	cache.reset(false)
+	if entry := cache.reserve("f"); entry != nil {
+		t.Error("entry was reserved while disconnected")
+	}
+
+	var nilCache *clientCache
+	nilCache.fill("a", nilCache.reserve("a"), []byte("state a"))
+	nilCache.invalidate("a")
+	if _, found := nilCache.get("a"); found {
+		t.Error("entry was found in nil cache")
+	}
+}
+
+func TestClientCacheListen(t *testing.T) {
+	cache := newTestClientCache(10)
+	for _, key := range []string{"sid:a", "sid:b", "sid:c"} {
+		cache.fill(key, cache.reserve(key), []byte(key))
+	}
+	conn := redigomock.NewConn()
+	conn.AddSubscriptionMessage([]interface{}{[]byte("message"), []byte(redisInvalidateChannel), []interface{}{[]byte("sid:a"), []byte("sid:b")}})
+	if err := cache.listen(conn); err == nil {
+		t.Error("did not receive expected error after the last message")
+	}
+	if _, found := cache.get("sid:a"); found {
+		t.Error("invalidated entry was found")
+	}
+	if _, found := cache.get("sid:c"); !found {
+		t.Error("entry that wasn't invalidated was not found")
+	}
+
+	//a nil list of keys means everything was flushed
+	conn.AddSubscriptionMessage([]interface{}{[]byte("message"), []byte(redisInvalidateChannel), nil})
+	cache.listen(conn)
+	if _, found := cache.get("sid:c"); found {
+		t.Error("entry was found after flush")
+	}
+}
+
+func TestRedisStoreClientCache(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	buf, err := encodeState("test state")
+	if err != nil {
+		t.Fatalf("unexpected error encoding state: %v", err)
+	}
+	conn := redigomock.NewConn()
+	store := NewRedisStore(getMockPool(conn), time.Hour)
+	store.RefreshInterval = time.Minute
+	store.cache = newTestClientCache(10)
+	key := store.getRedisKey(token)
+	conn.Command("SETEX", key, time.Hour.Seconds(), buf).Expect("OK")
+	get := conn.Command("GET", key).Expect(buf)
+
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	for i := 0; i < 3; i++ {
+		if err := store.Get(token, &state); err != nil || state != "test state" {
+			t.Fatalf("incorrect result: expected %s, %v but got %s, %v", "test state", nil, state, err)
+		}
+	}
+	if n := conn.Stats(get); n != 1 {
+		t.Errorf("incorrect number of GET commands: expected 1 but got %d", n)
+	}
+
+	//saving should invalidate the cached state
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Get(token, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if n := conn.Stats(get); n != 2 {
+		t.Errorf("incorrect number of GET commands: expected 2 but got %d", n)
+	}
+}
+
+func TestRedisStoreEnableClientCacheUnsupported(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	if _, err := store.EnableClientCache(0); err == nil {
+		t.Error("did not receive expected error enabling client cache without support")
+	}
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	var state string
+	if err := store.Get(token, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//DefaultRedisUserIndexPrefix is a suggested value for the UserIndexPrefix
+//of a RedisStore, which keeps the index keys separate from session keys
+const DefaultRedisUserIndexPrefix = "uid:"
+
+//ErrUserIndexDisabled is returned from UserSessions and UserUsage when
+//the RedisStore's UserIndexPrefix is empty
+var ErrUserIndexDisabled = errors.New("user index is not enabled")
+
+//QuotaExceededError is returned by a RedisStore with a UserQuota when
+//saving session state would exceed the quota of the session's user
+type QuotaExceededError struct {
+	//UserID is the ID of the session's user
+	UserID string
+	//Used is the total size in bytes of the encoded
+	//state of the user's other sessions
+	Used int
+	//Size is the size in bytes of the encoded state being saved
+	Size int
+	//Quota is the UserQuota
+	Quota int
+}
+
+//Error returns the error message
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("saving %d bytes of session state would exceed the quota of %d bytes for user %s, who is using %d",
+		e.Size, e.Quota, e.UserID, e.Used)
+}
+
+//redisUserKeySuffix is appended to the keys of sessions in the user index
+//to form the keys that record their user IDs, so that the user's hash can
+//be kept for as long as the session when it is read or touched, which
+//doesn't decode its state
+const redisUserKeySuffix = ":uid"
+
+//saveWithinQuotaScriptSrc saves session state and adds it to the user
+//index, but only if the total size of the user's session state would then
+//be within the quota. Sessions whose state no longer exists are removed from
+//the index while their sizes are totalled. It returns -1 if the state was
+//saved, or the total size of the user's other sessions if it wasn't.
+//The index is kept for at least as long as the session, but its expiry
+//time is never shortened, as it must outlive all of the user's sessions
+//for the quota to be enforced. KEYS[1] is the session key, KEYS[2] the user index key, and KEYS[3], if
+//present, the expiry index key. ARGV is the session duration, the encoded
+//state, the session ID, the quota, the session key prefix, the expiry
+//index score, the key recording the session's user ID, and the user ID.
+const saveWithinQuotaScriptSrc = `
+local used = 0
+local sizes = redis.call("HGETALL", KEYS[2])
+for i = 1, #sizes, 2 do
+	if sizes[i] ~= ARGV[3] then
+		if redis.call("EXISTS", ARGV[5] .. sizes[i]) == 1 then
+			used = used + tonumber(sizes[i + 1])
+		else
+			redis.call("HDEL", KEYS[2], sizes[i])
+		end
+	end
+end
+local size = string.len(ARGV[2])
+if used + size > tonumber(ARGV[4]) then
+	return used
+end
+redis.call("SETEX", KEYS[1], ARGV[1], ARGV[2])
+redis.call("HSET", KEYS[2], ARGV[3], size)
+if redis.call("TTL", KEYS[2]) < tonumber(ARGV[1]) then
+	redis.call("EXPIRE", KEYS[2], ARGV[1])
+end
+redis.call("SETEX", ARGV[7], ARGV[1], ARGV[8])
+if #KEYS > 2 then
+	redis.call("ZADD", KEYS[3], ARGV[6], ARGV[3])
+end
+return -1`
+
+var saveWithinQuotaScript = redis.NewScript(-1, saveWithinQuotaScriptSrc)
+
+//touchUserScriptSrc resets the expiry time of the key recording the user
+//ID of a session in the user index, and extends the expiry time of the
+//user's hash to match, if it would otherwise expire first, so that the hash
+//is kept for as long as any of the user's sessions. KEYS[1] is the key
+//recording the user ID, and ARGV is the expiry time in milliseconds and
+//the user index prefix.
+const touchUserScriptSrc = `
+local userID = redis.call("GET", KEYS[1])
+if not userID then
+	return 0
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+local userKey = ARGV[2] .. userID
+if redis.call("PTTL", userKey) < tonumber(ARGV[1]) then
+	redis.call("PEXPIRE", userKey, ARGV[1])
+end
+return 1`
+
+var touchUserScript = redis.NewScript(1, touchUserScriptSrc)
+
+//getIndexedUserID returns the ID of the user of the session state, or an
+//empty string if the store doesn't keep a user index, or the state doesn't
+//identify a user
+func (rs *RedisStore) getIndexedUserID(sessionState interface{}) string {
+	if len(rs.UserIndexPrefix) == 0 {
+		return ""
+	}
+	switch state := sessionState.(type) {
+	case *envelope:
+		return state.UserID
+	case UserIdentifier:
+		return state.SessionUserID()
+	}
+	return ""
+}
+
+//sendIndexUser sends the commands that add the token's session ID and the
+//size of its state to the user's index hash, record the session's user ID,
+//and keep both for as long as the session
+func (rs *RedisStore) sendIndexUser(conn redis.Conn, userID string, token Token, size int) {
+	conn.Send("HSET", rs.UserIndexPrefix+userID, token.ID().String(), size)
+	conn.Send("EXPIRE", rs.UserIndexPrefix+userID, rs.SessionDuration.Seconds())
+	conn.Send("SETEX", rs.getUserIDKey(token), rs.SessionDuration.Seconds(), userID)
+}
+
+//sendTouchUser sends the command that keeps the user's index hash for at
+//least ttl, now that the token's session will expire ttl from now, if the
+//store keeps a user index. It reports whether the command was sent.
+func (rs *RedisStore) sendTouchUser(conn redis.Conn, token Token, ttl time.Duration) bool {
+	if len(rs.UserIndexPrefix) == 0 {
+		return false
+	}
+	touchUserScript.Send(conn, rs.getUserIDKey(token), ttl.Milliseconds(), rs.UserIndexPrefix)
+	return true
+}
+
+//getUserIDKey returns the redis key that records
+//the user ID of the token's session
+func (rs *RedisStore) getUserIDKey(token Token) string {
+	return rs.getRedisKey(token) + redisUserKeySuffix
+}
+
+//saveWithinQuota saves the encoded state and updates the indexes using
+//saveWithinQuotaScript, returning a *QuotaExceededError if the user's
+//quota would be exceeded
+func (rs *RedisStore) saveWithinQuota(ctx context.Context, conn redis.Conn, token Token, userID string, buf []byte) error {
+	keysAndArgs := []interface{}{2, rs.getRedisKey(token), rs.UserIndexPrefix + userID}
+	if len(rs.ExpiryIndexKey) > 0 {
+		keysAndArgs = append(keysAndArgs, rs.ExpiryIndexKey)
+		keysAndArgs[0] = 3
+	}
+	expires := time.Now().Add(rs.SessionDuration).UnixNano() / int64(time.Millisecond)
+	keysAndArgs = append(keysAndArgs, rs.SessionDuration.Seconds(), buf, token.ID().String(),
+		rs.UserQuota, rs.KeyPrefix, expires, rs.getUserIDKey(token), userID)
+	used, err := redis.Int(saveWithinQuotaScript.DoContext(ctx, conn, keysAndArgs...))
+	if err != nil {
+		return fmt.Errorf("error executing save script: %v", err)
+	}
+	if used >= 0 {
+		return &QuotaExceededError{UserID: userID, Used: used, Size: len(buf), Quota: rs.UserQuota}
+	}
+	return nil
+}
+
+//UserSessions returns the IDs of the user's sessions that still have
+//state in the store, using the index kept when UserIndexPrefix is set.
+//Deleted and expired sessions are removed from the index as they're found,
+//as the index isn't updated when sessions are deleted or expire.
+func (rs *RedisStore) UserSessions(userID string) ([]string, error) {
+	sizes, err := rs.userSessionSizes(userID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range sizes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+//UserUsage returns the total size in bytes of the encoded state of
+//the user's sessions, using the index kept when UserIndexPrefix is set
+func (rs *RedisStore) UserUsage(userID string) (int, error) {
+	sizes, err := rs.userSessionSizes(userID)
+	if err != nil {
+		return 0, err
+	}
+	used := 0
+	for _, size := range sizes {
+		used += size
+	}
+	return used, nil
+}
+
+//userSessionSizes returns the sizes of the state of the user's sessions,
+//keyed by session ID, removing sessions whose state no longer exists
+//from the user's index
+func (rs *RedisStore) userSessionSizes(userID string) (map[string]int, error) {
+	if len(rs.UserIndexPrefix) == 0 {
+		return nil, ErrUserIndexDisabled
+	}
+	userKey := rs.UserIndexPrefix + userID
+	conn := rs.pool.Get()
+	defer conn.Close()
+	sizes, err := redis.IntMap(conn.Do("HGETALL", userKey))
+	if err != nil {
+		return nil, fmt.Errorf("error executing HGETALL: %v", err)
+	}
+	if len(sizes) == 0 {
+		return sizes, nil
+	}
+
+	//pipeline EXISTS commands for each session
+	ids := make([]string, 0, len(sizes))
+	for id := range sizes {
+		ids = append(ids, id)
+		conn.Send("EXISTS", rs.KeyPrefix+id)
+	}
+	conn.Flush()
+	var removed []interface{}
+	for _, id := range ids {
+		exists, err := redis.Bool(conn.Receive())
+		if err != nil {
+			return nil, fmt.Errorf("error executing EXISTS: %v", err)
+		}
+		if !exists {
+			removed = append(removed, id)
+			delete(sizes, id)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := conn.Do("HDEL", append([]interface{}{userKey}, removed...)...); err != nil {
+			return nil, fmt.Errorf("error executing HDEL: %v", err)
+		}
+	}
+	return sizes, nil
+}
+
+//ErrExpiryIndexDisabled is returned from ExpiringSessions and
+//SweepExpired when the RedisStore's ExpiryIndexKey is empty
+var ErrExpiryIndexDisabled = errors.New("expiry index is not enabled")
+
+//sendIndexExpiry sends the command that sets the token's score in the
+//expiry index to when its state will now expire, if the store keeps an
+//expiry index. If existing is true, the session is only updated if it's
+//already in the index, so that sessions whose state may not exist aren't added.
+func (rs *RedisStore) sendIndexExpiry(conn redis.Conn, token Token, existing bool) {
+	rs.sendIndexExpiryAt(conn, token, existing, time.Now().Add(rs.SessionDuration))
+}
+
+//sendIndexExpiryAt is like sendIndexExpiry, but records
+//that the session expires at the expires time
+func (rs *RedisStore) sendIndexExpiryAt(conn redis.Conn, token Token, existing bool, expires time.Time) {
+	if len(rs.ExpiryIndexKey) == 0 {
+		return
+	}
+	args := []interface{}{rs.ExpiryIndexKey}
+	if existing {
+		args = append(args, "XX")
+	}
+	conn.Send("ZADD", append(args, expires.UnixNano()/int64(time.Millisecond), token.ID().String())...)
+}
+
+//ExpiringSessions returns the IDs of sessions whose state will expire
+//within the duration unless they're used again, soonest first, using the
+//index kept when ExpiryIndexKey is set.
+func (rs *RedisStore) ExpiringSessions(within time.Duration) ([]string, error) {
+	if len(rs.ExpiryIndexKey) == 0 {
+		return nil, ErrExpiryIndexDisabled
+	}
+	now := time.Now()
+	conn := rs.pool.Get()
+	defer conn.Close()
+	ids, err := redis.Strings(conn.Do("ZRANGEBYSCORE", rs.ExpiryIndexKey,
+		now.UnixNano()/int64(time.Millisecond), now.Add(within).UnixNano()/int64(time.Millisecond)))
+	if err != nil {
+		return nil, fmt.Errorf("error executing ZRANGEBYSCORE: %v", err)
+	}
+	return ids, nil
+}
+
+//SweepExpired calls fn with the ID of each session in the index kept when
+//ExpiryIndexKey is set whose state has expired, and then removes it from
+//the index, so that resources associated with the session can be cleaned
+//up. Sessions whose state still exists, because the clocks of the processes
+//using the store differ, are left for a later sweep. If fn returns an
+//error, the sweep stops, and the session is left in the index to be tried
+//again. The number of sessions removed from the index is returned.
+func (rs *RedisStore) SweepExpired(fn func(sessionID string) error) (int, error) {
+	if len(rs.ExpiryIndexKey) == 0 {
+		return 0, ErrExpiryIndexDisabled
+	}
+	conn := rs.pool.Get()
+	defer conn.Close()
+	ids, err := redis.Strings(conn.Do("ZRANGEBYSCORE", rs.ExpiryIndexKey,
+		"-inf", time.Now().UnixNano()/int64(time.Millisecond)))
+	if err != nil {
+		return 0, fmt.Errorf("error executing ZRANGEBYSCORE: %v", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	//pipeline EXISTS commands for each session
+	for _, id := range ids {
+		conn.Send("EXISTS", rs.KeyPrefix+id)
+	}
+	conn.Flush()
+	var expired []string
+	for _, id := range ids {
+		exists, err := redis.Bool(conn.Receive())
+		if err != nil {
+			return 0, fmt.Errorf("error executing EXISTS: %v", err)
+		}
+		if !exists {
+			expired = append(expired, id)
+		}
+	}
+
+	removed := 0
+	for _, id := range expired {
+		if err := fn(id); err != nil {
+			return removed, err
+		}
+		if _, err := conn.Do("ZREM", rs.ExpiryIndexKey, id); err != nil {
+			return removed, fmt.Errorf("error executing ZREM: %v", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,274 @@
+package sessions
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStoreUserIndex(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	if _, err := store.UserSessions("user1"); err != ErrUserIndexDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrUserIndexDisabled, err)
+	}
+	store.UserIndexPrefix = DefaultRedisUserIndexPrefix
+
+	var tokens []Token
+	for i := 0; i < 3; i++ {
+		tk, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("unexpected error generating token: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	if err := store.Save(tokens[0], &userState{UserID: "user1"}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Save(tokens[1], &envelope{UserID: "user1"}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	//sessions without a user shouldn't be indexed
+	if err := store.Save(tokens[2], "anonymous"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+
+	ids, err := store.UserSessions("user1")
+	if err != nil {
+		t.Fatalf("unexpected error getting user sessions: %v", err)
+	}
+	sort.Strings(ids)
+	expected := []string{tokens[0].ID().String(), tokens[1].ID().String()}
+	sort.Strings(expected)
+	if len(ids) != 2 || ids[0] != expected[0] || ids[1] != expected[1] {
+		t.Errorf("incorrect sessions: expected %v but got %v", expected, ids)
+	}
+	if ttl := srv.TTL(DefaultRedisUserIndexPrefix + "user1"); ttl != time.Hour {
+		t.Errorf("incorrect index TTL: expected %v but got %v", time.Hour, ttl)
+	}
+
+	//deleted and replaced sessions should be removed from the index
+	if err := store.Delete(tokens[0]); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Replace(tokens[2], &userState{UserID: "user1"}, tokens[1]); err != nil {
+		t.Fatalf("unexpected error replacing state: %v", err)
+	}
+	if ids, err = store.UserSessions("user1"); err != nil {
+		t.Fatalf("unexpected error getting user sessions: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != tokens[2].ID().String() {
+		t.Errorf("incorrect sessions after delete and replace: expected %v but got %v", []string{tokens[2].ID().String()}, ids)
+	}
+	if members, _ := srv.HKeys(DefaultRedisUserIndexPrefix + "user1"); len(members) != 1 {
+		t.Errorf("stale sessions were not removed from index: %v", members)
+	}
+
+	if ids, err = store.UserSessions("nobody"); err != nil || len(ids) != 0 {
+		t.Errorf("incorrect result for user without sessions: expected [], %v but got %v, %v", nil, ids, err)
+	}
+}
+
+func TestRedisStoreUserIndexTTL(t *testing.T) {
+	cases := []struct {
+		name string
+		read func(store *RedisStore, tk Token) error
+	}{
+		{"get", func(store *RedisStore, tk Token) error { return store.Get(tk, &userState{}) }},
+		{"touch", func(store *RedisStore, tk Token) error { return store.Touch(tk) }},
+		{"get and touch", func(store *RedisStore, tk Token) error {
+			return store.GetAndTouch(tk, &userState{}, 0)
+		}},
+	}
+	for _, c := range cases {
+		srv := miniredis.RunT(t)
+		store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+		store.UserIndexPrefix = DefaultRedisUserIndexPrefix
+		tk, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+		}
+		if err := store.Save(tk, &userState{UserID: "user1"}); err != nil {
+			t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+
+		//reading the session should keep the user's hash for as long as it
+		srv.FastForward(40 * time.Minute)
+		if err := c.read(store, tk); err != nil {
+			t.Fatalf("case %s: unexpected error reading state: %v", c.name, err)
+		}
+		if ttl := srv.TTL(DefaultRedisUserIndexPrefix + "user1"); ttl != time.Hour {
+			t.Errorf("case %s: incorrect index TTL: expected %v but got %v", c.name, time.Hour, ttl)
+		}
+		srv.FastForward(40 * time.Minute)
+		if ids, err := store.UserSessions("user1"); err != nil || len(ids) != 1 {
+			t.Errorf("case %s: incorrect sessions after original TTL: expected [%s] but got %v, %v", c.name, tk.ID(), ids, err)
+		}
+
+		//the key recording the user ID is deleted with
+		//the session, and isn't reported by Scan
+		scanned := 0
+		store.Scan(func(Token) error {
+			scanned++
+			return nil
+		})
+		if scanned != 1 {
+			t.Errorf("case %s: incorrect number of scanned sessions: expected 1 but got %d", c.name, scanned)
+		}
+		if err := store.Delete(tk); err != nil {
+			t.Fatalf("case %s: unexpected error deleting state: %v", c.name, err)
+		}
+		if srv.Exists(store.getUserIDKey(tk)) {
+			t.Errorf("case %s: user ID key was not deleted with the session", c.name)
+		}
+	}
+}
+
+func TestRedisStoreUserQuota(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	store.UserIndexPrefix = DefaultRedisUserIndexPrefix
+	store.ExpiryIndexKey = "expiring"
+	buf, err := encodeState(&userState{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("unexpected error encoding state: %v", err)
+	}
+	size := len(buf)
+	store.UserQuota = size * 2
+
+	var tokens []Token
+	for i := 0; i < 3; i++ {
+		tk, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("unexpected error generating token: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	for _, tk := range tokens[:2] {
+		if err := store.Save(tk, &userState{UserID: "user1"}); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	if used, err := store.UserUsage("user1"); err != nil || used != size*2 {
+		t.Errorf("incorrect usage: expected %d, %v but got %d, %v", size*2, nil, used, err)
+	}
+	if members, _ := srv.ZMembers("expiring"); len(members) != 2 {
+		t.Errorf("incorrect number of sessions in expiry index: expected 2 but got %d", len(members))
+	}
+
+	//saving a third session should exceed the quota
+	err = store.Save(tokens[2], &userState{UserID: "user1"})
+	qerr, ok := err.(*QuotaExceededError)
+	if !ok {
+		t.Fatalf("incorrect error: expected *QuotaExceededError but got %v", err)
+	}
+	if qerr.UserID != "user1" || qerr.Used != size*2 || qerr.Size != size || qerr.Quota != size*2 {
+		t.Errorf("incorrect error fields: %+v", qerr)
+	}
+	if srv.Exists(store.getRedisKey(tokens[2])) {
+		t.Error("state exceeding the quota was saved")
+	}
+
+	//re-saving an existing session shouldn't count its previous size
+	if err := store.Save(tokens[0], &userState{UserID: "user1"}); err != nil {
+		t.Errorf("unexpected error re-saving state: %v", err)
+	}
+
+	//deleted sessions shouldn't count towards the quota
+	if err := store.Delete(tokens[1]); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Save(tokens[2], &userState{UserID: "user1"}); err != nil {
+		t.Errorf("unexpected error saving state after delete: %v", err)
+	}
+
+	//reads should keep the index, and so the quota,
+	//in force for as long as the sessions
+	srv.FastForward(40 * time.Minute)
+	for _, tk := range []Token{tokens[0], tokens[2]} {
+		if err := store.Get(tk, &userState{}); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+	}
+	srv.FastForward(40 * time.Minute)
+	if err := store.Save(tokens[1], &userState{UserID: "user1"}); err == nil {
+		t.Error("did not receive expected error saving state after the original index TTL")
+	}
+
+	//other users and sessions without a user have no quota
+	if err := store.Save(tokens[1], &userState{UserID: "user2"}); err != nil {
+		t.Errorf("unexpected error saving state for another user: %v", err)
+	}
+	if err := store.Save(tokens[1], "anonymous"); err != nil {
+		t.Errorf("unexpected error saving anonymous state: %v", err)
+	}
+}
+
+func TestRedisStoreExpiryIndex(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := NewRedisStore(NewRedisPool(srv.Addr(), time.Minute), time.Hour)
+	if _, err := store.ExpiringSessions(time.Minute); err != ErrExpiryIndexDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrExpiryIndexDisabled, err)
+	}
+	if _, err := store.SweepExpired(func(string) error { return nil }); err != ErrExpiryIndexDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrExpiryIndexDisabled, err)
+	}
+	store.ExpiryIndexKey = "expiries"
+	store.SessionDuration = time.Second
+
+	var tokens []Token
+	for i := 0; i < 3; i++ {
+		tk, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("unexpected error generating token: %v", err)
+		}
+		if err := store.Save(tk, "test state"); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	if err := store.Delete(tokens[2]); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	ids, err := store.ExpiringSessions(2 * time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error getting expiring sessions: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("incorrect number of expiring sessions: expected 2 but got %d", len(ids))
+	}
+	if ids, _ = store.ExpiringSessions(time.Millisecond); len(ids) != 0 {
+		t.Errorf("sessions expiring later were returned: %v", ids)
+	}
+
+	//getting a session should push back its expiry time in the index
+	time.Sleep(10 * time.Millisecond)
+	store.SessionDuration = time.Hour
+	var state string
+	if err := store.Get(tokens[1], &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if ids, _ = store.ExpiringSessions(2 * time.Second); len(ids) != 1 || ids[0] != tokens[0].ID().String() {
+		t.Errorf("incorrect expiring sessions: expected %v but got %v", []string{tokens[0].ID().String()}, ids)
+	}
+
+	//once the first session expires, it should be swept
+	time.Sleep(time.Second)
+	srv.FastForward(time.Second)
+	var swept []string
+	n, err := store.SweepExpired(func(sessionID string) error {
+		swept = append(swept, sessionID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error sweeping: %v", err)
+	}
+	if n != 1 || len(swept) != 1 || swept[0] != tokens[0].ID().String() {
+		t.Errorf("incorrect sweep: expected %v but got %d, %v", []string{tokens[0].ID().String()}, n, swept)
+	}
+	if n, _ = store.SweepExpired(func(string) error { return nil }); n != 0 {
+		t.Errorf("incorrect number swept again: expected 0 but got %d", n)
+	}
+}
@@ -0,0 +1,155 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//DefaultReencryptProgressEvery is the default number of
+//sessions ReencryptAll scans between progress reports
+const DefaultReencryptProgressEvery = 1000
+
+//ReencryptProgress reports the progress of ReencryptAll
+type ReencryptProgress struct {
+	//Scanned is the number of sessions scanned so far
+	Scanned int
+	//Reencrypted is the number of sessions re-encrypted so far
+	Reencrypted int
+	//Skipped is the number of sessions that were already
+	//encrypted under the current master key, or that
+	//ended before they could be re-encrypted
+	Skipped int
+	//Failed is the number of sessions that couldn't be re-encrypted
+	Failed int
+	//Elapsed is the time since ReencryptAll started
+	Elapsed time.Duration
+}
+
+//ReencryptOptions controls how ReencryptAll walks the store
+type ReencryptOptions struct {
+	//Rate is the maximum number of sessions re-encrypted per second,
+	//which limits the load on the store. Zero means no limit.
+	Rate float64
+	//Force re-encrypts sessions that are already encrypted
+	//under the current master key, such as after a data key
+	//may have been exposed
+	Force bool
+	//Progress, if set, is called every ProgressEvery sessions,
+	//and once more when the scan completes
+	Progress func(ReencryptProgress)
+	//ProgressEvery is the number of sessions scanned between calls
+	//to Progress. Defaults to DefaultReencryptProgressEvery.
+	ProgressEvery int
+	//OnError, if set, is called with each session
+	//that couldn't be re-encrypted
+	OnError func(token Token, err error)
+}
+
+//Reencrypt decrypts the session's state and encrypts it again with a new
+//data key, wrapped using the current master key. Unlike Rewrap, this
+//replaces the data key, so the old master key and data key can no longer
+//decrypt the state. It reports whether the session was re-encrypted, which
+//is false if it was already wrapped by the current master key, unless force
+//is true. Like Rewrap, an update saved by another request between the read
+//and write performed by Reencrypt may be lost.
+func (es *EncryptedStore) Reencrypt(token Token, force bool) (bool, error) {
+	enc := &encryptedState{}
+	if err := es.store.Get(token, enc); err != nil {
+		return false, err
+	}
+	if enc.KeyID == es.wrapper.KeyID() && !force {
+		return false, nil
+	}
+	state, err := es.decrypt(token, enc)
+	if err != nil {
+		return false, err
+	}
+	if enc, err = es.encrypt(token, state); err != nil {
+		return false, err
+	}
+	if err := es.store.Save(token, enc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//ReencryptAll calls Reencrypt for every session in the underlying store,
+//which must implement Scanner, so that sessions encrypted under old master
+//keys can be migrated to the current one before the old keys are retired.
+//Sessions that can't be re-encrypted are counted as failed, and don't stop
+//the scan, but an error is returned when the scan completes if any failed.
+//Cancelling ctx stops the scan. The final progress is returned.
+func (es *EncryptedStore) ReencryptAll(ctx context.Context, opts ReencryptOptions) (ReencryptProgress, error) {
+	var progress ReencryptProgress
+	scanner, ok := es.store.(Scanner)
+	if !ok {
+		return progress, fmt.Errorf("error re-encrypting sessions: %T does not implement Scanner", es.store)
+	}
+	every := opts.ProgressEvery
+	if every <= 0 {
+		every = DefaultReencryptProgressEvery
+	}
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	start := time.Now()
+	next := start
+	report := func() {
+		progress.Elapsed = time.Since(start)
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	err := scanner.Scan(func(token Token) error {
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+			next = next.Add(interval)
+			if now := time.Now(); next.Before(now) {
+				//don't allow a burst after a slow stretch
+				next = now
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		reencrypted, err := es.Reencrypt(token, opts.Force)
+		progress.Scanned++
+		switch {
+		case err == ErrStateNotFound:
+			progress.Skipped++
+		case err != nil:
+			progress.Failed++
+			if opts.OnError != nil {
+				opts.OnError(token, err)
+			}
+		case reencrypted:
+			progress.Reencrypted++
+		default:
+			progress.Skipped++
+		}
+		if progress.Scanned%every == 0 {
+			report()
+		}
+		return nil
+	})
+	report()
+	if err != nil {
+		return progress, fmt.Errorf("error re-encrypting sessions: %v", err)
+	}
+	if progress.Failed > 0 {
+		return progress, fmt.Errorf("error re-encrypting sessions: %d of %d sessions failed", progress.Failed, progress.Scanned)
+	}
+	return progress, nil
+}
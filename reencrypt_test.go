@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReencryptAll(t *testing.T) {
+	masterKeys := map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}
+	wrapper, err := NewLocalKeyWrapper("k1", masterKeys)
+	if err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	inner := newMockStore(false)
+	store := NewEncryptedStore(inner, wrapper)
+	tokens := make([]Token, 5)
+	for i := range tokens {
+		if tokens[i], err = NewToken(testSigningKey); err != nil {
+			t.Fatalf("unexpected error generating token: %v", err)
+		}
+		if err := store.Save(tokens[i], fmt.Sprintf("state %d", i)); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	//an entry that can't be decrypted should be counted as failed
+	corrupt, _ := NewToken(testSigningKey)
+	inner.entries[corrupt.ID().String()] = inner.entries[tokens[0].ID().String()]
+
+	masterKeys["k2"] = bytes.Repeat([]byte{2}, 32)
+	if store.wrapper, err = NewLocalKeyWrapper("k2", masterKeys); err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	//re-encrypt one session ahead of the batch,
+	//which should then skip it
+	if ok, err := store.Reencrypt(tokens[0], false); err != nil || !ok {
+		t.Fatalf("incorrect result re-encrypting session: expected true, <nil> but got %t, %v", ok, err)
+	}
+
+	var reports []ReencryptProgress
+	var failed []Token
+	progress, err := store.ReencryptAll(context.Background(), ReencryptOptions{
+		Rate:          200,
+		ProgressEvery: 2,
+		Progress:      func(p ReencryptProgress) { reports = append(reports, p) },
+		OnError:       func(token Token, err error) { failed = append(failed, token) },
+	})
+	if err == nil {
+		t.Error("did not receive expected error for session that failed to re-encrypt")
+	}
+	expected := ReencryptProgress{Scanned: 6, Reencrypted: 4, Skipped: 1, Failed: 1}
+	progress.Elapsed = 0
+	if progress != expected {
+		t.Errorf("incorrect progress: expected %+v but got %+v", expected, progress)
+	}
+	if len(reports) != 4 {
+		t.Errorf("incorrect number of progress reports: expected 4 but got %d", len(reports))
+	}
+	if len(failed) != 1 || failed[0].ID().String() != corrupt.ID().String() {
+		t.Errorf("incorrect failed sessions: %v", failed)
+	}
+	//rate limiting should space out the six sessions
+	if last := reports[len(reports)-1]; last.Elapsed < 20*time.Millisecond {
+		t.Errorf("re-encryption was not rate limited: took %v", last.Elapsed)
+	}
+
+	//the old master key should no longer be needed
+	delete(masterKeys, "k1")
+	if store.wrapper, err = NewLocalKeyWrapper("k2", masterKeys); err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	for i, tk := range tokens {
+		var state string
+		if err := store.Get(tk, &state); err != nil || state != fmt.Sprintf("state %d", i) {
+			t.Errorf("incorrect state after re-encryption: expected state %d, <nil> but got %s, %v", i, state, err)
+		}
+	}
+
+	//forcing re-encryption should replace data keys
+	//even when they are wrapped by the current master key
+	before := append([]byte(nil), inner.entries[tokens[1].ID().String()]...)
+	if ok, err := store.Reencrypt(tokens[1], true); err != nil || !ok {
+		t.Errorf("incorrect result forcing re-encryption: expected true, <nil> but got %t, %v", ok, err)
+	}
+	if bytes.Equal(before, inner.entries[tokens[1].ID().String()]) {
+		t.Error("forced re-encryption did not change the stored state")
+	}
+
+	//cancelling the context should stop the scan
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.ReencryptAll(ctx, ReencryptOptions{Force: true}); err == nil {
+		t.Error("did not receive expected error when context was cancelled")
+	}
+
+	//re-encrypting requires a Scanner
+	if _, err := NewEncryptedStore(struct{ Store }{inner}, wrapper).ReencryptAll(context.Background(), ReencryptOptions{}); err == nil {
+		t.Error("did not receive expected error when re-encrypting a store that isn't a Scanner")
+	}
+}
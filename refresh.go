@@ -0,0 +1,83 @@
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+//refreshSweepInterval is the number of refreshes recorded
+//between sweeps of the tracker's stale entries
+const refreshSweepInterval = 1024
+
+//refreshTracker tracks when each session's expiry time was last
+//refreshed by this process, so that stores can skip refreshing it
+//again until an interval has passed
+type refreshTracker struct {
+	mx        sync.Mutex
+	refreshed map[string]time.Time
+	records   int
+}
+
+//newRefreshTracker constructs a new refreshTracker
+func newRefreshTracker() *refreshTracker {
+	return &refreshTracker{refreshed: make(map[string]time.Time)}
+}
+
+//due reports whether the expiry time of the session with the key
+//should be refreshed now, because it hasn't been refreshed by this
+//process within the interval, and if so records that it was refreshed.
+//If interval is zero or negative, due always returns true.
+func (rt *refreshTracker) due(key string, interval time.Duration) bool {
+	if interval <= 0 {
+		return true
+	}
+	now := time.Now()
+	rt.mx.Lock()
+	defer rt.mx.Unlock()
+	if last, found := rt.refreshed[key]; found && now.Sub(last) < interval {
+		return false
+	}
+	rt.markLocked(key, now, interval)
+	return true
+}
+
+//mark records that the expiry time of the session with the key was
+//just refreshed, such as when its state was saved. If interval is
+//zero or negative, nothing is recorded.
+func (rt *refreshTracker) mark(key string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	rt.mx.Lock()
+	defer rt.mx.Unlock()
+	rt.markLocked(key, time.Now(), interval)
+}
+
+//markLocked is like mark, but the caller must hold the lock. Every
+//refreshSweepInterval records, entries older than the interval are
+//removed, since they would be refreshed on their next use anyway.
+func (rt *refreshTracker) markLocked(key string, now time.Time, interval time.Duration) {
+	rt.refreshed[key] = now
+	if rt.records++; rt.records%refreshSweepInterval == 0 {
+		for k, last := range rt.refreshed {
+			if now.Sub(last) >= interval {
+				delete(rt.refreshed, k)
+			}
+		}
+	}
+}
+
+//forget removes the session with the key from the tracker,
+//such as when its state is deleted or not found
+func (rt *refreshTracker) forget(key string) {
+	rt.mx.Lock()
+	defer rt.mx.Unlock()
+	delete(rt.refreshed, key)
+}
+
+//len returns the number of sessions being tracked
+func (rt *refreshTracker) len() int {
+	rt.mx.Lock()
+	defer rt.mx.Unlock()
+	return len(rt.refreshed)
+}
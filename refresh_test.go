@@ -0,0 +1,44 @@
+package sessions
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRefreshTracker(t *testing.T) {
+	rt := newRefreshTracker()
+	if !rt.due("a", 0) || !rt.due("a", 0) || rt.len() != 0 {
+		t.Error("refresh was not always due with no interval")
+	}
+	if !rt.due("a", time.Hour) {
+		t.Error("refresh was not due for new session")
+	}
+	if rt.due("a", time.Hour) {
+		t.Error("refresh was due again within the interval")
+	}
+	if !rt.due("a", time.Nanosecond) {
+		t.Error("refresh was not due after the interval")
+	}
+	rt.mark("b", time.Hour)
+	if rt.due("b", time.Hour) {
+		t.Error("refresh was due for marked session")
+	}
+	rt.forget("b")
+	if !rt.due("b", time.Hour) {
+		t.Error("refresh was not due for forgotten session")
+	}
+}
+
+func TestRefreshTrackerSweep(t *testing.T) {
+	rt := newRefreshTracker()
+	for i := 0; i < refreshSweepInterval-1; i++ {
+		rt.mark(fmt.Sprintf("stale%d", i), time.Hour)
+	}
+	//with a tiny interval, all the previous entries are stale
+	time.Sleep(time.Millisecond)
+	rt.mark("fresh", time.Millisecond)
+	if n := rt.len(); n != 1 {
+		t.Errorf("incorrect number of entries after sweep: expected 1 but got %d", n)
+	}
+}
@@ -0,0 +1,283 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//ReplicationMode controls how ReplicatedStore writes to its secondary stores
+type ReplicationMode int
+
+const (
+	//SyncReplication writes to the primary and all secondaries
+	//concurrently, and waits for all writes to complete
+	SyncReplication ReplicationMode = iota
+	//AsyncReplication writes to the primary, and queues the writes
+	//to the secondaries, which are performed in the background
+	AsyncReplication
+)
+
+//replicationQueueSize is the number of asynchronous writes that may
+//be queued for each secondary before further writes block
+const replicationQueueSize = 1024
+
+//ReplicatedStore is a Store that writes session state to a primary
+//and one or more secondary stores, and reads from the primary, falling
+//back to the secondaries in order if the primary fails. Use this when
+//sessions need to survive the loss of a whole cache cluster.
+//
+//Reads don't fall back to the secondaries when the primary reports
+//ErrStateNotFound, and deletes must succeed on the primary, so that
+//ended sessions can't be resumed from a secondary that missed the delete.
+type ReplicatedStore struct {
+	//OnAsyncError is called with any errors that occur while
+	//writing to secondaries asynchronously. Callers may set
+	//this after construction.
+	OnAsyncError func(err error)
+	primary      Store
+	secondaries  []Store
+	mode         ReplicationMode
+	queues       []chan func() error
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+}
+
+//NewReplicatedStore constructs a new ReplicatedStore that replicates
+//writes to the secondaries using mode. When using AsyncReplication,
+//call Close or CloseContext to flush pending writes before the process exits.
+func NewReplicatedStore(mode ReplicationMode, primary Store, secondaries ...Store) *ReplicatedStore {
+	rs := &ReplicatedStore{
+		primary:     primary,
+		secondaries: secondaries,
+		mode:        mode,
+	}
+	if mode == AsyncReplication {
+		//each secondary gets its own queue and worker,
+		//so that writes are applied in order
+		rs.queues = make([]chan func() error, len(secondaries))
+		for i := range secondaries {
+			rs.queues[i] = make(chan func() error, replicationQueueSize)
+			rs.wg.Add(1)
+			go rs.replicate(rs.queues[i])
+		}
+	}
+	return rs
+}
+
+//Save saves the session state to the primary and secondaries.
+//With SyncReplication, an error is returned only if the write failed
+//on every store, so that sessions can still begin while a cluster is
+//down. With AsyncReplication, the primary's error is returned, and the
+//state is copied using the DefaultCodec before the writes to the
+//secondaries are queued, so it may be changed after Save returns.
+func (rs *ReplicatedStore) Save(token Token, sessionState interface{}) error {
+	return rs.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the session state from the primary, or from the
+//first secondary that has it if the primary fails.
+func (rs *ReplicatedStore) Get(token Token, sessionState interface{}) error {
+	return rs.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the session state from the primary and secondaries.
+//An error is returned if the delete failed on the primary, whatever the
+//result on the secondaries.
+func (rs *ReplicatedStore) Delete(token Token) error {
+	return rs.DeleteContext(context.Background(), token)
+}
+
+//SaveContext is like Save, but respects the context
+func (rs *ReplicatedStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	state, err := rs.queuedState(sessionState)
+	if err != nil {
+		return err
+	}
+	return rs.write(ctx, false, func(ctx context.Context, s Store) error {
+		return saveContext(ctx, s, token, state)
+	})
+}
+
+//GetContext is like Get, but respects the context
+func (rs *ReplicatedStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return rs.read(func(s Store) error {
+		return getContext(ctx, s, token, sessionState)
+	})
+}
+
+//DeleteContext is like Delete, but respects the context
+func (rs *ReplicatedStore) DeleteContext(ctx context.Context, token Token) error {
+	return rs.write(ctx, true, func(ctx context.Context, s Store) error {
+		return deleteContext(ctx, s, token)
+	})
+}
+
+//Ping pings the primary store
+func (rs *ReplicatedStore) Ping(ctx context.Context) error {
+	return ping(ctx, rs.primary)
+}
+
+//Peek peeks at the session state in the primary, or in the
+//first secondary that has it if the primary fails
+func (rs *ReplicatedStore) Peek(token Token, sessionState interface{}) error {
+	return rs.read(func(s Store) error {
+		return peek(s, token, sessionState)
+	})
+}
+
+//GetAndTouch gets and touches the session state in the primary,
+//or in the first secondary that has it if the primary fails.
+//The state is read from only one store, so only that store's TTL is reset.
+func (rs *ReplicatedStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return rs.read(func(s Store) error {
+		return getAndTouch(s, token, sessionState, ttl)
+	})
+}
+
+//Touch touches the session state in the primary and secondaries,
+//following the same rules as Save
+func (rs *ReplicatedStore) Touch(token Token) error {
+	return rs.write(context.Background(), false, func(ctx context.Context, s Store) error {
+		return touch(s, token)
+	})
+}
+
+//TTL gets the TTL of the session state from the primary,
+//or from the first secondary that has it if the primary fails
+func (rs *ReplicatedStore) TTL(token Token) (time.Duration, error) {
+	var ttl time.Duration
+	err := rs.read(func(s Store) error {
+		var err error
+		ttl, err = storeTTL(s, token)
+		return err
+	})
+	return ttl, err
+}
+
+//Exists checks whether the primary has the session state, or the
+//first secondary that answers if the primary fails
+func (rs *ReplicatedStore) Exists(token Token) (bool, error) {
+	var found bool
+	err := rs.read(func(s Store) error {
+		var err error
+		found, err = exists(s, token)
+		return err
+	})
+	return found, err
+}
+
+//Scan scans the primary store
+func (rs *ReplicatedStore) Scan(fn func(token Token) error) error {
+	return scan(rs.primary, fn)
+}
+
+//Replace replaces the session state in the primary and secondaries,
+//following the same rules as Delete
+func (rs *ReplicatedStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	state, err := rs.queuedState(sessionState)
+	if err != nil {
+		return err
+	}
+	return rs.write(context.Background(), true, func(ctx context.Context, s Store) error {
+		return replace(s, token, state, replaced)
+	})
+}
+
+//Close waits for any queued asynchronous writes to complete,
+//and stops the background workers. The store may not be
+//written to after it is closed.
+func (rs *ReplicatedStore) Close() error {
+	return rs.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done,
+//returning its error, while the queued writes continue in the background
+func (rs *ReplicatedStore) CloseContext(ctx context.Context) error {
+	rs.closeOnce.Do(func() {
+		for _, q := range rs.queues {
+			close(q)
+		}
+	})
+	return waitContext(ctx, &rs.wg)
+}
+
+//write performs the write operation on the primary and secondaries.
+//If primaryRequired, the primary's error is returned; otherwise, with
+//SyncReplication, an error is returned only if every store failed.
+//Queued writes to the secondaries use a background context, as they
+//outlive the caller's.
+func (rs *ReplicatedStore) write(ctx context.Context, primaryRequired bool, op func(context.Context, Store) error) error {
+	if rs.mode == AsyncReplication {
+		for i, s := range rs.secondaries {
+			s := s
+			rs.queues[i] <- func() error { return op(context.Background(), s) }
+		}
+		return op(ctx, rs.primary)
+	}
+
+	stores := append([]Store{rs.primary}, rs.secondaries...)
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func(i int, s Store) {
+			defer wg.Done()
+			errs[i] = op(ctx, s)
+		}(i, s)
+	}
+	wg.Wait()
+	if primaryRequired {
+		return errs[0]
+	}
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if errs[0] == ErrStateNotFound {
+		//the session doesn't exist, rather than the replicas failing
+		return errs[0]
+	}
+	return fmt.Errorf("error writing to all replicas: %v", errs[0])
+}
+
+//queuedState returns a copy of sessionState to be queued for the
+//secondaries when using AsyncReplication, or sessionState itself
+//when using SyncReplication, as the writes complete before returning
+func (rs *ReplicatedStore) queuedState(sessionState interface{}) (interface{}, error) {
+	if rs.mode != AsyncReplication {
+		return sessionState, nil
+	}
+	encoded, err := encodeState(sessionState)
+	if err != nil {
+		return nil, err
+	}
+	return copyState(sessionState, encoded)
+}
+
+//read performs the read operation on the primary, and then on
+//each secondary in turn until one succeeds. Secondaries aren't
+//read if a store reports ErrStateNotFound, as the session
+//may have been ended while the secondary was unreachable.
+func (rs *ReplicatedStore) read(op func(Store) error) error {
+	err := op(rs.primary)
+	for _, s := range rs.secondaries {
+		if err == nil || err == ErrStateNotFound {
+			break
+		}
+		err = op(s)
+	}
+	return err
+}
+
+//replicate performs queued writes until the queue is closed
+func (rs *ReplicatedStore) replicate(queue chan func() error) {
+	defer rs.wg.Done()
+	for op := range queue {
+		if err := op(); err != nil && rs.OnAsyncError != nil {
+			rs.OnAsyncError(err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package sessions
+
+import (
+	"testing"
+)
+
+func TestReplicatedStoreSync(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	primary := newMockStore(false)
+	secondary := newMockStore(false)
+	store := NewReplicatedStore(SyncReplication, primary, secondary)
+
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if len(primary.entries) != 1 || len(secondary.entries) != 1 {
+		t.Error("state was not saved to all replicas")
+	}
+
+	//reads should fall back to the secondary if the primary fails
+	primary.triggerError = true
+	var state string
+	if err := store.Get(token, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+	if state != "test state" {
+		t.Errorf("incorrect state: expected %s but got %s", "test state", state)
+	}
+
+	//but not if the primary doesn't have it, as it may have been ended
+	primary.triggerError = false
+	primary.entries = make(map[string][]byte)
+	if err := store.Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	secondary.entries = make(map[string][]byte)
+	if err := store.Touch(token); err != ErrStateNotFound {
+		t.Errorf("incorrect error touching state: expected %v but got %v", ErrStateNotFound, err)
+	}
+
+	//saves should succeed as long as one replica succeeds
+	primary.triggerError = true
+	if err := store.Save(token, "test state"); err != nil {
+		t.Errorf("unexpected error saving state: %v", err)
+	}
+
+	//but deletes must succeed on the primary
+	if err := store.Delete(token); err == nil {
+		t.Error("did not receive expected error when the primary fails")
+	}
+	primary.triggerError = false
+	if err := store.Save(token, "test state"); err != nil {
+		t.Errorf("unexpected error saving state: %v", err)
+	}
+	secondary.triggerError = true
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	secondary.triggerError = false
+	if err := store.Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("deleted state was resumed from the secondary: %v", err)
+	}
+
+	//and fail if all replicas fail
+	primary.triggerError = true
+	secondary.triggerError = true
+	if err := store.Save(token, "test state"); err == nil {
+		t.Error("did not receive expected error when all replicas fail")
+	}
+	if err := store.Get(token, &state); err == nil {
+		t.Error("did not receive expected error when all replicas fail")
+	}
+}
+
+func TestReplicatedStoreAsync(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	primary := newMockStore(false)
+	secondary := newMockStore(false)
+	failing := newMockStore(true)
+	store := NewReplicatedStore(AsyncReplication, primary, secondary, failing)
+	var asyncErrs int
+	store.OnAsyncError = func(err error) { asyncErrs++ }
+
+	if err := store.Save(token, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Delete(token); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	updated := "updated state"
+	if err := store.Save(token, &updated); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	//queued writes must not see later changes to the state
+	updated = "changed after save"
+	store.Close()
+
+	//writes should have been applied to the secondary in order
+	var state string
+	if err := secondary.Get(token, &state); err != nil {
+		t.Errorf("unexpected error getting state from secondary: %v", err)
+	}
+	if state != "updated state" {
+		t.Errorf("incorrect state: expected %s but got %s", "updated state", state)
+	}
+	if asyncErrs != 3 {
+		t.Errorf("incorrect number of async errors: expected 3 but got %d", asyncErrs)
+	}
+
+	//primary errors should be returned
+	primary.triggerError = true
+	store = NewReplicatedStore(AsyncReplication, primary, secondary)
+	defer store.Close()
+	if err := store.Save(token, "test state"); err == nil {
+		t.Error("did not receive expected error from primary")
+	}
+}
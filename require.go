@@ -0,0 +1,254 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//ResponseFormat is the format of the body of responses
+//to requests that Require rejects
+type ResponseFormat int
+
+const (
+	//FormatText responds with a plain-text message
+	FormatText ResponseFormat = iota
+	//FormatJSON responds with a JSON object containing
+	//"error" and "message" properties, for APIs
+	FormatJSON
+	//FormatHTML responds with a minimal HTML page, for browsers
+	FormatHTML
+	//FormatProblemJSON responds with an RFC 7807 problem details
+	//object, with the error code in its "code" property
+	FormatProblemJSON
+)
+
+//Error codes used in the "error" property of JSON responses from Require
+const (
+	//RequireNoSession means the request had no session token
+	RequireNoSession = "no_session"
+	//RequireInvalidSession means the session token was invalid,
+	//or there was no state for it in the store
+	RequireInvalidSession = "invalid_session"
+	//RequireExpiredSession means the session has expired,
+	//is too old, or was revoked
+	RequireExpiredSession = "expired_session"
+	//RequirePendingSession means the session is a pre-session, which
+	//hasn't completed authentication, or that RequirePreSession was
+	//used and the session is a full session
+	RequirePendingSession = "pending_session"
+	//RequireUnavailable means the session couldn't be checked,
+	//usually because the store is unavailable
+	RequireUnavailable = "session_unavailable"
+	//RequireForbidden means the session is valid, but doesn't
+	//have the role or permission required by RequireRole or
+	//RequirePermission
+	RequireForbidden = "forbidden"
+)
+
+//RequireOptions controls how Require checks sessions,
+//and how it responds to requests it rejects
+type RequireOptions struct {
+	//NewState returns a pointer to a new, empty session state, into
+	//which Require gets the session's state. The state is then added
+	//to the request's context, along with the session token, using
+	//NewContext. If nil, the state is fetched and discarded, which
+	//requires the store to accept a nil sessionState in Get, as
+	//gob-based stores do.
+	NewState func() interface{}
+	//UnauthorizedStatus is the response status code for requests without
+	//a valid, current session. If zero, http.StatusUnauthorized is used.
+	UnauthorizedStatus int
+	//UnavailableStatus is the response status code for requests whose
+	//session can't be checked because the store failed. If zero,
+	//http.StatusServiceUnavailable is used.
+	UnavailableStatus int
+	//ForbiddenStatus is the response status code for requests rejected
+	//by RequireRole or RequirePermission because the session lacks the
+	//required role or permission. If zero, http.StatusForbidden is used.
+	ForbiddenStatus int
+	//Format is the format of the response body
+	Format ResponseFormat
+	//Challenge is the value of the WWW-Authenticate header added to
+	//unauthorized responses, such as `Bearer realm="api"`. If empty,
+	//no WWW-Authenticate header is added.
+	Challenge string
+	//Responder, if non-nil, writes the responses to rejected requests
+	//instead, so that callers can choose the status, headers, and body
+	//for each error code, such as redirecting browsers to a login page.
+	//The other options are then only used by responders that fall back
+	//to the RespondError method of these options.
+	Responder ErrorResponder
+}
+
+//ErrorResponder writes the responses to requests rejected by Require,
+//and the other middleware that checks sessions
+type ErrorResponder interface {
+	//RespondError writes the response to the rejected request, where
+	//code is one of the Require error codes, such as RequireNoSession,
+	//and message is a description of the error
+	RespondError(w http.ResponseWriter, r *http.Request, code string, message string)
+}
+
+//ErrorResponderFunc adapts a function to an ErrorResponder
+type ErrorResponderFunc func(w http.ResponseWriter, r *http.Request, code string, message string)
+
+//RespondError calls the function
+func (fn ErrorResponderFunc) RespondError(w http.ResponseWriter, r *http.Request, code string, message string) {
+	fn(w, r, code, message)
+}
+
+//RedirectToLogin returns an ErrorResponder that redirects GET and HEAD
+//requests without a valid session to loginURL, adding the requested URL
+//as the query parameter named by param, if param is non-empty, so that the
+//login page can send the user back once they sign in. Other rejected
+//requests, such as those that are forbidden or that can't be checked,
+//are passed to fallback, which is usually a RequireOptions.
+func RedirectToLogin(loginURL string, param string, fallback ErrorResponder) ErrorResponder {
+	return ErrorResponderFunc(func(w http.ResponseWriter, r *http.Request, code string, message string) {
+		redirect := r.Method == http.MethodGet || r.Method == http.MethodHead
+		switch code {
+		case RequireNoSession, RequireInvalidSession, RequireExpiredSession:
+		default:
+			redirect = false
+		}
+		if !redirect {
+			fallback.RespondError(w, r, code, message)
+			return
+		}
+		target := loginURL
+		if len(param) > 0 {
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + url.QueryEscape(param) + "=" + url.QueryEscape(r.URL.RequestURI())
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	})
+}
+
+//Require returns a handler that calls next only for requests with a valid,
+//current session, responding to other requests with an error status and
+//body, as controlled by opts. Requests with no session token, or an invalid
+//or expired one, are rejected as unauthorized, while requests whose session
+//can't be checked because the store failed are rejected as unavailable,
+//so that clients don't discard valid sessions during an outage.
+func (m *manager) Require(next http.Handler, opts RequireOptions) http.Handler {
+	return m.require(next, opts, false, nil)
+}
+
+//require is like Require, but requires a pre-session if pending is true,
+//and also rejects sessions for which authorize returns false, if authorize
+//is non-nil
+func (m *manager) require(next http.Handler, opts RequireOptions, pending bool, authorize func(env *envelope) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tk, err := m.GetToken(r)
+		if err == ErrNoToken {
+			opts.reject(w, r, RequireNoSession, "no session token")
+			return
+		}
+		if err == ErrTokenTooOld {
+			opts.reject(w, r, RequireExpiredSession, err.Error())
+			return
+		}
+		if err != nil {
+			opts.reject(w, r, RequireInvalidSession, "invalid session token")
+			return
+		}
+		var state interface{}
+		if opts.NewState != nil {
+			state = opts.NewState()
+		}
+		env, err := m.resumeEnvelope(r, tk, state, pending)
+		if err != nil {
+			code, message := resumeRejection(err)
+			opts.reject(w, r, code, message)
+			return
+		}
+		if authorize != nil && !authorize(env) {
+			opts.reject(w, r, RequireForbidden, "insufficient privileges")
+			return
+		}
+		m.writeExpires(w, tk, env)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), tk, state)))
+	})
+}
+
+//resumeRejection returns the error code and message
+//for an error returned from resumeEnvelope
+func resumeRejection(err error) (string, string) {
+	switch err = getStateError(err); err {
+	case ErrSessionNotFound, ErrSessionInvalid, ErrSessionRejected:
+		return RequireInvalidSession, "invalid session"
+	case ErrSessionTooOld, ErrSessionExpired, ErrSessionRevoked:
+		return RequireExpiredSession, err.Error()
+	case ErrSessionPending, ErrNotPreSession:
+		return RequirePendingSession, err.Error()
+	}
+	return RequireUnavailable, "session could not be checked"
+}
+
+//reject writes the response for a rejected request
+//using the Responder, if any, or RespondError
+func (opts RequireOptions) reject(w http.ResponseWriter, r *http.Request, code string, message string) {
+	if opts.Responder != nil {
+		opts.Responder.RespondError(w, r, code, message)
+		return
+	}
+	opts.RespondError(w, r, code, message)
+}
+
+//RespondError writes the response for a rejected request as controlled by
+//the options, ignoring the Responder, so that RequireOptions is itself an
+//ErrorResponder, which custom ErrorResponders can fall back to
+func (opts RequireOptions) RespondError(w http.ResponseWriter, r *http.Request, code string, message string) {
+	status := opts.UnauthorizedStatus
+	if status == 0 {
+		status = http.StatusUnauthorized
+	}
+	switch code {
+	case RequireUnavailable:
+		status = opts.UnavailableStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+	case RequireForbidden:
+		status = opts.ForbiddenStatus
+		if status == 0 {
+			status = http.StatusForbidden
+		}
+	}
+
+	if status == http.StatusUnauthorized && len(opts.Challenge) > 0 {
+		w.Header().Set("WWW-Authenticate", opts.Challenge)
+	}
+
+	switch opts.Format {
+	case FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": code, "message": message})
+	case FormatProblemJSON:
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":   "about:blank",
+			"title":  http.StatusText(status),
+			"status": status,
+			"detail": message,
+			"code":   code,
+		})
+	case FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		title := html.EscapeString(fmt.Sprintf("%d %s", status, http.StatusText(status)))
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s</title></head><body><h1>%s</h1><p>%s</p></body></html>\n",
+			title, title, html.EscapeString(message))
+	default:
+		http.Error(w, message, status)
+	}
+}
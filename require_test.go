@@ -0,0 +1,144 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestManagerRequire(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithRevocationList(NewMemoryRevocationList()))
+	valid, _ := NewToken(testSigningKey)
+	store.Save(valid, "test state")
+	missing, _ := NewToken(testSigningKey)
+	revoked, _ := NewToken(testSigningKey)
+	store.Save(revoked, "test state")
+	mgr.Revoke(revoked)
+
+	var state interface{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, _ = StateFromContext(r.Context())
+	})
+	newState := func() interface{} { return new(string) }
+
+	cases := []struct {
+		name           string
+		authorization  string
+		triggerError   bool
+		opts           RequireOptions
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"valid session", authTypeBearer + " " + valid.String(), false, RequireOptions{NewState: newState}, http.StatusOK, ""},
+		{"valid session without state", authTypeBearer + " " + valid.String(), false, RequireOptions{}, http.StatusOK, ""},
+		{"no token", "", false, RequireOptions{}, http.StatusUnauthorized, RequireNoSession},
+		{"invalid token", authTypeBearer + " " + modToken(valid.String()), false, RequireOptions{}, http.StatusUnauthorized, RequireInvalidSession},
+		{"missing state", authTypeBearer + " " + missing.String(), false, RequireOptions{}, http.StatusUnauthorized, RequireInvalidSession},
+		{"revoked session", authTypeBearer + " " + revoked.String(), false, RequireOptions{}, http.StatusUnauthorized, RequireExpiredSession},
+		{"store unavailable", authTypeBearer + " " + valid.String(), true, RequireOptions{}, http.StatusServiceUnavailable, RequireUnavailable},
+		{"custom statuses", "", false, RequireOptions{UnauthorizedStatus: http.StatusForbidden}, http.StatusForbidden, RequireNoSession},
+		{"custom unavailable status", authTypeBearer + " " + valid.String(), true, RequireOptions{UnavailableStatus: http.StatusInternalServerError}, http.StatusInternalServerError, RequireUnavailable},
+	}
+
+	for _, c := range cases {
+		for _, format := range []ResponseFormat{FormatText, FormatJSON, FormatHTML, FormatProblemJSON} {
+			state = nil
+			store.triggerError = c.triggerError
+			c.opts.Format = format
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			if len(c.authorization) > 0 {
+				req.Header.Set(headerAuthorization, c.authorization)
+			}
+			respRec := httptest.NewRecorder()
+			mgr.Require(next, c.opts).ServeHTTP(respRec, req)
+			if respRec.Code != c.expectedStatus {
+				t.Errorf("case %s (format %d): incorrect status: expected %d but got %d", c.name, format, c.expectedStatus, respRec.Code)
+				continue
+			}
+			if c.expectedStatus == http.StatusOK {
+				if c.opts.NewState != nil && (state == nil || *state.(*string) != "test state") {
+					t.Errorf("case %s (format %d): incorrect state in context: %v", c.name, format, state)
+				}
+				continue
+			}
+			switch format {
+			case FormatJSON:
+				body := map[string]string{}
+				if err := json.Unmarshal(respRec.Body.Bytes(), &body); err != nil || body["error"] != c.expectedCode {
+					t.Errorf("case %s: incorrect JSON body: %s", c.name, respRec.Body.String())
+				}
+			case FormatProblemJSON:
+				body := map[string]interface{}{}
+				if err := json.Unmarshal(respRec.Body.Bytes(), &body); err != nil ||
+					body["code"] != c.expectedCode || body["status"] != float64(c.expectedStatus) {
+					t.Errorf("case %s: incorrect problem JSON body: %s", c.name, respRec.Body.String())
+				}
+			case FormatHTML:
+				title := fmt.Sprintf("<title>%d %s</title>", c.expectedStatus, http.StatusText(c.expectedStatus))
+				if !strings.Contains(respRec.Body.String(), title) {
+					t.Errorf("case %s: incorrect HTML body: %s", c.name, respRec.Body.String())
+				}
+			}
+		}
+	}
+}
+
+func TestRequireResponder(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	valid, _ := NewToken(testSigningKey)
+	store.Save(valid, "test state")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	fallback := RequireOptions{Format: FormatJSON, Challenge: `Bearer realm="test"`}
+	opts := RequireOptions{Responder: RedirectToLogin("/login", "next", fallback)}
+
+	cases := []struct {
+		name              string
+		method            string
+		authorization     string
+		triggerError      bool
+		expectedStatus    int
+		expectedLocation  string
+		expectedChallenge string
+	}{
+		{"redirect", "GET", "", false, http.StatusSeeOther, "/login?next=%2Fpage%3Fa%3D1", ""},
+		{"redirect invalid", "HEAD", authTypeBearer + " " + modToken(valid.String()), false, http.StatusSeeOther, "/login?next=%2Fpage%3Fa%3D1", ""},
+		{"no redirect for POST", "POST", "", false, http.StatusUnauthorized, "", `Bearer realm="test"`},
+		{"no redirect when unavailable", "GET", authTypeBearer + " " + valid.String(), true, http.StatusServiceUnavailable, "", ""},
+	}
+	for _, c := range cases {
+		store.triggerError = c.triggerError
+		req := httptest.NewRequest(c.method, "http://example.com/page?a=1", nil)
+		if len(c.authorization) > 0 {
+			req.Header.Set(headerAuthorization, c.authorization)
+		}
+		respRec := httptest.NewRecorder()
+		mgr.Require(next, opts).ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+		if location := respRec.Header().Get("Location"); location != c.expectedLocation {
+			t.Errorf("case %s: incorrect location: expected %s but got %s", c.name, c.expectedLocation, location)
+		}
+		if challenge := respRec.Header().Get("WWW-Authenticate"); challenge != c.expectedChallenge {
+			t.Errorf("case %s: incorrect challenge: expected %s but got %s", c.name, c.expectedChallenge, challenge)
+		}
+	}
+
+	//custom responders receive the error code
+	var code string
+	opts = RequireOptions{Responder: ErrorResponderFunc(func(w http.ResponseWriter, r *http.Request, c string, message string) {
+		code = c
+		w.WriteHeader(http.StatusTeapot)
+	})}
+	store.triggerError = false
+	respRec := httptest.NewRecorder()
+	mgr.Require(next, opts).ServeHTTP(respRec, httptest.NewRequest("GET", "http://example.com", nil))
+	if respRec.Code != http.StatusTeapot || code != RequireNoSession {
+		t.Errorf("incorrect response from custom responder: expected %d, %s but got %d, %s", http.StatusTeapot, RequireNoSession, respRec.Code, code)
+	}
+}
@@ -0,0 +1,209 @@
+package sessions
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+//RetryPolicy controls how RetryStore retries failed store operations
+type RetryPolicy struct {
+	//MaxAttempts is the maximum number of attempts for each
+	//operation, including the first one
+	MaxAttempts int
+	//InitialBackoff is the maximum delay before the first retry.
+	//The maximum delay doubles for each subsequent retry, and the
+	//actual delay is a random duration up to that maximum.
+	InitialBackoff time.Duration
+	//MaxBackoff caps the maximum delay between attempts
+	MaxBackoff time.Duration
+	//Retryable reports whether an error is transient, and thus worth
+	//retrying. If nil, all errors are retried except ErrStateNotFound,
+	//ErrCircuitOpen, context.Canceled, context.DeadlineExceeded, and
+	//*CodecError, which retrying won't fix.
+	Retryable func(err error) bool
+}
+
+//DefaultRetryPolicy is a RetryPolicy that should work
+//well for riding out brief redis failovers
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+//retryStore is a Store that retries operations on an inner Store
+type retryStore struct {
+	inner  Store
+	policy RetryPolicy
+}
+
+//RetryStore wraps inner with a Store that retries transient errors
+//using jittered exponential backoff, according to policy. When called
+//through the ContextStore methods, retries stop once the context is
+//done, or when the next delay would exceed the context's deadline.
+func RetryStore(inner Store, policy RetryPolicy) Store {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &retryStore{
+		inner:  inner,
+		policy: policy,
+	}
+}
+
+//Save saves the state, retrying transient errors
+func (rs *retryStore) Save(token Token, sessionState interface{}) error {
+	return rs.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the state, retrying transient errors
+func (rs *retryStore) Get(token Token, sessionState interface{}) error {
+	return rs.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the state, retrying transient errors
+func (rs *retryStore) Delete(token Token) error {
+	return rs.DeleteContext(context.Background(), token)
+}
+
+//SaveContext saves the state, retrying transient errors until the context is done
+func (rs *retryStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return rs.retry(ctx, func() error {
+		return saveContext(ctx, rs.inner, token, sessionState)
+	})
+}
+
+//GetContext gets the state, retrying transient errors until the context is done
+func (rs *retryStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return rs.retry(ctx, func() error {
+		return getContext(ctx, rs.inner, token, sessionState)
+	})
+}
+
+//DeleteContext deletes the state, retrying transient errors until the context is done
+func (rs *retryStore) DeleteContext(ctx context.Context, token Token) error {
+	return rs.retry(ctx, func() error {
+		return deleteContext(ctx, rs.inner, token)
+	})
+}
+
+//Ping pings the inner store
+func (rs *retryStore) Ping(ctx context.Context) error {
+	return ping(ctx, rs.inner)
+}
+
+//Peek peeks at the state, retrying transient errors
+func (rs *retryStore) Peek(token Token, sessionState interface{}) error {
+	if _, ok := rs.inner.(Peeker); !ok {
+		return ErrPeekNotSupported
+	}
+	return rs.retry(context.Background(), func() error {
+		return peek(rs.inner, token, sessionState)
+	})
+}
+
+//GetAndTouch gets and touches the state, retrying transient errors
+func (rs *retryStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return rs.retry(context.Background(), func() error {
+		return getAndTouch(rs.inner, token, sessionState, ttl)
+	})
+}
+
+//Touch touches the state, retrying transient errors
+func (rs *retryStore) Touch(token Token) error {
+	return rs.retry(context.Background(), func() error {
+		return touch(rs.inner, token)
+	})
+}
+
+//TTL gets the TTL of the state, retrying transient errors
+func (rs *retryStore) TTL(token Token) (time.Duration, error) {
+	var ttl time.Duration
+	err := rs.retry(context.Background(), func() error {
+		var err error
+		ttl, err = storeTTL(rs.inner, token)
+		return err
+	})
+	return ttl, err
+}
+
+//Exists checks whether the inner store has the state, retrying transient errors
+func (rs *retryStore) Exists(token Token) (bool, error) {
+	var found bool
+	err := rs.retry(context.Background(), func() error {
+		var err error
+		found, err = exists(rs.inner, token)
+		return err
+	})
+	return found, err
+}
+
+//Scan scans the inner store. Scans aren't retried, as
+//fn may already have been called for some sessions.
+func (rs *retryStore) Scan(fn func(token Token) error) error {
+	return scan(rs.inner, fn)
+}
+
+//Replace replaces the state, retrying transient errors
+func (rs *retryStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	return rs.retry(context.Background(), func() error {
+		return replace(rs.inner, token, sessionState, replaced)
+	})
+}
+
+//retry calls op until it succeeds, returns a non-retryable error,
+//the attempts are exhausted, or the context is done
+func (rs *retryStore) retry(ctx context.Context, op func() error) error {
+	var err error
+	for attempt := 0; attempt < rs.policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := rs.policy.backoff(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+				return err
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+		//stores may wrap the context's error, so check the context too
+		if err = op(); err == nil || !rs.policy.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+//retryable reports whether err should be retried
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	if _, ok := err.(*CodecError); ok {
+		return false
+	}
+	switch err {
+	case ErrStateNotFound, ErrCircuitOpen, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	return true
+}
+
+//backoff returns a random delay before the retry attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	max := p.InitialBackoff
+	for i := 1; i < attempt && max < p.MaxBackoff; i++ {
+		max *= 2
+	}
+	if p.MaxBackoff > 0 && max > p.MaxBackoff {
+		max = p.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
@@ -0,0 +1,226 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+//flakyStore wraps a mockStore, failing the first failures operations
+type flakyStore struct {
+	*mockStore
+	failures int
+	attempts int
+}
+
+func (fs *flakyStore) fail() error {
+	fs.attempts++
+	if fs.attempts <= fs.failures {
+		return fmt.Errorf("test error %d", fs.attempts)
+	}
+	return nil
+}
+
+func (fs *flakyStore) Save(token Token, sessionState interface{}) error {
+	if err := fs.fail(); err != nil {
+		return err
+	}
+	return fs.mockStore.Save(token, sessionState)
+}
+
+func (fs *flakyStore) Get(token Token, sessionState interface{}) error {
+	if err := fs.fail(); err != nil {
+		return err
+	}
+	return fs.mockStore.Get(token, sessionState)
+}
+
+func (fs *flakyStore) Delete(token Token) error {
+	if err := fs.fail(); err != nil {
+		return err
+	}
+	return fs.mockStore.Delete(token)
+}
+
+//errorStore wraps a mockStore, failing Get with the error returned by err
+type errorStore struct {
+	*mockStore
+	err func() error
+}
+
+func (es *errorStore) Get(token Token, sessionState interface{}) error {
+	return es.err()
+}
+
+func TestRetryStore(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+
+	cases := []struct {
+		name             string
+		failures         int
+		expectError      bool
+		expectedAttempts int
+	}{
+		{
+			"no failures",
+			0,
+			false,
+			1,
+		},
+		{
+			"transient failures",
+			2,
+			false,
+			3,
+		},
+		{
+			"too many failures",
+			5,
+			true,
+			3,
+		},
+	}
+
+	for _, c := range cases {
+		ops := map[string]func(Store) error{
+			"save":   func(s Store) error { return s.Save(token, "test state") },
+			"get":    func(s Store) error { var state string; return s.Get(token, &state) },
+			"delete": func(s Store) error { return s.Delete(token) },
+		}
+		for opName, op := range ops {
+			fs := &flakyStore{mockStore: newMockStore(false), failures: c.failures}
+			fs.mockStore.Save(token, "test state")
+			err := op(RetryStore(fs, policy))
+			if c.expectError && err == nil {
+				t.Errorf("case %s %s: did not receive expected error", c.name, opName)
+			}
+			if !c.expectError && err != nil {
+				t.Errorf("case %s %s: unexpected error: %v", c.name, opName, err)
+			}
+			if fs.attempts != c.expectedAttempts {
+				t.Errorf("case %s %s: incorrect number of attempts: expected %d but got %d", c.name, opName, c.expectedAttempts, fs.attempts)
+			}
+		}
+	}
+}
+
+func TestRetryStoreNotRetryable(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	//ErrStateNotFound should not be retried by default
+	fs := &flakyStore{mockStore: newMockStore(false)}
+	var state string
+	if err := RetryStore(fs, DefaultRetryPolicy).Get(token, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if fs.attempts != 1 {
+		t.Errorf("ErrStateNotFound was retried: %d attempts", fs.attempts)
+	}
+
+	//errors that retrying can't fix should not be retried by default
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"circuit open", ErrCircuitOpen},
+		{"canceled", context.Canceled},
+		{"deadline exceeded", context.DeadlineExceeded},
+		{"codec", &CodecError{Op: "decoding", Err: fmt.Errorf("test error")}},
+	}
+	for _, c := range cases {
+		attempts := 0
+		es := &errorStore{mockStore: newMockStore(false), err: func() error {
+			attempts++
+			return c.err
+		}}
+		if err := RetryStore(es, DefaultRetryPolicy).Get(token, &state); err != c.err {
+			t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.err, err)
+		}
+		if attempts != 1 {
+			t.Errorf("case %s: error was retried: %d attempts", c.name, attempts)
+		}
+	}
+
+	//custom Retryable functions should be respected
+	fs = &flakyStore{mockStore: newMockStore(false), failures: 5}
+	policy := DefaultRetryPolicy
+	policy.Retryable = func(err error) bool { return false }
+	if err := RetryStore(fs, policy).Save(token, "test state"); err == nil {
+		t.Error("did not receive expected error")
+	}
+	if fs.attempts != 1 {
+		t.Errorf("non-retryable error was retried: %d attempts", fs.attempts)
+	}
+}
+
+func TestRetryStoreContext(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	}
+
+	//retries should stop when the next delay would exceed the deadline
+	fs := &flakyStore{mockStore: newMockStore(false), failures: 5}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	store := RetryStore(fs, policy).(ContextStore)
+	if err := store.SaveContext(ctx, token, "test state"); err == nil {
+		t.Error("did not receive expected error")
+	}
+	if fs.attempts != 1 {
+		t.Errorf("incorrect number of attempts: expected 1 but got %d", fs.attempts)
+	}
+
+	//and when the context is cancelled during the delay
+	fs = &flakyStore{mockStore: newMockStore(false), failures: 5}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	store = RetryStore(fs, policy).(ContextStore)
+	if err := store.DeleteContext(ctx, token); err == nil {
+		t.Error("did not receive expected error")
+	}
+	if fs.attempts != 1 {
+		t.Errorf("incorrect number of attempts: expected 1 but got %d", fs.attempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 35 * time.Millisecond}
+	cases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 35 * time.Millisecond},
+		{10, 35 * time.Millisecond},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			if d := policy.backoff(c.attempt); d < 0 || d > c.max {
+				t.Errorf("attempt %d: backoff %v outside of range [0, %v]", c.attempt, d, c.max)
+				break
+			}
+		}
+	}
+	if d := (RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("incorrect backoff for zero policy: expected 0 but got %v", d)
+	}
+}
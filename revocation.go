@@ -0,0 +1,147 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//ErrSessionRevoked is returned from GetState when the
+//session has been revoked using Manager.Revoke
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+//DefaultRevocationTTL is how long revocations are remembered
+//unless the manager has a maximum session lifetime
+const DefaultRevocationTTL = 24 * time.Hour
+
+//RevocationList records the IDs of revoked sessions, so that revoked
+//tokens stay dead even if their session state is recreated, such as
+//when a replica that missed the deletion is promoted, or a late
+//asynchronous write lands after the revocation.
+type RevocationList interface {
+	//Revoke records that the session ID is revoked. The record
+	//may be discarded after ttl.
+	Revoke(sessionID string, ttl time.Duration) error
+	//IsRevoked reports whether the session ID has been revoked
+	IsRevoked(sessionID string) (bool, error)
+}
+
+//memoryRevocationList is an in-memory RevocationList
+type memoryRevocationList struct {
+	mx      sync.Mutex
+	entries map[string]time.Time
+}
+
+//NewMemoryRevocationList constructs a new RevocationList that holds
+//revocations in memory. Revocations are not shared between processes,
+//so use NewRedisRevocationList when running multiple instances.
+func NewMemoryRevocationList() RevocationList {
+	return &memoryRevocationList{entries: make(map[string]time.Time)}
+}
+
+//Revoke records that the session ID is revoked until ttl elapses
+func (mrl *memoryRevocationList) Revoke(sessionID string, ttl time.Duration) error {
+	mrl.mx.Lock()
+	defer mrl.mx.Unlock()
+	now := time.Now()
+	//discard expired revocations so the list doesn't grow forever
+	for id, expires := range mrl.entries {
+		if now.After(expires) {
+			delete(mrl.entries, id)
+		}
+	}
+	mrl.entries[sessionID] = now.Add(ttl)
+	return nil
+}
+
+//IsRevoked reports whether the session ID has been revoked
+func (mrl *memoryRevocationList) IsRevoked(sessionID string) (bool, error) {
+	mrl.mx.Lock()
+	defer mrl.mx.Unlock()
+	expires, found := mrl.entries[sessionID]
+	return found && time.Now().Before(expires), nil
+}
+
+//DefaultRedisRevocationKeyPrefix is the default prefix added to
+//session IDs to form the redis keys of revocation tombstones
+const DefaultRedisRevocationKeyPrefix = "revoked:"
+
+//RedisRevocationList is a RevocationList backed by redis. Each revocation
+//is stored as a tombstone key that expires after the revocation's ttl.
+type RedisRevocationList struct {
+	//Prefix added to session IDs to form redis keys.
+	//Defaults to DefaultRedisRevocationKeyPrefix, but
+	//callers may adjust this after construction.
+	KeyPrefix string
+	//redis connection pool
+	pool *redis.Pool
+}
+
+//NewRedisRevocationList constructs a new RedisRevocationList
+func NewRedisRevocationList(pool *redis.Pool) *RedisRevocationList {
+	return &RedisRevocationList{
+		KeyPrefix: DefaultRedisRevocationKeyPrefix,
+		pool:      pool,
+	}
+}
+
+//Revoke sets a tombstone key for the session ID that expires after ttl
+func (rrl *RedisRevocationList) Revoke(sessionID string, ttl time.Duration) error {
+	conn := rrl.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SETEX", rrl.KeyPrefix+sessionID, int64(ttl.Seconds()), 1); err != nil {
+		return fmt.Errorf("error executing SETEX: %v", err)
+	}
+	return nil
+}
+
+//IsRevoked reports whether there is a tombstone key for the session ID
+func (rrl *RedisRevocationList) IsRevoked(sessionID string) (bool, error) {
+	conn := rrl.pool.Get()
+	defer conn.Close()
+	revoked, err := redis.Bool(conn.Do("EXISTS", rrl.KeyPrefix+sessionID))
+	if err != nil {
+		return false, fmt.Errorf("error executing EXISTS: %v", err)
+	}
+	return revoked, nil
+}
+
+//Revoke ends the session associated with the token, deleting its state from
+//the store. If the manager was constructed WithRevocationList, the session ID
+//is also recorded in that list, and GetState returns ErrSessionRevoked for
+//the token from then on, even if its session state reappears in the store.
+func (m *manager) Revoke(token Token) error {
+	if m.revocations != nil {
+		ttl := DefaultRevocationTTL
+		if m.maxLifetime > 0 {
+			ttl = m.maxLifetime
+		}
+		if err := m.revocations.Revoke(token.ID().String(), ttl); err != nil {
+			return fmt.Errorf("error revoking session: %v", err)
+		}
+	}
+	if err := m.store.Delete(token); err != nil {
+		return err
+	}
+	m.events.emit(EventRevoked, token)
+	return nil
+}
+
+//checkRevoked returns ErrSessionRevoked if the token
+//has been recorded in the manager's revocation list
+func (m *manager) checkRevoked(token Token) error {
+	if m.revocations == nil {
+		return nil
+	}
+	revoked, err := m.revocations.IsRevoked(token.ID().String())
+	if err != nil {
+		return fmt.Errorf("error checking revocation list: %v", err)
+	}
+	if revoked {
+		return ErrSessionRevoked
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestMemoryRevocationList(t *testing.T) {
+	rl := NewMemoryRevocationList()
+	if err := rl.Revoke("a", time.Hour); err != nil {
+		t.Fatalf("unexpected error revoking: %v", err)
+	}
+	if err := rl.Revoke("b", 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error revoking: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		id       string
+		wait     time.Duration
+		expected bool
+	}{
+		{"revoked", "a", 0, true},
+		{"not revoked", "c", 0, false},
+		{"revocation expired", "b", 20 * time.Millisecond, false},
+	}
+
+	for _, c := range cases {
+		time.Sleep(c.wait)
+		revoked, err := rl.IsRevoked(c.id)
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+		}
+		if revoked != c.expected {
+			t.Errorf("case %s: incorrect result: expected %t but got %t", c.name, c.expected, revoked)
+		}
+	}
+}
+
+func TestRedisRevocationList(t *testing.T) {
+	conn := redigomock.NewConn()
+	rl := NewRedisRevocationList(getMockPool(conn))
+
+	conn.Command("SETEX", "revoked:a", int64(3600), 1).Expect("OK")
+	if err := rl.Revoke("a", time.Hour); err != nil {
+		t.Errorf("unexpected error revoking: %v", err)
+	}
+	conn.Command("EXISTS", "revoked:a").Expect(int64(1))
+	if revoked, err := rl.IsRevoked("a"); err != nil || !revoked {
+		t.Errorf("incorrect result: expected true, <nil> but got %t, %v", revoked, err)
+	}
+
+	conn.Clear()
+	conn.Command("SETEX", "revoked:a", int64(3600), 1).ExpectError(fmt.Errorf("test error"))
+	if err := rl.Revoke("a", time.Hour); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+	conn.Command("EXISTS", "revoked:a").ExpectError(fmt.Errorf("test error"))
+	if _, err := rl.IsRevoked("a"); err == nil {
+		t.Error("did not receive expected error from mock")
+	}
+}
+
+func TestManagerRevoke(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithRevocationList(NewMemoryRevocationList()))
+	var revokedEvents int
+	mgr.Subscribe(func(evt Event) {
+		if evt.Type == EventRevoked {
+			revokedEvents++
+		}
+	})
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if err := mgr.Revoke(token); err != nil {
+		t.Fatalf("unexpected error revoking session: %v", err)
+	}
+	if len(store.entries) != 0 {
+		t.Error("state for revoked session was not deleted")
+	}
+	if revokedEvents != 1 {
+		t.Errorf("incorrect number of revoked events: expected 1 but got %d", revokedEvents)
+	}
+
+	//the session should stay dead even if its state reappears
+	store.Save(token, "test state")
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != ErrSessionRevoked {
+		t.Errorf("incorrect error: expected %v but got %v", ErrSessionRevoked, err)
+	}
+
+	//without a revocation list, the state is just deleted
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	if err := mgr.Revoke(token); err != nil {
+		t.Fatalf("unexpected error revoking session: %v", err)
+	}
+	if len(store.entries) != 0 {
+		t.Error("state for revoked session was not deleted")
+	}
+	store.triggerError = true
+	if err := mgr.Revoke(token); err == nil {
+		t.Error("did not receive expected error from store")
+	}
+}
@@ -0,0 +1,106 @@
+/*Package ristrettostore provides a session store backed by a local
+Ristretto cache (github.com/dgraph-io/ristretto). Ristretto's admission
+policy weighs how often each session is used against how much memory its
+state costs, so it keeps a higher proportion of active sessions than a
+plain LRU cache of the same size, making it a good front store for a
+sessions.TieredStore:
+
+	front, err := ristrettostore.New(64<<20, 5*time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer front.Close()
+	back := sessions.NewRedisStore(sessions.NewRedisPool(redisAddr, time.Minute), time.Hour)
+	mgr := sessions.NewManager(sessions.DefaultIDLength, signingKeys,
+		sessions.NewTieredStore(front, back))
+
+Since the admission policy may reject new sessions when the cache is
+full, a Get may return sessions.ErrStateNotFound for a session that was
+saved. Use this store only as a cache in front of another store.
+*/
+package ristrettostore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/davestearns/sessions"
+	"github.com/dgraph-io/ristretto/v2"
+)
+
+//countersPerByte is the number of Ristretto frequency counters
+//to allocate per byte of the maximum cost. Ristretto recommends ten
+//counters per expected entry, so this assumes ~1KB session states.
+const countersPerByte = 0.01
+
+//minCounters is the minimum number of frequency counters to allocate
+const minCounters = 1000
+
+//Store is a sessions.Store backed by a Ristretto cache
+type Store struct {
+	//SessionDuration is how long session state is kept after it is
+	//saved, or zero to keep it until evicted. Unlike most stores,
+	//getting state does not reset its expiry time.
+	//Callers may adjust this after construction.
+	SessionDuration time.Duration
+	cache           *ristretto.Cache[string, []byte]
+}
+
+//New constructs a new Store that holds up to maxBytes of session IDs and
+//encoded session state. Call Close to stop the cache's background
+//goroutines when the store is no longer needed.
+func New(maxBytes int64, sessionDuration time.Duration) (*Store, error) {
+	counters := int64(float64(maxBytes) * countersPerByte)
+	if counters < minCounters {
+		counters = minCounters
+	}
+	cache, err := ristretto.NewCache(&ristretto.Config[string, []byte]{
+		NumCounters: counters,
+		MaxCost:     maxBytes,
+		BufferItems: 64,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating ristretto cache: %v", err)
+	}
+	return &Store{
+		SessionDuration: sessionDuration,
+		cache:           cache,
+	}, nil
+}
+
+//Save encodes the session state using sessions.DefaultCodec, and offers
+//it to the cache. Save waits for the cache to apply the offer, so a
+//subsequent Get returns the state unless the cache rejected it.
+func (s *Store) Save(token sessions.Token, sessionState interface{}) error {
+	state, err := sessions.DefaultCodec.Encode(sessionState)
+	if err != nil {
+		return fmt.Errorf("error encoding session state: %v", err)
+	}
+	sessionID := token.ID().String()
+	s.cache.SetWithTTL(sessionID, state, int64(len(sessionID)+len(state)), s.SessionDuration)
+	s.cache.Wait()
+	return nil
+}
+
+//Get decodes the cached session state into sessionState. If the
+//state isn't in the cache, sessions.ErrStateNotFound is returned.
+func (s *Store) Get(token sessions.Token, sessionState interface{}) error {
+	state, found := s.cache.Get(token.ID().String())
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return sessions.DefaultCodec.Decode(state, sessionState)
+}
+
+//Delete removes the session state from the cache
+func (s *Store) Delete(token sessions.Token) error {
+	s.cache.Del(token.ID().String())
+	return nil
+}
+
+//Close stops the cache's background goroutines.
+//The store may not be used after it is closed.
+func (s *Store) Close() error {
+	s.cache.Close()
+	return nil
+}
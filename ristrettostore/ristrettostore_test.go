@@ -0,0 +1,74 @@
+package ristrettostore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davestearns/sessions"
+)
+
+func TestStore(t *testing.T) {
+	store, err := New(1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %v", err)
+	}
+	defer store.Close()
+	tk := sessions.IDToken("test session")
+
+	var state string
+	if err := store.Get(tk, &state); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := store.Save(tk, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+	if err := store.Save(tk, "updated state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Get(tk, &state); err != nil || state != "updated state" {
+		t.Errorf("incorrect state: expected updated state, <nil> but got %s, %v", state, err)
+	}
+	if err := store.Delete(tk); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Get(tk, &state); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	store, err := New(1<<20, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %v", err)
+	}
+	defer store.Close()
+	tk := sessions.IDToken("test session")
+	store.Save(tk, "test state")
+	time.Sleep(20 * time.Millisecond)
+	var state string
+	if err := store.Get(tk, &state); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+}
+
+func TestStoreTiered(t *testing.T) {
+	front, err := New(1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %v", err)
+	}
+	defer front.Close()
+	back := sessions.NewMemoryStore(time.Hour)
+	store := sessions.NewTieredStore(front, back)
+	tk := sessions.IDToken("test session")
+	if err := store.Save(tk, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	back.Delete(tk)
+	var state string
+	if err := store.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+}
@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+)
+
+//ErrRolesDisabled is returned from HasRole and HasPermission
+//when the manager was not constructed WithRoles
+var ErrRolesDisabled = errors.New("session roles are not enabled")
+
+//RoleIdentifier is implemented by session state types that carry
+//the roles of the session's user, such as "admin" or "editor"
+type RoleIdentifier interface {
+	//SessionRoles returns the roles of the session's user
+	SessionRoles() []string
+}
+
+//PermissionIdentifier is implemented by session state types that
+//carry the permissions of the session's user, such as "orders:write"
+type PermissionIdentifier interface {
+	//SessionPermissions returns the permissions of the session's user
+	SessionPermissions() []string
+}
+
+//WithRoles records the roles and permissions of each session whose state
+//implements RoleIdentifier and/or PermissionIdentifier, so that HasRole,
+//HasPermission, RequireRole, and RequirePermission can check them without
+//decoding the session state. Like WithMaxLifetime, this records the roles
+//and permissions alongside the session's state in the store, so sessions
+//begun without this option are not readable with it, and vice-versa.
+//Roles and permissions are recorded whenever the state is saved, so
+//update the state to change them.
+func WithRoles() ManagerOption {
+	return func(m *manager) {
+		m.roles = true
+	}
+}
+
+//HasRole reports whether the request's session has the role
+func (m *manager) HasRole(r *http.Request, role string) (bool, error) {
+	env, err := m.claims(r)
+	if err != nil {
+		return false, err
+	}
+	return contains(env.Roles, role), nil
+}
+
+//HasPermission reports whether the request's session has the permission
+func (m *manager) HasPermission(r *http.Request, permission string) (bool, error) {
+	env, err := m.claims(r)
+	if err != nil {
+		return false, err
+	}
+	return contains(env.Permissions, permission), nil
+}
+
+//RequireRole is like Require, but also rejects requests whose session
+//doesn't have at least one of the roles as forbidden. The manager must
+//be constructed WithRoles, or all requests are rejected as forbidden.
+func (m *manager) RequireRole(next http.Handler, opts RequireOptions, roles ...string) http.Handler {
+	return m.require(next, opts, false, func(env *envelope) bool {
+		return env != nil && containsAny(env.Roles, roles)
+	})
+}
+
+//RequirePermission is like Require, but also rejects requests whose
+//session doesn't have at least one of the permissions as forbidden. The
+//manager must be constructed WithRoles, or all requests are rejected
+//as forbidden.
+func (m *manager) RequirePermission(next http.Handler, opts RequireOptions, permissions ...string) http.Handler {
+	return m.require(next, opts, false, func(env *envelope) bool {
+		return env != nil && containsAny(env.Permissions, permissions)
+	})
+}
+
+//claims resumes the request's session without decoding its state,
+//and returns its envelope
+func (m *manager) claims(r *http.Request) (*envelope, error) {
+	if !m.roles {
+		return nil, ErrRolesDisabled
+	}
+	tk, err := m.GetToken(r)
+	if err != nil {
+		return nil, err
+	}
+	env, err := m.resumeEnvelope(r, tk, nil, false)
+	if err != nil {
+		return nil, getStateError(err)
+	}
+	return env, nil
+}
+
+//setRoles records the roles and permissions of sessionState
+func (e *envelope) setRoles(sessionState interface{}) {
+	if ri, ok := sessionState.(RoleIdentifier); ok {
+		e.Roles = ri.SessionRoles()
+	}
+	if pi, ok := sessionState.(PermissionIdentifier); ok {
+		e.Permissions = pi.SessionPermissions()
+	}
+}
+
+//contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//containsAny reports whether values contains any of targets
+func containsAny(values []string, targets []string) bool {
+	for _, t := range targets {
+		if contains(values, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type roleState struct {
+	Name        string
+	Roles       []string
+	Permissions []string
+}
+
+func (s *roleState) SessionRoles() []string {
+	return s.Roles
+}
+
+func (s *roleState) SessionPermissions() []string {
+	return s.Permissions
+}
+
+func TestManagerRoles(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false), WithRoles())
+	respRec := httptest.NewRecorder()
+	state := &roleState{Name: "test", Roles: []string{"editor"}, Permissions: []string{"orders:read"}}
+	tk, err := mgr.BeginSession(respRec, state)
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+
+	cases := []struct {
+		name     string
+		check    func(r *http.Request, name string) (bool, error)
+		value    string
+		expected bool
+	}{
+		{"has role", mgr.HasRole, "editor", true},
+		{"lacks role", mgr.HasRole, "admin", false},
+		{"has permission", mgr.HasPermission, "orders:read", true},
+		{"lacks permission", mgr.HasPermission, "orders:write", false},
+	}
+	for _, c := range cases {
+		actual, err := c.check(req, c.value)
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+		}
+		if actual != c.expected {
+			t.Errorf("case %s: incorrect result: expected %t but got %t", c.name, c.expected, actual)
+		}
+	}
+
+	//the state should still be readable
+	actualState := &roleState{}
+	if _, err := mgr.GetState(req, actualState); err != nil || actualState.Name != "test" {
+		t.Errorf("incorrect state: %v, %v", actualState, err)
+	}
+
+	//updating the state should update the roles
+	state.Roles = []string{"admin"}
+	if err := mgr.UpdateState(tk, state); err != nil {
+		t.Fatalf("unexpected error updating state: %v", err)
+	}
+	if isAdmin, err := mgr.HasRole(req, "admin"); err != nil || !isAdmin {
+		t.Errorf("incorrect result after update: expected true, <nil> but got %t, %v", isAdmin, err)
+	}
+
+	//without WithRoles
+	mgr = NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	if _, err := mgr.HasRole(req, "admin"); err != ErrRolesDisabled {
+		t.Errorf("incorrect error: expected %v but got %v", ErrRolesDisabled, err)
+	}
+}
+
+func TestManagerRequireRole(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false), WithRoles())
+	respRec := httptest.NewRecorder()
+	state := &roleState{Roles: []string{"editor"}, Permissions: []string{"orders:read"}}
+	if _, err := mgr.BeginSession(respRec, state); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	cases := []struct {
+		name           string
+		handler        http.Handler
+		expectedStatus int
+	}{
+		{"has one of the roles", mgr.RequireRole(next, RequireOptions{}, "admin", "editor"), http.StatusOK},
+		{"lacks roles", mgr.RequireRole(next, RequireOptions{}, "admin"), http.StatusForbidden},
+		{"has permission", mgr.RequirePermission(next, RequireOptions{}, "orders:read"), http.StatusOK},
+		{"lacks permission", mgr.RequirePermission(next, RequireOptions{}, "orders:write"), http.StatusForbidden},
+		{"custom forbidden status", mgr.RequireRole(next, RequireOptions{ForbiddenStatus: http.StatusNotFound}, "admin"), http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		rec := httptest.NewRecorder()
+		c.handler.ServeHTTP(rec, req)
+		if rec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, rec.Code)
+		}
+	}
+
+	//requests without a session are still unauthorized
+	rec := httptest.NewRecorder()
+	mgr.RequireRole(next, RequireOptions{}, "editor").ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("incorrect status: expected %d but got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
@@ -0,0 +1,110 @@
+/*Package samlbridge begins sessions managed by the github.com/davestearns/sessions
+package from validated SAML assertions.
+
+This package deliberately doesn't parse or validate SAML responses itself:
+use a dedicated SAML library for that, and copy the relevant parts of the
+validated assertion into an Assertion. The session is begun so that it
+expires when the identity provider's SessionNotOnOrAfter says it must,
+which requires the Manager to be constructed with sessions.WithSessionExpiry.
+*/
+package samlbridge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davestearns/sessions"
+)
+
+//ErrNoSubject is returned from BeginSession when the assertion has no subject
+var ErrNoSubject = errors.New("SAML assertion has no subject")
+
+//ErrAssertionExpired is returned from BeginSession when the
+//assertion's SessionNotOnOrAfter time has already passed
+var ErrAssertionExpired = errors.New("SAML assertion's session has expired")
+
+//Assertion holds the parts of a validated SAML assertion
+//needed to begin a session
+type Assertion struct {
+	//Issuer is the entity ID of the identity provider
+	Issuer string
+	//Subject is the subject's NameID
+	Subject string
+	//SessionIndex is the SessionIndex from the AuthnStatement, if any
+	SessionIndex string
+	//Attributes are the values from the AttributeStatement, keyed by name
+	Attributes map[string][]string
+	//SessionNotOnOrAfter is the SessionNotOnOrAfter from the
+	//AuthnStatement, or zero if the identity provider didn't set one
+	SessionNotOnOrAfter time.Time
+}
+
+//State is the session state created by DefaultMapAssertion
+type State struct {
+	//Issuer is the entity ID of the identity provider
+	Issuer string
+	//Subject is the subject's NameID
+	Subject string
+	//SessionIndex is the SessionIndex from the AuthnStatement, if any
+	SessionIndex string
+	//Attributes are the values from the AttributeStatement, keyed by name
+	Attributes map[string][]string
+}
+
+//DefaultMapAssertion maps the assertion to a *State
+func DefaultMapAssertion(a *Assertion) (interface{}, error) {
+	return &State{
+		Issuer:       a.Issuer,
+		Subject:      a.Subject,
+		SessionIndex: a.SessionIndex,
+		Attributes:   a.Attributes,
+	}, nil
+}
+
+//Bridge begins package sessions from validated SAML assertions
+type Bridge struct {
+	//MapAssertion maps a validated assertion to the initial session state.
+	//Defaults to DefaultMapAssertion, but callers may adjust this after construction.
+	MapAssertion func(a *Assertion) (interface{}, error)
+	//MaxDuration caps how long sessions last, even if the identity
+	//provider allows them to last longer, or doesn't set
+	//SessionNotOnOrAfter at all. Zero means no cap. Callers may
+	//adjust this after construction.
+	MaxDuration time.Duration
+	manager     sessions.Manager
+}
+
+//New constructs a new Bridge that begins sessions using manager,
+//which must be constructed with sessions.WithSessionExpiry
+func New(manager sessions.Manager) *Bridge {
+	return &Bridge{
+		MapAssertion: DefaultMapAssertion,
+		manager:      manager,
+	}
+}
+
+//BeginSession begins a new session for the validated assertion, with
+//initial state returned by MapAssertion, and returns its token. The session
+//expires at the assertion's SessionNotOnOrAfter time, or after MaxDuration,
+//whichever comes first.
+func (b *Bridge) BeginSession(w http.ResponseWriter, a *Assertion) (sessions.Token, error) {
+	if len(a.Subject) == 0 {
+		return nil, ErrNoSubject
+	}
+	expires := a.SessionNotOnOrAfter
+	if !expires.IsZero() && !time.Now().Before(expires) {
+		return nil, ErrAssertionExpired
+	}
+	if b.MaxDuration > 0 {
+		if max := time.Now().Add(b.MaxDuration); expires.IsZero() || max.Before(expires) {
+			expires = max
+		}
+	}
+	state, err := b.MapAssertion(a)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping assertion to session state: %v", err)
+	}
+	return b.manager.BeginSessionUntil(w, state, expires)
+}
@@ -0,0 +1,141 @@
+package samlbridge
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davestearns/sessions"
+)
+
+type mapStore struct {
+	mx      sync.Mutex
+	entries map[string][]byte
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{entries: make(map[string][]byte)}
+}
+
+func (ms *mapStore) Save(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return err
+	}
+	ms.entries[token.ID().String()] = buf.Bytes()
+	return nil
+}
+
+func (ms *mapStore) Get(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	val, found := ms.entries[token.ID().String()]
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState)
+}
+
+func (ms *mapStore) Delete(token sessions.Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.entries, token.ID().String())
+	return nil
+}
+
+func TestBeginSession(t *testing.T) {
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, newMapStore(),
+		sessions.WithSessionExpiry())
+	bridge := New(mgr)
+	attrs := map[string][]string{"groups": {"admins", "users"}}
+
+	cases := []struct {
+		name          string
+		assertion     *Assertion
+		maxDuration   time.Duration
+		wait          time.Duration
+		expectedError error
+		expectError   bool
+		expectExpired bool
+	}{
+		{
+			"valid assertion",
+			&Assertion{Issuer: "idp", Subject: "user1", Attributes: attrs, SessionNotOnOrAfter: time.Now().Add(time.Hour)},
+			0, 0, nil, false, false,
+		},
+		{
+			"no session expiry",
+			&Assertion{Issuer: "idp", Subject: "user1", Attributes: attrs},
+			0, 0, nil, false, false,
+		},
+		{
+			"session expiry passes",
+			&Assertion{Issuer: "idp", Subject: "user1", Attributes: attrs, SessionNotOnOrAfter: time.Now().Add(20 * time.Millisecond)},
+			0, 30 * time.Millisecond, nil, false, true,
+		},
+		{
+			"max duration passes",
+			&Assertion{Issuer: "idp", Subject: "user1", Attributes: attrs},
+			20 * time.Millisecond, 30 * time.Millisecond, nil, false, true,
+		},
+		{
+			"no subject",
+			&Assertion{Issuer: "idp"},
+			0, 0, ErrNoSubject, true, false,
+		},
+		{
+			"expired assertion",
+			&Assertion{Issuer: "idp", Subject: "user1", SessionNotOnOrAfter: time.Now().Add(-time.Second)},
+			0, 0, ErrAssertionExpired, true, false,
+		},
+	}
+
+	for _, c := range cases {
+		bridge.MaxDuration = c.maxDuration
+		respRec := httptest.NewRecorder()
+		_, err := bridge.BeginSession(respRec, c.assertion)
+		if c.expectError {
+			if err != c.expectedError {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error beginning session: %v", c.name, err)
+			continue
+		}
+
+		time.Sleep(c.wait)
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+		state := &State{}
+		_, err = mgr.GetState(req, state)
+		if c.expectExpired {
+			if err != sessions.ErrSessionExpired {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, sessions.ErrSessionExpired, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error getting state: %v", c.name, err)
+			continue
+		}
+		if state.Subject != c.assertion.Subject || !reflect.DeepEqual(state.Attributes, c.assertion.Attributes) {
+			t.Errorf("case %s: incorrect state: %v", c.name, state)
+		}
+	}
+
+	bridge.MapAssertion = func(a *Assertion) (interface{}, error) {
+		return nil, fmt.Errorf("test error")
+	}
+	if _, err := bridge.BeginSession(httptest.NewRecorder(), &Assertion{Subject: "user1"}); err == nil {
+		t.Error("did not receive expected error from MapAssertion")
+	}
+}
@@ -0,0 +1,257 @@
+/*Package sessiond provides a remote session service, so that many small
+services can share one hardened session tier without each of them talking
+to the session store directly. The Server exposes any sessions.Store over
+gRPC, and Client is a sessions.Store that uses the Server.
+
+On the session tier:
+
+	store := sessions.NewRedisStore(sessions.NewRedisPool(redisAddr, time.Minute), time.Hour)
+	srv := grpc.NewServer(grpc.Creds(creds))
+	sessiond.NewServer(store).Register(srv)
+	srv.Serve(listener)
+
+In each service:
+
+	conn, err := grpc.Dial(sessiondAddr, grpc.WithTransportCredentials(creds))
+	...
+	mgr := sessions.NewManager(sessions.DefaultIDLength, signingKeys, sessiond.NewClient(conn))
+
+Clients encode session state before sending it, so the Server stores it
+as opaque bytes and never needs the clients' session state types. Messages
+are gob-encoded rather than protobuf-encoded, so the service is intended for
+Go clients. The Server performs no authentication of its own, so use TLS
+client certificates or an interceptor to ensure only trusted services can
+reach it.
+*/
+package sessiond
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/davestearns/sessions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+//serviceName is the full name of the gRPC service
+const serviceName = "sessiond.Sessions"
+
+//codecName is the gRPC content subtype used for the service's messages
+const codecName = "sessiond-gob"
+
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+//gobCodec is a gRPC codec that gob-encodes messages
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) Name() string {
+	return codecName
+}
+
+//Request is the request message for all of the service's methods
+type Request struct {
+	//SessionID is the ID of the session
+	SessionID string
+	//State is the encoded session state, for Save
+	State []byte
+}
+
+//Response is the response message for all of the service's methods
+type Response struct {
+	//State is the encoded session state, for Get
+	State []byte
+}
+
+//Server is the session service, which serves requests using a Store
+type Server struct {
+	store sessions.Store
+}
+
+//NewServer constructs a new Server that serves requests using store
+func NewServer(store sessions.Store) *Server {
+	return &Server{store: store}
+}
+
+//Register registers the session service with the gRPC server
+func (s *Server) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+//Save saves the session state
+func (s *Server) Save(ctx context.Context, req *Request) (*Response, error) {
+	if err := s.store.Save(sessions.IDToken(req.SessionID), req.State); err != nil {
+		return nil, storeError(err)
+	}
+	return &Response{}, nil
+}
+
+//Get gets the session state, resetting its expiry time
+func (s *Server) Get(ctx context.Context, req *Request) (*Response, error) {
+	resp := &Response{}
+	if err := s.store.Get(sessions.IDToken(req.SessionID), &resp.State); err != nil {
+		return nil, storeError(err)
+	}
+	return resp, nil
+}
+
+//Delete deletes the session state
+func (s *Server) Delete(ctx context.Context, req *Request) (*Response, error) {
+	if err := s.store.Delete(sessions.IDToken(req.SessionID)); err != nil {
+		return nil, storeError(err)
+	}
+	return &Response{}, nil
+}
+
+//Touch resets the expiry time of the session state, using the store's
+//Touch method if it implements sessions.Toucher, or by getting the
+//state and discarding it otherwise
+func (s *Server) Touch(ctx context.Context, req *Request) (*Response, error) {
+	token := sessions.IDToken(req.SessionID)
+	var err error
+	if t, ok := s.store.(sessions.Toucher); ok {
+		err = t.Touch(token)
+	} else {
+		var state []byte
+		err = s.store.Get(token, &state)
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &Response{}, nil
+}
+
+//storeError converts an error from the store to a gRPC status error
+func storeError(err error) error {
+	if err == sessions.ErrStateNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+//method returns a gRPC method handler that calls fn
+func method(fn func(s *Server, ctx context.Context, req *Request) (*Response, error), name string) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &Request{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return fn(srv.(*Server), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(srv.(*Server), ctx, req.(*Request))
+			})
+		},
+	}
+}
+
+//serviceDesc describes the session service to gRPC
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		method((*Server).Save, "Save"),
+		method((*Server).Get, "Get"),
+		method((*Server).Delete, "Delete"),
+		method((*Server).Touch, "Touch"),
+	},
+	Metadata: "sessiond",
+}
+
+//Client is a sessions.Store that saves session state using a remote Server
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+//NewClient constructs a new Client that calls the Server over conn
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+//Save encodes the session state using sessions.DefaultCodec,
+//and saves it using the remote Server
+func (c *Client) Save(token sessions.Token, sessionState interface{}) error {
+	return c.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the session state from the remote Server, and decodes it into
+//sessionState. If there is no state associated with the token,
+//sessions.ErrStateNotFound is returned.
+func (c *Client) Get(token sessions.Token, sessionState interface{}) error {
+	return c.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the session state using the remote Server
+func (c *Client) Delete(token sessions.Token) error {
+	return c.DeleteContext(context.Background(), token)
+}
+
+//Touch resets the expiry time of the session state using the remote Server
+func (c *Client) Touch(token sessions.Token) error {
+	_, err := c.invoke(context.Background(), "Touch", &Request{SessionID: token.ID().String()})
+	return err
+}
+
+//SaveContext is like Save, but respects the context
+func (c *Client) SaveContext(ctx context.Context, token sessions.Token, sessionState interface{}) error {
+	state, err := sessions.DefaultCodec.Encode(sessionState)
+	if err != nil {
+		return fmt.Errorf("error encoding session state: %v", err)
+	}
+	_, err = c.invoke(ctx, "Save", &Request{SessionID: token.ID().String(), State: state})
+	return err
+}
+
+//GetContext is like Get, but respects the context
+func (c *Client) GetContext(ctx context.Context, token sessions.Token, sessionState interface{}) error {
+	resp, err := c.invoke(ctx, "Get", &Request{SessionID: token.ID().String()})
+	if err != nil {
+		return err
+	}
+	if err := sessions.DefaultCodec.Decode(resp.State, sessionState); err != nil {
+		return fmt.Errorf("error decoding session state: %v", err)
+	}
+	return nil
+}
+
+//DeleteContext is like Delete, but respects the context
+func (c *Client) DeleteContext(ctx context.Context, token sessions.Token) error {
+	_, err := c.invoke(ctx, "Delete", &Request{SessionID: token.ID().String()})
+	return err
+}
+
+//invoke calls the named method on the remote Server,
+//converting status errors back to store errors
+func (c *Client) invoke(ctx context.Context, name string, req *Request) (*Response, error) {
+	resp := &Response{}
+	err := c.conn.Invoke(ctx, "/"+serviceName+"/"+name, req, resp, grpc.CallContentSubtype(codecName))
+	if status.Code(err) == codes.NotFound {
+		return nil, sessions.ErrStateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %v", name, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+package sessiond
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/davestearns/sessions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type mapStore struct {
+	mx           sync.Mutex
+	entries      map[string][]byte
+	triggerError bool
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{entries: make(map[string][]byte)}
+}
+
+func (ms *mapStore) Save(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.triggerError {
+		return fmt.Errorf("test error")
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(sessionState); err != nil {
+		return err
+	}
+	ms.entries[token.ID().String()] = buf.Bytes()
+	return nil
+}
+
+func (ms *mapStore) Get(token sessions.Token, sessionState interface{}) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.triggerError {
+		return fmt.Errorf("test error")
+	}
+	val, found := ms.entries[token.ID().String()]
+	if !found {
+		return sessions.ErrStateNotFound
+	}
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(sessionState)
+}
+
+func (ms *mapStore) Delete(token sessions.Token) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	delete(ms.entries, token.ID().String())
+	return nil
+}
+
+//startServer starts a Server backed by store, and returns a Client connected to it
+func startServer(t *testing.T, store sessions.Store) *Client {
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	NewServer(store).Register(srv)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error dialing server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestClientServer(t *testing.T) {
+	type state struct {
+		Name  string
+		Count int
+	}
+	backing := newMapStore()
+	client := startServer(t, backing)
+	token, err := sessions.NewToken([]byte("test key"))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	if err := client.Get(token, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error getting missing state: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := client.Touch(token); err != sessions.ErrStateNotFound {
+		t.Errorf("incorrect error touching missing state: expected %v but got %v", sessions.ErrStateNotFound, err)
+	}
+	if err := client.Save(token, &state{"tester", 1}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	got := &state{}
+	if err := client.Get(token, got); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if got.Name != "tester" || got.Count != 1 {
+		t.Errorf("incorrect state: %+v", got)
+	}
+	if err := client.Touch(token); err != nil {
+		t.Errorf("unexpected error touching state: %v", err)
+	}
+	if err := client.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if len(backing.entries) != 0 {
+		t.Error("state was not deleted from backing store")
+	}
+
+	backing.triggerError = true
+	if err := client.Save(token, &state{}); err == nil || err == sessions.ErrStateNotFound {
+		t.Errorf("incorrect error from failing store: %v", err)
+	}
+}
+
+func TestClientWithManager(t *testing.T) {
+	mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"}, startServer(t, newMapStore()))
+	respRec := httptest.NewRecorder()
+	if _, err := mgr.BeginSession(respRec, "test state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", respRec.Header().Get("Authorization"))
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+}
@@ -0,0 +1,74 @@
+/*Package sessiontest provides helpers for testing HTTP handlers that use
+sessions. Instead of beginning a session and copying its token into each
+test request by hand, use NewRequest to get a request for a new session:
+
+	func TestProfileHandler(t *testing.T) {
+		mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"},
+			sessions.NewMemoryStore(time.Hour))
+		req, _ := sessiontest.NewRequest(t, mgr, "GET", "/profile", nil, &SessionState{UserID: 1})
+		respRec := httptest.NewRecorder()
+		NewProfileHandler(mgr).ServeHTTP(respRec, req)
+		...
+	}
+
+The session state is saved to the manager's store, and the token is added
+to the request the same way the manager adds it to responses, so it works
+with header, cookie, and custom Transports alike.
+*/
+package sessiontest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davestearns/sessions"
+)
+
+//NewRequest returns a new incoming server request, like httptest.NewRequest,
+//carrying the token for a new session begun using mgr with sessionState.
+//The token is also returned, so that tests can inspect the session afterwards.
+//If the session can't be begun, the test fails immediately.
+func NewRequest(tb testing.TB, mgr sessions.Manager, method string, target string, body io.Reader, sessionState interface{}) (*http.Request, sessions.Token) {
+	tb.Helper()
+	req := httptest.NewRequest(method, target, body)
+	return req, Authenticate(tb, mgr, req, sessionState)
+}
+
+//Authenticate begins a new session using mgr with sessionState, and adds
+//its token to the request, returning the token. Any headers and cookies
+//the manager adds to the response when beginning the session are added
+//to the request. If the manager adds nothing, as when it is constructed
+//WithoutResponseHeader, the token is added to the Authorization header
+//using the Bearer scheme. If the session can't be begun, the test fails
+//immediately.
+func Authenticate(tb testing.TB, mgr sessions.Manager, r *http.Request, sessionState interface{}) sessions.Token {
+	tb.Helper()
+	respRec := httptest.NewRecorder()
+	tk, err := mgr.BeginSession(respRec, sessionState)
+	if err != nil {
+		tb.Fatalf("error beginning session: %v", err)
+	}
+
+	resp := respRec.Result()
+	added := false
+	for name, values := range resp.Header {
+		if name == "Set-Cookie" {
+			continue
+		}
+		r.Header.Del(name)
+		for _, value := range values {
+			r.Header.Add(name, value)
+			added = true
+		}
+	}
+	for _, cookie := range resp.Cookies() {
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		added = true
+	}
+	if !added {
+		r.Header.Set("Authorization", "Bearer "+tk.String())
+	}
+	return tk
+}
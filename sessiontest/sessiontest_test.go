@@ -0,0 +1,42 @@
+package sessiontest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/davestearns/sessions"
+)
+
+func TestNewRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []sessions.ManagerOption
+	}{
+		{"default transport", nil},
+		{"cookie transport", []sessions.ManagerOption{
+			sessions.WithTransport(&sessions.CookieTransport{Cookie: http.Cookie{Name: "sid"}}),
+		}},
+		{"without response header", []sessions.ManagerOption{
+			sessions.WithoutResponseHeader(),
+		}},
+	}
+
+	for _, c := range cases {
+		mgr := sessions.NewManager(sessions.DefaultIDLength, []string{"test key"},
+			sessions.NewMemoryStore(time.Hour), c.opts...)
+		req, tk := NewRequest(t, mgr, "GET", "http://example.com", nil, "test state")
+		var state string
+		actualToken, err := mgr.GetState(req, &state)
+		if err != nil {
+			t.Errorf("case %s: unexpected error getting state: %v", c.name, err)
+			continue
+		}
+		if state != "test state" {
+			t.Errorf("case %s: incorrect state: expected test state but got %s", c.name, state)
+		}
+		if actualToken.String() != tk.String() {
+			t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, tk, actualToken)
+		}
+	}
+}
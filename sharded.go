@@ -0,0 +1,169 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//shardVirtualNodes is the number of points each shard gets on the
+//hash ring; more points spread session IDs more evenly across shards
+const shardVirtualNodes = 160
+
+//ShardedStore is a Store that spreads session state across multiple
+//underlying stores, using consistent hashing of session IDs to select
+//the store for each session. Very large installations can use this to
+//spread session volume across several redis instances without a cluster.
+type ShardedStore struct {
+	shards []Store
+	ring   []shardPoint
+}
+
+//shardPoint is a point on the hash ring
+type shardPoint struct {
+	hash  uint64
+	shard int
+}
+
+//NewShardedStore constructs a new ShardedStore over shards. Each shard's
+//position on the hash ring is determined by its position in the argument
+//list, so when adding shards, add them to the end of the list; only about
+//1/N of the existing sessions will then move to the new shard. It panics
+//if no shards are passed, as there would be nowhere to store sessions.
+func NewShardedStore(shards ...Store) *ShardedStore {
+	if len(shards) == 0 {
+		panic("sessions: NewShardedStore requires at least one shard")
+	}
+	ring := make([]shardPoint, 0, len(shards)*shardVirtualNodes)
+	for i := range shards {
+		for v := 0; v < shardVirtualNodes; v++ {
+			ring = append(ring, shardPoint{
+				hash:  shardHash("shard-" + strconv.Itoa(i) + "-" + strconv.Itoa(v)),
+				shard: i,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return &ShardedStore{
+		shards: shards,
+		ring:   ring,
+	}
+}
+
+//shardHash returns the hash of s used to position it on the ring
+func shardHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	//FNV alone doesn't spread similar strings well,
+	//so finish with the murmur3 64-bit mixer
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+//Shard returns the store responsible for the session token
+func (ss *ShardedStore) Shard(token Token) Store {
+	h := shardHash(token.ID().String())
+	//find the first point on the ring at or after the hash, wrapping around
+	i := sort.Search(len(ss.ring), func(i int) bool { return ss.ring[i].hash >= h })
+	if i == len(ss.ring) {
+		i = 0
+	}
+	return ss.shards[ss.ring[i].shard]
+}
+
+//Save saves the session state to the token's shard
+func (ss *ShardedStore) Save(token Token, sessionState interface{}) error {
+	return ss.Shard(token).Save(token, sessionState)
+}
+
+//Get gets the session state from the token's shard
+func (ss *ShardedStore) Get(token Token, sessionState interface{}) error {
+	return ss.Shard(token).Get(token, sessionState)
+}
+
+//Delete deletes the session state from the token's shard
+func (ss *ShardedStore) Delete(token Token) error {
+	return ss.Shard(token).Delete(token)
+}
+
+//SaveContext is like Save, but respects the context
+func (ss *ShardedStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return saveContext(ctx, ss.Shard(token), token, sessionState)
+}
+
+//GetContext is like Get, but respects the context
+func (ss *ShardedStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return getContext(ctx, ss.Shard(token), token, sessionState)
+}
+
+//DeleteContext is like Delete, but respects the context
+func (ss *ShardedStore) DeleteContext(ctx context.Context, token Token) error {
+	return deleteContext(ctx, ss.Shard(token), token)
+}
+
+//Ping pings every shard, returning an error if any are unreachable
+func (ss *ShardedStore) Ping(ctx context.Context) error {
+	for i, s := range ss.shards {
+		if err := ping(ctx, s); err != nil {
+			return fmt.Errorf("error pinging shard %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+//Peek peeks at the session state in the token's shard
+func (ss *ShardedStore) Peek(token Token, sessionState interface{}) error {
+	return peek(ss.Shard(token), token, sessionState)
+}
+
+//GetAndTouch gets and touches the session state in the token's shard
+func (ss *ShardedStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return getAndTouch(ss.Shard(token), token, sessionState, ttl)
+}
+
+//Touch touches the session state in the token's shard
+func (ss *ShardedStore) Touch(token Token) error {
+	return touch(ss.Shard(token), token)
+}
+
+//TTL gets the TTL of the session state in the token's shard
+func (ss *ShardedStore) TTL(token Token) (time.Duration, error) {
+	return storeTTL(ss.Shard(token), token)
+}
+
+//Exists checks whether the token's shard has the session state
+func (ss *ShardedStore) Exists(token Token) (bool, error) {
+	return exists(ss.Shard(token), token)
+}
+
+//Scan scans every shard in turn
+func (ss *ShardedStore) Scan(fn func(token Token) error) error {
+	for i, s := range ss.shards {
+		if err := scan(s, fn); err != nil {
+			return fmt.Errorf("error scanning shard %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+//Replace replaces the session state. If the tokens are on different
+//shards, the state is saved to the new token's shard before the
+//replaced token is deleted from its own.
+func (ss *ShardedStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	shard := ss.Shard(token)
+	if replacedShard := ss.Shard(replaced); replacedShard != shard {
+		if err := shard.Save(token, sessionState); err != nil {
+			return err
+		}
+		return replacedShard.Delete(replaced)
+	}
+	return replace(shard, token, sessionState, replaced)
+}
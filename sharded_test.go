@@ -0,0 +1,86 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShardedStore(t *testing.T) {
+	shards := []*mockStore{newMockStore(false), newMockStore(false), newMockStore(false)}
+	store := NewShardedStore(shards[0], shards[1], shards[2])
+
+	//save a bunch of sessions and ensure they are spread across the shards
+	const numSessions = 3000
+	tokens := make([]Token, numSessions)
+	for i := range tokens {
+		tokens[i], _ = NewToken(testSigningKey)
+		if err := store.Save(tokens[i], i); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	for i, s := range shards {
+		//each shard should get roughly a third of the sessions
+		if len(s.entries) < numSessions/6 || len(s.entries) > numSessions/2 {
+			t.Errorf("shard %d has an uneven number of sessions: %d", i, len(s.entries))
+		}
+	}
+
+	//ensure each session can be read back and deleted
+	for i, tk := range tokens {
+		var state int
+		if err := store.Get(tk, &state); err != nil {
+			t.Fatalf("unexpected error getting state: %v", err)
+		}
+		if state != i {
+			t.Errorf("incorrect state: expected %d but got %d", i, state)
+		}
+		if err := store.Delete(tk); err != nil {
+			t.Fatalf("unexpected error deleting state: %v", err)
+		}
+	}
+	for i, s := range shards {
+		if len(s.entries) != 0 {
+			t.Errorf("shard %d still has %d sessions after deleting", i, len(s.entries))
+		}
+	}
+}
+
+func TestShardedStoreAddShard(t *testing.T) {
+	shards := []Store{newMockStore(false), newMockStore(false), newMockStore(false)}
+	store := NewShardedStore(shards...)
+	bigger := NewShardedStore(append(shards, newMockStore(false))...)
+
+	//adding a shard should only move roughly 1/4 of the sessions
+	const numSessions = 2000
+	moved := 0
+	for i := 0; i < numSessions; i++ {
+		tk, _ := NewToken(testSigningKey)
+		if store.Shard(tk) != bigger.Shard(tk) {
+			moved++
+		}
+	}
+	if moved > numSessions/2 {
+		t.Errorf("too many sessions moved after adding a shard: %d of %d", moved, numSessions)
+	}
+}
+
+func TestShardedStoreNoShards(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewShardedStore did not panic without shards")
+		}
+	}()
+	NewShardedStore()
+}
+
+func TestShardedStorePing(t *testing.T) {
+	shards := []*mockStore{newMockStore(false), newMockStore(false)}
+	store := NewShardedStore(shards[0], shards[1])
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error pinging: %v", err)
+	}
+	shards[1].triggerError = true
+	if err := store.Ping(context.Background()); err == nil {
+		t.Error("did not receive expected error pinging with a failing shard")
+	}
+}
@@ -0,0 +1,67 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+)
+
+//ContextCloser is implemented by components that buffer events or writes
+//and process them in the background, such as AsyncEventSink, WebhookSink,
+//ReplicatedStore, WriteBehindStore, and MemoryStore's periodic snapshots.
+//CloseContext flushes everything that is buffered, and stops the background
+//work, so that nothing is lost when the process shuts down. If ctx is done
+//before the flush completes, CloseContext returns the context's error, and
+//the flush continues in the background. The component may not be used
+//after CloseContext is called.
+type ContextCloser interface {
+	CloseContext(ctx context.Context) error
+}
+
+//Close flushes and stops the event sinks passed to WithEventSinks, and then
+//the store, if they implement ContextCloser, so that buffered events and
+//pending writes aren't lost when the process shuts down. Call it after the
+//HTTP server has stopped handling requests, for example:
+//
+//	srv.Shutdown(ctx)
+//	if err := mgr.Close(ctx); err != nil {
+//		log.Printf("error closing session manager: %v", err)
+//	}
+//
+//The sinks stop receiving events as soon as Close is called. The first error
+//is returned, but the remaining components are still closed, bounded by ctx.
+//The manager may not be used after it is closed.
+func (m *manager) Close(ctx context.Context) error {
+	var firstErr error
+	for _, sink := range m.sinks {
+		sink.unsubscribe()
+	}
+	for _, sink := range m.sinks {
+		if closer, ok := sink.sink.(ContextCloser); ok {
+			if err := closer.CloseContext(ctx); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if closer, ok := m.store.(ContextCloser); ok {
+		if err := closer.CloseContext(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+//waitContext waits for wg, or until ctx is done,
+//in which case it returns the context's error
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
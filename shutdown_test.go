@@ -0,0 +1,76 @@
+package sessions
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManagerClose(t *testing.T) {
+	//hold up the async sink until the manager is closing
+	inner := &recordingSink{}
+	release := make(chan struct{})
+	async := NewAsyncEventSink(EventSinkFunc(func(evt Event) {
+		<-release
+		inner.Send(evt)
+	}), 10)
+	primary := newMockStore(false)
+	secondary := newMockStore(false)
+	store := NewReplicatedStore(AsyncReplication, primary, secondary)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store, WithEventSinks(async))
+
+	for i := 0; i < 3; i++ {
+		if _, err := mgr.BeginSession(nil, "test state"); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+	}
+
+	//closing should give up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mgr.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("incorrect error closing with a short deadline: expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	//and flush everything when it isn't
+	close(release)
+	if err := mgr.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error closing manager: %v", err)
+	}
+	if len(inner.events) != 3 {
+		t.Errorf("incorrect number of flushed events: expected 3 but got %d", len(inner.events))
+	}
+	if len(secondary.entries) != 3 {
+		t.Errorf("incorrect number of replicated writes: expected 3 but got %d", len(secondary.entries))
+	}
+
+	//the closed sink should no longer be subscribed
+	if n := len(mgr.(*manager).events.subscribers); n != 0 {
+		t.Errorf("incorrect number of subscribers after close: expected 0 but got %d", n)
+	}
+}
+
+func TestManagerCloseSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	store := NewMemoryStore(time.Hour)
+	store.SnapshotEvery(path, time.Hour, nil)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+	tk, err := mgr.BeginSession(nil, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if err := mgr.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error closing manager: %v", err)
+	}
+
+	//the session should be in the final snapshot
+	loaded := NewMemoryStore(time.Hour)
+	if err := loaded.LoadSnapshot(path); err != nil {
+		t.Fatalf("unexpected error loading snapshot: %v", err)
+	}
+	var state string
+	if err := loaded.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+}
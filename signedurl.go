@@ -0,0 +1,123 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//ParamSignedURL is the query string parameter added by SignURL
+const ParamSignedURL = "session_sig"
+
+//signedURLLabel is mixed into signed URL signatures, so that they
+//can never be confused with the signatures of session tokens
+const signedURLLabel = "sessions signed url"
+
+//ErrSignedURLExpired is returned from VerifyURL when
+//the signed URL's time-to-live has elapsed
+var ErrSignedURLExpired = errors.New("signed URL has expired")
+
+//SignURL returns a copy of rawurl with a ParamSignedURL query string
+//parameter added, which grants access to the token's session for requests
+//to that URL until ttl elapses. Use this for URLs that clients can't add
+//headers to, such as file downloads, image proxies, and EventSource
+//connections, so that the session token itself never appears in a URL,
+//where it might be logged or leaked through the Referer header. The
+//signature covers the URL's path and other query string parameters, so
+//it can't be used to access other URLs. Use VerifyURL to verify requests
+//for signed URLs.
+func (m *manager) SignURL(token Token, rawurl string, ttl time.Duration) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", fmt.Errorf("error parsing URL: %v", err)
+	}
+	//sign with the same key as the token, so that
+	//VerifyURL can reconstruct the same token
+	_, key, err := m.keys.verify(token.String(), m.tokenOpts)
+	if err != nil {
+		return "", err
+	}
+	idBuf, err := newTokenOptions(m.tokenOpts).idEnc().DecodeString(token.ID().String())
+	if err != nil {
+		return "", fmt.Errorf("error decoding session ID: %v", err)
+	}
+
+	query := u.Query()
+	query.Del(ParamSignedURL)
+	buf := make([]byte, len(idBuf), len(idBuf)+8+sha256.Size)
+	copy(buf, idBuf)
+	var expires [8]byte
+	binary.BigEndian.PutUint64(expires[:], uint64(time.Now().Add(ttl).UnixNano()))
+	buf = append(buf, expires[:]...)
+	buf = append(buf, signURL(key, buf, u.Path, query)...)
+
+	query.Set(ParamSignedURL, base64.RawURLEncoding.EncodeToString(buf))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+//VerifyURL verifies the ParamSignedURL query string parameter in a request
+//for a URL returned from SignURL, populates sessionState from the Store,
+//and returns the session's Token. ErrNoToken is returned if the request
+//URL isn't signed, and ErrSignedURLExpired is returned if the signed URL
+//has expired.
+func (m *manager) VerifyURL(r *http.Request, sessionState interface{}) (Token, error) {
+	query := r.URL.Query()
+	param := query.Get(ParamSignedURL)
+	if len(param) == 0 {
+		return nil, ErrNoToken
+	}
+	query.Del(ParamSignedURL)
+	buf, err := base64.RawURLEncoding.DecodeString(param)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding signed URL parameter: %v", err)
+	}
+	if len(buf) < MinIDLength+8+sha256.Size {
+		return nil, fmt.Errorf("signed URL parameter not long enough")
+	}
+
+	sigStart := len(buf) - sha256.Size
+	signed, sig := buf[:sigStart], buf[sigStart:]
+	for _, key := range m.keys {
+		secret, err := key.secret()
+		if err != nil || !hmac.Equal(sig, signURL(secret, signed, r.URL.Path, query)) {
+			continue
+		}
+		expires := time.Unix(0, int64(binary.BigEndian.Uint64(signed[sigStart-8:])))
+		if time.Now().After(expires) {
+			return nil, ErrSignedURLExpired
+		}
+		//reconstruct the session token from the ID
+		idBuf := signed[:sigStart-8]
+		to := newTokenOptions(m.tokenOpts)
+		tk := &token{
+			buf:   append(make([]byte, 0, len(idBuf)+key.sigSize()), idBuf...),
+			enc:   to.encoding,
+			idEnc: to.idEncoding,
+		}
+		tk.signWith(key)
+		if err := m.resume(r, tk, sessionState); err != nil {
+			return nil, getStateError(err)
+		}
+		return tk, nil
+	}
+	return nil, fmt.Errorf("signed URL has been modified since signed")
+}
+
+//signURL returns the HMAC signature of the signed URL parameter bytes,
+//along with the URL path and other query string parameters
+func signURL(signingKey []byte, buf []byte, path string, query url.Values) []byte {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte(signedURLLabel))
+	h.Write(buf)
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write([]byte(query.Encode()))
+	return h.Sum(nil)
+}
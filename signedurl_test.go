@@ -0,0 +1,74 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestManagerSignURL(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{"key1", "key2"}, newMockStore(false))
+	token, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	signed, err := mgr.SignURL(token, "https://example.com/files/report.pdf?download=1", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error signing URL: %v", err)
+	}
+	expired, err := mgr.SignURL(token, "https://example.com/files/report.pdf", -time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error signing URL: %v", err)
+	}
+	u, _ := url.Parse(signed)
+	sig := u.Query().Get(ParamSignedURL)
+
+	cases := []struct {
+		name          string
+		url           string
+		expectedError error
+		expectError   bool
+	}{
+		{"valid signed URL", signed, nil, false},
+		{"unsigned URL", "https://example.com/files/report.pdf?download=1", ErrNoToken, true},
+		{"expired signed URL", expired, ErrSignedURLExpired, true},
+		{"different path", "https://example.com/files/other.pdf?download=1&" + ParamSignedURL + "=" + sig, nil, true},
+		{"different query", "https://example.com/files/report.pdf?download=2&" + ParamSignedURL + "=" + sig, nil, true},
+		{"invalid signature", "https://example.com/files/report.pdf?download=1&" + ParamSignedURL + "=INVALID", nil, true},
+	}
+
+	for _, c := range cases {
+		var state string
+		actual, err := mgr.VerifyURL(httptest.NewRequest("GET", c.url, nil), &state)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("case %s: did not receive expected error", c.name)
+			} else if c.expectedError != nil && err != c.expectedError {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if actual.String() != token.String() {
+			t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, token.String(), actual.String())
+		}
+		if state != "test state" {
+			t.Errorf("case %s: incorrect state: expected %s but got %s", c.name, "test state", state)
+		}
+	}
+
+	//signed URLs should stop working once the session ends
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+token.String())
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+	var state string
+	if _, err := mgr.VerifyURL(httptest.NewRequest("GET", signed, nil), &state); err == nil {
+		t.Error("did not receive expected error verifying signed URL for ended session")
+	}
+}
@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
+
+//Algorithm identifies the algorithm used to sign tokens with a SigningKey
+type Algorithm string
+
+//Supported signing algorithms
+const (
+	//HS256 is HMAC-SHA-256, which is the default
+	HS256 Algorithm = "HS256"
+	//HS512 is HMAC-SHA-512
+	HS512 Algorithm = "HS512"
+	//EdDSA is Ed25519, which is not allowed in FIPS mode
+	EdDSA Algorithm = "EdDSA"
+)
+
+//SigningKey is a key used to sign and verify tokens, along with its
+//algorithm, so that a key ring can migrate from one algorithm to another
+//gradually: new tokens are signed with keys using the new algorithm,
+//while tokens signed with the old keys still verify until they're retired.
+//Use WithSigningKeys to add SigningKeys to a Manager.
+type SigningKey struct {
+	//Algorithm is the signing algorithm. If empty, HS256 is used.
+	Algorithm Algorithm
+	//Key is the secret key for HMAC algorithms. For EdDSA, it is either
+	//an ed25519.PrivateKey, which can sign and verify tokens, or an
+	//ed25519.PublicKey, which can only verify them, so that services
+	//that only verify tokens don't need the private key.
+	Key []byte
+}
+
+//alg returns the key's Algorithm, or HS256 if it's empty
+func (sk SigningKey) alg() Algorithm {
+	if len(sk.Algorithm) == 0 {
+		return HS256
+	}
+	return sk.Algorithm
+}
+
+//check returns an error if the key is empty, its algorithm is unknown,
+//it is the wrong size for its algorithm, or it isn't allowed in FIPS mode
+func (sk SigningKey) check() error {
+	if len(sk.Key) == 0 {
+		return fmt.Errorf("zero-length signing key")
+	}
+	switch sk.alg() {
+	case HS256, HS512:
+		return checkFIPSKey(sk.Key)
+	case EdDSA:
+		if fipsMode {
+			return fmt.Errorf("%s signing keys are %v", EdDSA, ErrNotFIPSApproved)
+		}
+		if len(sk.Key) != ed25519.PrivateKeySize && len(sk.Key) != ed25519.PublicKeySize {
+			return fmt.Errorf("%s signing key must be an ed25519 private or public key", EdDSA)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signing algorithm %q", sk.Algorithm)
+}
+
+//canSign reports whether the key can sign tokens,
+//rather than only verify them
+func (sk SigningKey) canSign() bool {
+	return sk.alg() != EdDSA || len(sk.Key) == ed25519.PrivateKeySize
+}
+
+//sigSize returns the size in bytes of the key's signatures
+func (sk SigningKey) sigSize() int {
+	switch sk.alg() {
+	case HS512:
+		return sha512.Size
+	case EdDSA:
+		return ed25519.SignatureSize
+	}
+	return sha256.Size
+}
+
+//appendSig appends the signature of buf to buf. The key must be able to sign.
+func (sk SigningKey) appendSig(buf []byte) []byte {
+	switch sk.alg() {
+	case EdDSA:
+		return append(buf, ed25519.Sign(ed25519.PrivateKey(sk.Key), buf)...)
+	case HS512:
+		return append(buf, hmacSum(sha512.New, sk.Key, buf)...)
+	}
+	return append(buf, hmacSum(sha256.New, sk.Key, buf)...)
+}
+
+//verifySig reports whether sig is the key's signature of msg
+func (sk SigningKey) verifySig(msg []byte, sig []byte) bool {
+	if len(sig) != sk.sigSize() {
+		return false
+	}
+	switch sk.alg() {
+	case EdDSA:
+		pub := ed25519.PublicKey(sk.Key)
+		if len(sk.Key) == ed25519.PrivateKeySize {
+			pub = ed25519.PrivateKey(sk.Key).Public().(ed25519.PublicKey)
+		}
+		return ed25519.Verify(pub, msg, sig)
+	case HS512:
+		return hmac.Equal(sig, hmacSum(sha512.New, sk.Key, msg))
+	}
+	return hmac.Equal(sig, hmacSum(sha256.New, sk.Key, msg))
+}
+
+//secret returns the secret bytes of the key, from which features such
+//as signed URLs and sub-tokens derive their own HMAC keys. Keys that can
+//only verify tokens have no secret.
+func (sk SigningKey) secret() ([]byte, error) {
+	if !sk.canSign() {
+		return nil, fmt.Errorf("%s public keys can only verify tokens", EdDSA)
+	}
+	return sk.Key, nil
+}
+
+//hmacSum returns the HMAC of msg, using the hash and key
+func hmacSum(h func() hash.Hash, key []byte, msg []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,150 @@
+package sessions
+
+import (
+	"crypto/ed25519"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSigningKeyAlgorithms(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating ed25519 key: %v", err)
+	}
+	cases := []struct {
+		name       string
+		key        SigningKey
+		verifyKey  SigningKey
+		otherKey   SigningKey
+		expectSize int
+	}{
+		{"default", SigningKey{Key: testSigningKey}, SigningKey{Key: testSigningKey},
+			SigningKey{Algorithm: HS512, Key: testSigningKey}, 32},
+		{"HS512", SigningKey{Algorithm: HS512, Key: testSigningKey}, SigningKey{Algorithm: HS512, Key: testSigningKey},
+			SigningKey{Algorithm: HS256, Key: testSigningKey}, 64},
+		{"EdDSA", SigningKey{Algorithm: EdDSA, Key: priv}, SigningKey{Algorithm: EdDSA, Key: pub},
+			SigningKey{Algorithm: HS512, Key: testSigningKey}, 64},
+	}
+
+	for _, c := range cases {
+		tk, err := NewTokenWithKey(c.key, DefaultIDLength, WithIssuedAt())
+		if err != nil {
+			t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+		}
+		if n := len(tk.(*token).buf); n != DefaultIDLength+issuedAtLength+c.expectSize {
+			t.Errorf("case %s: incorrect token length: expected %d but got %d", c.name, DefaultIDLength+issuedAtLength+c.expectSize, n)
+		}
+		verified, err := VerifyTokenWithKey(tk.String(), c.verifyKey, WithIssuedAt())
+		if err != nil {
+			t.Fatalf("case %s: unexpected error verifying token: %v", c.name, err)
+		}
+		if verified.ID().String() != tk.ID().String() || verified.ID().Len() != DefaultIDLength {
+			t.Errorf("case %s: incorrect ID: expected %s but got %s", c.name, tk.ID(), verified.ID())
+		}
+		if _, ok := IssuedAt(verified); !ok {
+			t.Errorf("case %s: issued-at time missing from verified token", c.name)
+		}
+		if _, err := VerifyTokenWithKey(tk.String(), c.otherKey, WithIssuedAt()); err == nil {
+			t.Errorf("case %s: did not receive expected error verifying with a key using another algorithm", c.name)
+		}
+	}
+
+	invalid := []SigningKey{
+		{Algorithm: HS256},
+		{Algorithm: "RS256", Key: testSigningKey},
+		{Algorithm: EdDSA, Key: testSigningKey},
+	}
+	for _, key := range invalid {
+		if _, err := NewTokenWithKey(key, DefaultIDLength); err == nil {
+			t.Errorf("did not receive expected error generating token with invalid key %+v", key)
+		}
+	}
+	if _, err := NewTokenWithKey(SigningKey{Algorithm: EdDSA, Key: pub}, DefaultIDLength); err == nil {
+		t.Error("did not receive expected error generating token with a public key")
+	}
+
+	defer func(enabled bool) { fipsMode = enabled }(fipsMode)
+	fipsMode = true
+	if _, err := NewTokenWithKey(SigningKey{Algorithm: EdDSA, Key: priv}, DefaultIDLength); err == nil {
+		t.Error("did not receive expected error generating EdDSA token in FIPS mode")
+	}
+	if _, err := NewTokenWithKey(SigningKey{Algorithm: HS512, Key: testSigningKey}, DefaultIDLength); err != nil {
+		t.Errorf("unexpected error generating HS512 token in FIPS mode: %v", err)
+	}
+}
+
+func TestManagerSigningKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating ed25519 key: %v", err)
+	}
+	oldTk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store := newMockStore(false)
+	if err := store.Save(oldTk, "old state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+
+	//tokens signed with the new EdDSA key and old HS256 key should both verify
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithSigningKeys(SigningKey{Algorithm: EdDSA, Key: priv}))
+	var state string
+	for i := 0; i < 10; i++ {
+		respRec := httptest.NewRecorder()
+		if _, err := mgr.BeginSession(respRec, "new state"); err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+		if _, err := mgr.GetState(req, &state); err != nil || state != "new state" {
+			t.Errorf("incorrect result for new token: expected %s, %v but got %s, %v", "new state", nil, state, err)
+		}
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+oldTk.String())
+	if _, err := mgr.GetState(req, &state); err != nil || state != "old state" {
+		t.Errorf("incorrect result for old token: expected %s, %v but got %s, %v", "old state", nil, state, err)
+	}
+
+	//a manager with only the public key should verify tokens signed with the private key
+	signer := NewManager(DefaultIDLength, nil, store, WithSigningKeys(SigningKey{Algorithm: EdDSA, Key: priv}))
+	verifier := NewManager(DefaultIDLength, nil, store, WithSigningKeys(SigningKey{Algorithm: EdDSA, Key: pub}))
+	respRec := httptest.NewRecorder()
+	if _, err := signer.BeginSession(respRec, "signed state"); err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	if _, err := verifier.GetState(req, &state); err != nil || state != "signed state" {
+		t.Errorf("incorrect result verifying with public key: expected %s, %v but got %s, %v", "signed state", nil, state, err)
+	}
+
+	//but can't begin sessions
+	if _, err := verifier.BeginSession(httptest.NewRecorder(), "new state"); err != ErrNoSigningKey {
+		t.Errorf("incorrect error beginning session with only a public key: expected %v but got %v", ErrNoSigningKey, err)
+	}
+
+	//and neither should a Verifier
+	if _, err := NewVerifierWithKeys([]SigningKey{{Algorithm: EdDSA, Key: pub}}).Verify(req); err != nil {
+		t.Errorf("unexpected error verifying with public key: %v", err)
+	}
+
+	//invalid keys should be caught at construction
+	panicked := func(construct func()) (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		construct()
+		return false
+	}
+	if !panicked(func() {
+		NewManager(DefaultIDLength, nil, store, WithSigningKeys(SigningKey{Algorithm: "RS256", Key: testSigningKey}))
+	}) {
+		t.Error("NewManager did not panic with an invalid signing key")
+	}
+	if !panicked(func() {
+		NewStatelessManagerWithKeys([]SigningKey{{Algorithm: EdDSA, Key: pub}})
+	}) {
+		t.Error("NewStatelessManagerWithKeys did not panic with a public key")
+	}
+}
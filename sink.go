@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+//EventSink consumes session lifecycle events. WebhookSink, ExpvarMetrics,
+//and the sinks in the kafkasink package all implement EventSink, so any
+//combination of them can consume the same stream of events:
+//
+//	webhooks := sessions.NewWebhookSink(webhookKey, webhookURL)
+//	defer webhooks.Close()
+//	logs := sessions.NewAsyncEventSink(sessions.LogSink(nil), 1024)
+//	defer logs.Close()
+//	mgr := sessions.NewManager(sessions.DefaultIDLength, signingKeys, store,
+//		sessions.WithEventSinks(webhooks, logs))
+//
+//Events are sent synchronously on the goroutine handling the request,
+//so Send should return quickly. Wrap slow sinks with NewAsyncEventSink.
+type EventSink interface {
+	//Send consumes the event
+	Send(evt Event)
+}
+
+//EventSinkFunc adapts a function to an EventSink
+type EventSinkFunc func(evt Event)
+
+//Send calls the function with the event
+func (fn EventSinkFunc) Send(evt Event) {
+	fn(evt)
+}
+
+//WithEventSinks sends all session lifecycle events to the sinks
+func WithEventSinks(sinks ...EventSink) ManagerOption {
+	return func(m *manager) {
+		for _, sink := range sinks {
+			m.sinks = append(m.sinks, sinkSubscription{sink, m.events.subscribe(sink.Send)})
+		}
+	}
+}
+
+//sinkSubscription is an EventSink subscribed to the manager's events,
+//which the manager unsubscribes and flushes when it is closed
+type sinkSubscription struct {
+	sink        EventSink
+	unsubscribe func()
+}
+
+//fanOutSink is an EventSink that sends events to several sinks
+type fanOutSink []EventSink
+
+//FanOut returns an EventSink that sends each event
+//to each of the sinks, in order
+func FanOut(sinks ...EventSink) EventSink {
+	return fanOutSink(sinks)
+}
+
+func (fs fanOutSink) Send(evt Event) {
+	for _, sink := range fs {
+		sink.Send(evt)
+	}
+}
+
+//LogSink returns an EventSink that writes each event to logger,
+//or to the standard logger if logger is nil
+func LogSink(logger *log.Logger) EventSink {
+	return EventSinkFunc(func(evt Event) {
+		if logger == nil {
+			log.Printf("session %s %s", evt.SessionID, evt.Type)
+			return
+		}
+		logger.Printf("session %s %s", evt.SessionID, evt.Type)
+	})
+}
+
+//AsyncEventSink is an EventSink that queues events and sends them to
+//another sink on a background goroutine, so that slow sinks don't slow
+//down requests. If the queue is full, events are dropped rather than
+//blocking the request.
+type AsyncEventSink struct {
+	//OnDrop is called with each event that is dropped because the
+	//queue is full. Callers may set this after construction.
+	OnDrop    func(evt Event)
+	sink      EventSink
+	queue     chan Event
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+//NewAsyncEventSink constructs a new AsyncEventSink that sends events
+//to sink, queueing up to queueSize events. Call Close or CloseContext
+//to flush queued events before the process exits.
+func NewAsyncEventSink(sink EventSink, queueSize int) *AsyncEventSink {
+	as := &AsyncEventSink{
+		sink:  sink,
+		queue: make(chan Event, queueSize),
+	}
+	as.wg.Add(1)
+	go as.forward()
+	return as
+}
+
+//Send queues the event, or drops it and calls OnDrop if the queue
+//is full. The sink may not be sent events after it is closed.
+func (as *AsyncEventSink) Send(evt Event) {
+	select {
+	case as.queue <- evt:
+	default:
+		if as.OnDrop != nil {
+			as.OnDrop(evt)
+		}
+	}
+}
+
+//Close waits for any queued events to be sent,
+//and stops the background worker
+func (as *AsyncEventSink) Close() error {
+	return as.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done,
+//returning its error, while the queued events continue to be sent
+func (as *AsyncEventSink) CloseContext(ctx context.Context) error {
+	as.closeOnce.Do(func() {
+		close(as.queue)
+	})
+	return waitContext(ctx, &as.wg)
+}
+
+//forward sends queued events to the sink until the queue is closed
+func (as *AsyncEventSink) forward() {
+	defer as.wg.Done()
+	for evt := range as.queue {
+		as.sink.Send(evt)
+	}
+}
@@ -0,0 +1,87 @@
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//recordingSink is an EventSink that records the events it receives
+type recordingSink struct {
+	mx     sync.Mutex
+	events []Event
+}
+
+func (rs *recordingSink) Send(evt Event) {
+	rs.mx.Lock()
+	defer rs.mx.Unlock()
+	rs.events = append(rs.events, evt)
+}
+
+func TestWithEventSinks(t *testing.T) {
+	sinks := []*recordingSink{{}, {}}
+	buf := bytes.NewBuffer(nil)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithEventSinks(FanOut(sinks[0], sinks[1]), LogSink(log.New(buf, "", 0))))
+
+	respRec := httptest.NewRecorder()
+	tk, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, fmt.Sprintf("%s %s", authTypeBearer, tk.String()))
+	if err := mgr.EndSession(req); err != nil {
+		t.Fatalf("unexpected error ending session: %v", err)
+	}
+
+	for i, sink := range sinks {
+		if len(sink.events) != 2 || sink.events[0].Type != EventCreated || sink.events[1].Type != EventEnded {
+			t.Errorf("incorrect events for sink %d: %v", i, sink.events)
+		}
+	}
+	expectedLog := fmt.Sprintf("session %s created\nsession %s ended\n", tk.ID(), tk.ID())
+	if buf.String() != expectedLog {
+		t.Errorf("incorrect log: expected %q but got %q", expectedLog, buf.String())
+	}
+}
+
+func TestAsyncEventSink(t *testing.T) {
+	//block the inner sink until the queue has been filled
+	inner := &recordingSink{}
+	release := make(chan struct{})
+	var dropped []Event
+	as := NewAsyncEventSink(EventSinkFunc(func(evt Event) {
+		<-release
+		inner.Send(evt)
+	}), 1)
+	as.OnDrop = func(evt Event) { dropped = append(dropped, evt) }
+
+	as.Send(Event{Type: EventCreated, SessionID: "a"})
+	//wait for the worker to take the first event, leaving the queue empty
+	for len(as.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	as.Send(Event{Type: EventCreated, SessionID: "b"})
+	as.Send(Event{Type: EventCreated, SessionID: "c"})
+	close(release)
+	if err := as.Close(); err != nil {
+		t.Fatalf("unexpected error closing sink: %v", err)
+	}
+
+	var sent []string
+	for _, evt := range inner.events {
+		sent = append(sent, evt.SessionID)
+	}
+	if strings.Join(sent, ",") != "a,b" {
+		t.Errorf("incorrect sent events: %v", sent)
+	}
+	if len(dropped) != 1 || dropped[0].SessionID != "c" {
+		t.Errorf("incorrect dropped events: %v", dropped)
+	}
+}
@@ -0,0 +1,209 @@
+package sessions
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//snapshotVersion is the version of the MemoryStore snapshot format
+const snapshotVersion = 1
+
+//snapshotHeader begins a MemoryStore snapshot
+type snapshotHeader struct {
+	Version int
+}
+
+//snapshotEntry is one session in a MemoryStore snapshot
+type snapshotEntry struct {
+	SessionID string
+	State     []byte
+	Expires   time.Time
+}
+
+//WriteSnapshot writes all unexpired sessions in the store to w, along with
+//their expiry times. Use ReadSnapshot to load them back into a store.
+//Each shard is locked only while its sessions are copied, so the store
+//may be used while the snapshot is written.
+func (ms *MemoryStore) WriteSnapshot(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion}); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	for _, shard := range ms.shards {
+		now := time.Now()
+		shard.mx.Lock()
+		//write from least to most recently used, so that
+		//loading the snapshot restores the LRU order
+		entries := make([]snapshotEntry, 0, len(shard.entries))
+		for elem := shard.lru.Back(); elem != nil; elem = elem.Prev() {
+			entry := elem.Value.(*memoryEntry)
+			if now.Before(entry.expires) {
+				entries = append(entries, snapshotEntry{entry.sessionID, entry.state, entry.expires})
+			}
+		}
+		shard.mx.Unlock()
+		for _, entry := range entries {
+			if err := enc.Encode(entry); err != nil {
+				return fmt.Errorf("error writing snapshot: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+//ReadSnapshot reads sessions written by WriteSnapshot from r into the
+//store. Sessions keep the expiry times they had when the snapshot was
+//written, so sessions that have since expired are skipped. The store's
+//MaxEntries and MaxBytes limits are enforced as the sessions are loaded.
+func (ms *MemoryStore) ReadSnapshot(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	header := snapshotHeader{}
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("error reading snapshot: %v", err)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+	for {
+		entry := snapshotEntry{}
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading snapshot: %v", err)
+		}
+		if time.Now().Before(entry.Expires) {
+			ms.put(entry.SessionID, entry.State, entry.Expires)
+		}
+	}
+}
+
+//SaveSnapshot writes a snapshot of the store to the file at path. The
+//snapshot is written to a temporary file in the same directory, which
+//then replaces the file at path, so a crash while writing never leaves
+//a partial snapshot behind.
+func (ms *MemoryStore) SaveSnapshot(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if err := ms.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing snapshot file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing snapshot file: %v", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("error replacing snapshot file: %v", err)
+	}
+	return nil
+}
+
+//LoadSnapshot reads the snapshot in the file at path into the store.
+//If the file doesn't exist, as on the very first startup, the store is
+//left empty and no error is returned.
+func (ms *MemoryStore) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error opening snapshot file: %v", err)
+	}
+	defer f.Close()
+	return ms.ReadSnapshot(f)
+}
+
+//SnapshotEvery saves a snapshot of the store to the file at path every
+//interval, in the background. Any errors saving the periodic snapshots
+//are passed to onError, which may be nil. It returns a function that
+//stops the snapshots and saves a final one, returning its error, which
+//should be called when the process shuts down, or call CloseContext to
+//stop all of the store's periodic snapshots. For example:
+//
+//	store := sessions.NewMemoryStore(time.Hour)
+//	if err := store.LoadSnapshot(snapshotPath); err != nil {
+//		log.Fatal(err)
+//	}
+//	stopSnapshots := store.SnapshotEvery(snapshotPath, time.Minute, nil)
+//	...
+//	//during graceful shutdown
+//	if err := stopSnapshots(); err != nil {
+//		log.Printf("error saving snapshot: %v", err)
+//	}
+func (ms *MemoryStore) SnapshotEvery(path string, interval time.Duration, onError func(err error)) func() error {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := ms.SaveSnapshot(path); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	stop := func() error {
+		stopOnce.Do(func() {
+			close(done)
+		})
+		wg.Wait()
+		return ms.SaveSnapshot(path)
+	}
+	ms.snapshotMx.Lock()
+	ms.stopSnapshots = append(ms.stopSnapshots, stop)
+	ms.snapshotMx.Unlock()
+	return stop
+}
+
+//CloseContext stops all periodic snapshots started with SnapshotEvery,
+//and saves a final snapshot for each, so that sessions saved since the
+//last periodic snapshot aren't lost when the process shuts down. It
+//returns the first error saving the snapshots, or the context's error
+//if ctx is done first, in which case the snapshots continue to be saved
+//in the background. The store may still be used, but is no longer
+//snapshotted.
+func (ms *MemoryStore) CloseContext(ctx context.Context) error {
+	ms.snapshotMx.Lock()
+	stops := ms.stopSnapshots
+	ms.stopSnapshots = nil
+	ms.snapshotMx.Unlock()
+
+	result := make(chan error, 1)
+	go func() {
+		var firstErr error
+		for _, stop := range stops {
+			if err := stop(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		result <- firstErr
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package sessions
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreSnapshot(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	tokens := make([]Token, 10)
+	for i := range tokens {
+		tokens[i], _ = NewToken(testSigningKey)
+		if err := store.Save(tokens[i], i); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	expired, _ := NewToken(testSigningKey)
+	store.SessionDuration = -time.Second
+	store.Save(expired, -1)
+
+	buf := bytes.NewBuffer(nil)
+	if err := store.WriteSnapshot(buf); err != nil {
+		t.Fatalf("unexpected error writing snapshot: %v", err)
+	}
+
+	loaded := NewShardedMemoryStore(time.Hour, 3)
+	if err := loaded.ReadSnapshot(buf); err != nil {
+		t.Fatalf("unexpected error reading snapshot: %v", err)
+	}
+	if loaded.Len() != len(tokens) {
+		t.Errorf("incorrect length: expected %d but got %d", len(tokens), loaded.Len())
+	}
+	for i, tk := range tokens {
+		var state int
+		if err := loaded.Get(tk, &state); err != nil || state != i {
+			t.Errorf("incorrect state: expected %d, <nil> but got %d, %v", i, state, err)
+		}
+	}
+	if exists, _ := loaded.Exists(expired); exists {
+		t.Error("expired session was loaded from snapshot")
+	}
+
+	//invalid snapshots should return errors
+	if err := loaded.ReadSnapshot(bytes.NewBufferString("not a snapshot")); err == nil {
+		t.Error("expected error reading invalid snapshot")
+	}
+}
+
+func TestMemoryStoreSnapshotRemainingTTL(t *testing.T) {
+	store := NewShardedMemoryStore(20*time.Millisecond, 1)
+	tk, _ := NewToken(testSigningKey)
+	store.Save(tk, "test state")
+	buf := bytes.NewBuffer(nil)
+	if err := store.WriteSnapshot(buf); err != nil {
+		t.Fatalf("unexpected error writing snapshot: %v", err)
+	}
+
+	//the loaded session should keep its original expiry time,
+	//not the loading store's session duration
+	loaded := NewShardedMemoryStore(time.Hour, 1)
+	if err := loaded.ReadSnapshot(buf); err != nil {
+		t.Fatalf("unexpected error reading snapshot: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if exists, _ := loaded.Exists(tk); exists {
+		t.Error("loaded session did not keep its remaining TTL")
+	}
+}
+
+func TestMemoryStoreSnapshotOrder(t *testing.T) {
+	store := NewShardedMemoryStore(time.Hour, 1)
+	tokens := make([]Token, 3)
+	for i := range tokens {
+		tokens[i], _ = NewToken(testSigningKey)
+		store.Save(tokens[i], i)
+	}
+	store.Touch(tokens[0])
+	buf := bytes.NewBuffer(nil)
+	store.WriteSnapshot(buf)
+
+	//the least-recently used session should be evicted first
+	loaded := NewShardedMemoryStore(time.Hour, 1)
+	loaded.MaxEntries = 2
+	if err := loaded.ReadSnapshot(buf); err != nil {
+		t.Fatalf("unexpected error reading snapshot: %v", err)
+	}
+	for i, expected := range []bool{true, false, true} {
+		if exists, _ := loaded.Exists(tokens[i]); exists != expected {
+			t.Errorf("incorrect existence for session %d: expected %t but got %t", i, expected, exists)
+		}
+	}
+}
+
+func TestMemoryStoreSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	store := NewMemoryStore(time.Hour)
+
+	//loading a missing snapshot should leave the store empty
+	if err := store.LoadSnapshot(path); err != nil {
+		t.Errorf("unexpected error loading missing snapshot: %v", err)
+	}
+
+	tk, _ := NewToken(testSigningKey)
+	store.Save(tk, "test state")
+	errs := make(chan error, 1)
+	stop := store.SnapshotEvery(path, time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	time.Sleep(10 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatalf("unexpected error saving final snapshot: %v", err)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error saving periodic snapshot: %v", err)
+	default:
+	}
+
+	loaded := NewMemoryStore(time.Hour)
+	if err := loaded.LoadSnapshot(path); err != nil {
+		t.Fatalf("unexpected error loading snapshot: %v", err)
+	}
+	var state string
+	if err := loaded.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+
+	//no temporary files should be left behind
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("incorrect number of files in snapshot directory: %d", len(files))
+	}
+}
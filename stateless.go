@@ -0,0 +1,250 @@
+package sessions
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+//encryptionKeyLabel is used to derive the AES key for stateless
+//tokens from a signing key, so that the same key bytes are never
+//used directly for both signing and encryption
+const encryptionKeyLabel = "sessions stateless encryption key"
+
+//statelessSigningLabel is used to derive the HMAC key for stateless
+//tokens from a signing key, and is the additional data of their
+//encrypted state, so that a Manager using the same signing keys
+//rejects stateless tokens, and a StatelessManager rejects its tokens
+const statelessSigningLabel = "sessions stateless signing key"
+
+//expiresLength is the length in bytes of the expiry time
+//sealed with the state in stateless tokens
+const expiresLength = 8
+
+//DefaultStatelessTTL is how long stateless tokens
+//are valid unless WithStatelessTTL is used
+const DefaultStatelessTTL = 24 * time.Hour
+
+//WithStatelessTTL sets how long stateless tokens are valid after they
+//are generated. The expiry time is encrypted with the state, and tokens
+//are rejected with ErrSessionExpired after it passes, as stateless
+//sessions can't otherwise be ended. The default is DefaultStatelessTTL.
+//This has no effect when verifying tokens, or on other kinds of tokens.
+func WithStatelessTTL(ttl time.Duration) TokenOption {
+	return func(to *tokenOptions) {
+		to.statelessTTL = ttl
+	}
+}
+
+//StatelessManager describes what a stateless session manager can do.
+//Stateless managers embed the session state directly in the token,
+//so they never touch a Store, but they also can't end a session
+//before the token expires (see WithStatelessTTL). Use them only for
+//small amounts of state, such as a few claims about the user.
+type StatelessManager interface {
+	BeginSession(w http.ResponseWriter, sessionState interface{}) (Token, error)
+	GetToken(r *http.Request) (Token, error)
+	GetState(r *http.Request, sessionState interface{}) (Token, error)
+}
+
+//statelessManager is the concrete implementation of the StatelessManager interface
+type statelessManager struct {
+	keys keyRing
+	//macKeys are derived from keys, and sign the tokens
+	macKeys   keyRing
+	tokenOpts []TokenOption
+}
+
+//NewStatelessManager constructs a new StatelessManager. Pass one or more
+//signingKeys to use for signing and encrypting session tokens--if multiple
+//are provided, the manager will rotate which key is used over time.
+//Any TokenOptions are used when generating and verifying tokens.
+func NewStatelessManager(signingKeys []string, opts ...TokenOption) StatelessManager {
+	return NewStatelessManagerWithKeys(newKeyRing(signingKeys), opts...)
+}
+
+//NewStatelessManagerWithKeys is like NewStatelessManager, but accepts
+//keys that declare their own algorithms. Stateless tokens are encrypted
+//and signed with keys derived from the signing keys' secrets, so their
+//algorithms aren't used, and each key must be able to sign. It panics
+//if any key is invalid, or can only verify tokens.
+func NewStatelessManagerWithKeys(signingKeys []SigningKey, opts ...TokenOption) StatelessManager {
+	keys := append(keyRing(nil), signingKeys...)
+	keys.mustCheck()
+	for _, key := range keys {
+		if _, err := key.secret(); err != nil {
+			panic(err)
+		}
+	}
+	macKeys := make(keyRing, len(keys))
+	for i, key := range keys {
+		macKeys[i] = SigningKey{Algorithm: HS256, Key: statelessSigningKey(key.Key)}
+	}
+	return &statelessManager{
+		keys:      keys,
+		macKeys:   macKeys,
+		tokenOpts: opts,
+	}
+}
+
+//BeginSession begins a new stateless session, encrypting the sessionState
+//into the new Token, which is added to the response Authorization header.
+func (m *statelessManager) BeginSession(w http.ResponseWriter, sessionState interface{}) (Token, error) {
+	key, err := m.keys.random()
+	if err != nil {
+		return nil, err
+	}
+	tk, err := NewStatelessToken(key.Key, sessionState, m.tokenOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error generating new token: %v", err)
+	}
+	if err := DefaultTransport.Write(w, tk); err != nil {
+		return nil, fmt.Errorf("error writing token to response: %v", err)
+	}
+	return tk, nil
+}
+
+//GetToken gets and verifies the Token (if any) from the request,
+//returning ErrSessionExpired if it has expired.
+func (m *statelessManager) GetToken(r *http.Request) (Token, error) {
+	return m.GetState(r, nil)
+}
+
+//GetState gets and verifies the Token from the request, and decrypts
+//the session state embedded within it into sessionState. If the
+//token has expired, ErrSessionExpired is returned.
+func (m *statelessManager) GetState(r *http.Request, sessionState interface{}) (Token, error) {
+	b64tk, err := DefaultTransport.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	tk, i, err := m.macKeys.verifyIndex(b64tk, m.tokenOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := openStatelessToken(tk, m.keys[i].Key, sessionState); err != nil {
+		return nil, err
+	}
+	return tk, nil
+}
+
+//NewStatelessToken constructs a new Token containing the sessionState,
+//which is encoded using the DefaultCodec and encrypted using AES-GCM along with
+//the token's expiry time (see WithStatelessTTL). The encryption key and the key
+//that signs the token are derived from the signingKey, so stateless tokens can't
+//be verified as regular tokens, and vice-versa. The ID portion of the returned
+//token is the encrypted state.
+func NewStatelessToken(signingKey []byte, sessionState interface{}, opts ...TokenOption) (Token, error) {
+	if len(signingKey) == 0 {
+		return nil, fmt.Errorf("zero-length signing key")
+	}
+	if err := checkFIPSKey(signingKey); err != nil {
+		return nil, err
+	}
+	aead, err := newStatelessAEAD(signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	//encode the session state
+	state, err := encodeState(sessionState)
+	if err != nil {
+		return nil, err
+	}
+
+	//read a random nonce, and seal the expiry time and state after
+	//it, leaving capacity for the issued-at time and the signature
+	to := newTokenOptions(opts)
+	plaintext := binary.BigEndian.AppendUint64(make([]byte, 0, expiresLength+len(state)),
+		uint64(time.Now().Add(to.statelessTTL).Unix()))
+	plaintext = append(plaintext, state...)
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead()+issuedAtLength+sha256.Size)
+	if _, err := io.ReadFull(to.rand, nonce); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %v", err)
+	}
+	tk := &token{
+		buf:   aead.Seal(nonce, nonce, plaintext, []byte(statelessSigningLabel)),
+		enc:   to.encoding,
+		idEnc: to.idEncoding,
+	}
+
+	//append the issued-at time, if requested
+	if to.issuedAt {
+		tk.buf = binary.BigEndian.AppendUint64(tk.buf, uint64(time.Now().Unix()))
+		tk.issuedAt = true
+	}
+
+	//sign and return
+	tk.sign(statelessSigningKey(signingKey))
+	return tk, nil
+}
+
+//OpenStatelessToken verifies a base64-encoded stateless token using the
+//provided signingKey, and decrypts the embedded state into sessionState,
+//which must be passed by reference. If the token has expired,
+//ErrSessionExpired is returned.
+func OpenStatelessToken(b64token string, signingKey []byte, sessionState interface{}, opts ...TokenOption) (Token, error) {
+	if len(signingKey) == 0 {
+		return nil, fmt.Errorf("zero-length signing key")
+	}
+	tk, err := VerifyToken(b64token, statelessSigningKey(signingKey), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := openStatelessToken(tk, signingKey, sessionState); err != nil {
+		return nil, err
+	}
+	return tk, nil
+}
+
+//openStatelessToken decrypts the state embedded in an already-verified
+//token, checks its expiry time, and decodes it into sessionState,
+//unless sessionState is nil
+func openStatelessToken(tk Token, signingKey []byte, sessionState interface{}) error {
+	aead, err := newStatelessAEAD(signingKey)
+	if err != nil {
+		return err
+	}
+	//the ID portion of the token is the nonce followed by the sealed state
+	sealed := tk.ID().(*id).buf
+	if len(sealed) < aead.NonceSize() {
+		return fmt.Errorf("token not long enough")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(statelessSigningLabel))
+	if err != nil {
+		return fmt.Errorf("error decrypting session state: %v", err)
+	}
+	if len(plaintext) < expiresLength {
+		return fmt.Errorf("session state not long enough")
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(plaintext[:expiresLength])), 0)
+	if !time.Now().Before(expires) {
+		return ErrSessionExpired
+	}
+	if sessionState == nil {
+		return nil
+	}
+	return decodeState(plaintext[expiresLength:], sessionState)
+}
+
+//newStatelessAEAD returns an AES-GCM cipher using a key
+//derived from the signingKey
+func newStatelessAEAD(signingKey []byte) (cipher.AEAD, error) {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte(encryptionKeyLabel))
+	return newAEAD(h.Sum(nil))
+}
+
+//statelessSigningKey derives the key that signs stateless
+//tokens from the signingKey
+func statelessSigningKey(signingKey []byte) []byte {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte(statelessSigningLabel))
+	return h.Sum(nil)
+}
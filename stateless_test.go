@@ -0,0 +1,224 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type statelessState struct {
+	UserID int
+	Roles  []string
+}
+
+func TestStatelessToken(t *testing.T) {
+	state := &statelessState{42, []string{"admin"}}
+	token, err := NewStatelessToken(testSigningKey, state)
+	if err != nil {
+		t.Fatalf("unexpected error generating stateless token: %v", err)
+	}
+
+	//ensure we can open it and get the same state back
+	stateGet := &statelessState{}
+	token2, err := OpenStatelessToken(token.String(), testSigningKey, stateGet)
+	if err != nil {
+		t.Fatalf("unexpected error opening stateless token: %v", err)
+	}
+	if token2.String() != token.String() {
+		t.Errorf("incorrect token: expected %s but got %s", token.String(), token2.String())
+	}
+	if !reflect.DeepEqual(stateGet, state) {
+		t.Errorf("incorrect state: expected %+v but got %+v", state, stateGet)
+	}
+
+	//failure cases
+	cases := []struct {
+		name       string
+		token      string
+		signingKey []byte
+	}{
+		{
+			"incorrect signing key",
+			token.String(),
+			[]byte("incorrect signing key"),
+		},
+		{
+			"modified token",
+			modToken(token.String()),
+			testSigningKey,
+		},
+		{
+			"non-stateless token",
+			func() string {
+				tk, err := NewToken(testSigningKey)
+				if err != nil {
+					t.Fatalf("unexpected error generating token: %v", err)
+				}
+				return tk.String()
+			}(),
+			testSigningKey,
+		},
+	}
+
+	for _, c := range cases {
+		if _, err := OpenStatelessToken(c.token, c.signingKey, &statelessState{}); err == nil {
+			t.Errorf("case %s: did not receive expected error", c.name)
+		}
+	}
+
+	//ensure we get errors for an empty key, unencodable state, and failure to read random bytes
+	if _, err := NewStatelessToken(nil, state); err == nil {
+		t.Error("did not receive expected error with zero-length signing key")
+	}
+	if _, err := NewStatelessToken(testSigningKey, func() {}); err == nil {
+		t.Error("did not receive expected error with un-serializable state")
+	}
+	if _, err := NewStatelessToken(testSigningKey, state, WithRand(&errorReader{})); err == nil {
+		t.Error("did not receive expected error when simulating error reading random bytes")
+	}
+}
+
+func TestStatelessManager(t *testing.T) {
+	mgr := NewStatelessManager([]string{"key one", "key two"})
+	respRec := httptest.NewRecorder()
+	state := &statelessState{42, []string{"admin"}}
+
+	token, err := mgr.BeginSession(respRec, state)
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	authHeader := respRec.Header().Get(headerAuthorization)
+	expectedHeader := fmt.Sprintf("%s %s", authTypeBearer, token.String())
+	if authHeader != expectedHeader {
+		t.Errorf("incorrect Authorization header in response: expected %s but got %s", expectedHeader, authHeader)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authHeader)
+	stateGet := &statelessState{}
+	if _, err := mgr.GetState(req, stateGet); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(stateGet, state) {
+		t.Errorf("incorrect state: expected %+v but got %+v", state, stateGet)
+	}
+	if _, err := mgr.GetToken(req); err != nil {
+		t.Errorf("unexpected error getting token: %v", err)
+	}
+
+	//a manager with different keys should not be able to verify the token
+	mgr2 := NewStatelessManager([]string{"some other key"})
+	if _, err := mgr2.GetState(req, &statelessState{}); err == nil {
+		t.Error("did not receive expected error when getting state with incorrect keys")
+	}
+
+	//requests without a token should get ErrNoToken
+	req = httptest.NewRequest("GET", "http://example.com", nil)
+	if _, err := mgr.GetState(req, &statelessState{}); err != ErrNoToken {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoToken, err)
+	}
+	if _, err := mgr.GetToken(req); err != ErrNoToken {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoToken, err)
+	}
+
+	//errors while generating the token should be returned
+	if _, err := mgr.BeginSession(respRec, func() {}); err == nil {
+		t.Error("did not receive expected error when beginning session with un-serializable state")
+	}
+}
+
+func TestStatelessManagerIssuedAt(t *testing.T) {
+	mgr := NewStatelessManager([]string{"key one"}, WithIssuedAt())
+	state := &statelessState{42, []string{"admin"}}
+	before := time.Now().Truncate(time.Second)
+	token, err := mgr.BeginSession(httptest.NewRecorder(), state)
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	issued, ok := IssuedAt(token)
+	if !ok || issued.Before(before) || issued.After(time.Now()) {
+		t.Errorf("incorrect issued-at time: expected about %v but got %v, %t", before, issued, ok)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Add(headerAuthorization, authTypeBearer+" "+token.String())
+	stateGet := &statelessState{}
+	verified, err := mgr.GetState(req, stateGet)
+	if err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(stateGet, state) {
+		t.Errorf("incorrect state: expected %+v but got %+v", state, stateGet)
+	}
+	if verifiedIssued, _ := IssuedAt(verified); !verifiedIssued.Equal(issued) {
+		t.Errorf("incorrect issued-at time after verifying: expected %v but got %v", issued, verifiedIssued)
+	}
+
+	//the layout must match, so a manager without the option can't verify it
+	if _, err := NewStatelessManager([]string{"key one"}).GetState(req, &statelessState{}); err == nil {
+		t.Error("did not receive expected error getting state without WithIssuedAt")
+	}
+}
+
+func TestStatelessTokenExpiry(t *testing.T) {
+	state := &statelessState{42, []string{"admin"}}
+	cases := []struct {
+		name        string
+		ttl         time.Duration
+		expectedErr error
+	}{
+		{"valid", time.Minute, nil},
+		{"expired", -time.Second, ErrSessionExpired},
+	}
+	for _, c := range cases {
+		mgr := NewStatelessManager([]string{"key one"}, WithStatelessTTL(c.ttl))
+		token, err := mgr.BeginSession(httptest.NewRecorder(), state)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error beginning session: %v", c.name, err)
+		}
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, authTypeBearer+" "+token.String())
+		if _, err := mgr.GetState(req, &statelessState{}); err != c.expectedErr {
+			t.Errorf("case %s: incorrect error getting state: expected %v but got %v", c.name, c.expectedErr, err)
+		}
+		if _, err := mgr.GetToken(req); err != c.expectedErr {
+			t.Errorf("case %s: incorrect error getting token: expected %v but got %v", c.name, c.expectedErr, err)
+		}
+		if _, err := OpenStatelessToken(token.String(), []byte("key one"), &statelessState{}); err != c.expectedErr {
+			t.Errorf("case %s: incorrect error opening token: expected %v but got %v", c.name, c.expectedErr, err)
+		}
+	}
+}
+
+func TestStatelessTokensAreNotSessionTokens(t *testing.T) {
+	keys := []string{"key one"}
+	statelessMgr := NewStatelessManager(keys)
+	mgr := NewManager(DefaultIDLength, keys, NewMemoryStore(time.Hour))
+
+	statelessTk, err := statelessMgr.BeginSession(httptest.NewRecorder(), &statelessState{42, nil})
+	if err != nil {
+		t.Fatalf("unexpected error beginning stateless session: %v", err)
+	}
+	tk, err := mgr.BeginSession(httptest.NewRecorder(), &statelessState{42, nil})
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+
+	newRequest := func(tk Token) *http.Request {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.Header.Add(headerAuthorization, authTypeBearer+" "+tk.String())
+		return req
+	}
+	if _, err := mgr.GetToken(newRequest(statelessTk)); err == nil {
+		t.Error("did not receive expected error verifying stateless token with manager")
+	}
+	if _, err := VerifyToken(statelessTk.String(), []byte(keys[0])); err == nil {
+		t.Error("did not receive expected error verifying stateless token with VerifyToken")
+	}
+	if _, err := statelessMgr.GetToken(newRequest(tk)); err == nil {
+		t.Error("did not receive expected error verifying session token with stateless manager")
+	}
+}
@@ -1,5 +1,16 @@
 package sessions
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//ErrStateNotFound is returned by stores when there is
+//no session state associated with the token
+var ErrStateNotFound = errors.New("session state not found")
+
 //Store describes what a session store can do
 type Store interface {
 	//Save saves the sessionState to the store, associated with the token
@@ -9,3 +20,227 @@ type Store interface {
 	//Delete removes state associated with the token
 	Delete(token Token) error
 }
+
+//Pinger is implemented by stores that can report whether their
+//backing infrastructure is reachable
+type Pinger interface {
+	//Ping returns an error if the store is not reachable
+	Ping(ctx context.Context) error
+}
+
+//ContextStore is implemented by stores whose operations accept a
+//context, so that they can respect per-request deadlines and cancellation
+type ContextStore interface {
+	//SaveContext is like Save, but respects the context
+	SaveContext(ctx context.Context, token Token, sessionState interface{}) error
+	//GetContext is like Get, but respects the context
+	GetContext(ctx context.Context, token Token, sessionState interface{}) error
+	//DeleteContext is like Delete, but respects the context
+	DeleteContext(ctx context.Context, token Token) error
+}
+
+//Exister is implemented by stores that can cheaply check whether
+//there is session state associated with a token, without fetching
+//and decoding that state
+type Exister interface {
+	//Exists reports whether there is state associated with the token
+	Exists(token Token) (bool, error)
+}
+
+//Toucher is implemented by stores that can reset the expiry time of
+//session state without fetching it
+type Toucher interface {
+	//Touch resets the expiry time of the state associated with the token.
+	//If there is no state associated with the token, ErrStateNotFound is returned.
+	Touch(token Token) error
+}
+
+//GetToucher is implemented by stores that can fetch session state
+//and reset its expiry time in a single atomic operation
+type GetToucher interface {
+	//GetAndTouch is like Get, but sets the expiry time of the state to
+	//ttl from now in the same operation, so that the state can't expire
+	//between being fetched and touched. If ttl is zero, the store's
+	//session duration is used. If there is no state associated with
+	//the token, ErrStateNotFound is returned.
+	GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error
+}
+
+//Peeker is implemented by stores that can fetch session state
+//without resetting its expiry time
+type Peeker interface {
+	//Peek is like Get, but doesn't reset the expiry time of the state
+	Peek(token Token, sessionState interface{}) error
+}
+
+//TTLer is implemented by stores that can report how long they will
+//keep session state before it expires
+type TTLer interface {
+	//TTL returns the time remaining before the state associated with the
+	//token expires, or zero if it never expires. If there is no state
+	//associated with the token, ErrStateNotFound is returned.
+	TTL(token Token) (time.Duration, error)
+}
+
+//Scanner is implemented by stores that can enumerate the sessions they
+//hold, for maintenance tasks such as re-wrapping encryption keys
+type Scanner interface {
+	//Scan calls fn with a token for each session in the store, stopping
+	//if fn returns an error. The tokens aren't signed, so they may only
+	//be used to address state in the store. Sessions saved or deleted
+	//during the scan may or may not be included, and some stores may
+	//include a session more than once, so fn should be idempotent.
+	Scan(fn func(token Token) error) error
+}
+
+//IDToken returns a Token for the session ID, for services that address
+//session state in a Store on behalf of others, such as a remote session
+//service. The Token has no signature, and its String method returns the ID,
+//so it must never be returned to clients.
+func IDToken(sessionID string) Token {
+	return storeToken(sessionID)
+}
+
+//storeToken is a Token for a session ID found in a store. It
+//has no signature, and its String method returns the ID.
+type storeToken string
+
+func (t storeToken) String() string {
+	return string(t)
+}
+
+func (t storeToken) ID() ID {
+	return storeID(t)
+}
+
+//storeID is the ID of a storeToken
+type storeID string
+
+//Len returns the length of the ID string, as its encoding is unknown
+func (i storeID) Len() int {
+	return len(i)
+}
+
+func (i storeID) String() string {
+	return string(i)
+}
+
+//saveContext saves using the store's SaveContext method if it implements ContextStore
+func saveContext(ctx context.Context, store Store, token Token, sessionState interface{}) error {
+	if cs, ok := store.(ContextStore); ok {
+		return cs.SaveContext(ctx, token, sessionState)
+	}
+	return store.Save(token, sessionState)
+}
+
+//getContext gets using the store's GetContext method if it implements ContextStore
+func getContext(ctx context.Context, store Store, token Token, sessionState interface{}) error {
+	if cs, ok := store.(ContextStore); ok {
+		return cs.GetContext(ctx, token, sessionState)
+	}
+	return store.Get(token, sessionState)
+}
+
+//deleteContext deletes using the store's DeleteContext method if it implements ContextStore
+func deleteContext(ctx context.Context, store Store, token Token) error {
+	if cs, ok := store.(ContextStore); ok {
+		return cs.DeleteContext(ctx, token)
+	}
+	return store.Delete(token)
+}
+
+//ping pings the store if it implements Pinger
+func ping(ctx context.Context, store Store) error {
+	if p, ok := store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+//exists checks whether the store has state for the token, using the store's
+//Exists method if it implements Exister. Otherwise, the state is fetched
+//and discarded, which requires the store to accept a nil sessionState in
+//Get, as gob-based stores do.
+func exists(store Store, token Token) (bool, error) {
+	if e, ok := store.(Exister); ok {
+		return e.Exists(token)
+	}
+	err := store.Get(token, nil)
+	if err == ErrStateNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//The following helpers let stores that wrap other stores implement the
+//optional store interfaces, forwarding to the inner store when it
+//implements them, and otherwise behaving as callers would if the
+//interface weren't implemented.
+
+//peek peeks using the store's Peek method if it implements Peeker,
+//and otherwise returns ErrPeekNotSupported
+func peek(store Store, token Token, sessionState interface{}) error {
+	if p, ok := store.(Peeker); ok {
+		return p.Peek(token, sessionState)
+	}
+	return ErrPeekNotSupported
+}
+
+//touch resets the expiry time using the store's Touch method if it
+//implements Toucher. Otherwise, it checks that the state exists, which
+//resets its expiry time in stores whose Get does so.
+func touch(store Store, token Token) error {
+	if t, ok := store.(Toucher); ok {
+		return t.Touch(token)
+	}
+	found, err := exists(store, token)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrStateNotFound
+	}
+	return nil
+}
+
+//storeTTL returns the time remaining before the state expires using the
+//store's TTL method if it implements TTLer, and otherwise zero, which
+//callers treat as an unknown expiry time
+func storeTTL(store Store, token Token) (time.Duration, error) {
+	if t, ok := store.(TTLer); ok {
+		return t.TTL(token)
+	}
+	return 0, nil
+}
+
+//getAndTouch gets using the store's GetAndTouch method if it implements
+//GetToucher. Otherwise, it uses Get, which resets the expiry time to the
+//store's session duration, rather than ttl, in stores that reset it.
+func getAndTouch(store Store, token Token, sessionState interface{}, ttl time.Duration) error {
+	if gt, ok := store.(GetToucher); ok {
+		return gt.GetAndTouch(token, sessionState, ttl)
+	}
+	return store.Get(token, sessionState)
+}
+
+//scan scans using the store's Scan method if it implements
+//Scanner, and otherwise returns an error
+func scan(store Store, fn func(token Token) error) error {
+	if s, ok := store.(Scanner); ok {
+		return s.Scan(fn)
+	}
+	return fmt.Errorf("error scanning: %T does not implement Scanner", store)
+}
+
+//replace replaces using the store's Replace method if it implements
+//Replacer. Otherwise, it saves the state and then deletes the replaced
+//state, which isn't atomic.
+func replace(store Store, token Token, sessionState interface{}, replaced Token) error {
+	if r, ok := store.(Replacer); ok {
+		return r.Replace(token, sessionState, replaced)
+	}
+	if err := store.Save(token, sessionState); err != nil {
+		return err
+	}
+	return store.Delete(replaced)
+}
@@ -0,0 +1,99 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDecoratorsForwardOptionalInterfaces(t *testing.T) {
+	wrapper, err := NewLocalKeyWrapper("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("unexpected error constructing key wrapper: %v", err)
+	}
+	cases := []struct {
+		name     string
+		decorate func(inner Store) Store
+	}{
+		{"retry", func(inner Store) Store { return RetryStore(inner, DefaultRetryPolicy) }},
+		{"circuit", func(inner Store) Store {
+			return CircuitBreakerStore(inner, CircuitBreakerOptions{FailureThreshold: 5, Cooldown: time.Second, CacheSize: 10})
+		}},
+		{"metrics", func(inner Store) Store { return MetricsStore(inner, NewStoreStats()) }},
+		{"timeout", func(inner Store) Store { return TimeoutStore(inner, time.Second) }},
+		{"sharded", func(inner Store) Store { return NewShardedStore(inner) }},
+		{"replicated", func(inner Store) Store { return NewReplicatedStore(SyncReplication, inner) }},
+		{"encrypted", func(inner Store) Store { return NewEncryptedStore(inner, wrapper) }},
+		{"write-behind", func(inner Store) Store { return NewWriteBehindStore(inner, 10, BlockOnOverflow) }},
+		{"tiered", func(inner Store) Store { return NewTieredStore(NewMemoryStore(time.Minute), inner) }},
+	}
+
+	for _, c := range cases {
+		store := c.decorate(NewMemoryStore(time.Hour))
+		if _, ok := store.(interface {
+			Peeker
+			Toucher
+			TTLer
+			Exister
+			Scanner
+			GetToucher
+			Replacer
+		}); !ok {
+			t.Errorf("case %s: store does not implement all optional interfaces", c.name)
+			continue
+		}
+		token, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+		}
+		if err := store.Save(token, "test state"); err != nil {
+			t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+
+		var state string
+		if err := store.(Peeker).Peek(token, &state); err != nil || state != "test state" {
+			t.Errorf("case %s: incorrect peeked state: expected test state, <nil> but got %s, %v", c.name, state, err)
+		}
+		if found, err := store.(Exister).Exists(token); err != nil || !found {
+			t.Errorf("case %s: incorrect result: expected true, <nil> but got %t, %v", c.name, found, err)
+		}
+		if err := store.(Toucher).Touch(token); err != nil {
+			t.Errorf("case %s: unexpected error touching state: %v", c.name, err)
+		}
+		state = ""
+		if err := store.(GetToucher).GetAndTouch(token, &state, time.Hour); err != nil || state != "test state" {
+			t.Errorf("case %s: incorrect state: expected test state, <nil> but got %s, %v", c.name, state, err)
+		}
+		if closer, ok := store.(ContextCloser); ok {
+			//flush queued writes, so the inner store has them
+			if err := closer.CloseContext(context.Background()); err != nil {
+				t.Errorf("case %s: unexpected error closing store: %v", c.name, err)
+			}
+		}
+		if ttl, err := store.(TTLer).TTL(token); err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+			t.Errorf("case %s: incorrect TTL: expected about 1h, <nil> but got %v, %v", c.name, ttl, err)
+		}
+		var ids []string
+		if err := store.(Scanner).Scan(func(tk Token) error {
+			ids = append(ids, tk.ID().String())
+			return nil
+		}); err != nil || len(ids) != 1 || ids[0] != token.ID().String() {
+			t.Errorf("case %s: incorrect scanned IDs: %v, %v", c.name, ids, err)
+		}
+
+		replacement, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("case %s: unexpected error generating token: %v", c.name, err)
+		}
+		if err := store.(Replacer).Replace(replacement, "new state", token); err != nil {
+			t.Errorf("case %s: unexpected error replacing state: %v", c.name, err)
+		}
+		if err := store.Get(token, &state); err != ErrStateNotFound {
+			t.Errorf("case %s: incorrect error getting replaced state: expected %v but got %v", c.name, ErrStateNotFound, err)
+		}
+		if err := store.Get(replacement, &state); err != nil || state != "new state" {
+			t.Errorf("case %s: incorrect state: expected new state, <nil> but got %s, %v", c.name, state, err)
+		}
+	}
+}
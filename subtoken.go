@@ -0,0 +1,221 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//subTokenLabel is mixed into sub-token signatures, so that they
+//can never be confused with the signatures of session tokens
+const subTokenLabel = "sessions sub-token"
+
+//ErrSubTokenExpired is returned when verifying a sub-token
+//whose time-to-live has elapsed
+var ErrSubTokenExpired = errors.New("sub-token has expired")
+
+//ErrParentSessionEnded is returned when verifying a sub-token
+//whose parent session has ended
+var ErrParentSessionEnded = errors.New("sub-token's parent session has ended")
+
+//ErrInsufficientScope is returned when verifying a sub-token
+//that doesn't have all of the required scopes
+var ErrInsufficientScope = errors.New("sub-token has insufficient scope")
+
+//SubToken describes a restricted token minted from a session, which
+//can be passed to downstream services in place of the session token.
+//Sub-tokens carry a narrowed set of scopes, expire independently of their
+//parent session, and stop working as soon as the parent session ends.
+type SubToken struct {
+	//ParentID is the string version of the parent session's ID
+	ParentID string `json:"pid"`
+	//UserID is the ID of the parent session's user, if known
+	UserID string `json:"uid,omitempty"`
+	//ParentCreated is when the parent session was begun, if known,
+	//which is compared to the user's logout epoch
+	ParentCreated time.Time `json:"pct,omitempty"`
+	//Scopes are the scopes granted to the sub-token
+	Scopes []string `json:"scp,omitempty"`
+	//Expires is when the sub-token expires
+	Expires time.Time `json:"exp"`
+}
+
+//HasScope reports whether the sub-token was granted scope
+func (st *SubToken) HasScope(scope string) bool {
+	for _, s := range st.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+//NewSubToken mints a sub-token from the parent session token, granting
+//only the provided scopes, and expiring after ttl. The returned string
+//is signed using the same key as parent, and can be verified by any
+//SubTokenVerifier that has the manager's signing keys and Store. The
+//parent session is resumed, so the manager's policies apply, and
+//pre-sessions that haven't been upgraded return ErrSessionPending.
+func (m *manager) NewSubToken(parent Token, ttl time.Duration, scopes ...string) (string, error) {
+	_, key, err := m.keys.verify(parent.String(), m.tokenOpts)
+	if err != nil {
+		return "", err
+	}
+	env, err := m.resumeEnvelope(nil, parent, nil, false)
+	if err != nil {
+		return "", getStateError(err)
+	}
+	st := &SubToken{
+		ParentID: parent.ID().String(),
+		Scopes:   scopes,
+		Expires:  time.Now().Add(ttl),
+	}
+	if env != nil {
+		st.UserID, st.ParentCreated = env.UserID, env.Created
+	}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return "", fmt.Errorf("error encoding sub-token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signSubToken(key, payload)), nil
+}
+
+//SubTokenVerifier verifies sub-tokens minted by a Manager's NewSubToken
+//method. Downstream services construct one with the same signing keys,
+//Store, and TokenOptions as the Manager, so that they can verify
+//sub-tokens without having access to the full session.
+type SubTokenVerifier struct {
+	//Epochs, if set, is checked by Verify to reject sub-tokens whose
+	//parent sessions were revoked by RevokeUser. Callers may set this
+	//to the Manager's EpochStore after construction.
+	Epochs EpochStore
+	//Revocations, if set, is checked by Verify to reject sub-tokens
+	//whose parent sessions were revoked by Revoke. Callers may set this
+	//to the Manager's RevocationList after construction.
+	Revocations RevocationList
+	keys        keyRing
+	store       Store
+	tokenOpts   []TokenOption
+}
+
+//NewSubTokenVerifier constructs a new SubTokenVerifier. The store is
+//used to check that the sub-token's parent session hasn't ended. If it
+//implements Exister, that check doesn't fetch the parent's session state.
+func NewSubTokenVerifier(signingKeys []string, store Store, opts ...TokenOption) *SubTokenVerifier {
+	return NewSubTokenVerifierWithKeys(newKeyRing(signingKeys), store, opts...)
+}
+
+//NewSubTokenVerifierWithKeys is like NewSubTokenVerifier, but accepts
+//keys that declare their own algorithms, matching those passed to the
+//Manager using WithSigningKeys. Sub-tokens are signed with secrets
+//derived from the keys that can sign, so keys that can only verify
+//tokens, such as ed25519 public keys, don't verify any sub-tokens.
+func NewSubTokenVerifierWithKeys(signingKeys []SigningKey, store Store, opts ...TokenOption) *SubTokenVerifier {
+	return &SubTokenVerifier{
+		keys:      append(keyRing(nil), signingKeys...),
+		store:     store,
+		tokenOpts: opts,
+	}
+}
+
+//Verify verifies the sub-token string, ensuring that it hasn't expired,
+//that its parent session hasn't ended or been revoked, and that it was
+//granted all of the requiredScopes. The verified SubToken is returned.
+//ErrSessionRevoked is returned if the parent session was revoked.
+func (v *SubTokenVerifier) Verify(subtoken string, requiredScopes ...string) (*SubToken, error) {
+	dot := strings.IndexByte(subtoken, '.')
+	if dot < 0 {
+		return nil, fmt.Errorf("invalid sub-token format")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(subtoken[:dot])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding sub-token: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(subtoken[dot+1:])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding sub-token signature: %v", err)
+	}
+	var key []byte
+	for _, k := range v.keys.secrets() {
+		if hmac.Equal(sig, signSubToken(k, payload)) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("sub-token has been modified since signed")
+	}
+
+	st := &SubToken{}
+	if err := json.Unmarshal(payload, st); err != nil {
+		return nil, fmt.Errorf("error decoding sub-token: %v", err)
+	}
+	if time.Now().After(st.Expires) {
+		return nil, ErrSubTokenExpired
+	}
+	for _, scope := range requiredScopes {
+		if !st.HasScope(scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+
+	if err := v.checkRevoked(st); err != nil {
+		return nil, err
+	}
+
+	//reconstruct the parent token and ensure its session still exists
+	to := newTokenOptions(v.tokenOpts)
+	idBuf, err := to.idEnc().DecodeString(st.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding parent session ID: %v", err)
+	}
+	parent := &token{buf: idBuf, enc: to.encoding, idEnc: to.idEncoding}
+	parent.sign(key)
+	found, err := exists(v.store, parent)
+	if err != nil {
+		return nil, fmt.Errorf("error checking parent session: %v", err)
+	}
+	if !found {
+		return nil, ErrParentSessionEnded
+	}
+	return st, nil
+}
+
+//checkRevoked returns ErrSessionRevoked if the sub-token's parent
+//session is on the revocation list, or was begun before its user's
+//logout epoch
+func (v *SubTokenVerifier) checkRevoked(st *SubToken) error {
+	if v.Revocations != nil {
+		revoked, err := v.Revocations.IsRevoked(st.ParentID)
+		if err != nil {
+			return fmt.Errorf("error checking revocation list: %v", err)
+		}
+		if revoked {
+			return ErrSessionRevoked
+		}
+	}
+	if v.Epochs != nil && len(st.UserID) > 0 {
+		epoch, err := v.Epochs.GetEpoch(st.UserID)
+		if err != nil {
+			return fmt.Errorf("error getting logout epoch: %v", err)
+		}
+		if !epoch.IsZero() && !st.ParentCreated.After(epoch) {
+			return ErrSessionRevoked
+		}
+	}
+	return nil
+}
+
+//signSubToken returns the HMAC signature of the sub-token payload
+func signSubToken(signingKey []byte, payload []byte) []byte {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte(subTokenLabel))
+	h.Write(payload)
+	return h.Sum(nil)
+}
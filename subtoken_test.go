@@ -0,0 +1,123 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubTokens(t *testing.T) {
+	signingKeys := []string{"key1", "key2"}
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, signingKeys, store)
+	parent, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	subtoken, err := mgr.NewSubToken(parent, time.Minute, "orders:read", "profile:read")
+	if err != nil {
+		t.Fatalf("unexpected error minting sub-token: %v", err)
+	}
+	expired, err := mgr.NewSubToken(parent, -time.Second, "orders:read")
+	if err != nil {
+		t.Fatalf("unexpected error minting sub-token: %v", err)
+	}
+	verifier := NewSubTokenVerifier(signingKeys, store)
+
+	cases := []struct {
+		name           string
+		subtoken       string
+		requiredScopes []string
+		expectedError  error
+		expectError    bool
+	}{
+		{"valid sub-token", subtoken, nil, nil, false},
+		{"valid sub-token with required scopes", subtoken, []string{"orders:read", "profile:read"}, nil, false},
+		{"insufficient scope", subtoken, []string{"orders:write"}, ErrInsufficientScope, true},
+		{"expired sub-token", expired, nil, ErrSubTokenExpired, true},
+		{"session token", parent.String(), nil, nil, true},
+		{"modified sub-token", strings.Replace(subtoken, ".", "A.", 1), nil, nil, true},
+	}
+
+	for _, c := range cases {
+		st, err := verifier.Verify(c.subtoken, c.requiredScopes...)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("case %s: did not receive expected error", c.name)
+			} else if c.expectedError != nil && err != c.expectedError {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if st.ParentID != parent.ID().String() {
+			t.Errorf("case %s: incorrect parent ID: expected %s but got %s", c.name, parent.ID().String(), st.ParentID)
+		}
+	}
+
+	//sub-tokens should stop working once the parent session ends
+	store.Delete(parent)
+	if _, err := verifier.Verify(subtoken); err != ErrParentSessionEnded {
+		t.Errorf("incorrect error: expected %v but got %v", ErrParentSessionEnded, err)
+	}
+
+	//and store errors should be returned
+	store.triggerError = true
+	if _, err := verifier.Verify(subtoken); err == nil || err == ErrParentSessionEnded {
+		t.Errorf("expected error from store but got %v", err)
+	}
+}
+
+func TestSubTokenRevocation(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	epochs := NewMemoryEpochStore()
+	revocations := NewMemoryRevocationList()
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store,
+		WithEpochStore(epochs), WithRevocationList(revocations), WithPreSessions(time.Minute))
+	verifier := NewSubTokenVerifier([]string{string(testSigningKey)}, store)
+	verifier.Epochs = epochs
+	verifier.Revocations = revocations
+
+	//pre-sessions can't mint sub-tokens
+	preToken, err := mgr.BeginPreSession(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.com", nil), &userState{"user1"})
+	if err != nil {
+		t.Fatalf("unexpected error beginning pre-session: %v", err)
+	}
+	if _, err := mgr.NewSubToken(preToken, time.Minute, "orders:read"); err != ErrSessionPending {
+		t.Errorf("incorrect error minting sub-token from pre-session: expected %v but got %v", ErrSessionPending, err)
+	}
+
+	subtokens := make([]string, 2)
+	for i := range subtokens {
+		parent, err := mgr.BeginSession(httptest.NewRecorder(), &userState{"user1"})
+		if err != nil {
+			t.Fatalf("unexpected error beginning session: %v", err)
+		}
+		if subtokens[i], err = mgr.NewSubToken(parent, time.Minute, "orders:read"); err != nil {
+			t.Fatalf("unexpected error minting sub-token: %v", err)
+		}
+		if _, err := verifier.Verify(subtokens[i]); err != nil {
+			t.Errorf("unexpected error verifying sub-token: %v", err)
+		}
+		if i == 0 {
+			if err := mgr.Revoke(parent); err != nil {
+				t.Fatalf("unexpected error revoking session: %v", err)
+			}
+		}
+	}
+
+	//sub-tokens should stop working once the parent is revoked
+	if _, err := verifier.Verify(subtokens[0]); err != ErrSessionRevoked {
+		t.Errorf("incorrect error for revoked parent: expected %v but got %v", ErrSessionRevoked, err)
+	}
+	if err := mgr.RevokeUser("user1"); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	if _, err := verifier.Verify(subtokens[1]); err != ErrSessionRevoked {
+		t.Errorf("incorrect error for revoked user: expected %v but got %v", ErrSessionRevoked, err)
+	}
+}
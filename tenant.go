@@ -0,0 +1,135 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+//ErrUnknownTenant is returned by TenantManager when the
+//tenant resolved from the request has not been added
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+//TenantResolver resolves the ID of the tenant for a request
+type TenantResolver func(r *http.Request) (string, error)
+
+//HostTenantResolver is a TenantResolver that uses the request's
+//host name (without any port) as the tenant ID.
+func HostTenantResolver(r *http.Request) (string, error) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if len(host) == 0 {
+		return "", fmt.Errorf("request has no host")
+	}
+	return host, nil
+}
+
+//HeaderTenantResolver returns a TenantResolver that uses the value
+//of the named request header as the tenant ID.
+func HeaderTenantResolver(name string) TenantResolver {
+	return func(r *http.Request) (string, error) {
+		tenantID := r.Header.Get(name)
+		if len(tenantID) == 0 {
+			return "", fmt.Errorf("request has no %s header", name)
+		}
+		return tenantID, nil
+	}
+}
+
+//TenantConfig holds the session settings for a single tenant.
+//To isolate each tenant's session state, give each tenant its own
+//Store. For example, tenants may share a redis pool, but each should
+//get its own RedisStore with a distinct KeyPrefix and the
+//SessionDuration appropriate for that tenant.
+type TenantConfig struct {
+	//IDLength is the byte length for new session IDs (see DefaultIDLength)
+	IDLength int
+	//SigningKeys are the keys used to sign this tenant's session tokens
+	SigningKeys []string
+	//Store is the Store used for this tenant's session state
+	Store Store
+	//Options are any additional options for this tenant's Manager
+	Options []ManagerOption
+}
+
+//TenantManager manages sessions for multiple tenants, selecting the
+//signing keys, Store, and other settings for each request based on
+//the tenant resolved from the request. Sessions begun for one tenant
+//can't be used with another, since each tenant signs tokens with
+//its own keys.
+type TenantManager struct {
+	resolve  TenantResolver
+	mx       sync.RWMutex
+	managers map[string]Manager
+}
+
+//NewTenantManager constructs a new TenantManager that uses
+//resolve to determine the tenant for each request.
+func NewTenantManager(resolve TenantResolver) *TenantManager {
+	return &TenantManager{
+		resolve:  resolve,
+		managers: make(map[string]Manager),
+	}
+}
+
+//AddTenant adds or replaces the configuration for the tenant with tenantID.
+func (tm *TenantManager) AddTenant(tenantID string, config TenantConfig) {
+	mgr := NewManager(config.IDLength, config.SigningKeys, config.Store, config.Options...)
+	tm.mx.Lock()
+	defer tm.mx.Unlock()
+	tm.managers[tenantID] = mgr
+}
+
+//RemoveTenant removes the tenant with tenantID.
+func (tm *TenantManager) RemoveTenant(tenantID string) {
+	tm.mx.Lock()
+	defer tm.mx.Unlock()
+	delete(tm.managers, tenantID)
+}
+
+//Manager returns the Manager for the tenant resolved from the request.
+//ErrUnknownTenant is returned if that tenant has not been added.
+func (tm *TenantManager) Manager(r *http.Request) (Manager, error) {
+	tenantID, err := tm.resolve(r)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving tenant: %v", err)
+	}
+	tm.mx.RLock()
+	defer tm.mx.RUnlock()
+	mgr, found := tm.managers[tenantID]
+	if !found {
+		return nil, ErrUnknownTenant
+	}
+	return mgr, nil
+}
+
+//BeginSession begins a new session for the tenant resolved from the request.
+func (tm *TenantManager) BeginSession(w http.ResponseWriter, r *http.Request, sessionState interface{}) (Token, error) {
+	mgr, err := tm.Manager(r)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.BeginRequestSession(w, r, sessionState)
+}
+
+//GetState gets the session state for the tenant resolved from the request.
+func (tm *TenantManager) GetState(r *http.Request, sessionState interface{}) (Token, error) {
+	mgr, err := tm.Manager(r)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.GetState(r, sessionState)
+}
+
+//EndSession ends the session for the tenant resolved from the request.
+func (tm *TenantManager) EndSession(r *http.Request) error {
+	mgr, err := tm.Manager(r)
+	if err != nil {
+		return err
+	}
+	return mgr.EndSession(r)
+}
@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://tenant1.example.com:8080/", nil)
+	req.Header.Set("X-Tenant", "tenant2")
+
+	tenantID, err := HostTenantResolver(req)
+	if err != nil {
+		t.Errorf("unexpected error resolving tenant from host: %v", err)
+	}
+	if tenantID != "tenant1.example.com" {
+		t.Errorf("incorrect tenant from host: expected %s but got %s", "tenant1.example.com", tenantID)
+	}
+
+	tenantID, err = HeaderTenantResolver("X-Tenant")(req)
+	if err != nil {
+		t.Errorf("unexpected error resolving tenant from header: %v", err)
+	}
+	if tenantID != "tenant2" {
+		t.Errorf("incorrect tenant from header: expected %s but got %s", "tenant2", tenantID)
+	}
+
+	req.Header.Del("X-Tenant")
+	if _, err := HeaderTenantResolver("X-Tenant")(req); err == nil {
+		t.Error("did not receive expected error resolving tenant without header")
+	}
+	req.Host = ""
+	if _, err := HostTenantResolver(req); err == nil {
+		t.Error("did not receive expected error resolving tenant without host")
+	}
+}
+
+func TestTenantManager(t *testing.T) {
+	store1 := newMockStore(false)
+	store2 := newMockStore(false)
+	tm := NewTenantManager(HeaderTenantResolver("X-Tenant"))
+	tm.AddTenant("tenant1", TenantConfig{DefaultIDLength, []string{"tenant1 key"}, store1, nil})
+	tm.AddTenant("tenant2", TenantConfig{DefaultIDLength, []string{"tenant2 key"}, store2, nil})
+
+	//begin a session for tenant1
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("X-Tenant", "tenant1")
+	respRec := httptest.NewRecorder()
+	token, err := tm.BeginSession(respRec, req, "tenant1 state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if len(store1.entries) != 1 || len(store2.entries) != 0 {
+		t.Errorf("session state saved to incorrect store")
+	}
+
+	//get the state for tenant1
+	req.Header.Set(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	var state string
+	tk, err := tm.GetState(req, &state)
+	if err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if tk.String() != token.String() {
+		t.Errorf("incorrect token: expected %s but got %s", token.String(), tk.String())
+	}
+	if state != "tenant1 state" {
+		t.Errorf("incorrect state: expected %s but got %s", "tenant1 state", state)
+	}
+
+	//the token should not be valid for tenant2
+	req.Header.Set("X-Tenant", "tenant2")
+	if _, err := tm.GetState(req, &state); err == nil {
+		t.Error("did not receive expected error using tenant1 token with tenant2")
+	}
+	if err := tm.EndSession(req); err == nil {
+		t.Error("did not receive expected error ending tenant1 session with tenant2")
+	}
+
+	//end the session for tenant1
+	req.Header.Set("X-Tenant", "tenant1")
+	if err := tm.EndSession(req); err != nil {
+		t.Errorf("unexpected error ending session: %v", err)
+	}
+	if len(store1.entries) != 0 {
+		t.Error("session state not deleted from store")
+	}
+
+	//unknown and unresolvable tenants
+	tm.RemoveTenant("tenant2")
+	req.Header.Set("X-Tenant", "tenant2")
+	if _, err := tm.Manager(req); err != ErrUnknownTenant {
+		t.Errorf("incorrect error for unknown tenant: expected %v but got %v", ErrUnknownTenant, err)
+	}
+	if _, err := tm.BeginSession(respRec, req, "state"); err != ErrUnknownTenant {
+		t.Errorf("incorrect error for unknown tenant: expected %v but got %v", ErrUnknownTenant, err)
+	}
+	req.Header.Del("X-Tenant")
+	if _, err := tm.Manager(req); err == nil {
+		t.Error("did not receive expected error for request without tenant")
+	}
+}
@@ -0,0 +1,367 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//TieredReadPolicy controls whether TieredStore adds state
+//fetched from the back store to the front store
+type TieredReadPolicy int
+
+const (
+	//ReadThrough adds state fetched from the back store to the front store
+	ReadThrough TieredReadPolicy = iota
+	//ReadAround doesn't add state fetched from the back store to the front
+	//store, so the front store only holds state saved by this process
+	ReadAround
+)
+
+//TieredWritePolicy controls how TieredStore writes
+//session state to the front and back stores
+type TieredWritePolicy int
+
+const (
+	//WriteThrough saves the state to the back store, and then to the
+	//front store, returning only once both writes are complete
+	WriteThrough TieredWritePolicy = iota
+	//WriteAround saves the state to the back store, and removes it from
+	//the front store, so that it is fetched from the back store when next
+	//read, which suits sessions that are rarely read by the process that
+	//saved them
+	WriteAround
+	//WriteBehind saves the state to the front store, and queues the write
+	//to the back store using a WriteBehindStore, so saves don't wait for
+	//the back store. Other processes don't see the state until it's
+	//flushed, and the last few writes are lost if the process crashes.
+	WriteBehind
+)
+
+//TieredPolicy controls how TieredStore reads and writes session state,
+//as the tradeoffs between consistency and latency differ by application.
+//The zero value reads and writes through to the back store.
+type TieredPolicy struct {
+	//Read controls whether state fetched from the
+	//back store is added to the front store
+	Read TieredReadPolicy
+	//Write controls how state is written to the front and back stores
+	Write TieredWritePolicy
+	//WriteBehindQueueSize is the number of writes to the back store that
+	//may be queued when Write is WriteBehind. If zero, the
+	//DefaultWriteBehindQueueSize is used.
+	WriteBehindQueueSize int
+	//WriteBehindOverflow controls what happens to writes while the
+	//queue is full when Write is WriteBehind
+	WriteBehindOverflow OverflowPolicy
+	//LocalTTL, if non-zero, is how long state is served from the front
+	//store after it was added, after which it is fetched from the back store
+	//again, which bounds how stale it may be. This is independent of the
+	//front store's own session duration.
+	LocalTTL time.Duration
+	//NegativeTTL, if non-zero, is how long the front store remembers that
+	//the back store has no state for a session, so that repeated gets of
+	//ended or expired sessions don't reach the back store. Saves of the
+	//session in this process, and in others when using UseBus, clear it.
+	NegativeTTL time.Duration
+}
+
+//tieredEntry is the state kept in the front store when the
+//policy needs to know how long ago it was added
+type tieredEntry struct {
+	Added   time.Time
+	Missing bool
+	State   []byte
+}
+
+//TieredStore is a Store that keeps session state in a fast, local front
+//store, such as a MemoryStore, in front of a slower, shared back store,
+//such as a RedisStore. Gets are served from the front store when
+//possible, and states fetched from the back store are added to the front
+//store. Saves and deletes are written through to both stores.
+//
+//Since each process has its own front store, a state saved by another
+//process may not be seen until the entry in this process's front store
+//expires or is evicted, so give the front store a short session duration,
+//or use a TieredStore only for sessions that rarely change. Alternatively,
+//call UseBus so that saves and deletes in one process invalidate the
+//state in every other process's front store.
+//
+//Use NewTieredStoreWithPolicy to choose other read and write policies,
+//such as writing behind to the back store, or bounding how long state
+//is served from the front store.
+type TieredStore struct {
+	front  Store
+	back   Store
+	policy TieredPolicy
+	origin string
+	mx     sync.RWMutex
+	bus    Bus
+}
+
+//NewTieredStore constructs a new TieredStore that reads
+//and writes through to the back store
+func NewTieredStore(front Store, back Store) *TieredStore {
+	return NewTieredStoreWithPolicy(front, back, TieredPolicy{})
+}
+
+//NewTieredStoreWithPolicy constructs a new TieredStore that reads and
+//writes session state according to policy. If policy.Write is WriteBehind,
+//call Close or CloseContext to flush queued writes before the process exits.
+//If policy.LocalTTL or policy.NegativeTTL is non-zero, the front store
+//holds the state encoded using the DefaultCodec, along with when it was
+//added, so the front store should only be used by this TieredStore.
+func NewTieredStoreWithPolicy(front Store, back Store, policy TieredPolicy) *TieredStore {
+	ts := &TieredStore{
+		front:  front,
+		back:   back,
+		policy: policy,
+	}
+	if policy.Write == WriteBehind {
+		queueSize := policy.WriteBehindQueueSize
+		if queueSize <= 0 {
+			queueSize = DefaultWriteBehindQueueSize
+		}
+		//other processes must not refetch the state from the back
+		//store until it has been written, so publish once it has
+		ts.back = newWriteBehindStore(back, queueSize, policy.WriteBehindOverflow, func(token Token) {
+			ts.publish(EventUpdated, token)
+		})
+	}
+	return ts
+}
+
+//UseBus publishes a message to the bus whenever session state is saved
+//or deleted, and deletes the state from the front store whenever another
+//process publishes such a message, so that other processes never serve
+//state that has changed. When the write policy is WriteBehind, the message
+//about a save is published once the queued write reaches the back store,
+//so that other processes don't refetch the previous state. It returns a
+//function that stops the subscription.
+func (ts *TieredStore) UseBus(bus Bus) (func(), error) {
+	origin := make([]byte, 8)
+	if _, err := rand.Read(origin); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %v", err)
+	}
+	ts.mx.Lock()
+	defer ts.mx.Unlock()
+	ts.origin = hex.EncodeToString(origin)
+	stop, err := bus.Subscribe(ts.invalidate)
+	if err != nil {
+		return nil, err
+	}
+	ts.bus = bus
+	return stop, nil
+}
+
+//invalidate deletes the state in a bus message from the front store,
+//unless the message was published by this store
+func (ts *TieredStore) invalidate(msg BusMessage) {
+	ts.mx.RLock()
+	origin := ts.origin
+	ts.mx.RUnlock()
+	if msg.Origin != origin {
+		ts.front.Delete(IDToken(msg.SessionID))
+	}
+}
+
+//publish publishes a message about the session to the bus, if any
+func (ts *TieredStore) publish(eventType EventType, token Token) {
+	ts.mx.RLock()
+	bus, origin := ts.bus, ts.origin
+	ts.mx.RUnlock()
+	if bus != nil {
+		bus.Publish(BusMessage{Type: eventType, SessionID: token.ID().String(), Origin: origin})
+	}
+}
+
+//Save saves the session state to the back store, and then to the front
+//store, or as described by the store's TieredWritePolicy
+func (ts *TieredStore) Save(token Token, sessionState interface{}) error {
+	if err := ts.back.Save(token, sessionState); err != nil {
+		return err
+	}
+	ts.saved(token, sessionState)
+	if ts.policy.Write != WriteBehind {
+		ts.publish(EventUpdated, token)
+	}
+	return nil
+}
+
+//Get gets the session state from the front store, or from the back
+//store if the front store doesn't have it, adding it to the front store
+//unless the store's TieredReadPolicy is ReadAround.
+func (ts *TieredStore) Get(token Token, sessionState interface{}) error {
+	if found, err := ts.getFront(token, sessionState); found {
+		return err
+	}
+	return ts.fetched(token, sessionState, ts.back.Get(token, sessionState))
+}
+
+//Delete deletes the session state from the back store and the front store
+func (ts *TieredStore) Delete(token Token) error {
+	err := ts.back.Delete(token)
+	if ferr := ts.front.Delete(token); err == nil {
+		err = ferr
+	}
+	ts.publish(EventEnded, token)
+	return err
+}
+
+//Touch resets the expiry time of the session state in the back store,
+//if it implements Toucher, and in the front store, if it implements Toucher.
+func (ts *TieredStore) Touch(token Token) error {
+	if t, ok := ts.back.(Toucher); ok {
+		if err := t.Touch(token); err != nil {
+			return err
+		}
+	}
+	if t, ok := ts.front.(Toucher); ok {
+		t.Touch(token)
+	}
+	return nil
+}
+
+//Peek peeks at the session state in the front store, or in the back store
+//if the front store doesn't have it, without adding it to the front store
+func (ts *TieredStore) Peek(token Token, sessionState interface{}) error {
+	if found, err := ts.getFront(token, sessionState); found {
+		return err
+	}
+	return peek(ts.back, token, sessionState)
+}
+
+//GetAndTouch gets and touches the session state in the back store, adding
+//it to the front store unless the store's TieredReadPolicy is ReadAround
+func (ts *TieredStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return ts.fetched(token, sessionState, getAndTouch(ts.back, token, sessionState, ttl))
+}
+
+//TTL gets the TTL of the session state in the back store
+func (ts *TieredStore) TTL(token Token) (time.Duration, error) {
+	return storeTTL(ts.back, token)
+}
+
+//Exists checks whether the front store has the session
+//state, or the back store if the front store doesn't
+func (ts *TieredStore) Exists(token Token) (bool, error) {
+	if found, err := ts.getFront(token, nil); found {
+		return err == nil, nil
+	}
+	return exists(ts.back, token)
+}
+
+//Scan scans the back store
+func (ts *TieredStore) Scan(fn func(token Token) error) error {
+	return scan(ts.back, fn)
+}
+
+//Replace replaces the session state in the back store, and then
+//saves the new state to the front store as Save does, and deletes
+//the replaced state from the front store
+func (ts *TieredStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	if err := replace(ts.back, token, sessionState, replaced); err != nil {
+		return err
+	}
+	ts.front.Delete(replaced)
+	ts.publish(EventEnded, replaced)
+	ts.saved(token, sessionState)
+	ts.publish(EventUpdated, token)
+	return nil
+}
+
+//Close flushes any writes queued for the back store, and closes
+//the front and back stores if they implement ContextCloser
+func (ts *TieredStore) Close() error {
+	return ts.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done,
+//returning its error, while the queued writes continue to be flushed
+func (ts *TieredStore) CloseContext(ctx context.Context) error {
+	var firstErr error
+	for _, s := range []Store{ts.back, ts.front} {
+		if closer, ok := s.(ContextCloser); ok {
+			if err := closer.CloseContext(ctx); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+//saved updates the front store after the session state was saved
+//to the back store, according to the store's TieredWritePolicy
+func (ts *TieredStore) saved(token Token, sessionState interface{}) {
+	if ts.policy.Write == WriteAround {
+		ts.front.Delete(token)
+	} else if err := ts.saveFront(token, sessionState); err != nil {
+		//don't leave a stale state in the front store
+		ts.front.Delete(token)
+	}
+}
+
+//fetched updates the front store after the session state was fetched
+//from the back store with the result err, and returns err
+func (ts *TieredStore) fetched(token Token, sessionState interface{}, err error) error {
+	if err == ErrStateNotFound && ts.policy.NegativeTTL > 0 {
+		ts.front.Save(token, &tieredEntry{Added: time.Now(), Missing: true})
+	}
+	if err != nil {
+		return err
+	}
+	if ts.policy.Read == ReadThrough && sessionState != nil {
+		ts.saveFront(token, sessionState)
+	}
+	return nil
+}
+
+//wrapsFront reports whether the front store holds tieredEntry
+//values, rather than the session state itself
+func (ts *TieredStore) wrapsFront() bool {
+	return ts.policy.LocalTTL > 0 || ts.policy.NegativeTTL > 0
+}
+
+//saveFront saves the session state to the front store
+func (ts *TieredStore) saveFront(token Token, sessionState interface{}) error {
+	if !ts.wrapsFront() {
+		return ts.front.Save(token, sessionState)
+	}
+	buf, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	return ts.front.Save(token, &tieredEntry{Added: time.Now(), State: buf})
+}
+
+//getFront gets the session state from the front store, reporting whether
+//it was found. If the front store remembers that the back store has no
+//state for the session, it returns true and ErrStateNotFound.
+func (ts *TieredStore) getFront(token Token, sessionState interface{}) (bool, error) {
+	if !ts.wrapsFront() {
+		return ts.front.Get(token, sessionState) == nil, nil
+	}
+	entry := tieredEntry{}
+	if err := ts.front.Get(token, &entry); err != nil {
+		return false, nil
+	}
+	ttl := ts.policy.LocalTTL
+	if entry.Missing {
+		ttl = ts.policy.NegativeTTL
+	}
+	if ttl > 0 && time.Since(entry.Added) >= ttl {
+		return false, nil
+	}
+	if entry.Missing {
+		return true, ErrStateNotFound
+	}
+	if sessionState != nil {
+		if err := DefaultCodec.Decode(entry.State, sessionState); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
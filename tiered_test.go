@@ -0,0 +1,162 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTieredStore(t *testing.T) {
+	front := NewMemoryStore(time.Hour)
+	back := NewMemoryStore(time.Hour)
+	store := NewTieredStore(front, back)
+	tk, _ := NewToken(testSigningKey)
+
+	if err := store.Save(tk, "test state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	for name, s := range map[string]Store{"front": front, "back": back} {
+		var state string
+		if err := s.Get(tk, &state); err != nil || state != "test state" {
+			t.Errorf("incorrect %s state: expected test state, <nil> but got %s, %v", name, state, err)
+		}
+	}
+
+	//gets should fall back to the back store, and fill the front store
+	front.Delete(tk)
+	var state string
+	if err := store.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+	if exists, _ := front.Exists(tk); !exists {
+		t.Error("front store was not filled from back store")
+	}
+
+	//gets should be served from the front store when it has the state
+	back.Delete(tk)
+	if err := store.Get(tk, &state); err != nil {
+		t.Errorf("unexpected error getting state from front store: %v", err)
+	}
+
+	if err := store.Touch(tk); err != ErrStateNotFound {
+		t.Errorf("incorrect error touching state: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Delete(tk); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Get(tk, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
+
+func TestTieredStoreErrors(t *testing.T) {
+	tk, _ := NewToken(testSigningKey)
+
+	//back store errors should be returned
+	store := NewTieredStore(NewMemoryStore(time.Hour), newMockStore(true))
+	if err := store.Save(tk, "test state"); err == nil {
+		t.Error("expected error saving to failing back store")
+	}
+	if err := store.Delete(tk); err == nil {
+		t.Error("expected error deleting from failing back store")
+	}
+
+	//front store errors should fall back to the back store
+	back := NewMemoryStore(time.Hour)
+	store = NewTieredStore(newMockStore(true), back)
+	if err := store.Save(tk, "test state"); err != nil {
+		t.Errorf("unexpected error saving with failing front store: %v", err)
+	}
+	var state string
+	if err := store.Get(tk, &state); err != nil || state != "test state" {
+		t.Errorf("incorrect state: expected test state, <nil> but got %s, %v", state, err)
+	}
+}
+
+func TestTieredStorePolicies(t *testing.T) {
+	cases := []struct {
+		name              string
+		policy            TieredPolicy
+		expectFrontOnSave bool
+		expectFrontOnGet  bool
+	}{
+		{"default", TieredPolicy{}, true, true},
+		{"write around", TieredPolicy{Write: WriteAround}, false, true},
+		{"read around", TieredPolicy{Read: ReadAround}, true, false},
+		{"write behind", TieredPolicy{Write: WriteBehind}, true, true},
+		{"local TTL", TieredPolicy{LocalTTL: time.Hour}, true, true},
+	}
+
+	for _, c := range cases {
+		front := NewMemoryStore(time.Hour)
+		back := NewMemoryStore(time.Hour)
+		store := NewTieredStoreWithPolicy(front, back, c.policy)
+		tk, _ := NewToken(testSigningKey)
+
+		if err := store.Save(tk, "test state"); err != nil {
+			t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+		if exists, _ := front.Exists(tk); exists != c.expectFrontOnSave {
+			t.Errorf("case %s: incorrect front store after save: expected %t but got %t", c.name, c.expectFrontOnSave, exists)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatalf("case %s: unexpected error closing store: %v", c.name, err)
+		}
+		var state string
+		if err := back.Get(tk, &state); err != nil || state != "test state" {
+			t.Errorf("case %s: incorrect back state: expected test state, <nil> but got %s, %v", c.name, state, err)
+		}
+
+		front.Delete(tk)
+		state = ""
+		if err := store.Get(tk, &state); err != nil || state != "test state" {
+			t.Errorf("case %s: incorrect state: expected test state, <nil> but got %s, %v", c.name, state, err)
+		}
+		if exists, _ := front.Exists(tk); exists != c.expectFrontOnGet {
+			t.Errorf("case %s: incorrect front store after get: expected %t but got %t", c.name, c.expectFrontOnGet, exists)
+		}
+	}
+}
+
+func TestTieredStoreTTLs(t *testing.T) {
+	front := NewMemoryStore(time.Hour)
+	back := NewMemoryStore(time.Hour)
+	store := NewTieredStoreWithPolicy(front, back, TieredPolicy{
+		LocalTTL:    50 * time.Millisecond,
+		NegativeTTL: 50 * time.Millisecond,
+	})
+	tk, _ := NewToken(testSigningKey)
+
+	//missing state should be remembered until the negative TTL elapses
+	var state string
+	if err := store.Get(tk, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	back.Save(tk, "back state")
+	if err := store.Get(tk, &state); err != ErrStateNotFound {
+		t.Errorf("incorrect error for remembered missing state: expected %v but got %v", ErrStateNotFound, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := store.Get(tk, &state); err != nil || state != "back state" {
+		t.Errorf("incorrect state after negative TTL: expected back state, <nil> but got %s, %v", state, err)
+	}
+
+	//state should be served from the front store until the local TTL elapses
+	back.Save(tk, "changed state")
+	if err := store.Get(tk, &state); err != nil || state != "back state" {
+		t.Errorf("incorrect state from front store: expected back state, <nil> but got %s, %v", state, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := store.Get(tk, &state); err != nil || state != "changed state" {
+		t.Errorf("incorrect state after local TTL: expected changed state, <nil> but got %s, %v", state, err)
+	}
+
+	//saves should replace remembered missing state
+	tk, _ = NewToken(testSigningKey)
+	store.Get(tk, &state)
+	if err := store.Save(tk, "saved state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Get(tk, &state); err != nil || state != "saved state" {
+		t.Errorf("incorrect state after save: expected saved state, <nil> but got %s, %v", state, err)
+	}
+}
@@ -0,0 +1,212 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+//TimeoutError is returned by a timeout store when an
+//operation doesn't complete within the timeout
+type TimeoutError struct {
+	//Op is the operation that timed out
+	Op StoreOp
+	//Duration is the time the operation was allowed
+	Duration time.Duration
+}
+
+//Error returns the error message
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("session store %s timed out after %v", e.Op, e.Duration)
+}
+
+//Timeout always returns true, so that callers checking for
+//timeouts the same way as net.Error will detect this error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+//timeoutStore is a Store that bounds the time taken by operations on an inner Store
+type timeoutStore struct {
+	inner   Store
+	timeout time.Duration
+}
+
+//TimeoutStore wraps inner with a Store that bounds each operation by
+//a context deadline of timeout, returning a *TimeoutError if the deadline
+//is exceeded. If inner implements ContextStore, the deadline is passed
+//to it, so it can abandon the operation. Otherwise, the operation keeps
+//running in the background after the timeout, but the caller no longer
+//waits for it.
+func TimeoutStore(inner Store, timeout time.Duration) Store {
+	return &timeoutStore{
+		inner:   inner,
+		timeout: timeout,
+	}
+}
+
+//Timeout returns a decorator for use with Chain that wraps a Store using TimeoutStore
+func Timeout(timeout time.Duration) func(Store) Store {
+	return func(s Store) Store {
+		return TimeoutStore(s, timeout)
+	}
+}
+
+//Save saves the state, bounded by the timeout
+func (ts *timeoutStore) Save(token Token, sessionState interface{}) error {
+	return ts.SaveContext(context.Background(), token, sessionState)
+}
+
+//Get gets the state, bounded by the timeout
+func (ts *timeoutStore) Get(token Token, sessionState interface{}) error {
+	return ts.GetContext(context.Background(), token, sessionState)
+}
+
+//Delete deletes the state, bounded by the timeout
+func (ts *timeoutStore) Delete(token Token) error {
+	return ts.DeleteContext(context.Background(), token)
+}
+
+//SaveContext saves the state, bounded by the timeout and the context
+func (ts *timeoutStore) SaveContext(ctx context.Context, token Token, sessionState interface{}) error {
+	return ts.do(ctx, StoreOpSave, func(ctx context.Context) error {
+		return saveContext(ctx, ts.inner, token, sessionState)
+	})
+}
+
+//GetContext gets the state, bounded by the timeout and the context
+func (ts *timeoutStore) GetContext(ctx context.Context, token Token, sessionState interface{}) error {
+	if _, ok := ts.inner.(ContextStore); ok || sessionState == nil {
+		return ts.do(ctx, StoreOpGet, func(ctx context.Context) error {
+			return getContext(ctx, ts.inner, token, sessionState)
+		})
+	}
+	return ts.read(ctx, StoreOpGet, sessionState, func(state interface{}) error {
+		return ts.inner.Get(token, state)
+	})
+}
+
+//DeleteContext deletes the state, bounded by the timeout and the context
+func (ts *timeoutStore) DeleteContext(ctx context.Context, token Token) error {
+	return ts.do(ctx, StoreOpDelete, func(ctx context.Context) error {
+		return deleteContext(ctx, ts.inner, token)
+	})
+}
+
+//Ping pings the inner store, bounded by the timeout
+func (ts *timeoutStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.timeout)
+	defer cancel()
+	return ping(ctx, ts.inner)
+}
+
+//Peek peeks at the state, bounded by the timeout
+func (ts *timeoutStore) Peek(token Token, sessionState interface{}) error {
+	return ts.read(context.Background(), StoreOpPeek, sessionState, func(state interface{}) error {
+		return peek(ts.inner, token, state)
+	})
+}
+
+//GetAndTouch gets and touches the state, bounded by the timeout
+func (ts *timeoutStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	return ts.read(context.Background(), StoreOpGetAndTouch, sessionState, func(state interface{}) error {
+		return getAndTouch(ts.inner, token, state, ttl)
+	})
+}
+
+//Touch touches the state, bounded by the timeout
+func (ts *timeoutStore) Touch(token Token) error {
+	return ts.do(context.Background(), StoreOpTouch, func(ctx context.Context) error {
+		return touch(ts.inner, token)
+	})
+}
+
+//TTL gets the TTL of the state, bounded by the timeout
+func (ts *timeoutStore) TTL(token Token) (time.Duration, error) {
+	result := make(chan time.Duration, 1)
+	err := ts.do(context.Background(), StoreOpTTL, func(ctx context.Context) error {
+		ttl, err := storeTTL(ts.inner, token)
+		result <- ttl
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return <-result, nil
+}
+
+//Exists checks whether the inner store has the state, bounded by the timeout
+func (ts *timeoutStore) Exists(token Token) (bool, error) {
+	result := make(chan bool, 1)
+	err := ts.do(context.Background(), StoreOpExists, func(ctx context.Context) error {
+		found, err := exists(ts.inner, token)
+		result <- found
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return <-result, nil
+}
+
+//Scan scans the inner store. Scans aren't bounded by the timeout,
+//as they take as long as the store has sessions.
+func (ts *timeoutStore) Scan(fn func(token Token) error) error {
+	return scan(ts.inner, fn)
+}
+
+//Replace replaces the state, bounded by the timeout
+func (ts *timeoutStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	return ts.do(context.Background(), StoreOpReplace, func(ctx context.Context) error {
+		return replace(ts.inner, token, sessionState, replaced)
+	})
+}
+
+//read reads the state using fn, bounded by the timeout and the context.
+//The inner store may keep running after we time out, so fn decodes into
+//a new value, which is only copied to sessionState on success, so the
+//inner store never writes to sessionState after we return.
+func (ts *timeoutStore) read(ctx context.Context, op StoreOp, sessionState interface{}, fn func(state interface{}) error) error {
+	if sessionState == nil {
+		return ts.do(ctx, op, func(ctx context.Context) error {
+			return fn(nil)
+		})
+	}
+	target := reflect.ValueOf(sessionState)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("session state must be a non-nil pointer")
+	}
+	temp := reflect.New(target.Elem().Type())
+	err := ts.do(ctx, op, func(ctx context.Context) error {
+		return fn(temp.Interface())
+	})
+	if err == nil {
+		target.Elem().Set(temp.Elem())
+	}
+	return err
+}
+
+//do runs op with a context bounded by the timeout, and returns
+//a *TimeoutError if the timeout elapses before op completes
+func (ts *timeoutStore) do(ctx context.Context, op StoreOp, fn func(context.Context) error) error {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, ts.timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- fn(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		//if the caller's context is done, return its error,
+		//otherwise our own timeout elapsed
+		if err := parent.Err(); err != nil {
+			return err
+		}
+		return &TimeoutError{Op: op, Duration: ts.timeout}
+	}
+}
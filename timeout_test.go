@@ -0,0 +1,131 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+//slowStore wraps a mockStore, delaying each operation
+type slowStore struct {
+	*mockStore
+	delay time.Duration
+}
+
+func (ss *slowStore) Save(token Token, sessionState interface{}) error {
+	time.Sleep(ss.delay)
+	return ss.mockStore.Save(token, sessionState)
+}
+
+func (ss *slowStore) Get(token Token, sessionState interface{}) error {
+	time.Sleep(ss.delay)
+	return ss.mockStore.Get(token, sessionState)
+}
+
+func (ss *slowStore) Delete(token Token) error {
+	time.Sleep(ss.delay)
+	return ss.mockStore.Delete(token)
+}
+
+func TestTimeoutStore(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	cases := []struct {
+		name          string
+		delay         time.Duration
+		expectTimeout bool
+	}{
+		{
+			"fast store",
+			0,
+			false,
+		},
+		{
+			"slow store",
+			50 * time.Millisecond,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		inner := &slowStore{newMockStore(false), 0}
+		inner.mockStore.Save(token, "test state")
+		inner.delay = c.delay
+		store := Chain(inner, Timeout(10*time.Millisecond))
+
+		ops := map[StoreOp]func() error{
+			StoreOpSave:   func() error { return store.Save(token, "test state") },
+			StoreOpGet:    func() error { var state string; return store.Get(token, &state) },
+			StoreOpDelete: func() error { return store.Delete(token) },
+		}
+		for op, fn := range ops {
+			err := fn()
+			if !c.expectTimeout {
+				if err != nil {
+					t.Errorf("case %s %s: unexpected error: %v", c.name, op, err)
+				}
+				continue
+			}
+			te, ok := err.(*TimeoutError)
+			if !ok {
+				t.Errorf("case %s %s: expected *TimeoutError but got %v", c.name, op, err)
+				continue
+			}
+			if te.Op != op || !te.Timeout() || len(te.Error()) == 0 {
+				t.Errorf("case %s %s: incorrect timeout error: %+v", c.name, op, te)
+			}
+		}
+	}
+}
+
+func TestTimeoutStoreGetCopiesOnSuccess(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	inner := &slowStore{newMockStore(false), 0}
+	inner.mockStore.Save(token, "test state")
+	store := TimeoutStore(inner, time.Second)
+
+	var state string
+	if err := store.Get(token, &state); err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if state != "test state" {
+		t.Errorf("incorrect state: expected %s but got %s", "test state", state)
+	}
+	if err := store.Get(token, state); err == nil {
+		t.Error("did not receive expected error when getting into a non-pointer")
+	}
+}
+
+func TestTimeoutStoreContext(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+
+	//the context should be passed to inner stores that implement ContextStore
+	inner := RetryStore(&slowStore{newMockStore(false), 50 * time.Millisecond}, DefaultRetryPolicy)
+	store := TimeoutStore(inner, 10*time.Millisecond)
+	var state string
+	if _, ok := store.Get(token, &state).(*TimeoutError); !ok {
+		t.Error("did not receive expected timeout error")
+	}
+
+	//a cancelled caller context should return the context's error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store = TimeoutStore(&slowStore{newMockStore(false), 50 * time.Millisecond}, time.Second)
+	if err := store.(ContextStore).SaveContext(ctx, token, "test state"); err != context.Canceled {
+		t.Errorf("incorrect error: expected %v but got %v", context.Canceled, err)
+	}
+
+	//pings should be passed through
+	if err := store.(Pinger).Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error pinging: %v", err)
+	}
+}
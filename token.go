@@ -5,7 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 )
 
 //MinIDLength is the minimum ID byte length allowed.
@@ -15,27 +19,144 @@ const MinIDLength = 16
 //DefaultIDLength is the default ID byte length.
 const DefaultIDLength = 32
 
-//randReader is the reader used to generate random bytes for sessionIDs.
-//This can be reset during automated tests to simulate an error from
-//the crypto/rand reader.
-var randReader = rand.Reader
+//DefaultMaxTokenLength is the default maximum length of an encoded token
+//accepted by VerifyToken. It is long enough for tokens with very long IDs,
+//and for stateless tokens with a few kilobytes of state.
+const DefaultMaxTokenLength = 8192
+
+//ErrTokenTooLong is returned when verifying an encoded token that
+//is longer than the maximum length, which is rejected before it is
+//decoded, so that huge tokens can't be used to waste server resources
+var ErrTokenTooLong = errors.New("session token is too long")
+
+//Encoding converts token and ID bytes to and from strings.
+//The *base64.Encoding values in the standard library, such as
+//base64.URLEncoding and base64.RawURLEncoding, satisfy this interface,
+//as do HexEncoding and Base62Encoding.
+type Encoding interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}
+
+//defaultEncoding is the Encoding used for tokens and IDs
+//unless another is specified using WithEncoding
+var defaultEncoding Encoding = base64.URLEncoding
+
+//TokenOption configures how tokens are generated and verified.
+//The same options must be used when verifying a token as were
+//used when generating it.
+type TokenOption func(*tokenOptions)
+
+//tokenOptions holds the settings controlled by TokenOptions
+type tokenOptions struct {
+	encoding Encoding
+	//idEncoding is the Encoding used for IDs,
+	//or nil to use the same one as tokens
+	idEncoding Encoding
+	rand       io.Reader
+	idGen      IDGenerator
+	maxLength  int
+	issuedAt   bool
+	//statelessTTL is how long stateless tokens are valid
+	statelessTTL time.Duration
+}
+
+//newTokenOptions returns the default settings with opts applied
+func newTokenOptions(opts []TokenOption) *tokenOptions {
+	to := &tokenOptions{encoding: defaultEncoding, rand: rand.Reader, idGen: RandomIDs, maxLength: DefaultMaxTokenLength,
+		statelessTTL: DefaultStatelessTTL}
+	for _, opt := range opts {
+		opt(to)
+	}
+	return to
+}
+
+//WithEncoding sets the Encoding used for the string versions of tokens
+//and IDs. The default is base64.URLEncoding, but base64.RawURLEncoding
+//omits the "=" padding, which breaks some proxies and needlessly lengthens
+//store keys. When RawURLEncoding is selected, padded tokens are rejected.
+func WithEncoding(enc Encoding) TokenOption {
+	return func(to *tokenOptions) {
+		to.encoding = enc
+	}
+}
+
+//WithIDEncoding sets the Encoding used for the string versions of IDs,
+//which are used as keys in stores and appear in logs and events, leaving
+//tokens in the Encoding set by WithEncoding. By default, IDs use the same
+//Encoding as tokens, but the "-" and "_" characters of base64url are
+//mangled by some log pipelines and SQL collations, which HexEncoding and
+//Base62Encoding avoid. Changing the ID encoding changes the store keys of
+//all sessions, so sessions begun before the change can't be resumed.
+func WithIDEncoding(enc Encoding) TokenOption {
+	return func(to *tokenOptions) {
+		to.idEncoding = enc
+	}
+}
+
+//idEnc returns the Encoding used for IDs
+func (to *tokenOptions) idEnc() Encoding {
+	if to.idEncoding != nil {
+		return to.idEncoding
+	}
+	return to.encoding
+}
+
+//WithRand sets the reader used to generate random bytes for new tokens.
+//The default is crypto/rand.Reader, which should always be used in
+//production, but fuzzing harnesses and tests can use a deterministic
+//reader to generate predictable tokens. This has no effect when
+//verifying tokens. To use this with a Manager, pass it to WithTokenOptions.
+func WithRand(r io.Reader) TokenOption {
+	return func(to *tokenOptions) {
+		to.rand = r
+	}
+}
+
+//WithMaxTokenLength sets the maximum length of an encoded token accepted
+//when verifying tokens. Longer tokens are rejected with ErrTokenTooLong
+//before they are decoded. The default is DefaultMaxTokenLength. This has
+//no effect when generating tokens.
+func WithMaxTokenLength(maxLength int) TokenOption {
+	return func(to *tokenOptions) {
+		to.maxLength = maxLength
+	}
+}
+
+//issuedAtLength is the length in bytes of the issued-at
+//time included in tokens generated WithIssuedAt
+const issuedAtLength = 8
+
+//WithIssuedAt includes the time each token was issued, as a big-endian
+//count of seconds since the Unix epoch, between the ID and the signature,
+//so that it is covered by the signature. Use IssuedAt to read it. This must
+//be used when verifying tokens if it was used when generating them, and
+//vice-versa, as it changes the layout of the token. To use this with a
+//Manager, pass it to WithTokenOptions, or use WithMaxTokenAge.
+func WithIssuedAt() TokenOption {
+	return func(to *tokenOptions) {
+		to.issuedAt = true
+	}
+}
 
 //ID provides read-only access to the ID portion of the token.
 type ID interface {
 	//Len returns the length of the session ID in bytes
 	Len() int
-	//String returns a base64-encoded version of the ID,
-	//suitable for use as a key in a session store
+	//String returns an encoded version of the ID, suitable for use as
+	//a key in a session store, which is base64-encoded unless another
+	//Encoding is set using WithEncoding or WithIDEncoding
 	String() string
 }
 
 //id is the concrete implementation of the ID interface
 type id struct {
 	buf []byte
+	enc Encoding
 }
 
 //Token represents a crypto-randon, digitally-signed session token.
-//Use NewToken() or NewTokenFromReader() to generate a new token.
+//Use NewToken() or NewTokenOfLength() to generate a new token.
 //Use the String() method to generate a base64-encoded version of the token
 //that is safe to transport over HTTPS, and use VerifyToken to verify
 //a base64-encoded token sent by the client.
@@ -51,28 +172,50 @@ type token struct {
 	//buf holds both the session ID bytes, and the HMAC signature bytes.
 	//The first bytes are the crypto-random session ID, which can be
 	//of any length >= MinIDLength. The last sha256.Size (32) bytes are
-	//the HMAC signature of those session ID bytes.
+	//the HMAC signature of those session ID bytes, unless the token
+	//was signed with a SigningKey using another algorithm.
 	// ---------------------------------------------------------
 	// | ID bytes (>= MinIDLength) | HMAC signature (32 bytes) |
 	// ---------------------------------------------------------
 	buf []byte
+	//enc is the Encoding used for the string versions
+	//of the token and its ID
+	enc Encoding
+	//idEnc is the Encoding used for the ID,
+	//if it differs from enc
+	idEnc Encoding
+	//issuedAt is true if the issued-at time is
+	//between the ID bytes and the signature
+	issuedAt bool
+	//sigSize is the size of the signature in bytes,
+	//or zero for the size of an HMAC-SHA-256 signature
+	sigSize int
 }
 
 //NewToken constructs a new Token of DefaultIDLength, using the
 //provided signingKey for generating the HMAC signature.
-func NewToken(signingKey []byte) (Token, error) {
-	return NewTokenOfLength(signingKey, DefaultIDLength)
+func NewToken(signingKey []byte, opts ...TokenOption) (Token, error) {
+	return NewTokenOfLength(signingKey, DefaultIDLength, opts...)
 }
 
 //NewTokenOfLength constructs a new Token using idLength as the length of the session ID
 //in bytes (must be >= MinIDLength). The signingKey must be non-zero length,
 //and will be used with the HMAC algorithm to digitally sign the ID.
-func NewTokenOfLength(signingKey []byte, idLength int) (Token, error) {
+func NewTokenOfLength(signingKey []byte, idLength int, opts ...TokenOption) (Token, error) {
+	return NewTokenWithKey(SigningKey{Algorithm: HS256, Key: signingKey}, idLength, opts...)
+}
+
+//NewTokenWithKey is like NewTokenOfLength, but signs the token using
+//the SigningKey's algorithm, which must be able to sign tokens
+func NewTokenWithKey(signingKey SigningKey, idLength int, opts ...TokenOption) (Token, error) {
 	//preconditions:
-	// - len(signingKey) > 0
+	// - signingKey is valid, and can sign
 	// - idLength >= MinIDLength
-	if len(signingKey) == 0 {
-		return nil, fmt.Errorf("zero-length signing key")
+	if err := signingKey.check(); err != nil {
+		return nil, err
+	}
+	if !signingKey.canSign() {
+		return nil, fmt.Errorf("%s public keys can only verify tokens", EdDSA)
 	}
 	if idLength < MinIDLength {
 		return nil, fmt.Errorf("ID length must be at least %d", MinIDLength)
@@ -80,53 +223,142 @@ func NewTokenOfLength(signingKey []byte, idLength int) (Token, error) {
 
 	//allocate the token buffer with a length of idLength,
 	//but a capacity that includes the length of the signature
-	tk := &token{buf: make([]byte, idLength, idLength+sha256.Size)}
+	to := newTokenOptions(opts)
+	tk := &token{
+		buf:     make([]byte, idLength, idLength+issuedAtLength+signingKey.sigSize()),
+		enc:     to.encoding,
+		idEnc:   to.idEncoding,
+		sigSize: signingKey.sigSize(),
+	}
+
+	//generate the ID portion
+	if err := to.idGen.GenerateID(tk.buf, to.rand); err != nil {
+		return nil, err
+	}
 
-	//read random bytes from the reader for the ID portion
-	if _, err := randReader.Read(tk.buf); err != nil {
-		return nil, fmt.Errorf("error reading random bytes: %v", err)
+	//append the issued-at time, if requested
+	if to.issuedAt {
+		tk.buf = tk.buf[:idLength+issuedAtLength]
+		binary.BigEndian.PutUint64(tk.buf[idLength:], uint64(time.Now().Unix()))
+		tk.issuedAt = true
 	}
 
 	//sign and return
-	h := hmac.New(sha256.New, signingKey)
-	h.Write(tk.buf)
-	tk.buf = h.Sum(tk.buf)
+	tk.buf = signingKey.appendSig(tk.buf)
 	return tk, nil
 }
 
 //VerifyToken verifies a base64-encoded token string using the provided signingKey.
-func VerifyToken(b64token string, signingKey []byte) (Token, error) {
-	if len(signingKey) == 0 {
-		return nil, fmt.Errorf("zero-length signing key")
+//Tokens longer than the maximum length (see WithMaxTokenLength) are rejected
+//with ErrTokenTooLong, and tokens that aren't in the canonical form produced
+//by the token's String method, such as those with embedded newlines or
+//non-zero padding bits, are rejected as invalid.
+func VerifyToken(b64token string, signingKey []byte, opts ...TokenOption) (Token, error) {
+	return VerifyTokenWithKey(b64token, SigningKey{Algorithm: HS256, Key: signingKey}, opts...)
+}
+
+//VerifyTokenWithKey is like VerifyToken, but verifies the
+//token's signature using the SigningKey's algorithm
+func VerifyTokenWithKey(b64token string, signingKey SigningKey, opts ...TokenOption) (Token, error) {
+	if err := signingKey.check(); err != nil {
+		return nil, err
+	}
+	to := newTokenOptions(opts)
+	if to.maxLength > 0 && len(b64token) > to.maxLength {
+		return nil, ErrTokenTooLong
 	}
-	buf, err := base64.URLEncoding.DecodeString(b64token)
+	enc := to.encoding
+	buf, err := enc.DecodeString(b64token)
 	if err != nil {
 		return nil, fmt.Errorf("error base64-decoding the token: %v", err)
 	}
-	//if the buffer is not longer than the size of a SHA256 hash + MinIDLength, it can't be valid
-	if len(buf) < sha256.Size+MinIDLength {
+	//reject alternate encodings of the same bytes, so that
+	//each token has exactly one valid string form
+	if enc.EncodeToString(buf) != b64token {
+		return nil, fmt.Errorf("token is not canonically encoded")
+	}
+	//if the buffer is not longer than the size of a signature + MinIDLength
+	//(+ the issued-at time, if expected), it can't be valid
+	sigSize := signingKey.sigSize()
+	minLength := sigSize + MinIDLength
+	if to.issuedAt {
+		minLength += issuedAtLength
+	}
+	if len(buf) < minLength {
 		return nil, fmt.Errorf("token not long enough")
 	}
 
-	//split the ID from the signature
-	sigStart := len(buf) - sha256.Size
+	//split the ID from the signature, and verify
+	sigStart := len(buf) - sigSize
 	id, sig := buf[:sigStart], buf[sigStart:]
-
-	//re-sign and compare
-	h := hmac.New(sha256.New, signingKey)
-	h.Write(id)
-	sig2 := h.Sum(nil)
-	if !hmac.Equal(sig, sig2) {
+	if !signingKey.verifySig(id, sig) {
 		return nil, fmt.Errorf("token has been modified since signed")
 	}
 
-	return &token{buf}, nil
+	return &token{buf: buf, enc: enc, idEnc: to.idEncoding, issuedAt: to.issuedAt, sigSize: sigSize}, nil
+}
+
+//VerifyTokenWithKeys is like VerifyToken, but tries each of the keys in
+//turn, returning the verified Token and the index of the key that verified
+//it, so that callers can tell which keys are still in use before retiring
+//them. If no key verifies the token, the index is -1, and the error is the
+//one returned for the last key.
+func VerifyTokenWithKeys(b64token string, keys ...[]byte) (Token, int, error) {
+	return verifyTokenWithKeys(b64token, newHMACKeyRing(keys), nil)
+}
+
+//verifyTokenWithKeys is like VerifyTokenWithKeys, but
+//accepts SigningKeys, and also accepts TokenOptions
+func verifyTokenWithKeys(b64token string, keys []SigningKey, opts []TokenOption) (Token, int, error) {
+	err := fmt.Errorf("no signing keys")
+	for i, key := range keys {
+		var tk Token
+		if tk, err = VerifyTokenWithKey(b64token, key, opts...); err == nil {
+			return tk, i, nil
+		}
+	}
+	return nil, -1, err
+}
+
+//IssuedAt returns the time the token was issued, which is included in
+//tokens generated WithIssuedAt. It returns false if the token doesn't
+//include the issued-at time.
+func IssuedAt(tk Token) (time.Time, bool) {
+	t, ok := tk.(*token)
+	if !ok || !t.issuedAt {
+		return time.Time{}, false
+	}
+	sigStart := len(t.buf) - t.sigLen()
+	secs := binary.BigEndian.Uint64(t.buf[sigStart-issuedAtLength : sigStart])
+	return time.Unix(int64(secs), 0), true
+}
+
+//sign appends the HMAC signature of the ID bytes
+//(and issued-at time, if any) in the buffer
+func (t *token) sign(signingKey []byte) {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write(t.buf)
+	t.buf = h.Sum(t.buf)
+}
+
+//signWith is like sign, but uses the SigningKey's algorithm
+func (t *token) signWith(signingKey SigningKey) {
+	t.buf = signingKey.appendSig(t.buf)
+	t.sigSize = signingKey.sigSize()
+}
+
+//sigLen returns the size of the token's signature in bytes
+func (t *token) sigLen() int {
+	if t.sigSize == 0 {
+		return sha256.Size
+	}
+	return t.sigSize
 }
 
 //String returns a base64-encoded version of the token, suitable
 //for transporting over a text-based protocol like HTTP.
 func (t *token) String() string {
-	return base64.URLEncoding.EncodeToString(t.buf)
+	return t.enc.EncodeToString(t.buf)
 }
 
 //ID returns the session ID from the token. The returned interface
@@ -134,8 +366,17 @@ func (t *token) String() string {
 //and allowing you to generate a base64-encoded version of the bytes,
 //which can be used as a key in a session store.
 func (t *token) ID() ID {
+	idEnd := len(t.buf) - t.sigLen()
+	if t.issuedAt {
+		idEnd -= issuedAtLength
+	}
+	enc := t.idEnc
+	if enc == nil {
+		enc = t.enc
+	}
 	return &id{
-		buf: t.buf[:len(t.buf)-sha256.Size],
+		buf: t.buf[:idEnd],
+		enc: enc,
 	}
 }
 
@@ -144,7 +385,7 @@ func (i *id) Len() int {
 	return len(i.buf)
 }
 
-//String returns a base64-encoded string of the ID
+//String returns the encoded string of the ID
 func (i *id) String() string {
-	return base64.URLEncoding.EncodeToString(i.buf)
+	return i.enc.EncodeToString(i.buf)
 }
@@ -1,10 +1,12 @@
 package sessions
 
 import (
-	"crypto/rand"
+	"bytes"
 	"encoding/base64"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 var testSigningKey = []byte("testsigningkey")
@@ -116,12 +118,10 @@ func TestNewTokenOfLength(t *testing.T) {
 
 func TestNewTokenErrorReadingRandom(t *testing.T) {
 	//use errorReader to simulate an error reading random bytes
-	randReader = &errorReader{}
-	_, err := NewToken(testSigningKey)
+	_, err := NewToken(testSigningKey, WithRand(&errorReader{}))
 	if err == nil {
 		t.Error("did not receive expected error when simulating error reading random bytes")
 	}
-	randReader = rand.Reader
 }
 
 func TestNewToken(t *testing.T) {
@@ -215,6 +215,21 @@ func TestVerifyToken(t *testing.T) {
 			modToken(tokenString),
 			testSigningKey,
 		},
+		{
+			"embedded newline",
+			tokenString[:10] + "\n" + tokenString[10:],
+			testSigningKey,
+		},
+		{
+			"non-zero padding bits",
+			nonCanonical(tokenString),
+			testSigningKey,
+		},
+		{
+			"too long",
+			strings.Repeat("A", DefaultMaxTokenLength+1),
+			testSigningKey,
+		},
 	}
 
 	for _, c := range cases {
@@ -225,6 +240,52 @@ func TestVerifyToken(t *testing.T) {
 	}
 }
 
+//nonCanonical sets one of the unused padding bits in the last
+//encoded character of a padded base64 token, which produces a token
+//that decodes to the same bytes unless decoding is strict
+func nonCanonical(b64token string) string {
+	padStart := strings.IndexByte(b64token, '=')
+	last := strings.IndexByte(base64URLAlphabet, b64token[padStart-1])
+	return b64token[:padStart-1] + string(base64URLAlphabet[last|1]) + b64token[padStart:]
+}
+
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+func TestVerifyTokenMaxLength(t *testing.T) {
+	token, err := NewTokenOfLength(testSigningKey, 64)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if _, err := VerifyToken(token.String(), testSigningKey, WithMaxTokenLength(len(token.String())-1)); err != ErrTokenTooLong {
+		t.Errorf("incorrect error: expected %v but got %v", ErrTokenTooLong, err)
+	}
+	if _, err := VerifyToken(token.String(), testSigningKey, WithMaxTokenLength(len(token.String()))); err != nil {
+		t.Errorf("unexpected error verifying token: %v", err)
+	}
+}
+
+func FuzzVerifyToken(f *testing.F) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		f.Fatalf("unexpected error generating token: %v", err)
+	}
+	f.Add(token.String())
+	f.Add(modToken(token.String()))
+	f.Add(nonCanonical(token.String()))
+	f.Add("")
+	f.Add("====")
+	f.Fuzz(func(t *testing.T, b64token string) {
+		tk, err := VerifyToken(b64token, testSigningKey)
+		if err != nil {
+			return
+		}
+		//only canonical tokens may verify
+		if tk.String() != b64token {
+			t.Errorf("verified non-canonical token %q, which encodes as %q", b64token, tk.String())
+		}
+	})
+}
+
 func TestTokenIDString(t *testing.T) {
 	//ensure that the ID string is non-zero length
 	//and can be base64-decoded
@@ -240,3 +301,160 @@ func TestTokenIDString(t *testing.T) {
 		t.Errorf("error base64-decoding ID string: %v", err)
 	}
 }
+
+func TestTokenEncoding(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       []TokenOption
+		expectsPad bool
+	}{
+		{
+			"default encoding",
+			nil,
+			true,
+		},
+		{
+			"raw URL encoding",
+			[]TokenOption{WithEncoding(base64.RawURLEncoding)},
+			false,
+		},
+	}
+
+	for _, c := range cases {
+		token, err := NewToken(testSigningKey, c.opts...)
+		if err != nil {
+			t.Errorf("case %s: unexpected error generating token: %v", c.name, err)
+			continue
+		}
+		if strings.Contains(token.String(), "=") != c.expectsPad {
+			t.Errorf("case %s: incorrect padding in token %s", c.name, token.String())
+		}
+		if strings.Contains(token.ID().String(), "=") != c.expectsPad {
+			t.Errorf("case %s: incorrect padding in ID %s", c.name, token.ID().String())
+		}
+		token2, err := VerifyToken(token.String(), testSigningKey, c.opts...)
+		if err != nil {
+			t.Errorf("case %s: unexpected error verifying token: %v", c.name, err)
+			continue
+		}
+		if token2.String() != token.String() || token2.ID().String() != token.ID().String() {
+			t.Errorf("case %s: verified token does not match original: expected %s but got %s", c.name, token.String(), token2.String())
+		}
+	}
+
+	//padded tokens should be rejected when raw encoding is selected
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if _, err := VerifyToken(token.String(), testSigningKey, WithEncoding(base64.RawURLEncoding)); err == nil {
+		t.Error("did not receive expected error verifying padded token with raw encoding")
+	}
+}
+
+func TestWithRand(t *testing.T) {
+	//the same random bytes should produce the same token
+	seed := bytes.Repeat([]byte{7}, DefaultIDLength)
+	tk1, err := NewToken(testSigningKey, WithRand(bytes.NewReader(seed)))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	tk2, err := NewToken(testSigningKey, WithRand(bytes.NewReader(seed)))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if tk1.String() != tk2.String() {
+		t.Errorf("tokens generated from the same random bytes differ: %s, %s", tk1, tk2)
+	}
+	//a short read should be an error
+	if _, err := NewToken(testSigningKey, WithRand(bytes.NewReader(seed[:4]))); err == nil {
+		t.Error("did not receive expected error when random bytes were exhausted")
+	}
+}
+
+func TestWithIssuedAt(t *testing.T) {
+	before := time.Now().Unix()
+	tk, err := NewToken(testSigningKey, WithIssuedAt())
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if tk.ID().Len() != DefaultIDLength {
+		t.Errorf("incorrect ID length: expected %d but got %d", DefaultIDLength, tk.ID().Len())
+	}
+	issued, ok := IssuedAt(tk)
+	if !ok || issued.Unix() < before || issued.Unix() > time.Now().Unix() {
+		t.Errorf("incorrect issued-at time: %v, %t", issued, ok)
+	}
+
+	verified, err := VerifyToken(tk.String(), testSigningKey, WithIssuedAt())
+	if err != nil {
+		t.Fatalf("unexpected error verifying token: %v", err)
+	}
+	if verified.ID().String() != tk.ID().String() {
+		t.Errorf("incorrect ID: expected %s but got %s", tk.ID(), verified.ID())
+	}
+	if verifiedIssued, ok := IssuedAt(verified); !ok || !verifiedIssued.Equal(issued) {
+		t.Errorf("incorrect issued-at time: expected %v but got %v", issued, verifiedIssued)
+	}
+
+	//the issued-at time should be covered by the signature
+	buf := tk.(*token).buf
+	modified := append([]byte{}, buf...)
+	modified[DefaultIDLength+issuedAtLength-1]--
+	if _, err := VerifyToken(base64.URLEncoding.EncodeToString(modified), testSigningKey, WithIssuedAt()); err == nil {
+		t.Error("did not receive expected error verifying token with modified issued-at time")
+	}
+
+	//tokens without the issued-at time shouldn't report one
+	plain, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if _, ok := IssuedAt(plain); ok {
+		t.Error("token without issued-at time reported one")
+	}
+	//minimum-length tokens without the issued-at time should be rejected
+	short, err := NewTokenOfLength(testSigningKey, MinIDLength)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	if _, err := VerifyToken(short.String(), testSigningKey, WithIssuedAt()); err == nil {
+		t.Error("did not receive expected error verifying token without issued-at time")
+	}
+}
+
+func TestVerifyTokenWithKeys(t *testing.T) {
+	oldKey := []byte("oldsigningkey")
+	tk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	cases := []struct {
+		name          string
+		keys          [][]byte
+		expectedIndex int
+	}{
+		{"first key", [][]byte{testSigningKey, oldKey}, 0},
+		{"second key", [][]byte{oldKey, testSigningKey}, 1},
+		{"no matching key", [][]byte{oldKey}, -1},
+		{"no keys", nil, -1},
+	}
+
+	for _, c := range cases {
+		verified, i, err := VerifyTokenWithKeys(tk.String(), c.keys...)
+		if i != c.expectedIndex {
+			t.Errorf("case %s: incorrect key index: expected %d but got %d", c.name, c.expectedIndex, i)
+		}
+		if c.expectedIndex < 0 {
+			if err == nil {
+				t.Errorf("case %s: did not receive expected error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+		} else if verified.String() != tk.String() {
+			t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, tk, verified)
+		}
+	}
+}
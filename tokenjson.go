@@ -0,0 +1,76 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+//TokenResponse is the JSON body written by WriteTokenJSON, which
+//follows the shape of an OAuth 2.0 access token response (RFC 6749)
+type TokenResponse struct {
+	//TokenType is always "Bearer"
+	TokenType string `json:"token_type"`
+	//AccessToken is the session token
+	AccessToken string `json:"access_token"`
+	//ExpiresIn is the number of seconds until the session expires,
+	//or zero if it isn't known
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+	//Scope is the space-separated list of scopes granted to the token
+	Scope string `json:"scope,omitempty"`
+}
+
+//TokenMeta describes the session token passed to WriteTokenJSON
+type TokenMeta struct {
+	//ExpiresIn is how long until the session expires,
+	//or zero if it isn't known
+	ExpiresIn time.Duration
+	//Scope is the space-separated list of scopes granted to the token
+	Scope string
+	//Extra are additional fields added to the response, such as
+	//a user ID. They can't replace the TokenResponse fields.
+	Extra map[string]interface{}
+}
+
+//WriteTokenJSON writes a JSON TokenResponse containing the session token,
+//so that login handlers return tokens in a consistent shape. The meta may
+//be nil. Like an OAuth 2.0 token response, the response must not be cached.
+//Use this with a manager constructed WithoutResponseHeader, so that the token isn't
+//also written to the Authorization header.
+func WriteTokenJSON(w http.ResponseWriter, token Token, meta *TokenMeta) error {
+	resp := TokenResponse{
+		TokenType:   authTypeBearer,
+		AccessToken: token.String(),
+	}
+	var body interface{} = resp
+	if meta != nil {
+		resp.ExpiresIn = int64(meta.ExpiresIn / time.Second)
+		resp.Scope = meta.Scope
+		body = resp
+		if len(meta.Extra) > 0 {
+			fields := make(map[string]interface{}, len(meta.Extra)+4)
+			for k, v := range meta.Extra {
+				fields[k] = v
+			}
+			fields["token_type"] = resp.TokenType
+			fields["access_token"] = resp.AccessToken
+			if resp.ExpiresIn > 0 {
+				fields["expires_in"] = resp.ExpiresIn
+			}
+			if len(resp.Scope) > 0 {
+				fields["scope"] = resp.Scope
+			}
+			body = fields
+		}
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding token response: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	_, err = w.Write(buf)
+	return err
+}
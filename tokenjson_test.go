@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteTokenJSON(t *testing.T) {
+	tk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	cases := []struct {
+		name     string
+		meta     *TokenMeta
+		expected map[string]interface{}
+	}{
+		{
+			"no meta",
+			nil,
+			map[string]interface{}{"token_type": "Bearer", "access_token": tk.String()},
+		},
+		{
+			"expiry and scope",
+			&TokenMeta{ExpiresIn: time.Hour, Scope: "orders:read profile"},
+			map[string]interface{}{"token_type": "Bearer", "access_token": tk.String(), "expires_in": 3600.0, "scope": "orders:read profile"},
+		},
+		{
+			"extra fields",
+			&TokenMeta{ExpiresIn: time.Minute, Extra: map[string]interface{}{"user_id": "user1", "token_type": "MAC"}},
+			map[string]interface{}{"token_type": "Bearer", "access_token": tk.String(), "expires_in": 60.0, "user_id": "user1"},
+		},
+	}
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		if err := WriteTokenJSON(respRec, tk, c.meta); err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if respRec.Header().Get("Content-Type") != "application/json" || respRec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("case %s: incorrect headers: %v", c.name, respRec.Header())
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(respRec.Body.Bytes(), &body); err != nil {
+			t.Errorf("case %s: error decoding response: %v", c.name, err)
+			continue
+		}
+		if len(body) != len(c.expected) {
+			t.Errorf("case %s: incorrect response: expected %v but got %v", c.name, c.expected, body)
+			continue
+		}
+		for k, v := range c.expected {
+			if body[k] != v {
+				t.Errorf("case %s: incorrect %s: expected %v but got %v", c.name, k, v, body[k])
+			}
+		}
+	}
+
+	//extra fields that can't be encoded should be an error
+	if err := WriteTokenJSON(httptest.NewRecorder(), tk, &TokenMeta{Extra: map[string]interface{}{"bad": func() {}}}); err == nil {
+		t.Error("did not receive expected error encoding invalid extra field")
+	}
+}
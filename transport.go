@@ -0,0 +1,247 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//Transport describes how session tokens are delivered to clients
+//in responses, and extracted from requests. Implement this to carry
+//tokens over channels other than the ones provided by this package.
+type Transport interface {
+	//Write adds the token to the response
+	Write(w http.ResponseWriter, token Token) error
+	//Read returns the encoded token from the request,
+	//or ErrNoToken if the request doesn't contain one
+	Read(r *http.Request) (string, error)
+}
+
+//CandidateReader is implemented by transports that may find several
+//candidate tokens in a request, such as when a request has several
+//Authorization headers, so that the manager can use the first one
+//that verifies
+type CandidateReader interface {
+	//ReadCandidates returns the encoded tokens found in the request, in
+	//order of preference, or the error Read would return if there are none
+	ReadCandidates(r *http.Request) ([]string, error)
+}
+
+//HeaderTransport is a Transport that carries tokens in a request
+//and response header, such as "Authorization: Bearer <token>"
+type HeaderTransport struct {
+	//Name is the header name
+	Name string
+	//Scheme is the authorization scheme that prefixes the token in the
+	//header value, separated by a space. If empty, the header value
+	//is just the token.
+	Scheme string
+}
+
+//QueryTransport is a Transport that reads tokens from a query string
+//parameter, such as "?auth=Bearer+<token>". Since tokens can't be
+//added to the URL of a response, Write does nothing.
+type QueryTransport struct {
+	//Param is the query string parameter name
+	Param string
+	//Scheme is the authorization scheme that prefixes the token in the
+	//parameter value, separated by a space. If empty, the parameter
+	//value is just the token.
+	Scheme string
+}
+
+//CookieTransport is a Transport that carries tokens in a cookie.
+//Tokens too long for a single cookie are split across several
+//cookies, as described in SetChunkedCookie.
+type CookieTransport struct {
+	//Cookie is the template for the cookie that is written to
+	//responses. Its Value is set to the token, and its Name is
+	//used to read the token from requests.
+	Cookie http.Cookie
+}
+
+//DefaultHeaderTransport carries tokens in the Authorization
+//header, using the Bearer scheme
+var DefaultHeaderTransport = &HeaderTransport{
+	Name:   headerAuthorization,
+	Scheme: authTypeBearer,
+}
+
+//DefaultQueryTransport reads tokens from the auth query string
+//parameter, using the Bearer scheme
+var DefaultQueryTransport = &QueryTransport{
+	Param:  paramAuthorization,
+	Scheme: authTypeBearer,
+}
+
+//DefaultTransport is the Transport used by managers unless
+//another one is set. It writes tokens to the Authorization header,
+//and reads them from that header, falling back to the auth query
+//string parameter for clients that can't set headers.
+var DefaultTransport = Transports(DefaultHeaderTransport, DefaultQueryTransport)
+
+//Write adds the token to the response header
+func (ht *HeaderTransport) Write(w http.ResponseWriter, token Token) error {
+	if len(ht.Scheme) == 0 {
+		w.Header().Add(ht.Name, token.String())
+	} else {
+		w.Header().Add(ht.Name, fmt.Sprintf("%s %s", ht.Scheme, token.String()))
+	}
+	return nil
+}
+
+//Read returns the first token from the request header that uses the
+//transport's Scheme, as described in ReadCandidates
+func (ht *HeaderTransport) Read(r *http.Request) (string, error) {
+	candidates, err := ht.ReadCandidates(r)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+//ReadCandidates returns the tokens from all of the request's headers that
+//use the transport's Scheme. Requests may have several headers with the
+//transport's Name, or several comma-separated values in one header, such as
+//when a gateway adds its own Basic credentials alongside the Bearer token.
+//Values using other schemes are skipped, but if no value uses the
+//transport's Scheme, ErrUnsupportedTokenType is returned.
+func (ht *HeaderTransport) ReadCandidates(r *http.Request) ([]string, error) {
+	var candidates []string
+	err := ErrNoToken
+	for _, header := range r.Header.Values(ht.Name) {
+		for _, value := range strings.Split(header, ",") {
+			token, parseErr := parseAuthValue(value, ht.Scheme)
+			if parseErr == nil {
+				candidates = append(candidates, token)
+			} else if err == ErrNoToken {
+				err = parseErr
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+//Write does nothing, as query string parameters can't be added to a response
+func (qt *QueryTransport) Write(w http.ResponseWriter, token Token) error {
+	return nil
+}
+
+//Read returns the token from the request's query string parameter
+func (qt *QueryTransport) Read(r *http.Request) (string, error) {
+	return parseAuthValue(r.URL.Query().Get(qt.Param), qt.Scheme)
+}
+
+//Write sets the token cookie on the response
+func (ct *CookieTransport) Write(w http.ResponseWriter, token Token) error {
+	cookie := ct.Cookie
+	cookie.Value = token.String()
+	SetChunkedCookie(w, &cookie)
+	return nil
+}
+
+//Read returns the token from the request's cookie
+func (ct *CookieTransport) Read(r *http.Request) (string, error) {
+	value, err := ReadChunkedCookie(r, ct.Cookie.Name)
+	if err == http.ErrNoCookie || (err == nil && len(value) == 0) {
+		return "", ErrNoToken
+	}
+	return value, err
+}
+
+//multiTransport is a Transport that combines several others
+type multiTransport []Transport
+
+//Transports combines several transports into one. Tokens are written
+//using all of the transports, and read from the first transport that
+//finds a token in the request.
+func Transports(transports ...Transport) Transport {
+	return multiTransport(transports)
+}
+
+//Write adds the token to the response using all of the transports
+func (mt multiTransport) Write(w http.ResponseWriter, token Token) error {
+	for _, t := range mt {
+		if err := t.Write(w, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Read returns the first of the candidate tokens
+//returned by ReadCandidates
+func (mt multiTransport) Read(r *http.Request) (string, error) {
+	candidates, err := mt.ReadCandidates(r)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+//ReadCandidates returns the candidate tokens found by all of the
+//transports, in order. If none of them find a token, the first error
+//other than ErrNoToken is returned, or ErrNoToken if there is none.
+func (mt multiTransport) ReadCandidates(r *http.Request) ([]string, error) {
+	var candidates []string
+	err := ErrNoToken
+	for _, t := range mt {
+		found, readErr := readCandidates(t, r)
+		if readErr == nil {
+			candidates = append(candidates, found...)
+		} else if err == ErrNoToken {
+			err = readErr
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+//readCandidates returns the candidate tokens found by the transport,
+//using its ReadCandidates method if it implements CandidateReader
+func readCandidates(t Transport, r *http.Request) ([]string, error) {
+	if cr, ok := t.(CandidateReader); ok {
+		return cr.ReadCandidates(r)
+	}
+	value, err := t.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+//parseAuthValue returns the token from a header or parameter value,
+//which must be prefixed by the scheme, if any. As described in RFC 6750,
+//the scheme is case-insensitive, and may be followed by one or more spaces.
+//If the scheme isn't followed by a token, ErrNoToken is returned.
+func parseAuthValue(value string, scheme string) (string, error) {
+	value = strings.TrimSpace(value)
+	//if empty, return appropriate error
+	if len(value) == 0 {
+		return "", ErrNoToken
+	}
+	if len(scheme) == 0 {
+		return value, nil
+	}
+
+	//ensure it has the scheme prefix, followed by whitespace or nothing
+	sep := strings.IndexAny(value, " \t")
+	if sep < 0 {
+		sep = len(value)
+	}
+	if !strings.EqualFold(value[:sep], scheme) {
+		return "", ErrUnsupportedTokenType
+	}
+
+	//return the token that follows the scheme prefix
+	token := strings.TrimLeft(value[sep:], " \t")
+	if len(token) == 0 {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
@@ -0,0 +1,187 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransports(t *testing.T) {
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	cookieTransport := &CookieTransport{Cookie: http.Cookie{Name: "session", Path: "/", HttpOnly: true}}
+	customHeader := &HeaderTransport{Name: "X-Session-Token"}
+
+	cases := []struct {
+		name      string
+		transport Transport
+	}{
+		{"default transport", DefaultTransport},
+		{"header transport", DefaultHeaderTransport},
+		{"header transport without scheme", customHeader},
+		{"cookie transport", cookieTransport},
+		{"combined transports", Transports(customHeader, cookieTransport)},
+	}
+
+	for _, c := range cases {
+		respRec := httptest.NewRecorder()
+		if err := c.transport.Write(respRec, token); err != nil {
+			t.Errorf("case %s: unexpected error writing token: %v", c.name, err)
+			continue
+		}
+		//copy the response headers and cookies into a request
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		for name, values := range respRec.Header() {
+			if name != "Set-Cookie" {
+				req.Header[name] = values
+			}
+		}
+		for _, cookie := range respRec.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+
+		actual, err := c.transport.Read(req)
+		if err != nil {
+			t.Errorf("case %s: unexpected error reading token: %v", c.name, err)
+		}
+		if actual != token.String() {
+			t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, token.String(), actual)
+		}
+
+		if _, err := c.transport.Read(httptest.NewRequest("GET", "http://example.com", nil)); err != ErrNoToken {
+			t.Errorf("case %s: incorrect error for request with no token: expected %v but got %v", c.name, ErrNoToken, err)
+		}
+	}
+}
+
+func TestQueryTransport(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com?auth=Bearer+abc", nil)
+	actual, err := DefaultQueryTransport.Read(req)
+	if err != nil {
+		t.Errorf("unexpected error reading token: %v", err)
+	}
+	if actual != "abc" {
+		t.Errorf("incorrect token: expected %s but got %s", "abc", actual)
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com?auth=Basic+abc", nil)
+	if _, err := DefaultQueryTransport.Read(req); err != ErrUnsupportedTokenType {
+		t.Errorf("incorrect error: expected %v but got %v", ErrUnsupportedTokenType, err)
+	}
+
+	respRec := httptest.NewRecorder()
+	token, _ := NewToken(testSigningKey)
+	DefaultQueryTransport.Write(respRec, token)
+	if len(respRec.Header()) > 0 {
+		t.Error("query transport wrote to the response")
+	}
+}
+
+func TestManagerWithTransport(t *testing.T) {
+	transport := &CookieTransport{Cookie: http.Cookie{Name: "session"}}
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false),
+		WithTransport(transport))
+	respRec := httptest.NewRecorder()
+	token, err := mgr.BeginSession(respRec, "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	if len(respRec.Header().Get(headerAuthorization)) > 0 {
+		t.Error("Authorization header added to response when using cookie transport")
+	}
+	if !strings.Contains(respRec.Header().Get("Set-Cookie"), token.String()) {
+		t.Error("token cookie not added to response")
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token.String()})
+	var state string
+	if _, err := mgr.GetState(req, &state); err != nil {
+		t.Errorf("unexpected error getting state: %v", err)
+	}
+	if state != "test state" {
+		t.Errorf("incorrect state: expected %s but got %s", "test state", state)
+	}
+}
+
+func TestParseAuthValue(t *testing.T) {
+	cases := []struct {
+		name          string
+		value         string
+		scheme        string
+		expected      string
+		expectedError error
+	}{
+		{"bearer token", "Bearer abc", authTypeBearer, "abc", nil},
+		{"lower case scheme", "bearer abc", authTypeBearer, "abc", nil},
+		{"upper case scheme", "BEARER abc", authTypeBearer, "abc", nil},
+		{"multiple spaces", "Bearer   abc", authTypeBearer, "abc", nil},
+		{"tab", "Bearer\tabc", authTypeBearer, "abc", nil},
+		{"surrounding whitespace", "  Bearer abc  ", authTypeBearer, "abc", nil},
+		{"scheme only", "Bearer", authTypeBearer, "", ErrNoToken},
+		{"scheme and spaces", "Bearer   ", authTypeBearer, "", ErrNoToken},
+		{"empty", "", authTypeBearer, "", ErrNoToken},
+		{"other scheme", "Basic abc", authTypeBearer, "", ErrUnsupportedTokenType},
+		{"scheme prefix", "Bearerabc", authTypeBearer, "", ErrUnsupportedTokenType},
+		{"no scheme", "abc", "", "abc", nil},
+	}
+	for _, c := range cases {
+		actual, err := parseAuthValue(c.value, c.scheme)
+		if actual != c.expected || err != c.expectedError {
+			t.Errorf("case %s: incorrect result: expected %q, %v but got %q, %v", c.name, c.expected, c.expectedError, actual, err)
+		}
+	}
+}
+
+func TestMultipleAuthorizationValues(t *testing.T) {
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, newMockStore(false))
+	token, err := mgr.BeginSession(httptest.NewRecorder(), "test state")
+	if err != nil {
+		t.Fatalf("unexpected error beginning session: %v", err)
+	}
+	other, err := NewToken([]byte("some other signing key"))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	bearer := authTypeBearer + " " + token.String()
+	otherBearer := authTypeBearer + " " + other.String()
+
+	cases := []struct {
+		name          string
+		headers       []string
+		expectError   bool
+		expectedError error
+	}{
+		{"basic header then bearer header", []string{"Basic dXNlcjpwYXNz", bearer}, false, nil},
+		{"bearer header then basic header", []string{bearer, "Basic dXNlcjpwYXNz"}, false, nil},
+		{"comma-joined values", []string{"Basic dXNlcjpwYXNz, " + bearer}, false, nil},
+		{"invalid bearer then valid bearer", []string{otherBearer, bearer}, false, nil},
+		{"only basic", []string{"Basic dXNlcjpwYXNz"}, true, ErrUnsupportedTokenType},
+		{"only invalid bearer", []string{"Basic dXNlcjpwYXNz", otherBearer}, true, nil},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		for _, h := range c.headers {
+			req.Header.Add(headerAuthorization, h)
+		}
+		tk, err := mgr.GetToken(req)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("case %s: did not receive expected error", c.name)
+			} else if c.expectedError != nil && err != c.expectedError {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if tk.String() != token.String() {
+			t.Errorf("case %s: incorrect token: expected %s but got %s", c.name, token.String(), tk.String())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package sessions
+
+//TypedStore wraps a Store so that session state of type T can be saved
+//and fetched with compile-time type checking, instead of passing untyped
+//pointers that might not match the type that was saved.
+type TypedStore[T any] struct {
+	//Store is the underlying store
+	Store Store
+}
+
+//NewTypedStore constructs a new TypedStore that wraps store
+func NewTypedStore[T any](store Store) *TypedStore[T] {
+	return &TypedStore[T]{Store: store}
+}
+
+//Save saves the session state, associated with the token
+func (ts *TypedStore[T]) Save(token Token, sessionState *T) error {
+	return ts.Store.Save(token, sessionState)
+}
+
+//Get returns the session state associated with the token.
+//If there is no state associated with the token, ErrStateNotFound is returned.
+func (ts *TypedStore[T]) Get(token Token) (*T, error) {
+	sessionState := new(T)
+	if err := ts.Store.Get(token, sessionState); err != nil {
+		return nil, err
+	}
+	return sessionState, nil
+}
+
+//Delete removes the session state associated with the token
+func (ts *TypedStore[T]) Delete(token Token) error {
+	return ts.Store.Delete(token)
+}
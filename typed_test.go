@@ -0,0 +1,36 @@
+package sessions
+
+import (
+	"testing"
+)
+
+func TestTypedStore(t *testing.T) {
+	type cart struct {
+		Items []string
+	}
+	token, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	store := NewTypedStore[cart](newMockStore(false))
+
+	if _, err := store.Get(token); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if err := store.Save(token, &cart{Items: []string{"item1"}}); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	state, err := store.Get(token)
+	if err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	if len(state.Items) != 1 || state.Items[0] != "item1" {
+		t.Errorf("incorrect state: %+v", state)
+	}
+	if err := store.Delete(token); err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if _, err := store.Get(token); err != ErrStateNotFound {
+		t.Errorf("incorrect error: expected %v but got %v", ErrStateNotFound, err)
+	}
+}
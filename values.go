@@ -0,0 +1,171 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func init() {
+	//register types commonly stored in Values that
+	//gob doesn't register automatically
+	gob.Register(time.Time{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+//Values is session state made up of named values, for apps that
+//don't want to define and version a session state struct. Values
+//are gob-encoded as interface values, so any types other than the
+//basic Go types must be registered using gob.Register.
+type Values map[string]interface{}
+
+//Set sets the named value
+func (v Values) Set(name string, value interface{}) {
+	v[name] = value
+}
+
+//Get returns the named value, or nil if it is not set
+func (v Values) Get(name string) interface{} {
+	return v[name]
+}
+
+//Delete removes the named value
+func (v Values) Delete(name string) {
+	delete(v, name)
+}
+
+//GetString returns the named value if it is a string,
+//or an empty string otherwise
+func (v Values) GetString(name string) string {
+	s, _ := v[name].(string)
+	return s
+}
+
+//GetInt returns the named value if it is an int,
+//or zero otherwise
+func (v Values) GetInt(name string) int {
+	i, _ := v[name].(int)
+	return i
+}
+
+//GetInt64 returns the named value if it is an int64,
+//or zero otherwise
+func (v Values) GetInt64(name string) int64 {
+	i, _ := v[name].(int64)
+	return i
+}
+
+//GetFloat64 returns the named value if it is a float64,
+//or zero otherwise
+func (v Values) GetFloat64(name string) float64 {
+	f, _ := v[name].(float64)
+	return f
+}
+
+//GetBool returns the named value if it is a bool,
+//or false otherwise
+func (v Values) GetBool(name string) bool {
+	b, _ := v[name].(bool)
+	return b
+}
+
+//GetTime returns the named value if it is a time.Time,
+//or the zero time otherwise
+func (v Values) GetTime(name string) time.Time {
+	t, _ := v[name].(time.Time)
+	return t
+}
+
+//Session is a session whose state is a set of Values. Use Manager.Session
+//to get the Session for a request, change its Values, and call Save to
+//save them. Like LazySession, a new session isn't begun until it is
+//first saved. If the manager's store is a FieldStore, only values changed
+//using Set or Delete are written by Save, so values should not be changed
+//by assigning to the Values map directly.
+type Session struct {
+	Values
+	mgr     *manager
+	w       http.ResponseWriter
+	r       *http.Request
+	token   Token
+	changed map[string]bool
+}
+
+//Session returns the Session for the request, with its Values populated
+//from the store. If the request has no session, or its session has
+//ended, an empty Session is returned, which begins a new session when
+//it is saved. Errors are returned only if the store fails.
+func (m *manager) Session(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s := &Session{Values: Values{}, mgr: m, w: w, r: r, changed: map[string]bool{}}
+	tk, err := m.GetToken(r)
+	if err != nil {
+		return s, nil
+	}
+	switch err := m.resume(r, tk, &s.Values); err {
+	case nil:
+		s.token = tk
+	case ErrStateNotFound, ErrSessionTooOld, ErrSessionExpired, ErrSessionRevoked, ErrSessionRejected:
+		s.Values = Values{}
+	default:
+		return nil, getStateError(err)
+	}
+	return s, nil
+}
+
+//Token returns the session's Token, or nil if the
+//session hasn't been saved yet
+func (s *Session) Token() Token {
+	return s.token
+}
+
+//Set sets the named value
+func (s *Session) Set(name string, value interface{}) {
+	s.Values.Set(name, value)
+	s.changed[name] = true
+}
+
+//Delete removes the named value
+func (s *Session) Delete(name string) {
+	s.Values.Delete(name)
+	s.changed[name] = true
+}
+
+//Save saves the session's Values to the store,
+//beginning a new session if necessary
+func (s *Session) Save() error {
+	if s.token == nil {
+		tk, err := s.mgr.BeginRequestSession(s.w, s.r, s.Values)
+		if err != nil {
+			return err
+		}
+		s.token = tk
+	} else if err := s.saveFields(); err != nil {
+		return err
+	}
+	s.changed = map[string]bool{}
+	return nil
+}
+
+//saveFields writes the changed values using the store's FieldStore
+//methods if it implements FieldStore, or the whole Values otherwise
+func (s *Session) saveFields() error {
+	fs, ok := s.mgr.store.(FieldStore)
+	if !ok || s.mgr.usesEnvelope() {
+		return s.mgr.UpdateState(s.token, s.Values)
+	}
+	for name := range s.changed {
+		var err error
+		if value, found := s.Values[name]; found {
+			err = fs.SetField(s.token, name, value)
+		} else {
+			err = fs.DeleteField(s.token, name)
+		}
+		if err != nil {
+			return fmt.Errorf("error saving session value %s: %v", name, err)
+		}
+	}
+	s.mgr.events.emit(EventUpdated, s.token)
+	return nil
+}
@@ -0,0 +1,161 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValues(t *testing.T) {
+	now := time.Now()
+	v := Values{}
+	v.Set("string", "test")
+	v.Set("int", 1)
+	v.Set("int64", int64(2))
+	v.Set("float64", 3.5)
+	v.Set("bool", true)
+	v.Set("time", now)
+
+	if v.GetString("string") != "test" || v.GetInt("int") != 1 || v.GetInt64("int64") != 2 ||
+		v.GetFloat64("float64") != 3.5 || !v.GetBool("bool") || !v.GetTime("time").Equal(now) {
+		t.Errorf("incorrect typed values: %v", v)
+	}
+	//getters should return zero values for missing or mistyped values
+	if v.GetString("int") != "" || v.GetInt("missing") != 0 || v.GetBool("string") || !v.GetTime("int").IsZero() {
+		t.Error("typed getters did not return zero values")
+	}
+	v.Delete("string")
+	if v.Get("string") != nil {
+		t.Error("value was not deleted")
+	}
+}
+
+func TestManagerSession(t *testing.T) {
+	store := newMockStore(false)
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+
+	//a request with no session should get an empty,
+	//unsaved session
+	respRec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	s, err := mgr.Session(respRec, req)
+	if err != nil {
+		t.Fatalf("unexpected error getting session: %v", err)
+	}
+	if s.Token() != nil || len(s.Values) != 0 {
+		t.Error("new session is not empty")
+	}
+	if len(store.entries) != 0 {
+		t.Error("session was begun before it was saved")
+	}
+
+	s.Set("cart", []string{"item1"})
+	s.Set("count", 1)
+	s.Set("seen", time.Now())
+	if err := s.Save(); err != nil {
+		t.Fatalf("unexpected error saving session: %v", err)
+	}
+	if s.Token() == nil || len(respRec.Header().Get(headerAuthorization)) == 0 {
+		t.Fatal("session was not begun when saved")
+	}
+
+	//the session should be resumed and updated
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	s, err = mgr.Session(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("unexpected error getting session: %v", err)
+	}
+	if s.GetInt("count") != 1 || s.GetTime("seen").IsZero() {
+		t.Errorf("incorrect values: %v", s.Values)
+	}
+	if cart, _ := s.Get("cart").([]string); len(cart) != 1 {
+		t.Errorf("incorrect cart: %v", s.Get("cart"))
+	}
+	s.Set("count", s.GetInt("count")+1)
+	if err := s.Save(); err != nil {
+		t.Fatalf("unexpected error saving session: %v", err)
+	}
+	s, _ = mgr.Session(httptest.NewRecorder(), req)
+	if s.GetInt("count") != 2 {
+		t.Errorf("incorrect count: expected 2 but got %d", s.GetInt("count"))
+	}
+
+	//an ended session should be replaced with an empty one
+	store.Delete(s.Token())
+	if s, err = mgr.Session(httptest.NewRecorder(), req); err != nil || s.Token() != nil {
+		t.Errorf("ended session was not replaced: %v", err)
+	}
+
+	//store errors should be returned
+	store.triggerError = true
+	if _, err := mgr.Session(httptest.NewRecorder(), req); err == nil {
+		t.Error("did not receive expected error from store")
+	}
+}
+
+//mockFieldStore is a FieldStore that records which fields were written
+type mockFieldStore struct {
+	*mockStore
+	fields []string
+}
+
+func (fs *mockFieldStore) GetField(token Token, name string, value interface{}) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (fs *mockFieldStore) SetField(token Token, name string, value interface{}) error {
+	values := Values{}
+	if err := fs.Get(token, &values); err != nil {
+		return err
+	}
+	values.Set(name, value)
+	fs.fields = append(fs.fields, name)
+	return fs.Save(token, values)
+}
+
+func (fs *mockFieldStore) DeleteField(token Token, name string) error {
+	values := Values{}
+	if err := fs.Get(token, &values); err != nil {
+		return err
+	}
+	values.Delete(name)
+	fs.fields = append(fs.fields, name)
+	return fs.Save(token, values)
+}
+
+func TestSessionFieldStore(t *testing.T) {
+	store := &mockFieldStore{mockStore: newMockStore(false)}
+	mgr := NewManager(DefaultIDLength, []string{string(testSigningKey)}, store)
+
+	respRec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	s, _ := mgr.Session(respRec, req)
+	s.Set("count", 1)
+	s.Set("name", "tester")
+	if err := s.Save(); err != nil {
+		t.Fatalf("unexpected error saving session: %v", err)
+	}
+	if len(store.fields) != 0 {
+		t.Error("fields were written when beginning the session")
+	}
+
+	//only the changed fields should be written
+	req.Header.Add(headerAuthorization, respRec.Header().Get(headerAuthorization))
+	s, _ = mgr.Session(httptest.NewRecorder(), req)
+	s.Set("count", 2)
+	s.Delete("name")
+	if err := s.Save(); err != nil {
+		t.Fatalf("unexpected error saving session: %v", err)
+	}
+	if len(store.fields) != 2 {
+		t.Errorf("incorrect fields written: %v", store.fields)
+	}
+	s, _ = mgr.Session(httptest.NewRecorder(), req)
+	if s.GetInt("count") != 2 || s.Get("name") != nil {
+		t.Errorf("incorrect values: %v", s.Values)
+	}
+	if err := s.Save(); err != nil || len(store.fields) != 2 {
+		t.Errorf("unchanged session wrote fields: %v", err)
+	}
+}
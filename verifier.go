@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"net/http"
+)
+
+//Verifier verifies session tokens without a Store, for services such as
+//API gateways and CDN workers that only need to reject requests with
+//missing, forged, or restricted tokens before forwarding them to an
+//origin that uses a Manager. A Verifier can't tell whether a token's
+//session is still active, so the origin must still check that.
+type Verifier struct {
+	//Transport reads tokens from requests. Defaults to
+	//DefaultTransport, but callers may adjust this after
+	//construction to match the origin's Manager.
+	Transport Transport
+	//Epochs is checked by VerifyAPIKey to reject API keys issued
+	//before their user's sessions were revoked. Callers must set
+	//this to the origin Manager's EpochStore to verify API keys.
+	Epochs EpochStore
+	//Revocations, if set, is checked by VerifyAPIKey to reject API
+	//keys minted from sessions that were revoked. Callers may set this
+	//to the origin Manager's RevocationList after construction.
+	Revocations RevocationList
+	keys        keyRing
+	tokenOpts   []TokenOption
+}
+
+//NewVerifier constructs a new Verifier that verifies tokens signed
+//with any of the signingKeys, using the TokenOptions. These must
+//match the keys and options used by the origin's Manager.
+func NewVerifier(signingKeys []string, opts ...TokenOption) *Verifier {
+	return NewVerifierWithKeys(newKeyRing(signingKeys), opts...)
+}
+
+//NewVerifierWithKeys is like NewVerifier, but accepts keys that declare
+//their own algorithms, matching those passed to the origin's Manager
+//using WithSigningKeys. Keys that can only verify tokens, such as ed25519
+//public keys, verify session tokens, but not API keys or attenuated tokens,
+//as those are signed with secrets derived from the origin's signing keys.
+//It panics if any key is invalid.
+func NewVerifierWithKeys(signingKeys []SigningKey, opts ...TokenOption) *Verifier {
+	keys := append(keyRing(nil), signingKeys...)
+	keys.mustCheck()
+	return &Verifier{
+		Transport: DefaultTransport,
+		keys:      keys,
+		tokenOpts: opts,
+	}
+}
+
+//Verify reads and verifies the token in the request, including any
+//caveats added with Attenuate. ErrNoToken is returned if the request
+//has no token. If the request has several candidate tokens, the
+//first one that verifies is returned.
+func (v *Verifier) Verify(r *http.Request) (Token, error) {
+	candidates, err := readCandidates(v.Transport, r)
+	if err != nil {
+		return nil, err
+	}
+	var tk Token
+	for _, b64tk := range candidates {
+		if tk, _, err = v.keys.verifyAttenuated(r, b64tk, v.tokenOpts); err == nil {
+			return tk, nil
+		}
+	}
+	return nil, err
+}
+
+//Handler returns middleware that responds with 401 Unauthorized
+//unless the request has a valid token, and otherwise calls next
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := v.Verify(r); err != nil {
+			http.Error(w, "invalid or missing session token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
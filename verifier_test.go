@@ -0,0 +1,52 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifier(t *testing.T) {
+	tk, err := NewToken(testSigningKey)
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	other, err := NewToken([]byte("some other signing key"))
+	if err != nil {
+		t.Fatalf("unexpected error generating token: %v", err)
+	}
+	verifier := NewVerifier([]string{"old signing key", string(testSigningKey)})
+	handler := verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name           string
+		authHeader     string
+		method         string
+		expectedStatus int
+	}{
+		{"valid", authTypeBearer + " " + tk.String(), "GET", http.StatusNoContent},
+		{"attenuated", authTypeBearer + " " + mustAttenuate(t, tk.String(), MethodCaveat("GET")), "GET", http.StatusNoContent},
+		{"caveat not satisfied", authTypeBearer + " " + mustAttenuate(t, tk.String(), MethodCaveat("GET")), "POST", http.StatusUnauthorized},
+		{"wrong key", authTypeBearer + " " + other.String(), "GET", http.StatusUnauthorized},
+		{"garbage", authTypeBearer + " garbage", "GET", http.StatusUnauthorized},
+		{"missing", "", "GET", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "http://example.com", nil)
+		if len(c.authHeader) > 0 {
+			req.Header.Set(headerAuthorization, c.authHeader)
+		}
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != c.expectedStatus {
+			t.Errorf("case %s: incorrect status: expected %d but got %d", c.name, c.expectedStatus, respRec.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	if _, err := verifier.Verify(req); err != ErrNoToken {
+		t.Errorf("incorrect error: expected %v but got %v", ErrNoToken, err)
+	}
+}
@@ -0,0 +1,187 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//HeaderWebhookSignature is the request header containing the
+//hex-encoded HMAC-SHA256 signature of the webhook request body
+const HeaderWebhookSignature = "X-Session-Signature"
+
+//webhookQueueSize is the number of events that may be queued
+//for delivery before further events are dropped
+const webhookQueueSize = 1024
+
+//ErrWebhookQueueFull is reported to OnError when an event
+//is dropped because too many events are waiting for delivery
+var ErrWebhookQueueFull = errors.New("webhook queue is full")
+
+//WebhookSink delivers session events to one or more webhook URLs.
+//Each event is POSTed as JSON, signed with HMAC-SHA256 using the sink's
+//signing key, so that receivers such as SIEM and user-activity systems
+//can verify that the event came from this server. To receive events
+//from a Manager, subscribe the sink's Send method:
+//
+//	sink := sessions.NewWebhookSink(webhookKey, "https://siem.example.com/hooks/sessions")
+//	defer sink.Close()
+//	mgr.Subscribe(sink.Send)
+//
+//Events are delivered by a background worker, so Send never blocks the request.
+type WebhookSink struct {
+	//Client is the http.Client used to POST events.
+	//Callers may adjust this after construction.
+	Client *http.Client
+	//Types are the event types that are delivered. Other event
+	//types are ignored. Callers may adjust this after construction.
+	Types []EventType
+	//RetryPolicy controls how failed deliveries are retried. Network
+	//errors and 5xx responses are retried, while other responses are not.
+	//Callers may adjust this after construction.
+	RetryPolicy RetryPolicy
+	//OnError is called with any errors that occur while delivering
+	//events, after all retries are exhausted. Callers may set this
+	//after construction.
+	OnError   func(err error)
+	key       []byte
+	urls      []string
+	queue     chan Event
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+//NewWebhookSink constructs a new WebhookSink that signs events with
+//signingKey and delivers them to urls. By default, only created,
+//ended, and revoked events are delivered, as accessed and updated
+//events can be very frequent. Call Close or CloseContext to flush pending
+//events before the process exits.
+func NewWebhookSink(signingKey string, urls ...string) *WebhookSink {
+	ws := &WebhookSink{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Types:       []EventType{EventCreated, EventEnded, EventRevoked},
+		RetryPolicy: DefaultRetryPolicy,
+		key:         []byte(signingKey),
+		urls:        urls,
+		queue:       make(chan Event, webhookQueueSize),
+	}
+	ws.wg.Add(1)
+	go ws.deliver()
+	return ws
+}
+
+//Send queues the event for delivery, if its type is one of the sink's Types.
+//If the queue is full, the event is dropped and ErrWebhookQueueFull
+//is reported to OnError. The sink may not be sent events after it is closed.
+func (ws *WebhookSink) Send(evt Event) {
+	if !ws.accepts(evt.Type) {
+		return
+	}
+	select {
+	case ws.queue <- evt:
+	default:
+		ws.reportError(ErrWebhookQueueFull)
+	}
+}
+
+//Close waits for any queued events to be delivered,
+//and stops the background worker
+func (ws *WebhookSink) Close() error {
+	return ws.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done,
+//returning its error, while the queued events continue to be delivered
+func (ws *WebhookSink) CloseContext(ctx context.Context) error {
+	ws.closeOnce.Do(func() {
+		close(ws.queue)
+	})
+	return waitContext(ctx, &ws.wg)
+}
+
+//SignWebhook returns the hex-encoded HMAC-SHA256 signature of body using
+//signingKey. Receivers can compare this to the HeaderWebhookSignature
+//request header, using hmac.Equal, to verify the request.
+func SignWebhook(signingKey string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(signingKey))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//accepts reports whether events of type t should be delivered
+func (ws *WebhookSink) accepts(t EventType) bool {
+	for _, accepted := range ws.Types {
+		if accepted == t {
+			return true
+		}
+	}
+	return false
+}
+
+//deliver posts queued events until the queue is closed
+func (ws *WebhookSink) deliver() {
+	defer ws.wg.Done()
+	for evt := range ws.queue {
+		body, err := json.Marshal(evt)
+		if err != nil {
+			ws.reportError(fmt.Errorf("error encoding webhook event: %v", err))
+			continue
+		}
+		sig := SignWebhook(string(ws.key), body)
+		for _, url := range ws.urls {
+			if err := ws.post(url, body, sig); err != nil {
+				ws.reportError(err)
+			}
+		}
+	}
+}
+
+//post posts the body to url, retrying according to the sink's RetryPolicy
+func (ws *WebhookSink) post(url string, body []byte, sig string) error {
+	var err error
+	var retry bool
+	for attempt := 0; attempt < ws.RetryPolicy.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(ws.RetryPolicy.backoff(attempt))
+		}
+		if retry, err = ws.postOnce(url, body, sig); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+//postOnce posts the body to url, returning any error,
+//and whether that error is worth retrying
+func (ws *WebhookSink) postOnce(url string, body []byte, sig string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookSignature, sig)
+	resp, err := ws.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("error posting webhook to %s: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500, fmt.Errorf("error posting webhook to %s: %s", url, resp.Status)
+	}
+	return false, nil
+}
+
+//reportError reports err to OnError, if set
+func (ws *WebhookSink) reportError(err error) {
+	if ws.OnError != nil {
+		ws.OnError(err)
+	}
+}
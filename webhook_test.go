@@ -0,0 +1,99 @@
+package sessions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	const key = "webhook key"
+	var mx sync.Mutex
+	var received []Event
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		attempts++
+		//fail the first attempt to exercise retries
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(HeaderWebhookSignature); sig != SignWebhook(key, body) {
+			t.Errorf("incorrect signature: %s", sig)
+		}
+		var evt Event
+		if err := json.Unmarshal(body, &evt); err != nil {
+			t.Errorf("error decoding event: %v", err)
+		}
+		received = append(received, evt)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(key, srv.URL)
+	sink.RetryPolicy.InitialBackoff = time.Millisecond
+	var errs []error
+	sink.OnError = func(err error) { errs = append(errs, err) }
+
+	now := time.Now()
+	sink.Send(Event{Type: EventCreated, SessionID: "1", Time: now})
+	sink.Send(Event{Type: EventAccessed, SessionID: "1", Time: now})
+	sink.Send(Event{Type: EventEnded, SessionID: "1", Time: now})
+	sink.Close()
+
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if len(received) != 2 {
+		t.Fatalf("incorrect number of events received: expected 2 but got %d", len(received))
+	}
+	if received[0].Type != EventCreated || received[1].Type != EventEnded {
+		t.Errorf("incorrect events received: %v", received)
+	}
+	if received[0].SessionID != "1" || !received[0].Time.Equal(now) {
+		t.Errorf("incorrect event received: %v", received[0])
+	}
+}
+
+func TestWebhookSinkErrors(t *testing.T) {
+	cases := []struct {
+		name             string
+		status           int
+		expectedAttempts int
+	}{
+		{"server error", http.StatusInternalServerError, 3},
+		{"client error", http.StatusBadRequest, 1},
+	}
+
+	for _, c := range cases {
+		var mx sync.Mutex
+		var attempts int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mx.Lock()
+			attempts++
+			mx.Unlock()
+			w.WriteHeader(c.status)
+		}))
+
+		sink := NewWebhookSink("webhook key", srv.URL)
+		sink.RetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		var errs int
+		sink.OnError = func(err error) { errs++ }
+		sink.Send(Event{Type: EventCreated, SessionID: "1", Time: time.Now()})
+		sink.Close()
+		srv.Close()
+
+		if attempts != c.expectedAttempts {
+			t.Errorf("case %s: incorrect number of attempts: expected %d but got %d", c.name, c.expectedAttempts, attempts)
+		}
+		if errs != 1 {
+			t.Errorf("case %s: incorrect number of errors: expected 1 but got %d", c.name, errs)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+//ErrWriteBehindQueueFull is returned from WriteBehindStore's Save and Touch
+//methods when the queue is full and the overflow policy is DropOnOverflow
+var ErrWriteBehindQueueFull = errors.New("write-behind queue is full")
+
+//OverflowPolicy controls what WriteBehindStore does
+//with writes when its queue is full
+type OverflowPolicy int
+
+const (
+	//BlockOnOverflow waits until there is room in the queue
+	BlockOnOverflow OverflowPolicy = iota
+	//WriteThroughOnOverflow writes to the inner store synchronously
+	WriteThroughOnOverflow
+	//DropOnOverflow drops the write, returning ErrWriteBehindQueueFull
+	DropOnOverflow
+)
+
+//DefaultWriteBehindQueueSize is a reasonable number of
+//writes for WriteBehindStore to queue
+const DefaultWriteBehindQueueSize = 1024
+
+//DefaultWriteBehindBatchSize is the default maximum number of
+//queued writes that WriteBehindStore flushes at a time
+const DefaultWriteBehindBatchSize = 100
+
+//WriteBehindStore is a Store that queues saves and touches, and writes them
+//to an inner store in batches on a background goroutine, so that requests
+//don't wait for them. Use it for extremely write-heavy endpoints, where
+//losing the last few updates to a session in a crash is acceptable.
+//
+//Each session has at most one queued write: saving a session that is
+//already queued replaces the queued state, so a session updated many times
+//between flushes is written only once. Gets return the queued state, so
+//a process always reads its own writes, but other processes sharing the
+//inner store don't see the writes until they're flushed. Deletes are
+//written synchronously, and discard any queued write, so that ended
+//sessions can't be resumed.
+//
+//Queued states are copied using the DefaultCodec, so they may be changed
+//after Save returns. Call Close or CloseContext to flush queued writes
+//before the process exits.
+type WriteBehindStore struct {
+	//BatchSize is the maximum number of queued writes flushed at a
+	//time. Callers may adjust this after construction.
+	BatchSize int
+	//OnError is called with any errors that occur while flushing
+	//queued writes. Callers may set this after construction.
+	OnError   func(err error)
+	inner     Store
+	queueSize int
+	overflow  OverflowPolicy
+	//saved, if non-nil, is called after each save
+	//is written to the inner store
+	saved func(token Token)
+	//mx protects pending, queue, and closed, and cond
+	//signals changes to them
+	mx      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]*pendingWrite
+	queue   []string
+	closed  bool
+	//flushMx is held while a batch is written, so that
+	//deletes are never overwritten by queued saves.
+	//When both are held, mx is locked first.
+	flushMx sync.Mutex
+	wg      sync.WaitGroup
+}
+
+//pendingWrite is a save or touch queued by a WriteBehindStore
+type pendingWrite struct {
+	token Token
+	//encoded and state are the encoded state and
+	//a copy of it, or nil for touches
+	encoded []byte
+	state   interface{}
+	//queued is true until the worker takes the write from the queue
+	queued bool
+}
+
+//NewWriteBehindStore constructs a new WriteBehindStore that queues up to
+//queueSize writes to inner, and handles further writes using overflow
+//while the queue is full.
+func NewWriteBehindStore(inner Store, queueSize int, overflow OverflowPolicy) *WriteBehindStore {
+	return newWriteBehindStore(inner, queueSize, overflow, nil)
+}
+
+//newWriteBehindStore is like NewWriteBehindStore, but calls saved,
+//if non-nil, after each save is written to the inner store
+func newWriteBehindStore(inner Store, queueSize int, overflow OverflowPolicy, saved func(token Token)) *WriteBehindStore {
+	ws := &WriteBehindStore{
+		BatchSize: DefaultWriteBehindBatchSize,
+		inner:     inner,
+		queueSize: queueSize,
+		overflow:  overflow,
+		saved:     saved,
+		pending:   make(map[string]*pendingWrite),
+	}
+	ws.cond = sync.NewCond(&ws.mx)
+	ws.wg.Add(1)
+	go ws.flush()
+	return ws
+}
+
+//Save queues the session state to be saved to the inner store
+func (ws *WriteBehindStore) Save(token Token, sessionState interface{}) error {
+	encoded, err := encodeState(sessionState)
+	if err != nil {
+		return err
+	}
+	state, err := copyState(sessionState, encoded)
+	if err != nil {
+		return err
+	}
+	return ws.enqueue(&pendingWrite{token: token, encoded: encoded, state: state})
+}
+
+//Get gets the session state queued to be saved, or
+//gets it from the inner store if there is none
+func (ws *WriteBehindStore) Get(token Token, sessionState interface{}) error {
+	encoded := ws.pendingState(token)
+	if encoded == nil {
+		return ws.inner.Get(token, sessionState)
+	}
+	return decodePending(encoded, sessionState)
+}
+
+//Delete discards any queued write for the session, and
+//deletes the session state from the inner store
+func (ws *WriteBehindStore) Delete(token Token) error {
+	ws.mx.Lock()
+	ws.discard(token)
+	ws.mx.Unlock()
+
+	//wait for any batch being flushed, as it may save the state
+	ws.flushMx.Lock()
+	defer ws.flushMx.Unlock()
+	return ws.inner.Delete(token)
+}
+
+//Touch queues the expiry time of the session state to be reset in the
+//inner store, if it implements Toucher. Touches of sessions with queued
+//saves are ignored, as the saves reset the expiry time. Since the touch
+//is written later, ErrStateNotFound is never returned.
+func (ws *WriteBehindStore) Touch(token Token) error {
+	if _, ok := ws.inner.(Toucher); !ok {
+		return nil
+	}
+	return ws.enqueue(&pendingWrite{token: token})
+}
+
+//Peek peeks at the session state queued to be saved,
+//or at the state in the inner store if there is none
+func (ws *WriteBehindStore) Peek(token Token, sessionState interface{}) error {
+	encoded := ws.pendingState(token)
+	if encoded == nil {
+		return peek(ws.inner, token, sessionState)
+	}
+	return decodePending(encoded, sessionState)
+}
+
+//GetAndTouch gets the session state queued to be saved, which resets the
+//expiry time when it is written, or gets and touches the state in the inner
+//store if there is none. The ttl applies only to states in the inner store.
+func (ws *WriteBehindStore) GetAndTouch(token Token, sessionState interface{}, ttl time.Duration) error {
+	encoded := ws.pendingState(token)
+	if encoded == nil {
+		return getAndTouch(ws.inner, token, sessionState, ttl)
+	}
+	if err := ws.Touch(token); err != nil {
+		return err
+	}
+	return decodePending(encoded, sessionState)
+}
+
+//TTL gets the TTL of the session state in the inner store.
+//Queued saves are not reflected until they are flushed.
+func (ws *WriteBehindStore) TTL(token Token) (time.Duration, error) {
+	return storeTTL(ws.inner, token)
+}
+
+//Exists checks whether the session state is queued to
+//be saved, or whether the inner store has it
+func (ws *WriteBehindStore) Exists(token Token) (bool, error) {
+	if ws.pendingState(token) != nil {
+		return true, nil
+	}
+	return exists(ws.inner, token)
+}
+
+//Scan scans the inner store. Sessions whose first
+//save is still queued are not included.
+func (ws *WriteBehindStore) Scan(fn func(token Token) error) error {
+	return scan(ws.inner, fn)
+}
+
+//Replace discards any queued writes for both sessions, and
+//replaces the session state in the inner store synchronously
+func (ws *WriteBehindStore) Replace(token Token, sessionState interface{}, replaced Token) error {
+	ws.mx.Lock()
+	ws.discard(token, replaced)
+	ws.mx.Unlock()
+
+	//wait for any batch being flushed, as it may save either state
+	ws.flushMx.Lock()
+	defer ws.flushMx.Unlock()
+	return replace(ws.inner, token, sessionState, replaced)
+}
+
+//Ping pings the inner store
+func (ws *WriteBehindStore) Ping(ctx context.Context) error {
+	return ping(ctx, ws.inner)
+}
+
+//Close waits for all queued writes to be flushed,
+//and stops the background worker
+func (ws *WriteBehindStore) Close() error {
+	return ws.CloseContext(context.Background())
+}
+
+//CloseContext is like Close, but stops waiting when ctx is done,
+//returning its error, while the queued writes continue to be flushed.
+//Writes made after the store is closed are written synchronously.
+func (ws *WriteBehindStore) CloseContext(ctx context.Context) error {
+	ws.mx.Lock()
+	ws.closed = true
+	ws.cond.Broadcast()
+	ws.mx.Unlock()
+	return waitContext(ctx, &ws.wg)
+}
+
+//enqueue queues the write, replacing any queued write for the same
+//session, or handles it using the overflow policy if the queue is full
+func (ws *WriteBehindStore) enqueue(pw *pendingWrite) error {
+	id := pw.token.ID().String()
+	ws.mx.Lock()
+	for {
+		current := ws.pending[id]
+		if current != nil && current.queued {
+			//touches don't replace queued saves
+			if pw.encoded != nil {
+				current.encoded, current.state = pw.encoded, pw.state
+			}
+			ws.mx.Unlock()
+			return nil
+		}
+		if ws.closed {
+			return ws.writeThrough(pw, current)
+		}
+		if len(ws.queue) < ws.queueSize {
+			if current != nil && pw.encoded == nil {
+				//a save of the state being flushed also
+				//resets its expiry, and keeps it readable
+				pw.encoded, pw.state = current.encoded, current.state
+			}
+			pw.queued = true
+			ws.pending[id] = pw
+			ws.queue = append(ws.queue, id)
+			ws.cond.Broadcast()
+			ws.mx.Unlock()
+			return nil
+		}
+		switch ws.overflow {
+		case WriteThroughOnOverflow:
+			return ws.writeThrough(pw, current)
+		case DropOnOverflow:
+			ws.mx.Unlock()
+			return ErrWriteBehindQueueFull
+		}
+		ws.cond.Wait()
+	}
+}
+
+//discard discards any queued writes for the sessions, freeing their
+//places in the queue. It must be called with mx locked.
+func (ws *WriteBehindStore) discard(tokens ...Token) {
+	for _, token := range tokens {
+		id := token.ID().String()
+		pw := ws.pending[id]
+		if pw == nil {
+			continue
+		}
+		delete(ws.pending, id)
+		if !pw.queued {
+			//the write is being flushed, so it's no longer in the queue
+			continue
+		}
+		for i, queued := range ws.queue {
+			if queued == id {
+				ws.queue = append(ws.queue[:i], ws.queue[i+1:]...)
+				break
+			}
+		}
+		ws.cond.Broadcast()
+	}
+}
+
+//flush writes queued writes to the inner store in batches,
+//until the store is closed and the queue is empty
+func (ws *WriteBehindStore) flush() {
+	defer ws.wg.Done()
+	for {
+		ws.mx.Lock()
+		for len(ws.queue) == 0 && !ws.closed {
+			ws.cond.Wait()
+		}
+		if len(ws.queue) == 0 {
+			ws.mx.Unlock()
+			return
+		}
+		n := len(ws.queue)
+		if ws.BatchSize > 0 && n > ws.BatchSize {
+			n = ws.BatchSize
+		}
+		batch := make([]*pendingWrite, 0, n)
+		writes := make([]pendingWrite, 0, n)
+		for _, id := range ws.queue[:n] {
+			pw := ws.pending[id]
+			pw.queued = false
+			batch = append(batch, pw)
+			writes = append(writes, *pw)
+		}
+		ws.queue = ws.queue[n:]
+		ws.cond.Broadcast()
+		//take flushMx before releasing mx, so that a delete of a session
+		//in the batch either discards it before it's taken, or waits for
+		//the batch to be written before deleting the state
+		ws.flushMx.Lock()
+		ws.mx.Unlock()
+
+		for i := range writes {
+			if err := ws.write(&writes[i]); err != nil && ws.OnError != nil {
+				ws.OnError(err)
+			}
+		}
+		ws.flushMx.Unlock()
+
+		//writes replaced while being flushed are queued again,
+		//so only remove those that are unchanged
+		ws.mx.Lock()
+		for _, pw := range batch {
+			id := pw.token.ID().String()
+			if ws.pending[id] == pw && !pw.queued {
+				delete(ws.pending, id)
+			}
+		}
+		ws.mx.Unlock()
+	}
+}
+
+//pendingState returns the encoded session state queued
+//to be saved, or nil if there is none
+func (ws *WriteBehindStore) pendingState(token Token) []byte {
+	ws.mx.Lock()
+	defer ws.mx.Unlock()
+	if pw := ws.pending[token.ID().String()]; pw != nil {
+		return pw.encoded
+	}
+	return nil
+}
+
+//decodePending decodes the queued state into sessionState, if non-nil
+func decodePending(encoded []byte, sessionState interface{}) error {
+	if sessionState == nil {
+		return nil
+	}
+	return decodeState(encoded, sessionState)
+}
+
+//writeThrough writes the save or touch to the inner store synchronously,
+//after any batch being flushed, which may include current, an earlier
+//write of the same session. It must be called with mx locked, which it
+//unlocks.
+func (ws *WriteBehindStore) writeThrough(pw *pendingWrite, current *pendingWrite) error {
+	if current != nil && pw.encoded != nil {
+		//the earlier write is no longer the latest state
+		delete(ws.pending, pw.token.ID().String())
+	}
+	ws.mx.Unlock()
+	ws.flushMx.Lock()
+	defer ws.flushMx.Unlock()
+	return ws.write(pw)
+}
+
+//write writes the save or touch to the inner store
+func (ws *WriteBehindStore) write(pw *pendingWrite) error {
+	if pw.encoded == nil {
+		err := ws.inner.(Toucher).Touch(pw.token)
+		if err != nil && err != ErrStateNotFound {
+			return fmt.Errorf("error touching session state: %v", err)
+		}
+		return nil
+	}
+	if err := ws.inner.Save(pw.token, pw.state); err != nil {
+		return fmt.Errorf("error saving session state: %v", err)
+	}
+	if ws.saved != nil {
+		ws.saved(pw.token)
+	}
+	return nil
+}
+
+//copyState returns a pointer to a new value of the same type as
+//sessionState, populated by decoding the encoded state
+func copyState(sessionState interface{}, encoded []byte) (interface{}, error) {
+	t := reflect.TypeOf(sessionState)
+	if t == nil {
+		return nil, fmt.Errorf("session state must not be nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	state := reflect.New(t).Interface()
+	if err := DefaultCodec.Decode(encoded, state); err != nil {
+		return nil, fmt.Errorf("error copying session state: %v", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,285 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//gatedStore is a Store that blocks saves and touches until its gate
+//is opened, and counts them
+type gatedStore struct {
+	*mockStore
+	gate    chan struct{}
+	started chan struct{}
+	mx      sync.Mutex
+	saves   int
+	touches int
+}
+
+func newGatedStore() *gatedStore {
+	return &gatedStore{
+		mockStore: newMockStore(false),
+		gate:      make(chan struct{}),
+		started:   make(chan struct{}, 100),
+	}
+}
+
+func (gs *gatedStore) Save(token Token, sessionState interface{}) error {
+	gs.started <- struct{}{}
+	<-gs.gate
+	gs.mx.Lock()
+	gs.saves++
+	gs.mx.Unlock()
+	return gs.mockStore.Save(token, sessionState)
+}
+
+func (gs *gatedStore) Touch(token Token) error {
+	gs.started <- struct{}{}
+	<-gs.gate
+	gs.mx.Lock()
+	defer gs.mx.Unlock()
+	gs.touches++
+	return nil
+}
+
+func newTestTokens(t *testing.T, n int) []Token {
+	tokens := make([]Token, n)
+	for i := range tokens {
+		tk, err := NewToken(testSigningKey)
+		if err != nil {
+			t.Fatalf("unexpected error generating token: %v", err)
+		}
+		tokens[i] = tk
+	}
+	return tokens
+}
+
+//queued returns the number of writes in the store's queue
+func (ws *WriteBehindStore) queued() int {
+	ws.mx.Lock()
+	defer ws.mx.Unlock()
+	return len(ws.queue)
+}
+
+func TestWriteBehindStore(t *testing.T) {
+	inner := newGatedStore()
+	store := NewWriteBehindStore(inner, 10, BlockOnOverflow)
+	tks := newTestTokens(t, 2)
+
+	//hold up the worker with the first session
+	if err := store.Save(tks[0], "first state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	<-inner.started
+
+	//queued saves of the same session should be coalesced,
+	//and visible to gets before they're flushed
+	state := "second state"
+	for i := 0; i < 5; i++ {
+		if err := store.Save(tks[1], &state); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+	}
+	state = "changed after save"
+	var got string
+	if err := store.Get(tks[1], &got); err != nil || got != "second state" {
+		t.Errorf("incorrect queued state: expected second state, <nil> but got %s, %v", got, err)
+	}
+	if err := store.Get(tks[0], &got); err != nil || got != "first state" {
+		t.Errorf("incorrect state being flushed: expected first state, <nil> but got %s, %v", got, err)
+	}
+
+	//touches of sessions with queued saves should be ignored
+	if err := store.Touch(tks[1]); err != nil {
+		t.Fatalf("unexpected error touching state: %v", err)
+	}
+
+	close(inner.gate)
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error closing store: %v", err)
+	}
+	if inner.saves != 2 || inner.touches != 0 {
+		t.Errorf("incorrect number of writes: expected 2 saves and 0 touches but got %d and %d", inner.saves, inner.touches)
+	}
+	if err := inner.Get(tks[1], &got); err != nil || got != "second state" {
+		t.Errorf("incorrect flushed state: expected second state, <nil> but got %s, %v", got, err)
+	}
+
+	//writes after closing should be synchronous
+	if err := store.Save(tks[0], "after close"); err != nil {
+		t.Fatalf("unexpected error saving after close: %v", err)
+	}
+	if err := inner.Get(tks[0], &got); err != nil || got != "after close" {
+		t.Errorf("incorrect state saved after close: expected after close, <nil> but got %s, %v", got, err)
+	}
+
+	//deletes should discard queued writes
+	store = NewWriteBehindStore(inner, 10, BlockOnOverflow)
+	store.BatchSize = 1
+	if err := store.Touch(tks[1]); err != nil {
+		t.Fatalf("unexpected error touching state: %v", err)
+	}
+	if err := store.Save(tks[0], "deleted state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	if err := store.Delete(tks[0]); err != nil {
+		t.Fatalf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error closing store: %v", err)
+	}
+	if err := store.Get(tks[0], &got); err != ErrStateNotFound {
+		t.Errorf("incorrect error getting deleted state: expected %v but got %v", ErrStateNotFound, err)
+	}
+	if inner.touches != 1 {
+		t.Errorf("incorrect number of touches: expected 1 but got %d", inner.touches)
+	}
+}
+
+func TestWriteBehindStoreOverflow(t *testing.T) {
+	cases := []struct {
+		name        string
+		overflow    OverflowPolicy
+		expectedErr error
+		expectSaved bool
+	}{
+		{"block", BlockOnOverflow, nil, true},
+		{"write through", WriteThroughOnOverflow, nil, true},
+		{"drop", DropOnOverflow, ErrWriteBehindQueueFull, false},
+	}
+
+	for _, c := range cases {
+		inner := newGatedStore()
+		store := NewWriteBehindStore(inner, 1, c.overflow)
+		tks := newTestTokens(t, 3)
+
+		//one save is being flushed, and another fills the queue
+		if err := store.Save(tks[0], "test state"); err != nil {
+			t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+		<-inner.started
+		if err := store.Save(tks[1], "test state"); err != nil {
+			t.Fatalf("case %s: unexpected error saving state: %v", c.name, err)
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			result <- store.Save(tks[2], "overflow state")
+		}()
+		select {
+		case err := <-result:
+			if c.overflow != DropOnOverflow {
+				t.Errorf("case %s: save returned while the queue was full: %v", c.name, err)
+			}
+			if err != c.expectedErr {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedErr, err)
+			}
+		case <-time.After(20 * time.Millisecond):
+			if c.overflow == DropOnOverflow {
+				t.Errorf("case %s: save blocked while the queue was full", c.name)
+			}
+			close(inner.gate)
+			if err := <-result; err != c.expectedErr {
+				t.Errorf("case %s: incorrect error: expected %v but got %v", c.name, c.expectedErr, err)
+			}
+		}
+		if c.overflow == DropOnOverflow {
+			close(inner.gate)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := store.CloseContext(ctx); err != nil {
+			t.Fatalf("case %s: unexpected error closing store: %v", c.name, err)
+		}
+		cancel()
+		var got string
+		err := inner.Get(tks[2], &got)
+		if saved := err == nil && got == "overflow state"; saved != c.expectSaved {
+			t.Errorf("case %s: incorrect overflow result: expected saved %t but got %s, %v", c.name, c.expectSaved, got, err)
+		}
+	}
+}
+
+func TestWriteBehindStoreDeleteDuringFlush(t *testing.T) {
+	inner := newMockStore(false)
+	store := NewWriteBehindStore(inner, 2, WriteThroughOnOverflow)
+	store.BatchSize = 1
+
+	//deletes racing with the flush of queued saves, while writes
+	//through contend for the flush, must never be overwritten
+	var wg sync.WaitGroup
+	deleted := make(chan Token, 1000)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, tk := range newTestTokens(t, 100) {
+				if err := store.Save(tk, "test state"); err != nil {
+					t.Errorf("unexpected error saving state: %v", err)
+					return
+				}
+				if err := store.Delete(tk); err != nil {
+					t.Errorf("unexpected error deleting state: %v", err)
+					return
+				}
+				deleted <- tk
+			}
+		}()
+	}
+	wg.Wait()
+	close(deleted)
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error closing store: %v", err)
+	}
+	for tk := range deleted {
+		if err := inner.Get(tk, nil); err != ErrStateNotFound {
+			t.Errorf("deleted state was saved: expected %v but got %v", ErrStateNotFound, err)
+			break
+		}
+	}
+}
+
+func TestWriteBehindStoreDeleteFreesQueue(t *testing.T) {
+	inner := newGatedStore()
+	store := NewWriteBehindStore(inner, 2, DropOnOverflow)
+	tks := newTestTokens(t, 4)
+
+	//hold up the worker with the first session
+	if err := store.Save(tks[0], "first state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	<-inner.started
+
+	//deleting a queued session should free its place in the queue,
+	//even while the delete waits for the batch being flushed
+	if err := store.Save(tks[1], "deleted state"); err != nil {
+		t.Fatalf("unexpected error saving state: %v", err)
+	}
+	deleted := make(chan error, 1)
+	go func() { deleted <- store.Delete(tks[1]) }()
+	deadline := time.Now().Add(time.Second)
+	for store.queued() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, tk := range tks[2:] {
+		if err := store.Save(tk, "test state"); err != nil {
+			t.Errorf("unexpected error saving state: %v", err)
+		}
+	}
+
+	close(inner.gate)
+	if err := <-deleted; err != nil {
+		t.Errorf("unexpected error deleting state: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error closing store: %v", err)
+	}
+	if inner.saves != 3 {
+		t.Errorf("incorrect number of saves: expected 3 but got %d", inner.saves)
+	}
+	if err := inner.Get(tks[1], nil); err != ErrStateNotFound {
+		t.Errorf("deleted state was saved: expected %v but got %v", ErrStateNotFound, err)
+	}
+}